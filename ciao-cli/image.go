@@ -112,7 +112,7 @@ func (cmd *imageAddCommand) parseArgs(args []string) []string {
 	cmd.Flag.Var(&cmd.diskFormat, "disk-format", "Image Disk Format (ami, ari, aki, vhd, vmdk, raw, qcow2, vdi, iso")
 	cmd.Flag.IntVar(&cmd.minDiskSize, "min-disk-size", 0, "Minimum disk size in GB")
 	cmd.Flag.IntVar(&cmd.minRAMSize, "min-ram-size", 0, "Minimum amount of RAM in MB")
-	cmd.Flag.StringVar(&cmd.visibility, "visibility", "public", "Image visibility (public or private)")
+	cmd.Flag.StringVar(&cmd.visibility, "visibility", "private", "Image visibility (public, private or shared)")
 	cmd.Flag.BoolVar(&cmd.protected, "protected", false, "Prevent an image from being deleted")
 	cmd.Flag.StringVar(&cmd.tags, "tags", "", "Image tags separated by comma")
 	cmd.Flag.StringVar(&cmd.file, "file", "", "Image file to upload")
@@ -131,14 +131,7 @@ func (cmd *imageAddCommand) run(args []string) error {
 		fatalf("Could not get Image service client [%s]\n", err)
 	}
 
-	var visibility images.ImageVisibility
-	if cmd.visibility == "public" {
-		visibility = images.ImageVisibilityPublic
-	} else if cmd.visibility == "private" {
-		visibility = images.ImageVisibilityPrivate
-	} else {
-		fatalf("Image visibility should be public or private")
-	}
+	visibility := imageVisibility(cmd.visibility)
 
 	opts := images.CreateOpts{
 		Name:             cmd.name,
@@ -426,7 +419,7 @@ The modify flags are:
 
 func (cmd *imageModifyCommand) parseArgs(args []string) []string {
 	cmd.Flag.StringVar(&cmd.name, "name", "", "Image Name")
-	cmd.Flag.StringVar(&cmd.visibility, "visibility", "public", "Image visibility (public or private)")
+	cmd.Flag.StringVar(&cmd.visibility, "visibility", "", "Image visibility (public, private or shared)")
 	cmd.Flag.StringVar(&cmd.tags, "tags", "", "Image tags separated by comma")
 	cmd.Flag.StringVar(&cmd.image, "image", "", "Image UUID")
 	cmd.Flag.Usage = func() { cmd.usage() }
@@ -446,16 +439,8 @@ func (cmd *imageModifyCommand) run(args []string) error {
 
 	var opts images.UpdateOpts
 	if cmd.visibility != "" {
-		var visibility images.ImageVisibility
-		if cmd.visibility == "public" {
-			visibility = images.ImageVisibilityPublic
-		} else if cmd.visibility == "private" {
-			visibility = images.ImageVisibilityPrivate
-		} else {
-			fatalf("Image visibility should be public or private")
-		}
-		v := images.UpdateVisibility{
-			Visibility: visibility,
+		v := replaceImageVisibility{
+			Visibility: imageVisibility(cmd.visibility),
 		}
 		opts = append(opts, v)
 	}
@@ -485,6 +470,31 @@ func (cmd *imageModifyCommand) run(args []string) error {
 	return nil
 }
 
+func imageVisibility(visibility string) images.ImageVisibility {
+	v := images.ImageVisibility(visibility)
+	switch v {
+	case images.ImageVisibilityPublic, images.ImageVisibilityPrivate, images.ImageVisibilityShared:
+		return v
+	}
+
+	fatalf("Image visibility should be public, private or shared")
+	return ""
+}
+
+// replaceImageVisibility implements images.Patch. gophercloud's
+// UpdateVisibility sends an invalid patch operation.
+type replaceImageVisibility struct {
+	Visibility images.ImageVisibility
+}
+
+func (r replaceImageVisibility) ToImagePatchMap() map[string]interface{} {
+	return map[string]interface{}{
+		"op":    "replace",
+		"path":  "/visibility",
+		"value": r.Visibility,
+	}
+}
+
 func dumpImage(i *images.Image) {
 	fmt.Printf("\tName             [%s]\n", i.Name)
 	fmt.Printf("\tSize             [%d bytes]\n", i.SizeBytes)
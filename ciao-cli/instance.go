@@ -61,9 +61,11 @@ const (
 var instanceCommand = &command{
 	SubCommands: map[string]subCommand{
 		"add":     new(instanceAddCommand),
+		"console": new(instanceConsoleCommand),
 		"delete":  new(instanceDeleteCommand),
 		"list":    new(instanceListCommand),
 		"show":    new(instanceShowCommand),
+		"resize":  new(instanceResizeCommand),
 		"restart": new(instanceRestartCommand),
 		"stop":    new(instanceStopCommand),
 	},
@@ -296,6 +298,161 @@ func startStopInstance(instance string, stop bool) error {
 	return nil
 }
 
+type instanceConsoleCommand struct {
+	Flag     flag.FlagSet
+	instance string
+	length   int
+}
+
+func (cmd *instanceConsoleCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] instance console [flags]
+
+Show the console output of a Ciao instance
+
+The console flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *instanceConsoleCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.instance, "instance", "", "Instance UUID")
+	cmd.Flag.IntVar(&cmd.length, "length", 0, "Number of lines to show, 0 shows the whole console log")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *instanceConsoleCommand) run(args []string) error {
+	if *tenantID == "" {
+		errorf("Missing required -tenant-id parameter")
+		cmd.usage()
+	}
+
+	if cmd.instance == "" {
+		errorf("Missing required -instance parameter")
+		cmd.usage()
+	}
+
+	var req compute.GetConsoleOutputRequest
+	if cmd.length > 0 {
+		req.GetConsoleOutput.Length = &cmd.length
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	url := buildComputeURL("%s/servers/%s/action", *tenantID, cmd.instance)
+
+	resp, err := sendHTTPRequest("POST", url, nil, bytes.NewReader(b))
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fatalf("Failed to get instance console: %s", resp.Status)
+	}
+
+	var output compute.GetConsoleOutputResponse
+	err = unmarshalHTTPResponse(resp, &output)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	fmt.Print(output.Output)
+	return nil
+}
+
+type instanceResizeCommand struct {
+	Flag     flag.FlagSet
+	instance string
+	workload string
+	confirm  bool
+	revert   bool
+}
+
+func (cmd *instanceResizeCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] instance resize [flags]
+
+Resize a stopped Ciao instance to the resources of another workload, or
+confirm or revert a previous resize
+
+The resize flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *instanceResizeCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.instance, "instance", "", "Instance UUID")
+	cmd.Flag.StringVar(&cmd.workload, "workload", "", "Workload UUID to resize the instance to")
+	cmd.Flag.BoolVar(&cmd.confirm, "confirm", false, "Confirm the last resize of the instance")
+	cmd.Flag.BoolVar(&cmd.revert, "revert", false, "Revert the last resize of the instance")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *instanceResizeCommand) run(args []string) error {
+	if *tenantID == "" {
+		errorf("Missing required -tenant-id parameter")
+		cmd.usage()
+	}
+
+	if cmd.instance == "" {
+		errorf("Missing required -instance parameter")
+		cmd.usage()
+	}
+
+	var action interface{}
+	switch {
+	case cmd.confirm && cmd.revert:
+		errorf("Only one of -confirm and -revert can be specified")
+		cmd.usage()
+	case cmd.confirm:
+		action = map[string]interface{}{"confirmResize": nil}
+	case cmd.revert:
+		action = map[string]interface{}{"revertResize": nil}
+	case cmd.workload == "":
+		errorf("Missing required -workload parameter")
+		cmd.usage()
+	default:
+		var req compute.ResizeServerRequest
+		req.Resize.FlavorRef = cmd.workload
+		action = req
+	}
+
+	b, err := json.Marshal(action)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	url := buildComputeURL("%s/servers/%s/action", *tenantID, cmd.instance)
+
+	resp, err := sendHTTPRequest("POST", url, nil, bytes.NewReader(b))
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusAccepted {
+		fatalf("Instance resize failed: %s", resp.Status)
+	}
+
+	switch {
+	case cmd.confirm:
+		fmt.Printf("Resize of instance %s confirmed\n", cmd.instance)
+	case cmd.revert:
+		fmt.Printf("Resize of instance %s reverted\n", cmd.instance)
+	default:
+		fmt.Printf("Instance %s resized\n", cmd.instance)
+	}
+	return nil
+}
+
 type instanceListCommand struct {
 	Flag     flag.FlagSet
 	workload string
@@ -17,18 +17,25 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"text/template"
 	"time"
 
 	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/openstack/block"
+	"github.com/01org/ciao/openstack/compute"
+	"github.com/rackspace/gophercloud"
 )
 
 var tenantCommand = &command{
 	SubCommands: map[string]subCommand{
-		"list": new(tenantListCommand),
+		"list":  new(tenantListCommand),
+		"quota": new(tenantQuotaCommand),
 	},
 }
 
@@ -252,3 +259,211 @@ func listTenantResources(t *template.Template) error {
 
 	return nil
 }
+
+type tenantQuotaCommand struct {
+	Flag      flag.FlagSet
+	tenant    string
+	instances int
+	vcpus     int
+	memory    int
+	disk      int
+	volumes   int
+	reset     bool
+	template  string
+}
+
+type tenantQuotas struct {
+	ID        string
+	Instances compute.QuotaDetail
+	VCPUs     compute.QuotaDetail
+	Memory    compute.QuotaDetail
+	Disk      compute.QuotaDetail
+	Volumes   compute.QuotaDetail
+}
+
+func (cmd *tenantQuotaCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] tenant quota [flags]
+
+Show, update or reset the quotas of a tenant
+
+Without any limit flag the quotas and their usage are shown. Updating or
+resetting quotas is a privileged operation. A limit of -1 means unlimited.
+
+The quota flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on the following struct:
+
+struct {
+	ID        string // Tenant ID
+	Instances struct {
+		InUse    int // Current usage
+		Limit    int // Maximum allowed, -1 for unlimited
+		Reserved int // Not currently used
+	}
+	VCPUs     struct // Same as Instances
+	Memory    struct // Same as Instances, in MB
+	Disk      struct // Same as Instances, in MB
+	Volumes   struct // Same as Instances
+}
+`)
+	os.Exit(2)
+}
+
+func (cmd *tenantQuotaCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.tenant, "tenant", "", "Specify to manage the quotas of a tenant other than -tenant-id")
+	cmd.Flag.IntVar(&cmd.instances, "instances", -1, "Maximum number of instances")
+	cmd.Flag.IntVar(&cmd.vcpus, "vcpus", -1, "Maximum number of CPUs")
+	cmd.Flag.IntVar(&cmd.memory, "mem-mb", -1, "Maximum amount of RAM in MB")
+	cmd.Flag.IntVar(&cmd.disk, "disk-mb", -1, "Maximum amount of disk space in MB")
+	cmd.Flag.IntVar(&cmd.volumes, "volumes", -1, "Maximum number of volumes")
+	cmd.Flag.BoolVar(&cmd.reset, "reset", false, "Reset all quotas to unlimited")
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *tenantQuotaCommand) run(args []string) error {
+	if *tenantID == "" {
+		fatalf("Missing required -tenant-id parameter")
+	}
+
+	if cmd.tenant == "" {
+		cmd.tenant = *tenantID
+	}
+
+	// only the limits explicitly passed on the command line are updated
+	var computeQuotas compute.QuotaSetUpdate
+	var blockQuotas block.QuotaSetUpdate
+	update := false
+
+	cmd.Flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "instances":
+			computeQuotas.Instances = &cmd.instances
+		case "vcpus":
+			computeQuotas.Cores = &cmd.vcpus
+		case "mem-mb":
+			computeQuotas.RAM = &cmd.memory
+		case "disk-mb":
+			computeQuotas.Disk = &cmd.disk
+		case "volumes":
+			blockQuotas.Volumes = &cmd.volumes
+		default:
+			return
+		}
+		update = true
+	})
+
+	if cmd.reset && update {
+		errorf("-reset cannot be combined with limit flags")
+		cmd.usage()
+	}
+
+	client, err := storageServiceClient(*identityUser, *identityPassword, *tenantID)
+	if err != nil {
+		fatalf("Could not get volume service client [%s]\n", err)
+	}
+
+	computeURL := buildComputeURL("%s/os-quota-sets/%s", *tenantID, cmd.tenant)
+	blockURL := client.ServiceURL("os-quota-sets", cmd.tenant)
+
+	if cmd.reset {
+		resp, err := sendHTTPRequest("DELETE", computeURL, nil, nil)
+		if err != nil {
+			fatalf(err.Error())
+		}
+		resp.Body.Close()
+
+		_, err = client.Request("DELETE", blockURL, gophercloud.RequestOpts{
+			OkCodes: []int{http.StatusOK},
+		})
+		if err != nil {
+			fatalf(err.Error())
+		}
+
+		fmt.Printf("Reset quotas for tenant %s\n", cmd.tenant)
+		return nil
+	}
+
+	if update {
+		b, err := json.Marshal(compute.UpdateQuotaSetRequest{QuotaSet: computeQuotas})
+		if err != nil {
+			fatalf(err.Error())
+		}
+
+		resp, err := sendHTTPRequest("PUT", computeURL, nil, bytes.NewReader(b))
+		if err != nil {
+			fatalf(err.Error())
+		}
+		resp.Body.Close()
+
+		if blockQuotas.Volumes != nil {
+			_, err = client.Request("PUT", blockURL, gophercloud.RequestOpts{
+				JSONBody: block.UpdateQuotaSetRequest{QuotaSet: blockQuotas},
+				OkCodes:  []int{http.StatusOK},
+			})
+			if err != nil {
+				fatalf(err.Error())
+			}
+		}
+	}
+
+	t := createTemplate("tenant-quota", cmd.template)
+
+	return showTenantQuotas(t, cmd.tenant, computeURL, client, blockURL)
+}
+
+func showTenantQuotas(t *template.Template, tenant string, computeURL string,
+	client *gophercloud.ServiceClient, blockURL string) error {
+	var computeQuotas compute.QuotaSetDetailResponse
+	var blockQuotas block.QuotaSetDetailResponse
+
+	resp, err := sendHTTPRequest("GET", computeURL+"/detail", nil, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	err = unmarshalHTTPResponse(resp, &computeQuotas)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	_, err = client.Request("GET", blockURL+"?usage=true", gophercloud.RequestOpts{
+		JSONResponse: &blockQuotas,
+		OkCodes:      []int{http.StatusOK},
+	})
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	q := computeQuotas.QuotaSet
+	quotas := tenantQuotas{
+		ID:        tenant,
+		Instances: q.Instances,
+		VCPUs:     q.Cores,
+		Memory:    q.RAM,
+		Disk:      q.Disk,
+		Volumes:   compute.QuotaDetail(blockQuotas.QuotaSet.Volumes),
+	}
+
+	if t != nil {
+		if err := t.Execute(os.Stdout, &quotas); err != nil {
+			fatalf(err.Error())
+		}
+		fmt.Println("")
+		return nil
+	}
+
+	fmt.Printf("Quotas for tenant %s:\n", quotas.ID)
+	fmt.Printf("\tInstances: %d | %s\n", quotas.Instances.InUse, limitToString(quotas.Instances.Limit))
+	fmt.Printf("\tCPUs:      %d | %s\n", quotas.VCPUs.InUse, limitToString(quotas.VCPUs.Limit))
+	fmt.Printf("\tMemory:    %d | %s\n", quotas.Memory.InUse, limitToString(quotas.Memory.Limit))
+	fmt.Printf("\tDisk:      %d | %s\n", quotas.Disk.InUse, limitToString(quotas.Disk.Limit))
+	fmt.Printf("\tVolumes:   %d | %s\n", quotas.Volumes.InUse, limitToString(quotas.Volumes.Limit))
+
+	return nil
+}
@@ -17,16 +17,24 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 
+	"github.com/01org/ciao/ciao-controller/types"
 	"github.com/01org/ciao/openstack/compute"
 )
 
 var workloadCommand = &command{
 	SubCommands: map[string]subCommand{
-		"list": new(workloadListCommand),
+		"list":   new(workloadListCommand),
+		"create": new(workloadCreateCommand),
+		"delete": new(workloadDeleteCommand),
+		"show":   new(workloadShowCommand),
 	},
 }
 
@@ -103,3 +111,301 @@ func (cmd *workloadListCommand) run(args []string) error {
 	}
 	return nil
 }
+
+type workloadCreateCommand struct {
+	Flag              flag.FlagSet
+	id                string
+	description       string
+	vmType            string
+	fwType            string
+	imageID           string
+	imageName         string
+	config            string
+	vcpus             int
+	memMB             int
+	diskMB            int
+	cpuShares         int
+	cpuQuota          int
+	memLimitMB        int
+	diskIOPS          int
+	diskMBps          int
+	storageSourceType string
+	storageSourceID   string
+	storageSize       int
+	storageBootable   bool
+	storagePersistent bool
+}
+
+func (cmd *workloadCreateCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] workload create [flags]
+
+Create a new workload
+
+The create flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *workloadCreateCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.id, "id", "", "Workload UUID, generated if not set")
+	cmd.Flag.StringVar(&cmd.description, "description", "", "Workload description")
+	cmd.Flag.StringVar(&cmd.vmType, "vm-type", "qemu", "Hypervisor, qemu or docker")
+	cmd.Flag.StringVar(&cmd.fwType, "fw-type", "legacy", "Firmware of qemu workloads, legacy or efi")
+	cmd.Flag.StringVar(&cmd.imageID, "image-id", "", "Backing image UUID of qemu workloads")
+	cmd.Flag.StringVar(&cmd.imageName, "image-name", "", "Docker image name of docker workloads")
+	cmd.Flag.StringVar(&cmd.config, "config", "", "Path to the cloud-init configuration file")
+	cmd.Flag.IntVar(&cmd.vcpus, "vcpus", 0, "Default number of VCPUs")
+	cmd.Flag.IntVar(&cmd.memMB, "mem-mb", 0, "Default amount of memory in MiB")
+	cmd.Flag.IntVar(&cmd.diskMB, "disk-mb", 0, "Default amount of disk space in MiB")
+	cmd.Flag.IntVar(&cmd.cpuShares, "cpu-shares", 0, "Relative CPU weight of instances")
+	cmd.Flag.IntVar(&cmd.cpuQuota, "cpu-quota", 0, "Maximum CPU usage of instances, as a percentage of one CPU")
+	cmd.Flag.IntVar(&cmd.memLimitMB, "mem-limit-mb", 0, "Maximum memory usage of instances in MiB")
+	cmd.Flag.IntVar(&cmd.diskIOPS, "disk-iops", 0, "Maximum disk operations per second of instances")
+	cmd.Flag.IntVar(&cmd.diskMBps, "disk-mbps", 0, "Maximum disk throughput of instances in MiB per second")
+	cmd.Flag.StringVar(&cmd.storageSourceType, "storage-source-type", "", "Storage source type, image, volume or empty")
+	cmd.Flag.StringVar(&cmd.storageSourceID, "storage-source-id", "", "UUID of the storage source image or volume")
+	cmd.Flag.IntVar(&cmd.storageSize, "storage-size", 0, "Size of the storage in GiB")
+	cmd.Flag.BoolVar(&cmd.storageBootable, "storage-bootable", false, "Boot from the storage")
+	cmd.Flag.BoolVar(&cmd.storagePersistent, "storage-persistent", false, "Keep the storage after the instance is deleted")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *workloadCreateCommand) run(args []string) error {
+	if cmd.description == "" {
+		errorf("Missing required -description parameter")
+		cmd.usage()
+	}
+
+	if cmd.config == "" {
+		errorf("Missing required -config parameter")
+		cmd.usage()
+	}
+
+	config, err := ioutil.ReadFile(cmd.config)
+	if err != nil {
+		fatalf("Could not read configuration file [%s]\n", err)
+	}
+
+	wl := types.CiaoWorkload{
+		ID:          cmd.id,
+		Description: cmd.description,
+		VMType:      cmd.vmType,
+		ImageID:     cmd.imageID,
+		ImageName:   cmd.imageName,
+		Config:      string(config),
+	}
+
+	if cmd.vmType == "qemu" {
+		wl.FWType = cmd.fwType
+	}
+
+	// Limits are not mandatory as they do not need to be reserved on
+	// the node that runs the instance.
+	defaults := []struct {
+		rtype     string
+		value     int
+		mandatory bool
+	}{
+		{"vcpus", cmd.vcpus, true},
+		{"mem_mb", cmd.memMB, true},
+		{"disk_mb", cmd.diskMB, true},
+		{"cpu_shares", cmd.cpuShares, false},
+		{"cpu_quota", cmd.cpuQuota, false},
+		{"mem_limit_mb", cmd.memLimitMB, false},
+		{"disk_iops", cmd.diskIOPS, false},
+		{"disk_mbps", cmd.diskMBps, false},
+	}
+
+	for _, d := range defaults {
+		if d.value == 0 {
+			continue
+		}
+
+		wl.Defaults = append(wl.Defaults, types.CiaoWorkloadResource{
+			Type:      d.rtype,
+			Value:     d.value,
+			Mandatory: d.mandatory,
+		})
+	}
+
+	if cmd.storageSourceType != "" {
+		wl.Storage = &types.CiaoWorkloadStorage{
+			Bootable:   cmd.storageBootable,
+			Persistent: cmd.storagePersistent,
+			Size:       cmd.storageSize,
+			SourceType: cmd.storageSourceType,
+			SourceID:   cmd.storageSourceID,
+		}
+	}
+
+	b, err := json.Marshal(types.CiaoWorkloadDetail{Workload: wl})
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	url := buildComputeURL("workloads")
+
+	resp, err := sendHTTPRequest("POST", url, nil, bytes.NewReader(b))
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	var workload types.CiaoWorkloadDetail
+	err = unmarshalHTTPResponse(resp, &workload)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	fmt.Printf("Created workload %s\n", workload.Workload.ID)
+	return nil
+}
+
+type workloadDeleteCommand struct {
+	Flag     flag.FlagSet
+	workload string
+}
+
+func (cmd *workloadDeleteCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] workload delete [flags]
+
+Deletes a workload which has no instances
+
+The delete flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func (cmd *workloadDeleteCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.workload, "workload", "", "Workload UUID")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *workloadDeleteCommand) run(args []string) error {
+	if cmd.workload == "" {
+		errorf("Missing required -workload parameter")
+		cmd.usage()
+	}
+
+	url := buildComputeURL("workloads/%s", cmd.workload)
+
+	resp, err := sendHTTPRequest("DELETE", url, nil, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		fatalf("Workload deletion failed: %s", resp.Status)
+	}
+
+	fmt.Printf("Deleted workload %s\n", cmd.workload)
+	return nil
+}
+
+type workloadShowCommand struct {
+	Flag     flag.FlagSet
+	workload string
+	template string
+}
+
+func (cmd *workloadShowCommand) usage(...string) {
+	fmt.Fprintf(os.Stderr, `usage: ciao-cli [options] workload show [flags]
+
+Print detailed information about a workload
+
+The show flags are:
+
+`)
+	cmd.Flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+The template passed to the -f option operates on a 
+
+struct {
+	ID          string // UUID of the workload
+	Description string // Description of the workload
+	FWType      string // Firmware of qemu workloads, legacy or efi
+	VMType      string // Hypervisor, qemu or docker
+	ImageID     string // Backing image UUID of qemu workloads
+	ImageName   string // Docker image name of docker workloads
+	Config      string // cloud-init configuration of the workload
+	Defaults    []struct {
+		Type      string // Resource type, e.g., vcpus or mem_mb
+		Value     int    // Default value of the resource
+		Mandatory bool   // Indicates whether the resource is mandatory
+	}
+	Storage *struct {
+		ID         string // Volume UUID, empty if a volume is created
+		Bootable   bool   // Indicates whether instances boot from the storage
+		Persistent bool   // Indicates whether the storage outlives instances
+		Size       int    // Size of the storage in GiB
+		SourceType string // image, volume or empty
+		SourceID   string // UUID of the source image or volume
+	}
+}
+`)
+	os.Exit(2)
+}
+
+func (cmd *workloadShowCommand) parseArgs(args []string) []string {
+	cmd.Flag.StringVar(&cmd.workload, "workload", "", "Workload UUID")
+	cmd.Flag.StringVar(&cmd.template, "f", "", "Template used to format output")
+	cmd.Flag.Usage = func() { cmd.usage() }
+	cmd.Flag.Parse(args)
+	return cmd.Flag.Args()
+}
+
+func (cmd *workloadShowCommand) run(args []string) error {
+	if cmd.workload == "" {
+		errorf("Missing required -workload parameter")
+		cmd.usage()
+	}
+
+	var workload types.CiaoWorkloadDetail
+	url := buildComputeURL("workloads/%s", cmd.workload)
+
+	resp, err := sendHTTPRequest("GET", url, nil, nil)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	err = unmarshalHTTPResponse(resp, &workload)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	if cmd.template != "" {
+		return outputToTemplate("workload-show", cmd.template,
+			&workload.Workload)
+	}
+
+	wl := workload.Workload
+	fmt.Printf("\tName: %s\n\tUUID: %s\n\tHypervisor: %s\n", wl.Description, wl.ID, wl.VMType)
+	if wl.FWType != "" {
+		fmt.Printf("\tFirmware: %s\n", wl.FWType)
+	}
+	if wl.ImageID != "" {
+		fmt.Printf("\tImage UUID: %s\n", wl.ImageID)
+	}
+	if wl.ImageName != "" {
+		fmt.Printf("\tImage Name: %s\n", wl.ImageName)
+	}
+	for _, r := range wl.Defaults {
+		fmt.Printf("\t%s: %d\n", r.Type, r.Value)
+	}
+	if wl.Storage != nil {
+		fmt.Printf("\tStorage: %s %s, %d GiB, bootable %t, persistent %t\n",
+			wl.Storage.SourceType, wl.Storage.SourceID, wl.Storage.Size,
+			wl.Storage.Bootable, wl.Storage.Persistent)
+	}
+	fmt.Printf("\tConfig:\n%s\n", wl.Config)
+	return nil
+}
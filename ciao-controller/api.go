@@ -20,13 +20,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"reflect"
 	"sort"
 	"strconv"
 	"time"
 
+	"github.com/01org/ciao/ciao-controller/internal/datastore"
 	"github.com/01org/ciao/ciao-controller/types"
 	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp"
+	"github.com/01org/ciao/ssntp/uuid"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 )
@@ -279,6 +282,7 @@ const (
 	vcpu          = 2
 	memory        = 3
 	disk          = 4
+	volumes       = 6
 )
 
 func getResources(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
@@ -703,3 +707,241 @@ func traceData(c *controller, w http.ResponseWriter, r *http.Request) (APIRespon
 
 	return APIResponse{http.StatusOK, traceData}, nil
 }
+
+func workloadErrorResponse(err error) APIResponse {
+	switch err {
+	case datastore.ErrNoWorkload:
+		return APIResponse{http.StatusNotFound, nil}
+	case datastore.ErrDuplicateWorkload,
+		datastore.ErrWorkloadInUse:
+		return APIResponse{http.StatusConflict, nil}
+	case datastore.ErrInternalWorkload:
+		return APIResponse{http.StatusForbidden, nil}
+	default:
+		return errorResponse(err)
+	}
+}
+
+func workloadToCiaoWorkload(wl *types.Workload) types.CiaoWorkload {
+	w := types.CiaoWorkload{
+		ID:          wl.ID,
+		Description: wl.Description,
+		FWType:      wl.FWType,
+		VMType:      string(wl.VMType),
+		ImageID:     wl.ImageID,
+		ImageName:   wl.ImageName,
+		Config:      wl.Config,
+		Defaults:    []types.CiaoWorkloadResource{},
+	}
+
+	for _, r := range wl.Defaults {
+		w.Defaults = append(w.Defaults, types.CiaoWorkloadResource{
+			Type:      string(r.Type),
+			Value:     r.Value,
+			Mandatory: r.Mandatory,
+		})
+	}
+
+	if wl.Storage != nil {
+		w.Storage = &types.CiaoWorkloadStorage{
+			ID:         wl.Storage.ID,
+			Bootable:   wl.Storage.Bootable,
+			Persistent: wl.Storage.Persistent,
+			Size:       wl.Storage.Size,
+			SourceType: string(wl.Storage.SourceType),
+			SourceID:   wl.Storage.SourceID,
+		}
+	}
+
+	return w
+}
+
+// ciaoWorkloadToWorkload validates a workload definition received
+// through the API and converts it to the datastore representation.
+func ciaoWorkloadToWorkload(w types.CiaoWorkload) (types.Workload, error) {
+	wl := types.Workload{
+		ID:          w.ID,
+		Description: w.Description,
+		FWType:      w.FWType,
+		VMType:      payloads.Hypervisor(w.VMType),
+		ImageID:     w.ImageID,
+		ImageName:   w.ImageName,
+		Config:      w.Config,
+	}
+
+	if wl.Description == "" {
+		return wl, errors.New("Missing workload description")
+	}
+
+	if wl.Config == "" {
+		return wl, errors.New("Missing workload configuration")
+	}
+
+	switch wl.VMType {
+	case payloads.QEMU:
+		if wl.FWType != string(payloads.EFI) && wl.FWType != payloads.Legacy {
+			return wl, fmt.Errorf("Invalid firmware type %q", wl.FWType)
+		}
+
+		if wl.ImageID == "" && w.Storage == nil {
+			return wl, errors.New("Missing image ID or storage")
+		}
+	case payloads.Docker:
+		if wl.ImageName == "" {
+			return wl, errors.New("Missing docker image name")
+		}
+	default:
+		return wl, fmt.Errorf("Invalid hypervisor %q", w.VMType)
+	}
+
+	for _, r := range w.Defaults {
+		switch payloads.Resource(r.Type) {
+		case payloads.VCPUs, payloads.MemMB, payloads.DiskMB, payloads.NetworkNode:
+		default:
+			if !payloads.IsLimit(payloads.Resource(r.Type)) {
+				return wl, fmt.Errorf("Invalid resource type %q", r.Type)
+			}
+		}
+
+		if r.Value < 0 {
+			return wl, fmt.Errorf("Invalid %s value %d", r.Type, r.Value)
+		}
+
+		wl.Defaults = append(wl.Defaults, payloads.RequestedResource{
+			Type:      payloads.Resource(r.Type),
+			Value:     r.Value,
+			Mandatory: r.Mandatory,
+		})
+	}
+
+	if w.Storage != nil {
+		s := &types.StorageResource{
+			ID:         w.Storage.ID,
+			Bootable:   w.Storage.Bootable,
+			Persistent: w.Storage.Persistent,
+			Size:       w.Storage.Size,
+			SourceType: types.SourceType(w.Storage.SourceType),
+			SourceID:   w.Storage.SourceID,
+		}
+
+		switch s.SourceType {
+		case types.ImageService, types.VolumeService:
+			if s.SourceID == "" {
+				return wl, errors.New("Missing storage source ID")
+			}
+		case types.Empty:
+		default:
+			return wl, fmt.Errorf("Invalid storage source type %q", s.SourceType)
+		}
+
+		if s.Size < 0 {
+			return wl, fmt.Errorf("Invalid storage size %d", s.Size)
+		}
+
+		wl.Storage = s
+	}
+
+	return wl, nil
+}
+
+func readWorkload(r *http.Request) (types.Workload, error) {
+	var req types.CiaoWorkloadDetail
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return types.Workload{}, err
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return types.Workload{}, err
+	}
+
+	return ciaoWorkloadToWorkload(req.Workload)
+}
+
+func createWorkload(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	wl, err := readWorkload(r)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	if wl.ID == "" {
+		wl.ID = uuid.Generate().String()
+	}
+
+	err = c.ds.AddWorkload(wl)
+	if err != nil {
+		return workloadErrorResponse(err), err
+	}
+
+	resp := types.CiaoWorkloadDetail{
+		Workload: workloadToCiaoWorkload(&wl),
+	}
+
+	return APIResponse{http.StatusCreated, resp}, nil
+}
+
+func showWorkload(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	workloadID := vars["workload"]
+
+	wl, err := c.ds.GetWorkload(workloadID)
+	if err != nil {
+		return APIResponse{http.StatusNotFound, nil}, err
+	}
+
+	resp := types.CiaoWorkloadDetail{
+		Workload: workloadToCiaoWorkload(wl),
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+func updateWorkload(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	workloadID := vars["workload"]
+
+	wl, err := readWorkload(r)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	if wl.ID != "" && wl.ID != workloadID {
+		err = errors.New("Workload ID cannot be changed")
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	wl.ID = workloadID
+
+	// Errors are reported by UpdateWorkload, which also knows which
+	// workloads cannot be updated.
+	old, _ := c.ds.GetWorkload(workloadID)
+
+	err = c.ds.UpdateWorkload(wl)
+	if err != nil {
+		return workloadErrorResponse(err), err
+	}
+
+	if old == nil || !reflect.DeepEqual(workloadLimits(old), workloadLimits(&wl)) {
+		c.updateWorkloadLimits(&wl)
+	}
+
+	resp := types.CiaoWorkloadDetail{
+		Workload: workloadToCiaoWorkload(&wl),
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+func deleteWorkload(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	workloadID := vars["workload"]
+
+	err := c.ds.DeleteWorkload(workloadID)
+	if err != nil {
+		return workloadErrorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, nil}, nil
+}
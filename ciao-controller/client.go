@@ -17,18 +17,36 @@
 package main
 
 import (
+	"errors"
+	"sync"
 	"time"
 
+	"github.com/01org/ciao/ciao-controller/types"
 	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp"
+	"github.com/01org/ciao/ssntp/uuid"
 	"github.com/golang/glog"
 	"gopkg.in/yaml.v2"
 )
 
+// consoleTimeout is how long the controller waits for a launcher to return
+// the console output of an instance.
+const consoleTimeout = 10 * time.Second
+
+var errConsoleTimeout = errors.New("Timed out waiting for console output")
+
+type consoleResult struct {
+	output string
+	err    error
+}
+
 type ssntpClient struct {
 	ctl   *controller
 	ssntp ssntp.Client
 	name  string
+
+	consoleLock     sync.Mutex
+	consoleRequests map[string]chan consoleResult
 }
 
 func (client *ssntpClient) ConnectNotify() {
@@ -73,7 +91,31 @@ func (client *ssntpClient) EventNotify(event ssntp.Event, frame *ssntp.Frame) {
 			glog.Warning("Error unmarshalling InstanceDeleted")
 			return
 		}
-		client.ctl.ds.DeleteInstance(event.InstanceDeleted.InstanceUUID)
+		instanceID := event.InstanceDeleted.InstanceUUID
+		relaunched, err := client.ctl.relaunchResizedInstance(instanceID)
+		if err != nil {
+			glog.Warningf("Unable to relaunch resized instance %s: %v", instanceID, err)
+		} else if relaunched {
+			break
+		}
+		client.ctl.releaseInstancePublicIPs(instanceID)
+		client.ctl.ds.DeleteInstance(instanceID)
+	case ssntp.InstanceEvacuated:
+		var event payloads.EventInstanceEvacuated
+		err := yaml.Unmarshal(payload, &event)
+		if err != nil {
+			glog.Warning("Error unmarshalling InstanceEvacuated")
+			return
+		}
+		instanceID := event.InstanceEvacuated.InstanceUUID
+		relaunched, err := client.ctl.relaunchEvacuatedInstance(instanceID)
+		if err != nil {
+			glog.Warningf("Unable to relaunch evacuated instance %s: %v", instanceID, err)
+		} else if relaunched {
+			break
+		}
+		client.ctl.releaseInstancePublicIPs(instanceID)
+		client.ctl.ds.DeleteInstance(instanceID)
 	case ssntp.ConcentratorInstanceAdded:
 		var event payloads.EventConcentratorInstanceAdded
 		err := yaml.Unmarshal(payload, &event)
@@ -83,6 +125,31 @@ func (client *ssntpClient) EventNotify(event ssntp.Event, frame *ssntp.Frame) {
 		}
 		newCNCI := event.CNCIAdded
 		client.ctl.ds.AddCNCIIP(newCNCI.ConcentratorMAC, newCNCI.ConcentratorIP)
+	case ssntp.PublicIPAssigned:
+		var event payloads.EventPublicIPAssigned
+		err := yaml.Unmarshal(payload, &event)
+		if err != nil {
+			glog.Warning("Error unmarshalling PublicIPAssigned")
+			return
+		}
+		assigned := event.AssignedIP
+		err = client.ctl.ds.PublicIPAssigned(assigned.InstanceUUID, assigned.PublicIP)
+		if err != nil {
+			glog.Warningf("Unable to assign public IP %s to instance %s: %v",
+				assigned.PublicIP, assigned.InstanceUUID, err)
+		}
+	case ssntp.ControllerPromoted:
+		var event payloads.EventControllerPromoted
+		err := yaml.Unmarshal(payload, &event)
+		if err != nil {
+			glog.Warning("Error unmarshalling ControllerPromoted")
+			return
+		}
+		glog.Infof("Promoted to master controller")
+		err = client.ctl.ds.ReconcileStats(event.ControllerPromoted.NodeStats)
+		if err != nil {
+			glog.Warningf("Unable to reconcile node stats: %v", err)
+		}
 	case ssntp.TraceReport:
 		var trace payloads.Trace
 		err := yaml.Unmarshal(payload, &trace)
@@ -92,6 +159,16 @@ func (client *ssntpClient) EventNotify(event ssntp.Event, frame *ssntp.Frame) {
 		}
 		client.ctl.ds.HandleTraceReport(trace)
 
+	case ssntp.ConsoleOutput:
+		var event payloads.EventConsoleOutput
+		err := yaml.Unmarshal(payload, &event)
+		if err != nil {
+			glog.Warning("Error unmarshalling ConsoleOutput")
+			return
+		}
+		client.consoleReply(event.ConsoleOutput.RequestUUID,
+			consoleResult{output: event.ConsoleOutput.Output})
+
 	case ssntp.NodeConnected:
 		var nodeConnected payloads.NodeConnected
 		err := yaml.Unmarshal(payload, &nodeConnected)
@@ -163,12 +240,51 @@ func (client *ssntpClient) ErrorNotify(err ssntp.Error, frame *ssntp.Frame) {
 		}
 		client.ctl.ds.DetachVolumeFailure(failure.InstanceUUID, failure.VolumeUUID, failure.Reason)
 
+	case ssntp.CreateImageFailure:
+		var failure payloads.ErrorCreateImageFailure
+		err := yaml.Unmarshal(payload, &failure)
+		if err != nil {
+			glog.Warning("Error unmarshalling CreateImageFailure")
+			return
+		}
+		glog.Warningf("Unable to create image %s from instance %s: %s",
+			failure.ImageUUID, failure.InstanceUUID, failure.Reason)
+		if failure.ImageUUID != "" {
+			err = client.ctl.deleteServiceImage(failure.ImageUUID)
+			if err != nil {
+				glog.Warningf("Unable to delete image %s: %v", failure.ImageUUID, err)
+			}
+		}
+
+	case ssntp.GetConsoleFailure:
+		var failure payloads.ErrorGetConsoleFailure
+		err := yaml.Unmarshal(payload, &failure)
+		if err != nil {
+			glog.Warning("Error unmarshalling GetConsoleFailure")
+			return
+		}
+		client.consoleReply(failure.RequestUUID,
+			consoleResult{err: errors.New(failure.Reason.String())})
+
+	case ssntp.UpdateLimitsFailure:
+		var failure payloads.ErrorUpdateLimitsFailure
+		err := yaml.Unmarshal(payload, &failure)
+		if err != nil {
+			glog.Warning("Error unmarshalling UpdateLimitsFailure")
+			return
+		}
+		glog.Warningf("Unable to update limits of instance %s: %s",
+			failure.InstanceUUID, failure.Reason)
 	}
 	glog.V(1).Info(string(payload))
 }
 
 func newSSNTPClient(ctl *controller, config *ssntp.Config) (*ssntpClient, error) {
-	client := &ssntpClient{name: "ciao Controller", ctl: ctl}
+	client := &ssntpClient{
+		name:            "ciao Controller",
+		ctl:             ctl,
+		consoleRequests: make(map[string]chan consoleResult),
+	}
 
 	err := client.ssntp.Dial(config, client)
 	return client, err
@@ -267,6 +383,32 @@ func (client *ssntpClient) RestartInstance(instanceID string, nodeID string) err
 	return err
 }
 
+// restartResizedInstance restarts an instance, replacing the resources with
+// which it was started by sizes.
+func (client *ssntpClient) restartResizedInstance(instanceID string, nodeID string, sizes []payloads.RequestedResource) error {
+	restartCmd := payloads.RestartCmd{
+		InstanceUUID:       instanceID,
+		WorkloadAgentUUID:  nodeID,
+		RequestedResources: sizes,
+	}
+
+	payload := payloads.Restart{
+		Restart: restartCmd,
+	}
+
+	y, err := yaml.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	glog.Info("RESTART resized instance: ", instanceID)
+	glog.V(1).Info(string(y))
+
+	_, err = client.ssntp.SendCommand(ssntp.RESTART, y)
+
+	return err
+}
+
 func (client *ssntpClient) EvacuateNode(nodeID string) error {
 	evacuateCmd := payloads.EvacuateCmd{
 		WorkloadAgentUUID: nodeID,
@@ -333,6 +475,170 @@ func (client *ssntpClient) detachVolume(volID string, instanceID string, nodeID
 	return err
 }
 
+func (client *ssntpClient) createImage(instanceID, nodeID, imageID, url, token string) error {
+	payload := payloads.CreateImage{
+		CreateImage: payloads.CreateImageCmd{
+			InstanceUUID:      instanceID,
+			WorkloadAgentUUID: nodeID,
+			ImageUUID:         imageID,
+			ImageServiceURL:   url,
+			Token:             token,
+		},
+	}
+
+	y, err := yaml.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("CreateImage %s from %s\n", imageID, instanceID)
+
+	_, err = client.ssntp.SendCommand(ssntp.CreateImage, y)
+
+	return err
+}
+
+func (client *ssntpClient) updateLimits(instanceID, nodeID string, limits []payloads.RequestedResource) error {
+	payload := payloads.UpdateLimits{
+		UpdateLimits: payloads.UpdateLimitsCmd{
+			InstanceUUID:      instanceID,
+			WorkloadAgentUUID: nodeID,
+			Limits:            limits,
+		},
+	}
+
+	y, err := yaml.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("UpdateLimits of %s\n", instanceID)
+	glog.V(1).Info(string(y))
+
+	_, err = client.ssntp.SendCommand(ssntp.UpdateLimits, y)
+
+	return err
+}
+
+// getConsole asks the launcher running instanceID for the last lines of the
+// instance's console log and waits for the reply.
+func (client *ssntpClient) getConsole(instanceID, nodeID string, lines int) (string, error) {
+	requestID, resultCh := client.addConsoleRequest()
+
+	payload := payloads.GetConsole{
+		GetConsole: payloads.GetConsoleCmd{
+			InstanceUUID:      instanceID,
+			WorkloadAgentUUID: nodeID,
+			Lines:             lines,
+			RequestUUID:       requestID,
+		},
+	}
+
+	y, err := yaml.Marshal(payload)
+	if err != nil {
+		client.cancelConsoleRequest(requestID)
+		return "", err
+	}
+
+	glog.Infof("GetConsole of %s\n", instanceID)
+
+	_, err = client.ssntp.SendCommand(ssntp.GetConsole, y)
+	if err != nil {
+		client.cancelConsoleRequest(requestID)
+		return "", err
+	}
+
+	select {
+	case result := <-resultCh:
+		return result.output, result.err
+	case <-time.After(consoleTimeout):
+		client.cancelConsoleRequest(requestID)
+		return "", errConsoleTimeout
+	}
+}
+
+// addConsoleRequest registers a new pending getConsole call.  The launcher
+// copies the returned request ID into its reply, so that concurrent
+// requests for the same instance, which may ask for a different number of
+// lines, each get their own output.
+func (client *ssntpClient) addConsoleRequest() (string, chan consoleResult) {
+	requestID := uuid.Generate().String()
+	resultCh := make(chan consoleResult, 1)
+
+	client.consoleLock.Lock()
+	client.consoleRequests[requestID] = resultCh
+	client.consoleLock.Unlock()
+
+	return requestID, resultCh
+}
+
+// consoleReply hands the console output, or error, received for requestID
+// to the pending getConsole call that sent it.
+func (client *ssntpClient) consoleReply(requestID string, result consoleResult) {
+	client.consoleLock.Lock()
+	resultCh, ok := client.consoleRequests[requestID]
+	delete(client.consoleRequests, requestID)
+	client.consoleLock.Unlock()
+
+	if !ok {
+		glog.Warningf("Console reply for unknown request %s", requestID)
+		return
+	}
+
+	resultCh <- result
+}
+
+func (client *ssntpClient) cancelConsoleRequest(requestID string) {
+	client.consoleLock.Lock()
+	delete(client.consoleRequests, requestID)
+	client.consoleLock.Unlock()
+}
+
+func publicIPCommand(ip types.PublicIP, concentratorID string, instance *types.Instance) payloads.PublicIPCommand {
+	return payloads.PublicIPCommand{
+		ConcentratorUUID: concentratorID,
+		TenantUUID:       instance.TenantID,
+		InstanceUUID:     instance.ID,
+		PublicIP:         ip.Address,
+		PrivateIP:        instance.IPAddress,
+		VnicMAC:          instance.MACAddress,
+	}
+}
+
+func (client *ssntpClient) assignPublicIP(ip types.PublicIP, concentratorID string, instance *types.Instance) error {
+	payload := payloads.CommandAssignPublicIP{
+		AssignIP: publicIPCommand(ip, concentratorID, instance),
+	}
+
+	y, err := yaml.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("AssignPublicIP %s to %s\n", ip.Address, instance.ID)
+
+	_, err = client.ssntp.SendCommand(ssntp.AssignPublicIP, y)
+
+	return err
+}
+
+func (client *ssntpClient) releasePublicIP(ip types.PublicIP, concentratorID string, instance *types.Instance) error {
+	payload := payloads.CommandReleasePublicIP{
+		ReleaseIP: publicIPCommand(ip, concentratorID, instance),
+	}
+
+	y, err := yaml.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("ReleasePublicIP %s from %s\n", ip.Address, instance.ID)
+
+	_, err = client.ssntp.SendCommand(ssntp.ReleasePublicIP, y)
+
+	return err
+}
+
 func (client *ssntpClient) Disconnect() {
 	client.ssntp.Close()
 }
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/01org/ciao/ciao-controller/internal/datastore"
 	"github.com/01org/ciao/ciao-controller/types"
 	"github.com/01org/ciao/payloads"
 	"github.com/golang/glog"
@@ -32,6 +33,86 @@ func (c *controller) evacuateNode(nodeID string) error {
 	return nil
 }
 
+// bootsFromVolume indicates whether the instances of wl boot from a volume.
+// Such instances are persistent, as their root filesystem does not live on
+// the node they run on, and can therefore be relaunched on another node.
+func bootsFromVolume(wl *types.Workload) bool {
+	return wl.Storage != nil && wl.Storage.Bootable
+}
+
+// instanceStorage returns the volume from which instance boots and the other
+// volumes attached to it, as they must be described in the START command
+// that relaunches the instance on another node.
+func (c *controller) instanceStorage(instance *types.Instance) (payloads.StorageResources, []payloads.StorageResources, error) {
+	attachments, err := c.ds.GetStorageAttachments(instance.ID)
+	if err != nil {
+		return payloads.StorageResources{}, nil, err
+	}
+
+	var boot payloads.StorageResources
+	var volumes []payloads.StorageResources
+	for _, a := range attachments {
+		if a.Boot {
+			boot = payloads.StorageResources{ID: a.BlockID, Bootable: true}
+			continue
+		}
+		volumes = append(volumes, payloads.StorageResources{ID: a.BlockID})
+	}
+
+	// the boot volume of instances created before boot volumes were
+	// recorded is only known if it is their sole volume.
+	if boot.ID == "" && len(volumes) == 1 {
+		boot = payloads.StorageResources{ID: volumes[0].ID, Bootable: true}
+		volumes = nil
+	}
+
+	if boot.ID == "" {
+		return payloads.StorageResources{}, nil,
+			fmt.Errorf("Boot volume of instance %s unknown", instance.ID)
+	}
+
+	return boot, volumes, nil
+}
+
+// relaunchEvacuatedInstance relaunches an instance which has been removed
+// from an evacuated node on another node, with the same ID, IP address and
+// volumes.  The scheduler will not place it on the evacuated node as that
+// node is in maintenance mode.  Only persistent instances, i.e., those that
+// boot from a volume, can be relaunched.  It returns false if the instance
+// is not relaunched.
+func (c *controller) relaunchEvacuatedInstance(instanceID string) (bool, error) {
+	i, err := c.ds.GetInstance(instanceID)
+	if err != nil {
+		return false, err
+	}
+
+	wl, err := c.ds.GetWorkload(i.WorkloadID)
+	if err != nil {
+		return false, err
+	}
+
+	if !bootsFromVolume(wl) {
+		return false, nil
+	}
+
+	boot, volumes, err := c.instanceStorage(i)
+	if err != nil {
+		return false, err
+	}
+
+	config, err := relaunchConfig(c, wl, i, boot, volumes)
+	if err != nil {
+		return false, err
+	}
+
+	err = c.ds.EvacuateInstance(instanceID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, c.client.StartWorkload(config.config)
+}
+
 func (c *controller) restartInstance(instanceID string) error {
 	// should I bother to see if instanceID is valid?
 	// get node id.  If there is no node id we can't send a restart
@@ -52,6 +133,243 @@ func (c *controller) restartInstance(instanceID string) error {
 	return nil
 }
 
+// workloadUsage returns the resources an instance of wl is accounted for.
+func workloadUsage(wl *types.Workload) map[string]int {
+	usage := make(map[string]int)
+	for _, r := range wl.Defaults {
+		usage[string(r.Type)] = r.Value
+	}
+	return usage
+}
+
+// workloadSizes returns the vcpus, mem_mb and disk_mb resources of wl, which
+// are sent to the launcher when an instance is restarted after a resize.
+func workloadSizes(wl *types.Workload) []payloads.RequestedResource {
+	sizes := []payloads.RequestedResource{}
+	for _, r := range wl.Defaults {
+		switch r.Type {
+		case payloads.VCPUs, payloads.MemMB, payloads.DiskMB:
+			sizes = append(sizes, r)
+		}
+	}
+	return sizes
+}
+
+// resizeAllowed checks whether the tenant of instance can afford for the
+// resource usage of instance to change to usage.
+func (c *controller) resizeAllowed(instance *types.Instance, usage map[string]int) error {
+	tenant, err := c.ds.GetTenant(instance.TenantID)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range tenant.Resources {
+		// the number of instances does not change
+		if res.Rtype == 1 {
+			continue
+		}
+
+		delta := usage[res.Rname] - instance.Usage[res.Rname]
+		if delta > 0 && res.OverLimit(delta) {
+			return types.ErrQuota
+		}
+	}
+
+	return nil
+}
+
+// nodeHasCapacity checks whether the node on which a stopped instance was
+// running, according to the last statistics it reported, has the capacity
+// to restart the instance with a resource usage of usage rather than old.
+// Nodes that have not reported any statistics are assumed to have the
+// capacity.
+func (c *controller) nodeHasCapacity(nodeID string, old, usage map[string]int) bool {
+	for _, n := range c.ds.GetNodeLastStats().Nodes {
+		if n.ID != nodeID {
+			continue
+		}
+
+		mem := usage[string(payloads.MemMB)]
+		disk := usage[string(payloads.DiskMB)] - old[string(payloads.DiskMB)]
+		return mem <= n.MemAvailable && disk <= n.DiskAvailable
+	}
+
+	return true
+}
+
+// restartResizedInstance restarts a stopped instance that has been resized
+// in place, first updating its limits to those of wl.
+func (c *controller) restartResizedInstance(instanceID string, nodeID string, wl *types.Workload) {
+	err := c.client.updateLimits(instanceID, nodeID, workloadLimits(wl))
+	if err == nil {
+		err = c.client.restartResizedInstance(instanceID, nodeID, workloadSizes(wl))
+	}
+
+	if err != nil {
+		glog.Warningf("Unable to restart resized instance %s: %v", instanceID, err)
+	}
+}
+
+// resizeInstance changes the workload of a stopped instance to workloadID.
+// The instance is restarted with the resources of its new workload on the
+// node it was running on if that node has the capacity to host it.
+// Otherwise the instance is deleted from that node and relaunched, with the
+// same ID, IP address and volumes, on a node chosen by the scheduler when the
+// node reports that it has been deleted.  This is only possible for instances
+// that boot from a volume.
+func (c *controller) resizeInstance(instanceID string, workloadID string) error {
+	i, err := c.ds.GetInstance(instanceID)
+	if err != nil {
+		return err
+	}
+
+	if i.NodeID == "" {
+		return types.ErrInstanceNotAssigned
+	}
+
+	if i.CNCI || i.State != payloads.ComputeStatusStopped {
+		return types.ErrInstanceNotStopped
+	}
+
+	_, err = c.ds.GetInstanceResize(instanceID)
+	if err == nil {
+		return datastore.ErrResizeInProgress
+	}
+
+	old, err := c.ds.GetWorkload(i.WorkloadID)
+	if err != nil {
+		return err
+	}
+
+	wl, err := c.ds.GetWorkload(workloadID)
+	if err != nil || wl.ID == old.ID || isCNCIWorkload(wl) ||
+		wl.VMType != old.VMType || wl.ImageID != old.ImageID ||
+		wl.ImageName != old.ImageName {
+		return types.ErrInvalidResize
+	}
+
+	usage := workloadUsage(wl)
+
+	err = c.resizeAllowed(i, usage)
+	if err != nil {
+		return err
+	}
+
+	migrate := !c.nodeHasCapacity(i.NodeID, i.Usage, usage)
+	if migrate {
+		if !bootsFromVolume(old) {
+			return types.ErrNoCapacity
+		}
+
+		_, _, err = c.instanceStorage(i)
+		if err != nil {
+			glog.Warningf("Unable to move instance %s: %v", instanceID, err)
+			return types.ErrNoCapacity
+		}
+	}
+
+	nodeID := i.NodeID
+	err = c.ds.ResizeInstance(instanceID, workloadID, usage, migrate)
+	if err != nil {
+		return err
+	}
+
+	if migrate {
+		go c.client.DeleteInstance(instanceID, nodeID)
+	} else {
+		go c.restartResizedInstance(instanceID, nodeID, wl)
+	}
+
+	return nil
+}
+
+// relaunchResizedInstance launches an instance that is being moved to
+// another node as part of a resize, once the node it was running on has
+// deleted it.  It returns false if the instance is not being moved.
+func (c *controller) relaunchResizedInstance(instanceID string) (bool, error) {
+	r, err := c.ds.GetInstanceResize(instanceID)
+	if err != nil || !r.Migrating {
+		return false, nil
+	}
+
+	i, err := c.ds.GetInstance(instanceID)
+	if err != nil {
+		return true, err
+	}
+
+	wl, err := c.ds.GetWorkload(i.WorkloadID)
+	if err != nil {
+		return true, err
+	}
+
+	boot, volumes, err := c.instanceStorage(i)
+	if err != nil {
+		return true, err
+	}
+
+	config, err := relaunchConfig(c, wl, i, boot, volumes)
+	if err != nil {
+		return true, err
+	}
+
+	err = c.ds.RelocateInstance(instanceID)
+	if err != nil {
+		return true, err
+	}
+
+	return true, c.client.StartWorkload(config.config)
+}
+
+// confirmResize confirms the resize of an instance, which can then no
+// longer be reverted.
+func (c *controller) confirmResize(instanceID string) error {
+	return c.ds.ConfirmResize(instanceID)
+}
+
+// revertResize restores the workload an instance had before it was resized.
+// Like resizeInstance, it requires the instance to be stopped and restarts
+// it with the resources of that workload.  The instance is not moved back to
+// the node it was running on if it was moved by the resize, and disks that
+// were grown by the resize are not shrunk.
+func (c *controller) revertResize(instanceID string) error {
+	i, err := c.ds.GetInstance(instanceID)
+	if err != nil {
+		return err
+	}
+
+	r, err := c.ds.GetInstanceResize(instanceID)
+	if err != nil {
+		return err
+	}
+
+	if r.Migrating || i.NodeID == "" {
+		return types.ErrInstanceNotAssigned
+	}
+
+	if i.State != payloads.ComputeStatusStopped {
+		return types.ErrInstanceNotStopped
+	}
+
+	wl, err := c.ds.GetWorkload(r.OldWorkloadID)
+	if err != nil {
+		return err
+	}
+
+	if !c.nodeHasCapacity(i.NodeID, i.Usage, r.OldUsage) {
+		return types.ErrNoCapacity
+	}
+
+	nodeID := i.NodeID
+	_, err = c.ds.RevertResize(instanceID)
+	if err != nil {
+		return err
+	}
+
+	go c.restartResizedInstance(instanceID, nodeID, wl)
+
+	return nil
+}
+
 func (c *controller) stopInstance(instanceID string) error {
 	// get node id.  If there is no node id we can't send a delete
 	i, err := c.ds.GetInstance(instanceID)
@@ -86,6 +404,148 @@ func (c *controller) deleteInstance(instanceID string) error {
 	return nil
 }
 
+// workloadLimits returns the resource limits defined by wl.
+func workloadLimits(wl *types.Workload) []payloads.RequestedResource {
+	limits := []payloads.RequestedResource{}
+	for _, r := range wl.Defaults {
+		if payloads.IsLimit(r.Type) {
+			limits = append(limits, r)
+		}
+	}
+	return limits
+}
+
+// updateWorkloadLimits sends the resource limits of wl to the instances of
+// wl that have been assigned to a node, so that changes to the limits of a
+// workload apply to its running instances.  Failures are logged but are not
+// reported to the caller as the workload itself has already been updated.
+func (c *controller) updateWorkloadLimits(wl *types.Workload) {
+	limits := workloadLimits(wl)
+
+	instances, err := c.ds.GetAllInstances()
+	if err != nil {
+		glog.Warningf("Unable to retrieve instances of workload %s: %v", wl.ID, err)
+		return
+	}
+
+	for _, i := range instances {
+		if i.WorkloadID != wl.ID || i.NodeID == "" {
+			continue
+		}
+
+		err = c.client.updateLimits(i.ID, i.NodeID, limits)
+		if err != nil {
+			glog.Warningf("Unable to update limits of instance %s: %v", i.ID, err)
+		}
+	}
+}
+
+// tenantCNCI returns the ID of the CNCI of the tenant owning instance.
+func (c *controller) tenantCNCI(instance *types.Instance) (string, error) {
+	tenant, err := c.ds.GetTenant(instance.TenantID)
+	if err != nil {
+		return "", err
+	}
+
+	if tenant == nil || tenant.CNCIID == "" {
+		return "", errors.New("Tenant CNCI not available")
+	}
+
+	return tenant.CNCIID, nil
+}
+
+// mapPublicIP asks the tenant CNCI to map a public IP to an instance.
+// The instance public IP is only set once the CNCI reports the public IP
+// as assigned.
+func (c *controller) mapPublicIP(ID string, instanceID string) error {
+	i, err := c.ds.GetInstance(instanceID)
+	if err != nil {
+		return err
+	}
+
+	ip, err := c.ds.MapPublicIP(ID, instanceID)
+	if err != nil {
+		return err
+	}
+
+	// there is no CNCI to map the public IP without networking.
+	if *noNetwork {
+		return c.ds.PublicIPAssigned(instanceID, ip.Address)
+	}
+
+	cnciID, err := c.tenantCNCI(i)
+	if err == nil {
+		err = c.client.assignPublicIP(ip, cnciID, i)
+	}
+
+	if err != nil {
+		_, dsErr := c.ds.UnmapPublicIP(ID)
+		if dsErr != nil {
+			glog.Error(dsErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// unmapPublicIP removes the mapping of a public IP to an instance and asks
+// the tenant CNCI to release it.
+func (c *controller) unmapPublicIP(ID string) error {
+	ip, err := c.ds.GetPublicIP(ID)
+	if err != nil {
+		return err
+	}
+
+	// get the instance first, the datastore forgets about its
+	// public IP once unmapped.
+	i, err := c.ds.GetInstance(ip.InstanceID)
+	if err != nil {
+		i = nil
+	}
+
+	ip, err = c.ds.UnmapPublicIP(ID)
+	if err != nil {
+		return err
+	}
+
+	if *noNetwork || i == nil {
+		return nil
+	}
+
+	cnciID, err := c.tenantCNCI(i)
+	if err != nil {
+		return err
+	}
+
+	return c.client.releasePublicIP(ip, cnciID, i)
+}
+
+// releaseInstancePublicIPs unmaps the public IPs of an instance which is
+// being deleted.  The public IPs remain allocated to the tenant.
+func (c *controller) releaseInstancePublicIPs(instanceID string) {
+	i, err := c.ds.GetInstance(instanceID)
+	if err != nil {
+		return
+	}
+
+	ips, err := c.ds.GetTenantPublicIPs(i.TenantID)
+	if err != nil {
+		return
+	}
+
+	for _, ip := range ips {
+		if ip.InstanceID != instanceID {
+			continue
+		}
+
+		err = c.unmapPublicIP(ip.ID)
+		if err != nil {
+			glog.Warningf("Unable to release public IP %s: %v", ip.Address, err)
+		}
+	}
+}
+
 func (c *controller) confirmTenant(tenantID string) error {
 	tenant, err := c.ds.GetTenant(tenantID)
 	if err != nil {
@@ -122,6 +582,39 @@ func (c *controller) confirmTenant(tenantID string) error {
 	return nil
 }
 
+// setTenantLimit stores the limit of a resource for a tenant.  A negative
+// limit removes the limit, leaving the resource unlimited.
+func (c *controller) setTenantLimit(tenantID string, resource int, limit int) error {
+	if limit < 0 {
+		return c.ds.DeleteLimit(tenantID, resource)
+	}
+
+	return c.ds.AddLimit(tenantID, resource, limit)
+}
+
+// getTenantResource returns a copy of a resource of a tenant.  A tenant
+// without that resource gets an unused and unlimited one.
+func (c *controller) getTenantResource(tenantID string, resource int) (types.Resource, error) {
+	res := types.Resource{Rtype: resource, Limit: -1}
+
+	tenant, err := c.ds.GetTenant(tenantID)
+	if err != nil {
+		return res, err
+	}
+
+	if tenant == nil {
+		return res, types.ErrTenantNotFound
+	}
+
+	for _, r := range tenant.Resources {
+		if r.Rtype == resource {
+			return *r, nil
+		}
+	}
+
+	return res, nil
+}
+
 func (c *controller) startWorkload(workloadID string, tenantID string, instances int, trace bool, label string) ([]*types.Instance, error) {
 	var e error
 
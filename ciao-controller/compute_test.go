@@ -17,8 +17,10 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"sort"
@@ -27,9 +29,12 @@ import (
 
 	"github.com/01org/ciao/ciao-controller/types"
 	"github.com/01org/ciao/openstack/compute"
+	osIdentity "github.com/01org/ciao/openstack/identity"
+	image "github.com/01org/ciao/openstack/image"
 	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp"
 	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
 )
 
 func testHTTPRequest(t *testing.T, method string, URL string, expectedResponse int, data []byte, validToken bool) []byte {
@@ -1309,3 +1314,722 @@ func TestTraceData(t *testing.T) {
 func TestTraceDataInvalidToken(t *testing.T) {
 	testTraceData(t, http.StatusUnauthorized, false)
 }
+
+type testImageService struct {
+	createdCh chan string
+	deletedCh chan string
+	tokenCh   chan image.TokenScope
+}
+
+func (is testImageService) CreateImage(caller osIdentity.Identity, req image.CreateImageRequest) (image.DefaultResponse, error) {
+	is.createdCh <- req.Owner + "/" + req.Name
+	return image.DefaultResponse{ID: testutil.ImageUUID, Name: &req.Name}, nil
+}
+
+func (is testImageService) UploadImage(osIdentity.Identity, string, io.Reader) (image.NoContentImageResponse, error) {
+	return image.NoContentImageResponse{}, nil
+}
+
+func (is testImageService) ListImages(osIdentity.Identity) ([]image.DefaultResponse, error) {
+	return []image.DefaultResponse{}, nil
+}
+
+func (is testImageService) GetImage(osIdentity.Identity, string) (image.DefaultResponse, error) {
+	return image.DefaultResponse{}, image.ErrNoImage
+}
+
+func (is testImageService) DeleteImage(caller osIdentity.Identity, ID string) (image.NoContentImageResponse, error) {
+	is.deletedCh <- ID
+	return image.NoContentImageResponse{ImageID: ID}, nil
+}
+
+func (is testImageService) DownloadImage(osIdentity.Identity, string) (io.ReadCloser, error) {
+	return nil, image.ErrNoImageData
+}
+
+func (is testImageService) UpdateImage(osIdentity.Identity, string, []image.PatchOperation) (image.DefaultResponse, error) {
+	return image.DefaultResponse{}, image.ErrNoImage
+}
+
+func (is testImageService) ListImageMembers(osIdentity.Identity, string) ([]image.ImageMember, error) {
+	return nil, image.ErrNoImage
+}
+
+func (is testImageService) AddImageMember(osIdentity.Identity, string, string) (image.ImageMember, error) {
+	return image.ImageMember{}, image.ErrNoImage
+}
+
+func (is testImageService) GetImageMember(osIdentity.Identity, string, string) (image.ImageMember, error) {
+	return image.ImageMember{}, image.ErrNoImage
+}
+
+func (is testImageService) UpdateImageMember(osIdentity.Identity, string, string, image.MemberStatus) (image.ImageMember, error) {
+	return image.ImageMember{}, image.ErrNoImage
+}
+
+func (is testImageService) DeleteImageMember(osIdentity.Identity, string, string) error {
+	return image.ErrNoImage
+}
+
+func (is testImageService) CreateImageToken(caller osIdentity.Identity, ID string, scope image.TokenScope) (image.TokenResponse, error) {
+	is.tokenCh <- scope
+	return image.TokenResponse{Token: "upload-token", Scope: scope, ImageID: ID}, nil
+}
+
+func TestServerActionCreateImage(t *testing.T) {
+	is := testImageService{
+		createdCh: make(chan string, 1),
+		deletedCh: make(chan string, 1),
+		tokenCh:   make(chan image.TokenScope, 2),
+	}
+	ts := httptest.NewServer(image.Routes(image.APIConfig{ImageService: is}))
+	defer ts.Close()
+
+	oldURL := imageServiceURL
+	imageServiceURL = ts.URL
+	defer func() { imageServiceURL = oldURL }()
+
+	tenant, err := ctl.ds.GetTenant(testutil.ComputeUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := testutil.NewSsntpTestClientConnection("ServerActionCreateImage", ssntp.AGENT, testutil.AgentUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown()
+
+	servers := testCreateServer(t, 1)
+	if servers.TotalServers != 1 {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1 * time.Second)
+
+	sendStatsCmd(client, t)
+
+	time.Sleep(1 * time.Second)
+
+	serverCh := server.AddCmdChan(ssntp.CreateImage)
+
+	var req compute.CreateImageRequest
+	req.CreateImage.Name = "golden-image"
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := testutil.ComputeURL + "/v2.1/" + tenant.ID + "/servers/" + servers.Servers[0].ID + "/action"
+	body := testHTTPRequest(t, "POST", url, http.StatusAccepted, b, true)
+
+	var resp compute.CreateImageResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.ImageID != testutil.ImageUUID {
+		t.Fatalf("expected image %s, got %s", testutil.ImageUUID, resp.ImageID)
+	}
+
+	select {
+	case name := <-is.createdCh:
+		// the image is owned by the tenant of the instance
+		if name != tenant.ID+"/"+req.CreateImage.Name {
+			t.Fatalf("expected image %s/%s, got %s", tenant.ID, req.CreateImage.Name, name)
+		}
+	default:
+		t.Fatal("Image not created in image service")
+	}
+
+	instance, err := ctl.ds.GetInstance(servers.Servers[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wl, err := ctl.ds.GetWorkload(instance.WorkloadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the nodes are only given tokens to download the image of the
+	// instance when starting it, if it boots from an image, and then
+	// to upload its snapshot
+	scopes := []image.TokenScope{image.UploadScope}
+	if wl.ImageID != "" && wl.VMType != payloads.Docker {
+		scopes = append([]image.TokenScope{image.DownloadScope}, scopes...)
+	}
+
+	for _, expected := range scopes {
+		select {
+		case scope := <-is.tokenCh:
+			if scope != expected {
+				t.Fatalf("expected %s token, got %s", expected, scope)
+			}
+		default:
+			t.Fatalf("%s token not created in image service", expected)
+		}
+	}
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.CreateImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.InstanceUUID != servers.Servers[0].ID || result.NodeUUID != client.UUID {
+		t.Fatalf("expected %s %s, got %s %s", servers.Servers[0].ID, client.UUID,
+			result.InstanceUUID, result.NodeUUID)
+	}
+
+	// a failure to create the image should remove it from the image service
+	failure := payloads.ErrorCreateImageFailure{
+		InstanceUUID: servers.Servers[0].ID,
+		ImageUUID:    resp.ImageID,
+		Reason:       payloads.CreateImageUploadFailure,
+	}
+	y, err := yaml.Marshal(&failure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl.client.ErrorNotify(ssntp.CreateImageFailure, &ssntp.Frame{Payload: y})
+
+	select {
+	case ID := <-is.deletedCh:
+		if ID != resp.ImageID {
+			t.Fatalf("expected image %s to be deleted, got %s", resp.ImageID, ID)
+		}
+	default:
+		t.Fatal("Image not deleted from image service")
+	}
+}
+
+func TestServerActionGetConsoleOutput(t *testing.T) {
+	tenant, err := ctl.ds.GetTenant(testutil.ComputeUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := testutil.NewSsntpTestClientConnection("ServerActionGetConsoleOutput", ssntp.AGENT, testutil.AgentUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown()
+
+	servers := testCreateServer(t, 1)
+	if servers.TotalServers != 1 {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1 * time.Second)
+
+	sendStatsCmd(client, t)
+
+	time.Sleep(1 * time.Second)
+
+	b := []byte(`{"os-getConsoleOutput":{"length":50}}`)
+	url := testutil.ComputeURL + "/v2.1/" + tenant.ID + "/servers/" + servers.Servers[0].ID + "/action"
+	body := testHTTPRequest(t, "POST", url, http.StatusOK, b, true)
+
+	var resp compute.GetConsoleOutputResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Output != testutil.ConsoleOutput {
+		t.Fatalf("expected console output %q, got %q", testutil.ConsoleOutput, resp.Output)
+	}
+
+	// a launcher failure should be reported to the caller
+	client.GetConsoleFail = true
+	client.GetConsoleFailReason = payloads.GetConsoleNoLog
+	_ = testHTTPRequest(t, "POST", url, http.StatusInternalServerError, b, true)
+}
+
+func TestServerActionResize(t *testing.T) {
+	tenant, err := ctl.ds.GetTenant(testutil.ComputeUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers := testCreateServer(t, 1)
+	if servers.TotalServers != 1 {
+		t.Fatal(err)
+	}
+
+	url := testutil.ComputeURL + "/v2.1/" + tenant.ID + "/servers/" + servers.Servers[0].ID + "/action"
+
+	_ = testHTTPRequest(t, "POST", url, http.StatusBadRequest, []byte(`{"resize":{}}`), true)
+
+	// no resize has been requested so there is nothing to confirm or revert
+	_ = testHTTPRequest(t, "POST", url, http.StatusConflict, []byte(`{"confirmResize":null}`), true)
+	_ = testHTTPRequest(t, "POST", url, http.StatusConflict, []byte(`{"revertResize":null}`), true)
+}
+
+func TestFloatingIPs(t *testing.T) {
+	tenant, err := ctl.ds.GetTenant(testutil.ComputeUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bulk compute.CreateFloatingIPsBulkRequest
+	bulk.FloatingIPsBulkCreate.IPRange = "198.51.100.0/30"
+	bulk.FloatingIPsBulkCreate.Pool = "test"
+
+	b, err := json.Marshal(bulk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := testutil.ComputeURL + "/v2.1/os-floating-ips-bulk"
+	_ = testHTTPRequest(t, "POST", url, http.StatusOK, b, true)
+
+	url = testutil.ComputeURL + "/v2.1/" + tenant.ID + "/os-floating-ip-pools"
+	body := testHTTPRequest(t, "GET", url, http.StatusOK, nil, true)
+
+	var pools compute.FloatingIPPools
+	err = json.Unmarshal(body, &pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pools.FloatingIPPools) != 1 || pools.FloatingIPPools[0].Name != "test" {
+		t.Fatalf("expected pool test, got %v", pools.FloatingIPPools)
+	}
+
+	url = testutil.ComputeURL + "/v2.1/" + tenant.ID + "/os-floating-ips"
+	body = testHTTPRequest(t, "POST", url, http.StatusOK, []byte(`{"pool":"test"}`), true)
+
+	var ip compute.FloatingIP
+	err = json.Unmarshal(body, &ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ip.FloatingIP.Pool != "test" || ip.FloatingIP.InstanceID != nil {
+		t.Fatalf("bad floating IP %v", ip.FloatingIP)
+	}
+
+	servers := testCreateServer(t, 1)
+	serverID := servers.Servers[0].ID
+
+	serverCh := server.AddCmdChan(ssntp.AssignPublicIP)
+
+	url = testutil.ComputeURL + "/v2.1/" + tenant.ID + "/servers/" + serverID + "/action"
+	action := `{"addFloatingIp":{"address":"` + ip.FloatingIP.IP + `"}}`
+	_ = testHTTPRequest(t, "POST", url, http.StatusAccepted, []byte(action), true)
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.AssignPublicIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.InstanceUUID != serverID {
+		t.Fatalf("expected instance %s, got %s", serverID, result.InstanceUUID)
+	}
+
+	// a floating IP can only be associated to one server at a time
+	_ = testHTTPRequest(t, "POST", url, http.StatusConflict, []byte(action), true)
+
+	assigned := payloads.EventPublicIPAssigned{
+		AssignedIP: payloads.PublicIPEvent{
+			ConcentratorUUID: tenant.CNCIID,
+			InstanceUUID:     serverID,
+			PublicIP:         ip.FloatingIP.IP,
+		},
+	}
+	y, err := yaml.Marshal(&assigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl.client.EventNotify(ssntp.PublicIPAssigned, &ssntp.Frame{Payload: y})
+
+	instance, err := ctl.ds.GetInstance(serverID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if instance.PublicIP != ip.FloatingIP.IP {
+		t.Fatalf("expected public IP %s, got %s", ip.FloatingIP.IP, instance.PublicIP)
+	}
+
+	serverCh = server.AddCmdChan(ssntp.ReleasePublicIP)
+
+	action = `{"removeFloatingIp":{"address":"` + ip.FloatingIP.IP + `"}}`
+	_ = testHTTPRequest(t, "POST", url, http.StatusAccepted, []byte(action), true)
+
+	result, err = server.GetCmdChanResult(serverCh, ssntp.ReleasePublicIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.InstanceUUID != serverID {
+		t.Fatalf("expected instance %s, got %s", serverID, result.InstanceUUID)
+	}
+
+	if instance.PublicIP != "" {
+		t.Fatalf("public IP %s not removed from instance", instance.PublicIP)
+	}
+
+	// allocated floating IPs cannot be removed from the pool
+	url = testutil.ComputeURL + "/v2.1/os-floating-ips-bulk/delete"
+	_ = testHTTPRequest(t, "PUT", url, http.StatusConflict, []byte(`{"ip_range":"198.51.100.0/30"}`), true)
+
+	url = testutil.ComputeURL + "/v2.1/" + tenant.ID + "/os-floating-ips/" + ip.FloatingIP.ID
+	_ = testHTTPRequest(t, "DELETE", url, http.StatusAccepted, nil, true)
+
+	url = testutil.ComputeURL + "/v2.1/os-floating-ips-bulk/delete"
+	_ = testHTTPRequest(t, "PUT", url, http.StatusOK, []byte(`{"ip_range":"198.51.100.0/30"}`), true)
+
+	url = testutil.ComputeURL + "/v2.1/os-floating-ips-bulk"
+	body = testHTTPRequest(t, "GET", url, http.StatusOK, nil, true)
+
+	var ips compute.FloatingIPsBulk
+	err = json.Unmarshal(body, &ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ips.FloatingIPInfo) != 0 {
+		t.Fatalf("floating IPs not deleted: %v", ips.FloatingIPInfo)
+	}
+}
+
+func TestQuotaSets(t *testing.T) {
+	tenant, err := ctl.ds.GetTenant(testutil.ComputeUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := testutil.ComputeURL + "/v2.1/" + tenant.ID + "/os-quota-sets/" + tenant.ID
+	_ = testHTTPRequest(t, "PUT", url, http.StatusUnauthorized, []byte(`{"quota_set":{"instances":100}}`), false)
+	_ = testHTTPRequest(t, "PUT", url, http.StatusBadRequest, []byte(`{"quota_set":{"instances":-2}}`), true)
+
+	body := testHTTPRequest(t, "PUT", url, http.StatusOK, []byte(`{"quota_set":{"instances":100,"ram":-1}}`), true)
+
+	var quotas compute.QuotaSetResponse
+	err = json.Unmarshal(body, &quotas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := compute.QuotaSet{
+		ID:        tenant.ID,
+		Instances: 100,
+		Cores:     -1,
+		RAM:       -1,
+		Disk:      -1,
+	}
+
+	if quotas.QuotaSet != expected {
+		t.Fatalf("expected %v, got %v", expected, quotas.QuotaSet)
+	}
+
+	body = testHTTPRequest(t, "GET", url+"/detail", http.StatusOK, nil, true)
+
+	var detail compute.QuotaSetDetailResponse
+	err = json.Unmarshal(body, &detail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := ctl.ds.GetAllInstancesFromTenant(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if detail.QuotaSet.Instances.Limit != 100 ||
+		detail.QuotaSet.Instances.InUse != len(instances) {
+		t.Fatalf("bad instances quota %v", detail.QuotaSet.Instances)
+	}
+
+	_ = testHTTPRequest(t, "DELETE", url, http.StatusAccepted, nil, true)
+
+	body = testHTTPRequest(t, "GET", url, http.StatusOK, nil, true)
+
+	err = json.Unmarshal(body, &quotas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if quotas.QuotaSet.Instances != -1 {
+		t.Fatalf("instances quota not reset: %v", quotas.QuotaSet)
+	}
+}
+
+func TestIPRangeAddresses(t *testing.T) {
+	tests := []struct {
+		ipRange   string
+		addresses []string
+		err       error
+	}{
+		{"198.51.100.7", []string{"198.51.100.7"}, nil},
+		{"198.51.100.7/32", []string{"198.51.100.7"}, nil},
+		{"198.51.100.6/31", []string{"198.51.100.6", "198.51.100.7"}, nil},
+		{"198.51.100.0/30", []string{"198.51.100.1", "198.51.100.2"}, nil},
+		{"255.255.255.255", []string{"255.255.255.255"}, nil},
+		{"255.255.255.255/32", []string{"255.255.255.255"}, nil},
+		{"255.255.255.254/31", []string{"255.255.255.254", "255.255.255.255"}, nil},
+		{"255.255.255.252/30", []string{"255.255.255.253", "255.255.255.254"}, nil},
+		{"0.0.0.0/31", []string{"0.0.0.0", "0.0.0.1"}, nil},
+		{"10.0.0.0/8", nil, compute.ErrInvalidIPRange},
+		{"2001:db8::/64", nil, compute.ErrInvalidIPRange},
+		{"not an address", nil, compute.ErrInvalidIPRange},
+	}
+
+	for _, tt := range tests {
+		addresses, err := ipRangeAddresses(tt.ipRange)
+		if err != tt.err {
+			t.Errorf("%s: expected error %v, got %v", tt.ipRange, tt.err, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(addresses, tt.addresses) {
+			t.Errorf("%s: expected %v, got %v", tt.ipRange, tt.addresses, addresses)
+		}
+	}
+}
+
+func TestWorkloads(t *testing.T) {
+	req := types.CiaoWorkloadDetail{
+		Workload: types.CiaoWorkload{
+			Description: "test docker workload",
+			VMType:      string(payloads.Docker),
+			ImageName:   "ubuntu:latest",
+			Config:      "---\n#cloud-config\n...\n",
+			Defaults: []types.CiaoWorkloadResource{
+				{Type: string(payloads.VCPUs), Value: 1, Mandatory: true},
+				{Type: string(payloads.MemMB), Value: 256, Mandatory: true},
+			},
+		},
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := testutil.ComputeURL + "/v2.1/workloads"
+	_ = testHTTPRequest(t, "POST", url, http.StatusUnauthorized, b, false)
+	body := testHTTPRequest(t, "POST", url, http.StatusCreated, b, true)
+
+	var created types.CiaoWorkloadDetail
+	err = json.Unmarshal(body, &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created.Workload.ID == "" {
+		t.Fatal("workload ID not generated")
+	}
+
+	req.Workload.ID = created.Workload.ID
+	if !reflect.DeepEqual(created, req) {
+		t.Fatalf("expected workload %v, got %v", req, created)
+	}
+
+	url = testutil.ComputeURL + "/v2.1/workloads/" + created.Workload.ID
+	body = testHTTPRequest(t, "GET", url, http.StatusOK, nil, true)
+
+	var shown types.CiaoWorkloadDetail
+	err = json.Unmarshal(body, &shown)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(shown, req) {
+		t.Fatalf("expected workload %v, got %v", req, shown)
+	}
+
+	req.Workload.Description = "updated test docker workload"
+	req.Workload.Defaults = req.Workload.Defaults[1:]
+
+	b, err = json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = testHTTPRequest(t, "PUT", url, http.StatusOK, b, true)
+
+	wl, err := ctl.ds.GetWorkload(created.Workload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wl.Description != req.Workload.Description || len(wl.Defaults) != 1 {
+		t.Fatalf("workload not updated: %v", wl)
+	}
+
+	cnciID, err := ctl.ds.GetCNCIWorkloadID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = testHTTPRequest(t, "DELETE", testutil.ComputeURL+"/v2.1/workloads/"+cnciID, http.StatusForbidden, nil, true)
+
+	_ = testHTTPRequest(t, "DELETE", url, http.StatusAccepted, nil, true)
+	_ = testHTTPRequest(t, "GET", url, http.StatusNotFound, nil, true)
+	_ = testHTTPRequest(t, "DELETE", url, http.StatusNotFound, nil, true)
+}
+
+func TestWorkloadLimits(t *testing.T) {
+	req := types.CiaoWorkloadDetail{
+		Workload: types.CiaoWorkload{
+			Description: "test limited docker workload",
+			VMType:      string(payloads.Docker),
+			ImageName:   "ubuntu:latest",
+			Config:      "---\n#cloud-config\n...\n",
+			Defaults: []types.CiaoWorkloadResource{
+				{Type: string(payloads.VCPUs), Value: 1, Mandatory: true},
+				{Type: string(payloads.MemMB), Value: 256, Mandatory: true},
+				{Type: string(payloads.CPUShares), Value: 512},
+				{Type: string(payloads.CPUQuota), Value: 50},
+				{Type: string(payloads.MemLimitMB), Value: 128},
+				{Type: string(payloads.DiskIOPS), Value: 100},
+				{Type: string(payloads.DiskMBps), Value: 10},
+			},
+		},
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := testutil.ComputeURL + "/v2.1/workloads"
+	body := testHTTPRequest(t, "POST", url, http.StatusCreated, b, true)
+
+	var created types.CiaoWorkloadDetail
+	err = json.Unmarshal(body, &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Workload.ID = created.Workload.ID
+	if !reflect.DeepEqual(created, req) {
+		t.Fatalf("expected workload %v, got %v", req, created)
+	}
+
+	// the limits must have been stored along with the workload
+	wl, err := ctl.ds.GetWorkload(created.Workload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits := workloadLimits(wl)
+	if len(limits) != 5 {
+		t.Fatalf("expected 5 limits, got %v", limits)
+	}
+
+	url = testutil.ComputeURL + "/v2.1/workloads/" + created.Workload.ID
+	body = testHTTPRequest(t, "GET", url, http.StatusOK, nil, true)
+
+	var shown types.CiaoWorkloadDetail
+	err = json.Unmarshal(body, &shown)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(shown, req) {
+		t.Fatalf("expected workload %v, got %v", req, shown)
+	}
+
+	_ = testHTTPRequest(t, "DELETE", url, http.StatusAccepted, nil, true)
+}
+
+func TestCiaoWorkloadToWorkload(t *testing.T) {
+	tests := []struct {
+		name  string
+		wl    types.CiaoWorkload
+		valid bool
+	}{
+		{
+			"qemu",
+			types.CiaoWorkload{Description: "vm", VMType: "qemu", FWType: "efi", ImageID: "image", Config: "config"},
+			true,
+		},
+		{
+			"boot from volume",
+			types.CiaoWorkload{Description: "vm", VMType: "qemu", FWType: "legacy", Config: "config",
+				Storage: &types.CiaoWorkloadStorage{Bootable: true, SourceType: "image", SourceID: "image"}},
+			true,
+		},
+		{
+			"docker",
+			types.CiaoWorkload{Description: "container", VMType: "docker", ImageName: "ubuntu", Config: "config"},
+			true,
+		},
+		{
+			"no description",
+			types.CiaoWorkload{VMType: "docker", ImageName: "ubuntu", Config: "config"},
+			false,
+		},
+		{
+			"no config",
+			types.CiaoWorkload{Description: "container", VMType: "docker", ImageName: "ubuntu"},
+			false,
+		},
+		{
+			"bad hypervisor",
+			types.CiaoWorkload{Description: "vm", VMType: "xen", ImageID: "image", Config: "config"},
+			false,
+		},
+		{
+			"bad firmware",
+			types.CiaoWorkload{Description: "vm", VMType: "qemu", FWType: "bios", ImageID: "image", Config: "config"},
+			false,
+		},
+		{
+			"no image",
+			types.CiaoWorkload{Description: "vm", VMType: "qemu", FWType: "efi", Config: "config"},
+			false,
+		},
+		{
+			"no docker image",
+			types.CiaoWorkload{Description: "container", VMType: "docker", Config: "config"},
+			false,
+		},
+		{
+			"limits",
+			types.CiaoWorkload{Description: "container", VMType: "docker", ImageName: "ubuntu", Config: "config",
+				Defaults: []types.CiaoWorkloadResource{{Type: "cpu_shares", Value: 512}, {Type: "mem_limit_mb", Value: 256}}},
+			true,
+		},
+		{
+			"bad resource",
+			types.CiaoWorkload{Description: "container", VMType: "docker", ImageName: "ubuntu", Config: "config",
+				Defaults: []types.CiaoWorkloadResource{{Type: "instances", Value: 1}}},
+			false,
+		},
+		{
+			"negative resource",
+			types.CiaoWorkload{Description: "container", VMType: "docker", ImageName: "ubuntu", Config: "config",
+				Defaults: []types.CiaoWorkloadResource{{Type: "vcpus", Value: -1}}},
+			false,
+		},
+		{
+			"bad storage source",
+			types.CiaoWorkload{Description: "vm", VMType: "qemu", FWType: "efi", Config: "config",
+				Storage: &types.CiaoWorkloadStorage{SourceType: "nfs"}},
+			false,
+		},
+		{
+			"no storage source ID",
+			types.CiaoWorkload{Description: "vm", VMType: "qemu", FWType: "efi", Config: "config",
+				Storage: &types.CiaoWorkloadStorage{SourceType: "volume"}},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := ciaoWorkloadToWorkload(tt.wl)
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("%s: invalid workload accepted", tt.name)
+		}
+	}
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/01org/ciao/ssntp"
 	"github.com/01org/ciao/ssntp/uuid"
 	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
 )
 
 func addTestTenant() (tenant *types.Tenant, err error) {
@@ -225,6 +226,29 @@ func TestTenantOutOfBounds(t *testing.T) {
 	}
 }
 
+func TestTenantVolumeLimitAllowsInstances(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// volumes are not consumed by instances
+	err = ctl.ds.AddLimit(tenant.ID, volumes, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ctl.ds.GetWorkloads()
+	if err != nil || len(wls) == 0 {
+		t.Fatal(err)
+	}
+
+	_, err = ctl.startWorkload(wls[0].ID, tenant.ID, 1, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestNewTenantHardwareAddr
 // Confirm that the mac addresses generated from a given
 // IP address is as expected.
@@ -403,6 +427,371 @@ func TestRestartInstance(t *testing.T) {
 	}
 }
 
+// stopTestInstance stops a running instance and sends stats so that the
+// controller knows it is stopped.
+func stopTestInstance(t *testing.T, client *testutil.SsntpTestClient, instanceID string) {
+	serverCh := server.AddCmdChan(ssntp.STOP)
+	clientCh := client.AddCmdChan(ssntp.STOP)
+
+	time.Sleep(1 * time.Second)
+
+	err := ctl.stopInstance(instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = server.GetCmdChanResult(serverCh, ssntp.STOP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetCmdChanResult(clientCh, ssntp.STOP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendStatsCmd(client, t)
+
+	time.Sleep(1 * time.Second)
+}
+
+// addResizeWorkload adds a copy of wl that requests memMB of memory.
+func addResizeWorkload(t *testing.T, wl *types.Workload, memMB int) *types.Workload {
+	resized := *wl
+	resized.ID = uuid.Generate().String()
+	resized.Description = "resized " + wl.Description
+	resized.Defaults = nil
+	for _, r := range wl.Defaults {
+		if r.Type == payloads.MemMB {
+			r.Value = memMB
+		}
+		resized.Defaults = append(resized.Defaults, r)
+	}
+
+	err := ctl.ds.AddWorkload(resized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &resized
+}
+
+func TestResizeInstance(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	time.Sleep(1 * time.Second)
+
+	sendStatsCmd(client, t)
+
+	time.Sleep(1 * time.Second)
+
+	wl, err := ctl.ds.GetWorkload(instances[0].WorkloadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resized := addResizeWorkload(t, wl, 1024)
+
+	err = ctl.resizeInstance(instances[0].ID, resized.ID)
+	if err != types.ErrInstanceNotStopped {
+		t.Fatalf("Expected %v, got %v", types.ErrInstanceNotStopped, err)
+	}
+
+	stopTestInstance(t, client, instances[0].ID)
+
+	serverCh := server.AddCmdChan(ssntp.RESTART)
+
+	err = ctl.resizeInstance(instances[0].ID, resized.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.RESTART)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instances[0].ID {
+		t.Fatal("Did not get correct Instance ID")
+	}
+
+	i, err := ctl.ds.GetInstance(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.WorkloadID != resized.ID || i.Usage[string(payloads.MemMB)] != 1024 {
+		t.Fatalf("Instance not resized %+v", i)
+	}
+
+	details, err := instanceToServer(ctl, i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Status != types.InstanceStatusVerifyResize {
+		t.Fatalf("Expected status %s, got %s", types.InstanceStatusVerifyResize, details.Status)
+	}
+
+	err = ctl.resizeInstance(instances[0].ID, wl.ID)
+	if err != datastore.ErrResizeInProgress {
+		t.Fatalf("Expected %v, got %v", datastore.ErrResizeInProgress, err)
+	}
+
+	err = ctl.confirmResize(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ctl.ds.GetInstanceResize(instances[0].ID)
+	if err != datastore.ErrNoResize {
+		t.Fatal("Resize not confirmed")
+	}
+}
+
+func TestRevertResize(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	time.Sleep(1 * time.Second)
+
+	sendStatsCmd(client, t)
+
+	stopTestInstance(t, client, instances[0].ID)
+
+	wl, err := ctl.ds.GetWorkload(instances[0].WorkloadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resized := addResizeWorkload(t, wl, 512)
+
+	err = ctl.revertResize(instances[0].ID)
+	if err != datastore.ErrNoResize {
+		t.Fatalf("Expected %v, got %v", datastore.ErrNoResize, err)
+	}
+
+	serverCh := server.AddCmdChan(ssntp.RESTART)
+
+	err = ctl.resizeInstance(instances[0].ID, resized.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = server.GetCmdChanResult(serverCh, ssntp.RESTART)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverCh = server.AddCmdChan(ssntp.RESTART)
+
+	err = ctl.revertResize(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = server.GetCmdChanResult(serverCh, ssntp.RESTART)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := ctl.ds.GetInstance(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.WorkloadID != wl.ID {
+		t.Fatalf("Resize not reverted %+v", i)
+	}
+}
+
+func TestResizeInstanceNoCapacity(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	time.Sleep(1 * time.Second)
+
+	sendStatsCmd(client, t)
+
+	stopTestInstance(t, client, instances[0].ID)
+
+	wl, err := ctl.ds.GetWorkload(instances[0].WorkloadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// more memory than the test node reports as available.  The
+	// instance has no known boot volume so it cannot be moved.
+	resized := addResizeWorkload(t, wl, 1024*1024)
+
+	err = ctl.resizeInstance(instances[0].ID, resized.ID)
+	if err != types.ErrNoCapacity {
+		t.Fatalf("Expected %v, got %v", types.ErrNoCapacity, err)
+	}
+
+	err = ctl.resizeInstance(instances[0].ID, "unknown")
+	if err != types.ErrInvalidResize {
+		t.Fatalf("Expected %v, got %v", types.ErrInvalidResize, err)
+	}
+
+	i, err := ctl.ds.GetInstance(instances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.WorkloadID != wl.ID {
+		t.Fatalf("Instance unexpectedly resized %+v", i)
+	}
+}
+
+func TestResizeInstanceMigrate(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	time.Sleep(1 * time.Second)
+
+	instance := instances[0]
+	boot := addTestBlockDevice(t, instance.TenantID)
+	volume := addTestBlockDevice(t, instance.TenantID)
+
+	wl, err := ctl.ds.GetWorkload(instance.WorkloadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bootable := *wl
+	bootable.ID = uuid.Generate().String()
+	bootable.Storage = &types.StorageResource{
+		ID:         boot.ID,
+		Bootable:   true,
+		SourceType: types.VolumeService,
+	}
+	err = ctl.ds.AddWorkload(bootable)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ctl.ds.ResizeInstance(instance.ID, bootable.ID, instance.Usage, false)
+	if err == nil {
+		err = ctl.ds.ConfirmResize(instance.ID)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ctl.ds.AttachBootVolume(instance.ID, boot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl.ds.HandleStats(payloads.Stat{
+		NodeUUID: client.UUID,
+		Status:   ssntp.READY.String(),
+		Load:     -1,
+		Instances: []payloads.InstanceStat{
+			{
+				InstanceUUID: instance.ID,
+				State:        payloads.ComputeStatusStopped,
+				Volumes:      []string{boot.ID, volume.ID},
+			},
+		},
+	})
+
+	// more memory than the test node reports as available so the
+	// instance, and both of its volumes, must be moved.
+	resized := addResizeWorkload(t, &bootable, 1024*1024)
+
+	serverDelCh := server.AddCmdChan(ssntp.DELETE)
+
+	err = ctl.resizeInstance(instance.ID, resized.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := server.GetCmdChanResult(serverDelCh, ssntp.DELETE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instance.ID {
+		t.Fatal("Did not get correct Instance ID")
+	}
+
+	serverCmdCh := server.AddCmdChan(ssntp.START)
+	serverEvtCh := server.AddEventChan(ssntp.InstanceDeleted)
+	go client.SendDeleteEvent(instance.ID)
+	_, err = server.GetEventChanResult(serverEvtCh, ssntp.InstanceDeleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = server.GetCmdChanResult(serverCmdCh, ssntp.START)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instance.ID {
+		t.Fatal("Resized instance was not relaunched")
+	}
+
+	i, err := ctl.ds.GetInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.WorkloadID != resized.ID {
+		t.Fatalf("Instance not resized %+v", i)
+	}
+
+	bootVolume, volumes, err := ctl.instanceStorage(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bootVolume.ID != boot.ID || len(volumes) != 1 || volumes[0].ID != volume.ID {
+		t.Fatalf("Unexpected volumes %v %v", bootVolume, volumes)
+	}
+}
+
+func TestUpdateWorkloadLimits(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	time.Sleep(1 * time.Second)
+
+	sendStatsCmd(client, t)
+
+	serverCh := server.AddCmdChan(ssntp.UpdateLimits)
+	clientCh := client.AddCmdChan(ssntp.UpdateLimits)
+
+	time.Sleep(1 * time.Second)
+
+	wl, err := ctl.ds.GetWorkload(instances[0].WorkloadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := *wl
+	updated.Defaults = append([]payloads.RequestedResource{
+		{Type: payloads.CPUShares, Value: 512},
+	}, wl.Defaults...)
+	ctl.updateWorkloadLimits(&updated)
+
+	result, err := server.GetCmdChanResult(serverCh, ssntp.UpdateLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.NodeUUID != client.UUID {
+		t.Fatal("Did not get node ID")
+	}
+
+	_, err = client.GetCmdChanResult(clientCh, ssntp.UpdateLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestEvacuateNode(t *testing.T) {
 	client, err := testutil.NewSsntpTestClientConnection("EvacuateNode", ssntp.AGENT, testutil.AgentUUID)
 	if err != nil {
@@ -749,6 +1138,228 @@ func TestInstanceDeletedEvent(t *testing.T) {
 	}
 }
 
+func TestInstanceEvacuatedEvent(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	time.Sleep(1 * time.Second)
+
+	serverEvtCh := server.AddEventChan(ssntp.InstanceEvacuated)
+	go client.SendEvacuatedEvent(instances[0].ID)
+	result, err := server.GetEventChanResult(serverEvtCh, ssntp.InstanceEvacuated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.NodeUUID != client.UUID {
+		t.Fatal("Did not get node ID")
+	}
+
+	time.Sleep(1 * time.Second)
+
+	// the instance does not boot from a volume, its root filesystem
+	// is gone with the node.
+	_, err = ctl.ds.GetInstance(instances[0].ID)
+	if err == nil {
+		t.Error("Evacuated instance not deleted")
+	}
+}
+
+func TestPersistentInstanceEvacuatedEvent(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 1, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	time.Sleep(1 * time.Second)
+
+	instance := instances[0]
+	boot := addTestBlockDevice(t, instance.TenantID)
+	volume := addTestBlockDevice(t, instance.TenantID)
+
+	wl, err := ctl.ds.GetWorkload(instance.WorkloadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bootable := *wl
+	bootable.ID = uuid.Generate().String()
+	bootable.Storage = &types.StorageResource{
+		ID:         boot.ID,
+		Bootable:   true,
+		SourceType: types.VolumeService,
+	}
+	err = ctl.ds.AddWorkload(bootable)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ctl.ds.ResizeInstance(instance.ID, bootable.ID, instance.Usage, false)
+	if err == nil {
+		err = ctl.ds.ConfirmResize(instance.ID)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ctl.ds.AttachBootVolume(instance.ID, boot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl.ds.HandleStats(payloads.Stat{
+		NodeUUID: client.UUID,
+		Status:   ssntp.READY.String(),
+		Load:     -1,
+		Instances: []payloads.InstanceStat{
+			{
+				InstanceUUID: instance.ID,
+				State:        payloads.ComputeStatusRunning,
+				Volumes:      []string{boot.ID, volume.ID},
+			},
+		},
+	})
+
+	bootVolume, volumes, err := ctl.instanceStorage(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bootVolume.ID != boot.ID || !bootVolume.Bootable ||
+		len(volumes) != 1 || volumes[0].ID != volume.ID {
+		t.Fatalf("Unexpected volumes %v %v", bootVolume, volumes)
+	}
+
+	serverCmdCh := server.AddCmdChan(ssntp.START)
+	serverEvtCh := server.AddEventChan(ssntp.InstanceEvacuated)
+	go client.SendEvacuatedEvent(instance.ID)
+	_, err = server.GetEventChanResult(serverEvtCh, ssntp.InstanceEvacuated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the controller should relaunch the same instance
+	result, err := server.GetCmdChanResult(serverCmdCh, ssntp.START)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != instance.ID {
+		t.Fatal("Evacuated instance was not relaunched")
+	}
+
+	_, err = ctl.ds.GetInstance(instance.ID)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestControllerPromotedEvent(t *testing.T) {
+	var reason payloads.StartFailureReason
+
+	client, instances := testStartWorkload(t, 2, false, reason)
+	defer client.Shutdown()
+
+	sendStatsCmd(client, t)
+
+	time.Sleep(1 * time.Second)
+
+	// the first instance went away while this controller was a backup
+	event := payloads.EventControllerPromoted{
+		ControllerPromoted: payloads.ControllerPromotedEvent{
+			ControllerUUID: testutil.ControllerUUID,
+			NodeStats: []payloads.Stat{
+				{
+					NodeUUID: client.UUID,
+					Status:   ssntp.READY.String(),
+					Load:     -1,
+					Instances: []payloads.InstanceStat{
+						{
+							InstanceUUID: instances[1].ID,
+							State:        payloads.ComputeStatusRunning,
+						},
+					},
+				},
+			},
+		},
+	}
+	y, err := yaml.Marshal(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl.client.EventNotify(ssntp.ControllerPromoted, &ssntp.Frame{Payload: y})
+
+	_, err = ctl.ds.GetInstance(instances[0].ID)
+	if err == nil {
+		t.Error("Unreported instance not deleted")
+	}
+
+	_, err = ctl.ds.GetInstance(instances[1].ID)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConsoleReplyPerRequest(t *testing.T) {
+	firstID, firstCh := ctl.client.addConsoleRequest()
+	secondID, secondCh := ctl.client.addConsoleRequest()
+	defer ctl.client.cancelConsoleRequest(firstID)
+
+	event := payloads.EventConsoleOutput{
+		ConsoleOutput: payloads.ConsoleOutputEvent{
+			InstanceUUID: testutil.InstanceUUID,
+			RequestUUID:  secondID,
+			Output:       testutil.ConsoleOutput,
+		},
+	}
+	y, err := yaml.Marshal(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl.client.EventNotify(ssntp.ConsoleOutput, &ssntp.Frame{Payload: y})
+
+	select {
+	case result := <-secondCh:
+		if result.err != nil || result.output != testutil.ConsoleOutput {
+			t.Errorf("Unexpected console result %v", result)
+		}
+	default:
+		t.Error("Console output not delivered to its request")
+	}
+
+	select {
+	case result := <-firstCh:
+		t.Errorf("Console output delivered to another request: %v", result)
+	default:
+	}
+
+	failure := payloads.ErrorGetConsoleFailure{
+		InstanceUUID: testutil.InstanceUUID,
+		RequestUUID:  firstID,
+		Reason:       payloads.GetConsoleNoLog,
+	}
+	y, err = yaml.Marshal(&failure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctl.client.ErrorNotify(ssntp.GetConsoleFailure, &ssntp.Frame{Payload: y})
+
+	select {
+	case result := <-firstCh:
+		if result.err == nil {
+			t.Error("Expected console error")
+		}
+	default:
+		t.Error("Console error not delivered to its request")
+	}
+}
+
 func TestStartFailure(t *testing.T) {
 	reason := payloads.FullCloud
 
@@ -1127,6 +1738,58 @@ func TestGetStorage(t *testing.T) {
 	}
 }
 
+// imageDriver is a block driver which, like storage.CephDriver, stores
+// the image identified by imageID.
+type imageDriver struct {
+	storage.NoopDriver
+	imageID string
+}
+
+func (d *imageDriver) HasImage(imageID string) bool {
+	return imageID == d.imageID
+}
+
+func TestGetStorageNoLocalImage(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// images stored in ceph by the image service have no local copy,
+	// only the block driver knows about them.
+	imageID := uuid.Generate().String()
+
+	s := &types.StorageResource{
+		Bootable:   true,
+		Persistent: true,
+		SourceType: types.ImageService,
+		SourceID:   imageID,
+	}
+
+	wl := &types.Workload{
+		ID:      "validID",
+		ImageID: imageID,
+		Storage: s,
+	}
+
+	_, err = getStorage(ctl, wl, tenant.ID)
+	if err == nil {
+		t.Fatal("Created storage from an image that does not exist")
+	}
+
+	defer func(d storage.BlockDriver) { ctl.BlockDriver = d }(ctl.BlockDriver)
+	ctl.BlockDriver = &imageDriver{imageID: imageID}
+
+	pl, err := getStorage(ctl, wl, tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pl.ID == "" || !pl.Bootable {
+		t.Errorf("wrong storage resource %+v", pl)
+	}
+}
+
 func TestStorageConfig(t *testing.T) {
 	var err error
 
@@ -1209,6 +1872,42 @@ func TestCreateVolume(t *testing.T) {
 	}
 }
 
+func TestCreateVolumeOverQuota(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limit := 1
+	_, err = ctl.UpdateVolumeQuotaSet(tenant.ID, block.QuotaSetUpdate{Volumes: &limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = createTestVolume(tenant.ID, 20, t)
+
+	_, err = ctl.CreateVolume(tenant.ID, block.RequestedVolume{Size: 20})
+	if err != block.ErrQuota {
+		t.Fatalf("expected %v, got %v", block.ErrQuota, err)
+	}
+
+	abs, err := ctl.GetAbsoluteLimits(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if abs.MaxTotalVolumes != 1 || abs.TotalVolumesUsed != 1 {
+		t.Fatalf("bad volume limits %v", abs)
+	}
+
+	err = ctl.DeleteVolumeQuotaSet(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = createTestVolume(tenant.ID, 20, t)
+}
+
 func TestDeleteVolume(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
@@ -0,0 +1,133 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	osimage "github.com/01org/ciao/openstack/image"
+)
+
+func (c *controller) imageServiceRequest(method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if token := c.imageServiceToken(); token != "" {
+		req.Header.Set("X-Auth-Token", token)
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
+// imageServiceToken returns the token the controller presents to the image
+// service.  The controller acts on behalf of the tenant using its own
+// service credentials.
+func (c *controller) imageServiceToken() string {
+	if c.id == nil {
+		return ""
+	}
+	return c.id.scV3.TokenID
+}
+
+// createServiceImage creates a new, empty, image called name and owned by
+// tenant in the image service and returns its UUID.  The contents of the
+// image, a qcow2 snapshot of an instance, are uploaded separately.
+func (c *controller) createServiceImage(name string, tenant string) (string, error) {
+	req := osimage.CreateImageRequest{
+		Name:            name,
+		ContainerFormat: osimage.Bare,
+		DiskFormat:      osimage.QCow,
+		Owner:           tenant,
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/v2/images", strings.TrimSuffix(imageServiceURL, "/"))
+	resp, err := c.imageServiceRequest("POST", url, b)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("Unable to create image %s: %s", name, resp.Status)
+	}
+
+	var image osimage.DefaultResponse
+	err = json.NewDecoder(resp.Body).Decode(&image)
+	if err != nil {
+		return "", err
+	}
+
+	return image.ID, nil
+}
+
+// deleteServiceImage deletes the image identified by ID from the image
+// service.
+func (c *controller) deleteServiceImage(ID string) error {
+	url := fmt.Sprintf("%s/v2/images/%s", strings.TrimSuffix(imageServiceURL, "/"), ID)
+	resp, err := c.imageServiceRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("Unable to delete image %s: %s", ID, resp.Status)
+	}
+
+	return nil
+}
+
+// createImageToken creates a short-lived token which grants access to the
+// image identified by ID, within scope, and which the controller gives to
+// the nodes instead of its own service credentials.
+func (c *controller) createImageToken(ID string, scope osimage.TokenScope) (string, error) {
+	b, err := json.Marshal(osimage.CreateTokenRequest{Scope: scope})
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/v2/images/%s/token", strings.TrimSuffix(imageServiceURL, "/"), ID)
+	resp, err := c.imageServiceRequest("POST", url, b)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("Unable to create %s token for image %s: %s", scope, ID, resp.Status)
+	}
+
+	var token osimage.TokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", err
+	}
+
+	return token.Token, nil
+}
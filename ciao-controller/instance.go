@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/01org/ciao/ciao-controller/types"
+	osimage "github.com/01org/ciao/openstack/image"
 	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp/uuid"
 	"github.com/golang/glog"
@@ -90,6 +91,14 @@ func (i *instance) Add() error {
 	if i.CNCI == false {
 		ds := i.ctl.ds
 		ds.AddInstance(&i.Instance)
+
+		storage := i.newConfig.sc.Start.Storage
+		if storage.ID != "" && storage.Bootable {
+			err := ds.AttachBootVolume(i.ID, storage.ID)
+			if err != nil {
+				glog.Warningf("Unable to record boot volume of instance %s: %v", i.ID, err)
+			}
+		}
 	} else {
 		i.ctl.ds.AddTenantCNCI(i.TenantID, i.ID, i.MACAddress)
 	}
@@ -126,7 +135,14 @@ func (i *instance) Allowed() (bool, error) {
 			}
 			continue
 		}
-		if res.OverLimit(i.Usage[res.Rname]) {
+
+		// resources such as volumes are not consumed by instances
+		request, ok := i.Usage[res.Rname]
+		if !ok {
+			continue
+		}
+
+		if res.OverLimit(request) {
 			return false, nil
 		}
 	}
@@ -181,13 +197,17 @@ func getStorage(c *controller, wl *types.Workload, tenant string) (payloads.Stor
 	// ID of source is the image id.
 	switch s.SourceType {
 	case types.ImageService:
-		path, err := c.image.GetImagePath(s.SourceID)
+		image, err := c.image.GetImagePath(s.SourceID)
 		if err != nil {
-			// this image doesn't exist
-			return payloads.StorageResources{}, err
+			// images stored in ceph by the image service have no
+			// local copy, the block driver clones them from their ID.
+			if !c.HasImage(s.SourceID) {
+				return payloads.StorageResources{}, err
+			}
+			image = s.SourceID
 		}
 
-		device, err := c.CreateBlockDevice(&path, s.Size)
+		device, err := c.CreateBlockDevice(&image, s.Size)
 		if err != nil {
 			return payloads.StorageResources{}, err
 		}
@@ -260,6 +280,48 @@ func getStorage(c *controller, wl *types.Workload, tenant string) (payloads.Stor
 }
 
 func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID string) (config, error) {
+	var ipAddress net.IP
+	var storage payloads.StorageResources
+
+	if isCNCIWorkload(wl) == false {
+		var err error
+
+		ipAddress, err = ctl.ds.AllocateTenantIP(tenantID)
+		if err != nil {
+			fmt.Println("Unable to allocate IP address: ", err)
+			return config{}, err
+		}
+
+		// handle storage resources
+		if wl.Storage != nil {
+			storage, err = getStorage(ctl, wl, tenantID)
+			if err != nil {
+				return config{ip: ipAddress.String()}, err
+			}
+		}
+	}
+
+	return buildConfig(ctl, wl, instanceID, tenantID, ipAddress, storage, nil)
+}
+
+// relaunchConfig creates the START configuration needed to launch an existing
+// instance, which keeps its IP address, as an instance of wl booting from the
+// volume described by storage.  The other volumes attached to the instance
+// are attached to the relaunched instance.
+func relaunchConfig(ctl *controller, wl *types.Workload, instance *types.Instance, storage payloads.StorageResources,
+	volumes []payloads.StorageResources) (config, error) {
+	ipAddress := net.ParseIP(instance.IPAddress)
+	if ipAddress == nil {
+		return config{}, fmt.Errorf("Invalid IP address %s", instance.IPAddress)
+	}
+
+	return buildConfig(ctl, wl, instance.ID, instance.TenantID, ipAddress, storage, volumes)
+}
+
+// buildConfig creates the START configuration of an instance of wl.  The
+// ipAddress is ignored for CNCI workloads.
+func buildConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID string,
+	ipAddress net.IP, storage payloads.StorageResources, volumes []payloads.StorageResources) (config, error) {
 	type UserData struct {
 		UUID     string `json:"uuid"`
 		Hostname string `json:"hostname"`
@@ -281,18 +343,11 @@ func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID
 	config.cnci = isCNCIWorkload(wl)
 
 	var networking payloads.NetworkResources
-	var storage payloads.StorageResources
 
 	// do we ever need to save the vnic uuid?
 	networking.VnicUUID = uuid.Generate().String()
 
 	if config.cnci == false {
-		ipAddress, err := ctl.ds.AllocateTenantIP(tenantID)
-		if err != nil {
-			fmt.Println("Unable to allocate IP address: ", err)
-			return config, err
-		}
-
 		networking.VnicMAC = newTenantHardwareAddr(ipAddress).String()
 
 		// send in CIDR notation?
@@ -313,14 +368,6 @@ func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID
 		// set the hostname and uuid for userdata
 		userData.UUID = instanceID
 		userData.Hostname = instanceID
-
-		// handle storage resources
-		if wl.Storage != nil {
-			storage, err = getStorage(ctl, wl, tenantID)
-			if err != nil {
-				return config, err
-			}
-		}
 	} else {
 		networking.VnicMAC = tenant.CNCIMAC
 
@@ -342,10 +389,17 @@ func newConfig(ctl *controller, wl *types.Workload, instanceID string, tenantID
 		RequestedResources:  defaults,
 		Networking:          networking,
 		Storage:             storage,
+		Volumes:             volumes,
 	}
 
 	if wl.VMType == payloads.Docker {
 		startCmd.DockerImage = wl.ImageName
+	} else if imageServiceURL != "" && imageID != "" {
+		startCmd.ImageServiceURL = imageServiceURL
+		startCmd.Token, err = ctl.createImageToken(imageID, osimage.DownloadScope)
+		if err != nil {
+			glog.Warningf("Unable to create download token for image %s: %v", imageID, err)
+		}
 	}
 
 	cmd := payloads.Start{
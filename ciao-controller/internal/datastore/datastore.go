@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"net"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -40,9 +41,24 @@ var (
 	ErrNoTenant            = errors.New("Tenant not found")
 	ErrNoBlockData         = errors.New("Block Device not found")
 	ErrNoStorageAttachment = errors.New("No Volume Attached")
+	ErrNoPublicIP          = errors.New("Public IP not found")
+	ErrNoFreePublicIP      = errors.New("No free public IP in pool")
+	ErrDuplicatePublicIP   = errors.New("Public IP already in pool")
+	ErrPublicIPInUse       = errors.New("Public IP in use")
+	ErrPublicIPNotMapped   = errors.New("Public IP not mapped to an instance")
+	ErrNoWorkload          = errors.New("Workload not found")
+	ErrDuplicateWorkload   = errors.New("Workload already exists")
+	ErrWorkloadInUse       = errors.New("Workload in use")
+	ErrInternalWorkload    = errors.New("Internal workloads cannot be modified")
+	ErrNoResize            = errors.New("Instance is not being resized")
+	ErrResizeInProgress    = errors.New("Instance is already being resized")
 )
 
 // Config contains configuration information for the datastore.
+// If PersistentURI is a postgres:// or postgresql:// URI, all data,
+// including the transient data, is stored in that PostgreSQL database
+// and TransientURI is ignored.  Otherwise both URIs refer to sqlite3
+// databases.
 type Config struct {
 	PersistentURI     string
 	TransientURI      string
@@ -93,9 +109,13 @@ type persistentStore interface {
 	getCNCIWorkloadID() (id string, err error)
 	getWorkloadNoCache(id string) (*workload, error)
 	getWorkloadsNoCache() ([]*workload, error)
+	addWorkload(wl *workload) error
+	updateWorkload(wl *workload) error
+	deleteWorkload(ID string) error
 
 	// interfaces related to tenants
 	addLimit(tenantID string, resourceID int, limit int) (err error)
+	deleteLimit(tenantID string, resourceID int) (err error)
 	addTenant(id string, MAC string) (err error)
 	getTenantNoCache(id string) (t *tenant, err error)
 	getTenantsNoCache() ([]*tenant, error)
@@ -106,6 +126,7 @@ type persistentStore interface {
 	// interfaces related to instances
 	getInstances() (instances []*types.Instance, err error)
 	addInstance(instance *types.Instance) (err error)
+	updateInstance(instance *types.Instance) (err error)
 	removeInstance(instanceID string) (err error)
 
 	// interfaces related to statistics
@@ -126,6 +147,30 @@ type persistentStore interface {
 	createStorageAttachment(a types.StorageAttachment) error
 	getAllStorageAttachments() (map[string]types.StorageAttachment, error)
 	deleteStorageAttachment(ID string) error
+
+	// public IP interfaces
+	getAllPublicIPs() (map[string]types.PublicIP, error)
+	createPublicIP(ip types.PublicIP) error
+	updatePublicIP(ip types.PublicIP) error
+	deletePublicIP(ID string) error
+
+	// getCacheChanges returns the number of changes made to the
+	// tenants, instances and public IPs tables, by any controller
+	// sharing the store.  It returns nil if the store is not shared.
+	getCacheChanges() (map[string]int64, error)
+}
+
+func isPostgresURI(URI string) bool {
+	return strings.HasPrefix(URI, "postgres://") ||
+		strings.HasPrefix(URI, "postgresql://")
+}
+
+func getPersistentStore(config Config) (persistentStore, error) {
+	if isPostgresURI(config.PersistentURI) {
+		return getPostgresStore(config)
+	}
+
+	return getSqliteStore(config)
 }
 
 // Datastore provides context for the datastore package.
@@ -155,6 +200,9 @@ type Datastore struct {
 	instances     map[string]*types.Instance
 	instancesLock *sync.RWMutex
 
+	// resizes is protected by instancesLock.
+	resizes map[string]types.InstanceResize
+
 	tenantUsage     map[string][]types.CiaoUsage
 	tenantUsageLock *sync.RWMutex
 
@@ -166,6 +214,14 @@ type Datastore struct {
 	attachLock      *sync.RWMutex
 	// maybe add a map[instanceid][]types.StorageAttachment
 	// to make retrieval of volumes faster.
+
+	publicIPs     map[string]types.PublicIP
+	publicIPsLock *sync.RWMutex
+
+	// cacheChanges holds the store changes counts the tenants,
+	// instances and public IPs caches were last loaded at.
+	cacheChanges     map[string]int64
+	cacheChangesLock *sync.Mutex
 }
 
 // Init initializes the private data for the Datastore object.
@@ -181,6 +237,14 @@ func (ds *Datastore) Init(config Config) error {
 
 	ds.db = ps
 
+	// the changes made while the caches are being filled are
+	// picked up on the first refresh.
+	ds.cacheChangesLock = &sync.Mutex{}
+	ds.cacheChanges, err = ds.db.getCacheChanges()
+	if err != nil {
+		glog.Warning(err)
+	}
+
 	ds.cnciAddedChans = make(map[string]chan bool)
 	ds.cnciAddedLock = &sync.Mutex{}
 
@@ -200,6 +264,7 @@ func (ds *Datastore) Init(config Config) error {
 	// cache all our instances prior to getting tenants
 	ds.instancesLock = &sync.RWMutex{}
 	ds.instances = make(map[string]*types.Instance)
+	ds.resizes = make(map[string]types.InstanceResize)
 
 	instances, err := ds.db.getInstances()
 	if err != nil {
@@ -216,6 +281,9 @@ func (ds *Datastore) Init(config Config) error {
 	if err == nil {
 		for i := range tenants {
 			ds.tenants[tenants[i].ID] = tenants[i]
+			for _, subnet := range tenants[i].subnets {
+				ds.allSubnets[subnet] = true
+			}
 		}
 	}
 
@@ -283,9 +351,142 @@ func (ds *Datastore) Init(config Config) error {
 
 	ds.attachLock = &sync.RWMutex{}
 
+	ds.publicIPs, err = ds.db.getAllPublicIPs()
+	if err != nil {
+		glog.Warning(err)
+		ds.publicIPs = make(map[string]types.PublicIP)
+	}
+
+	for _, ip := range ds.publicIPs {
+		i, ok := ds.instances[ip.InstanceID]
+		if ok && ip.Assigned {
+			i.PublicIP = ip.Address
+		}
+	}
+
+	ds.publicIPsLock = &sync.RWMutex{}
+
 	return err
 }
 
+// refreshCaches reloads the tenants, instances and public IPs caches
+// from the database when another controller sharing the database, or
+// this one, changed them since they were last loaded.  The node, state
+// and SSH details of the cached instances are kept, as they are
+// updated from the node statistics.
+func (ds *Datastore) refreshCaches() {
+	changes, err := ds.db.getCacheChanges()
+	if err != nil {
+		glog.Warningf("Unable to check the datastore for changes: %v", err)
+		return
+	}
+
+	if changes == nil {
+		return
+	}
+
+	ds.cacheChangesLock.Lock()
+	defer ds.cacheChangesLock.Unlock()
+
+	changed := len(changes) != len(ds.cacheChanges)
+	for name, count := range changes {
+		if ds.cacheChanges[name] != count {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	instances, err := ds.db.getInstances()
+	if err != nil {
+		glog.Warningf("Unable to reload instances: %v", err)
+		return
+	}
+
+	tenants, err := ds.db.getTenantsNoCache()
+	if err != nil {
+		glog.Warningf("Unable to reload tenants: %v", err)
+		return
+	}
+
+	publicIPs, err := ds.db.getAllPublicIPs()
+	if err != nil {
+		glog.Warningf("Unable to reload public IPs: %v", err)
+		return
+	}
+
+	addresses := make(map[string]string)
+	for _, ip := range publicIPs {
+		if ip.Assigned {
+			addresses[ip.InstanceID] = ip.Address
+		}
+	}
+
+	ds.instancesLock.Lock()
+	cached := make(map[string]*types.Instance)
+	for _, i := range instances {
+		c, ok := ds.instances[i.ID]
+		if ok {
+			c.TenantID = i.TenantID
+			c.WorkloadID = i.WorkloadID
+			c.MACAddress = i.MACAddress
+			c.IPAddress = i.IPAddress
+			c.Usage = i.Usage
+			i = c
+		}
+		i.PublicIP = addresses[i.ID]
+		cached[i.ID] = i
+	}
+	ds.instances = cached
+	ds.instancesLock.Unlock()
+
+	ds.nodesLock.Lock()
+	for _, n := range ds.nodes {
+		n.instances = make(map[string]*types.Instance)
+	}
+	for key, i := range cached {
+		if i.NodeID == "" {
+			continue
+		}
+
+		n, ok := ds.nodes[i.NodeID]
+		if !ok {
+			n = &node{
+				Node:      types.Node{ID: i.NodeID},
+				instances: make(map[string]*types.Instance),
+			}
+			ds.nodes[i.NodeID] = n
+		}
+		n.instances[key] = i
+	}
+	ds.nodesLock.Unlock()
+
+	ds.tenantsLock.Lock()
+	ds.tenants = make(map[string]*tenant)
+	ds.allSubnets = make(map[int]bool)
+	for _, t := range tenants {
+		t.instances = make(map[string]*types.Instance)
+		ds.tenants[t.ID] = t
+		for _, subnet := range t.subnets {
+			ds.allSubnets[subnet] = true
+		}
+	}
+	for key, i := range cached {
+		if t, ok := ds.tenants[i.TenantID]; ok {
+			t.instances[key] = i
+		}
+	}
+	ds.tenantsLock.Unlock()
+
+	ds.publicIPsLock.Lock()
+	ds.publicIPs = publicIPs
+	ds.publicIPsLock.Unlock()
+
+	ds.cacheChanges = changes
+}
+
 // Exit will disconnect the backing database.
 func (ds *Datastore) Exit() {
 	ds.db.disconnect()
@@ -303,6 +504,8 @@ func (ds *Datastore) AddTenantChan(c chan bool, tenantID string) {
 
 // AddLimit allows the caller to store a limt for a specific resource for a tenant.
 func (ds *Datastore) AddLimit(tenantID string, resourceID int, limit int) error {
+	ds.refreshCaches()
+
 	err := ds.db.addLimit(tenantID, resourceID, limit)
 	if err != nil {
 		return err
@@ -328,6 +531,36 @@ func (ds *Datastore) AddLimit(tenantID string, resourceID int, limit int) error
 	return err
 }
 
+// DeleteLimit removes the limit for a specific resource for a tenant,
+// leaving the tenant with unlimited use of that resource.
+func (ds *Datastore) DeleteLimit(tenantID string, resourceID int) error {
+	ds.refreshCaches()
+
+	err := ds.db.deleteLimit(tenantID, resourceID)
+	if err != nil {
+		return err
+	}
+
+	// update cache
+	ds.tenantsLock.Lock()
+
+	tenant := ds.tenants[tenantID]
+	if tenant != nil {
+		resources := tenant.Resources
+
+		for i := range resources {
+			if resources[i].Rtype == resourceID {
+				resources[i].Limit = -1
+				break
+			}
+		}
+	}
+
+	ds.tenantsLock.Unlock()
+
+	return nil
+}
+
 func newHardwareAddr() (net.HardwareAddr, error) {
 	buf := make([]byte, 6)
 	_, err := rand.Read(buf)
@@ -354,6 +587,8 @@ func newHardwareAddr() (net.HardwareAddr, error) {
 // it creates a MAC address for the tenant network and makes sure
 // that this new tenant is cached.
 func (ds *Datastore) AddTenant(id string) (*types.Tenant, error) {
+	ds.refreshCaches()
+
 	hw, err := newHardwareAddr()
 	if err != nil {
 		glog.V(2).Info("error creating mac address", err)
@@ -393,6 +628,8 @@ func (ds *Datastore) getTenant(id string) (*tenant, error) {
 
 // GetTenant returns details about a tenant referenced by the uuid
 func (ds *Datastore) GetTenant(id string) (*types.Tenant, error) {
+	ds.refreshCaches()
+
 	t, err := ds.getTenant(id)
 	if err != nil || t == nil {
 		return nil, err
@@ -463,9 +700,98 @@ func (ds *Datastore) GetWorkloads() ([]*types.Workload, error) {
 	return workloads, nil
 }
 
+// AddWorkload adds a new workload to the datastore.  The workload
+// configuration and default resources are stored along with its
+// template so that it survives a controller restart.
+func (ds *Datastore) AddWorkload(w types.Workload) error {
+	ds.workloadsLock.Lock()
+	defer ds.workloadsLock.Unlock()
+
+	if ds.workloads[w.ID] != nil || w.ID == ds.cnciWorkloadID {
+		return ErrDuplicateWorkload
+	}
+
+	wl := &workload{Workload: w}
+
+	err := ds.db.addWorkload(wl)
+	if err != nil {
+		return err
+	}
+
+	ds.workloads[w.ID] = wl
+
+	return nil
+}
+
+// UpdateWorkload replaces the definition of an existing workload.
+// Instances already running keep the definition they were started with,
+// apart from their resource limits which are updated by the controller.
+func (ds *Datastore) UpdateWorkload(w types.Workload) error {
+	ds.workloadsLock.Lock()
+	defer ds.workloadsLock.Unlock()
+
+	if w.ID == ds.cnciWorkloadID {
+		return ErrInternalWorkload
+	}
+
+	old := ds.workloads[w.ID]
+	if old == nil {
+		return ErrNoWorkload
+	}
+
+	wl := &workload{
+		Workload: w,
+		filename: old.filename,
+	}
+
+	err := ds.db.updateWorkload(wl)
+	if err != nil {
+		return err
+	}
+
+	ds.workloads[w.ID] = wl
+
+	return nil
+}
+
+// DeleteWorkload removes a workload from the datastore.  A workload
+// cannot be deleted while instances of it exist.
+func (ds *Datastore) DeleteWorkload(ID string) error {
+	ds.workloadsLock.Lock()
+	defer ds.workloadsLock.Unlock()
+
+	if ID == ds.cnciWorkloadID {
+		return ErrInternalWorkload
+	}
+
+	if ds.workloads[ID] == nil {
+		return ErrNoWorkload
+	}
+
+	ds.instancesLock.RLock()
+	for _, i := range ds.instances {
+		if i.WorkloadID == ID {
+			ds.instancesLock.RUnlock()
+			return ErrWorkloadInUse
+		}
+	}
+	ds.instancesLock.RUnlock()
+
+	err := ds.db.deleteWorkload(ID)
+	if err != nil {
+		return err
+	}
+
+	delete(ds.workloads, ID)
+
+	return nil
+}
+
 // AddCNCIIP will associate a new IP address with an existing CNCI
 // via the mac address
 func (ds *Datastore) AddCNCIIP(cnciMAC string, ip string) error {
+	ds.refreshCaches()
+
 	var ok bool
 	var tenantID string
 	var tenant *tenant
@@ -511,6 +837,8 @@ func (ds *Datastore) AddCNCIIP(cnciMAC string, ip string) error {
 // The instanceID of the new CNCI instance and the MAC address of the new instance
 // are stored in the sql database and updated in the cache.
 func (ds *Datastore) AddTenantCNCI(tenantID string, instanceID string, mac string) error {
+	ds.refreshCaches()
+
 	// update tenants cache
 	ds.tenantsLock.Lock()
 
@@ -569,6 +897,8 @@ func (ds *Datastore) getTenants() ([]*tenant, error) {
 
 // GetAllTenants returns all the tenants from the datastore.
 func (ds *Datastore) GetAllTenants() ([]*types.Tenant, error) {
+	ds.refreshCaches()
+
 	var tenants []*types.Tenant
 
 	// yes, this makes it so we have to loop through
@@ -606,11 +936,13 @@ func (ds *Datastore) ReleaseTenantIP(tenantID string, ip string) error {
 
 	subnetInt := binary.BigEndian.Uint16(ipBytes[1:3])
 
+	ds.refreshCaches()
+
 	// clear from cache
 	ds.tenantsLock.Lock()
 
 	if ds.tenants[tenantID] != nil {
-		ds.tenants[tenantID].network[int(subnetInt)][int(ipBytes[3])] = false
+		delete(ds.tenants[tenantID].network[int(subnetInt)], int(ipBytes[3]))
 	}
 
 	ds.tenantsLock.Unlock()
@@ -625,6 +957,8 @@ func (ds *Datastore) AllocateTenantIP(tenantID string) (net.IP, error) {
 	var subnetInt uint16
 	subnetInt = 0
 
+	ds.refreshCaches()
+
 	ds.tenantsLock.Lock()
 
 	network := ds.tenants[tenantID].network
@@ -706,7 +1040,16 @@ func (ds *Datastore) AllocateTenantIP(tenantID string) (net.IP, error) {
 
 	ds.tenantsLock.Unlock()
 
-	go ds.db.claimTenantIP(tenantID, int(subnetInt), rest)
+	// another controller sharing the database may have claimed the
+	// address since the cache was refreshed.
+	err := ds.db.claimTenantIP(tenantID, int(subnetInt), rest)
+	if err != nil {
+		ds.tenantsLock.Lock()
+		delete(hosts, rest)
+		ds.tenantsLock.Unlock()
+
+		return nil, err
+	}
 
 	// convert to IP type.
 	next := net.IPv4(172, subnetBytes[0], subnetBytes[1], byte(rest))
@@ -716,6 +1059,8 @@ func (ds *Datastore) AllocateTenantIP(tenantID string) (net.IP, error) {
 
 // GetAllInstances retrieves all instances out of the datastore.
 func (ds *Datastore) GetAllInstances() ([]*types.Instance, error) {
+	ds.refreshCaches()
+
 	var instances []*types.Instance
 
 	// always get from cache
@@ -734,6 +1079,8 @@ func (ds *Datastore) GetAllInstances() ([]*types.Instance, error) {
 
 // GetInstance retrieves an instance out of the datastore.
 func (ds *Datastore) GetInstance(id string) (*types.Instance, error) {
+	ds.refreshCaches()
+
 	// always get from cache
 	ds.instancesLock.RLock()
 
@@ -750,6 +1097,8 @@ func (ds *Datastore) GetInstance(id string) (*types.Instance, error) {
 
 // GetAllInstancesFromTenant will retrieve all instances belonging to a specific tenant
 func (ds *Datastore) GetAllInstancesFromTenant(tenantID string) ([]*types.Instance, error) {
+	ds.refreshCaches()
+
 	var instances []*types.Instance
 
 	ds.tenantsLock.RLock()
@@ -772,6 +1121,8 @@ func (ds *Datastore) GetAllInstancesFromTenant(tenantID string) ([]*types.Instan
 
 // GetAllInstancesByNode will retrieve all the instances running on a specific compute Node.
 func (ds *Datastore) GetAllInstancesByNode(nodeID string) ([]*types.Instance, error) {
+	ds.refreshCaches()
+
 	var instances []*types.Instance
 
 	ds.nodesLock.RLock()
@@ -791,6 +1142,8 @@ func (ds *Datastore) GetAllInstancesByNode(nodeID string) ([]*types.Instance, er
 // AddInstance will store a new instance in the datastore.
 // The instance will be updated both in the cache and in the database
 func (ds *Datastore) AddInstance(instance *types.Instance) error {
+	ds.refreshCaches()
+
 	// add to cache
 	ds.instancesLock.Lock()
 
@@ -836,12 +1189,196 @@ func (ds *Datastore) AddInstance(instance *types.Instance) error {
 
 	ds.tenantsLock.Unlock()
 
-	// update database asynchronously
-	go ds.db.addInstance(instance)
+	// the instance is stored before returning so that it is not
+	// dropped from the cache by the next refresh.
+	return ds.db.addInstance(instance)
+}
+
+// updateInstanceUsage replaces the resource usage of instance with usage,
+// both in the cache and in the database, and adjusts the resource usage of
+// the instance's tenant accordingly.
+func (ds *Datastore) updateInstanceUsage(instance *types.Instance, workloadID string, usage map[string]int) {
+	old := instance.Usage
+
+	ds.instancesLock.Lock()
+	instance.WorkloadID = workloadID
+	instance.Usage = usage
+	ds.instancesLock.Unlock()
+
+	ds.tenantsLock.Lock()
+	tenant := ds.tenants[instance.TenantID]
+	if tenant != nil {
+		for i := range tenant.Resources {
+			name := tenant.Resources[i].Rname
+			tenant.Resources[i].Usage += usage[name] - old[name]
+		}
+	}
+	ds.tenantsLock.Unlock()
+
+	err := ds.db.updateInstance(instance)
+	if err != nil {
+		glog.Warningf("Unable to store usage of instance %s: %v", instance.ID, err)
+	}
+}
+
+// ResizeInstance changes the workload and resource usage of an instance,
+// recording the previous values so that the resize can be reverted.
+// migrating indicates whether the instance is to be moved to another node.
+func (ds *Datastore) ResizeInstance(instanceID string, workloadID string, usage map[string]int, migrating bool) error {
+	ds.refreshCaches()
+
+	ds.instancesLock.Lock()
+	i, ok := ds.instances[instanceID]
+	if !ok {
+		ds.instancesLock.Unlock()
+		return types.ErrInstanceNotFound
+	}
+
+	if _, ok := ds.resizes[instanceID]; ok {
+		ds.instancesLock.Unlock()
+		return ErrResizeInProgress
+	}
+
+	ds.resizes[instanceID] = types.InstanceResize{
+		InstanceID:    instanceID,
+		OldWorkloadID: i.WorkloadID,
+		OldUsage:      i.Usage,
+		Migrating:     migrating,
+	}
+	ds.instancesLock.Unlock()
+
+	ds.updateInstanceUsage(i, workloadID, usage)
+
+	msg := fmt.Sprintf("Resizing Instance %s to workload %s", instanceID, workloadID)
+	ds.db.logEvent(i.TenantID, string(userInfo), msg)
+
+	return nil
+}
+
+// GetInstanceResize retrieves the resize record of an instance that has
+// been resized but whose resize has not yet been confirmed or reverted.
+func (ds *Datastore) GetInstanceResize(instanceID string) (types.InstanceResize, error) {
+	ds.instancesLock.RLock()
+	r, ok := ds.resizes[instanceID]
+	ds.instancesLock.RUnlock()
+
+	if !ok {
+		return types.InstanceResize{}, ErrNoResize
+	}
+
+	return r, nil
+}
+
+// ConfirmResize discards the resize record of an instance, after which the
+// resize can no longer be reverted.
+func (ds *Datastore) ConfirmResize(instanceID string) error {
+	ds.instancesLock.Lock()
+	defer ds.instancesLock.Unlock()
+
+	r, ok := ds.resizes[instanceID]
+	if !ok || r.Migrating {
+		return ErrNoResize
+	}
+
+	delete(ds.resizes, instanceID)
+
+	return nil
+}
+
+// RevertResize restores the workload and resource usage an instance had
+// before it was resized and discards its resize record.  The record is
+// returned.
+func (ds *Datastore) RevertResize(instanceID string) (types.InstanceResize, error) {
+	ds.instancesLock.Lock()
+	r, ok := ds.resizes[instanceID]
+	if !ok || r.Migrating {
+		ds.instancesLock.Unlock()
+		return types.InstanceResize{}, ErrNoResize
+	}
+
+	i := ds.instances[instanceID]
+	delete(ds.resizes, instanceID)
+	ds.instancesLock.Unlock()
+
+	ds.updateInstanceUsage(i, r.OldWorkloadID, r.OldUsage)
+
+	msg := fmt.Sprintf("Reverted resize of Instance %s", instanceID)
+	ds.db.logEvent(i.TenantID, string(userInfo), msg)
+
+	return r, nil
+}
+
+// RelocateInstance removes an instance that is being moved to another node
+// as part of a resize from the node it was running on.  The instance
+// becomes pending until it is reported by its new node.
+func (ds *Datastore) RelocateInstance(instanceID string) error {
+	ds.instancesLock.Lock()
+	i, ok := ds.instances[instanceID]
+	r, resizing := ds.resizes[instanceID]
+	if !ok || !resizing || !r.Migrating {
+		ds.instancesLock.Unlock()
+		return ErrNoResize
+	}
+
+	r.Migrating = false
+	ds.resizes[instanceID] = r
+	ds.instancesLock.Unlock()
+
+	_ = ds.unassignInstance(i)
 
 	return nil
 }
 
+// EvacuateInstance removes an instance that has been evacuated from the
+// node it was running on, so that it can be relaunched on another node.
+// The instance becomes pending until it is reported by its new node.
+func (ds *Datastore) EvacuateInstance(instanceID string) error {
+	ds.refreshCaches()
+
+	ds.instancesLock.RLock()
+	i, ok := ds.instances[instanceID]
+	ds.instancesLock.RUnlock()
+	if !ok {
+		return types.ErrInstanceNotFound
+	}
+
+	nodeID := ds.unassignInstance(i)
+
+	msg := fmt.Sprintf("Evacuated Instance %s from node %s", instanceID, nodeID)
+	ds.db.logEvent(i.TenantID, string(userInfo), msg)
+
+	return nil
+}
+
+// unassignInstance removes an instance from the node it was running on,
+// which ID is returned.
+func (ds *Datastore) unassignInstance(i *types.Instance) string {
+	ds.instancesLock.Lock()
+	nodeID := i.NodeID
+	i.NodeID = ""
+	i.State = payloads.Pending
+	i.SSHIP = ""
+	i.SSHPort = 0
+	ds.instancesLock.Unlock()
+
+	if nodeID != "" {
+		ds.nodesLock.Lock()
+		if n, ok := ds.nodes[nodeID]; ok {
+			delete(n.instances, i.ID)
+		}
+		ds.nodesLock.Unlock()
+	}
+
+	ds.instanceLastStatLock.Lock()
+	stat := ds.instanceLastStat[i.ID]
+	stat.NodeID = ""
+	stat.Status = payloads.Pending
+	ds.instanceLastStat[i.ID] = stat
+	ds.instanceLastStatLock.Unlock()
+
+	return nodeID
+}
+
 // RestartFailure logs a RestartFailure in the datastore
 func (ds *Datastore) RestartFailure(instanceID string, reason payloads.RestartFailureReason) error {
 	i, err := ds.GetInstance(instanceID)
@@ -930,7 +1467,11 @@ func (ds *Datastore) StartFailure(instanceID string, reason payloads.StartFailur
 		payloads.InvalidPayload,
 		payloads.InvalidData,
 		payloads.ImageFailure,
-		payloads.NetworkFailure:
+		payloads.NetworkFailure,
+		payloads.NotEnoughVCPUs,
+		payloads.NotEnoughMemory,
+		payloads.NotEnoughDisk,
+		payloads.NodeInMaintenance:
 
 		ds.deleteInstance(instanceID)
 
@@ -999,10 +1540,17 @@ func (ds *Datastore) deleteInstance(instanceID string) error {
 	ds.instanceLastStatLock.Unlock()
 
 	ds.instancesLock.Lock()
-	i := ds.instances[instanceID]
+	i, ok := ds.instances[instanceID]
 	delete(ds.instances, instanceID)
+	delete(ds.resizes, instanceID)
 	ds.instancesLock.Unlock()
 
+	// the instance may have been deleted by another controller
+	// sharing the database.
+	if !ok {
+		return types.ErrInstanceNotFound
+	}
+
 	ds.tenantsLock.Lock()
 	tenant := ds.tenants[i.TenantID]
 	delete(tenant.instances, instanceID)
@@ -1044,11 +1592,15 @@ func (ds *Datastore) deleteInstance(instanceID string) error {
 
 	ds.updateStorageAttachments(instanceID, nil)
 
+	ds.unmapInstancePublicIPs(instanceID)
+
 	return err
 }
 
 // DeleteInstance removes an instance from the datastore.
 func (ds *Datastore) DeleteInstance(instanceID string) error {
+	ds.refreshCaches()
+
 	err := ds.deleteInstance(instanceID)
 	if err != nil {
 		return err
@@ -1075,6 +1627,8 @@ func (ds *Datastore) DeleteNode(nodeID string) error {
 
 // HandleStats makes sure that the data from the stat payload is stored.
 func (ds *Datastore) HandleStats(stat payloads.Stat) error {
+	ds.refreshCaches()
+
 	if stat.Load != -1 {
 		ds.addNodeStat(stat)
 	}
@@ -1082,6 +1636,51 @@ func (ds *Datastore) HandleStats(stat payloads.Stat) error {
 	return ds.addInstanceStats(stat.Instances, stat.NodeUUID)
 }
 
+// ReconcileStats brings the datastore in line with the latest stats
+// reported by each node, as handed over to a controller that just got
+// promoted to master.  Instances the datastore still places on one of
+// those nodes but which are no longer reported by it are deleted.
+func (ds *Datastore) ReconcileStats(stats []payloads.Stat) error {
+	ds.refreshCaches()
+
+	reported := make(map[string]map[string]bool)
+
+	for _, stat := range stats {
+		err := ds.HandleStats(stat)
+		if err != nil {
+			return err
+		}
+
+		instances := make(map[string]bool)
+		for _, instance := range stat.Instances {
+			instances[instance.InstanceUUID] = true
+		}
+		reported[stat.NodeUUID] = instances
+	}
+
+	var stale []string
+
+	ds.instancesLock.RLock()
+	for _, instance := range ds.instances {
+		instances, ok := reported[instance.NodeID]
+		if ok && !instances[instance.ID] {
+			stale = append(stale, instance.ID)
+		}
+	}
+	ds.instancesLock.RUnlock()
+
+	for _, instanceID := range stale {
+		glog.Infof("Deleting instance %s no longer reported by its node", instanceID)
+
+		err := ds.DeleteInstance(instanceID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // HandleTraceReport stores the provided trace data in the datastore.
 func (ds *Datastore) HandleTraceReport(trace payloads.Trace) error {
 	for index := range trace.Frames {
@@ -1310,6 +1909,8 @@ func (ds *Datastore) addInstanceStats(stats []payloads.InstanceStat, nodeID stri
 // tenants.  If cnci is not null, it will only provide information about a specific
 // cnci.
 func (ds *Datastore) GetTenantCNCISummary(cnci string) ([]types.TenantCNCI, error) {
+	ds.refreshCaches()
+
 	var cncis []types.TenantCNCI
 	subnetBytes := []byte{0, 0}
 
@@ -1398,8 +1999,17 @@ func (ds *Datastore) AddBlockDevice(device types.BlockData) error {
 
 	// update tenants cache
 	ds.tenantsLock.Lock()
-	devices := ds.tenants[device.TenantID].devices
-	devices[device.ID] = device
+	tenant := ds.tenants[device.TenantID]
+	tenant.devices[device.ID] = device
+
+	if !update {
+		for i := range tenant.Resources {
+			if tenant.Resources[i].Rname == "volumes" {
+				tenant.Resources[i].Usage++
+				break
+			}
+		}
+	}
 	ds.tenantsLock.Unlock()
 
 	// store persistently
@@ -1423,8 +2033,17 @@ func (ds *Datastore) DeleteBlockDevice(ID string) error {
 
 	dev, ok := ds.blockDevices[ID]
 	if ok {
+		tenant := ds.tenants[dev.TenantID]
+
 		delete(ds.blockDevices, ID)
-		delete(ds.tenants[dev.TenantID].devices, ID)
+		delete(tenant.devices, ID)
+
+		for i := range tenant.Resources {
+			if tenant.Resources[i].Rname == "volumes" {
+				tenant.Resources[i].Usage--
+				break
+			}
+		}
 	}
 
 	ds.tenantsLock.Unlock()
@@ -1488,7 +2107,7 @@ func (ds *Datastore) UpdateBlockDevice(data types.BlockData) error {
 	return ds.AddBlockDevice(data)
 }
 
-func (ds *Datastore) createStorageAttachment(instanceID string, blockID string) (types.StorageAttachment, error) {
+func (ds *Datastore) createStorageAttachment(instanceID string, blockID string, boot bool) (types.StorageAttachment, error) {
 	link := attachment{
 		instanceID: instanceID,
 		volumeID:   blockID,
@@ -1498,6 +2117,7 @@ func (ds *Datastore) createStorageAttachment(instanceID string, blockID string)
 		InstanceID: instanceID,
 		ID:         uuid.Generate().String(),
 		BlockID:    blockID,
+		Boot:       boot,
 	}
 
 	// add it to our links map
@@ -1511,6 +2131,24 @@ func (ds *Datastore) createStorageAttachment(instanceID string, blockID string)
 	return a, err
 }
 
+// AttachBootVolume records that an instance boots from a block device, so
+// that the instance can be relaunched from that device on another node.
+// The block device is in use from then on.
+func (ds *Datastore) AttachBootVolume(instanceID string, blockID string) error {
+	_, err := ds.createStorageAttachment(instanceID, blockID, true)
+	if err != nil {
+		return err
+	}
+
+	bd, err := ds.GetBlockDevice(blockID)
+	if err != nil {
+		return err
+	}
+
+	bd.State = types.InUse
+	return ds.UpdateBlockDevice(bd)
+}
+
 // GetStorageAttachments returns a list of volumes associated with this instance.
 func (ds *Datastore) GetStorageAttachments(instanceID string) ([]types.StorageAttachment, error) {
 	var links []types.StorageAttachment
@@ -1677,3 +2315,329 @@ func (ds *Datastore) GetVolumeAttachments(volume string) ([]types.StorageAttachm
 
 	return attachments, nil
 }
+
+// AddPublicIPs adds addresses to the public IP pool named pool.  None of
+// the addresses are added if one of them is already in the public IP pool.
+func (ds *Datastore) AddPublicIPs(pool string, addresses []string) ([]types.PublicIP, error) {
+	ds.refreshCaches()
+
+	var ips []types.PublicIP
+
+	ds.publicIPsLock.Lock()
+	defer ds.publicIPsLock.Unlock()
+
+	for _, ip := range ds.publicIPs {
+		for _, address := range addresses {
+			if ip.Address == address {
+				return nil, ErrDuplicatePublicIP
+			}
+		}
+	}
+
+	for _, address := range addresses {
+		ip := types.PublicIP{
+			ID:      uuid.Generate().String(),
+			Address: address,
+			Pool:    pool,
+		}
+
+		err := ds.db.createPublicIP(ip)
+		if err != nil {
+			return ips, err
+		}
+
+		ds.publicIPs[ip.ID] = ip
+		ips = append(ips, ip)
+	}
+
+	return ips, nil
+}
+
+// DeletePublicIPs removes addresses from the public IP pool.  None of the
+// addresses are removed if one of them is unknown or allocated to a tenant.
+func (ds *Datastore) DeletePublicIPs(addresses []string) error {
+	ds.refreshCaches()
+
+	var ids []string
+
+	ds.publicIPsLock.Lock()
+	defer ds.publicIPsLock.Unlock()
+
+	for _, address := range addresses {
+		ip, err := ds.getPublicIPByAddress(address)
+		if err != nil {
+			return err
+		}
+
+		if ip.TenantID != "" {
+			return ErrPublicIPInUse
+		}
+
+		ids = append(ids, ip.ID)
+	}
+
+	for _, id := range ids {
+		err := ds.db.deletePublicIP(id)
+		if err != nil {
+			return err
+		}
+
+		delete(ds.publicIPs, id)
+	}
+
+	return nil
+}
+
+// GetPublicIPs returns all the addresses of the public IP pool.
+func (ds *Datastore) GetPublicIPs() ([]types.PublicIP, error) {
+	ds.refreshCaches()
+
+	var ips []types.PublicIP
+
+	ds.publicIPsLock.RLock()
+
+	for _, ip := range ds.publicIPs {
+		ips = append(ips, ip)
+	}
+
+	ds.publicIPsLock.RUnlock()
+
+	return ips, nil
+}
+
+// GetTenantPublicIPs returns the public IPs allocated to a tenant.
+func (ds *Datastore) GetTenantPublicIPs(tenantID string) ([]types.PublicIP, error) {
+	ds.refreshCaches()
+
+	var ips []types.PublicIP
+
+	ds.publicIPsLock.RLock()
+
+	for _, ip := range ds.publicIPs {
+		if ip.TenantID == tenantID {
+			ips = append(ips, ip)
+		}
+	}
+
+	ds.publicIPsLock.RUnlock()
+
+	return ips, nil
+}
+
+// GetPublicIP returns information about a public IP from the datastore.
+func (ds *Datastore) GetPublicIP(ID string) (types.PublicIP, error) {
+	ds.refreshCaches()
+
+	ds.publicIPsLock.RLock()
+	ip, ok := ds.publicIPs[ID]
+	ds.publicIPsLock.RUnlock()
+
+	if !ok {
+		return types.PublicIP{}, ErrNoPublicIP
+	}
+	return ip, nil
+}
+
+func (ds *Datastore) getPublicIPByAddress(address string) (types.PublicIP, error) {
+	for _, ip := range ds.publicIPs {
+		if ip.Address == address {
+			return ip, nil
+		}
+	}
+
+	return types.PublicIP{}, ErrNoPublicIP
+}
+
+// GetPublicIPByAddress returns information about the public IP holding
+// address from the datastore.
+func (ds *Datastore) GetPublicIPByAddress(address string) (types.PublicIP, error) {
+	ds.refreshCaches()
+
+	ds.publicIPsLock.RLock()
+	defer ds.publicIPsLock.RUnlock()
+
+	return ds.getPublicIPByAddress(address)
+}
+
+// AllocatePublicIP allocates a free address of the public IP pool named
+// pool to a tenant.  If pool is empty, the address is allocated from any
+// pool.
+func (ds *Datastore) AllocatePublicIP(tenantID string, pool string) (types.PublicIP, error) {
+	ds.refreshCaches()
+
+	ds.publicIPsLock.Lock()
+	defer ds.publicIPsLock.Unlock()
+
+	for _, ip := range ds.publicIPs {
+		if ip.TenantID != "" || (pool != "" && ip.Pool != pool) {
+			continue
+		}
+
+		ip.TenantID = tenantID
+
+		err := ds.db.updatePublicIP(ip)
+		if err != nil {
+			return types.PublicIP{}, err
+		}
+
+		ds.publicIPs[ip.ID] = ip
+		return ip, nil
+	}
+
+	return types.PublicIP{}, ErrNoFreePublicIP
+}
+
+// ReleasePublicIP returns a public IP allocated to a tenant to the public
+// IP pool.  Public IPs mapped to an instance cannot be released.
+func (ds *Datastore) ReleasePublicIP(ID string) error {
+	ds.refreshCaches()
+
+	ds.publicIPsLock.Lock()
+	defer ds.publicIPsLock.Unlock()
+
+	ip, ok := ds.publicIPs[ID]
+	if !ok {
+		return ErrNoPublicIP
+	}
+
+	if ip.InstanceID != "" {
+		return ErrPublicIPInUse
+	}
+
+	ip.TenantID = ""
+
+	err := ds.db.updatePublicIP(ip)
+	if err != nil {
+		return err
+	}
+
+	ds.publicIPs[ID] = ip
+	return nil
+}
+
+// MapPublicIP records that a public IP is being mapped to an instance.
+// The mapping is only complete once the CNCI reports the public IP as
+// assigned.
+func (ds *Datastore) MapPublicIP(ID string, instanceID string) (types.PublicIP, error) {
+	ds.refreshCaches()
+
+	ds.publicIPsLock.Lock()
+	defer ds.publicIPsLock.Unlock()
+
+	ip, ok := ds.publicIPs[ID]
+	if !ok {
+		return types.PublicIP{}, ErrNoPublicIP
+	}
+
+	for _, i := range ds.publicIPs {
+		if i.InstanceID != "" && (i.ID == ID || i.InstanceID == instanceID) {
+			return types.PublicIP{}, ErrPublicIPInUse
+		}
+	}
+
+	ip.InstanceID = instanceID
+	ip.Assigned = false
+
+	err := ds.db.updatePublicIP(ip)
+	if err != nil {
+		return types.PublicIP{}, err
+	}
+
+	ds.publicIPs[ID] = ip
+	return ip, nil
+}
+
+func (ds *Datastore) setInstancePublicIP(instanceID string, address string) {
+	ds.instancesLock.Lock()
+	i, ok := ds.instances[instanceID]
+	if ok {
+		i.PublicIP = address
+	}
+	ds.instancesLock.Unlock()
+}
+
+// unmapPublicIP must be called with the public IPs lock held.
+func (ds *Datastore) unmapPublicIP(ip types.PublicIP) (types.PublicIP, error) {
+	unmapped := ip
+	unmapped.InstanceID = ""
+	unmapped.Assigned = false
+
+	err := ds.db.updatePublicIP(unmapped)
+	if err != nil {
+		return types.PublicIP{}, err
+	}
+
+	ds.publicIPs[ip.ID] = unmapped
+	ds.setInstancePublicIP(ip.InstanceID, "")
+
+	return ip, nil
+}
+
+// UnmapPublicIP removes the mapping of a public IP to an instance.  It
+// returns the public IP as it was before being unmapped.
+func (ds *Datastore) UnmapPublicIP(ID string) (types.PublicIP, error) {
+	ds.refreshCaches()
+
+	ds.publicIPsLock.Lock()
+	defer ds.publicIPsLock.Unlock()
+
+	ip, ok := ds.publicIPs[ID]
+	if !ok {
+		return types.PublicIP{}, ErrNoPublicIP
+	}
+
+	if ip.InstanceID == "" {
+		return types.PublicIP{}, ErrPublicIPNotMapped
+	}
+
+	return ds.unmapPublicIP(ip)
+}
+
+func (ds *Datastore) unmapInstancePublicIPs(instanceID string) {
+	ds.publicIPsLock.Lock()
+	defer ds.publicIPsLock.Unlock()
+
+	for _, ip := range ds.publicIPs {
+		if ip.InstanceID != instanceID {
+			continue
+		}
+
+		_, err := ds.unmapPublicIP(ip)
+		if err != nil {
+			glog.V(2).Info("deleteInstance: ", err)
+		}
+	}
+}
+
+// PublicIPAssigned records that the CNCI has mapped a public IP to an
+// instance, and updates the instance with its public IP.
+func (ds *Datastore) PublicIPAssigned(instanceID string, address string) error {
+	ds.refreshCaches()
+
+	ds.publicIPsLock.Lock()
+	defer ds.publicIPsLock.Unlock()
+
+	ip, err := ds.getPublicIPByAddress(address)
+	if err != nil {
+		return err
+	}
+
+	if ip.InstanceID != instanceID {
+		return ErrPublicIPNotMapped
+	}
+
+	ip.Assigned = true
+
+	err = ds.db.updatePublicIP(ip)
+	if err != nil {
+		return err
+	}
+
+	ds.publicIPs[ip.ID] = ip
+	ds.setInstancePublicIP(instanceID, address)
+
+	msg := fmt.Sprintf("Public IP %s assigned to instance %s", address, instanceID)
+	ds.db.logEvent(ip.TenantID, string(userInfo), msg)
+
+	return nil
+}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 
@@ -516,6 +517,208 @@ func TestGetInstance(t *testing.T) {
 	}
 }
 
+func tenantUsage(t *testing.T, tenantID string) map[string]int {
+	tenant, err := ds.getTenant(tenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usage := make(map[string]int)
+	for _, r := range tenant.Resources {
+		usage[r.Rname] = r.Usage
+	}
+
+	return usage
+}
+
+func TestResizeInstance(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := tenantUsage(t, tenant.ID)
+	oldUsage := instance.Usage
+
+	usage := make(map[string]int)
+	for name, val := range oldUsage {
+		usage[name] = val
+	}
+	usage[string(payloads.MemMB)] += 256
+
+	resizedID := wls[len(wls)-1].ID
+	err = ds.ResizeInstance(instance.ID, resizedID, usage, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.ResizeInstance(instance.ID, resizedID, usage, false)
+	if err != ErrResizeInProgress {
+		t.Fatalf("Expected %v, got %v", ErrResizeInProgress, err)
+	}
+
+	r, err := ds.GetInstanceResize(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.OldWorkloadID != wls[0].ID || !reflect.DeepEqual(r.OldUsage, oldUsage) || r.Migrating {
+		t.Fatalf("Unexpected resize record %+v", r)
+	}
+
+	i, err := ds.GetInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i.WorkloadID != resizedID || !reflect.DeepEqual(i.Usage, usage) {
+		t.Fatalf("Instance not resized %+v", i)
+	}
+
+	after := tenantUsage(t, tenant.ID)
+	mem := string(payloads.MemMB)
+	if after[mem] != before[mem]+256 {
+		t.Fatalf("Tenant memory usage %d, expected %d", after[mem], before[mem]+256)
+	}
+
+	_, err = ds.RevertResize(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i.WorkloadID != wls[0].ID || !reflect.DeepEqual(i.Usage, oldUsage) {
+		t.Fatalf("Resize not reverted %+v", i)
+	}
+
+	if !reflect.DeepEqual(tenantUsage(t, tenant.ID), before) {
+		t.Fatal("Tenant usage not restored")
+	}
+
+	err = ds.ConfirmResize(instance.ID)
+	if err != ErrNoResize {
+		t.Fatalf("Expected %v, got %v", ErrNoResize, err)
+	}
+
+	err = ds.ResizeInstance(instance.ID, resizedID, usage, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.ConfirmResize(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.GetInstanceResize(instance.ID)
+	if err != ErrNoResize {
+		t.Fatalf("Expected %v, got %v", ErrNoResize, err)
+	}
+}
+
+func TestRelocateInstance(t *testing.T) {
+	instances, stat := addTestInstanceStats(t)
+	instance := instances[0]
+
+	err := ds.RelocateInstance(instance.ID)
+	if err != ErrNoResize {
+		t.Fatalf("Expected %v, got %v", ErrNoResize, err)
+	}
+
+	err = ds.ResizeInstance(instance.ID, instance.WorkloadID, instance.Usage, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.ConfirmResize(instance.ID)
+	if err != ErrNoResize {
+		t.Fatalf("Expected %v, got %v", ErrNoResize, err)
+	}
+
+	err = ds.RelocateInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if instance.NodeID != "" || instance.State != payloads.Pending {
+		t.Fatalf("Instance not relocated %+v", instance)
+	}
+
+	onNode, err := ds.GetAllInstancesByNode(stat.NodeUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range onNode {
+		if i.ID == instance.ID {
+			t.Fatal("Instance still assigned to its node")
+		}
+	}
+
+	r, err := ds.GetInstanceResize(instance.ID)
+	if err != nil || r.Migrating {
+		t.Fatalf("Unexpected resize record %+v: %v", r, err)
+	}
+
+	err = ds.DeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.GetInstanceResize(instance.ID)
+	if err != ErrNoResize {
+		t.Fatal("Resize record not deleted with instance")
+	}
+}
+
+func TestEvacuateInstance(t *testing.T) {
+	instances, stat := addTestInstanceStats(t)
+	instance := instances[0]
+
+	err := ds.EvacuateInstance(uuid.Generate().String())
+	if err != types.ErrInstanceNotFound {
+		t.Fatalf("Expected %v, got %v", types.ErrInstanceNotFound, err)
+	}
+
+	err = ds.EvacuateInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if instance.NodeID != "" || instance.State != payloads.Pending {
+		t.Fatalf("Instance not evacuated %+v", instance)
+	}
+
+	onNode, err := ds.GetAllInstancesByNode(stat.NodeUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range onNode {
+		if i.ID == instance.ID {
+			t.Fatal("Instance still assigned to its node")
+		}
+	}
+
+	_, err = ds.GetInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestHandleStats(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
@@ -592,6 +795,35 @@ func TestHandleStats(t *testing.T) {
 	}
 }
 
+func TestReconcileStats(t *testing.T) {
+	instances, stat := addTestInstanceStats(t)
+
+	// the first instance went away while there was no master controller
+	gone := instances[0]
+	stat.Instances = stat.Instances[1:]
+
+	err := ds.ReconcileStats([]payloads.Stat{stat})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.GetInstance(gone.ID)
+	if err != types.ErrInstanceNotFound {
+		t.Fatal("unreported instance not deleted")
+	}
+
+	for _, instance := range instances[1:] {
+		i, err := ds.GetInstance(instance.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i.NodeID != stat.NodeUUID {
+			t.Fatal("Incorrect NodeID for reported instance")
+		}
+	}
+}
+
 func TestGetInstanceLastStats(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
@@ -1044,6 +1276,80 @@ func TestAddLimit(t *testing.T) {
 	}
 }
 
+func TestAddLimitReplace(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, limit := range []int{1, 5} {
+		err = ds.AddLimit(tenant.ID, 2, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t2, err := ds.db.getTenantNoCache(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := 0
+	for _, r := range t2.Resources {
+		if r.Rtype == 2 {
+			found++
+			if r.Limit != 5 {
+				t.Fatalf("expected limit 5, got %d", r.Limit)
+			}
+		}
+	}
+
+	if found != 1 {
+		t.Fatalf("expected 1 vcpus resource, got %d", found)
+	}
+}
+
+func TestDeleteLimit(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.AddLimit(tenant.ID, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.DeleteLimit(tenant.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// make sure cache was updated
+	t2, err := ds.GetTenant(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range t2.Resources {
+		if r.Rtype == 1 && r.Limit != -1 {
+			t.Fatalf("expected no limit in cache, got %d", r.Limit)
+		}
+	}
+
+	// make sure datastore was updated
+	t3, err := ds.db.getTenantNoCache(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range t3.Resources {
+		if r.Rtype == 1 && r.Limit != -1 {
+			t.Fatalf("expected no limit in datastore, got %d", r.Limit)
+		}
+	}
+}
+
 func TestRemoveTenantCNCI(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
@@ -1692,6 +1998,94 @@ func TestDeleteBlockDevice(t *testing.T) {
 	}
 }
 
+func getVolumesUsage(resources []*types.Resource) int {
+	for _, r := range resources {
+		if r.Rname == "volumes" {
+			return r.Usage
+		}
+	}
+
+	return -1
+}
+
+func TestBlockDeviceVolumesUsage(t *testing.T) {
+	newTenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := types.BlockData{
+		BlockDevice: storage.BlockDevice{
+			ID: uuid.Generate().String(),
+		},
+		State:      types.Available,
+		TenantID:   newTenant.ID,
+		CreateTime: time.Now(),
+	}
+
+	err = ds.AddBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// updating a device must not count it twice
+	err = ds.UpdateBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenant, err := ds.GetTenant(newTenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usage := getVolumesUsage(tenant.Resources)
+	if usage != 1 {
+		t.Fatalf("expected 1 volume in use, got %d", usage)
+	}
+
+	err = ds.DeleteBlockDevice(data.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usage = getVolumesUsage(tenant.Resources)
+	if usage != 0 {
+		t.Fatalf("expected 0 volumes in use, got %d", usage)
+	}
+}
+
+func TestGetTenantResourcesVolumes(t *testing.T) {
+	newTenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := types.BlockData{
+		BlockDevice: storage.BlockDevice{
+			ID: uuid.Generate().String(),
+		},
+		State:      types.Available,
+		TenantID:   newTenant.ID,
+		CreateTime: time.Now(),
+	}
+
+	err = ds.db.createBlockData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenant, err := ds.db.getTenantNoCache(newTenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usage := getVolumesUsage(tenant.Resources)
+	if usage != 1 {
+		t.Fatalf("expected 1 volume in use, got %d", usage)
+	}
+}
+
 func TestUpdateBlockDevice(t *testing.T) {
 	newTenant, err := addTestTenant()
 	if err != nil {
@@ -1818,7 +2212,7 @@ func TestCreateStorageAttachment(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ds.createStorageAttachment(instance.ID, data.ID)
+	_, err = ds.createStorageAttachment(instance.ID, data.ID, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1838,14 +2232,75 @@ func TestCreateStorageAttachment(t *testing.T) {
 	}
 }
 
-func TestUpdateStorageAttachmentExisting(t *testing.T) {
+func TestAttachBootVolume(t *testing.T) {
 	tenant, err := addTestTenant()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	blockDevice := storage.BlockDevice{
-		ID: "validID",
+	data := types.BlockData{
+		BlockDevice: storage.BlockDevice{ID: uuid.Generate().String()},
+		State:       types.Available,
+		TenantID:    tenant.ID,
+		CreateTime:  time.Now(),
+	}
+
+	err = ds.AddBlockDevice(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.AttachBootVolume(instance.ID, data.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the boot volume is reported by the node once the instance runs.
+	ds.updateStorageAttachments(instance.ID, []string{data.ID})
+
+	attachments, err := ds.GetStorageAttachments(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(attachments) != 1 || !attachments[0].Boot ||
+		attachments[0].BlockID != data.ID {
+		t.Fatalf("Unexpected attachments %+v", attachments)
+	}
+
+	bd, err := ds.GetBlockDevice(data.ID)
+	if err != nil || bd.State != types.InUse {
+		t.Fatalf("Boot volume not in use %+v: %v", bd, err)
+	}
+
+	stored, err := ds.db.getAllStorageAttachments()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !stored[attachments[0].ID].Boot {
+		t.Fatalf("Boot attachment not stored %+v", stored[attachments[0].ID])
+	}
+}
+
+func TestUpdateStorageAttachmentExisting(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockDevice := storage.BlockDevice{
+		ID: "validID",
 	}
 
 	data := types.BlockData{
@@ -1875,7 +2330,7 @@ func TestUpdateStorageAttachmentExisting(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ds.createStorageAttachment(instance.ID, data.ID)
+	_, err = ds.createStorageAttachment(instance.ID, data.ID, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1982,7 +2437,7 @@ func TestUpdateStorageAttachmentDeleted(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ds.createStorageAttachment(instance.ID, data.ID)
+	_, err = ds.createStorageAttachment(instance.ID, data.ID, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2032,7 +2487,7 @@ func TestGetStorageAttachment(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ds.createStorageAttachment(instance.ID, data.ID)
+	_, err = ds.createStorageAttachment(instance.ID, data.ID, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2127,7 +2582,7 @@ func TestDeleteStorageAttachment(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ds.createStorageAttachment(instance.ID, data.ID)
+	_, err = ds.createStorageAttachment(instance.ID, data.ID, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2189,7 +2644,7 @@ func TestDeleteStorageAttachmentError(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ds.createStorageAttachment(instance.ID, data.ID)
+	_, err = ds.createStorageAttachment(instance.ID, data.ID, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2256,7 +2711,7 @@ func TestGetVolumeAttachments(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = ds.createStorageAttachment(instance.ID, data.ID)
+	_, err = ds.createStorageAttachment(instance.ID, data.ID, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2281,11 +2736,466 @@ var ds *Datastore
 
 var tablesInitPath = flag.String("tables_init_path", "../../tables", "path to csv files")
 var workloadsPath = flag.String("workloads_path", "../../workloads", "path to yaml files")
+var postgresURI = flag.String("postgres_uri", "", "postgres:// URI of a database to test against instead of sqlite3")
+
+func TestAllocatePublicIP(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addresses := []string{"198.51.100.1", "198.51.100.2"}
+	_, err = ds.AddPublicIPs("allocate", addresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.AddPublicIPs("allocate", addresses[:1])
+	if err != ErrDuplicatePublicIP {
+		t.Fatalf("expected %v, got %v", ErrDuplicatePublicIP, err)
+	}
+
+	for range addresses {
+		ip, err := ds.AllocatePublicIP(tenant.ID, "allocate")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ip.TenantID != tenant.ID || ip.Pool != "allocate" {
+			t.Fatalf("bad public IP allocation %v", ip)
+		}
+	}
+
+	_, err = ds.AllocatePublicIP(tenant.ID, "allocate")
+	if err != ErrNoFreePublicIP {
+		t.Fatalf("expected %v, got %v", ErrNoFreePublicIP, err)
+	}
+
+	ips, err := ds.GetTenantPublicIPs(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ips) != len(addresses) {
+		t.Fatalf("expected %d public IPs, got %d", len(addresses), len(ips))
+	}
+
+	err = ds.DeletePublicIPs(addresses)
+	if err != ErrPublicIPInUse {
+		t.Fatalf("expected %v, got %v", ErrPublicIPInUse, err)
+	}
+
+	for _, ip := range ips {
+		err = ds.ReleasePublicIP(ip.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = ds.DeletePublicIPs(addresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.GetPublicIP(ips[0].ID)
+	if err != ErrNoPublicIP {
+		t.Fatalf("expected %v, got %v", ErrNoPublicIP, err)
+	}
+}
+
+func TestMapPublicIP(t *testing.T) {
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance, err := addTestInstance(tenant, wls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.AddPublicIPs("map", []string{"198.51.100.3", "198.51.100.4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip, err := ds.AllocatePublicIP(tenant.ID, "map")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := ds.AllocatePublicIP(tenant.ID, "map")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.MapPublicIP(ip.ID, instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.MapPublicIP(other.ID, instance.ID)
+	if err != ErrPublicIPInUse {
+		t.Fatalf("expected %v, got %v", ErrPublicIPInUse, err)
+	}
+
+	err = ds.ReleasePublicIP(ip.ID)
+	if err != ErrPublicIPInUse {
+		t.Fatalf("expected %v, got %v", ErrPublicIPInUse, err)
+	}
+
+	err = ds.PublicIPAssigned(instance.ID, ip.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := ds.GetInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i.PublicIP != ip.Address {
+		t.Fatalf("expected instance public IP %s, got %s", ip.Address, i.PublicIP)
+	}
+
+	mapped, err := ds.UnmapPublicIP(ip.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mapped.InstanceID != instance.ID {
+		t.Fatalf("expected public IP mapped to %s, got %s", instance.ID, mapped.InstanceID)
+	}
+
+	if i.PublicIP != "" {
+		t.Fatalf("instance public IP %s not cleared", i.PublicIP)
+	}
+
+	_, err = ds.UnmapPublicIP(ip.ID)
+	if err != ErrPublicIPNotMapped {
+		t.Fatalf("expected %v, got %v", ErrPublicIPNotMapped, err)
+	}
+
+	// deleting the instance unmaps its public IP
+	_, err = ds.MapPublicIP(other.ID, instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.DeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err = ds.GetPublicIP(other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other.InstanceID != "" || other.TenantID != tenant.ID {
+		t.Fatalf("bad public IP after instance deletion %v", other)
+	}
+}
+
+func TestAddWorkload(t *testing.T) {
+	wl := types.Workload{
+		ID:          uuid.Generate().String(),
+		Description: "test workload",
+		FWType:      string(payloads.EFI),
+		VMType:      payloads.QEMU,
+		ImageID:     uuid.Generate().String(),
+		Config:      "---\n#cloud-config\n...\n",
+		Defaults: []payloads.RequestedResource{
+			{Type: payloads.VCPUs, Value: 2, Mandatory: true},
+			{Type: payloads.MemMB, Value: 512, Mandatory: true},
+		},
+	}
+
+	err := ds.AddWorkload(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.AddWorkload(wl)
+	if err != ErrDuplicateWorkload {
+		t.Fatalf("expected %v, got %v", ErrDuplicateWorkload, err)
+	}
+
+	w, err := ds.GetWorkload(wl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(*w, wl) {
+		t.Fatalf("expected workload %v, got %v", wl, *w)
+	}
+
+	wl.Description = "updated test workload"
+	wl.Defaults = wl.Defaults[:1]
+	wl.Storage = &types.StorageResource{
+		Bootable:   true,
+		Size:       10,
+		SourceType: types.ImageService,
+		SourceID:   wl.ImageID,
+	}
+
+	err = ds.UpdateWorkload(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// make sure the workload was persisted and not just cached
+	stored, err := ds.db.getWorkloadNoCache(wl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(stored.Workload, wl) {
+		t.Fatalf("expected workload %v, got %v", wl, stored.Workload)
+	}
+
+	err = ds.DeleteWorkload(wl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds.db.getWorkloadNoCache(wl.ID)
+	if err == nil {
+		t.Fatal("workload not deleted")
+	}
+
+	err = ds.UpdateWorkload(wl)
+	if err != ErrNoWorkload {
+		t.Fatalf("expected %v, got %v", ErrNoWorkload, err)
+	}
+
+	err = ds.DeleteWorkload(wl.ID)
+	if err != ErrNoWorkload {
+		t.Fatalf("expected %v, got %v", ErrNoWorkload, err)
+	}
+}
+
+func TestDeleteWorkloadError(t *testing.T) {
+	cnciID, err := ds.GetCNCIWorkloadID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.DeleteWorkload(cnciID)
+	if err != ErrInternalWorkload {
+		t.Fatalf("expected %v, got %v", ErrInternalWorkload, err)
+	}
+
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wl := types.Workload{
+		ID:          uuid.Generate().String(),
+		Description: "test workload in use",
+		VMType:      payloads.Docker,
+		ImageName:   "ubuntu:latest",
+	}
+
+	err = ds.AddWorkload(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance, err := addTestInstance(tenant, &wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.DeleteWorkload(wl.ID)
+	if err != ErrWorkloadInUse {
+		t.Fatalf("expected %v, got %v", ErrWorkloadInUse, err)
+	}
+
+	err = ds.DeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.DeleteWorkload(wl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sharedStore is a persistentStore shared with another controller, which
+// changes are simulated by writing to the store directly and counting
+// them.
+type sharedStore struct {
+	persistentStore
+	changes int64
+}
+
+func (s *sharedStore) getCacheChanges() (map[string]int64, error) {
+	return map[string]int64{"tenants": s.changes}, nil
+}
+
+func TestRefreshCaches(t *testing.T) {
+	store := &sharedStore{persistentStore: ds.db}
+	ds.db = store
+	defer func() {
+		ds.db = store.persistentStore
+	}()
+
+	tenant, err := addTestTenant()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip, err := ds.AllocateTenantIP(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the other controller adds a tenant and claims the next address
+	otherID := uuid.Generate().String()
+	err = store.addTenant(otherID, "02:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ipBytes := ip.To4()
+	subnet := int(binary.BigEndian.Uint16(ipBytes[1:3]))
+	err = store.claimTenantIP(tenant.ID, subnet, int(ipBytes[3])+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.changes++
+
+	tenants, err := ds.GetAllTenants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, tt := range tenants {
+		found = found || tt.ID == otherID
+	}
+	if !found {
+		t.Error("tenant added by another controller not found")
+	}
+
+	next, err := ds.AllocateTenantIP(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next.To4()[3] != ipBytes[3]+2 {
+		t.Errorf("expected address %d to be allocated, got %s", ipBytes[3]+2, next)
+	}
+
+	// the other controller adds an instance and a public IP
+	wls, err := ds.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	usage := make(map[string]int)
+	for _, r := range wls[0].Defaults {
+		usage[string(r.Type)] = r.Value
+	}
+
+	instance := &types.Instance{
+		ID:         uuid.Generate().String(),
+		TenantID:   tenant.ID,
+		WorkloadID: wls[0].ID,
+		IPAddress:  "172.16.0.254",
+		MACAddress: "02:00:ac:10:00:fe",
+		Usage:      usage,
+		CreateTime: time.Now(),
+	}
+
+	err = store.addInstance(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicIP := types.PublicIP{
+		ID:      uuid.Generate().String(),
+		Address: "10.11.12.13",
+		Pool:    "shared",
+	}
+
+	err = store.createPublicIP(publicIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.changes++
+
+	i, err := ds.GetInstance(instance.ID)
+	if err != nil {
+		t.Fatalf("instance added by another controller not found: %v", err)
+	}
+
+	if i.WorkloadID != instance.WorkloadID || i.IPAddress != instance.IPAddress {
+		t.Errorf("expected instance %+v, got %+v", instance, i)
+	}
+
+	instances, err := ds.GetAllInstancesFromTenant(tenant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 1 || instances[0].ID != instance.ID {
+		t.Errorf("expected tenant instance %s, got %v", instance.ID, instances)
+	}
+
+	_, err = ds.GetPublicIP(publicIP.ID)
+	if err != nil {
+		t.Errorf("public IP added by another controller not found: %v", err)
+	}
+
+	// the other controller deletes them
+	err = store.removeInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.deletePublicIP(publicIP.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.changes++
+
+	_, err = ds.GetInstance(instance.ID)
+	if err == nil {
+		t.Error("instance deleted by another controller found")
+	}
+
+	_, err = ds.GetPublicIP(publicIP.ID)
+	if err != ErrNoPublicIP {
+		t.Errorf("expected %v, got %v", ErrNoPublicIP, err)
+	}
+
+	err = ds.DeleteInstance(instance.ID)
+	if err != types.ErrInstanceNotFound {
+		t.Errorf("expected %v, got %v", types.ErrInstanceNotFound, err)
+	}
+}
 
 func TestMain(m *testing.M) {
 	flag.Parse()
 
 	ds = new(Datastore)
+	stopPostgres := func() {}
 
 	dsConfig := Config{
 		PersistentURI:     "file:memdb1?mode=memory&cache=shared",
@@ -2294,14 +3204,29 @@ func TestMain(m *testing.M) {
 		InitWorkloadsPath: *workloadsPath,
 	}
 
+	if *postgresURI != "" {
+		dsConfig.PersistentURI = *postgresURI
+		testPostgresURI = *postgresURI
+	} else {
+		uri, stop, err := startTestPostgres()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to start PostgreSQL: %v\n", err)
+		} else {
+			testPostgresURI = uri
+			stopPostgres = stop
+		}
+	}
+
 	err := ds.Init(dsConfig)
 	if err != nil {
+		stopPostgres()
 		os.Exit(1)
 	}
 
 	code := m.Run()
 
 	ds.Exit()
+	stopPostgres()
 
 	os.Exit(code)
 }
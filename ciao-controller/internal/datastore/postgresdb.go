@@ -0,0 +1,1665 @@
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
+	// register the postgres sql driver
+	_ "github.com/lib/pq"
+)
+
+// postgresDB stores both the persistent and the transient data in a
+// single PostgreSQL database.  Unlike sqlite3, PostgreSQL cannot join
+// tables that live in different databases, and several queries need
+// to join instances with their latest statistics.
+type postgresDB struct {
+	db            *sql.DB
+	tables        []persistentData
+	tableInitPath string
+	workloadsPath string
+}
+
+// postgresTable reuses the csv handling of the sqlite3 table types
+// but creates the table using a PostgreSQL specific schema.
+type postgresTable struct {
+	persistentData
+	ds     *postgresDB
+	schema string
+}
+
+func (t postgresTable) Init() error {
+	return t.ds.exec(t.DB(), t.schema)
+}
+
+// The sqlite3 store does not enable foreign key support so none of the
+// references between tables are enforced and the datastore relies on
+// this, e.g., attachments can outlive their instances.  The schemas
+// below therefore omit the foreign keys.  Ids are stored as text as
+// UUIDs do not fit in the varchar(32) columns declared for sqlite3.
+var pgSchemas = map[string]string{
+	"resources": `CREATE TABLE IF NOT EXISTS resources
+		(
+		id integer primary key,
+		name text
+		);`,
+	"tenants": `CREATE TABLE IF NOT EXISTS tenants
+		(
+		id text primary key,
+		name text,
+		cnci_id text default null,
+		cnci_mac text default null,
+		cnci_ip text default null
+		);`,
+	"limits": `CREATE TABLE IF NOT EXISTS limits
+		(
+		resource_id integer,
+		tenant_id text,
+		max_value integer
+		);`,
+	"instances": `CREATE TABLE IF NOT EXISTS instances
+		(
+		id text primary key,
+		tenant_id text,
+		workload_id text,
+		mac_address text,
+		ip text,
+		create_time timestamp with time zone,
+		unique(tenant_id, ip, mac_address)
+		);`,
+	"workload_template": `CREATE TABLE IF NOT EXISTS workload_template
+		(
+		id text primary key,
+		description text,
+		filename text,
+		fw_type text,
+		vm_type text,
+		image_id text,
+		image_name text,
+		internal integer
+		);`,
+	"workload_resources": `CREATE TABLE IF NOT EXISTS workload_resources
+		(
+		workload_id text,
+		resource_id integer,
+		default_value integer,
+		estimated_value integer,
+		mandatory integer
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS wlr_index
+		ON workload_resources(workload_id, resource_id);`,
+	"workload_configs": `CREATE TABLE IF NOT EXISTS workload_configs
+		(
+		workload_id text primary key,
+		config text
+		);`,
+	"usage": `CREATE TABLE IF NOT EXISTS usage
+		(
+		instance_id text,
+		resource_id integer,
+		value integer
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS myindex
+		ON usage(instance_id, resource_id);`,
+	"node_statistics": `CREATE TABLE IF NOT EXISTS node_statistics
+		(
+			id serial primary key,
+			node_id text,
+			mem_total_mb integer,
+			mem_available_mb integer,
+			disk_total_mb integer,
+			disk_available_mb integer,
+			load integer,
+			cpus_online integer,
+			"timestamp" timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL
+		);`,
+	"log": `CREATE TABLE IF NOT EXISTS log
+		(
+		id serial primary key,
+		tenant_id text,
+		type text,
+		message text,
+		"timestamp" timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL
+		);`,
+	"tenant_network": `CREATE TABLE IF NOT EXISTS tenant_network
+		(
+		tenant_id text,
+		subnet integer,
+		rest integer,
+		PRIMARY KEY(subnet, rest)
+		);`,
+	"instance_statistics": `CREATE TABLE IF NOT EXISTS instance_statistics
+		(
+			id serial primary key,
+			instance_id text,
+			memory_usage_mb integer,
+			disk_usage_mb integer,
+			cpu_usage integer,
+			state text,
+			node_id text,
+			ssh_ip text,
+			ssh_port integer,
+			"timestamp" timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL
+		);`,
+	"frame_statistics": `CREATE TABLE IF NOT EXISTS frame_statistics
+		(
+			id serial primary key,
+			label text,
+			type text,
+			operand text,
+			start_timestamp text,
+			end_timestamp text
+		);`,
+	"trace_data": `CREATE TABLE IF NOT EXISTS trace_data
+		(
+			id serial primary key,
+			frame_id integer,
+			ssntp_uuid text,
+			tx_timestamp text,
+			rx_timestamp text
+		);`,
+	"block_data": `CREATE TABLE IF NOT EXISTS block_data
+		(
+		id text primary key,
+		tenant_id text,
+		size integer,
+		state text,
+		create_time timestamp with time zone,
+		name text,
+		description text
+		);`,
+	"attachments": `CREATE TABLE IF NOT EXISTS attachments
+		(
+		id text primary key,
+		instance_id text,
+		block_id text,
+		boot integer default 0
+		);
+		ALTER TABLE attachments ADD COLUMN IF NOT EXISTS boot integer default 0;`,
+	"workload_storage": `CREATE TABLE IF NOT EXISTS workload_storage
+		(
+		workload_id text,
+		volume_id text,
+		bootable integer,
+		persistent integer,
+		size integer,
+		source_type text,
+		source_id text,
+		PRIMARY KEY(workload_id, volume_id)
+		);`,
+	"public_ips": `CREATE TABLE IF NOT EXISTS public_ips
+		(
+		id text primary key,
+		address text unique,
+		pool text,
+		tenant_id text,
+		instance_id text,
+		assigned boolean
+		);`,
+}
+
+// Several controllers may share the database.  The changes made to the
+// tables backing the tenants, instances and public IPs caches are counted
+// so that the controllers know when to reload their caches.
+const pgCacheChangesSchema = `CREATE TABLE IF NOT EXISTS cache_changes
+	(
+	name text primary key,
+	changes bigint DEFAULT 0 NOT NULL
+	);
+	INSERT INTO cache_changes (name) VALUES ('tenants'), ('instances'), ('public_ips')
+	ON CONFLICT DO NOTHING;
+	CREATE OR REPLACE FUNCTION cache_changed() RETURNS trigger AS $$
+	BEGIN
+		UPDATE cache_changes SET changes = changes + 1 WHERE name = TG_ARGV[0];
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;`
+
+// pgCacheTables maps the tables backing the caches to the cache they
+// back.
+var pgCacheTables = map[string]string{
+	"tenants":        "tenants",
+	"limits":         "tenants",
+	"tenant_network": "tenants",
+	"instances":      "instances",
+	"usage":          "instances",
+	"public_ips":     "public_ips",
+}
+
+func (ds *postgresDB) createCacheTriggers() error {
+	err := ds.exec(ds.db, pgCacheChangesSchema)
+	if err != nil {
+		return err
+	}
+
+	for table, cache := range pgCacheTables {
+		cmd := fmt.Sprintf(`DROP TRIGGER IF EXISTS %[1]s_changed ON %[1]s;
+			CREATE TRIGGER %[1]s_changed
+			AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON %[1]s
+			FOR EACH STATEMENT EXECUTE PROCEDURE cache_changed('%[2]s');`, table, cache)
+
+		err = ds.exec(ds.db, cmd)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ds *postgresDB) getCacheChanges() (map[string]int64, error) {
+	rows, err := ds.db.Query("SELECT name, changes FROM cache_changes")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make(map[string]int64)
+
+	for rows.Next() {
+		var name string
+		var count int64
+
+		err = rows.Scan(&name, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		changes[name] = count
+	}
+
+	return changes, rows.Err()
+}
+
+// pgElapsed returns an sql expression that computes the number of seconds
+// between two of the text timestamps stored in the statistics tables.
+func pgElapsed(from, to string) string {
+	return fmt.Sprintf("EXTRACT(EPOCH FROM (NULLIF(%s, '')::timestamptz - NULLIF(%s, '')::timestamptz))", to, from)
+}
+
+func (ds *postgresDB) exec(db *sql.DB, cmd string) error {
+	glog.V(2).Info("exec: ", cmd)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(cmd)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) create(tableName string, record ...interface{}) error {
+	if ds.getTableDB(tableName) == nil {
+		return errors.New("Bad table name")
+	}
+
+	params := make([]string, len(record))
+	for i := range record {
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	cmd := "INSERT INTO " + tableName + " VALUES (" + strings.Join(params, ",") + ") ON CONFLICT DO NOTHING"
+
+	glog.V(2).Info("create: ", cmd)
+
+	_, err := ds.db.Exec(cmd, record...)
+	return err
+}
+
+func (ds *postgresDB) tablesPath() string {
+	return ds.tableInitPath
+}
+
+func (ds *postgresDB) getTableDB(name string) *sql.DB {
+	for _, table := range ds.tables {
+		if table.Name() == name {
+			return table.DB()
+		}
+	}
+	return nil
+}
+
+// getPostgresStore connects to the PostgreSQL database identified by
+// config.PersistentURI and creates any missing tables.  As with sqlite3,
+// the tables are populated with initial data from the csv files found
+// in config.InitTablesPath.
+func getPostgresStore(config Config) (persistentStore, error) {
+	db, err := sql.Open("postgres", config.PersistentURI)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		glog.Warning(err)
+		db.Close()
+		return nil, err
+	}
+
+	ds := &postgresDB{
+		db:            db,
+		tableInitPath: config.InitTablesPath,
+		workloadsPath: config.InitWorkloadsPath,
+	}
+
+	tables := []persistentData{
+		resourceData{namedData{ds: ds, name: "resources", db: db}},
+		tenantData{namedData{ds: ds, name: "tenants", db: db}},
+		limitsData{namedData{ds: ds, name: "limits", db: db}},
+		instanceData{namedData{ds: ds, name: "instances", db: db}},
+		workloadTemplateData{namedData{ds: ds, name: "workload_template", db: db}},
+		workloadResourceData{namedData{ds: ds, name: "workload_resources", db: db}},
+		workloadConfigData{namedData{ds: ds, name: "workload_configs", db: db}},
+		usageData{namedData{ds: ds, name: "usage", db: db}},
+		nodeStatisticsData{namedData{ds: ds, name: "node_statistics", db: db}},
+		logData{namedData{ds: ds, name: "log", db: db}},
+		subnetData{namedData{ds: ds, name: "tenant_network", db: db}},
+		instanceStatisticsData{namedData{ds: ds, name: "instance_statistics", db: db}},
+		frameStatisticsData{namedData{ds: ds, name: "frame_statistics", db: db}},
+		traceData{namedData{ds: ds, name: "trace_data", db: db}},
+		blockData{namedData{ds: ds, name: "block_data", db: db}},
+		attachments{namedData{ds: ds, name: "attachments", db: db}},
+		workloadStorage{namedData{ds: ds, name: "workload_storage", db: db}},
+		publicIPData{namedData{ds: ds, name: "public_ips", db: db}},
+	}
+
+	for _, table := range tables {
+		ds.tables = append(ds.tables, postgresTable{
+			persistentData: table,
+			ds:             ds,
+			schema:         pgSchemas[table.Name()],
+		})
+	}
+
+	for _, table := range ds.tables {
+		err = table.Init()
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	err = ds.createCacheTriggers()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	for _, table := range ds.tables {
+		// Populate failures are not fatal, because it could just mean
+		// there's no initial data to populate
+		_ = table.Populate()
+	}
+
+	return ds, nil
+}
+
+func (ds *postgresDB) disconnect() {
+	ds.db.Close()
+}
+
+func (ds *postgresDB) logEvent(tenantID string, eventType string, message string) error {
+	_, err := ds.db.Exec("INSERT INTO log (tenant_id, type, message) VALUES ($1, $2, $3)", tenantID, eventType, message)
+	return err
+}
+
+func (ds *postgresDB) clearLog() error {
+	err := ds.exec(ds.db, "DELETE FROM log")
+	if err != nil {
+		glog.V(2).Info("could not clear log: ", err)
+	}
+
+	return err
+}
+
+func (ds *postgresDB) getEventLog() ([]*types.LogEntry, error) {
+	rows, err := ds.db.Query(`SELECT "timestamp", tenant_id, type, message FROM log ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logEntries := make([]*types.LogEntry, 0)
+	for rows.Next() {
+		var e types.LogEntry
+		err = rows.Scan(&e.Timestamp, &e.TenantID, &e.EventType, &e.Message)
+		if err != nil {
+			return nil, err
+		}
+		logEntries = append(logEntries, &e)
+	}
+
+	return logEntries, rows.Err()
+}
+
+func (ds *postgresDB) getCNCIWorkloadID() (string, error) {
+	var ID string
+
+	err := ds.db.QueryRow("SELECT id FROM workload_template WHERE description = 'CNCI'").Scan(&ID)
+	if err != nil {
+		return "", err
+	}
+
+	return ID, nil
+}
+
+func (ds *postgresDB) getConfigNoCache(ID string) (string, error) {
+	var configFile string
+
+	var config string
+	err := ds.db.QueryRow("SELECT config FROM workload_configs WHERE workload_id = $1", ID).Scan(&config)
+	if err == nil {
+		return config, nil
+	} else if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	err = ds.db.QueryRow("SELECT filename FROM workload_template WHERE id = $1", ID).Scan(&configFile)
+	if err != nil {
+		return "", err
+	}
+
+	path := fmt.Sprintf("%s/%s", ds.workloadsPath, configFile)
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes), nil
+}
+
+func (ds *postgresDB) getWorkloadDefaults(ID string) ([]payloads.RequestedResource, error) {
+	query := `SELECT resources.name, default_value, mandatory FROM workload_resources
+		  JOIN resources
+		  ON workload_resources.resource_id = resources.id
+		  WHERE workload_id = $1`
+
+	rows, err := ds.db.Query(query, ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var defaults []payloads.RequestedResource
+
+	for rows.Next() {
+		var val int
+		var rname string
+		var mandatory bool
+
+		err = rows.Scan(&rname, &val, &mandatory)
+		if err != nil {
+			return nil, err
+		}
+		r := payloads.RequestedResource{
+			Type:      payloads.Resource(rname),
+			Value:     val,
+			Mandatory: mandatory,
+		}
+		defaults = append(defaults, r)
+	}
+
+	return defaults, rows.Err()
+}
+
+func (ds *postgresDB) getWorkloadStorage(ID string) (*types.StorageResource, error) {
+	query := `SELECT volume_id, bootable, persistent, size,
+			 source_type, source_id
+		  FROM workload_storage
+		  WHERE workload_id = $1`
+
+	var r types.StorageResource
+	var sourceType string
+
+	err := ds.db.QueryRow(query, ID).Scan(&r.ID, &r.Bootable, &r.Persistent, &r.Size, &sourceType, &r.SourceID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// not an error, it's just not there.
+			err = nil
+		}
+
+		return nil, err
+	}
+	r.SourceType = types.SourceType(sourceType)
+
+	return &r, nil
+}
+
+func (ds *postgresDB) scanWorkload(row interface {
+	Scan(dest ...interface{}) error
+}) (*workload, error) {
+	wl := new(workload)
+
+	var VMType string
+
+	err := row.Scan(&wl.ID, &wl.Description, &wl.filename, &wl.FWType, &VMType, &wl.ImageID, &wl.ImageName)
+	if err != nil {
+		return nil, err
+	}
+
+	wl.VMType = payloads.Hypervisor(VMType)
+
+	wl.Config, err = ds.getConfigNoCache(wl.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	wl.Defaults, err = ds.getWorkloadDefaults(wl.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	wl.Storage, err = ds.getWorkloadStorage(wl.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return wl, nil
+}
+
+func (ds *postgresDB) getWorkloadNoCache(id string) (*workload, error) {
+	query := `SELECT id,
+			 description,
+			 filename,
+			 fw_type,
+			 vm_type,
+			 image_id,
+			 image_name
+		  FROM workload_template
+		  WHERE id = $1`
+
+	wl, err := ds.scanWorkload(ds.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("Workload %q not found", id)
+	}
+
+	return wl, err
+}
+
+func (ds *postgresDB) getWorkloadsNoCache() ([]*workload, error) {
+	query := `SELECT id,
+			 description,
+			 filename,
+			 fw_type,
+			 vm_type,
+			 image_id,
+			 image_name
+		  FROM workload_template
+		  WHERE internal = 0`
+
+	rows, err := ds.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workloads []*workload
+
+	for rows.Next() {
+		wl, err := ds.scanWorkload(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		workloads = append(workloads, wl)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return workloads, nil
+}
+
+func (ds *postgresDB) insertWorkloadData(tx *sql.Tx, wl *workload) error {
+	for _, r := range wl.Defaults {
+		res, err := tx.Exec(`INSERT INTO workload_resources
+				     SELECT $1, id, $2, $2, $3 FROM resources WHERE name = $4`,
+			wl.ID, r.Value, boolToInt(r.Mandatory), string(r.Type))
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return fmt.Errorf("Unknown resource %q", r.Type)
+		}
+	}
+
+	if wl.Storage != nil {
+		s := wl.Storage
+		_, err := tx.Exec("INSERT INTO workload_storage VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			wl.ID, s.ID, boolToInt(s.Bootable), boolToInt(s.Persistent), s.Size, string(s.SourceType), s.SourceID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec("INSERT INTO workload_configs VALUES ($1, $2)", wl.ID, wl.Config)
+
+	return err
+}
+
+func (ds *postgresDB) deleteWorkloadData(tx *sql.Tx, ID string) error {
+	for _, table := range []string{"workload_resources", "workload_storage", "workload_configs"} {
+		_, err := tx.Exec("DELETE FROM "+table+" WHERE workload_id = $1", ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ds *postgresDB) addWorkload(wl *workload) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO workload_template VALUES ($1, $2, $3, $4, $5, $6, $7, 0)",
+		wl.ID, wl.Description, wl.filename, wl.FWType, string(wl.VMType), wl.ImageID, wl.ImageName)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = ds.insertWorkloadData(tx, wl)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) updateWorkload(wl *workload) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE workload_template
+			  SET description = $1, fw_type = $2, vm_type = $3, image_id = $4, image_name = $5
+			  WHERE id = $6`,
+		wl.Description, wl.FWType, string(wl.VMType), wl.ImageID, wl.ImageName, wl.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = ds.deleteWorkloadData(tx, wl.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = ds.insertWorkloadData(tx, wl)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) deleteWorkload(ID string) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = ds.deleteWorkloadData(tx, ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM workload_template WHERE id = $1", ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) addLimit(tenantID string, resourceID int, limit int) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// limits has no unique key so replace any existing limit by hand
+	_, err = tx.Exec("DELETE FROM limits WHERE tenant_id = $1 AND resource_id = $2", tenantID, resourceID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO limits VALUES ($1, $2, $3)", resourceID, tenantID, limit)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) deleteLimit(tenantID string, resourceID int) error {
+	_, err := ds.db.Exec("DELETE FROM limits WHERE tenant_id = $1 AND resource_id = $2", tenantID, resourceID)
+	return err
+}
+
+func (ds *postgresDB) getTenantResources(ID string) ([]*types.Resource, error) {
+	query := `WITH instances_usage AS
+		 (
+			 SELECT resource_id, value
+			 FROM usage
+			 LEFT JOIN instances
+			 ON usage.instance_id = instances.id
+			 WHERE instances.tenant_id = $1
+		 )
+		 SELECT resources.name, resources.id, MAX(limits.max_value),
+		 CASE WHEN resources.id = 1 THEN
+		 (
+			 SELECT COUNT(instances.id)
+			 FROM instances
+			 WHERE instances.tenant_id = $1
+		 )
+		 WHEN resources.name = 'volumes' THEN
+		 (
+			 SELECT COUNT(block_data.id)
+			 FROM block_data
+			 WHERE block_data.tenant_id = $1
+		 )
+		 ELSE SUM(instances_usage.value)
+		 END
+		 FROM resources
+		 LEFT JOIN instances_usage
+		 ON instances_usage.resource_id = resources.id
+		 LEFT JOIN limits
+		 ON resources.id = limits.resource_id
+		 AND limits.tenant_id = $1
+		 GROUP BY resources.id
+		 ORDER BY resources.id`
+
+	rows, err := ds.db.Query(query, ID)
+	if err != nil {
+		glog.Warning("Failed to get tenant usage")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resources []*types.Resource
+
+	for rows.Next() {
+		var id int
+		var name string
+		var sqlMaxVal sql.NullInt64
+		var sqlCurVal sql.NullInt64
+		var maxVal = -1
+		var curVal = 0
+
+		err = rows.Scan(&name, &id, &sqlMaxVal, &sqlCurVal)
+		if err != nil {
+			return nil, err
+		}
+
+		if sqlMaxVal.Valid {
+			maxVal = int(sqlMaxVal.Int64)
+		}
+
+		if sqlCurVal.Valid {
+			curVal = int(sqlCurVal.Int64)
+		}
+
+		r := types.Resource{
+			Rname: name,
+			Rtype: id,
+			Limit: maxVal,
+			Usage: curVal,
+		}
+
+		resources = append(resources, &r)
+	}
+
+	return resources, rows.Err()
+}
+
+func (ds *postgresDB) addTenant(ID string, MAC string) error {
+	return ds.create("tenants", ID, "", "", MAC, "")
+}
+
+func (ds *postgresDB) fillTenant(t *tenant) error {
+	var err error
+
+	t.Resources, err = ds.getTenantResources(t.ID)
+	if err != nil {
+		return err
+	}
+
+	err = ds.getTenantNetwork(t)
+	if err != nil {
+		return err
+	}
+
+	t.instances, err = ds.getTenantInstances(t.ID)
+	if err != nil {
+		return err
+	}
+
+	t.devices, err = ds.getTenantDevices(t.ID)
+
+	return err
+}
+
+func (ds *postgresDB) getTenantNoCache(ID string) (*tenant, error) {
+	query := `SELECT	tenants.id,
+				tenants.name,
+				tenants.cnci_id,
+				tenants.cnci_mac,
+				tenants.cnci_ip
+		  FROM tenants
+		  WHERE tenants.id = $1`
+
+	t := &tenant{}
+
+	err := ds.db.QueryRow(query, ID).Scan(&t.ID, &t.Name, &t.CNCIID, &t.CNCIMAC, &t.CNCIIP)
+	if err != nil {
+		glog.Warning("unable to retrieve tenant from tenants")
+
+		if err == sql.ErrNoRows {
+			// not an error, it's just not there.
+			err = nil
+		}
+
+		return nil, err
+	}
+
+	// for these items below, its ok to get err returned
+	// because a tenant could simply not have used any
+	// resources or networks yet.
+	t.Resources, err = ds.getTenantResources(ID)
+	if err != nil {
+		glog.V(2).Info(err)
+	}
+
+	err = ds.getTenantNetwork(t)
+	if err != nil {
+		glog.V(2).Info(err)
+	}
+
+	t.instances, err = ds.getTenantInstances(t.ID)
+	if err != nil {
+		glog.V(2).Info(err)
+	}
+
+	t.devices, err = ds.getTenantDevices(t.ID)
+
+	return t, err
+}
+
+func (ds *postgresDB) getTenantsNoCache() ([]*tenant, error) {
+	query := `SELECT	tenants.id,
+				tenants.name,
+				tenants.cnci_id,
+				tenants.cnci_mac,
+				tenants.cnci_ip
+		  FROM tenants`
+
+	rows, err := ds.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*tenant
+
+	for rows.Next() {
+		var id sql.NullString
+		var name sql.NullString
+		var cnciID sql.NullString
+		var cnciMAC sql.NullString
+		var cnciIP sql.NullString
+
+		err = rows.Scan(&id, &name, &cnciID, &cnciMAC, &cnciIP)
+		if err != nil {
+			return nil, err
+		}
+
+		t := &tenant{}
+		t.ID = id.String
+		t.Name = name.String
+		t.CNCIID = cnciID.String
+		t.CNCIMAC = cnciMAC.String
+		t.CNCIIP = cnciIP.String
+
+		tenants = append(tenants, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The tenant details are retrieved once the rows are closed, so
+	// that we do not hold more than one connection at a time.
+	rows.Close()
+
+	for _, t := range tenants {
+		err = ds.fillTenant(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tenants, nil
+}
+
+func (ds *postgresDB) updateTenant(t *tenant) error {
+	_, err := ds.db.Exec("UPDATE tenants SET cnci_id = $1, cnci_mac = $2, cnci_ip = $3 WHERE id = $4", t.CNCIID, t.CNCIMAC, t.CNCIIP, t.ID)
+	return err
+}
+
+func (ds *postgresDB) claimTenantIP(tenantID string, subnetInt int, rest int) error {
+	_, err := ds.db.Exec("INSERT INTO tenant_network VALUES($1, $2, $3)", tenantID, subnetInt, rest)
+	return err
+}
+
+func (ds *postgresDB) releaseTenantIP(tenantID string, subnetInt int, rest int) error {
+	_, err := ds.db.Exec("DELETE FROM tenant_network WHERE tenant_id = $1 AND subnet = $2 AND rest = $3", tenantID, subnetInt, rest)
+	return err
+}
+
+func (ds *postgresDB) getTenantNetwork(tenant *tenant) error {
+	tenant.network = make(map[int]map[int]bool)
+
+	// get all subnet,rest values for this tenant
+	query := `SELECT subnet, rest
+		  FROM tenant_network
+		  WHERE tenant_id = $1`
+
+	rows, err := ds.db.Query(query, tenant.ID)
+	if err != nil {
+		glog.Warning(err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var subnetInt uint16
+		var rest uint8
+
+		err = rows.Scan(&subnetInt, &rest)
+		if err != nil {
+			glog.Warning(err)
+			return err
+		}
+
+		_, ok := tenant.network[int(subnetInt)]
+		if !ok {
+			sub := make(map[int]bool)
+			tenant.network[int(subnetInt)] = sub
+		}
+
+		/* Only add to the subnet list for the first host */
+		if len(tenant.network[int(subnetInt)]) == 0 {
+			tenant.subnets = append(tenant.subnets, int(subnetInt))
+		}
+
+		tenant.network[int(subnetInt)][int(rest)] = true
+	}
+
+	return rows.Err()
+}
+
+// pgInstancesQuery selects each instance along with the state reported
+// in its most recent statistics.
+const pgInstancesQuery = `
+	WITH latest AS
+	(
+		SELECT DISTINCT ON (instance_id)
+			instance_id,
+			state,
+			ssh_ip,
+			ssh_port,
+			node_id
+		FROM instance_statistics
+		ORDER BY instance_id, "timestamp" DESC, id DESC
+	)
+	SELECT	instances.id,
+		instances.tenant_id,
+		COALESCE(latest.state, '` + payloads.ComputeStatusPending + `') AS state,
+		workload_id,
+		latest.ssh_ip,
+		latest.ssh_port,
+		latest.node_id,
+		mac_address,
+		ip
+	FROM instances
+	LEFT JOIN latest
+	ON instances.id = latest.instance_id
+	`
+
+func (ds *postgresDB) queryInstances(query string, args ...interface{}) ([]*types.Instance, error) {
+	rows, err := ds.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var instances []*types.Instance
+
+	for rows.Next() {
+		var nodeID sql.NullString
+		var sshIP sql.NullString
+		var sshPort sql.NullInt64
+
+		i := &types.Instance{}
+
+		err = rows.Scan(&i.ID, &i.TenantID, &i.State, &i.WorkloadID, &sshIP, &sshPort, &nodeID, &i.MACAddress, &i.IPAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		i.NodeID = nodeID.String
+		i.SSHIP = sshIP.String
+		if sshPort.Valid {
+			i.SSHPort = int(sshPort.Int64)
+		}
+
+		instances = append(instances, i)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows.Close()
+
+	for _, i := range instances {
+		defaults, err := ds.getWorkloadDefaults(i.WorkloadID)
+		if err != nil {
+			return nil, err
+		}
+
+		usage := make(map[string]int)
+		for c := range defaults {
+			usage[string(defaults[c].Type)] = defaults[c].Value
+		}
+		i.Usage = usage
+	}
+
+	return instances, nil
+}
+
+func (ds *postgresDB) getInstances() ([]*types.Instance, error) {
+	instances, err := ds.queryInstances(pgInstancesQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sqlite3 store reports instances that have not yet been
+	// assigned to a node in this way.
+	for _, i := range instances {
+		if i.NodeID == "" {
+			i.NodeID = "Not Assigned"
+		}
+		if i.SSHIP == "" {
+			i.SSHIP = "Not Assigned"
+		}
+	}
+
+	return instances, nil
+}
+
+func (ds *postgresDB) getTenantInstances(tenantID string) (map[string]*types.Instance, error) {
+	instances, err := ds.queryInstances(pgInstancesQuery+"WHERE instances.tenant_id = $1", tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantInstances := make(map[string]*types.Instance)
+	for _, i := range instances {
+		if i.SSHIP == "" {
+			i.SSHIP = "Not Assigned"
+		}
+		tenantInstances[i.ID] = i
+	}
+
+	return tenantInstances, nil
+}
+
+func (ds *postgresDB) addInstance(instance *types.Instance) error {
+	err := ds.create("instances", instance.ID, instance.TenantID, instance.WorkloadID, instance.MACAddress, instance.IPAddress, instance.CreateTime)
+	if err != nil {
+		return err
+	}
+
+	return ds.addUsage(instance.ID, instance.Usage)
+}
+
+func (ds *postgresDB) removeInstance(instanceID string) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM instances WHERE id = $1", instanceID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM usage WHERE instance_id = $1", instanceID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateInstance stores the workload and resource usage of an existing
+// instance, which change when the instance is resized.
+func (ds *postgresDB) updateInstance(instance *types.Instance) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE instances SET workload_id = $1 WHERE id = $2", instance.WorkloadID, instance.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM usage WHERE instance_id = $1", instance.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return ds.addUsage(instance.ID, instance.Usage)
+}
+
+func (ds *postgresDB) addUsage(instanceID string, usage map[string]int) error {
+	cmd := `INSERT INTO usage (instance_id, resource_id, value)
+		SELECT $1, resources.id, $2
+		FROM resources
+		WHERE name = $3
+		ON CONFLICT DO NOTHING`
+
+	for key, val := range usage {
+		_, err := ds.db.Exec(cmd, instanceID, val, key)
+		if err != nil {
+			glog.V(2).Info(err)
+			// but keep going
+		}
+	}
+
+	return nil
+}
+
+func (ds *postgresDB) addNodeStatDB(stat payloads.Stat) error {
+	_, err := ds.db.Exec("INSERT INTO node_statistics (node_id, mem_total_mb, mem_available_mb, disk_total_mb, disk_available_mb, load, cpus_online) VALUES($1, $2, $3, $4, $5, $6, $7)", stat.NodeUUID, stat.MemTotalMB, stat.MemAvailableMB, stat.DiskTotalMB, stat.DiskAvailableMB, stat.Load, stat.CpusOnline)
+	return err
+}
+
+func (ds *postgresDB) addInstanceStatsDB(stats []payloads.InstanceStat, nodeID string) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	cmd := `INSERT INTO instance_statistics (instance_id, memory_usage_mb, disk_usage_mb, cpu_usage, state, node_id, ssh_ip, ssh_port)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	stmt, err := tx.Prepare(cmd)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	defer stmt.Close()
+
+	for index := range stats {
+		stat := stats[index]
+
+		_, err = stmt.Exec(stat.InstanceUUID, stat.MemoryUsageMB, stat.DiskUsageMB, stat.CPUUsage, stat.State, nodeID, stat.SSHIP, stat.SSHPort)
+		if err != nil {
+			// a failed statement aborts a PostgreSQL transaction
+			glog.Warning(err)
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) addFrameStat(stat payloads.FrameTrace) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO frame_statistics (label, type, operand, start_timestamp, end_timestamp)
+		  VALUES($1, $2, $3, $4, $5)
+		  RETURNING id`
+
+	var id int
+
+	err = tx.QueryRow(query, stat.Label, stat.Type, stat.Operand, stat.StartTimestamp, stat.EndTimestamp).Scan(&id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for index := range stat.Nodes {
+		t := stat.Nodes[index]
+
+		cmd := `INSERT INTO trace_data (frame_id, ssntp_uuid, tx_timestamp, rx_timestamp)
+			VALUES($1, $2, $3, $4)`
+
+		_, err = tx.Exec(cmd, id, t.SSNTPUUID, t.TxTimestamp, t.RxTimestamp)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ds *postgresDB) getNodeSummary() ([]*types.NodeSummary, error) {
+	query := `
+WITH latest AS
+(
+	SELECT DISTINCT ON (instance_id)
+		instance_id,
+		node_id,
+		state
+	FROM instance_statistics
+	ORDER BY instance_id, "timestamp" DESC, id DESC
+),
+node_instances AS
+(
+	SELECT instances.id AS instance_id,
+	       COALESCE(latest.state, '` + payloads.ComputeStatusPending + `') AS state,
+	       COALESCE(latest.node_id, 'Not Assigned') AS node_id
+	FROM instances
+	LEFT JOIN latest
+	ON instances.id = latest.instance_id
+)
+SELECT	node_id,
+	count(instance_id),
+	count(instance_id) FILTER (WHERE state = '` + payloads.ComputeStatusRunning + `'),
+	count(instance_id) FILTER (WHERE state = '` + payloads.ComputeStatusPending + `'),
+	count(instance_id) FILTER (WHERE state = '` + payloads.ComputeStatusStopped + `')
+FROM node_instances
+GROUP BY node_id
+`
+
+	rows, err := ds.db.Query(query)
+	if err != nil {
+		glog.V(2).Info("Failed to get Node Summary: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := make([]*types.NodeSummary, 0)
+
+	for rows.Next() {
+		var n types.NodeSummary
+
+		err = rows.Scan(&n.NodeID, &n.TotalInstances, &n.TotalRunningInstances, &n.TotalPendingInstances, &n.TotalPausedInstances)
+		if err != nil {
+			return nil, err
+		}
+
+		summary = append(summary, &n)
+	}
+
+	return summary, rows.Err()
+}
+
+// pgFrameDurations contains the common expressions used to compute the
+// time spent by a frame in the controller, the scheduler and the launcher.
+// The label is the first parameter of the query.
+var pgFrameDurations = `total AS
+		(
+			SELECT	id,
+				start_timestamp,
+				end_timestamp,
+				` + pgElapsed("start_timestamp", "end_timestamp") + ` AS total_elapsed
+			FROM frame_statistics
+			WHERE label = $1
+		),
+		total_start AS
+		(
+			SELECT	trace_data.frame_id,
+				trace_data.ssntp_uuid,
+				` + pgElapsed("total.start_timestamp", "trace_data.tx_timestamp") + ` AS total_elapsed
+			FROM trace_data
+			JOIN total
+			ON trace_data.frame_id = total.id
+			WHERE rx_timestamp = ''
+		),
+		total_end AS
+		(
+			SELECT	trace_data.frame_id,
+				trace_data.ssntp_uuid,
+				` + pgElapsed("trace_data.rx_timestamp", "total.end_timestamp") + ` AS total_elapsed
+			FROM trace_data
+			JOIN total
+			ON trace_data.frame_id = total.id
+			WHERE tx_timestamp = ''
+		),
+		total_per_node AS
+		(
+			SELECT	trace_data.frame_id,
+				trace_data.ssntp_uuid,
+				` + pgElapsed("trace_data.rx_timestamp", "trace_data.tx_timestamp") + ` AS total_elapsed
+			FROM trace_data
+			WHERE tx_timestamp != '' AND rx_timestamp != ''
+		)`
+
+func (ds *postgresDB) getBatchFrameSummary() ([]types.BatchFrameSummary, error) {
+	query := `SELECT label, count(id)
+		  FROM frame_statistics
+		  GROUP BY label`
+
+	rows, err := ds.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]types.BatchFrameSummary, 0)
+
+	for rows.Next() {
+		var stat types.BatchFrameSummary
+
+		err = rows.Scan(&stat.BatchID, &stat.NumInstances)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
+
+func (ds *postgresDB) getBatchFrameStatistics(label string) ([]types.BatchFrameStat, error) {
+	query := `WITH ` + pgFrameDurations + `,
+		diffs AS
+		(
+			SELECT 	total.id AS id,
+				total.total_elapsed AS total_elapsed,
+				total_start.total_elapsed AS controller_elapsed,
+				total_end.total_elapsed AS launcher_elapsed,
+				total_per_node.total_elapsed AS scheduler_elapsed
+			FROM total
+			LEFT JOIN total_start
+			ON total.id = total_start.frame_id
+			LEFT JOIN total_end
+			ON total_start.frame_id = total_end.frame_id
+			LEFT JOIN total_per_node
+			ON total_start.frame_id = total_per_node.frame_id
+		),
+		averages AS
+		(
+			SELECT	avg(diffs.total_elapsed) AS avg_total_elapsed,
+				avg(diffs.controller_elapsed) AS avg_controller,
+				avg(diffs.launcher_elapsed) AS avg_launcher,
+				avg(diffs.scheduler_elapsed) AS avg_scheduler
+			FROM diffs
+		),
+		variance AS
+		(
+			SELECT	avg((total_start.total_elapsed - averages.avg_controller) * (total_start.total_elapsed - averages.avg_controller)) AS controller,
+				avg((total_end.total_elapsed - averages.avg_launcher) * (total_end.total_elapsed - averages.avg_launcher)) AS launcher,
+				avg((total_per_node.total_elapsed - averages.avg_scheduler) * (total_per_node.total_elapsed - averages.avg_scheduler)) AS scheduler
+			FROM total_start
+			LEFT JOIN total_end
+			ON total_start.frame_id = total_end.frame_id
+			LEFT JOIN total_per_node
+			ON total_start.frame_id = total_per_node.frame_id
+			CROSS JOIN averages
+		)
+		SELECT	count(total.id) AS num_instances,
+			` + pgElapsed("min(total.start_timestamp)", "max(total.end_timestamp)") + ` AS total_elapsed,
+			max(averages.avg_total_elapsed) AS average_total_elapsed,
+			max(averages.avg_controller) AS average_controller_elapsed,
+			max(averages.avg_launcher) AS average_launcher_elapsed,
+			max(averages.avg_scheduler) AS average_scheduler_elapsed,
+			max(variance.controller) AS controller_variance,
+			max(variance.launcher) AS launcher_variance,
+			max(variance.scheduler) AS scheduler_variance
+		FROM variance
+		CROSS JOIN total
+		CROSS JOIN averages`
+
+	rows, err := ds.db.Query(query, label)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]types.BatchFrameStat, 0)
+
+	for rows.Next() {
+		var stat types.BatchFrameStat
+		var numInstances sql.NullInt64
+		var totalElapsed sql.NullFloat64
+		var averageElapsed sql.NullFloat64
+		var averageControllerElapsed sql.NullFloat64
+		var averageLauncherElapsed sql.NullFloat64
+		var averageSchedulerElapsed sql.NullFloat64
+		var varianceController sql.NullFloat64
+		var varianceLauncher sql.NullFloat64
+		var varianceScheduler sql.NullFloat64
+
+		err = rows.Scan(&numInstances, &totalElapsed, &averageElapsed, &averageControllerElapsed, &averageLauncherElapsed, &averageSchedulerElapsed, &varianceController, &varianceLauncher, &varianceScheduler)
+		if err != nil {
+			return nil, err
+		}
+
+		stat.NumInstances = int(numInstances.Int64)
+		stat.TotalElapsed = totalElapsed.Float64
+		stat.AverageElapsed = averageElapsed.Float64
+		stat.AverageControllerElapsed = averageControllerElapsed.Float64
+		stat.AverageLauncherElapsed = averageLauncherElapsed.Float64
+		stat.AverageSchedulerElapsed = averageSchedulerElapsed.Float64
+		stat.VarianceController = varianceController.Float64
+		stat.VarianceLauncher = varianceLauncher.Float64
+		stat.VarianceScheduler = varianceScheduler.Float64
+
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
+
+func (ds *postgresDB) queryBlockData(query string, args ...interface{}) (map[string]types.BlockData, error) {
+	devices := make(map[string]types.BlockData)
+
+	rows, err := ds.db.Query(query, args...)
+	if err != nil {
+		return devices, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var state string
+		var data types.BlockData
+
+		err = rows.Scan(&data.ID, &data.TenantID, &data.Size, &state, &data.CreateTime, &data.Name, &data.Description)
+		if err != nil {
+			continue
+		}
+
+		data.State = types.BlockState(state)
+		devices[data.ID] = data
+	}
+
+	return devices, rows.Err()
+}
+
+const pgBlockDataQuery = `SELECT	block_data.id,
+				block_data.tenant_id,
+				block_data.size,
+				block_data.state,
+				block_data.create_time,
+				block_data.name,
+				block_data.description
+		  FROM	block_data `
+
+func (ds *postgresDB) getTenantDevices(tenantID string) (map[string]types.BlockData, error) {
+	return ds.queryBlockData(pgBlockDataQuery+"WHERE block_data.tenant_id = $1", tenantID)
+}
+
+func (ds *postgresDB) getAllBlockData() (map[string]types.BlockData, error) {
+	devices, err := ds.queryBlockData(pgBlockDataQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+func (ds *postgresDB) createBlockData(data types.BlockData) error {
+	return ds.create("block_data", data.ID, data.TenantID, data.Size, string(data.State), data.CreateTime, data.Name, data.Description)
+}
+
+// For now we only support updating the state.
+func (ds *postgresDB) updateBlockData(data types.BlockData) error {
+	_, err := ds.db.Exec("UPDATE block_data SET state = $1 WHERE id = $2", string(data.State), data.ID)
+	return err
+}
+
+func (ds *postgresDB) deleteBlockData(ID string) error {
+	_, err := ds.db.Exec("DELETE FROM block_data WHERE id = $1", ID)
+	return err
+}
+
+func (ds *postgresDB) createStorageAttachment(a types.StorageAttachment) error {
+	return ds.create("attachments", a.ID, a.InstanceID, a.BlockID, boolToInt(a.Boot))
+}
+
+func (ds *postgresDB) getAllStorageAttachments() (map[string]types.StorageAttachment, error) {
+	attachments := make(map[string]types.StorageAttachment)
+
+	query := `SELECT	attachments.id,
+				attachments.instance_id,
+				attachments.block_id,
+				attachments.boot
+		  FROM	attachments`
+
+	rows, err := ds.db.Query(query)
+	if err != nil {
+		return attachments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a types.StorageAttachment
+
+		var boot int
+
+		err = rows.Scan(&a.ID, &a.InstanceID, &a.BlockID, &boot)
+		if err != nil {
+			continue
+		}
+		a.Boot = boot != 0
+		attachments[a.ID] = a
+	}
+
+	return attachments, rows.Err()
+}
+
+func (ds *postgresDB) deleteStorageAttachment(ID string) error {
+	_, err := ds.db.Exec("DELETE FROM attachments WHERE id = $1", ID)
+	return err
+}
+
+func (ds *postgresDB) getAllPublicIPs() (map[string]types.PublicIP, error) {
+	ips := make(map[string]types.PublicIP)
+
+	query := `SELECT	public_ips.id,
+				public_ips.address,
+				public_ips.pool,
+				public_ips.tenant_id,
+				public_ips.instance_id,
+				public_ips.assigned
+		  FROM	public_ips`
+
+	rows, err := ds.db.Query(query)
+	if err != nil {
+		return ips, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ip types.PublicIP
+
+		err = rows.Scan(&ip.ID, &ip.Address, &ip.Pool, &ip.TenantID, &ip.InstanceID, &ip.Assigned)
+		if err != nil {
+			continue
+		}
+		ips[ip.ID] = ip
+	}
+
+	return ips, rows.Err()
+}
+
+func (ds *postgresDB) createPublicIP(ip types.PublicIP) error {
+	_, err := ds.db.Exec("INSERT INTO public_ips VALUES ($1, $2, $3, $4, $5, $6)",
+		ip.ID, ip.Address, ip.Pool, ip.TenantID, ip.InstanceID, ip.Assigned)
+	return err
+}
+
+func (ds *postgresDB) updatePublicIP(ip types.PublicIP) error {
+	_, err := ds.db.Exec("UPDATE public_ips SET tenant_id = $1, instance_id = $2, assigned = $3 WHERE id = $4",
+		ip.TenantID, ip.InstanceID, ip.Assigned, ip.ID)
+	return err
+}
+
+func (ds *postgresDB) deletePublicIP(ID string) error {
+	_, err := ds.db.Exec("DELETE FROM public_ips WHERE id = $1", ID)
+	return err
+}
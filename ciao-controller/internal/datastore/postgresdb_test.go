@@ -0,0 +1,555 @@
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/01org/ciao/ciao-controller/types"
+	"github.com/01org/ciao/ciao-storage"
+	"github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/ssntp/uuid"
+)
+
+// The tests in this file need a PostgreSQL server.  TestMain starts a
+// throwaway server when the PostgreSQL initdb and pg_ctl tools are
+// available, unless the -postgres_uri flag is given, e.g.,
+//
+// go test -args -postgres_uri postgres://ciao@localhost/ciao_test?sslmode=disable
+//
+// They are skipped otherwise.
+
+// testPostgresURI is the URI of the database the postgres tests use.
+var testPostgresURI string
+
+// startTestPostgres initialises a new database cluster in a temporary
+// directory and starts a PostgreSQL server, only listening on a unix
+// socket in that directory.  It returns the URI of the server's postgres
+// database and a function which stops the server and removes the cluster.
+func startTestPostgres() (string, func(), error) {
+	initdb, err := exec.LookPath("initdb")
+	if err != nil {
+		return "", nil, err
+	}
+
+	pgctl, err := exec.LookPath("pg_ctl")
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "ciao-postgres-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	data := path.Join(dir, "data")
+	out, err := exec.Command(initdb, "-D", data, "-U", "ciao", "-A", "trust").CombinedOutput()
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb failed: %v: %s", err, out)
+	}
+
+	const port = 5432
+	opts := fmt.Sprintf("-c listen_addresses='' -k %s -p %d", dir, port)
+	out, err = exec.Command(pgctl, "-D", data, "-o", opts, "-l", path.Join(dir, "log"),
+		"-w", "start").CombinedOutput()
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start failed: %v: %s", err, out)
+	}
+
+	stop := func() {
+		_ = exec.Command(pgctl, "-D", data, "-m", "immediate", "-w", "stop").Run()
+		_ = os.RemoveAll(dir)
+	}
+
+	uri := fmt.Sprintf("postgres://ciao@localhost:%d/postgres?host=%s&sslmode=disable", port, dir)
+
+	return uri, stop, nil
+}
+
+func getTestPostgresStore(t *testing.T) persistentStore {
+	if testPostgresURI == "" {
+		t.Skip("-postgres_uri not specified and no PostgreSQL server could be started")
+	}
+
+	config := Config{
+		PersistentURI:     testPostgresURI,
+		InitTablesPath:    *tablesInitPath,
+		InitWorkloadsPath: *workloadsPath,
+	}
+
+	db, err := getPersistentStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := db.(*postgresDB); !ok {
+		t.Fatalf("Expected a postgres store, got %T", db)
+	}
+
+	return db
+}
+
+func TestIsPostgresURI(t *testing.T) {
+	tests := []struct {
+		URI      string
+		postgres bool
+	}{
+		{"postgres://ciao@localhost/ciao", true},
+		{"postgresql://ciao@localhost/ciao?sslmode=disable", true},
+		{"./ciao-controller.db", false},
+		{"file:memdb1?mode=memory&cache=shared", false},
+		{"/var/lib/postgres.db", false},
+	}
+
+	for _, test := range tests {
+		if isPostgresURI(test.URI) != test.postgres {
+			t.Errorf("isPostgresURI(%q) != %v", test.URI, test.postgres)
+		}
+	}
+}
+
+func TestPostgresWorkloads(t *testing.T) {
+	db := getTestPostgresStore(t)
+	defer db.disconnect()
+
+	ID, err := db.getCNCIWorkloadID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wl, err := db.getWorkloadNoCache(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wl.ID != ID || len(wl.Defaults) == 0 {
+		t.Fatalf("Incorrect CNCI workload %+v", wl)
+	}
+
+	wls, err := db.getWorkloadsNoCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, w := range wls {
+		if w.ID == ID {
+			t.Fatal("Internal workload returned")
+		}
+	}
+}
+
+func TestPostgresGetTenantWithStorage(t *testing.T) {
+	db := getTestPostgresStore(t)
+	defer db.disconnect()
+
+	tenantID := uuid.Generate().String()
+
+	err := db.addTenant(tenantID, "validmac")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := types.BlockData{
+		BlockDevice: storage.BlockDevice{ID: uuid.Generate().String()},
+		Size:        0,
+		State:       types.Available,
+		TenantID:    tenantID,
+		CreateTime:  time.Now(),
+	}
+
+	err = db.createBlockData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenant, err := db.getTenantNoCache(tenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tenant == nil || tenant.CNCIMAC != "validmac" {
+		t.Fatalf("Incorrect tenant %+v", tenant)
+	}
+
+	if tenant.devices[data.ID].ID != data.ID {
+		t.Fatal("device not correct")
+	}
+
+	data.State = types.InUse
+	err = db.updateBlockData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devices, err := db.getAllBlockData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if devices[data.ID].State != types.InUse {
+		t.Fatal("block device not updated")
+	}
+
+	err = db.deleteBlockData(data.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devices, err = db.getTenantDevices(tenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := devices[data.ID]; ok {
+		t.Fatal("block device not deleted")
+	}
+}
+
+func TestPostgresStorageAttachments(t *testing.T) {
+	db := getTestPostgresStore(t)
+	defer db.disconnect()
+
+	a := types.StorageAttachment{
+		ID:         uuid.Generate().String(),
+		InstanceID: uuid.Generate().String(),
+		BlockID:    uuid.Generate().String(),
+	}
+
+	err := db.createStorageAttachment(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attachments, err := db.getAllStorageAttachments()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attachments[a.ID] != a {
+		t.Fatal("attachment not found")
+	}
+
+	err = db.deleteStorageAttachment(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attachments, err = db.getAllStorageAttachments()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := attachments[a.ID]; ok {
+		t.Fatal("attachment not deleted")
+	}
+}
+
+func TestPostgresInstances(t *testing.T) {
+	db := getTestPostgresStore(t)
+	defer db.disconnect()
+
+	workloadID, err := db.getCNCIWorkloadID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance := &types.Instance{
+		ID:         uuid.Generate().String(),
+		TenantID:   uuid.Generate().String(),
+		WorkloadID: workloadID,
+		MACAddress: "02:00:00:00:00:01",
+		IPAddress:  "172.16.0.2",
+		CreateTime: time.Now(),
+		Usage:      map[string]int{"vcpus": 2, "mem_mb": 256},
+	}
+
+	err = db.addTenant(instance.TenantID, "validmac")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.addInstance(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.claimTenantIP(instance.TenantID, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenant, err := db.getTenantNoCache(instance.TenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tenant.network[1][2] || tenant.instances[instance.ID] == nil {
+		t.Fatalf("Incorrect tenant %+v", tenant)
+	}
+
+	err = db.releaseTenantIP(instance.TenantID, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance.Usage = map[string]int{"vcpus": 4, "mem_mb": 512}
+	err = db.updateInstance(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeID := uuid.Generate().String()
+	stats := []payloads.InstanceStat{
+		{
+			InstanceUUID: instance.ID,
+			State:        payloads.ComputeStatusRunning,
+			SSHIP:        "192.168.0.1",
+			SSHPort:      34567,
+		},
+	}
+
+	err = db.addInstanceStatsDB(stats, nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := db.getInstances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found *types.Instance
+	for _, i := range instances {
+		if i.ID == instance.ID {
+			found = i
+		}
+	}
+
+	if found == nil || found.State != payloads.ComputeStatusRunning ||
+		found.NodeID != nodeID || found.SSHPort != 34567 {
+		t.Fatalf("Incorrect instance %+v", found)
+	}
+
+	summary, err := db.getNodeSummary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nodeSummary *types.NodeSummary
+	for _, s := range summary {
+		if s.NodeID == nodeID {
+			nodeSummary = s
+		}
+	}
+
+	if nodeSummary == nil || nodeSummary.TotalInstances != 1 ||
+		nodeSummary.TotalRunningInstances != 1 {
+		t.Fatalf("Incorrect node summary %+v", nodeSummary)
+	}
+
+	err = db.removeInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenant, err = db.getTenantNoCache(instance.TenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tenant.instances) != 0 {
+		t.Fatal("instance not removed")
+	}
+}
+
+func TestPostgresFrameStatistics(t *testing.T) {
+	db := getTestPostgresStore(t)
+	defer db.disconnect()
+
+	label := uuid.Generate().String()
+	start := time.Now()
+
+	stat := payloads.FrameTrace{
+		Label:          label,
+		Type:           "type",
+		Operand:        "operand",
+		StartTimestamp: start.Format(time.RFC3339Nano),
+		EndTimestamp:   start.Add(time.Second).Format(time.RFC3339Nano),
+		Nodes: []payloads.SSNTPNode{
+			{
+				SSNTPUUID:   uuid.Generate().String(),
+				SSNTPRole:   "test",
+				TxTimestamp: start.Format(time.RFC3339Nano),
+			},
+		},
+	}
+
+	err := db.addFrameStat(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.getBatchFrameStatistics(label)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats) != 1 || stats[0].NumInstances != 1 || stats[0].TotalElapsed != 1 {
+		t.Fatalf("Incorrect frame statistics %+v", stats)
+	}
+}
+
+func getTestPostgresDatastore(t *testing.T) *Datastore {
+	if testPostgresURI == "" {
+		t.Skip("-postgres_uri not specified and no PostgreSQL server could be started")
+	}
+
+	config := Config{
+		PersistentURI:     testPostgresURI,
+		InitTablesPath:    *tablesInitPath,
+		InitWorkloadsPath: *workloadsPath,
+	}
+
+	d := new(Datastore)
+	err := d.Init(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+// TestPostgresSharedDatastore checks that two controllers sharing the
+// same database see each other's tenants, instances and IPs.
+func TestPostgresSharedDatastore(t *testing.T) {
+	ds1 := getTestPostgresDatastore(t)
+	defer ds1.Exit()
+
+	ds2 := getTestPostgresDatastore(t)
+	defer ds2.Exit()
+
+	tenantID := uuid.Generate().String()
+	_, err := ds1.AddTenant(tenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenants, err := ds2.GetAllTenants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, tt := range tenants {
+		found = found || tt.ID == tenantID
+	}
+	if !found {
+		t.Fatal("tenant added by the first controller not found")
+	}
+
+	ip1, err := ds1.AllocateTenantIP(tenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip2, err := ds2.AllocateTenantIP(tenantID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ip1.Equal(ip2) {
+		t.Fatalf("%s allocated by both controllers", ip1)
+	}
+
+	wls, err := ds1.GetWorkloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wls) == 0 {
+		t.Fatal("No Workloads Found")
+	}
+
+	usage := make(map[string]int)
+	for _, r := range wls[0].Defaults {
+		usage[string(r.Type)] = r.Value
+	}
+
+	instance := &types.Instance{
+		ID:         uuid.Generate().String(),
+		TenantID:   tenantID,
+		WorkloadID: wls[0].ID,
+		State:      payloads.Pending,
+		IPAddress:  ip1.String(),
+		MACAddress: "02:00:ac:10:00:02",
+		Usage:      usage,
+		CreateTime: time.Now(),
+	}
+
+	err = ds1.AddInstance(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds2.GetInstance(instance.ID)
+	if err != nil {
+		t.Fatalf("instance added by the first controller not found: %v", err)
+	}
+
+	pool := "shared-" + tenantID
+	address := fmt.Sprintf("10.%d.%d.%d", ip1.To4()[1], ip1.To4()[2], ip2.To4()[3])
+	_, err = ds1.AddPublicIPs(pool, []string{address})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicIP, err := ds2.AllocatePublicIP(tenantID, pool)
+	if err != nil {
+		t.Fatalf("public IP added by the first controller not allocated: %v", err)
+	}
+
+	_, err = ds1.AllocatePublicIP(tenantID, pool)
+	if err != ErrNoFreePublicIP {
+		t.Errorf("expected %v, got %v", ErrNoFreePublicIP, err)
+	}
+
+	err = ds2.DeleteInstance(instance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ds1.GetInstance(instance.ID)
+	if err == nil {
+		t.Error("instance deleted by the second controller found")
+	}
+
+	err = ds1.ReleasePublicIP(publicIP.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds2.DeletePublicIPs([]string{address})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -54,8 +54,16 @@ type persistentData interface {
 	DB() *sql.DB
 }
 
+// sqlStore is implemented by the sql backed persistent stores so that
+// the table types defined in this file can be shared between them.
+type sqlStore interface {
+	exec(db *sql.DB, cmd string) error
+	create(tableName string, record ...interface{}) error
+	tablesPath() string
+}
+
 type namedData struct {
-	ds   *sqliteDB
+	ds   sqlStore
 	name string
 	db   *sql.DB
 }
@@ -78,7 +86,7 @@ func (d namedData) DB() *sql.DB {
 }
 
 func (d namedData) ReadCsv() ([][]string, error) {
-	f, err := os.Open(fmt.Sprintf("%s/%s.csv", d.ds.tableInitPath, d.name))
+	f, err := os.Open(fmt.Sprintf("%s/%s.csv", d.ds.tablesPath(), d.name))
 	if err != nil {
 		return nil, err
 	}
@@ -219,10 +227,69 @@ func (d attachments) Init() error {
 		id string primary key,
 		instance_id string,
 		block_id string,
+		boot int default 0,
 		foreign key(instance_id) references instances(id),
 		foreign key(block_id) references block_data(id)
 		);`
 
+	err := d.ds.exec(d.db, cmd)
+	if err != nil {
+		return err
+	}
+
+	// databases created before boot volumes were recorded lack
+	// the boot column.
+	return addSqliteColumn(d.db, d.name, "boot", "int default 0")
+}
+
+// addSqliteColumn adds a column to an existing table if it does not have
+// it yet.
+func addSqliteColumn(db *sql.DB, table string, column string, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+
+		err = rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk)
+		if err != nil {
+			return err
+		}
+
+		if name == column {
+			return nil
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// Public IP pool
+type publicIPData struct {
+	namedData
+}
+
+func (d publicIPData) Init() error {
+	cmd := `CREATE TABLE IF NOT EXISTS public_ips
+		(
+		id string primary key,
+		address string unique,
+		pool string,
+		tenant_id string,
+		instance_id string,
+		assigned int
+		);`
+
 	return d.ds.exec(d.db, cmd)
 }
 
@@ -279,10 +346,31 @@ type resourceData struct {
 	namedData
 }
 
+// builtinResources are the resources the controller relies on.  They are
+// added to the resources table on every start, along with the resources of
+// the resources table csv, so that databases created by older controllers,
+// and deployments whose table csv predate a resource, get them too.
+var builtinResources = []struct {
+	id   int
+	name string
+}{
+	{1, "instances"},
+	{2, "vcpus"},
+	{3, "mem_mb"},
+	{4, "disk_mb"},
+	{5, "network_node"},
+	{6, "volumes"},
+	{7, "cpu_shares"},
+	{8, "cpu_quota"},
+	{9, "mem_limit_mb"},
+	{10, "disk_iops"},
+	{11, "disk_mbps"},
+}
+
 func (d resourceData) Populate() error {
 	lines, err := d.ReadCsv()
 	if err != nil {
-		return err
+		glog.V(2).Info("could not read resources: ", err)
 	}
 
 	for _, line := range lines {
@@ -294,6 +382,13 @@ func (d resourceData) Populate() error {
 		}
 	}
 
+	for _, r := range builtinResources {
+		err = d.ds.create(d.name, r.id, r.name)
+		if err != nil {
+			glog.V(2).Info("could not add resource: ", err)
+		}
+	}
+
 	return err
 }
 
@@ -456,6 +551,22 @@ func (d workloadTemplateData) Init() error {
 	return d.ds.exec(d.db, cmd)
 }
 
+// workload configurations added through the API
+type workloadConfigData struct {
+	namedData
+}
+
+func (d workloadConfigData) Init() error {
+	cmd := `CREATE TABLE IF NOT EXISTS workload_configs
+		(
+		workload_id varchar(32) primary key,
+		config text,
+		foreign key(workload_id) references workload_template(id)
+		);`
+
+	return d.ds.exec(d.db, cmd)
+}
+
 // statistics
 type nodeStatisticsData struct {
 	namedData
@@ -585,6 +696,10 @@ func (ds *sqliteDB) create(tableName string, record ...interface{}) error {
 	return ds.exec(db, cmd)
 }
 
+func (ds *sqliteDB) tablesPath() string {
+	return ds.tableInitPath
+}
+
 func (ds *sqliteDB) getTableDB(name string) *sql.DB {
 	for _, table := range ds.tables {
 		n := table.Name()
@@ -595,11 +710,11 @@ func (ds *sqliteDB) getTableDB(name string) *sql.DB {
 	return nil
 }
 
-// Init initializes the private data for the database object.
+// getSqliteStore initializes the private data for the database object.
 // The sql tables are populated with initial data from csv
 // files if this is the first time the database has been
-// created.  The datastore caches are also filled.
-func getPersistentStore(config Config) (persistentStore, error) {
+// created.
+func getSqliteStore(config Config) (persistentStore, error) {
 	var ds = &sqliteDB{}
 
 	err := ds.Connect(config.PersistentURI, config.TransientURI)
@@ -617,6 +732,7 @@ func getPersistentStore(config Config) (persistentStore, error) {
 		instanceData{namedData{ds: ds, name: "instances", db: ds.db}},
 		workloadTemplateData{namedData{ds: ds, name: "workload_template", db: ds.db}},
 		workloadResourceData{namedData{ds: ds, name: "workload_resources", db: ds.db}},
+		workloadConfigData{namedData{ds: ds, name: "workload_configs", db: ds.db}},
 		usageData{namedData{ds: ds, name: "usage", db: ds.db}},
 		nodeStatisticsData{namedData{ds: ds, name: "node_statistics", db: ds.tdb}},
 		logData{namedData{ds: ds, name: "log", db: ds.tdb}},
@@ -627,6 +743,7 @@ func getPersistentStore(config Config) (persistentStore, error) {
 		blockData{namedData{ds: ds, name: "block_data", db: ds.db}},
 		attachments{namedData{ds: ds, name: "attachments", db: ds.db}},
 		workloadStorage{namedData{ds: ds, name: "workload_storage", db: ds.db}},
+		publicIPData{namedData{ds: ds, name: "public_ips", db: ds.db}},
 	}
 
 	ds.tableInitPath = config.InitTablesPath
@@ -784,7 +901,17 @@ func (ds *sqliteDB) getConfigNoCache(ID string) (string, error) {
 
 	db := ds.getTableDB("workload_template")
 
-	err := db.QueryRow("SELECT filename FROM workload_template where id = ?", ID).Scan(&configFile)
+	// workloads created through the API store their configuration
+	// in the database rather than in workloadsPath.
+	var config string
+	err := db.QueryRow("SELECT config FROM workload_configs WHERE workload_id = ?", ID).Scan(&config)
+	if err == nil {
+		return config, nil
+	} else if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	err = db.QueryRow("SELECT filename FROM workload_template where id = ?", ID).Scan(&configFile)
 
 	if err != nil {
 		return "", err
@@ -796,7 +923,7 @@ func (ds *sqliteDB) getConfigNoCache(ID string) (string, error) {
 		return "", err
 	}
 
-	config := string(bytes)
+	config = string(bytes)
 
 	return config, nil
 }
@@ -864,8 +991,37 @@ func (ds *sqliteDB) getWorkloadStorage(ID string) (*types.StorageResource, error
 }
 
 func (ds *sqliteDB) addLimit(tenantID string, resourceID int, limit int) error {
+	datastore := ds.getTableDB("limits")
+
 	ds.dbLock.Lock()
-	err := ds.create("limits", resourceID, tenantID, limit)
+	defer ds.dbLock.Unlock()
+
+	tx, err := datastore.Begin()
+	if err != nil {
+		return err
+	}
+
+	// limits has no unique key so replace any existing limit by hand
+	_, err = tx.Exec("DELETE FROM limits WHERE tenant_id = ? AND resource_id = ?", tenantID, resourceID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO limits VALUES (?, ?, ?)", resourceID, tenantID, limit)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *sqliteDB) deleteLimit(tenantID string, resourceID int) error {
+	datastore := ds.getTableDB("limits")
+
+	ds.dbLock.Lock()
+	_, err := datastore.Exec("DELETE FROM limits WHERE tenant_id = ? AND resource_id = ?", tenantID, resourceID)
 	ds.dbLock.Unlock()
 
 	return err
@@ -881,13 +1037,19 @@ func (ds *sqliteDB) getTenantResources(ID string) ([]*types.Resource, error) {
 			 WHERE instances.tenant_id = ?
 		 )
 		 SELECT resources.name, resources.id, limits.max_value,
-		 CASE resources.id
-		 WHEN resources.id = 1 then
+		 CASE
+		 WHEN resources.id = 1 THEN
 		 (
 			 SELECT COUNT(instances.id)
 			 FROM instances
 			 WHERE instances.tenant_id = ?
 		 )
+		 WHEN resources.name = 'volumes' THEN
+		 (
+			 SELECT COUNT(block_data.id)
+			 FROM block_data
+			 WHERE block_data.tenant_id = ?
+		 )
 		 ELSE SUM(instances_usage.value)
 		 END
 		 FROM resources
@@ -900,7 +1062,7 @@ func (ds *sqliteDB) getTenantResources(ID string) ([]*types.Resource, error) {
 
 	datastore := ds.db
 
-	rows, err := datastore.Query(query, ID, ID, ID)
+	rows, err := datastore.Query(query, ID, ID, ID, ID)
 	if err != nil {
 		glog.Warning("Failed to get tenant usage")
 		return nil, err
@@ -1102,6 +1264,147 @@ func (ds *sqliteDB) getWorkloadsNoCache() ([]*workload, error) {
 	return workloads, nil
 }
 
+// boolToInt converts the flags of a workload to the integers stored
+// in the workload tables.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (ds *sqliteDB) insertWorkloadData(tx *sql.Tx, wl *workload) error {
+	for _, r := range wl.Defaults {
+		res, err := tx.Exec(`INSERT INTO workload_resources
+				     SELECT ?, id, ?, ?, ? FROM resources WHERE name = ?`,
+			wl.ID, r.Value, r.Value, boolToInt(r.Mandatory), string(r.Type))
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return fmt.Errorf("Unknown resource %q", r.Type)
+		}
+	}
+
+	if wl.Storage != nil {
+		s := wl.Storage
+		_, err := tx.Exec("INSERT INTO workload_storage VALUES (?, ?, ?, ?, ?, ?, ?)",
+			wl.ID, s.ID, boolToInt(s.Bootable), boolToInt(s.Persistent), s.Size, string(s.SourceType), s.SourceID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec("INSERT INTO workload_configs VALUES (?, ?)", wl.ID, wl.Config)
+
+	return err
+}
+
+func (ds *sqliteDB) deleteWorkloadData(tx *sql.Tx, ID string) error {
+	for _, table := range []string{"workload_resources", "workload_storage", "workload_configs"} {
+		_, err := tx.Exec("DELETE FROM "+table+" WHERE workload_id = ?", ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ds *sqliteDB) addWorkload(wl *workload) error {
+	datastore := ds.getTableDB("workload_template")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	tx, err := datastore.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO workload_template VALUES (?, ?, ?, ?, ?, ?, ?, 0)",
+		wl.ID, wl.Description, wl.filename, wl.FWType, string(wl.VMType), wl.ImageID, wl.ImageName)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = ds.insertWorkloadData(tx, wl)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *sqliteDB) updateWorkload(wl *workload) error {
+	datastore := ds.getTableDB("workload_template")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	tx, err := datastore.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE workload_template
+			  SET description = ?, fw_type = ?, vm_type = ?, image_id = ?, image_name = ?
+			  WHERE id = ?`,
+		wl.Description, wl.FWType, string(wl.VMType), wl.ImageID, wl.ImageName, wl.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = ds.deleteWorkloadData(tx, wl.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = ds.insertWorkloadData(tx, wl)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ds *sqliteDB) deleteWorkload(ID string) error {
+	datastore := ds.getTableDB("workload_template")
+
+	ds.dbLock.Lock()
+	defer ds.dbLock.Unlock()
+
+	tx, err := datastore.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = ds.deleteWorkloadData(tx, ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM workload_template WHERE id = ?", ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (ds *sqliteDB) updateTenant(t *tenant) error {
 	db := ds.getTableDB("tenants")
 
@@ -1556,6 +1859,44 @@ func (ds *sqliteDB) removeInstance(instanceID string) error {
 	return err
 }
 
+// updateInstance stores the workload and resource usage of an existing
+// instance, which change when the instance is resized.
+func (ds *sqliteDB) updateInstance(instance *types.Instance) error {
+	datastore := ds.getTableDB("instances")
+
+	ds.dbLock.Lock()
+
+	tx, err := datastore.Begin()
+	if err != nil {
+		ds.dbLock.Unlock()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE instances SET workload_id = ? WHERE id = ?", instance.WorkloadID, instance.ID)
+	if err != nil {
+		tx.Rollback()
+		ds.dbLock.Unlock()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM usage WHERE instance_id = ?", instance.ID)
+	if err != nil {
+		tx.Rollback()
+		ds.dbLock.Unlock()
+		return err
+	}
+
+	err = tx.Commit()
+
+	ds.dbLock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return ds.addUsage(instance.ID, instance.Usage)
+}
+
 func (ds *sqliteDB) addUsage(instanceID string, usage map[string]int) error {
 	datastore := ds.getTableDB("usage")
 
@@ -2305,7 +2646,7 @@ func (ds *sqliteDB) deleteBlockData(ID string) error {
 
 func (ds *sqliteDB) createStorageAttachment(a types.StorageAttachment) error {
 	ds.dbLock.Lock()
-	err := ds.create("attachments", a.ID, a.InstanceID, a.BlockID)
+	err := ds.create("attachments", a.ID, a.InstanceID, a.BlockID, boolToInt(a.Boot))
 	ds.dbLock.Unlock()
 	return err
 }
@@ -2317,7 +2658,8 @@ func (ds *sqliteDB) getAllStorageAttachments() (map[string]types.StorageAttachme
 
 	query := `SELECT	attachments.id,
 				attachments.instance_id,
-				attachments.block_id
+				attachments.block_id,
+				attachments.boot
 		  FROM	attachments `
 
 	rows, err := datastore.Query(query)
@@ -2329,10 +2671,13 @@ func (ds *sqliteDB) getAllStorageAttachments() (map[string]types.StorageAttachme
 	for rows.Next() {
 		var a types.StorageAttachment
 
-		err = rows.Scan(&a.ID, &a.InstanceID, &a.BlockID)
+		var boot int
+
+		err = rows.Scan(&a.ID, &a.InstanceID, &a.BlockID, &boot)
 		if err != nil {
 			continue
 		}
+		a.Boot = boot != 0
 		attachments[a.ID] = a
 	}
 
@@ -2365,3 +2710,77 @@ func (ds *sqliteDB) deleteStorageAttachment(ID string) error {
 
 	return err
 }
+
+func (ds *sqliteDB) getAllPublicIPs() (map[string]types.PublicIP, error) {
+	ips := make(map[string]types.PublicIP)
+
+	datastore := ds.getTableDB("public_ips")
+
+	query := `SELECT	public_ips.id,
+				public_ips.address,
+				public_ips.pool,
+				public_ips.tenant_id,
+				public_ips.instance_id,
+				public_ips.assigned
+		  FROM	public_ips`
+
+	rows, err := datastore.Query(query)
+	if err != nil {
+		return ips, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ip types.PublicIP
+
+		err = rows.Scan(&ip.ID, &ip.Address, &ip.Pool, &ip.TenantID, &ip.InstanceID, &ip.Assigned)
+		if err != nil {
+			continue
+		}
+		ips[ip.ID] = ip
+	}
+
+	if err = rows.Err(); err != nil {
+		return ips, err
+	}
+
+	return ips, nil
+}
+
+func (ds *sqliteDB) createPublicIP(ip types.PublicIP) error {
+	datastore := ds.getTableDB("public_ips")
+
+	ds.dbLock.Lock()
+	_, err := datastore.Exec("INSERT INTO public_ips VALUES (?, ?, ?, ?, ?, ?)",
+		ip.ID, ip.Address, ip.Pool, ip.TenantID, ip.InstanceID, ip.Assigned)
+	ds.dbLock.Unlock()
+
+	return err
+}
+
+func (ds *sqliteDB) updatePublicIP(ip types.PublicIP) error {
+	datastore := ds.getTableDB("public_ips")
+
+	ds.dbLock.Lock()
+	_, err := datastore.Exec("UPDATE public_ips SET tenant_id = ?, instance_id = ?, assigned = ? WHERE id = ?",
+		ip.TenantID, ip.InstanceID, ip.Assigned, ip.ID)
+	ds.dbLock.Unlock()
+
+	return err
+}
+
+func (ds *sqliteDB) deletePublicIP(ID string) error {
+	datastore := ds.getTableDB("public_ips")
+
+	ds.dbLock.Lock()
+	_, err := datastore.Exec("DELETE FROM public_ips WHERE id = ?", ID)
+	ds.dbLock.Unlock()
+
+	return err
+}
+
+// getCacheChanges returns nil as a sqlite3 database is only used by a
+// single controller, which caches are therefore always up to date.
+func (ds *sqliteDB) getCacheChanges() (map[string]int64, error) {
+	return nil, nil
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/01org/ciao/ciao-controller/types"
 	"github.com/01org/ciao/ciao-storage"
+	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp/uuid"
 )
 
@@ -259,3 +260,137 @@ func TestGetAllStorageAttachments(t *testing.T) {
 
 	db.disconnect()
 }
+
+func TestPublicIPData(t *testing.T) {
+	config := Config{
+		PersistentURI: "file:PublicIPData1?mode=memory&cache=shared",
+		TransientURI:  "file:PublicIPData2?mode=memory&cache=shared",
+	}
+
+	db, err := getPersistentStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip := types.PublicIP{
+		ID:      uuid.Generate().String(),
+		Address: "203.0.113.10",
+		Pool:    "public",
+	}
+
+	err = db.createPublicIP(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip.TenantID = uuid.Generate().String()
+	ip.InstanceID = uuid.Generate().String()
+	ip.Assigned = true
+
+	err = db.updatePublicIP(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ips, err := db.getAllPublicIPs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ips[ip.ID] != ip {
+		t.Fatalf("expected public IP %v, got %v", ip, ips[ip.ID])
+	}
+
+	err = db.deletePublicIP(ip.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ips, err = db.getAllPublicIPs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ips) != 0 {
+		t.Fatal("public IP not deleted")
+	}
+
+	db.disconnect()
+}
+
+func TestAddWorkloadUnknownResource(t *testing.T) {
+	config := Config{
+		PersistentURI: "file:WorkloadData1?mode=memory&cache=shared",
+		TransientURI:  "file:WorkloadData2?mode=memory&cache=shared",
+	}
+
+	db, err := getPersistentStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wl := &workload{
+		Workload: types.Workload{
+			ID:          uuid.Generate().String(),
+			Description: "test workload",
+			VMType:      payloads.QEMU,
+			Defaults: []payloads.RequestedResource{
+				{Type: "unknown", Value: 1},
+			},
+		},
+	}
+
+	err = db.addWorkload(wl)
+	if err == nil {
+		t.Fatal("workload with unknown resource added")
+	}
+
+	// the workload template must not have been added either
+	_, err = db.getWorkloadNoCache(wl.ID)
+	if err == nil {
+		t.Fatal("workload template not rolled back")
+	}
+
+	wl.Defaults = nil
+
+	err = db.addWorkload(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.deleteWorkload(wl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.disconnect()
+}
+
+func TestBuiltinResources(t *testing.T) {
+	config := Config{
+		PersistentURI: "file:BuiltinResources1?mode=memory&cache=shared",
+		TransientURI:  "file:BuiltinResources2?mode=memory&cache=shared",
+	}
+
+	// No InitTablesPath, so there are no resources to read from csv
+	db, err := getPersistentStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.disconnect()
+
+	ds := db.(*sqliteDB)
+
+	for _, r := range builtinResources {
+		var name string
+
+		err = ds.db.QueryRow("SELECT name FROM resources WHERE id = ?", r.id).Scan(&name)
+		if err != nil {
+			t.Fatalf("resource %d not found: %v", r.id, err)
+		}
+
+		if name != r.name {
+			t.Fatalf("expected resource %d to be %s, got %s", r.id, r.name, name)
+		}
+	}
+}
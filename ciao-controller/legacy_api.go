@@ -21,6 +21,7 @@
 // @SubApi Tenants API [/v2.1/tenants]
 // @SubApi CNCIs API [/v2.1/cncis]
 // @SubApi Traces API [/v2.1/traces]
+// @SubApi Workloads API [/v2.1/workloads]
 
 package main
 
@@ -245,6 +246,54 @@ func legacyTraceData(c *controller, w http.ResponseWriter, r *http.Request) (API
 	return traceData(c, w, r)
 }
 
+// @Title legacyCreateWorkload
+// @Description Creates a new workload.
+// @Accept  json
+// @Success 201 {object} types.CiaoWorkloadDetail "Returns the definition of the new workload."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/workloads [post]
+// @Resource /v2.1/workloads
+func legacyCreateWorkload(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	return createWorkload(c, w, r)
+}
+
+// @Title legacyShowWorkload
+// @Description Shows the definition of a workload.
+// @Accept  json
+// @Success 200 {object} types.CiaoWorkloadDetail "Returns the definition of the workload, including its configuration."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/workloads/{workload} [get]
+// @Resource /v2.1/workloads
+func legacyShowWorkload(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	return showWorkload(c, w, r)
+}
+
+// @Title legacyUpdateWorkload
+// @Description Replaces the definition of a workload.
+// @Accept  json
+// @Success 200 {object} types.CiaoWorkloadDetail "Returns the new definition of the workload."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/workloads/{workload} [put]
+// @Resource /v2.1/workloads
+func legacyUpdateWorkload(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	return updateWorkload(c, w, r)
+}
+
+// @Title legacyDeleteWorkload
+// @Description Deletes a workload which has no instances.
+// @Accept  json
+// @Success 202 {object} string "This operation does not return a response body, returns the 202 StatusAccepted code."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/workloads/{workload} [delete]
+// @Resource /v2.1/workloads
+func legacyDeleteWorkload(c *controller, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	return deleteWorkload(c, w, r)
+}
+
 // @Title listServerDetailsFlavors
 // @Description Lists all servers with details for a particular flavor.
 // @Accept  json
@@ -308,5 +357,14 @@ func legacyComputeRoutes(ctl *controller, r *mux.Router) *mux.Router {
 	r.Handle("/v2.1/traces/{label}",
 		legacyAPIHandler{ctl, legacyTraceData}).Methods("GET")
 
+	r.Handle("/v2.1/workloads",
+		legacyAPIHandler{ctl, legacyCreateWorkload}).Methods("POST")
+	r.Handle("/v2.1/workloads/{workload}",
+		legacyAPIHandler{ctl, legacyShowWorkload}).Methods("GET")
+	r.Handle("/v2.1/workloads/{workload}",
+		legacyAPIHandler{ctl, legacyUpdateWorkload}).Methods("PUT")
+	r.Handle("/v2.1/workloads/{workload}",
+		legacyAPIHandler{ctl, legacyDeleteWorkload}).Methods("DELETE")
+
 	return r
 }
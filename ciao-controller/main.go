@@ -56,6 +56,7 @@ var cert = flag.String("cert", "", "Client certificate")
 var caCert = flag.String("cacert", "", "CA certificate")
 var serverURL = flag.String("url", "", "Server URL")
 var identityURL = "identity:35357"
+var imageServiceURL = ""
 var serviceUser = "csr"
 var servicePassword = ""
 var volumeAPIPort = block.APIPort
@@ -66,7 +67,7 @@ var httpsKey = "/etc/pki/ciao/ciao-controller-key.pem"
 var tablesInitPath = flag.String("tables_init_path", "./tables", "path to csv files")
 var workloadsPath = flag.String("workloads_path", "./workloads", "path to yaml files")
 var noNetwork = flag.Bool("nonetwork", false, "Debug with no networking")
-var persistentDatastoreLocation = flag.String("database_path", "./ciao-controller.db", "path to persistent database")
+var persistentDatastoreLocation = flag.String("database_path", "./ciao-controller.db", "path to persistent database, or a postgres:// URI")
 var transientDatastoreLocation = flag.String("stats_path", "/tmp/ciao-controller-stats.db", "path to stats database")
 var logDir = "/var/lib/ciao/logs/controller"
 
@@ -140,6 +141,7 @@ func main() {
 	httpsCAcert = clusterConfig.Configure.Controller.HTTPSCACert
 	httpsKey = clusterConfig.Configure.Controller.HTTPSKey
 	identityURL = clusterConfig.Configure.IdentityService.URL
+	imageServiceURL = clusterConfig.Configure.ImageService.URL
 	serviceUser = clusterConfig.Configure.Controller.IdentityUser
 	servicePassword = clusterConfig.Configure.Controller.IdentityPassword
 	if *cephID == "" {
@@ -155,6 +157,7 @@ func main() {
 		volumeURL := "https://" + hostname + ":" + strconv.Itoa(volumeAPIPort)
 		imageURL := "https://" + hostname + ":" + strconv.Itoa(imageAPIPort)
 		computeURL := "https://" + hostname + ":" + strconv.Itoa(computeAPIPort)
+		imageServiceURL = imageURL
 		testIdentityConfig := testutil.IdentityConfig{
 			VolumeURL:  volumeURL,
 			ImageURL:   imageURL,
@@ -15,15 +15,20 @@
 package main
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"sort"
 
+	"github.com/01org/ciao/ciao-controller/internal/datastore"
 	"github.com/01org/ciao/ciao-controller/types"
 	"github.com/01org/ciao/openstack/compute"
 	osIdentity "github.com/01org/ciao/openstack/identity"
+	osimage "github.com/01org/ciao/openstack/image"
 	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 )
 
@@ -46,6 +51,16 @@ func instanceToServer(ctl *controller, instance *types.Instance) (compute.Server
 
 	imageID := workload.ImageID
 
+	status := instance.State
+	resize, err := ctl.ds.GetInstanceResize(instance.ID)
+	if err == nil {
+		if resize.Migrating || status == payloads.ComputeStatusPending {
+			status = types.InstanceStatusResize
+		} else {
+			status = types.InstanceStatusVerifyResize
+		}
+	}
+
 	server := compute.ServerDetails{
 		HostID:   instance.NodeID,
 		ID:       instance.ID,
@@ -56,7 +71,7 @@ func instanceToServer(ctl *controller, instance *types.Instance) (compute.Server
 		Image: compute.Image{
 			ID: imageID,
 		},
-		Status: instance.State,
+		Status: status,
 		Addresses: compute.Addresses{
 			Private: []compute.PrivateAddresses{
 				{
@@ -71,6 +86,14 @@ func instanceToServer(ctl *controller, instance *types.Instance) (compute.Server
 		Created: instance.CreateTime,
 	}
 
+	if instance.PublicIP != "" {
+		server.Addresses.Private = append(server.Addresses.Private,
+			compute.PrivateAddresses{
+				Addr:         instance.PublicIP,
+				OSEXTIPSType: "floating",
+			})
+	}
+
 	return server, nil
 }
 
@@ -235,6 +258,127 @@ func (c *controller) StopServer(tenant string, ID string) error {
 	return err
 }
 
+func (c *controller) CreateServerImage(tenant string, ID string, req compute.CreateImageRequest) (compute.CreateImageResponse, error) {
+	var resp compute.CreateImageResponse
+
+	i, err := c.ds.GetInstance(ID)
+	if err != nil {
+		return resp, err
+	}
+
+	if i.TenantID != tenant {
+		return resp, compute.ErrServerOwner
+	}
+
+	if i.NodeID == "" || i.State == payloads.ComputeStatusPending {
+		return resp, compute.ErrInstanceNotAvailable
+	}
+
+	imageID, err := c.createServiceImage(req.CreateImage.Name, tenant)
+	if err != nil {
+		return resp, err
+	}
+
+	token, err := c.createImageToken(imageID, osimage.UploadScope)
+	if err == nil {
+		err = c.client.createImage(ID, i.NodeID, imageID, imageServiceURL, token)
+	}
+	if err != nil {
+		dsErr := c.deleteServiceImage(imageID)
+		if dsErr != nil {
+			glog.Error(dsErr)
+		}
+		return resp, err
+	}
+
+	resp.ImageID = imageID
+	return resp, nil
+}
+
+func (c *controller) GetServerConsoleOutput(tenant string, ID string, req compute.GetConsoleOutputRequest) (compute.GetConsoleOutputResponse, error) {
+	var resp compute.GetConsoleOutputResponse
+
+	i, err := c.ds.GetInstance(ID)
+	if err != nil {
+		return resp, err
+	}
+
+	if i.TenantID != tenant {
+		return resp, compute.ErrServerOwner
+	}
+
+	if i.NodeID == "" || i.State == payloads.ComputeStatusPending {
+		return resp, compute.ErrInstanceNotAvailable
+	}
+
+	lines := 0
+	if req.GetConsoleOutput.Length != nil && *req.GetConsoleOutput.Length > 0 {
+		lines = *req.GetConsoleOutput.Length
+	}
+
+	resp.Output, err = c.client.getConsole(ID, i.NodeID, lines)
+	return resp, err
+}
+
+// resizeError maps the errors returned when resizing an instance to the
+// errors of the compute API.
+func resizeError(err error) error {
+	switch err {
+	case types.ErrInstanceNotAssigned, types.ErrInstanceNotStopped,
+		datastore.ErrResizeInProgress:
+		return compute.ErrInstanceNotAvailable
+	case types.ErrInvalidResize:
+		return compute.ErrInvalidFlavor
+	case types.ErrNoCapacity:
+		return compute.ErrNoCapacity
+	case types.ErrQuota:
+		return compute.ErrQuota
+	case datastore.ErrNoResize:
+		return compute.ErrServerNotResizing
+	}
+
+	return err
+}
+
+func (c *controller) ResizeServer(tenant string, ID string, req compute.ResizeServerRequest) error {
+	i, err := c.ds.GetInstance(ID)
+	if err != nil {
+		return compute.ErrServerNotFound
+	}
+
+	if i.TenantID != tenant {
+		return compute.ErrServerOwner
+	}
+
+	return resizeError(c.resizeInstance(ID, req.Resize.FlavorRef))
+}
+
+func (c *controller) ConfirmResizeServer(tenant string, ID string) error {
+	i, err := c.ds.GetInstance(ID)
+	if err != nil {
+		return compute.ErrServerNotFound
+	}
+
+	if i.TenantID != tenant {
+		return compute.ErrServerOwner
+	}
+
+	return resizeError(c.confirmResize(ID))
+}
+
+func (c *controller) RevertResizeServer(tenant string, ID string) error {
+	i, err := c.ds.GetInstance(ID)
+	if err != nil {
+		return compute.ErrServerNotFound
+	}
+
+	if i.TenantID != tenant {
+		return compute.ErrServerOwner
+	}
+
+	return resizeError(c.revertResize(ID))
+}
+
 func (c *controller) ListFlavors(tenant string) (compute.Flavors, error) {
 	flavors := compute.NewComputeFlavors()
 
@@ -323,6 +467,381 @@ func (c *controller) ShowFlavorDetails(tenant string, flavorID string) (compute.
 	return flavor, nil
 }
 
+// defaultPublicIPPool is the pool floating IPs are added to when no pool
+// is specified.
+const defaultPublicIPPool = "public"
+
+func publicIPToFloatingIP(ctl *controller, ip types.PublicIP) compute.FloatingIPDetails {
+	details := compute.FloatingIPDetails{
+		ID:   ip.ID,
+		IP:   ip.Address,
+		Pool: ip.Pool,
+	}
+
+	if ip.InstanceID != "" {
+		instanceID := ip.InstanceID
+		details.InstanceID = &instanceID
+
+		instance, err := ctl.ds.GetInstance(ip.InstanceID)
+		if err == nil {
+			fixedIP := instance.IPAddress
+			details.FixedIP = &fixedIP
+		}
+	}
+
+	return details
+}
+
+func floatingIPError(err error) error {
+	switch err {
+	case datastore.ErrNoPublicIP:
+		return compute.ErrFloatingIPNotFound
+	case datastore.ErrNoFreePublicIP:
+		return compute.ErrNoFreeFloatingIP
+	case datastore.ErrPublicIPInUse:
+		return compute.ErrFloatingIPInUse
+	case datastore.ErrPublicIPNotMapped:
+		return compute.ErrFloatingIPNotMapped
+	case datastore.ErrDuplicatePublicIP:
+		return compute.ErrFloatingIPExists
+	}
+
+	return err
+}
+
+// getTenantPublicIP returns the public IP identified by ID, making sure
+// it is allocated to tenant.
+func (c *controller) getTenantPublicIP(tenant string, ID string) (types.PublicIP, error) {
+	ip, err := c.ds.GetPublicIP(ID)
+	if err != nil {
+		return ip, floatingIPError(err)
+	}
+
+	if ip.TenantID != tenant {
+		return ip, compute.ErrFloatingIPOwner
+	}
+
+	return ip, nil
+}
+
+// getServerPublicIP returns the public IP holding address and the server
+// it is to be mapped to, making sure both belong to tenant.
+func (c *controller) getServerPublicIP(tenant string, server string, address string) (types.PublicIP, error) {
+	i, err := c.ds.GetInstance(server)
+	if err != nil {
+		return types.PublicIP{}, compute.ErrServerNotFound
+	}
+
+	if i.TenantID != tenant {
+		return types.PublicIP{}, compute.ErrServerOwner
+	}
+
+	ip, err := c.ds.GetPublicIPByAddress(address)
+	if err != nil {
+		return ip, floatingIPError(err)
+	}
+
+	if ip.TenantID != tenant {
+		return ip, compute.ErrFloatingIPOwner
+	}
+
+	return ip, nil
+}
+
+func (c *controller) ListFloatingIPs(tenant string) (compute.FloatingIPs, error) {
+	ips := compute.NewFloatingIPs()
+
+	publicIPs, err := c.ds.GetTenantPublicIPs(tenant)
+	if err != nil {
+		return ips, err
+	}
+
+	sort.Sort(types.SortedPublicIPsByAddress(publicIPs))
+
+	for _, ip := range publicIPs {
+		ips.FloatingIPs = append(ips.FloatingIPs, publicIPToFloatingIP(c, ip))
+	}
+
+	return ips, nil
+}
+
+func (c *controller) CreateFloatingIP(tenant string, req compute.CreateFloatingIPRequest) (compute.FloatingIP, error) {
+	var ip compute.FloatingIP
+
+	publicIP, err := c.ds.AllocatePublicIP(tenant, req.Pool)
+	if err != nil {
+		return ip, floatingIPError(err)
+	}
+
+	ip.FloatingIP = publicIPToFloatingIP(c, publicIP)
+
+	return ip, nil
+}
+
+func (c *controller) ShowFloatingIP(tenant string, ID string) (compute.FloatingIP, error) {
+	var ip compute.FloatingIP
+
+	publicIP, err := c.getTenantPublicIP(tenant, ID)
+	if err != nil {
+		return ip, err
+	}
+
+	ip.FloatingIP = publicIPToFloatingIP(c, publicIP)
+
+	return ip, nil
+}
+
+func (c *controller) DeleteFloatingIP(tenant string, ID string) error {
+	ip, err := c.getTenantPublicIP(tenant, ID)
+	if err != nil {
+		return err
+	}
+
+	// a floating IP still associated to a server is disassociated first.
+	if ip.InstanceID != "" {
+		err = c.unmapPublicIP(ID)
+		if err != nil {
+			return floatingIPError(err)
+		}
+	}
+
+	return floatingIPError(c.ds.ReleasePublicIP(ID))
+}
+
+func (c *controller) AddFloatingIP(tenant string, server string, req compute.AddFloatingIPRequest) error {
+	ip, err := c.getServerPublicIP(tenant, server, req.AddFloatingIP.Address)
+	if err != nil {
+		return err
+	}
+
+	return floatingIPError(c.mapPublicIP(ip.ID, server))
+}
+
+func (c *controller) RemoveFloatingIP(tenant string, server string, req compute.RemoveFloatingIPRequest) error {
+	ip, err := c.getServerPublicIP(tenant, server, req.RemoveFloatingIP.Address)
+	if err != nil {
+		return err
+	}
+
+	if ip.InstanceID != server {
+		return compute.ErrFloatingIPNotMapped
+	}
+
+	return floatingIPError(c.unmapPublicIP(ip.ID))
+}
+
+func (c *controller) ListFloatingIPPools(tenant string) (compute.FloatingIPPools, error) {
+	pools := compute.NewFloatingIPPools()
+
+	ips, err := c.ds.GetPublicIPs()
+	if err != nil {
+		return pools, err
+	}
+
+	names := make(map[string]bool)
+	for _, ip := range ips {
+		names[ip.Pool] = true
+	}
+
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		pools.FloatingIPPools = append(pools.FloatingIPPools,
+			compute.FloatingIPPool{Name: name})
+	}
+
+	return pools, nil
+}
+
+func (c *controller) ListFloatingIPsBulk() (compute.FloatingIPsBulk, error) {
+	ips := compute.NewFloatingIPsBulk()
+
+	publicIPs, err := c.ds.GetPublicIPs()
+	if err != nil {
+		return ips, err
+	}
+
+	sort.Sort(types.SortedPublicIPsByAddress(publicIPs))
+
+	for _, ip := range publicIPs {
+		floatingIP := publicIPToFloatingIP(c, ip)
+
+		details := compute.FloatingIPBulkDetails{
+			Address:      ip.Address,
+			FixedIP:      floatingIP.FixedIP,
+			InstanceUUID: floatingIP.InstanceID,
+			Pool:         ip.Pool,
+		}
+
+		if ip.TenantID != "" {
+			tenantID := ip.TenantID
+			details.ProjectID = &tenantID
+		}
+
+		ips.FloatingIPInfo = append(ips.FloatingIPInfo, details)
+	}
+
+	return ips, nil
+}
+
+// maxIPRangeSize is the largest number of addresses that can be added to
+// or removed from the public IP pool at once.
+const maxIPRangeSize = 65536
+
+// ipRangeAddresses returns the addresses of an IP range, which is either
+// a single IPv4 address or an IPv4 CIDR range.  The network and broadcast
+// addresses of CIDR ranges are not part of the range.
+func ipRangeAddresses(ipRange string) ([]string, error) {
+	if ip := net.ParseIP(ipRange); ip != nil && ip.To4() != nil {
+		return []string{ip.To4().String()}, nil
+	}
+
+	ip, ipNet, err := net.ParseCIDR(ipRange)
+	if err != nil || ip.To4() == nil {
+		return nil, compute.ErrInvalidIPRange
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	size := 1 << uint(bits-ones)
+	if size > maxIPRangeSize {
+		return nil, compute.ErrInvalidIPRange
+	}
+
+	first := binary.BigEndian.Uint32(ipNet.IP.To4())
+	last := first + uint32(size) - 1
+	if size > 2 {
+		first++
+		last--
+	}
+
+	// the counter is wider than an address so that it does not wrap
+	// at the end of the address space.
+	var addresses []string
+	for n := uint64(first); n <= uint64(last); n++ {
+		address := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(address, uint32(n))
+		addresses = append(addresses, address.String())
+	}
+
+	return addresses, nil
+}
+
+func (c *controller) CreateFloatingIPsBulk(req compute.CreateFloatingIPsBulkRequest) (compute.CreateFloatingIPsBulkRequest, error) {
+	addresses, err := ipRangeAddresses(req.FloatingIPsBulkCreate.IPRange)
+	if err != nil {
+		return req, err
+	}
+
+	if req.FloatingIPsBulkCreate.Pool == "" {
+		req.FloatingIPsBulkCreate.Pool = defaultPublicIPPool
+	}
+
+	_, err = c.ds.AddPublicIPs(req.FloatingIPsBulkCreate.Pool, addresses)
+	if err != nil {
+		return req, floatingIPError(err)
+	}
+
+	return req, nil
+}
+
+func (c *controller) DeleteFloatingIPsBulk(req compute.DeleteFloatingIPsBulkRequest) (compute.DeleteFloatingIPsBulkResponse, error) {
+	var resp compute.DeleteFloatingIPsBulkResponse
+
+	addresses, err := ipRangeAddresses(req.IPRange)
+	if err != nil {
+		return resp, err
+	}
+
+	err = c.ds.DeletePublicIPs(addresses)
+	if err != nil {
+		return resp, floatingIPError(err)
+	}
+
+	resp.FloatingIPsBulkDelete = req.IPRange
+
+	return resp, nil
+}
+
+func (c *controller) ShowQuotaSet(tenant string) (compute.QuotaSetDetail, error) {
+	q := compute.QuotaSetDetail{ID: tenant}
+
+	err := c.confirmTenant(tenant)
+	if err != nil {
+		return q, err
+	}
+
+	details := []struct {
+		resource int
+		detail   *compute.QuotaDetail
+	}{
+		{instances, &q.Instances},
+		{vcpu, &q.Cores},
+		{memory, &q.RAM},
+		{disk, &q.Disk},
+	}
+
+	for _, d := range details {
+		r, err := c.getTenantResource(tenant, d.resource)
+		if err != nil {
+			return q, err
+		}
+
+		*d.detail = compute.QuotaDetail{InUse: r.Usage, Limit: r.Limit}
+	}
+
+	return q, nil
+}
+
+func (c *controller) UpdateQuotaSet(tenant string, req compute.QuotaSetUpdate) (compute.QuotaSetDetail, error) {
+	err := c.confirmTenant(tenant)
+	if err != nil {
+		return compute.QuotaSetDetail{}, err
+	}
+
+	limits := []struct {
+		resource int
+		limit    *int
+	}{
+		{instances, req.Instances},
+		{vcpu, req.Cores},
+		{memory, req.RAM},
+		{disk, req.Disk},
+	}
+
+	for _, l := range limits {
+		if l.limit == nil {
+			continue
+		}
+
+		err = c.setTenantLimit(tenant, l.resource, *l.limit)
+		if err != nil {
+			return compute.QuotaSetDetail{}, err
+		}
+	}
+
+	return c.ShowQuotaSet(tenant)
+}
+
+func (c *controller) DeleteQuotaSet(tenant string) error {
+	err := c.confirmTenant(tenant)
+	if err != nil {
+		return err
+	}
+
+	for _, resource := range []int{instances, vcpu, memory, disk} {
+		err = c.ds.DeleteLimit(tenant, resource)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Start will get the Compute API endpoints from the OpenStack compute api,
 // then wrap them in keystone validation. It will then start the https
 // service.
@@ -36,7 +36,15 @@ func (c *controller) GetAbsoluteLimits(tenant string) (block.AbsoluteLimits, err
 		return block.AbsoluteLimits{}, err
 	}
 
-	return block.AbsoluteLimits{}, nil
+	r, err := c.getTenantResource(tenant, volumes)
+	if err != nil {
+		return block.AbsoluteLimits{}, err
+	}
+
+	return block.AbsoluteLimits{
+		MaxTotalVolumes:  r.Limit,
+		TotalVolumesUsed: r.Usage,
+	}, nil
 }
 
 // CreateVolume will create a new block device and store it in the datastore.
@@ -46,9 +54,17 @@ func (c *controller) CreateVolume(tenant string, req block.RequestedVolume) (blo
 		return block.Volume{}, err
 	}
 
+	r, err := c.getTenantResource(tenant, volumes)
+	if err != nil {
+		return block.Volume{}, err
+	}
+
+	if r.OverLimit(1) {
+		return block.Volume{}, block.ErrQuota
+	}
+
 	var bd storage.BlockDevice
 
-	// no limits checking for now.
 	if req.ImageRef != nil {
 		// create bootable volume
 		bd, err = c.CreateBlockDevice(req.ImageRef, req.Size)
@@ -382,6 +398,52 @@ func (c *controller) ShowVolumeDetails(tenant string, volume string) (block.Volu
 	return vol, nil
 }
 
+// ShowVolumeQuotaSet returns the volumes quota of a tenant.
+func (c *controller) ShowVolumeQuotaSet(tenant string) (block.QuotaSetDetail, error) {
+	q := block.QuotaSetDetail{ID: tenant}
+
+	err := c.confirmTenant(tenant)
+	if err != nil {
+		return q, err
+	}
+
+	r, err := c.getTenantResource(tenant, volumes)
+	if err != nil {
+		return q, err
+	}
+
+	q.Volumes = block.QuotaDetail{InUse: r.Usage, Limit: r.Limit}
+
+	return q, nil
+}
+
+// UpdateVolumeQuotaSet changes the volumes quota of a tenant.
+func (c *controller) UpdateVolumeQuotaSet(tenant string, req block.QuotaSetUpdate) (block.QuotaSetDetail, error) {
+	err := c.confirmTenant(tenant)
+	if err != nil {
+		return block.QuotaSetDetail{}, err
+	}
+
+	if req.Volumes != nil {
+		err = c.setTenantLimit(tenant, volumes, *req.Volumes)
+		if err != nil {
+			return block.QuotaSetDetail{}, err
+		}
+	}
+
+	return c.ShowVolumeQuotaSet(tenant)
+}
+
+// DeleteVolumeQuotaSet resets the volumes quota of a tenant to unlimited.
+func (c *controller) DeleteVolumeQuotaSet(tenant string) error {
+	err := c.confirmTenant(tenant)
+	if err != nil {
+		return err
+	}
+
+	return c.ds.DeleteLimit(tenant, volumes)
+}
+
 // Start will get the Volume API endpoints from the OpenStack block api,
 // then wrap them in keystone validation. It will then start the https
 // service.
@@ -91,12 +91,38 @@ type Instance struct {
 	IPAddress   string              `json:"ip_address"`
 	SSHIP       string              `json:"ssh_ip"`
 	SSHPort     int                 `json:"ssh_port"`
+	PublicIP    string              `json:"public_ip"`
 	CNCI        bool                `json:"-"`
 	Usage       map[string]int      `json:"-"`
 	Attachments []StorageAttachment `json:"-"`
 	CreateTime  time.Time           `json:"-"`
 }
 
+// Statuses reported for instances that are being resized.  They replace the
+// state reported by the node until the resize is confirmed or reverted.
+const (
+	// InstanceStatusResize is the status of an instance that is being
+	// moved to another node as part of a resize.
+	InstanceStatusResize = "resize"
+
+	// InstanceStatusVerifyResize is the status of a resized instance whose
+	// resize has not yet been confirmed or reverted.
+	InstanceStatusVerifyResize = "verify_resize"
+)
+
+// InstanceResize records the workload and resource usage an instance had
+// before it was resized, so that the resize can be reverted.
+type InstanceResize struct {
+	InstanceID    string
+	OldWorkloadID string
+	OldUsage      map[string]int
+
+	// Migrating is true while the instance is being moved to another
+	// node as the node it was running on lacked the capacity for the
+	// new workload.
+	Migrating bool
+}
+
 // SortedInstancesByID implements sort.Interface for Instance by ID string
 type SortedInstancesByID []*Instance
 
@@ -104,6 +130,13 @@ func (s SortedInstancesByID) Len() int           { return len(s) }
 func (s SortedInstancesByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s SortedInstancesByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
 
+// SortedPublicIPsByAddress implements sort.Interface for PublicIP by Address string
+type SortedPublicIPsByAddress []PublicIP
+
+func (s SortedPublicIPsByAddress) Len() int           { return len(s) }
+func (s SortedPublicIPsByAddress) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s SortedPublicIPsByAddress) Less(i, j int) bool { return s[i].Address < s[j].Address }
+
 // SortedComputeNodesByID implements sort.Interface for Node by ID string
 type SortedComputeNodesByID []CiaoComputeNode
 
@@ -130,8 +163,9 @@ type Resource struct {
 }
 
 // OverLimit calculates whether a request will put a tenant over it's limit.
+// A negative limit means the resource is unlimited.
 func (r *Resource) OverLimit(request int) bool {
-	if r.Limit > 0 && r.Usage+request > r.Limit {
+	if r.Limit >= 0 && r.Usage+request > r.Limit {
 		return true
 	}
 	return false
@@ -251,6 +285,19 @@ type StorageAttachment struct {
 	ID         string // a uuid
 	InstanceID string // the instance this volume is attached to
 	BlockID    string // the ID of the block device
+	Boot       bool   // true if the instance boots from the block device
+}
+
+// PublicIP represents an address of the public IP pool.  Addresses are
+// allocated to a tenant and can then be mapped to one of its instances
+// by the tenant CNCI.
+type PublicIP struct {
+	ID         string // a uuid
+	Address    string // the public IP address
+	Pool       string // the pool the address belongs to
+	TenantID   string // the tenant the address is allocated to, if any
+	InstanceID string // the instance the address is mapped to, if any
+	Assigned   bool   // true once the CNCI has mapped the address
 }
 
 // CiaoComputeTenants represents the unmarshalled version of the contents of a
@@ -432,6 +479,44 @@ type CiaoServersAction struct {
 	ServerIDs []string `json:"servers"`
 }
 
+// CiaoWorkloadResource contains the default value of a resource
+// requested by the instances of a workload.
+type CiaoWorkloadResource struct {
+	Type      string `json:"type"`
+	Value     int    `json:"value"`
+	Mandatory bool   `json:"mandatory"`
+}
+
+// CiaoWorkloadStorage contains the storage definition of a workload.
+type CiaoWorkloadStorage struct {
+	ID         string `json:"id,omitempty"`
+	Bootable   bool   `json:"bootable"`
+	Persistent bool   `json:"persistent"`
+	Size       int    `json:"size"`
+	SourceType string `json:"source_type"`
+	SourceID   string `json:"source_id,omitempty"`
+}
+
+// CiaoWorkload contains information about an individual workload.
+type CiaoWorkload struct {
+	ID          string                 `json:"id"`
+	Description string                 `json:"description"`
+	FWType      string                 `json:"fw_type"`
+	VMType      string                 `json:"vm_type"`
+	ImageID     string                 `json:"image_id"`
+	ImageName   string                 `json:"image_name"`
+	Config      string                 `json:"config"`
+	Defaults    []CiaoWorkloadResource `json:"defaults"`
+	Storage     *CiaoWorkloadStorage   `json:"storage,omitempty"`
+}
+
+// CiaoWorkloadDetail represents the unmarshalled version of the contents of a
+// v2.1/workloads request or of a v2.1/workloads/{workload} request or
+// response.  It contains the definition of a workload.
+type CiaoWorkloadDetail struct {
+	Workload CiaoWorkload `json:"workload"`
+}
+
 // CiaoTraceSummary contains information about a specific SSNTP Trace label.
 type CiaoTraceSummary struct {
 	Label     string `json:"label"`
@@ -511,4 +596,13 @@ var (
 
 	// ErrInstanceNotAssigned is returned when an instance is not assigned to a node.
 	ErrInstanceNotAssigned = errors.New("Cannot perform operation: instance not assigned to Node")
+
+	// ErrInstanceNotStopped is returned when an operation requires a stopped instance.
+	ErrInstanceNotStopped = errors.New("Cannot perform operation: instance is not stopped")
+
+	// ErrInvalidResize is returned when an instance cannot be resized to a workload.
+	ErrInvalidResize = errors.New("Instance cannot be resized to this workload")
+
+	// ErrNoCapacity is returned when no node can host a resized instance.
+	ErrNoCapacity = errors.New("No node has the capacity for the resized instance")
 )
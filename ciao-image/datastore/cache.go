@@ -16,13 +16,22 @@ package datastore
 
 import (
 	"io"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/01org/ciao/openstack/image"
+	"github.com/01org/ciao/ssntp/uuid"
+	"github.com/golang/glog"
 )
 
 // ImageCache is an image metadata cache.
 type ImageCache struct {
+	// ConvertTo is the type uploaded images are converted to, with
+	// qemu-img.  Images are stored as uploaded when it is empty.
+	// ISO images are never converted.
+	ConvertTo Type
+
 	images map[string]Image
 	lock   *sync.RWMutex
 	metaDs MetaDataStore
@@ -30,20 +39,152 @@ type ImageCache struct {
 }
 
 // Init initializes the datastore struct and must be called before anything.
+// The images known to the metadata store are loaded and reconciled with the
+// image data found in the raw data store.
 func (c *ImageCache) Init(rawDs RawDataStore, metaDs MetaDataStore) error {
 	c.images = make(map[string]Image)
 	c.lock = &sync.RWMutex{}
 	c.metaDs = metaDs
 	c.rawDs = rawDs
 
+	images, err := metaDs.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, i := range images {
+		c.images[i.ID] = i
+	}
+
+	return c.reconcile()
+}
+
+// reconcile makes the image metadata consistent with the raw data store.
+// Uploads interrupted by a restart and active images whose data is missing
+// or truncated go back to the Created state, so that they can be uploaded
+// again.  Image data with no metadata, left behind by an image service that
+// could not persist its metadata, is adopted as a private active image that
+// only admins can see, so that they can inspect it before publishing or
+// deleting it.
+func (c *ImageCache) reconcile() error {
+	if c.rawDs == nil {
+		return nil
+	}
+
+	IDs, err := c.rawDs.List()
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[string]bool)
+	for _, ID := range IDs {
+		stored[ID] = true
+	}
+
+	for ID, img := range c.images {
+		if img.State == Created || img.State == Killed {
+			continue
+		}
+
+		if img.State == Active && stored[ID] {
+			size, err := c.rawDs.GetImageSize(ID)
+			if err == nil && size == img.Size {
+				continue
+			}
+		}
+
+		glog.Warningf("Image %s has no valid data, resetting it", ID)
+
+		if stored[ID] {
+			err = c.rawDs.Delete(ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		img.State = Created
+		img.Size = 0
+		img.CheckSum = ""
+		img.SHA256 = ""
+
+		err = c.metaDs.Write(img)
+		if err != nil {
+			return err
+		}
+
+		c.images[ID] = img
+	}
+
+	for _, ID := range IDs {
+		if _, ok := c.images[ID]; ok {
+			continue
+		}
+
+		if _, err := uuid.Parse(ID); err != nil {
+			continue
+		}
+
+		img, err := c.adoptImage(ID)
+		if err != nil {
+			return err
+		}
+
+		glog.Infof("Adopted image %s with no metadata", ID)
+
+		c.images[ID] = img
+	}
+
 	return nil
 }
 
+// adoptImage creates and stores the metadata of an image for which only the
+// raw data is available.  Its owner is not known so the image has no tenant
+// and is private.
+func (c *ImageCache) adoptImage(ID string) (Image, error) {
+	data, err := c.rawDs.Read(ID)
+	if err != nil {
+		return Image{}, err
+	}
+	defer func() { _ = data.Close() }()
+
+	r, imgType, err := sniff(data)
+	if err != nil {
+		return Image{}, err
+	}
+
+	h := newImageHash()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return Image{}, err
+	}
+
+	img := Image{
+		ID:         ID,
+		State:      Active,
+		Type:       imgType,
+		Visibility: image.Private,
+		CreateTime: time.Now(),
+	}
+	h.set(&img)
+
+	err = c.metaDs.Write(img)
+	if err != nil {
+		return Image{}, err
+	}
+
+	return img, nil
+}
+
 // CreateImage will add an image to the datastore.
 func (c *ImageCache) CreateImage(i Image) error {
 	defer c.lock.Unlock()
 	c.lock.Lock()
 
+	err := c.metaDs.Write(i)
+	if err != nil {
+		return err
+	}
+
 	c.images[i.ID] = i
 
 	return nil
@@ -77,20 +218,29 @@ func (c *ImageCache) GetImage(ID string) (Image, error) {
 	return i, nil
 }
 
-// UpdateImage will modify an existing image.
+// UpdateImage will modify the metadata of an existing image.
+// The state, size and checksum of the image are owned by UploadImage
+// and are not modified.
 func (c *ImageCache) UpdateImage(i Image) error {
 	defer c.lock.Unlock()
 	c.lock.Lock()
 
-	_, ok := c.images[i.ID]
-	if ok {
-		c.images[i.ID] = i
-	}
-
+	img, ok := c.images[i.ID]
 	if !ok {
 		return image.ErrNoImage
 	}
 
+	i.State = img.State
+	i.Size = img.Size
+	i.CheckSum = img.CheckSum
+
+	err := c.metaDs.Write(i)
+	if err != nil {
+		return err
+	}
+
+	c.images[i.ID] = i
+
 	return nil
 }
 
@@ -99,23 +249,42 @@ func (c *ImageCache) DeleteImage(ID string) error {
 	defer c.lock.Unlock()
 	c.lock.Lock()
 
-	_, ok := c.images[ID]
-	if ok {
-		delete(c.images, ID)
+	img, ok := c.images[ID]
+	if !ok {
+		return image.ErrNoImage
+	}
+
+	if img.Protected {
+		return image.ErrImageProtected
+	}
+
+	if img.State == Saving {
+		return image.ErrImageSaving
+	}
+
+	// Created images have no data to delete, and killed images may
+	// have no data.
+	if img.State != Created && c.rawDs != nil {
 		err := c.rawDs.Delete(ID)
-		if err != nil {
+		if err != nil && img.State != Killed {
 			return err
 		}
 	}
 
-	if !ok {
-		return image.ErrNoImage
+	err := c.metaDs.Delete(ID)
+	if err != nil {
+		return err
 	}
 
+	delete(c.images, ID)
+
 	return nil
 }
 
 // UploadImage will read an image, save it and update the image cache.
+// The image data must match the image type, when it has been declared.
+// The data of active images cannot be replaced.  The image moves to the
+// Killed state if its data cannot be saved.
 func (c *ImageCache) UploadImage(ID string, body io.Reader) error {
 	c.lock.Lock()
 
@@ -130,22 +299,99 @@ func (c *ImageCache) UploadImage(ID string, body io.Reader) error {
 		return image.ErrImageSaving
 	}
 
+	if img.State == Active {
+		c.lock.Unlock()
+		return image.ErrImageActive
+	}
+
 	img.State = Saving
+	err := c.metaDs.Write(img)
+	if err != nil {
+		c.lock.Unlock()
+		return err
+	}
+	c.images[ID] = img
 
 	c.lock.Unlock()
 
-	if c.rawDs != nil {
-		_, err := c.rawDs.Write(ID, body)
+	imgType, h, err := c.storeImage(ID, img.Type, body)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// the image metadata may have been updated during the upload
+	img = c.images[ID]
+
+	if err != nil {
+		img.State = Killed
+		c.images[ID] = img
+		if mErr := c.metaDs.Write(img); mErr != nil {
+			glog.Warningf("Unable to update image %s metadata: %v", ID, mErr)
+		}
+		return err
+	}
+
+	img.State = Active
+	img.Type = imgType
+	h.set(&img)
+	c.images[ID] = img
+
+	return c.metaDs.Write(img)
+}
+
+// storeImage writes the image data read from body to the raw data store,
+// after checking that it matches the declared image type, and converting
+// it if needed.  The type and the sums of the stored data are returned.
+func (c *ImageCache) storeImage(ID string, declared Type, body io.Reader) (Type, *imageHash, error) {
+	data, imgType, err := sniff(body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if declared != "" && declared != imgType {
+		return "", nil, image.ErrBadImageData
+	}
+
+	if c.ConvertTo != "" && imgType != c.ConvertTo && imgType != ISO {
+		converted, err := convertImage(data, imgType, c.ConvertTo)
 		if err != nil {
-			return err
+			return "", nil, err
 		}
+		defer func() { _ = os.Remove(converted) }()
+
+		f, err := os.Open(converted)
+		if err != nil {
+			return "", nil, err
+		}
+		defer func() { _ = f.Close() }()
+
+		data = f
+		imgType = c.ConvertTo
 	}
 
-	c.lock.Lock()
+	h := newImageHash()
+	if c.rawDs != nil {
+		_, err = c.rawDs.Write(ID, io.TeeReader(data, h))
+	} else {
+		_, err = io.Copy(h, data)
+	}
 
-	img.State = Active
+	return imgType, h, err
+}
 
-	c.lock.Unlock()
+// DownloadImage returns a reader for the data of an uploaded image.
+func (c *ImageCache) DownloadImage(ID string) (io.ReadCloser, error) {
+	c.lock.RLock()
+	img, ok := c.images[ID]
+	c.lock.RUnlock()
 
-	return nil
+	if !ok {
+		return nil, image.ErrNoImage
+	}
+
+	if img.State != Active || c.rawDs == nil {
+		return nil, image.ErrNoImageData
+	}
+
+	return c.rawDs.Read(ID)
 }
@@ -0,0 +1,226 @@
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/01org/ciao/ciao-storage"
+	"github.com/01org/ciao/openstack/image"
+	"github.com/golang/glog"
+)
+
+// Ceph implements the RawDataStore interface on top of ceph rbd images.
+// The data of each image is imported as an rbd image named after the
+// image ID, with a protected storage.ImageSnapshot snapshot from which
+// storage.CephDriver clones the volumes created from the image.
+type Ceph struct {
+	// ID is the cephx user ID to use
+	ID string
+}
+
+func (c *Ceph) rbd(args ...string) *exec.Cmd {
+	if c.ID != "" {
+		args = append([]string{"--id", c.ID}, args...)
+	}
+
+	return exec.Command("rbd", args...)
+}
+
+// run runs an rbd command and returns its standard output.
+func (c *Ceph) run(args ...string) ([]byte, error) {
+	out, err := c.rbd(args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return nil, fmt.Errorf("rbd %s failed: %v: %s",
+			strings.Join(args, " "), err, exitErr.Stderr)
+	}
+
+	return out, err
+}
+
+// Write imports an image into ceph.
+// If the image already exists it will be overridden.  The volumes cloned
+// from the image are attached to instances as raw disks, so qcow2 images,
+// which must be converted to raw before they are written, are rejected.
+func (c *Ceph) Write(ID string, body io.Reader) (int64, error) {
+	data, imgType, err := sniff(body)
+	if err != nil {
+		return 0, err
+	}
+
+	if imgType == QCow {
+		return 0, image.ErrBadImageData
+	}
+
+	if _, err := c.run("info", ID); err == nil {
+		err = c.Delete(ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	cmd := c.rbd("--image-format", "2", "--image-feature", "layering",
+		"import", "-", ID)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1<<16)
+
+	size, err := io.CopyBuffer(stdin, data, buf)
+	_ = stdin.Close()
+	waitErr := cmd.Wait()
+	if err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		if _, infoErr := c.run("info", ID); infoErr == nil {
+			if _, rmErr := c.run("rm", ID); rmErr != nil {
+				glog.Warningf("Unable to remove partial rbd image %s: %v", ID, rmErr)
+			}
+		}
+		return 0, err
+	}
+
+	snapshot := ID + "@" + storage.ImageSnapshot
+
+	for _, op := range []string{"create", "protect"} {
+		_, err = c.run("snap", op, snapshot)
+		if err != nil {
+			if delErr := c.Delete(ID); delErr != nil {
+				glog.Warningf("Unable to remove rbd image %s: %v", ID, delErr)
+			}
+			return 0, err
+		}
+	}
+
+	return size, nil
+}
+
+type rbdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+// Close stops reading the image and waits for the rbd command to exit.
+func (r rbdReader) Close() error {
+	_ = r.ReadCloser.Close()
+	return r.cmd.Wait()
+}
+
+// Read exports an image from ceph for reading.
+func (c *Ceph) Read(ID string) (io.ReadCloser, error) {
+	snapshot := ID + "@" + storage.ImageSnapshot
+
+	_, err := c.run("info", snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := c.rbd("export", snapshot, "-")
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return rbdReader{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// Delete removes an image, and its snapshot, from ceph.
+// Images with volumes cloned from them cannot be removed.
+func (c *Ceph) Delete(ID string) error {
+	// the snapshot is missing if the image was not completely written.
+	snapshot := ID + "@" + storage.ImageSnapshot
+	if _, err := c.run("info", snapshot); err == nil {
+		_, err = c.run("snap", "unprotect", snapshot)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := c.run("snap", "purge", ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.run("rm", ID)
+
+	return err
+}
+
+// GetImageSize returns the size of an image stored in ceph.
+func (c *Ceph) GetImageSize(ID string) (int64, error) {
+	out, err := c.run("info", "--format", "json", ID)
+	if err != nil {
+		return 0, err
+	}
+
+	var info struct {
+		Size int64 `json:"size"`
+	}
+
+	err = json.Unmarshal(out, &info)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to parse output from rbd info: %v", err)
+	}
+
+	return info.Size, nil
+}
+
+// List returns the names of the rbd images holding image service images,
+// i.e. the ones with a storage.ImageSnapshot snapshot. Volumes stored in
+// the same pool are ignored.
+func (c *Ceph) List() ([]string, error) {
+	out, err := c.run("ls", "-l", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []struct {
+		Image    string `json:"image"`
+		Snapshot string `json:"snapshot"`
+	}
+
+	err = json.Unmarshal(out, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse output from rbd ls: %v", err)
+	}
+
+	var IDs []string
+	for _, e := range entries {
+		if e.Snapshot == storage.ImageSnapshot {
+			IDs = append(IDs, e.Image)
+		}
+	}
+
+	return IDs, nil
+}
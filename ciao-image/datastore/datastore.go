@@ -33,6 +33,9 @@ const (
 
 	// Active means that the image is created, uploaded and ready to use.
 	Active State = "active"
+
+	// Killed means that the upload of the image data failed.
+	Killed State = "killed"
 )
 
 // Status translate an image state to an openstack image status.
@@ -44,19 +47,13 @@ func (state State) Status() image.Status {
 		return image.Saving
 	case Active:
 		return image.Active
+	case Killed:
+		return image.Killed
 	}
 
 	return image.Active
 }
 
-// Visibility returns the image visibility
-func (i Image) Visibility() image.Visibility {
-	if i.TenantID == "" {
-		return image.Public
-	}
-	return image.Private
-}
-
 // Type represents the valid image types.
 type Type string
 
@@ -71,6 +68,13 @@ const (
 	ISO Type = "iso"
 )
 
+// Member is a tenant an image is shared with.
+type Member struct {
+	Status     image.MemberStatus
+	CreateTime time.Time
+	UpdateTime time.Time
+}
+
 // Image contains the information that ciao will store about the image
 type Image struct {
 	ID         string
@@ -79,6 +83,42 @@ type Image struct {
 	Name       string
 	CreateTime time.Time
 	Type       Type
+
+	// Visibility defines which tenants, besides the owner identified
+	// by TenantID, can see and use the image.
+	Visibility image.Visibility
+
+	// Members are the tenants a shared image is shared with, indexed
+	// by tenant ID.
+	Members map[string]Member
+
+	// Size is the size, in bytes, of the uploaded image data.
+	Size int64
+
+	// CheckSum is the hex encoded MD5 sum of the uploaded image data.
+	CheckSum string
+
+	// SHA256 is the hex encoded SHA256 sum of the uploaded image data.
+	SHA256 string
+
+	// UpdateTime is the time of the last update of the image metadata.
+	UpdateTime time.Time
+
+	// Tags are free form strings attached to the image.
+	Tags []string
+
+	// Properties are custom, free form, key value pairs.
+	Properties map[string]string
+
+	// MinDisk is the minimum disk size, in GB, required to boot the image.
+	MinDisk int
+
+	// MinRAM is the minimum amount of memory, in MB, required to boot
+	// the image.
+	MinRAM int
+
+	// Protected images cannot be deleted.
+	Protected bool
 }
 
 // DataStore is the image data storage interface.
@@ -90,6 +130,7 @@ type DataStore interface {
 	UpdateImage(Image) error
 	DeleteImage(string) error
 	UploadImage(string, io.Reader) error
+	DownloadImage(string) (io.ReadCloser, error)
 }
 
 // MetaDataStore is the metadata storing interface that's used by
@@ -104,5 +145,12 @@ type MetaDataStore interface {
 // image cache implementation.
 type RawDataStore interface {
 	Write(ID string, body io.Reader) (int64, error)
+	Read(ID string) (io.ReadCloser, error)
 	Delete(ID string) error
+
+	// GetImageSize returns the size, in bytes, of the stored image data.
+	GetImageSize(ID string) (int64, error)
+
+	// List returns the IDs of all the images with stored data.
+	List() ([]string, error)
 }
@@ -15,8 +15,18 @@
 package datastore
 
 import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/01org/ciao/openstack/image"
+	"github.com/01org/ciao/testutil"
 )
 
 func testCreateAndGet(t *testing.T, d RawDataStore, m MetaDataStore) {
@@ -123,6 +133,73 @@ func testUpload(t *testing.T, d RawDataStore, m MetaDataStore) {
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	// the data of an active image cannot be replaced
+	err = cache.UploadImage(i.ID, strings.NewReader("QFI\xfbUpload file"))
+	if err != image.ErrImageActive {
+		t.Fatalf("Expected %v, got %v", image.ErrImageActive, err)
+	}
+
+	img, err := cache.GetImage(i.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img.State != Active || img.Size != int64(len("Upload file")) {
+		t.Fatalf("Active image modified by upload %+v", img)
+	}
+}
+
+func testDownload(t *testing.T, d RawDataStore, m MetaDataStore) {
+	i := Image{
+		ID:    "validID",
+		State: Created,
+	}
+
+	cache := ImageCache{}
+	cache.Init(d, m)
+
+	// create the entry
+	err := cache.CreateImage(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing to download before uploading
+	_, err = cache.DownloadImage(i.ID)
+	if err == nil {
+		t.Fatal("Downloaded an image with no data")
+	}
+
+	err = cache.UploadImage(i.ID, strings.NewReader("Upload file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image, err := cache.GetImage(i.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if image.State != Active || image.Size != int64(len("Upload file")) ||
+		image.CheckSum != "ffeed24e8e4fd763c1d0d02c6e5d6e15" {
+		t.Fatalf("Wrong uploaded image %+v", image)
+	}
+
+	data, err := cache.DownloadImage(i.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "Upload file" {
+		t.Fatalf("Downloaded %s, expected Upload file", string(b))
+	}
 }
 
 var mountPoint = "/var/lib/ciao/images"
@@ -142,3 +219,478 @@ func TestPosixNoopDelete(t *testing.T) {
 func TestPosixNoopUpload(t *testing.T) {
 	testUpload(t, &Posix{MountPoint: mountPoint}, &Noop{})
 }
+
+func TestPosixNoopDownload(t *testing.T) {
+	testDownload(t, &Posix{MountPoint: mountPoint}, &Noop{})
+}
+
+func testPosixSQLite(t *testing.T, test func(*testing.T, RawDataStore, MetaDataStore)) {
+	dir, err := ioutil.TempDir("", "ciao-image-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	m := &SQLite{DbFile: path.Join(dir, "images.db")}
+	defer func() { _ = m.Close() }()
+
+	d := &Posix{MountPoint: dir}
+
+	test(t, d, m)
+}
+
+// sqliteV1Table is the images table of the first sqlite metadata store.
+const sqliteV1Table = `CREATE TABLE images
+(
+	id string primary key,
+	state string,
+	type string,
+	tenant_id string,
+	name string,
+	create_time DATETIME,
+	size int,
+	checksum string
+);`
+
+func TestSQLiteMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ciao-image-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	dbFile := path.Join(dir, "images.db")
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createTime := time.Date(2016, 11, 4, 10, 0, 0, 0, time.UTC)
+	_, err = db.Exec(sqliteV1Table)
+	if err == nil {
+		_, err = db.Exec(`INSERT INTO images VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			"validID", string(Active), string(Raw), "", "old", createTime,
+			11, "ffeed24e8e4fd763c1d0d02c6e5d6e15")
+	}
+	_ = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &SQLite{DbFile: dbFile}
+	defer func() { _ = m.Close() }()
+
+	images, err := m.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 1 {
+		t.Fatalf("Expected 1 image, got %d", len(images))
+	}
+
+	i := images[0]
+	if i.ID != "validID" || i.Name != "old" || i.State != Active ||
+		i.Size != 11 || i.SHA256 != "" || !i.UpdateTime.Equal(createTime) ||
+		i.Tags != nil || i.Properties != nil || i.MinDisk != 0 ||
+		i.MinRAM != 0 || i.Protected || i.Visibility != image.Public ||
+		i.Members != nil {
+		t.Fatalf("Wrong migrated image %+v", i)
+	}
+
+	i.Tags = []string{"ubuntu"}
+	err = m.Write(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the database is only migrated once
+	m = &SQLite{DbFile: dbFile}
+	defer func() { _ = m.Close() }()
+
+	images, err = m.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 1 || !reflect.DeepEqual(images[0].Tags, i.Tags) {
+		t.Fatalf("Wrong image after reopening the database %+v", images)
+	}
+}
+
+func TestPosixSQLiteCreateAndGet(t *testing.T) {
+	testPosixSQLite(t, testCreateAndGet)
+}
+
+func TestPosixSQLiteGetAll(t *testing.T) {
+	testPosixSQLite(t, testGetAll)
+}
+
+func TestPosixSQLiteDelete(t *testing.T) {
+	testPosixSQLite(t, testDelete)
+}
+
+func TestPosixSQLiteUpload(t *testing.T) {
+	testPosixSQLite(t, testUpload)
+}
+
+func TestPosixSQLiteDownload(t *testing.T) {
+	testPosixSQLite(t, testDownload)
+}
+
+func testReload(t *testing.T, d RawDataStore, m MetaDataStore) {
+	uploaded := Image{
+		ID:         "ab68111c-03a6-11e6-87de-001320fb6e31",
+		State:      Created,
+		TenantID:   "tenant",
+		Name:       "uploaded",
+		Type:       Raw,
+		Tags:       []string{"ubuntu"},
+		Properties: map[string]string{"os_distro": "ubuntu"},
+		MinDisk:    10,
+		MinRAM:     512,
+		Protected:  true,
+		Visibility: image.Shared,
+		Members: map[string]Member{
+			"bab7d5c60cd041a0a36f7c4b6e1dd978": {Status: image.MemberAccepted},
+		},
+	}
+	queued := Image{
+		ID:    "bc1e2a44-03a6-11e6-87de-001320fb6e31",
+		State: Created,
+		Name:  "queued",
+	}
+	lost := Image{
+		ID:    "cd9f3b56-03a6-11e6-87de-001320fb6e31",
+		State: Created,
+		Name:  "lost",
+	}
+	orphan := "de8a4c68-03a6-11e6-87de-001320fb6e31"
+
+	cache := ImageCache{}
+	err := cache.Init(d, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range []Image{uploaded, queued, lost} {
+		err = cache.CreateImage(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, ID := range []string{uploaded.ID, lost.ID} {
+		err = cache.UploadImage(ID, strings.NewReader("Upload file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// data lost behind the image service's back, and data with no metadata
+	err = d.Delete(lost.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = d.Write(orphan, strings.NewReader("Upload file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache = ImageCache{}
+	err = cache.Init(d, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := cache.GetAllImages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 4 {
+		t.Fatalf("Expected 4 images, got %d", len(images))
+	}
+
+	tests := []struct {
+		ID         string
+		state      State
+		name       string
+		tenantID   string
+		imgType    Type
+		size       int64
+		visibility image.Visibility
+	}{
+		{uploaded.ID, Active, uploaded.Name, uploaded.TenantID, uploaded.Type, int64(len("Upload file")), image.Shared},
+		{queued.ID, Created, queued.Name, "", "", 0, ""},
+		{lost.ID, Created, lost.Name, "", Raw, 0, ""},
+		{orphan, Active, "", "", Raw, int64(len("Upload file")), image.Private},
+	}
+
+	for _, test := range tests {
+		i, err := cache.GetImage(test.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i.State != test.state || i.Name != test.name ||
+			i.TenantID != test.tenantID || i.Type != test.imgType ||
+			i.Size != test.size || i.Visibility != test.visibility {
+			t.Errorf("Wrong image %s after reload %+v", test.ID, i)
+		}
+
+		if test.state == Active && i.CheckSum != "ffeed24e8e4fd763c1d0d02c6e5d6e15" {
+			t.Errorf("Wrong checksum for image %s: %s", test.ID, i.CheckSum)
+		}
+	}
+
+	i, err := cache.GetImage(uploaded.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(i.Tags, uploaded.Tags) ||
+		!reflect.DeepEqual(i.Properties, uploaded.Properties) ||
+		i.MinDisk != uploaded.MinDisk || i.MinRAM != uploaded.MinRAM ||
+		!i.Protected || i.Visibility != uploaded.Visibility ||
+		i.Members["bab7d5c60cd041a0a36f7c4b6e1dd978"].Status != image.MemberAccepted {
+		t.Errorf("Wrong image metadata after reload %+v", i)
+	}
+
+	err = cache.DeleteImage(orphan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache = ImageCache{}
+	err = cache.Init(d, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cache.GetImage(orphan)
+	if err == nil {
+		t.Fatal("Deleted image found after reload")
+	}
+}
+
+func TestPosixSQLiteReload(t *testing.T) {
+	testPosixSQLite(t, testReload)
+}
+
+func testCephSQLite(t *testing.T, test func(*testing.T, RawDataStore, MetaDataStore)) {
+	rbd, err := testutil.NewFakeRBD()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rbd.Close() }()
+
+	m := &SQLite{DbFile: path.Join(rbd.Dir, "images.db")}
+	defer func() { _ = m.Close() }()
+
+	d := &Ceph{ID: "ciao"}
+
+	test(t, d, m)
+}
+
+func TestCephSQLiteCreateAndGet(t *testing.T) {
+	testCephSQLite(t, testCreateAndGet)
+}
+
+func TestCephSQLiteGetAll(t *testing.T) {
+	testCephSQLite(t, testGetAll)
+}
+
+func TestCephSQLiteDelete(t *testing.T) {
+	testCephSQLite(t, testDelete)
+}
+
+func TestCephSQLiteUpload(t *testing.T) {
+	testCephSQLite(t, testUpload)
+}
+
+func TestCephSQLiteDownload(t *testing.T) {
+	testCephSQLite(t, testDownload)
+}
+
+func TestCephSQLiteReload(t *testing.T) {
+	testCephSQLite(t, testReload)
+}
+
+func TestCephList(t *testing.T) {
+	rbd, err := testutil.NewFakeRBD()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rbd.Close() }()
+
+	d := &Ceph{}
+
+	_, err = d.Write("image", strings.NewReader("Upload file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// overwriting an image replaces its data
+	size, err := d.Write("image", strings.NewReader("Upload"))
+	if err != nil || size != int64(len("Upload")) {
+		t.Fatalf("Unable to overwrite image: %d %v", size, err)
+	}
+
+	size, err = d.GetImageSize("image")
+	if err != nil || size != int64(len("Upload")) {
+		t.Fatalf("Wrong image size: %d %v", size, err)
+	}
+
+	// qcow2 images cannot be attached as raw volumes
+	_, err = d.Write("qcow", strings.NewReader("QFI\xfb\x00\x00\x00\x03"))
+	if err != image.ErrBadImageData {
+		t.Fatalf("Expected %v, got %v", image.ErrBadImageData, err)
+	}
+
+	// a volume, which is not an image, in the same pool
+	err = exec.Command("rbd", "create", "--size", "1G", "volume").Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	IDs, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(IDs, []string{"image"}) {
+		t.Fatalf("Expected [image], got %v", IDs)
+	}
+
+	err = d.Delete("image")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = d.Read("image")
+	if err == nil {
+		t.Fatal("Read a deleted image")
+	}
+}
+
+func TestDetectType(t *testing.T) {
+	iso := make([]byte, headerSize)
+	copy(iso[isoMagicOffset:], "CD001")
+
+	tests := []struct {
+		header  []byte
+		imgType Type
+	}{
+		{[]byte("QFI\xfb\x00\x00\x00\x03"), QCow},
+		{iso, ISO},
+		{iso[:headerSize-1], Raw},
+		{[]byte("QFI"), Raw},
+		{[]byte{}, Raw},
+	}
+
+	for _, test := range tests {
+		imgType := detectType(test.header)
+		if imgType != test.imgType {
+			t.Errorf("Expected %s for %q, got %s", test.imgType, test.header, imgType)
+		}
+	}
+}
+
+// fakeQemuImg prefixes the data of the raw images it converts with the
+// qcow2 magic.
+const fakeQemuImg = `#!/bin/sh
+[ "$1" = "convert" ] && [ "$3" = "raw" ] && [ "$5" = "qcow2" ] || exit 1
+{ printf 'QFI\373'; cat "$6"; } > "$7"
+`
+
+func TestUploadConvert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ciao-image-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	err = ioutil.WriteFile(path.Join(dir, "qemu-img"), []byte(fakeQemuImg), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(p string) { _ = os.Setenv("PATH", p) }(os.Getenv("PATH"))
+	err = os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := ImageCache{ConvertTo: QCow}
+	err = cache.Init(&Posix{MountPoint: dir}, &Noop{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iso := make([]byte, headerSize)
+	copy(iso[isoMagicOffset:], "CD001")
+
+	tests := []struct {
+		ID      string
+		data    string
+		state   State
+		imgType Type
+		stored  string
+	}{
+		{"raw", "Upload file", Active, QCow, "QFI\xfbUpload file"},
+		{"qcow", "QFI\xfbUpload file", Active, QCow, "QFI\xfbUpload file"},
+		{"iso", string(iso), Active, ISO, string(iso)},
+	}
+
+	for _, test := range tests {
+		err = cache.CreateImage(Image{ID: test.ID, State: Created})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = cache.UploadImage(test.ID, strings.NewReader(test.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		img, err := cache.GetImage(test.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if img.State != test.state || img.Type != test.imgType ||
+			img.Size != int64(len(test.stored)) {
+			t.Errorf("Wrong image %s after upload %+v", test.ID, img)
+		}
+
+		data, err := ioutil.ReadFile(path.Join(dir, test.ID))
+		if err != nil || string(data) != test.stored {
+			t.Errorf("Wrong image %s data %q: %v", test.ID, data, err)
+		}
+	}
+
+	// conversion failures kill the image
+	cache.ConvertTo = Raw
+
+	err = cache.CreateImage(Image{ID: "killed", State: Created})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cache.UploadImage("killed", strings.NewReader("QFI\xfbUpload file"))
+	if err == nil {
+		t.Fatal("Conversion failure not reported")
+	}
+
+	img, err := cache.GetImage("killed")
+	if err != nil || img.State != Killed {
+		t.Fatalf("Expected killed image, got %+v: %v", img, err)
+	}
+
+	err = cache.DeleteImage("killed")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+var (
+	// qcowMagic starts every qcow2 image.
+	qcowMagic = []byte{'Q', 'F', 'I', 0xfb}
+
+	// isoMagic identifies the first ISO 9660 volume descriptor.
+	isoMagic = []byte("CD001")
+)
+
+// isoMagicOffset is the offset of isoMagic in an ISO image, after the
+// 32KB system area and the volume descriptor type.
+const isoMagicOffset = 0x8001
+
+// headerSize is the amount of image data needed to detect its type.
+const headerSize = isoMagicOffset + 5
+
+// detectType returns the type of the image data starting with header.
+// Data which is neither qcow2 nor ISO is raw.
+func detectType(header []byte) Type {
+	if bytes.HasPrefix(header, qcowMagic) {
+		return QCow
+	}
+
+	if len(header) >= headerSize &&
+		bytes.Equal(header[isoMagicOffset:headerSize], isoMagic) {
+		return ISO
+	}
+
+	return Raw
+}
+
+// sniff detects the type of the image data read from r.  The returned
+// reader reads the whole image data, including its header.
+func sniff(r io.Reader) (io.Reader, Type, error) {
+	data := bufio.NewReaderSize(r, 1<<16)
+
+	header, err := data.Peek(headerSize)
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+
+	return data, detectType(header), nil
+}
+
+// imageHash computes the size, MD5 and SHA256 sums of the image data
+// written to it.
+type imageHash struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+	size   int64
+}
+
+func newImageHash() *imageHash {
+	return &imageHash{
+		md5:    md5.New(),
+		sha256: sha256.New(),
+	}
+}
+
+func (h *imageHash) Write(p []byte) (int, error) {
+	_, _ = h.md5.Write(p)
+	_, _ = h.sha256.Write(p)
+	h.size += int64(len(p))
+
+	return len(p), nil
+}
+
+// set records the size and sums of the image data in img.
+func (h *imageHash) set(img *Image) {
+	img.Size = h.size
+	img.CheckSum = hex.EncodeToString(h.md5.Sum(nil))
+	img.SHA256 = hex.EncodeToString(h.sha256.Sum(nil))
+}
+
+// convertImage converts the image data read from r, of type from, to
+// the type to with qemu-img.  The converted image is stored in a
+// temporary file which path is returned, and that the caller removes.
+func convertImage(r io.Reader, from Type, to Type) (string, error) {
+	src, err := ioutil.TempFile("", "ciao-image-")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.Remove(src.Name()) }()
+
+	_, err = io.Copy(src, r)
+	if cErr := src.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	dst := src.Name() + "." + string(to)
+
+	cmd := exec.Command("qemu-img", "convert", "-f", string(from),
+		"-O", string(to), src.Name(), dst)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		_ = os.Remove(dst)
+		return "", fmt.Errorf("qemu-img convert failed: %v: %s", err, out)
+	}
+
+	return dst, nil
+}
@@ -16,6 +16,7 @@ package datastore
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 )
@@ -34,15 +35,52 @@ func (p *Posix) Write(ID string, body io.Reader) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	defer func() { _ = image.Close() }()
 
 	buf := make([]byte, 1<<16)
 
 	return io.CopyBuffer(image, body, buf)
 }
 
+// Read opens an image from the posix filesystem for reading.
+func (p *Posix) Read(ID string) (io.ReadCloser, error) {
+	imageName := path.Join(p.MountPoint, ID)
+
+	return os.Open(imageName)
+}
+
 // Delete removes an image from the posix filesystem
 func (p *Posix) Delete(ID string) error {
 	imageName := path.Join(p.MountPoint, ID)
 
 	return os.Remove(imageName)
 }
+
+// GetImageSize returns the size of an image file in the posix filesystem.
+func (p *Posix) GetImageSize(ID string) (int64, error) {
+	imageName := path.Join(p.MountPoint, ID)
+
+	fi, err := os.Stat(imageName)
+	if err != nil {
+		return 0, err
+	}
+
+	return fi.Size(), nil
+}
+
+// List returns the names of the regular files found in the mount point.
+func (p *Posix) List() ([]string, error) {
+	files, err := ioutil.ReadDir(p.MountPoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var IDs []string
+	for _, fi := range files {
+		if fi.Mode().IsRegular() {
+			IDs = append(IDs, fi.Name())
+		}
+	}
+
+	return IDs, nil
+}
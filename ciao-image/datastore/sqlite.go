@@ -0,0 +1,279 @@
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/01org/ciao/openstack/image"
+
+	// register the sqlite3 database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const imagesTable = `CREATE TABLE IF NOT EXISTS images
+(
+	id string primary key,
+	state string,
+	type string,
+	tenant_id string,
+	name string,
+	create_time DATETIME,
+	size int,
+	checksum string,
+	sha256 string,
+	update_time DATETIME,
+	tags string,
+	properties string,
+	min_disk int,
+	min_ram int,
+	protected boolean,
+	visibility string,
+	members string
+);`
+
+// imagesColumns are the columns added to the images table after its first
+// version, with their definition and the statement initializing them, if
+// any, for the images stored before they were added.
+var imagesColumns = []struct {
+	name       string
+	definition string
+	init       string
+}{
+	{"update_time", "DATETIME", "UPDATE images SET update_time = create_time"},
+	{"tags", "string DEFAULT 'null'", ""},
+	{"properties", "string DEFAULT 'null'", ""},
+	{"min_disk", "int DEFAULT 0", ""},
+	{"min_ram", "int DEFAULT 0", ""},
+	{"protected", "boolean DEFAULT 0", ""},
+
+	// images were visible to every tenant before their visibility
+	// could be set.
+	{"visibility", "string DEFAULT 'public'", ""},
+	{"members", "string DEFAULT 'null'", ""},
+	{"sha256", "string DEFAULT ''", ""},
+}
+
+// SQLite implements the MetaDataStore interface on top of an sqlite3
+// database, so that image metadata survives restarts of the image service.
+// The database is created the first time it is used.
+type SQLite struct {
+	// DbFile is the path to the sqlite3 database file.
+	DbFile string
+
+	db   *sql.DB
+	lock sync.Mutex
+}
+
+func (s *SQLite) getDb() (*sql.DB, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.db != nil {
+		return s.db, nil
+	}
+
+	db, err := sql.Open("sqlite3", s.DbFile)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(imagesTable)
+	if err == nil {
+		err = migrate(db)
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	s.db = db
+
+	return s.db, nil
+}
+
+// migrate adds the columns of imagesColumns which are missing from the
+// images table of a database created by an older image service.
+func migrate(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA table_info(images)")
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue interface{}
+
+		err = rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+
+		columns[name] = true
+	}
+
+	err = rows.Err()
+	_ = rows.Close()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range imagesColumns {
+		if columns[c.name] {
+			continue
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("ALTER TABLE images ADD COLUMN %s %s",
+			c.name, c.definition))
+		if err == nil && c.init != "" {
+			_, err = tx.Exec(c.init)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Write is the sqlite image metadata write implementation.
+// An existing entry for the same image is replaced.
+func (s *SQLite) Write(i Image) error {
+	db, err := s.getDb()
+	if err != nil {
+		return err
+	}
+
+	tags, err := json.Marshal(i.Tags)
+	if err != nil {
+		return err
+	}
+
+	properties, err := json.Marshal(i.Properties)
+	if err != nil {
+		return err
+	}
+
+	members, err := json.Marshal(i.Members)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT OR REPLACE INTO images
+			  (id, state, type, tenant_id, name, create_time, size, checksum,
+			   sha256, update_time, tags, properties, min_disk, min_ram,
+			   protected, visibility, members)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		i.ID, string(i.State), string(i.Type), i.TenantID, i.Name,
+		i.CreateTime, i.Size, i.CheckSum, i.SHA256, i.UpdateTime, string(tags),
+		string(properties), i.MinDisk, i.MinRAM, i.Protected,
+		string(i.Visibility), string(members))
+
+	return err
+}
+
+// Delete is the sqlite image metadata delete implementation.
+func (s *SQLite) Delete(ID string) error {
+	db, err := s.getDb()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM images WHERE id = ?", ID)
+
+	return err
+}
+
+// GetAll is the sqlite image metadata get all images implementation.
+func (s *SQLite) GetAll() ([]Image, error) {
+	db, err := s.getDb()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT id, state, type, tenant_id, name,
+			       create_time, size, checksum, sha256, update_time,
+			       tags, properties, min_disk, min_ram, protected,
+			       visibility, members FROM images`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var images []Image
+
+	for rows.Next() {
+		var i Image
+		var state, imageType, tags, properties, visibility, members string
+
+		err = rows.Scan(&i.ID, &state, &imageType, &i.TenantID, &i.Name,
+			&i.CreateTime, &i.Size, &i.CheckSum, &i.SHA256, &i.UpdateTime, &tags,
+			&properties, &i.MinDisk, &i.MinRAM, &i.Protected, &visibility,
+			&members)
+		if err != nil {
+			return nil, err
+		}
+
+		i.State = State(state)
+		i.Type = Type(imageType)
+		i.Visibility = image.Visibility(visibility)
+
+		err = json.Unmarshal([]byte(tags), &i.Tags)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(properties), &i.Properties)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(members), &i.Members)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, i)
+	}
+
+	return images, rows.Err()
+}
+
+// Close closes the sqlite3 database, if it was opened.
+func (s *SQLite) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.db == nil {
+		return nil
+	}
+
+	err := s.db.Close()
+	s.db = nil
+
+	return err
+}
@@ -33,6 +33,10 @@ var password = "hello"
 var mountPoint = "/var/lib/ciao/images"
 
 var identityURL = flag.String("identity", identity, "URL of keystone service")
+var metaDataPath = flag.String("database_path", "/var/lib/ciao/ciao-image.db", "path to the image metadata database")
+var rawDataStore = flag.String("datastore", "posix", "image data store, posix or ceph")
+var cephID = flag.String("ceph_id", "", "ceph client id")
+var convertTo = flag.String("convert_to", "", "disk format uploaded images are converted to, raw or qcow2")
 
 func init() {
 	flag.Parse()
@@ -43,10 +47,33 @@ func init() {
 }
 
 func main() {
-	// TBD Select the right datastore interface
-	metaDs := &datastore.Noop{}
-	rawDs := &datastore.Posix{
-		MountPoint: mountPoint,
+	metaDs := &datastore.SQLite{
+		DbFile: *metaDataPath,
+	}
+
+	var rawDs datastore.RawDataStore
+	switch *rawDataStore {
+	case "posix":
+		rawDs = &datastore.Posix{
+			MountPoint: mountPoint,
+		}
+	case "ceph":
+		rawDs = &datastore.Ceph{
+			ID: *cephID,
+		}
+	default:
+		glog.Fatalf("Unknown image data store %s", *rawDataStore)
+	}
+
+	switch datastore.Type(*convertTo) {
+	case "", datastore.Raw, datastore.QCow:
+	default:
+		glog.Fatalf("Cannot convert images to %s", *convertTo)
+	}
+
+	// volumes cloned from images stored in ceph are attached as raw disks.
+	if *rawDataStore == "ceph" && datastore.Type(*convertTo) != datastore.Raw {
+		glog.Fatalf("The ceph data store requires -convert_to %s", datastore.Raw)
 	}
 
 	config := service.Config{
@@ -55,6 +82,7 @@ func main() {
 		HTTPSKey:         httpsKey,
 		RawDataStore:     rawDs,
 		MetaDataStore:    metaDs,
+		ConvertTo:        datastore.Type(*convertTo),
 		IdentityEndpoint: identity,
 		Username:         userName,
 		Password:         password,
@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/01org/ciao/ciao-image/datastore"
@@ -32,11 +34,104 @@ import (
 
 // ImageService is the context for the image service implementation.
 type ImageService struct {
-	ds datastore.DataStore
+	ds     datastore.DataStore
+	tokens *tokenStore
+}
+
+// owns returns true if caller owns img.  Admins own every image.
+func owns(caller identity.Identity, img datastore.Image) bool {
+	return caller.Admin || (img.TenantID != "" && img.TenantID == caller.ProjectID)
+}
+
+// canSee returns true if caller can see and use img.
+func canSee(caller identity.Identity, img datastore.Image) bool {
+	if img.Visibility == image.Public || owns(caller, img) {
+		return true
+	}
+
+	if img.Visibility == image.Shared {
+		_, ok := img.Members[caller.ProjectID]
+		return ok
+	}
+
+	return false
+}
+
+// checkVisibility checks that caller can give an image the visibility v.
+// Only admins can publish public images.
+func checkVisibility(caller identity.Identity, v image.Visibility) error {
+	switch v {
+	case image.Private, image.Shared:
+		return nil
+	case image.Public:
+		if caller.Admin {
+			return nil
+		}
+		return image.ErrForbidden
+	}
+
+	return image.ErrBadProperty
+}
+
+// getImage returns the image identified by imageID, if caller can see it.
+// Images that caller cannot see are reported as not found.
+func (is ImageService) getImage(caller identity.Identity, imageID string) (datastore.Image, error) {
+	img, err := is.ds.GetImage(imageID)
+	if err != nil {
+		return datastore.Image{}, err
+	}
+
+	if !canSee(caller, img) {
+		return datastore.Image{}, image.ErrNoImage
+	}
+
+	return img, nil
+}
+
+// getOwnedImage returns the image identified by imageID, if caller owns it.
+func (is ImageService) getOwnedImage(caller identity.Identity, imageID string) (datastore.Image, error) {
+	img, err := is.getImage(caller, imageID)
+	if err != nil {
+		return datastore.Image{}, err
+	}
+
+	if !owns(caller, img) {
+		return datastore.Image{}, image.ErrForbidden
+	}
+
+	return img, nil
+}
+
+// copyImage returns a copy of img which tags, properties and members can
+// be modified without modifying the cached image.
+func copyImage(img datastore.Image) datastore.Image {
+	c := img
+
+	if img.Tags != nil {
+		c.Tags = append([]string{}, img.Tags...)
+	}
+
+	if img.Properties != nil {
+		c.Properties = make(map[string]string)
+		for k, v := range img.Properties {
+			c.Properties[k] = v
+		}
+	}
+
+	if img.Members != nil {
+		c.Members = make(map[string]datastore.Member)
+		for k, v := range img.Members {
+			c.Members[k] = v
+		}
+	}
+
+	return c
 }
 
 // CreateImage will create an empty image in the image datastore.
-func (is ImageService) CreateImage(req image.CreateImageRequest) (image.DefaultResponse, error) {
+// The image is owned by the caller's tenant, unless an admin creates it
+// on behalf of another tenant.
+func (is ImageService) CreateImage(caller identity.Identity, req image.CreateImageRequest) (image.DefaultResponse, error) {
 	// create an ImageInfo struct and store it in our image
 	// datastore.
 	id := req.ID
@@ -52,53 +147,166 @@ func (is ImageService) CreateImage(req image.CreateImageRequest) (image.DefaultR
 		}
 	}
 
+	properties, err := imageProperties(req.Properties)
+	if err != nil {
+		return image.DefaultResponse{}, err
+	}
+
+	if req.MinDisk < 0 || req.MinRAM < 0 {
+		return image.DefaultResponse{}, image.ErrBadProperty
+	}
+
+	owner := caller.ProjectID
+	if req.Owner != "" && req.Owner != owner {
+		if !caller.Admin {
+			return image.DefaultResponse{}, image.ErrForbidden
+		}
+		owner = req.Owner
+	}
+
+	var imgType datastore.Type
+	switch req.DiskFormat {
+	case "":
+		// the format is detected when the image data is uploaded.
+	case image.Raw, image.QCow, image.ISO:
+		imgType = datastore.Type(req.DiskFormat)
+	default:
+		return image.DefaultResponse{}, image.ErrBadProperty
+	}
+
+	visibility := req.Visibility
+	if visibility == "" {
+		visibility = image.Private
+	}
+
+	err = checkVisibility(caller, visibility)
+	if err != nil {
+		return image.DefaultResponse{}, err
+	}
+
 	i := datastore.Image{
 		ID:         id,
 		State:      datastore.Created,
+		TenantID:   owner,
+		Visibility: visibility,
 		Name:       req.Name,
+		Type:       imgType,
 		CreateTime: time.Now(),
+		Tags:       req.Tags,
+		Properties: properties,
+		MinDisk:    req.MinDisk,
+		MinRAM:     req.MinRAM,
+		Protected:  req.Protected,
 	}
+	i.UpdateTime = i.CreateTime
 
-	err := is.ds.CreateImage(i)
+	err = is.ds.CreateImage(i)
 	if err != nil {
 		return image.DefaultResponse{}, err
 	}
 
-	return image.DefaultResponse{
-		Status:     image.Queued,
-		CreatedAt:  i.CreateTime,
-		Tags:       make([]string, 0),
-		Locations:  make([]string, 0),
-		DiskFormat: image.Raw,
-		Visibility: i.Visibility(),
-		Self:       fmt.Sprintf("/v2/images/%s", i.ID),
-		Protected:  false,
-		ID:         i.ID,
-		File:       fmt.Sprintf("/v2/images/%s/file", i.ID),
-		Schema:     "/v2/schemas/image",
-		Name:       &i.Name,
-	}, nil
+	return createImageResponse(i)
+}
+
+// imageProperties converts the custom properties of an image creation
+// request, which must all have string values.
+func imageProperties(props interface{}) (map[string]string, error) {
+	if props == nil {
+		return nil, nil
+	}
+
+	m, ok := props.(map[string]interface{})
+	if !ok {
+		return nil, image.ErrBadProperty
+	}
+
+	properties := make(map[string]string)
+	for k, v := range m {
+		value, ok := v.(string)
+		if !ok || isImageAttribute(k) {
+			return nil, image.ErrBadProperty
+		}
+		properties[k] = value
+	}
+
+	return properties, nil
 }
 
 func createImageResponse(img datastore.Image) (image.DefaultResponse, error) {
+	var size *int
+	var checksum, hashAlgo, hashValue *string
+	var properties interface{}
+
+	if img.State == datastore.Active {
+		s := int(img.Size)
+		size = &s
+		checksum = &img.CheckSum
+
+		if img.SHA256 != "" {
+			algo := "sha256"
+			hashAlgo = &algo
+			hashValue = &img.SHA256
+		}
+	}
+
+	// images which format has not been declared, nor detected yet, are
+	// reported as raw.
+	diskFormat := image.DiskFormat(img.Type)
+	if diskFormat == "" {
+		diskFormat = image.Raw
+	}
+
+	tags := img.Tags
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+
+	if len(img.Properties) > 0 {
+		properties = img.Properties
+	}
+
+	var owner *string
+	if img.TenantID != "" {
+		owner = &img.TenantID
+	}
+
+	containerFormat := image.Bare
+	minDisk := img.MinDisk
+	minRAM := img.MinRAM
+	updatedAt := img.UpdateTime
+	if updatedAt.IsZero() {
+		updatedAt = img.CreateTime
+	}
+
 	return image.DefaultResponse{
-		Status:     img.State.Status(),
-		CreatedAt:  img.CreateTime,
-		Tags:       make([]string, 0),
-		Locations:  make([]string, 0),
-		DiskFormat: image.DiskFormat(img.Type),
-		Visibility: img.Visibility(),
-		Self:       fmt.Sprintf("/v2/images/%s", img.ID),
-		Protected:  false,
-		ID:         img.ID,
-		File:       fmt.Sprintf("/v2/images/%s/file", img.ID),
-		Schema:     "/v2/schemas/image",
-		Name:       &img.Name,
+		Status:          img.State.Status(),
+		ContainerFormat: &containerFormat,
+		MinRAM:          &minRAM,
+		UpdatedAt:       &updatedAt,
+		MinDisk:         &minDisk,
+		CreatedAt:       img.CreateTime,
+		Tags:            tags,
+		Locations:       make([]string, 0),
+		DiskFormat:      diskFormat,
+		Visibility:      img.Visibility,
+		Owner:           owner,
+		Self:            fmt.Sprintf("/v2/images/%s", img.ID),
+		Protected:       img.Protected,
+		ID:              img.ID,
+		File:            fmt.Sprintf("/v2/images/%s/file", img.ID),
+		Schema:          "/v2/schemas/image",
+		Name:            &img.Name,
+		Size:            size,
+		CheckSum:        checksum,
+		HashAlgo:        hashAlgo,
+		HashValue:       hashValue,
+		Properties:      properties,
 	}, nil
 }
 
-// ListImages will return a list of all the images in the datastore.
-func (is ImageService) ListImages() ([]image.DefaultResponse, error) {
+// ListImages will return a list of the images the caller can see.
+// Shared images are only listed once the caller accepted them.
+func (is ImageService) ListImages(caller identity.Identity) ([]image.DefaultResponse, error) {
 	var response []image.DefaultResponse
 
 	images, err := is.ds.GetAllImages()
@@ -107,6 +315,15 @@ func (is ImageService) ListImages() ([]image.DefaultResponse, error) {
 	}
 
 	for _, img := range images {
+		if !canSee(caller, img) {
+			continue
+		}
+
+		if img.Visibility == image.Shared && !owns(caller, img) &&
+			img.Members[caller.ProjectID].Status != image.MemberAccepted {
+			continue
+		}
+
 		i, _ := createImageResponse(img)
 		response = append(response, i)
 	}
@@ -115,10 +332,15 @@ func (is ImageService) ListImages() ([]image.DefaultResponse, error) {
 }
 
 // UploadImage will upload a raw image data and update its status.
-func (is ImageService) UploadImage(imageID string, body io.Reader) (image.NoContentImageResponse, error) {
+func (is ImageService) UploadImage(caller identity.Identity, imageID string, body io.Reader) (image.NoContentImageResponse, error) {
 	var response image.NoContentImageResponse
 
-	err := is.ds.UploadImage(imageID, body)
+	_, err := is.getOwnedImage(caller, imageID)
+	if err != nil {
+		return response, err
+	}
+
+	err = is.ds.UploadImage(imageID, body)
 	if err != nil {
 		return response, err
 	}
@@ -128,10 +350,15 @@ func (is ImageService) UploadImage(imageID string, body io.Reader) (image.NoCont
 }
 
 // DeleteImage will delete a raw image and its metadata
-func (is ImageService) DeleteImage(imageID string) (image.NoContentImageResponse, error) {
+func (is ImageService) DeleteImage(caller identity.Identity, imageID string) (image.NoContentImageResponse, error) {
 	var response image.NoContentImageResponse
 
-	err := is.ds.DeleteImage(imageID)
+	_, err := is.getOwnedImage(caller, imageID)
+	if err != nil {
+		return response, err
+	}
+
+	err = is.ds.DeleteImage(imageID)
 	if err != nil {
 		return response, err
 	}
@@ -140,19 +367,332 @@ func (is ImageService) DeleteImage(imageID string) (image.NoContentImageResponse
 	return response, nil
 }
 
+// DownloadImage will return a reader for the raw image data
+func (is ImageService) DownloadImage(caller identity.Identity, imageID string) (io.ReadCloser, error) {
+	_, err := is.getImage(caller, imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return is.ds.DownloadImage(imageID)
+}
+
+// readOnlyAttributes are the image attributes managed by the image service.
+var readOnlyAttributes = map[string]bool{
+	"id":               true,
+	"status":           true,
+	"size":             true,
+	"virtual_size":     true,
+	"checksum":         true,
+	"created_at":       true,
+	"updated_at":       true,
+	"owner":            true,
+	"locations":        true,
+	"self":             true,
+	"file":             true,
+	"schema":           true,
+	"container_format": true,
+	"disk_format":      true,
+}
+
+// isImageAttribute returns true if name is an attribute of an image,
+// rather than a custom image property.
+func isImageAttribute(name string) bool {
+	switch name {
+	case "name", "tags", "min_disk", "min_ram", "protected", "properties", "visibility":
+		return true
+	}
+
+	return readOnlyAttributes[name]
+}
+
+// patchInt returns the value of an image update operation as a non-negative
+// int.
+func patchInt(op image.PatchOperation) (int, error) {
+	v, ok := op.Value.(float64)
+	if !ok || v < 0 || v != float64(int(v)) {
+		return 0, image.ErrBadPatch
+	}
+
+	return int(v), nil
+}
+
+// applyPatch applies a single image update operation, made by caller, to an
+// image.  The image's properties map is modified in place.
+func applyPatch(caller identity.Identity, img *datastore.Image, op image.PatchOperation) error {
+	if !strings.HasPrefix(op.Path, "/") || strings.Count(op.Path, "/") != 1 {
+		return image.ErrBadPatch
+	}
+	name := op.Path[1:]
+
+	if readOnlyAttributes[name] {
+		return image.ErrReadOnly
+	}
+
+	switch op.Op {
+	case image.PatchAdd, image.PatchReplace, image.PatchRemove:
+	default:
+		return image.ErrBadPatch
+	}
+
+	if op.Op == image.PatchRemove {
+		switch name {
+		case "name", "min_disk", "min_ram", "protected", "properties", "visibility":
+			return image.ErrBadPatch
+		case "tags":
+			img.Tags = nil
+			return nil
+		}
+
+		if _, ok := img.Properties[name]; !ok {
+			return image.ErrBadPatch
+		}
+		delete(img.Properties, name)
+		return nil
+	}
+
+	var err error
+
+	switch name {
+	case "name":
+		var ok bool
+		img.Name, ok = op.Value.(string)
+		if !ok {
+			return image.ErrBadPatch
+		}
+	case "min_disk":
+		img.MinDisk, err = patchInt(op)
+	case "min_ram":
+		img.MinRAM, err = patchInt(op)
+	case "protected":
+		var ok bool
+		img.Protected, ok = op.Value.(bool)
+		if !ok {
+			return image.ErrBadPatch
+		}
+	case "tags":
+		values, ok := op.Value.([]interface{})
+		if !ok {
+			return image.ErrBadPatch
+		}
+		tags := make([]string, 0, len(values))
+		for _, v := range values {
+			tag, ok := v.(string)
+			if !ok {
+				return image.ErrBadPatch
+			}
+			tags = append(tags, tag)
+		}
+		img.Tags = tags
+	case "visibility":
+		v, ok := op.Value.(string)
+		if !ok {
+			return image.ErrBadPatch
+		}
+		err = checkVisibility(caller, image.Visibility(v))
+		if err == image.ErrBadProperty {
+			return image.ErrBadPatch
+		}
+		img.Visibility = image.Visibility(v)
+	case "properties":
+		return image.ErrBadPatch
+	default:
+		value, ok := op.Value.(string)
+		if !ok {
+			return image.ErrBadPatch
+		}
+		if _, ok := img.Properties[name]; !ok && op.Op == image.PatchReplace {
+			return image.ErrBadPatch
+		}
+		if img.Properties == nil {
+			img.Properties = make(map[string]string)
+		}
+		img.Properties[name] = value
+	}
+
+	return err
+}
+
+// UpdateImage applies the operations of an image update request to the
+// metadata of an image.  Either all the operations are applied, or none.
+func (is ImageService) UpdateImage(caller identity.Identity, imageID string, ops []image.PatchOperation) (image.DefaultResponse, error) {
+	img, err := is.getOwnedImage(caller, imageID)
+	if err != nil {
+		return image.DefaultResponse{}, err
+	}
+
+	// the cached image must not be modified by a failed update.
+	img = copyImage(img)
+
+	for _, op := range ops {
+		err = applyPatch(caller, &img, op)
+		if err != nil {
+			return image.DefaultResponse{}, err
+		}
+	}
+
+	img.UpdateTime = time.Now()
+
+	err = is.ds.UpdateImage(img)
+	if err != nil {
+		return image.DefaultResponse{}, err
+	}
+
+	img, err = is.ds.GetImage(imageID)
+	if err != nil {
+		return image.DefaultResponse{}, err
+	}
+
+	return createImageResponse(img)
+}
+
 // GetImage will get the raw image data
-func (is ImageService) GetImage(imageID string) (image.DefaultResponse, error) {
+func (is ImageService) GetImage(caller identity.Identity, imageID string) (image.DefaultResponse, error) {
 	var response image.DefaultResponse
 
-	image, err := is.ds.GetImage(imageID)
+	img, err := is.getImage(caller, imageID)
 	if err != nil {
 		return response, err
 	}
 
-	response, _ = createImageResponse(image)
+	response, _ = createImageResponse(img)
 	return response, nil
 }
 
+func memberResponse(imageID string, memberID string, m datastore.Member) image.ImageMember {
+	return image.ImageMember{
+		CreatedAt: m.CreateTime,
+		ImageID:   imageID,
+		MemberID:  memberID,
+		Schema:    "/v2/schemas/member",
+		Status:    m.Status,
+		UpdatedAt: m.UpdateTime,
+	}
+}
+
+// ListImageMembers lists the tenants an image is shared with.  Members
+// that do not own the image only see their own membership.
+func (is ImageService) ListImageMembers(caller identity.Identity, imageID string) ([]image.ImageMember, error) {
+	img, err := is.getImage(caller, imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var IDs []string
+	for ID := range img.Members {
+		if owns(caller, img) || ID == caller.ProjectID {
+			IDs = append(IDs, ID)
+		}
+	}
+	sort.Strings(IDs)
+
+	var members []image.ImageMember
+	for _, ID := range IDs {
+		members = append(members, memberResponse(imageID, ID, img.Members[ID]))
+	}
+
+	return members, nil
+}
+
+// AddImageMember shares an image with a tenant.  Only shared images can
+// have members, and the membership is pending until the tenant accepts it.
+func (is ImageService) AddImageMember(caller identity.Identity, imageID string, memberID string) (image.ImageMember, error) {
+	img, err := is.getOwnedImage(caller, imageID)
+	if err != nil {
+		return image.ImageMember{}, err
+	}
+
+	if img.Visibility != image.Shared {
+		return image.ImageMember{}, image.ErrForbidden
+	}
+
+	if _, ok := img.Members[memberID]; ok {
+		return image.ImageMember{}, image.ErrAlreadyExists
+	}
+
+	img = copyImage(img)
+	if img.Members == nil {
+		img.Members = make(map[string]datastore.Member)
+	}
+
+	now := time.Now()
+	m := datastore.Member{
+		Status:     image.MemberPending,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	img.Members[memberID] = m
+
+	err = is.ds.UpdateImage(img)
+	if err != nil {
+		return image.ImageMember{}, err
+	}
+
+	return memberResponse(imageID, memberID, m), nil
+}
+
+// GetImageMember returns the status of a tenant an image is shared with.
+func (is ImageService) GetImageMember(caller identity.Identity, imageID string, memberID string) (image.ImageMember, error) {
+	img, err := is.getImage(caller, imageID)
+	if err != nil {
+		return image.ImageMember{}, err
+	}
+
+	m, ok := img.Members[memberID]
+	if !ok || (!owns(caller, img) && memberID != caller.ProjectID) {
+		return image.ImageMember{}, image.ErrNoMember
+	}
+
+	return memberResponse(imageID, memberID, m), nil
+}
+
+// UpdateImageMember lets a tenant accept or reject an image shared with it.
+func (is ImageService) UpdateImageMember(caller identity.Identity, imageID string, memberID string, status image.MemberStatus) (image.ImageMember, error) {
+	img, err := is.getImage(caller, imageID)
+	if err != nil {
+		return image.ImageMember{}, err
+	}
+
+	m, ok := img.Members[memberID]
+	if !ok {
+		return image.ImageMember{}, image.ErrNoMember
+	}
+
+	if !caller.Admin && memberID != caller.ProjectID {
+		return image.ImageMember{}, image.ErrForbidden
+	}
+
+	m.Status = status
+	m.UpdateTime = time.Now()
+
+	img = copyImage(img)
+	img.Members[memberID] = m
+
+	err = is.ds.UpdateImage(img)
+	if err != nil {
+		return image.ImageMember{}, err
+	}
+
+	return memberResponse(imageID, memberID, m), nil
+}
+
+// DeleteImageMember stops sharing an image with a tenant.
+func (is ImageService) DeleteImageMember(caller identity.Identity, imageID string, memberID string) error {
+	img, err := is.getOwnedImage(caller, imageID)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := img.Members[memberID]; !ok {
+		return image.ErrNoMember
+	}
+
+	img = copyImage(img)
+	delete(img.Members, memberID)
+
+	return is.ds.UpdateImage(img)
+}
+
 // Config is required to setup the API context for the image service.
 type Config struct {
 	// Port represents the http port that should be used for the service.
@@ -170,6 +710,10 @@ type Config struct {
 	// MetaDataStore is an interface to a persistent datastore for the image meta data.
 	MetaDataStore datastore.MetaDataStore
 
+	// ConvertTo is the disk format uploaded images are converted to.
+	// Images are stored as uploaded when it is empty.
+	ConvertTo datastore.Type
+
 	// IdentityEndpoint is the location of the keystone service.
 	IdentityEndpoint string
 
@@ -205,7 +749,10 @@ func getIdentityClient(config Config) (*gophercloud.ServiceClient, error) {
 // then wrap them in keystone validation. It will then start the https
 // service.
 func Start(config Config) error {
-	is := ImageService{ds: &datastore.ImageCache{}}
+	is := ImageService{
+		ds:     &datastore.ImageCache{ConvertTo: config.ConvertTo},
+		tokens: newTokenStore(),
+	}
 	err := is.ds.Init(config.RawDataStore, config.MetaDataStore)
 	if err != nil {
 		return err
@@ -241,9 +788,14 @@ func Start(config Config) error {
 			Next:          route.GetHandler(),
 			ValidServices: validServices,
 			ValidAdmins:   validAdmins,
+			ProjectScoped: true,
 		}
 
-		route.Handler(h)
+		route.Handler(tokenHandler{
+			is:       is,
+			Next:     route.GetHandler(),
+			Fallback: h,
+		})
 
 		return nil
 	})
@@ -0,0 +1,422 @@
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/01org/ciao/ciao-image/datastore"
+	"github.com/01org/ciao/openstack/identity"
+	"github.com/01org/ciao/openstack/image"
+)
+
+var (
+	owner  = identity.Identity{ProjectID: "bab7d5c60cd041a0a36f7c4b6e1dd978"}
+	tenant = identity.Identity{ProjectID: "5ef70662f8b34079a6eddb8da9d75fe8"}
+	admin  = identity.Identity{ProjectID: "9d3fb2b7d1b9489ab9e6e01b1a1aa6e6", Admin: true}
+)
+
+func testImageService(t *testing.T) ImageService {
+	is := ImageService{
+		ds:     &datastore.ImageCache{},
+		tokens: newTokenStore(),
+	}
+	err := is.ds.Init(nil, &datastore.Noop{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return is
+}
+
+func TestCreateImage(t *testing.T) {
+	is := testImageService(t)
+
+	req := image.CreateImageRequest{
+		Name:       "Ubuntu",
+		Tags:       []string{"ubuntu"},
+		MinDisk:    10,
+		MinRAM:     512,
+		Properties: map[string]interface{}{"os_distro": "ubuntu"},
+	}
+
+	resp, err := is.CreateImage(owner, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Status != image.Queued || *resp.Name != "Ubuntu" ||
+		*resp.Owner != owner.ProjectID || resp.Visibility != image.Private ||
+		*resp.MinDisk != 10 || *resp.MinRAM != 512 ||
+		!reflect.DeepEqual(resp.Tags, req.Tags) ||
+		!reflect.DeepEqual(resp.Properties, map[string]string{"os_distro": "ubuntu"}) {
+		t.Fatalf("Wrong image created %+v", resp)
+	}
+
+	req.Properties = map[string]interface{}{"min_disk": "10"}
+	_, err = is.CreateImage(owner, req)
+	if err != image.ErrBadProperty {
+		t.Fatalf("Expected %v, got %v", image.ErrBadProperty, err)
+	}
+}
+
+func TestUploadImageFormat(t *testing.T) {
+	is := testImageService(t)
+
+	_, err := is.CreateImage(owner, image.CreateImageRequest{DiskFormat: "vmdk"})
+	if err != image.ErrBadProperty {
+		t.Fatalf("Expected %v, got %v", image.ErrBadProperty, err)
+	}
+
+	qcow := "QFI\xfb\x00\x00\x00\x03"
+	sum := sha256.Sum256([]byte(qcow))
+
+	tests := []struct {
+		declared image.DiskFormat
+		data     string
+		err      error
+		status   image.Status
+		format   image.DiskFormat
+	}{
+		{image.QCow, "raw data", image.ErrBadImageData, image.Killed, image.QCow},
+		{image.Raw, qcow, image.ErrBadImageData, image.Killed, image.Raw},
+		{image.QCow, qcow, nil, image.Active, image.QCow},
+		{"", qcow, nil, image.Active, image.QCow},
+		{"", "raw data", nil, image.Active, image.Raw},
+	}
+
+	for _, tt := range tests {
+		img, err := is.CreateImage(owner, image.CreateImageRequest{DiskFormat: tt.declared})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = is.UploadImage(owner, img.ID, strings.NewReader(tt.data))
+		if err != tt.err {
+			t.Errorf("%s upload of %q: expected %v, got %v", tt.declared, tt.data, tt.err, err)
+		}
+
+		img, err = is.GetImage(owner, img.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if img.Status != tt.status || img.DiskFormat != tt.format {
+			t.Errorf("%s upload of %q: wrong image %+v", tt.declared, tt.data, img)
+		}
+
+		if tt.data == qcow && tt.err == nil &&
+			(*img.HashAlgo != "sha256" || *img.HashValue != hex.EncodeToString(sum[:])) {
+			t.Errorf("Wrong image hash %s %s", *img.HashAlgo, *img.HashValue)
+		}
+	}
+}
+
+func TestUpdateImage(t *testing.T) {
+	is := testImageService(t)
+
+	req := image.CreateImageRequest{
+		Name:       "Ubuntu",
+		Properties: map[string]interface{}{"os_distro": "ubuntu"},
+	}
+
+	img, err := is.CreateImage(owner, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		patch string
+		err   error
+		check func(image.DefaultResponse) bool
+	}{
+		{
+			`[{"op":"replace","path":"/name","value":"Ubuntu 16.04"}]`,
+			nil,
+			func(r image.DefaultResponse) bool { return *r.Name == "Ubuntu 16.04" },
+		},
+		{
+			`[{"op":"add","path":"/tags","value":["ubuntu","lts"]},{"op":"replace","path":"/min_ram","value":1024}]`,
+			nil,
+			func(r image.DefaultResponse) bool {
+				return reflect.DeepEqual(r.Tags, []string{"ubuntu", "lts"}) && *r.MinRAM == 1024
+			},
+		},
+		{
+			`[{"op":"add","path":"/os_version","value":"16.04"},{"op":"remove","path":"/os_distro"}]`,
+			nil,
+			func(r image.DefaultResponse) bool {
+				return reflect.DeepEqual(r.Properties, map[string]string{"os_version": "16.04"})
+			},
+		},
+		{
+			`[{"op":"replace","path":"/protected","value":true}]`,
+			nil,
+			func(r image.DefaultResponse) bool { return r.Protected },
+		},
+		{
+			`[{"op":"replace","path":"/checksum","value":"0"}]`,
+			image.ErrReadOnly,
+			nil,
+		},
+		{
+			`[{"op":"replace","path":"/missing","value":"0"}]`,
+			image.ErrBadPatch,
+			nil,
+		},
+		{
+			`[{"op":"add","path":"/min_disk","value":-1}]`,
+			image.ErrBadPatch,
+			nil,
+		},
+		{
+			`[{"op":"remove","path":"/os_version"},{"op":"move","path":"/name"}]`,
+			image.ErrBadPatch,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		var ops []image.PatchOperation
+
+		err := json.Unmarshal([]byte(tt.patch), &ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := is.UpdateImage(owner, img.ID, ops)
+		if err != tt.err {
+			t.Fatalf("%s: expected %v, got %v", tt.patch, tt.err, err)
+		}
+
+		if tt.check != nil && !tt.check(resp) {
+			t.Fatalf("%s: wrong image %+v", tt.patch, resp)
+		}
+	}
+
+	// failed updates must not modify the image
+	resp, err := is.GetImage(owner, img.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(resp.Properties, map[string]string{"os_version": "16.04"}) {
+		t.Fatalf("Image modified by a failed update %+v", resp)
+	}
+
+	_, err = is.DeleteImage(owner, img.ID)
+	if err != image.ErrImageProtected {
+		t.Fatalf("Expected %v, got %v", image.ErrImageProtected, err)
+	}
+}
+
+func listedImage(t *testing.T, is ImageService, caller identity.Identity, ID string) bool {
+	images, err := is.ListImages(caller)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range images {
+		if i.ID == ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestImageVisibility(t *testing.T) {
+	is := testImageService(t)
+
+	_, err := is.CreateImage(owner, image.CreateImageRequest{Visibility: image.Public})
+	if err != image.ErrForbidden {
+		t.Fatalf("Expected %v, got %v", image.ErrForbidden, err)
+	}
+
+	_, err = is.CreateImage(owner, image.CreateImageRequest{Owner: tenant.ProjectID})
+	if err != image.ErrForbidden {
+		t.Fatalf("Expected %v, got %v", image.ErrForbidden, err)
+	}
+
+	public, err := is.CreateImage(admin, image.CreateImageRequest{Visibility: image.Public})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private, err := is.CreateImage(owner, image.CreateImageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		caller  identity.Identity
+		ID      string
+		visible bool
+		owned   bool
+	}{
+		{owner, public.ID, true, false},
+		{tenant, public.ID, true, false},
+		{admin, public.ID, true, true},
+		{owner, private.ID, true, true},
+		{tenant, private.ID, false, false},
+		{admin, private.ID, true, true},
+	}
+
+	for _, tt := range tests {
+		_, err := is.GetImage(tt.caller, tt.ID)
+		if (err == nil) != tt.visible {
+			t.Errorf("%s getting %s: got %v", tt.caller.ProjectID, tt.ID, err)
+		}
+
+		if listedImage(t, is, tt.caller, tt.ID) != tt.visible {
+			t.Errorf("%s listing %s: expected %v", tt.caller.ProjectID, tt.ID, tt.visible)
+		}
+
+		ops := []image.PatchOperation{{Op: image.PatchReplace, Path: "/name", Value: "name"}}
+		_, err = is.UpdateImage(tt.caller, tt.ID, ops)
+		if (err == nil) != tt.owned {
+			t.Errorf("%s updating %s: got %v", tt.caller.ProjectID, tt.ID, err)
+		}
+	}
+
+	_, err = is.DeleteImage(tenant, private.ID)
+	if err != image.ErrNoImage {
+		t.Fatalf("Expected %v, got %v", image.ErrNoImage, err)
+	}
+
+	_, err = is.DeleteImage(owner, public.ID)
+	if err != image.ErrForbidden {
+		t.Fatalf("Expected %v, got %v", image.ErrForbidden, err)
+	}
+
+	ops := []image.PatchOperation{{Op: image.PatchReplace, Path: "/visibility", Value: "public"}}
+	_, err = is.UpdateImage(owner, private.ID, ops)
+	if err != image.ErrForbidden {
+		t.Fatalf("Expected %v, got %v", image.ErrForbidden, err)
+	}
+
+	_, err = is.UpdateImage(admin, private.ID, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = is.GetImage(tenant, private.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImageMembers(t *testing.T) {
+	is := testImageService(t)
+
+	img, err := is.CreateImage(owner, image.CreateImageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// private images cannot be shared
+	_, err = is.AddImageMember(owner, img.ID, tenant.ProjectID)
+	if err != image.ErrForbidden {
+		t.Fatalf("Expected %v, got %v", image.ErrForbidden, err)
+	}
+
+	ops := []image.PatchOperation{{Op: image.PatchReplace, Path: "/visibility", Value: "shared"}}
+	_, err = is.UpdateImage(owner, img.ID, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = is.GetImage(tenant, img.ID)
+	if err != image.ErrNoImage {
+		t.Fatalf("Expected %v, got %v", image.ErrNoImage, err)
+	}
+
+	m, err := is.AddImageMember(owner, img.ID, tenant.ProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Status != image.MemberPending || m.MemberID != tenant.ProjectID {
+		t.Fatalf("Wrong member %+v", m)
+	}
+
+	_, err = is.AddImageMember(owner, img.ID, tenant.ProjectID)
+	if err != image.ErrAlreadyExists {
+		t.Fatalf("Expected %v, got %v", image.ErrAlreadyExists, err)
+	}
+
+	// pending members can use the image, but do not list it
+	_, err = is.GetImage(tenant, img.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if listedImage(t, is, tenant, img.ID) {
+		t.Fatal("Pending shared image listed")
+	}
+
+	_, err = is.UpdateImageMember(owner, img.ID, tenant.ProjectID, image.MemberAccepted)
+	if err != image.ErrForbidden {
+		t.Fatalf("Expected %v, got %v", image.ErrForbidden, err)
+	}
+
+	_, err = is.UpdateImageMember(tenant, img.ID, tenant.ProjectID, image.MemberAccepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !listedImage(t, is, tenant, img.ID) {
+		t.Fatal("Accepted shared image not listed")
+	}
+
+	members, err := is.ListImageMembers(tenant, img.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(members) != 1 || members[0].Status != image.MemberAccepted {
+		t.Fatalf("Wrong members %+v", members)
+	}
+
+	_, err = is.DeleteImage(tenant, img.ID)
+	if err != image.ErrForbidden {
+		t.Fatalf("Expected %v, got %v", image.ErrForbidden, err)
+	}
+
+	err = is.DeleteImageMember(tenant, img.ID, tenant.ProjectID)
+	if err != image.ErrForbidden {
+		t.Fatalf("Expected %v, got %v", image.ErrForbidden, err)
+	}
+
+	err = is.DeleteImageMember(owner, img.ID, tenant.ProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = is.GetImage(tenant, img.ID)
+	if err != image.ErrNoImage {
+		t.Fatalf("Expected %v, got %v", image.ErrNoImage, err)
+	}
+
+	_, err = is.GetImageMember(owner, img.ID, tenant.ProjectID)
+	if err != image.ErrNoMember {
+		t.Fatalf("Expected %v, got %v", image.ErrNoMember, err)
+	}
+}
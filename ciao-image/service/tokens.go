@@ -0,0 +1,184 @@
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/01org/ciao/openstack/identity"
+	"github.com/01org/ciao/openstack/image"
+	"github.com/gorilla/mux"
+)
+
+// tokenLifetime is how long an image token can be used after its creation.
+const tokenLifetime = time.Hour
+
+// imageToken describes what an image token grants access to.
+type imageToken struct {
+	imageID   string
+	scope     image.TokenScope
+	expiresAt time.Time
+}
+
+// tokenStore holds the image tokens which have not been used or have not
+// expired yet.
+type tokenStore struct {
+	sync.Mutex
+	tokens map[string]imageToken
+}
+
+func newTokenStore() *tokenStore {
+	return &tokenStore{
+		tokens: make(map[string]imageToken),
+	}
+}
+
+// create returns a new token granting access to imageID within scope.
+func (s *tokenStore) create(imageID string, scope image.TokenScope) (string, imageToken, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", imageToken{}, err
+	}
+
+	token := hex.EncodeToString(b)
+	t := imageToken{
+		imageID:   imageID,
+		scope:     scope,
+		expiresAt: time.Now().Add(tokenLifetime),
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for k, v := range s.tokens {
+		if time.Now().After(v.expiresAt) {
+			delete(s.tokens, k)
+		}
+	}
+	s.tokens[token] = t
+
+	return token, t, nil
+}
+
+// check returns true if token grants access to imageID within scope.
+// Upload tokens can only be used once.
+func (s *tokenStore) check(token string, imageID string, scope image.TokenScope) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	t, ok := s.tokens[token]
+	if !ok || t.imageID != imageID || t.scope != scope {
+		return false
+	}
+
+	if time.Now().After(t.expiresAt) {
+		delete(s.tokens, token)
+		return false
+	}
+
+	if scope == image.UploadScope {
+		delete(s.tokens, token)
+	}
+
+	return true
+}
+
+// CreateImageToken creates a short-lived token which grants access to the
+// image identified by imageID, within scope, to whoever presents it.  Only
+// admins can create image tokens.
+func (is ImageService) CreateImageToken(caller identity.Identity, imageID string, scope image.TokenScope) (image.TokenResponse, error) {
+	var response image.TokenResponse
+
+	if !caller.Admin {
+		return response, image.ErrForbidden
+	}
+
+	if scope != image.UploadScope && scope != image.DownloadScope {
+		return response, image.ErrBadProperty
+	}
+
+	_, err := is.getImage(caller, imageID)
+	if err != nil {
+		return response, err
+	}
+
+	token, t, err := is.tokens.create(imageID, scope)
+	if err != nil {
+		return response, err
+	}
+
+	response.Token = token
+	response.Scope = t.scope
+	response.ImageID = t.imageID
+	response.ExpiresAt = t.expiresAt
+
+	return response, nil
+}
+
+// tokenScope returns the scope an image token must have to grant access
+// to the resource of the image identified by imageID requested by r.
+func tokenScope(r *http.Request, imageID string) (image.TokenScope, bool) {
+	imagePath := "/v2/images/" + imageID
+
+	switch {
+	case r.Method == "PUT" && r.URL.Path == imagePath+"/file":
+		return image.UploadScope, true
+	case r.Method == "GET" && (r.URL.Path == imagePath || r.URL.Path == imagePath+"/file"):
+		return image.DownloadScope, true
+	}
+
+	return "", false
+}
+
+// tokenHandler serves the requests which present an image token with
+// Next, as if they had been made by the owner of the image, and the other
+// requests with Fallback, which authenticates them with keystone.
+type tokenHandler struct {
+	is       ImageService
+	Next     http.Handler
+	Fallback http.Handler
+}
+
+func (h tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get(image.TokenHeader)
+	if token == "" {
+		h.Fallback.ServeHTTP(w, r)
+		return
+	}
+
+	imageID := mux.Vars(r)["image_id"]
+	scope, ok := tokenScope(r, imageID)
+	if !ok || !h.is.tokens.check(token, imageID, scope) {
+		http.Error(w, "Invalid image token", http.StatusUnauthorized)
+		return
+	}
+
+	img, err := h.is.ds.GetImage(imageID)
+	if err != nil {
+		http.Error(w, "Invalid image token", http.StatusUnauthorized)
+		return
+	}
+
+	id := identity.Identity{
+		ProjectID: img.TenantID,
+	}
+
+	h.Next.ServeHTTP(w, identity.WithIdentity(r, id))
+}
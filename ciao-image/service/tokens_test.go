@@ -0,0 +1,145 @@
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/01org/ciao/openstack/identity"
+	"github.com/01org/ciao/openstack/image"
+	"github.com/gorilla/mux"
+)
+
+func TestCreateImageToken(t *testing.T) {
+	is := testImageService(t)
+
+	img, err := is.CreateImage(owner, image.CreateImageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = is.CreateImageToken(owner, img.ID, image.UploadScope)
+	if err != image.ErrForbidden {
+		t.Fatalf("Expected %v, got %v", image.ErrForbidden, err)
+	}
+
+	_, err = is.CreateImageToken(admin, img.ID, "delete")
+	if err != image.ErrBadProperty {
+		t.Fatalf("Expected %v, got %v", image.ErrBadProperty, err)
+	}
+
+	_, err = is.CreateImageToken(admin, "unknown", image.UploadScope)
+	if err != image.ErrNoImage {
+		t.Fatalf("Expected %v, got %v", image.ErrNoImage, err)
+	}
+
+	resp, err := is.CreateImageToken(admin, img.ID, image.UploadScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Token == "" || resp.ImageID != img.ID || resp.Scope != image.UploadScope ||
+		resp.ExpiresAt.IsZero() {
+		t.Fatalf("Wrong token created %+v", resp)
+	}
+}
+
+func TestTokenHandler(t *testing.T) {
+	is := testImageService(t)
+
+	img, err := is.CreateImage(owner, image.CreateImageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := is.CreateImage(owner, image.CreateImageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := is.CreateImageToken(admin, img.ID, image.UploadScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	download, err := is.CreateImageToken(admin, img.ID, image.DownloadScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var caller *identity.Identity
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := identity.GetIdentity(r)
+		caller = &id
+	})
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	h := tokenHandler{
+		is:       is,
+		Next:     next,
+		Fallback: fallback,
+	}
+	r := mux.NewRouter()
+	r.Handle("/v2/images/{image_id}", h)
+	r.Handle("/v2/images/{image_id}/file", h)
+	r.Handle("/v2/images/{image_id}/members", h)
+
+	tests := []struct {
+		method  string
+		path    string
+		imageID string
+		token   string
+		status  int
+	}{
+		{"PUT", "/file", img.ID, "", http.StatusTeapot},
+		{"PUT", "/file", img.ID, "invalid", http.StatusUnauthorized},
+		{"PUT", "/file", other.ID, resp.Token, http.StatusUnauthorized},
+		{"GET", "/file", img.ID, resp.Token, http.StatusUnauthorized},
+		{"PUT", "/file", img.ID, download.Token, http.StatusUnauthorized},
+		{"PUT", "/file", img.ID, resp.Token, http.StatusOK},
+		{"PUT", "/file", img.ID, resp.Token, http.StatusUnauthorized},
+		{"GET", "/file", other.ID, download.Token, http.StatusUnauthorized},
+		{"GET", "/members", img.ID, download.Token, http.StatusUnauthorized},
+		{"GET", "", img.ID, download.Token, http.StatusOK},
+		{"GET", "/file", img.ID, download.Token, http.StatusOK},
+		{"GET", "/file", img.ID, download.Token, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		caller = nil
+
+		req := httptest.NewRequest(tt.method, "/v2/images/"+tt.imageID+tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set(image.TokenHeader, tt.token)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s%s with token %q: expected %d, got %d",
+				tt.method, tt.imageID, tt.path, tt.token, tt.status, w.Code)
+		}
+
+		if tt.status == http.StatusOK &&
+			(caller == nil || caller.ProjectID != owner.ProjectID || caller.Admin) {
+			t.Errorf("Request served with wrong identity %+v", caller)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/golang/glog"
+)
+
+// cgroupParent is the cgroup, in each of the cgroupSubsystems
+// hierarchies, under which launcher creates one cgroup per instance.
+const cgroupParent = "ciao"
+
+// cpuPeriod is the CFS period, in microseconds, used to enforce CPU quotas.
+const cpuPeriod = 100000
+
+// defaultCPUShares is the kernel's default cpu.shares value.  It is used
+// when an instance has no CPUShares limit.
+const defaultCPUShares = 1024
+
+// cgroupRoot is the directory under which the cgroup hierarchies are
+// mounted.  It is a variable so that it can be overridden by the unit tests.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// sysBlockDevices is the sysfs directory that describes block devices.
+var sysBlockDevices = "/sys/dev/block"
+
+var cgroupSubsystems = []string{"cpu", "memory", "blkio"}
+
+// resourceLimits contains the limits that are enforced on the host
+// resources used by an instance.  A zero value means that the corresponding
+// resource is not limited.
+type resourceLimits struct {
+	// CPUShares is the relative weight of the instance when CPU time is
+	// shared between instances.
+	CPUShares int
+
+	// CPUQuota is the maximum CPU time the instance can use, as a
+	// percentage of a single CPU.
+	CPUQuota int
+
+	// MemLimitMB is the maximum amount of memory the instance's
+	// processes can use.
+	MemLimitMB int
+
+	// DiskIOPS is the maximum number of read and of write operations per
+	// second the instance can issue to the device holding its rootfs.
+	DiskIOPS int
+
+	// DiskMBps is the maximum number of MBs per second the instance can
+	// read from and write to the device holding its rootfs.
+	DiskMBps int
+}
+
+type cgroupSetting struct {
+	subsystem string
+	file      string
+	value     string
+}
+
+// instanceCgroup returns the path of the cgroup of instance relative to the
+// root of a cgroup hierarchy.
+func instanceCgroup(instance string) string {
+	return path.Join("/", cgroupParent, instance)
+}
+
+// cgroupSettings returns the values that need to be written to the cgroup
+// files of an instance to enforce l.  Limits that are not set are reset to
+// the kernel's defaults so that they can be removed from running instances.
+// The blkio settings are only returned if device, the major:minor numbers of
+// the disk holding the instance's rootfs, is known.
+func (l *resourceLimits) cgroupSettings(device string) []cgroupSetting {
+	shares := defaultCPUShares
+	if l.CPUShares > 0 {
+		shares = l.CPUShares
+	}
+
+	quota := -1
+	if l.CPUQuota > 0 {
+		quota = l.CPUQuota * cpuPeriod / 100
+	}
+
+	memory := int64(-1)
+	if l.MemLimitMB > 0 {
+		memory = int64(l.MemLimitMB) * 1024 * 1024
+	}
+
+	settings := []cgroupSetting{
+		{"cpu", "cpu.shares", strconv.Itoa(shares)},
+		{"cpu", "cpu.cfs_period_us", strconv.Itoa(cpuPeriod)},
+		{"cpu", "cpu.cfs_quota_us", strconv.Itoa(quota)},
+		{"memory", "memory.limit_in_bytes", strconv.FormatInt(memory, 10)},
+	}
+
+	if device == "" {
+		return settings
+	}
+
+	// Writing a rate of 0 removes the throttling rule for device.
+	iops := fmt.Sprintf("%s %d", device, l.DiskIOPS)
+	bps := fmt.Sprintf("%s %d", device, int64(l.DiskMBps)*1024*1024)
+
+	return append(settings,
+		cgroupSetting{"blkio", "blkio.throttle.read_iops_device", iops},
+		cgroupSetting{"blkio", "blkio.throttle.write_iops_device", iops},
+		cgroupSetting{"blkio", "blkio.throttle.read_bps_device", bps},
+		cgroupSetting{"blkio", "blkio.throttle.write_bps_device", bps})
+}
+
+// blockDevice returns the major:minor numbers of the disk that holds the
+// file or directory p.  Disk IO can only be throttled on whole disks so the
+// numbers of the parent disk are returned if p is stored on a partition.
+func blockDevice(p string) (string, error) {
+	var st syscall.Stat_t
+
+	err := syscall.Stat(p, &st)
+	if err != nil {
+		return "", err
+	}
+
+	dev := uint64(st.Dev)
+	major := ((dev >> 8) & 0xfff) | ((dev >> 32) &^ 0xfff)
+	minor := (dev & 0xff) | ((dev >> 12) &^ 0xff)
+	device := fmt.Sprintf("%d:%d", major, minor)
+
+	sysPath, err := filepath.EvalSymlinks(path.Join(sysBlockDevices, device))
+	if err != nil {
+		return "", fmt.Errorf("%s is not stored on a block device", p)
+	}
+
+	if _, err = os.Stat(path.Join(sysPath, "partition")); err != nil {
+		return device, nil
+	}
+
+	parent, err := ioutil.ReadFile(path.Join(path.Dir(sysPath), "dev"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(parent)), nil
+}
+
+// applyCgroupLimits creates the cgroups of instance, if they do not already
+// exist, and sets their limits.  If pid is not 0, the process is moved into
+// these cgroups.  The disk IO limits are enforced on the disk holding
+// dataDir.
+func applyCgroupLimits(instance string, pid int, limits resourceLimits, dataDir string) error {
+	device, err := blockDevice(dataDir)
+	if err != nil {
+		if limits.DiskIOPS > 0 || limits.DiskMBps > 0 {
+			return fmt.Errorf("Unable to limit disk IO: %v", err)
+		}
+		device = ""
+	}
+
+	cgroup := instanceCgroup(instance)
+	for _, subsystem := range cgroupSubsystems {
+		err = os.MkdirAll(path.Join(cgroupRoot, subsystem, cgroup), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range limits.cgroupSettings(device) {
+		p := path.Join(cgroupRoot, s.subsystem, cgroup, s.file)
+		err = ioutil.WriteFile(p, []byte(s.value), 0644)
+		if err != nil {
+			return fmt.Errorf("Unable to set %s to %s: %v", s.file, s.value, err)
+		}
+	}
+
+	if pid == 0 {
+		return nil
+	}
+
+	for _, subsystem := range cgroupSubsystems {
+		p := path.Join(cgroupRoot, subsystem, cgroup, "cgroup.procs")
+		err = ioutil.WriteFile(p, []byte(strconv.Itoa(pid)), 0644)
+		if err != nil {
+			return fmt.Errorf("Unable to add %d to %s cgroup: %v", pid, subsystem, err)
+		}
+	}
+
+	return nil
+}
+
+// removeCgroup removes the cgroups of instance.  The cgroups can only be
+// removed once the instance's processes have exited.
+func removeCgroup(instance string) {
+	cgroup := instanceCgroup(instance)
+	for _, subsystem := range cgroupSubsystems {
+		err := os.Remove(path.Join(cgroupRoot, subsystem, cgroup))
+		if err != nil && !os.IsNotExist(err) {
+			glog.Warningf("Unable to remove %s cgroup of %s: %v", subsystem, instance, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestCgroupSettings(t *testing.T) {
+	tests := []struct {
+		limits   resourceLimits
+		device   string
+		expected []cgroupSetting
+	}{
+		{
+			resourceLimits{},
+			"",
+			[]cgroupSetting{
+				{"cpu", "cpu.shares", "1024"},
+				{"cpu", "cpu.cfs_period_us", "100000"},
+				{"cpu", "cpu.cfs_quota_us", "-1"},
+				{"memory", "memory.limit_in_bytes", "-1"},
+			},
+		},
+		{
+			resourceLimits{CPUShares: 512, CPUQuota: 150, MemLimitMB: 256,
+				DiskIOPS: 100, DiskMBps: 10},
+			"8:0",
+			[]cgroupSetting{
+				{"cpu", "cpu.shares", "512"},
+				{"cpu", "cpu.cfs_period_us", "100000"},
+				{"cpu", "cpu.cfs_quota_us", "150000"},
+				{"memory", "memory.limit_in_bytes", "268435456"},
+				{"blkio", "blkio.throttle.read_iops_device", "8:0 100"},
+				{"blkio", "blkio.throttle.write_iops_device", "8:0 100"},
+				{"blkio", "blkio.throttle.read_bps_device", "8:0 10485760"},
+				{"blkio", "blkio.throttle.write_bps_device", "8:0 10485760"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		settings := test.limits.cgroupSettings(test.device)
+		if !reflect.DeepEqual(settings, test.expected) {
+			t.Errorf("Unexpected settings for %+v: %v", test.limits, settings)
+		}
+	}
+}
+
+func TestApplyCgroupLimits(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup-test")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(root) }()
+
+	savedRoot := cgroupRoot
+	cgroupRoot = root
+	defer func() { cgroupRoot = savedRoot }()
+
+	limits := resourceLimits{CPUShares: 512, MemLimitMB: 256}
+	err = applyCgroupLimits("testInstance", 1000, limits, root)
+	if err != nil {
+		t.Fatalf("applyCgroupLimits failed: %v", err)
+	}
+
+	files := map[string]string{
+		"cpu/ciao/testInstance/cpu.shares":               "512",
+		"cpu/ciao/testInstance/cgroup.procs":             "1000",
+		"memory/ciao/testInstance/memory.limit_in_bytes": "268435456",
+		"blkio/ciao/testInstance/cgroup.procs":           "1000",
+	}
+	for f, expected := range files {
+		data, err := ioutil.ReadFile(path.Join(root, f))
+		if err != nil {
+			t.Errorf("Unable to read %s: %v", f, err)
+			continue
+		}
+		if string(data) != expected {
+			t.Errorf("Unexpected contents of %s: %s", f, string(data))
+		}
+	}
+}
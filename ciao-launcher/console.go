@@ -0,0 +1,178 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/ssntp"
+	"github.com/golang/glog"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	consoleLogName = "console.log"
+
+	// consoleLogMaxSize is the size in bytes above which the console log
+	// of an instance is rotated.
+	consoleLogMaxSize = 1 << 20
+
+	// consoleRotateInterval is how often the console log size is checked.
+	consoleRotateInterval = 30 * time.Second
+
+	// consoleOutputMaxSize bounds the size of the console output sent
+	// to the controller.
+	consoleOutputMaxSize = 64 << 10
+)
+
+var errNoConsoleLog = errors.New("No console log")
+
+// rotateConsoleLog moves the contents of the console log stored at logPath
+// to logPath.1 once the log is bigger than maxSize.  The log is copied and
+// truncated rather than renamed as qemu keeps it open.  Qemu opens the log
+// in append mode so its next writes go to the start of the truncated file.
+// Anything written between the copy and the truncation is lost.
+func rotateConsoleLog(logPath string, maxSize int64) error {
+	fi, err := os.Stat(logPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if fi.Size() <= maxSize {
+		return nil
+	}
+
+	src, err := os.OpenFile(logPath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.Create(logPath + ".1")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		_ = dst.Close()
+		return err
+	}
+
+	err = dst.Close()
+	if err != nil {
+		return err
+	}
+
+	return src.Truncate(0)
+}
+
+// readTail returns at most max bytes from the end of the file at path.
+func readTail(path string, max int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.Size() > max {
+		_, err = f.Seek(fi.Size()-max, os.SEEK_SET)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ioutil.ReadAll(io.LimitReader(f, max))
+}
+
+// tailLines returns the last n lines of data, or all of data if n is 0.
+func tailLines(data []byte, n int) []byte {
+	if n <= 0 {
+		return data
+	}
+
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+
+	for ; n > 0; n-- {
+		end = bytes.LastIndexByte(data[:end], '\n')
+		if end < 0 {
+			return data
+		}
+	}
+
+	return data[end+1:]
+}
+
+// tailConsoleLog returns the last lines of the console log stored at
+// logPath, or the whole log if lines is 0.  The end of the rotated log is
+// included when the current log is shorter than consoleOutputMaxSize, which
+// also bounds the size of the output.
+func tailConsoleLog(logPath string, lines int) (string, error) {
+	data, err := readTail(logPath, consoleOutputMaxSize)
+	if os.IsNotExist(err) {
+		return "", errNoConsoleLog
+	} else if err != nil {
+		return "", err
+	}
+
+	if len(data) < consoleOutputMaxSize {
+		rotated, err := readTail(logPath+".1", consoleOutputMaxSize-int64(len(data)))
+		if err == nil {
+			data = append(rotated, data...)
+		}
+	}
+
+	return string(tailLines(data, lines)), nil
+}
+
+// sendConsoleOutput sends the console output of an instance, in reply to
+// the GetConsole command identified by request, to the controller, which
+// waits for it, so it is queued if the launcher is disconnected.
+func sendConsoleOutput(conn serverConn, instance, request, output string) {
+	var event payloads.EventConsoleOutput
+
+	event.ConsoleOutput.InstanceUUID = instance
+	event.ConsoleOutput.RequestUUID = request
+	event.ConsoleOutput.Output = output
+
+	payload, err := yaml.Marshal(&event)
+	if err != nil {
+		glog.Errorf("Unable to Marshall ConsoleOutput %v", err)
+		return
+	}
+
+	_, err = conn.SendEvent(ssntp.ConsoleOutput, payload)
+	if err != nil {
+		glog.Errorf("Failed to send event command %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestTailLines(t *testing.T) {
+	tests := []struct {
+		data     string
+		lines    int
+		expected string
+	}{
+		{"", 10, ""},
+		{"a\nb\nc\n", 0, "a\nb\nc\n"},
+		{"a\nb\nc\n", 1, "c\n"},
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc\n", 3, "a\nb\nc\n"},
+		{"a\nb\nc\n", 10, "a\nb\nc\n"},
+		{"a\nb\nc", 1, "c"},
+		{"a\nb\nc", 2, "b\nc"},
+	}
+
+	for _, test := range tests {
+		tail := string(tailLines([]byte(test.data), test.lines))
+		if tail != test.expected {
+			t.Errorf("tailLines(%q, %d) = %q, expected %q", test.data,
+				test.lines, tail, test.expected)
+		}
+	}
+}
+
+// Checks that console logs are rotated and read back correctly.
+//
+// This test writes a console log, rotates it, appends to the truncated log
+// and reads back the tail of the log.
+//
+// The log should only be rotated once it exceeds the maximum size and
+// tailConsoleLog should return lines from both the rotated and the current
+// log.
+func TestRotateConsoleLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "console-test")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	logPath := path.Join(dir, consoleLogName)
+
+	_, err = tailConsoleLog(logPath, 0)
+	if err != errNoConsoleLog {
+		t.Errorf("errNoConsoleLog expected, got %v", err)
+	}
+
+	err = rotateConsoleLog(logPath, 8)
+	if err != nil {
+		t.Errorf("Rotating a missing log should succeed: %v", err)
+	}
+
+	err = ioutil.WriteFile(logPath, []byte("line 1\nline 2\n"), 0644)
+	if err != nil {
+		t.Fatalf("Unable to write console log: %v", err)
+	}
+
+	err = rotateConsoleLog(logPath, 1024)
+	if err != nil {
+		t.Fatalf("Unable to rotate console log: %v", err)
+	}
+	if _, err = os.Stat(logPath + ".1"); err == nil {
+		t.Errorf("Console log should not have been rotated")
+	}
+
+	err = rotateConsoleLog(logPath, 8)
+	if err != nil {
+		t.Fatalf("Unable to rotate console log: %v", err)
+	}
+
+	fi, err := os.Stat(logPath)
+	if err != nil || fi.Size() != 0 {
+		t.Errorf("Console log should have been truncated")
+	}
+
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Unable to open console log: %v", err)
+	}
+	_, err = f.WriteString("line 3\n")
+	_ = f.Close()
+	if err != nil {
+		t.Fatalf("Unable to write console log: %v", err)
+	}
+
+	output, err := tailConsoleLog(logPath, 2)
+	if err != nil {
+		t.Fatalf("Unable to read console log: %v", err)
+	}
+	if output != "line 2\nline 3\n" {
+		t.Errorf("Unexpected console output %q", output)
+	}
+}
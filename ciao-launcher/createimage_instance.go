@@ -0,0 +1,118 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	osimage "github.com/01org/ciao/openstack/image"
+	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
+)
+
+func processCreateImage(vm virtualizer, monitorCh chan interface{}, cfg *vmConfig,
+	instanceDir, image string) (string, *createImageError) {
+
+	if !cfg.Container && cfg.Image == "" {
+		createErr := &createImageError{nil, payloads.CreateImageSnapshotFailure}
+		glog.Errorf("Instance %s has no rootfs [%s]", cfg.Instance, string(createErr.code))
+		return "", createErr
+	}
+
+	target := path.Join(instanceDir, "snapshot-"+image)
+
+	var err error
+	if monitorCh != nil {
+		responseCh := make(chan error)
+		monitorCh <- virtualizerSnapshotCmd{
+			responseCh: responseCh,
+			target:     target,
+		}
+		err = <-responseCh
+	} else {
+		err = vm.snapshot(target)
+	}
+
+	if err != nil {
+		_ = os.Remove(target)
+		createErr := &createImageError{err, payloads.CreateImageSnapshotFailure}
+		glog.Errorf("Unable to snapshot instance %s [%s]: %v", cfg.Instance,
+			string(createErr.code), err)
+		return "", createErr
+	}
+
+	glog.Infof("Snapshot of instance %s stored in %s", cfg.Instance, target)
+
+	return target, nil
+}
+
+// uploadSnapshot uploads the snapshot stored in target to image on the
+// image service located at url and then deletes target.  The upload is
+// cancelled if doneCh is closed.
+func uploadSnapshot(doneCh chan struct{}, target, url, image, token string) *createImageError {
+	defer func() {
+		_ = os.Remove(target)
+	}()
+
+	f, err := os.Open(target)
+	if err != nil {
+		glog.Errorf("Unable to open snapshot %s: %v", target, err)
+		return &createImageError{err, payloads.CreateImageSnapshotFailure}
+	}
+	defer func() { _ = f.Close() }()
+
+	fileURL := fmt.Sprintf("%s/v2/images/%s/file", strings.TrimSuffix(url, "/"), image)
+	req, err := http.NewRequest("PUT", fileURL, f)
+	if err != nil {
+		glog.Errorf("Unable to create request for %s: %v", fileURL, err)
+		return &createImageError{err, payloads.CreateImageUploadFailure}
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if token != "" {
+		req.Header.Set(osimage.TokenHeader, token)
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	go func() {
+		select {
+		case <-doneCh:
+			cancelFunc()
+		case <-ctx.Done():
+		}
+	}()
+
+	resp, err := imageServiceClient(imageServiceTransferTimeout).Do(req.WithContext(ctx))
+	if err != nil {
+		glog.Errorf("Unable to upload snapshot to %s: %v", fileURL, err)
+		return &createImageError{err, payloads.CreateImageUploadFailure}
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		err = fmt.Errorf("Unexpected status %s", resp.Status)
+		glog.Errorf("Unable to upload snapshot to %s: %v", fileURL, err)
+		return &createImageError{err, payloads.CreateImageUploadFailure}
+	}
+
+	return nil
+}
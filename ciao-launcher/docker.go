@@ -17,6 +17,7 @@
 package main
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -24,6 +25,8 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -44,6 +47,14 @@ import (
 
 const volumesDir = "volumes"
 
+// dockerImagesTimeout bounds the time spent listing the docker images
+// present on the node, which is done in the background for the overseer.
+const dockerImagesTimeout = 2 * time.Second
+
+// dockerDataDir is the directory in which docker stores the rootfs of its
+// containers.  Disk IO limits are enforced on the disk that holds it.
+const dockerDataDir = "/var/lib/docker"
+
 var dockerClient struct {
 	sync.Mutex
 	cli *client.Client
@@ -95,6 +106,43 @@ func getDockerClient() (cli *client.Client, err error) {
 	return cli, err
 }
 
+// dockerImages returns the names of the docker images present on the node.
+// Images tagged latest are also listed under their untagged name, which is
+// how START payloads usually refer to them.
+func dockerImages() []string {
+	cli, err := getDockerClient()
+	if err != nil {
+		return nil
+	}
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), dockerImagesTimeout)
+	defer cancelFunc()
+
+	images, err := cli.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		if glog.V(1) {
+			glog.Infof("Unable to list docker images: %v", err)
+		}
+		return nil
+	}
+
+	var names []string
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			if tag == "<none>:<none>" {
+				continue
+			}
+
+			names = append(names, tag)
+			if strings.HasSuffix(tag, ":latest") {
+				names = append(names, strings.TrimSuffix(tag, ":latest"))
+			}
+		}
+	}
+
+	return names
+}
+
 func (d *docker) init(cfg *vmConfig, instanceDir string) {
 	d.cfg = cfg
 	d.instanceDir = instanceDir
@@ -210,6 +258,11 @@ func (d *docker) createConfigs(bridge string, userData, metaData []byte, volumes
 
 	hostConfig = &container.HostConfig{Binds: volumes}
 
+	// The container's cgroups are created under the instance's cgroups so
+	// that the limits set by setLimits apply to the container and can be
+	// updated while it is running.
+	hostConfig.CgroupParent = instanceCgroup(d.cfg.Instance)
+
 	if d.cfg.Mem > 0 {
 		// Docker memory limit is in bytes.
 		hostConfig.Memory = int64(1024 * 1024 * d.cfg.Mem)
@@ -336,6 +389,36 @@ func (d *docker) createImage(bridge string, userData, metaData []byte) error {
 	return nil
 }
 
+// resize updates the memory and CPU limits of the container.  The size of a
+// container's rootfs is determined by docker and cannot be changed.
+func (d *docker) resize() error {
+	if d.dockerID == "" {
+		return fmt.Errorf("Container for %s does not exist", d.cfg.Instance)
+	}
+
+	cli, err := getDockerClient()
+	if err != nil {
+		return err
+	}
+
+	var update container.UpdateConfig
+	if d.cfg.Mem > 0 {
+		update.Memory = int64(1024 * 1024 * d.cfg.Mem)
+	}
+
+	if d.cfg.Cpus > 0 {
+		update.CPUPeriod = 100 * 1000
+		update.CPUQuota = update.CPUPeriod * int64(d.cfg.Cpus)
+	}
+
+	err = cli.ContainerUpdate(context.Background(), d.dockerID, update)
+	if err != nil {
+		glog.Errorf("Unable to update container %s: %v", d.dockerID, err)
+	}
+
+	return err
+}
+
 func (d *docker) deleteImage() error {
 	if d.dockerID == "" {
 		return nil
@@ -359,6 +442,63 @@ func (d *docker) deleteImage() error {
 	return nil
 }
 
+// dockerSnapshot commits the container dockerID to a temporary image and
+// saves that image as a tar archive in target.  The temporary image is
+// removed once it has been saved.
+func dockerSnapshot(cli *client.Client, dockerID, target string) error {
+	commit, err := cli.ContainerCommit(context.Background(),
+		types.ContainerCommitOptions{
+			ContainerID: dockerID,
+			Pause:       true,
+		})
+	if err != nil {
+		return fmt.Errorf("Unable to commit container %s: %v", dockerID, err)
+	}
+
+	defer func() {
+		_, err := cli.ImageRemove(context.Background(),
+			types.ImageRemoveOptions{
+				ImageID:       commit.ID,
+				PruneChildren: true,
+			})
+		if err != nil {
+			glog.Warningf("Unable to remove image %s: %v", commit.ID, err)
+		}
+	}()
+
+	reader, err := cli.ImageSave(context.Background(), []string{commit.ID})
+	if err != nil {
+		return fmt.Errorf("Unable to save image %s: %v", commit.ID, err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, reader)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("Unable to write image %s: %v", commit.ID, err)
+	}
+
+	return f.Close()
+}
+
+func (d *docker) snapshot(target string) error {
+	if d.dockerID == "" {
+		return fmt.Errorf("Container for %s does not exist", d.cfg.Instance)
+	}
+
+	cli, err := getDockerClient()
+	if err != nil {
+		return err
+	}
+
+	return dockerSnapshot(cli, d.dockerID, target)
+}
+
 func (d *docker) startVM(vnicName, ipAddress, cephID string) error {
 	cli, err := getDockerClient()
 	if err != nil {
@@ -415,6 +555,11 @@ DONE:
 			case virtualizerDetachCmd:
 				err := fmt.Errorf("Live Detach of volumes not supported for containers")
 				cmd.responseCh <- err
+			case virtualizerMigrateCmd:
+				err := fmt.Errorf("Migration not supported for containers")
+				cmd.responseCh <- err
+			case virtualizerSnapshotCmd:
+				cmd.responseCh <- dockerSnapshot(cli, dockerID, cmd.target)
 			}
 		}
 	}
@@ -551,6 +696,73 @@ func (d *docker) stats() (disk, memory, cpu int) {
 	return
 }
 
+// readDockerLogs demultiplexes the stdout and stderr streams returned by
+// the docker logs API.  Each frame starts with an 8 byte header holding the
+// stream type and the big endian size of the frame.  Only the last max bytes
+// of output are returned.
+func readDockerLogs(r io.Reader, max int) ([]byte, error) {
+	var output []byte
+	header := make([]byte, 8)
+
+	for {
+		_, err := io.ReadFull(r, header)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		size := binary.BigEndian.Uint32(header[4:])
+		frame := make([]byte, size)
+		_, err = io.ReadFull(r, frame)
+		if err != nil {
+			return nil, err
+		}
+
+		output = append(output, frame...)
+		if len(output) > max {
+			output = output[len(output)-max:]
+		}
+	}
+
+	return output, nil
+}
+
+func (d *docker) consoleLog(lines int) (string, error) {
+	if d.dockerID == "" {
+		return "", errNoConsoleLog
+	}
+
+	cli, err := getDockerClient()
+	if err != nil {
+		return "", err
+	}
+
+	tail := "all"
+	if lines > 0 {
+		tail = strconv.Itoa(lines)
+	}
+
+	resp, err := cli.ContainerLogs(context.Background(),
+		types.ContainerLogsOptions{
+			ContainerID: d.dockerID,
+			ShowStdout:  true,
+			ShowStderr:  true,
+			Tail:        tail,
+		})
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Close() }()
+
+	output, err := readDockerLogs(resp, consoleOutputMaxSize)
+	if err != nil {
+		return "", err
+	}
+
+	return string(output), nil
+}
+
 func (d *docker) connected() {
 	d.prevCPUTime = -1
 }
@@ -559,4 +771,9 @@ func (d *docker) lostVM() {
 	d.prevCPUTime = -1
 
 	d.umountVolumes(d.cfg.Volumes)
+	removeCgroup(d.cfg.Instance)
+}
+
+func (d *docker) setLimits(limits resourceLimits) error {
+	return applyCgroupLimits(d.cfg.Instance, 0, limits, dockerDataDir)
 }
@@ -17,6 +17,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -71,6 +72,10 @@ func (s dockerTestStorage) GetVolumeMapping() (map[string][]string, error) {
 	return nil, nil
 }
 
+func (s dockerTestStorage) HasImage(imageID string) bool {
+	return false
+}
+
 func (s dockerTestStorage) cleanup() error {
 	return os.RemoveAll(s.root)
 }
@@ -210,3 +215,43 @@ func TestDockerBadMount(t *testing.T) {
 		t.Fatal("mounts not cleaned up correctly")
 	}
 }
+
+func dockerLogFrame(stream byte, data string) []byte {
+	header := []byte{stream, 0, 0, 0, 0, 0, 0, byte(len(data))}
+	return append(header, data...)
+}
+
+// Checks that docker logs are correctly demultiplexed.
+//
+// This test builds a stream containing stdout and stderr frames and checks
+// that readDockerLogs returns their contents in order and honours the
+// maximum size of the output.
+//
+// The output of readDockerLogs should match the frames' contents and
+// truncated streams should be reported as errors.
+func TestReadDockerLogs(t *testing.T) {
+	var stream []byte
+	stream = append(stream, dockerLogFrame(1, "ciao ")...)
+	stream = append(stream, dockerLogFrame(2, "login:")...)
+
+	output, err := readDockerLogs(bytes.NewReader(stream), 1024)
+	if err != nil {
+		t.Fatalf("readDockerLogs failed: %v", err)
+	}
+	if string(output) != "ciao login:" {
+		t.Errorf("Unexpected output %q", output)
+	}
+
+	output, err = readDockerLogs(bytes.NewReader(stream), 6)
+	if err != nil {
+		t.Fatalf("readDockerLogs failed: %v", err)
+	}
+	if string(output) != "login:" {
+		t.Errorf("Unexpected output %q", output)
+	}
+
+	_, err = readDockerLogs(bytes.NewReader(stream[:len(stream)-1]), 1024)
+	if err == nil {
+		t.Errorf("readDockerLogs should fail on truncated frames")
+	}
+}
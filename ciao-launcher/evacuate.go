@@ -0,0 +1,79 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"os/exec"
+	"sync"
+
+	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
+)
+
+type evacuateCmd struct {
+	nextState payloads.EvacuateNextState
+}
+
+// nextStateCommands maps the states an evacuated node can be asked to reach
+// to the commands that take the node there.  The maintenance and update
+// states have no command, the node simply stays in maintenance mode, either
+// until the launcher is restarted or until its software has been updated.
+var nextStateCommands = map[payloads.EvacuateNextState][]string{
+	payloads.NextStateShutdown: {"systemctl", "poweroff"},
+	payloads.NextStateReboot:   {"systemctl", "reboot"},
+}
+
+/*
+evacuateInstance asks the server loop to remove an instance from the node.
+For the same reasons as killMe, the overseer cannot send this request to
+the server loop directly, so we spawn a go routine to do so.
+*/
+
+func evacuateInstance(instance string, doneCh chan struct{}, ac *agentClient, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		cmd := &cmdWrapper{instance, &insDeleteCmd{evacuate: true}}
+		select {
+		case ac.cmdCh <- cmd:
+		case <-doneCh:
+		}
+		wg.Done()
+	}()
+}
+
+// reachNextState takes an evacuated node to its next state once all the
+// instance go routines tracked by wg have exited.
+func reachNextState(nextState payloads.EvacuateNextState, wg *sync.WaitGroup) {
+	args := nextStateCommands[nextState]
+	if args == nil {
+		glog.Infof("Node evacuated.  Staying in maintenance mode (%s)", nextState)
+		return
+	}
+
+	if simulate {
+		glog.Infof("Node evacuated.  Simulation, not running %v", args)
+		return
+	}
+
+	go func() {
+		wg.Wait()
+		glog.Infof("Node evacuated.  Running %v", args)
+		if err := exec.Command(args[0], args[1:]...).Run(); err != nil {
+			glog.Errorf("Unable to reach %s state: %v", nextState, err)
+		}
+	}()
+}
@@ -17,8 +17,22 @@
 package main
 
 import (
+	"crypto/md5"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
 	"sync"
+	"time"
 
+	osimage "github.com/01org/ciao/openstack/image"
 	"github.com/golang/glog"
 )
 
@@ -33,8 +47,82 @@ var imagesMap struct {
 	images map[string]*imageStats
 }
 
+type imageDownload struct {
+	done chan struct{}
+	err  error
+}
+
+var downloadsMap struct {
+	sync.Mutex
+	downloads map[string]*imageDownload
+}
+
 func init() {
 	imagesMap.images = make(map[string]*imageStats)
+	downloadsMap.downloads = make(map[string]*imageDownload)
+}
+
+// Timeouts of the requests made to the image service.  Transfers of image
+// data can legitimately take a long time, so they get a much longer overall
+// timeout than the other requests, but establishing the connection and
+// waiting for the response headers are bounded for all of them.
+const (
+	imageServiceDialTimeout     = 30 * time.Second
+	imageServiceResponseTimeout = 5 * time.Minute
+	imageServiceRequestTimeout  = 2 * time.Minute
+	imageServiceTransferTimeout = 2 * time.Hour
+)
+
+var imageServiceTransport struct {
+	sync.Once
+	transport *http.Transport
+}
+
+// newImageServiceTransport returns a transport which trusts the cluster CA,
+// found in caCertPath, in addition to the system CAs.
+func newImageServiceTransport(caCertPath string) *http.Transport {
+	tlsConfig := &tls.Config{}
+
+	if caCertPath != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := ioutil.ReadFile(caCertPath)
+		if err != nil {
+			glog.Warningf("Unable to read CA certificate %s: %v", caCertPath, err)
+		} else if !pool.AppendCertsFromPEM(pem) {
+			glog.Warningf("No CA certificate found in %s", caCertPath)
+		} else {
+			tlsConfig.RootCAs = pool
+		}
+	}
+
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   imageServiceDialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   imageServiceDialTimeout,
+		ResponseHeaderTimeout: imageServiceResponseTimeout,
+		IdleConnTimeout:       90 * time.Second,
+	}
+}
+
+// imageServiceClient returns a client for the image service whose requests
+// time out after timeout.
+func imageServiceClient(timeout time.Duration) *http.Client {
+	imageServiceTransport.Do(func() {
+		imageServiceTransport.transport = newImageServiceTransport(serverCertPath)
+	})
+
+	return &http.Client{
+		Transport: imageServiceTransport.transport,
+		Timeout:   timeout,
+	}
 }
 
 // Originally this was supposed to be a generic
@@ -67,3 +155,128 @@ func getMinImageSize(vm *qemuV, imagePath string) (minSizeMB int, err error) {
 
 	return info.minSizeMB, info.err
 }
+
+// forgetImageSize drops the minimum size computed for imagePath, which
+// may be different once the image is downloaded again.
+func forgetImageSize(imagePath string) {
+	imagesMap.Lock()
+	delete(imagesMap.images, imagePath)
+	imagesMap.Unlock()
+}
+
+// downloadImage downloads image from the image service located at url and
+// stores it in dir.  Concurrent downloads of the same image are coalesced:
+// only the first caller downloads the image, the others wait for it and
+// share its result.  Unlike image sizes, download results are not cached,
+// so that a failed download can be retried by the next instance needing
+// the image.
+func downloadImage(url, token, dir, image string) error {
+	imagePath := path.Join(dir, image)
+
+	downloadsMap.Lock()
+	dl := downloadsMap.downloads[imagePath]
+	if dl == nil {
+		dl = &imageDownload{
+			done: make(chan struct{}),
+		}
+		downloadsMap.downloads[imagePath] = dl
+		downloadsMap.Unlock()
+
+		dl.err = fetchImage(url, token, imagePath, image)
+
+		downloadsMap.Lock()
+		delete(downloadsMap.downloads, imagePath)
+		downloadsMap.Unlock()
+		close(dl.done)
+	} else {
+		downloadsMap.Unlock()
+
+		<-dl.done
+	}
+
+	return dl.err
+}
+
+// fetchImage downloads image into a temporary file located next to
+// imagePath, verifies the MD5 sum of the downloaded data against the one
+// advertised by the image service, and then renames the temporary file to
+// imagePath.  A partially downloaded or corrupted image is thus never
+// visible under imagePath.
+func fetchImage(url, token, imagePath, image string) (err error) {
+	fileURL := fmt.Sprintf("%s/v2/images/%s/file", strings.TrimSuffix(url, "/"), image)
+	glog.Infof("Downloading %s from %s", image, fileURL)
+
+	req, err := http.NewRequest("GET", fileURL, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set(osimage.TokenHeader, token)
+	}
+
+	resp, err := imageServiceClient(imageServiceTransferTimeout).Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to download %s: %s", image, resp.Status)
+	}
+
+	checksum := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-MD5")))
+	if checksum == "" {
+		return fmt.Errorf("No checksum provided for %s", image)
+	}
+
+	dir := path.Dir(imagePath)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, "."+image+"-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to download %s: %v", image, err)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if sum != checksum {
+		err = fmt.Errorf("Checksum mismatch for %s: expected %s got %s", image, checksum, sum)
+		return err
+	}
+
+	err = os.Chmod(f.Name(), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(f.Name(), imagePath)
+	if err != nil {
+		return err
+	}
+
+	err = recordImage(dir, image, checksum)
+	if err != nil {
+		glog.Warningf("Unable to record checksum of %s: %v", image, err)
+		err = nil
+	}
+
+	glog.Infof("Image %s downloaded to %s", image, imagePath)
+
+	return nil
+}
@@ -0,0 +1,357 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	osimage "github.com/01org/ciao/openstack/image"
+	"github.com/golang/glog"
+)
+
+// imageCacheDir is the directory, relative to the images directory, in
+// which launcher records the checksums of the images it downloads.
+const imageCacheDir = ".cache"
+
+// The image cache keeps track of the backing images stored on the node.
+// Images are referenced by the qemu instances created from them, from the
+// moment the overseer adds the instance until it is removed.  Images
+// launcher downloaded itself are managed by the cache.  They are evicted
+// once they are no longer referenced and either the cache exceeds its
+// disk budget, in which case the least recently used ones go first, or
+// they have been deleted or changed in the image service.  Images
+// provisioned by other means, e.g., copied by an administrator, are
+// never evicted.
+
+type cachedImage struct {
+	sizeMB   int
+	lastUsed time.Time
+	stale    bool
+}
+
+type unusedImage struct {
+	name string
+	*cachedImage
+}
+
+type byLastUsed []unusedImage
+
+func (s byLastUsed) Len() int           { return len(s) }
+func (s byLastUsed) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLastUsed) Less(i, j int) bool { return s[i].lastUsed.Before(s[j].lastUsed) }
+
+type imageCache struct {
+	sync.Mutex
+	dir      string
+	budgetMB int
+	refs     map[string]int
+	images   map[string]*cachedImage
+}
+
+// imgCache is the image cache of the node.  It is created by the overseer
+// before it starts any instance go routine.
+var imgCache *imageCache
+
+func newImageCache(dir string, budgetMB int) *imageCache {
+	c := &imageCache{
+		dir:      dir,
+		budgetMB: budgetMB,
+		refs:     make(map[string]int),
+		images:   make(map[string]*cachedImage),
+	}
+	c.scan()
+	return c
+}
+
+// cachedImageOf returns the backing image used by the instance created
+// from cfg, or "" if the instance does not use one.
+func cachedImageOf(cfg *vmConfig) string {
+	if cfg.Container {
+		return ""
+	}
+	return cfg.Image
+}
+
+func imageRecordPath(dir, image string) string {
+	return path.Join(dir, imageCacheDir, image)
+}
+
+// recordImage records the checksum of an image downloaded into dir, making
+// the image managed by the cache.
+func recordImage(dir, image, checksum string) error {
+	err := os.MkdirAll(path.Join(dir, imageCacheDir), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(imageRecordPath(dir, image), []byte(checksum), 0644)
+}
+
+// scan synchronises the managed images with the image records present on
+// disk.  It must be called with the cache locked.
+func (c *imageCache) scan() {
+	records, err := ioutil.ReadDir(path.Join(c.dir, imageCacheDir))
+	if err != nil && !os.IsNotExist(err) {
+		glog.Warningf("Unable to read image records: %v", err)
+		return
+	}
+
+	present := make(map[string]struct{})
+	for _, record := range records {
+		image := record.Name()
+		info, err := os.Stat(path.Join(c.dir, image))
+		if err != nil {
+			_ = os.Remove(imageRecordPath(c.dir, image))
+			continue
+		}
+
+		present[image] = struct{}{}
+		ci := c.images[image]
+		if ci == nil {
+			ci = &cachedImage{lastUsed: info.ModTime()}
+			c.images[image] = ci
+		}
+		ci.sizeMB = int(info.Size() / (1000 * 1000))
+	}
+
+	for image := range c.images {
+		if _, ok := present[image]; !ok {
+			delete(c.images, image)
+		}
+	}
+}
+
+// evict deletes image and its record.  It must be called with the cache
+// locked.
+func (c *imageCache) evict(image string) {
+	imagePath := path.Join(c.dir, image)
+	err := os.Remove(imagePath)
+	if err != nil && !os.IsNotExist(err) {
+		glog.Warningf("Unable to evict image %s: %v", image, err)
+		return
+	}
+
+	_ = os.Remove(imageRecordPath(c.dir, image))
+	delete(c.images, image)
+	forgetImageSize(imagePath)
+
+	glog.Infof("Image %s evicted from cache", image)
+}
+
+// ref records that a new instance uses image.
+func (c *imageCache) ref(image string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.refs[image]++
+	if ci := c.images[image]; ci != nil {
+		ci.lastUsed = time.Now()
+	}
+}
+
+// unref records that an instance no longer uses image.  Stale images
+// are evicted as soon as they are no longer used.
+func (c *imageCache) unref(image string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.refs[image]--
+	if c.refs[image] > 0 {
+		return
+	}
+	delete(c.refs, image)
+
+	ci := c.images[image]
+	if ci == nil {
+		return
+	}
+
+	ci.lastUsed = time.Now()
+	if ci.stale {
+		c.evict(image)
+	}
+}
+
+// checksum returns the checksum recorded for image, or "" if image is
+// not managed by the cache.
+func (c *imageCache) checksum(image string) string {
+	b, err := ioutil.ReadFile(imageRecordPath(c.dir, image))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// invalidate marks image as stale.  It is called by an instance about to
+// use image, which therefore holds one of its references.  The image is
+// evicted straight away if no other instance uses it, in which case
+// invalidate returns true.
+func (c *imageCache) invalidate(image string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	c.scan()
+	ci := c.images[image]
+	if ci == nil {
+		return false
+	}
+
+	ci.stale = true
+	if c.refs[image] > 1 {
+		return false
+	}
+
+	c.evict(image)
+	return true
+}
+
+// gc evicts the stale images no longer used and, if the managed images
+// exceed the disk budget, the least recently used images until the
+// budget is met.  A budget of 0 means no limit.
+func (c *imageCache) gc() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.scan()
+
+	var unused []unusedImage
+	totalMB := 0
+	for image, ci := range c.images {
+		if c.refs[image] > 0 {
+			totalMB += ci.sizeMB
+			continue
+		}
+
+		if ci.stale {
+			c.evict(image)
+			continue
+		}
+
+		totalMB += ci.sizeMB
+		unused = append(unused, unusedImage{image, ci})
+	}
+
+	if c.budgetMB <= 0 || totalMB <= c.budgetMB {
+		return
+	}
+
+	sort.Sort(byLastUsed(unused))
+
+	for _, image := range unused {
+		if totalMB <= c.budgetMB {
+			break
+		}
+		totalMB -= image.sizeMB
+		c.evict(image.name)
+	}
+}
+
+// list returns the images present on the node which can be used to
+// create new instances without being downloaded first.
+func (c *imageCache) list() []string {
+	c.Lock()
+	defer c.Unlock()
+
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil
+	}
+
+	var images []string
+	for _, f := range files {
+		image := f.Name()
+		if !f.Mode().IsRegular() || strings.HasPrefix(image, ".") {
+			continue
+		}
+
+		if ci := c.images[image]; ci != nil && ci.stale {
+			continue
+		}
+
+		images = append(images, image)
+	}
+
+	return images
+}
+
+// validate checks that the cached copy of image is still the one served
+// by the image service located at url.  Images deleted from the image
+// service are invalidated and an error is returned.  Images changed in the
+// image service are invalidated and errImageNotFound is returned if they
+// could be evicted, so that they get downloaded again.  A changed image
+// still used by other instances cannot be replaced and continues to be
+// used until it is evicted.  Images not managed by the cache are not
+// validated.
+func (c *imageCache) validate(url, token, image string) error {
+	checksum := c.checksum(image)
+	if checksum == "" {
+		return nil
+	}
+
+	imageURL := fmt.Sprintf("%s/v2/images/%s", strings.TrimSuffix(url, "/"), image)
+	req, err := http.NewRequest("GET", imageURL, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set(osimage.TokenHeader, token)
+	}
+
+	resp, err := imageServiceClient(imageServiceRequestTimeout).Do(req)
+	if err != nil {
+		glog.Warningf("Unable to validate image %s: %v", image, err)
+		return nil
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		c.invalidate(image)
+		return fmt.Errorf("Image %s has been deleted from the image service", image)
+	}
+
+	var info osimage.DefaultResponse
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("Unexpected status %s", resp.Status)
+	} else {
+		err = json.NewDecoder(resp.Body).Decode(&info)
+	}
+	if err != nil {
+		glog.Warningf("Unable to validate image %s: %v", image, err)
+		return nil
+	}
+
+	if info.CheckSum == nil || *info.CheckSum == checksum {
+		return nil
+	}
+
+	glog.Infof("Image %s has changed in the image service", image)
+	if c.invalidate(image) {
+		return errImageNotFound
+	}
+
+	glog.Warningf("Image %s is in use and cannot be replaced yet", image)
+	return nil
+}
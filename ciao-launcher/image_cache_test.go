@@ -0,0 +1,219 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	osimage "github.com/01org/ciao/openstack/image"
+)
+
+// createCachedImage creates an image of sizeMB in dir, last modified at
+// mtime.  The image is managed by the cache if managed is true.
+func createCachedImage(t *testing.T, dir, image string, sizeMB int, mtime time.Time, managed bool) {
+	imagePath := path.Join(dir, image)
+	err := ioutil.WriteFile(imagePath, make([]byte, sizeMB*1000*1000), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chtimes(imagePath, mtime, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if managed {
+		err = recordImage(dir, image, testImageChecksum)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkCachedImages(t *testing.T, c *imageCache, expected []string) {
+	images := c.list()
+	sort.Strings(images)
+	sort.Strings(expected)
+
+	if len(images) == 0 && len(expected) == 0 {
+		return
+	}
+
+	if !reflect.DeepEqual(images, expected) {
+		t.Fatalf("Expected cached images %v, found %v", expected, images)
+	}
+}
+
+// Checks the image cache LRU eviction.
+//
+// Three managed images and an unmanaged one are created.  The disk budget
+// only allows for two of the managed images.  The most recent image is
+// referenced and the cache is garbage collected.  The reference is then
+// dropped, the budget reduced, and the cache garbage collected again.
+//
+// The least recently used image should be evicted first, the referenced
+// and unmanaged images should never be evicted.
+func TestImageCacheLRU(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ciao-launcher-image-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	now := time.Now()
+	createCachedImage(t, dir, "old", 2, now.Add(-3*time.Hour), true)
+	createCachedImage(t, dir, "recent", 2, now.Add(-2*time.Hour), true)
+	createCachedImage(t, dir, "new", 2, now.Add(-4*time.Hour), true)
+	createCachedImage(t, dir, "unmanaged", 2, now.Add(-5*time.Hour), false)
+
+	c := newImageCache(dir, 4)
+	c.ref("new")
+	c.gc()
+	checkCachedImages(t, c, []string{"recent", "new", "unmanaged"})
+
+	c.unref("new")
+	c.budgetMB = 2
+	c.gc()
+	checkCachedImages(t, c, []string{"new", "unmanaged"})
+
+	c.budgetMB = 0
+	c.gc()
+	checkCachedImages(t, c, []string{"new", "unmanaged"})
+}
+
+// Checks that stale images are only evicted once no longer used.
+//
+// A managed image is referenced twice and invalidated.  Its references are
+// then dropped one after the other.
+//
+// The image should not be reported while stale and should only be deleted
+// once its last reference is dropped.
+func TestImageCacheInvalidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ciao-launcher-image-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	createCachedImage(t, dir, "image", 1, time.Now(), true)
+	createCachedImage(t, dir, "unmanaged", 1, time.Now(), false)
+
+	c := newImageCache(dir, 0)
+	c.ref("image")
+	c.ref("image")
+	c.ref("unmanaged")
+
+	if c.invalidate("unmanaged") {
+		t.Errorf("Unmanaged image evicted")
+	}
+
+	if c.invalidate("image") {
+		t.Errorf("Image used by another instance evicted")
+	}
+	checkCachedImages(t, c, []string{"unmanaged"})
+
+	c.unref("image")
+	c.gc()
+	if _, err := os.Stat(path.Join(dir, "image")); err != nil {
+		t.Errorf("Image evicted while still in use: %v", err)
+	}
+
+	c.unref("image")
+	if _, err := os.Stat(path.Join(dir, "image")); !os.IsNotExist(err) {
+		t.Errorf("Stale image not evicted: %v", err)
+	}
+
+	if c.checksum("image") != "" {
+		t.Errorf("Record of evicted image not deleted")
+	}
+}
+
+// Checks that cached images are validated against the image service.
+//
+// Instances are started from a cached image that is unchanged, changed
+// and not used by other instances, changed and used by other instances,
+// and deleted from the image service.
+//
+// Unchanged images and changed images in use should be used, other changed
+// images should be downloaded again and deleted images should fail.
+func TestImageCacheValidate(t *testing.T) {
+	tests := []struct {
+		checksum string
+		status   int
+		refs     int
+		err      error
+		present  bool
+	}{
+		{testImageChecksum, http.StatusOK, 1, nil, true},
+		{"ffeed24e8e4fd763c1d0d02c6e5d6e16", http.StatusOK, 1, errImageNotFound, false},
+		{"ffeed24e8e4fd763c1d0d02c6e5d6e16", http.StatusOK, 2, nil, true},
+		{testImageChecksum, http.StatusNotFound, 1, nil, false},
+		{testImageChecksum, http.StatusInternalServerError, 1, nil, true},
+	}
+
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "ciao-launcher-image-cache-")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		createCachedImage(t, dir, "image", 1, time.Now(), true)
+		c := newImageCache(dir, 0)
+		for i := 0; i < tt.refs; i++ {
+			c.ref("image")
+		}
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			if tt.status == http.StatusOK {
+				checksum := tt.checksum
+				_ = json.NewEncoder(w).Encode(&osimage.DefaultResponse{
+					ID:       "image",
+					Status:   osimage.Active,
+					CheckSum: &checksum,
+				})
+			}
+		}))
+
+		err = c.validate(ts.URL, "", "image")
+		ts.Close()
+
+		if tt.status == http.StatusNotFound {
+			if err == nil {
+				t.Errorf("Image deleted from image service validated")
+			}
+		} else if err != tt.err {
+			t.Errorf("Unexpected validation result: %v", err)
+		}
+
+		_, err = os.Stat(path.Join(dir, "image"))
+		if tt.present != (err == nil) {
+			t.Errorf("Image present %v, expected %v", err == nil, tt.present)
+		}
+
+		_ = os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,238 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	osimage "github.com/01org/ciao/openstack/image"
+	"github.com/01org/ciao/testutil"
+)
+
+const testImageData = "Upload file"
+const testImageChecksum = "ffeed24e8e4fd763c1d0d02c6e5d6e15"
+
+type imageServer struct {
+	checksum string
+	token    string
+	requests int32
+	release  chan struct{}
+}
+
+func (s *imageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.requests, 1)
+
+	if r.URL.Path != "/v2/images/"+testutil.ImageUUID+"/file" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if r.Header.Get(osimage.TokenHeader) != s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if s.release != nil {
+		<-s.release
+	}
+
+	w.Header().Set("Content-MD5", s.checksum)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(testImageData))
+}
+
+func checkImageDir(t *testing.T, dir string, present bool) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []os.FileInfo
+	for _, f := range entries {
+		if f.Name() != imageCacheDir {
+			files = append(files, f)
+		}
+	}
+
+	if !present {
+		if len(files) != 0 {
+			t.Fatalf("Unexpected file %s in %s", files[0].Name(), dir)
+		}
+		return
+	}
+
+	if len(files) != 1 || files[0].Name() != testutil.ImageUUID {
+		t.Fatalf("Expected %s to contain only %s", dir, testutil.ImageUUID)
+	}
+
+	b, err := ioutil.ReadFile(path.Join(dir, testutil.ImageUUID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != testImageData {
+		t.Fatalf("Wrong image data %s", string(b))
+	}
+
+	if newImageCache(dir, 0).checksum(testutil.ImageUUID) != testImageChecksum {
+		t.Fatalf("Checksum of %s not recorded", testutil.ImageUUID)
+	}
+}
+
+// Checks that images can be downloaded from the image service.
+//
+// Images with a valid checksum are downloaded and stored in the images
+// directory.  Images with a missing or an invalid checksum, or that
+// cannot be downloaded, are not.
+//
+// Only images with a valid checksum should be stored.
+func TestDownloadImage(t *testing.T) {
+	tests := []struct {
+		checksum string
+		token    string
+		image    string
+		present  bool
+	}{
+		{testImageChecksum, "token", testutil.ImageUUID, true},
+		{"", "token", testutil.ImageUUID, false},
+		{"ffeed24e8e4fd763c1d0d02c6e5d6e16", "token", testutil.ImageUUID, false},
+		{testImageChecksum, "", testutil.ImageUUID, false},
+		{testImageChecksum, "token", testutil.InstanceUUID, false},
+	}
+
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "ciao-launcher-image-")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ts := httptest.NewServer(&imageServer{checksum: tt.checksum, token: "token"})
+
+		err = downloadImage(ts.URL, tt.token, dir, tt.image)
+		ts.Close()
+
+		if tt.present && err != nil {
+			t.Errorf("Unable to download image: %v", err)
+		} else if !tt.present && err == nil {
+			t.Errorf("Invalid download of %s succeeded", tt.image)
+		}
+
+		checkImageDir(t, dir, tt.present)
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// Checks that concurrent downloads of the same image are coalesced.
+//
+// Several goroutines download the same image while the image service
+// is blocked.
+//
+// Only one request should reach the image service and all the goroutines
+// should succeed.
+func TestDownloadImageConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ciao-launcher-image-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	is := &imageServer{
+		checksum: testImageChecksum,
+		release:  make(chan struct{}),
+	}
+	ts := httptest.NewServer(is)
+	defer ts.Close()
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, 4)
+	for i := 0; i < cap(errCh); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errCh <- downloadImage(ts.URL, "", dir, testutil.ImageUUID)
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(is.release)
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		if err != nil {
+			t.Errorf("Unable to download image: %v", err)
+		}
+	}
+
+	if requests := atomic.LoadInt32(&is.requests); requests != 1 {
+		t.Errorf("Expected 1 download request, got %d", requests)
+	}
+
+	checkImageDir(t, dir, true)
+}
+
+func TestImageServiceTransport(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	f, err := ioutil.TempFile("", "launcher-ca-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	err = pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: ts.TLS.Certificates[0].Certificate[0]})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		caCertPath string
+		trusted    bool
+	}{
+		{"", false},
+		{f.Name(), true},
+	}
+
+	for _, tt := range tests {
+		client := &http.Client{
+			Transport: newImageServiceTransport(tt.caCertPath),
+			Timeout:   time.Second,
+		}
+
+		resp, err := client.Get(ts.URL)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+
+		if (err == nil) != tt.trusted {
+			t.Errorf("CA %q: unexpected request result %v", tt.caCertPath, err)
+		}
+	}
+}
@@ -46,6 +46,7 @@ type instanceData struct {
 	rcvStamp       time.Time
 	st             *startTimes
 	storageDriver  storage.BlockDriver
+	migrateCh      chan error
 }
 
 type insStartCmd struct {
@@ -55,10 +56,13 @@ type insStartCmd struct {
 	cfg      *vmConfig
 	rcvStamp time.Time
 }
-type insRestartCmd struct{}
+type insRestartCmd struct {
+	size instanceSize
+}
 type insDeleteCmd struct {
-	suicide bool
-	running ovsRunningState
+	suicide  bool
+	evacuate bool
+	running  ovsRunningState
 }
 type insStopCmd struct{}
 type insMonitorCmd struct{}
@@ -70,6 +74,25 @@ type insDetachVolumeCmd struct {
 	volumeUUID string
 }
 
+type insMigrateCmd struct {
+	uri string
+}
+
+type insCreateImageCmd struct {
+	image string
+	url   string
+	token string
+}
+
+type insGetConsoleCmd struct {
+	lines   int
+	request string
+}
+
+type insUpdateLimitsCmd struct {
+	limits resourceLimits
+}
+
 /*
 This functions asks the server loop to kill the instance.  An instance
 needs to request that the server loop kill it if Start fails completly.
@@ -154,7 +177,18 @@ func (id *instanceData) restartCommand(cmd *insRestartCmd) {
 		return
 	}
 
-	restartErr := processRestart(id.instanceDir, id.vm, id.ac.conn, id.cfg)
+	restartErr := processResize(id.vm, id.cfg, id.instance, id.instanceDir, cmd.size)
+	if restartErr == nil {
+		if cmd.size != (instanceSize{}) {
+			id.ovsCh <- &ovsResizeCmd{
+				instance: id.instance,
+				cpus:     id.cfg.Cpus,
+				memMB:    id.cfg.Mem,
+				diskMB:   id.cfg.Disk,
+			}
+		}
+		restartErr = processRestart(id.instanceDir, id.vm, id.ac.conn, id.cfg)
+	}
 
 	if restartErr != nil {
 		glog.Errorf("Unable to restart instance[%s]: %v", string(restartErr.code),
@@ -252,6 +286,145 @@ func (id *instanceData) detachVolumeCommand(cmd *insDetachVolumeCmd) {
 	glog.Infof("Volume %s detched from instance %s", cmd.volumeUUID, id.instance)
 }
 
+func (id *instanceData) migrateCommand(cmd *insMigrateCmd) {
+	if id.shuttingDown {
+		migrateErr := &migrateError{nil, payloads.MigrateNoInstance}
+		glog.Errorf("Unable to migrate instance[%s]", string(migrateErr.code))
+		migrateErr.send(id.ac.conn, id.instance)
+		return
+	}
+
+	if id.cfg.Container {
+		migrateErr := &migrateError{nil, payloads.MigrateNotSupported}
+		glog.Errorf("Unable to migrate instance[%s]", string(migrateErr.code))
+		migrateErr.send(id.ac.conn, id.instance)
+		return
+	}
+
+	if id.monitorCh == nil {
+		migrateErr := &migrateError{nil, payloads.MigrateNotRunning}
+		glog.Errorf("Unable to migrate instance[%s]", string(migrateErr.code))
+		migrateErr.send(id.ac.conn, id.instance)
+		return
+	}
+
+	if id.migrateCh != nil {
+		migrateErr := &migrateError{nil, payloads.MigrateFailed}
+		glog.Errorf("Migration of %s already in progress[%s]", id.instance,
+			string(migrateErr.code))
+		migrateErr.send(id.ac.conn, id.instance)
+		return
+	}
+
+	glog.Infof("Migrating %s to %s", id.instance, cmd.uri)
+
+	// The response is buffered so that the monitor go routine never blocks
+	// if we are asked to shutdown before the migration completes.
+
+	id.migrateCh = make(chan error, 1)
+	id.monitorCh <- virtualizerMigrateCmd{
+		responseCh: id.migrateCh,
+		uri:        cmd.uri,
+	}
+}
+
+// migrationDone is called when an outgoing migration terminates.  If the
+// instance has been successfully migrated the local copy, which is paused,
+// is deleted without notifying the controller, as the instance lives on,
+// on the destination node.
+func (id *instanceData) migrationDone(err error) {
+	id.migrateCh = nil
+
+	if err != nil {
+		migrateErr := &migrateError{err, payloads.MigrateFailed}
+		glog.Errorf("Unable to migrate instance[%s]: %v", string(migrateErr.code), err)
+		migrateErr.send(id.ac.conn, id.instance)
+		return
+	}
+
+	if id.shuttingDown {
+		return
+	}
+
+	glog.Infof("Instance %s migrated.  Removing it from the node", id.instance)
+	killMe(id.instance, id.doneCh, id.ac, &id.instanceWg)
+	id.shuttingDown = true
+}
+
+// createImageCommand snapshots the instance's rootfs and then uploads the
+// snapshot to the image service from a separate go routine, so that the
+// instance go routine is not blocked for the duration of the upload.
+func (id *instanceData) createImageCommand(cmd *insCreateImageCmd) {
+	if id.shuttingDown {
+		createErr := &createImageError{nil, payloads.CreateImageNoInstance}
+		glog.Errorf("Unable to create image from instance[%s]", string(createErr.code))
+		createErr.send(id.ac.conn, id.instance, cmd.image)
+		return
+	}
+
+	target, createErr := processCreateImage(id.vm, id.monitorCh, id.cfg, id.instanceDir, cmd.image)
+	if createErr != nil {
+		createErr.send(id.ac.conn, id.instance, cmd.image)
+		return
+	}
+
+	id.instanceWg.Add(1)
+	go func() {
+		defer id.instanceWg.Done()
+		createErr := uploadSnapshot(id.doneCh, target, cmd.url, cmd.image, cmd.token)
+		if createErr != nil {
+			createErr.send(id.ac.conn, id.instance, cmd.image)
+			return
+		}
+		glog.Infof("Image %s created from instance %s", cmd.image, id.instance)
+	}()
+}
+
+// getConsoleCommand sends the last lines of the instance's console log
+// to the controller.
+func (id *instanceData) getConsoleCommand(cmd *insGetConsoleCmd) {
+	if id.shuttingDown {
+		consoleErr := &getConsoleError{nil, payloads.GetConsoleNoInstance}
+		glog.Errorf("Unable to get console of instance[%s]", string(consoleErr.code))
+		consoleErr.send(id.ac.conn, id.instance, cmd.request)
+		return
+	}
+
+	output, err := id.vm.consoleLog(cmd.lines)
+	if err != nil {
+		consoleErr := &getConsoleError{err, payloads.GetConsoleNoLog}
+		glog.Errorf("Unable to get console of instance %s [%s]: %v", id.instance,
+			string(consoleErr.code), err)
+		consoleErr.send(id.ac.conn, id.instance, cmd.request)
+		return
+	}
+
+	sendConsoleOutput(id.ac.conn, id.instance, cmd.request, output)
+}
+
+// updateLimitsCommand applies new resource limits to the instance and
+// stores them so that they are re-applied when the instance is restarted.
+func (id *instanceData) updateLimitsCommand(cmd *insUpdateLimitsCmd) {
+	if id.shuttingDown {
+		limitsErr := &updateLimitsError{nil, payloads.UpdateLimitsNoInstance}
+		glog.Errorf("Unable to update limits of instance[%s]", string(limitsErr.code))
+		limitsErr.send(id.ac.conn, id.instance)
+		return
+	}
+
+	// The limits of an instance that has not yet been detected as running
+	// are applied when the instance go routine is notified that it is.
+	running := id.monitorCh != nil && id.connectedCh == nil
+	limitsErr := processUpdateLimits(id.vm, id.cfg, id.instance, id.instanceDir,
+		cmd.limits, running)
+	if limitsErr != nil {
+		limitsErr.send(id.ac.conn, id.instance)
+		return
+	}
+
+	glog.Infof("Limits of instance %s updated", id.instance)
+}
+
 func (id *instanceData) logStartTrace() {
 	if id.st == nil {
 		return
@@ -295,6 +468,14 @@ func (id *instanceData) instanceCommand(cmd interface{}) bool {
 		id.attachVolumeCommand(cmd)
 	case *insDetachVolumeCmd:
 		id.detachVolumeCommand(cmd)
+	case *insMigrateCmd:
+		id.migrateCommand(cmd)
+	case *insCreateImageCmd:
+		id.createImageCommand(cmd)
+	case *insGetConsoleCmd:
+		id.getConsoleCommand(cmd)
+	case *insUpdateLimitsCmd:
+		id.updateLimitsCommand(cmd)
 	case *insDeleteCmd:
 		if id.deleteCommand(cmd) {
 			return false
@@ -349,6 +530,8 @@ DONE:
 			if !id.instanceCommand(cmd) {
 				break DONE
 			}
+		case err := <-id.migrateCh:
+			id.migrationDone(err)
 		case <-id.monitorCloseCh:
 			// Means we've lost VM for now
 			id.vm.lostVM()
@@ -368,6 +551,10 @@ DONE:
 			id.logStartTrace()
 			id.connectedCh = nil
 			id.vm.connected()
+			if err := id.vm.setLimits(id.cfg.Limits); err != nil {
+				glog.Warningf("Unable to apply limits to instance %s: %v",
+					id.instance, err)
+			}
 			id.ovsCh <- &ovsStateChange{id.instance, ovsRunning}
 			d, m, c := id.vm.stats()
 			id.ovsCh <- &ovsStatsUpdateCmd{id.instance, m, d, c, id.getVolumes()}
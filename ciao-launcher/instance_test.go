@@ -18,6 +18,9 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"sync"
@@ -25,6 +28,7 @@ import (
 	"time"
 
 	storage "github.com/01org/ciao/ciao-storage"
+	osimage "github.com/01org/ciao/openstack/image"
 	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp"
 	"github.com/01org/ciao/testutil"
@@ -58,16 +62,27 @@ type instanceTestState struct {
 	rf              payloads.ErrorRestartFailure
 	avf             payloads.ErrorAttachVolumeFailure
 	dvf             payloads.ErrorDetachVolumeFailure
+	cif             payloads.ErrorCreateImageFailure
+	gcf             payloads.ErrorGetConsoleFailure
+	co              payloads.EventConsoleOutput
+	consoleCh       chan struct{}
+	ulf             payloads.ErrorUpdateLimitsFailure
+	limits          resourceLimits
+	limitsCh        chan struct{}
 	connect         bool
 	monitorCh       chan interface{}
 	errorCh         chan struct{}
 	monitorClosedCh chan struct{}
 	failStartVM     bool
+	failResize      bool
+	cfg             *vmConfig
+	size            instanceSize
+	resized         *ovsResizeCmd
 	ac              *agentClient
 }
 
 func (v *instanceTestState) init(cfg *vmConfig, instanceDir string) {
-
+	v.cfg = cfg
 }
 
 func (v *instanceTestState) checkBackingImage() error {
@@ -86,6 +101,22 @@ func (v *instanceTestState) deleteImage() error {
 	return nil
 }
 
+func (v *instanceTestState) snapshot(target string) error {
+	return ioutil.WriteFile(target, []byte("snapshot"), 0644)
+}
+
+func (v *instanceTestState) consoleLog(lines int) (string, error) {
+	return testutil.ConsoleOutput, nil
+}
+
+func (v *instanceTestState) resize() error {
+	if v.failResize {
+		return fmt.Errorf("Failed to resize VM")
+	}
+	v.size = instanceSize{v.cfg.Cpus, v.cfg.Mem, v.cfg.Disk}
+	return nil
+}
+
 func (v *instanceTestState) startVM(vnicName, ipAddress, cephID string) error {
 	if v.failStartVM {
 		return fmt.Errorf("Failed to start VM")
@@ -120,6 +151,14 @@ func (v *instanceTestState) connected() {
 func (v *instanceTestState) lostVM() {
 }
 
+func (v *instanceTestState) setLimits(limits resourceLimits) error {
+	v.limits = limits
+	if v.limitsCh != nil {
+		close(v.limitsCh)
+	}
+	return nil
+}
+
 func (v *instanceTestState) SendError(error ssntp.Error, payload []byte) (int, error) {
 	switch error {
 	case ssntp.StopFailure:
@@ -152,6 +191,21 @@ func (v *instanceTestState) SendError(error ssntp.Error, payload []byte) (int, e
 		if err != nil {
 			v.t.Fatalf("Failed to unmarshall detach volume error %v", err)
 		}
+	case ssntp.CreateImageFailure:
+		err := yaml.Unmarshal(payload, &v.cif)
+		if err != nil {
+			v.t.Fatalf("Failed to unmarshall create image error %v", err)
+		}
+	case ssntp.GetConsoleFailure:
+		err := yaml.Unmarshal(payload, &v.gcf)
+		if err != nil {
+			v.t.Fatalf("Failed to unmarshall get console error %v", err)
+		}
+	case ssntp.UpdateLimitsFailure:
+		err := yaml.Unmarshal(payload, &v.ulf)
+		if err != nil {
+			v.t.Fatalf("Failed to unmarshall update limits error %v", err)
+		}
 	}
 
 	if v.errorCh != nil {
@@ -162,6 +216,15 @@ func (v *instanceTestState) SendError(error ssntp.Error, payload []byte) (int, e
 }
 
 func (v *instanceTestState) SendEvent(event ssntp.Event, payload []byte) (int, error) {
+	if event == ssntp.ConsoleOutput {
+		err := yaml.Unmarshal(payload, &v.co)
+		if err != nil {
+			v.t.Fatalf("Failed to unmarshall console output %v", err)
+		}
+		if v.consoleCh != nil {
+			close(v.consoleCh)
+		}
+	}
 	return 0, nil
 }
 
@@ -350,11 +413,11 @@ DONE:
 }
 
 func (v *instanceTestState) restartInstance(t *testing.T, ovsCh chan interface{},
-	cmdCh chan<- interface{}, errorOk bool) bool {
+	cmdCh chan<- interface{}, size instanceSize, errorOk bool) bool {
 
 	v.errorCh = make(chan struct{})
 	select {
-	case cmdCh <- &insRestartCmd{}:
+	case cmdCh <- &insRestartCmd{size}:
 	case <-time.After(time.Second):
 		t.Error("Timed out sending Restart command")
 		return false
@@ -377,6 +440,8 @@ func (v *instanceTestState) restartInstance(t *testing.T, ovsCh chan interface{}
 				}
 				return true
 			case *ovsStatsUpdateCmd:
+			case *ovsResizeCmd:
+				v.resized = stChange
 			default:
 				t.Error("Unexpected commands received on ovsCh")
 				return false
@@ -644,7 +709,7 @@ func TestRestart(t *testing.T) {
 		t.FailNow()
 	}
 
-	if !state.restartInstance(t, ovsCh, cmdCh, false) {
+	if !state.restartInstance(t, ovsCh, cmdCh, instanceSize{}, false) {
 		shutdownInstanceLoop(doneCh, ovsCh, &wg, t)
 		t.FailNow()
 	}
@@ -681,7 +746,7 @@ func TestRestartFail(t *testing.T) {
 		t.FailNow()
 	}
 
-	if state.restartInstance(t, ovsCh, cmdCh, true) {
+	if state.restartInstance(t, ovsCh, cmdCh, instanceSize{}, true) {
 		t.Error("Restart was expected to Fail")
 	}
 
@@ -693,6 +758,125 @@ func TestRestartFail(t *testing.T) {
 	shutdownInstanceLoop(doneCh, ovsCh, &wg, t)
 }
 
+// startStoppedInstanceLoop creates the instance directory of an instance that
+// is not running and starts its instance loop.  The returned function removes
+// the instance directory.
+func startStoppedInstanceLoop(t *testing.T, wg *sync.WaitGroup, cfg *vmConfig,
+	state *instanceTestState) (chan interface{}, chan<- interface{}, chan struct{}, func()) {
+
+	instanceDir := path.Join(instancesDir, state.instance)
+	err := os.MkdirAll(instanceDir, 0755)
+	if err != nil {
+		t.Fatalf("Unable to create instance directory: %v", err)
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(instanceDir)
+	}
+
+	doneCh := make(chan struct{})
+	ovsCh := make(chan interface{})
+	ac := &agentClient{conn: state, cmdCh: make(chan *cmdWrapper)}
+	cmdCh := startInstanceWithVM(state.instance, cfg, wg, doneCh, ac, ovsCh, state, &storage.NoopDriver{})
+	if !state.expectStatsUpdate(t, ovsCh) {
+		shutdownInstanceLoop(doneCh, ovsCh, wg, t)
+		cleanup()
+		t.FailNow()
+	}
+
+	return ovsCh, cmdCh, doneCh, cleanup
+}
+
+// Check we can resize an instance when restarting it.
+//
+// We start the instance loop and then restart the instance with a RESTART command
+// that contains new CPU, memory and disk sizes.
+//
+// The instance should be resized and restarted correctly, the new sizes should
+// be saved in the instance's state and the instanceLoop should quit cleanly.
+func TestRestartResize(t *testing.T) {
+	var wg sync.WaitGroup
+	cfg := standardCfg
+	state := &instanceTestState{
+		t:          t,
+		instance:   "testInstance",
+		statsArray: [3]int{10, 128, 10},
+		connect:    true,
+	}
+	ovsCh, cmdCh, doneCh, cleanup := startStoppedInstanceLoop(t, &wg, &cfg, state)
+	defer cleanup()
+
+	size := instanceSize{cpus: 4, mem: 1024, disk: 16000}
+	if !state.restartInstance(t, ovsCh, cmdCh, size, false) {
+		shutdownInstanceLoop(doneCh, ovsCh, &wg, t)
+		t.FailNow()
+	}
+
+	shutdownInstanceLoop(doneCh, ovsCh, &wg, t)
+
+	if state.size != size {
+		t.Errorf("Instance resized to %+v, expected %+v", state.size, size)
+	}
+
+	// the overseer must be told about the new sizes
+	expected := ovsResizeCmd{state.instance, size.cpus, size.mem, size.disk}
+	if state.resized == nil || *state.resized != expected {
+		t.Errorf("Overseer told about %+v, expected %+v", state.resized, expected)
+	}
+
+	saved, err := loadVMConfig(path.Join(instancesDir, state.instance))
+	if err != nil {
+		t.Fatalf("Unable to load instance state: %v", err)
+	}
+
+	if saved.Cpus != size.cpus || saved.Mem != size.mem || saved.Disk != size.disk {
+		t.Errorf("Unexpected sizes saved %d %d %d", saved.Cpus, saved.Mem, saved.Disk)
+	}
+}
+
+// Check that a resize failure prevents an instance from being restarted.
+//
+// We start the instance loop and then restart the instance with new sizes.
+// This attempt will fail as we've configured resize to return an error.
+//
+// The restartCommand should fail with the RestartResizeFailure error, the
+// sizes of the instance should be unchanged and the instanceLoop should
+// quit cleanly.
+func TestRestartResizeFail(t *testing.T) {
+	var wg sync.WaitGroup
+	cfg := standardCfg
+	state := &instanceTestState{
+		t:          t,
+		instance:   "testInstance",
+		statsArray: [3]int{10, 128, 10},
+		connect:    true,
+		failResize: true,
+	}
+	ovsCh, cmdCh, doneCh, cleanup := startStoppedInstanceLoop(t, &wg, &cfg, state)
+	defer cleanup()
+
+	size := instanceSize{cpus: 4, mem: 1024, disk: 4000}
+	if state.restartInstance(t, ovsCh, cmdCh, size, true) {
+		t.Error("Restart was expected to Fail")
+	}
+
+	if state.rf.Reason != payloads.RestartResizeFailure {
+		t.Errorf("Invalid restart error found %s, expected %s",
+			state.rf.Reason, payloads.RestartResizeFailure)
+	}
+
+	shutdownInstanceLoop(doneCh, ovsCh, &wg, t)
+
+	if cfg.Cpus != standardCfg.Cpus || cfg.Mem != standardCfg.Mem ||
+		cfg.Disk != standardCfg.Disk {
+		t.Errorf("Sizes changed by failed resize %d %d %d", cfg.Cpus,
+			cfg.Mem, cfg.Disk)
+	}
+
+	if state.resized != nil {
+		t.Errorf("Overseer told about failed resize %+v", state.resized)
+	}
+}
+
 // Check we get an error when starting an instance with an invalid image
 //
 // We start the instance loop and then try to start an instance with an invalid
@@ -1074,3 +1258,184 @@ func TestDetachNonexistingVolumeFromInstance(t *testing.T) {
 
 	wg.Wait()
 }
+
+func createImageFromInstance(t *testing.T, handler http.HandlerFunc,
+	check func(*instanceTestState)) {
+	var wg sync.WaitGroup
+	cfg := standardCfg
+	state, ovsCh, cmdCh, doneCh := startVMWithCFG(t, &wg, &cfg, true, false)
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	state.errorCh = make(chan struct{})
+	select {
+	case cmdCh <- &insCreateImageCmd{testutil.ImageUUID, ts.URL, testutil.ImageToken}:
+	case <-time.After(time.Second):
+		t.Error("Timed out sending create image command")
+	}
+
+	select {
+	case monCmd := <-state.monitorCh:
+		snapshotCmd := monCmd.(virtualizerSnapshotCmd)
+		snapshotCmd.responseCh <- state.snapshot(snapshotCmd.target)
+	case <-time.After(time.Second):
+		t.Error("Timed out waiting for snapshot command")
+	}
+
+	check(state)
+
+	if !state.deleteInstance(t, ovsCh, cmdCh) {
+		cleanupShutdownFail(t, cfg.Instance, doneCh, ovsCh, &wg)
+	}
+
+	wg.Wait()
+}
+
+// Check we can create an image from a running instance
+//
+// We start the instance loop, send a create image command, reply to the
+// snapshot command sent to the monitor channel and wait for the snapshot to
+// be uploaded to our test image service before deleting the instance.
+//
+// The instanceLoop and then instance should start correctly.  The snapshot
+// should be uploaded to the correct image with the correct token and the
+// instance should be correctly deleted.
+func TestCreateImageFromInstance(t *testing.T) {
+	uploadCh := make(chan string, 1)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Errorf("Unexpected method %s", r.Method)
+		}
+		expectedPath := fmt.Sprintf("/v2/images/%s/file", testutil.ImageUUID)
+		if r.URL.Path != expectedPath {
+			t.Errorf("Unexpected path.  Expected %s got %s", expectedPath, r.URL.Path)
+		}
+		if r.Header.Get(osimage.TokenHeader) != testutil.ImageToken {
+			t.Errorf("Unexpected token %s", r.Header.Get(osimage.TokenHeader))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		uploadCh <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	createImageFromInstance(t, handler, func(state *instanceTestState) {
+		select {
+		case body := <-uploadCh:
+			if body != "snapshot" {
+				t.Errorf("Unexpected snapshot contents %s", body)
+			}
+		case <-state.errorCh:
+			t.Errorf("Unexpected error %s", state.cif.Reason)
+		case <-time.After(time.Second):
+			t.Error("Timed out waiting for snapshot upload")
+		}
+	})
+}
+
+// Check that a failure to upload a snapshot is reported
+//
+// We start the instance loop, send a create image command and reply to the
+// snapshot command sent to the monitor channel.  Our test image service
+// rejects the upload.
+//
+// The instanceLoop and then instance should start correctly.  A
+// CreateImageFailure error should be sent with a reason of upload_failure
+// and the instance should be correctly deleted.
+func TestCreateImageUploadFailure(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	createImageFromInstance(t, handler, func(state *instanceTestState) {
+		select {
+		case <-state.errorCh:
+			if state.cif.Reason != payloads.CreateImageUploadFailure {
+				t.Errorf("Unexpected error.  Expected %s got %s",
+					payloads.CreateImageUploadFailure, state.cif.Reason)
+			}
+		case <-time.After(time.Second):
+			t.Error("Timed out waiting for upload to fail")
+		}
+	})
+}
+
+// Check we can retrieve the console output of a running instance
+//
+// We start the instance loop, send a get console command and wait for the
+// console output event before deleting the instance.
+//
+// The instanceLoop and then instance should start correctly.  A ConsoleOutput
+// event containing the console log of the instance should be sent and the
+// instance should be correctly deleted.
+func TestGetConsole(t *testing.T) {
+	var wg sync.WaitGroup
+	cfg := standardCfg
+	state, ovsCh, cmdCh, doneCh := startVMWithCFG(t, &wg, &cfg, true, false)
+
+	state.errorCh = make(chan struct{})
+	state.consoleCh = make(chan struct{})
+	select {
+	case cmdCh <- &insGetConsoleCmd{50, testutil.ConsoleRequestUUID}:
+	case <-time.After(time.Second):
+		t.Error("Timed out sending get console command")
+	}
+
+	select {
+	case <-state.consoleCh:
+		if state.co.ConsoleOutput.InstanceUUID != cfg.Instance ||
+			state.co.ConsoleOutput.RequestUUID != testutil.ConsoleRequestUUID ||
+			state.co.ConsoleOutput.Output != testutil.ConsoleOutput {
+			t.Errorf("Unexpected console output %v", state.co.ConsoleOutput)
+		}
+	case <-state.errorCh:
+		t.Errorf("Unexpected error %s", state.gcf.Reason)
+	case <-time.After(time.Second):
+		t.Error("Timed out waiting for console output")
+	}
+
+	if !state.deleteInstance(t, ovsCh, cmdCh) {
+		cleanupShutdownFail(t, cfg.Instance, doneCh, ovsCh, &wg)
+	}
+
+	wg.Wait()
+}
+
+// Check we can update the limits of a running instance.
+//
+// Start an instance, send it an insUpdateLimitsCmd and then delete the
+// instance.
+//
+// The new limits should be applied to the running instance and no error
+// should be sent.
+func TestUpdateLimits(t *testing.T) {
+	var wg sync.WaitGroup
+	cfg := standardCfg
+	state, ovsCh, cmdCh, doneCh := startVMWithCFG(t, &wg, &cfg, true, false)
+
+	limits := resourceLimits{CPUShares: 512, MemLimitMB: 2048, DiskIOPS: 100}
+	state.errorCh = make(chan struct{})
+	state.limitsCh = make(chan struct{})
+	select {
+	case cmdCh <- &insUpdateLimitsCmd{limits}:
+	case <-time.After(time.Second):
+		t.Error("Timed out sending update limits command")
+	}
+
+	select {
+	case <-state.limitsCh:
+		if state.limits != limits {
+			t.Errorf("Unexpected limits %+v", state.limits)
+		}
+	case <-state.errorCh:
+		t.Errorf("Unexpected error %s", state.ulf.Reason)
+	case <-time.After(time.Second):
+		t.Error("Timed out waiting for limits to be applied")
+	}
+
+	if !state.deleteInstance(t, ovsCh, cmdCh) {
+		cleanupShutdownFail(t, cfg.Instance, doneCh, ovsCh, &wg)
+	}
+
+	wg.Wait()
+}
@@ -81,6 +81,7 @@ var networking bool
 var hardReset bool
 var diskLimit bool
 var memLimit bool
+var imageCacheMB int
 var cephID string
 var simulate bool
 var maxInstances = int(math.MaxInt32)
@@ -180,7 +181,7 @@ func (client *agentClient) CommandNotify(cmd ssntp.Command, frame *ssntp.Frame)
 		}
 		client.cmdCh <- &cmdWrapper{cfg.Instance, &insStartCmd{cn, md, frame, cfg, time.Now()}}
 	case ssntp.RESTART:
-		instance, payloadErr := parseRestartPayload(payload)
+		instance, size, payloadErr := parseRestartPayload(payload)
 		if payloadErr != nil {
 			restartError := &restartError{
 				payloadErr.err,
@@ -190,7 +191,7 @@ func (client *agentClient) CommandNotify(cmd ssntp.Command, frame *ssntp.Frame)
 			glog.Errorf("Unable to parse YAML: %v", payloadErr.err)
 			return
 		}
-		client.cmdCh <- &cmdWrapper{instance, &insRestartCmd{}}
+		client.cmdCh <- &cmdWrapper{instance, &insRestartCmd{size}}
 	case ssntp.STOP:
 		instance, payloadErr := parseStopPayload(payload)
 		if payloadErr != nil {
@@ -239,6 +240,63 @@ func (client *agentClient) CommandNotify(cmd ssntp.Command, frame *ssntp.Frame)
 			return
 		}
 		client.cmdCh <- &cmdWrapper{instance, &insDetachVolumeCmd{volume}}
+	case ssntp.MIGRATE:
+		instance, uri, payloadErr := parseMigratePayload(payload)
+		if payloadErr != nil {
+			migrateError := &migrateError{
+				payloadErr.err,
+				payloads.MigrateFailureReason(payloadErr.code),
+			}
+			migrateError.send(client.conn, "")
+			glog.Errorf("Unable to parse YAML: %s", payloadErr.err)
+			return
+		}
+		client.cmdCh <- &cmdWrapper{instance, &insMigrateCmd{uri}}
+	case ssntp.CreateImage:
+		cmd, payloadErr := parseCreateImagePayload(payload)
+		if payloadErr != nil {
+			createImageError := &createImageError{
+				payloadErr.err,
+				payloads.CreateImageFailureReason(payloadErr.code),
+			}
+			createImageError.send(client.conn, "", "")
+			glog.Errorf("Unable to parse YAML: %s", payloadErr.err)
+			return
+		}
+		client.cmdCh <- &cmdWrapper{cmd.InstanceUUID,
+			&insCreateImageCmd{cmd.ImageUUID, cmd.ImageServiceURL, cmd.Token}}
+	case ssntp.GetConsole:
+		cmd, payloadErr := parseGetConsolePayload(payload)
+		if payloadErr != nil {
+			getConsoleError := &getConsoleError{
+				payloadErr.err,
+				payloads.GetConsoleFailureReason(payloadErr.code),
+			}
+			getConsoleError.send(client.conn, "", cmd.RequestUUID)
+			glog.Errorf("Unable to parse YAML: %s", payloadErr.err)
+			return
+		}
+		client.cmdCh <- &cmdWrapper{cmd.InstanceUUID,
+			&insGetConsoleCmd{cmd.Lines, cmd.RequestUUID}}
+	case ssntp.UpdateLimits:
+		instance, limits, payloadErr := parseUpdateLimitsPayload(payload)
+		if payloadErr != nil {
+			updateLimitsError := &updateLimitsError{
+				payloadErr.err,
+				payloads.UpdateLimitsFailureReason(payloadErr.code),
+			}
+			updateLimitsError.send(client.conn, "")
+			glog.Errorf("Unable to parse YAML: %s", payloadErr.err)
+			return
+		}
+		client.cmdCh <- &cmdWrapper{instance, &insUpdateLimitsCmd{limits}}
+	case ssntp.EVACUATE:
+		nextState, err := parseEvacuatePayload(payload)
+		if err != nil {
+			glog.Errorf("Unable to parse YAML: %v", err)
+			return
+		}
+		client.cmdCh <- &cmdWrapper{"", &evacuateCmd{nextState}}
 	}
 }
 
@@ -308,14 +366,17 @@ func processCommand(conn serverConn, cmd *cmdWrapper, ovsCh chan<- interface{})
 	case *statusCmd:
 		ovsCh <- &ovsStatsStatusCmd{}
 		return
+	case *evacuateCmd:
+		ovsCh <- &ovsEvacuateCmd{insCmd.nextState}
+		return
 	case *insStartCmd:
 		targetCh := make(chan ovsAddResult)
 		ovsCh <- &ovsAddCmd{cmd.instance, insCmd.cfg, targetCh}
 		addResult := <-targetCh
 		if !addResult.canAdd {
-			glog.Errorf("Instance will make node full: Disk %d Mem %d CPUs %d",
-				insCmd.cfg.Disk, insCmd.cfg.Mem, insCmd.cfg.Cpus)
-			se := startError{nil, payloads.FullComputeNode}
+			glog.Errorf("Unable to start instance (%s): Disk %d Mem %d CPUs %d",
+				addResult.reason, insCmd.cfg.Disk, insCmd.cfg.Mem, insCmd.cfg.Cpus)
+			se := startError{nil, addResult.reason}
 			se.send(conn, cmd.instance)
 			return
 		}
@@ -325,8 +386,10 @@ func processCommand(conn serverConn, cmd *cmdWrapper, ovsCh chan<- interface{})
 		target = insState.cmdCh
 		if target == nil {
 			glog.Errorf("Instance %s does not exist", cmd.instance)
-			de := deleteError{nil, payloads.DeleteNoInstance}
-			de.send(conn, cmd.instance)
+			if !insCmd.evacuate {
+				de := deleteError{nil, payloads.DeleteNoInstance}
+				de.send(conn, cmd.instance)
+			}
 			return
 		}
 		delCmd = insCmd
@@ -347,6 +410,38 @@ func processCommand(conn serverConn, cmd *cmdWrapper, ovsCh chan<- interface{})
 			re.send(conn, cmd.instance)
 			return
 		}
+	case *insMigrateCmd:
+		target = insCmdChannel(cmd.instance, ovsCh)
+		if target == nil {
+			glog.Errorf("Instance %s does not exist", cmd.instance)
+			me := migrateError{nil, payloads.MigrateNoInstance}
+			me.send(conn, cmd.instance)
+			return
+		}
+	case *insCreateImageCmd:
+		target = insCmdChannel(cmd.instance, ovsCh)
+		if target == nil {
+			glog.Errorf("Instance %s does not exist", cmd.instance)
+			cie := createImageError{nil, payloads.CreateImageNoInstance}
+			cie.send(conn, cmd.instance, insCmd.image)
+			return
+		}
+	case *insGetConsoleCmd:
+		target = insCmdChannel(cmd.instance, ovsCh)
+		if target == nil {
+			glog.Errorf("Instance %s does not exist", cmd.instance)
+			gce := getConsoleError{nil, payloads.GetConsoleNoInstance}
+			gce.send(conn, cmd.instance, insCmd.request)
+			return
+		}
+	case *insUpdateLimitsCmd:
+		target = insCmdChannel(cmd.instance, ovsCh)
+		if target == nil {
+			glog.Errorf("Instance %s does not exist", cmd.instance)
+			ule := updateLimitsError{nil, payloads.UpdateLimitsNoInstance}
+			ule.send(conn, cmd.instance)
+			return
+		}
 	default:
 		target = insCmdChannel(cmd.instance, ovsCh)
 	}
@@ -363,6 +458,7 @@ func processCommand(conn serverConn, cmd *cmdWrapper, ovsCh chan<- interface{})
 		ovsCh <- &ovsRemoveCmd{
 			cmd.instance,
 			delCmd.suicide,
+			delCmd.evacuate,
 			errCh}
 		<-errCh
 	}
@@ -397,6 +493,7 @@ func loadClusterConfig(conn serverConn) error {
 	mgmtNet = clusterConfig.Configure.Launcher.ManagementNetwork
 	diskLimit = clusterConfig.Configure.Launcher.DiskLimit
 	memLimit = clusterConfig.Configure.Launcher.MemoryLimit
+	imageCacheMB = clusterConfig.Configure.Launcher.ImageCacheMB
 	if cephID == "" {
 		cephID = clusterConfig.Configure.Storage.CephID
 	}
@@ -410,6 +507,7 @@ func printClusterConfig() {
 	glog.Infof("Management Network:   %v", mgmtNet)
 	glog.Infof("Disk Limit:           %v", diskLimit)
 	glog.Infof("Memory Limit:         %v", memLimit)
+	glog.Infof("Image Cache MB:       %v", imageCacheMB)
 	glog.Infof("Ceph ID:              %v", cephID)
 }
 
@@ -236,7 +236,9 @@ func createVnicCfg(cfg *vmConfig) (*libsnnet.VnicConfig, error) {
 func sendNetworkEvent(conn serverConn, eventType ssntp.Event,
 	event *libsnnet.SsntpEventInfo) {
 
-	if event == nil || !conn.isConnected() {
+	// Events sent while disconnected are queued by SSNTP and
+	// replayed once reconnected.
+	if event == nil {
 		return
 	}
 
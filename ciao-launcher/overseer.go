@@ -38,6 +38,7 @@ import (
 type ovsAddResult struct {
 	cmdCh  chan<- interface{}
 	canAdd bool
+	reason payloads.StartFailureReason
 }
 
 type ovsAddCmd struct {
@@ -59,6 +60,7 @@ type ovsGetCmd struct {
 type ovsRemoveCmd struct {
 	instance string
 	suicide  bool
+	evacuate bool
 	errCh    chan<- error
 }
 
@@ -75,6 +77,13 @@ type ovsStatsUpdateCmd struct {
 	volumes       []string
 }
 
+type ovsResizeCmd struct {
+	instance string
+	cpus     int
+	memMB    int
+	diskMB   int
+}
+
 type ovsTraceFrame struct {
 	frame *ssntp.Frame
 }
@@ -82,6 +91,10 @@ type ovsTraceFrame struct {
 type ovsStatusCmd struct{}
 type ovsStatsStatusCmd struct{}
 
+type ovsEvacuateCmd struct {
+	nextState payloads.EvacuateNextState
+}
+
 type ovsRunningState int
 
 const (
@@ -109,11 +122,13 @@ type ovsInstanceState struct {
 	sshIP          string
 	sshPort        int
 	volumes        []string
+	image          string
 }
 
 type overseer struct {
 	instancesDir       string
 	instances          map[string]*ovsInstanceState
+	images             *imageCache
 	ovsCh              chan interface{}
 	ovsInstanceCh      chan interface{}
 	childDoneCh        chan struct{}
@@ -125,11 +140,22 @@ type overseer struct {
 	memoryAllocated    int
 	diskSpaceAvailable int
 	memoryAvailable    int
+	cpusOnline         int
+	maintenance        bool
+	evacuating         bool
+	nextState          payloads.EvacuateNextState
 	traceFrames        *list.List
 	memInfo            string
 	stat               string
 	loadavg            string
 	statsInterval      time.Duration
+
+	// dockerImages is the last known list of the docker images present
+	// on the node.  It is refreshed asynchronously, through
+	// dockerImagesCh, as listing the docker images can be slow.
+	dockerImages           []string
+	dockerImagesCh         chan []string
+	dockerImagesRefreshing bool
 }
 
 type cnStats struct {
@@ -139,6 +165,7 @@ type cnStats struct {
 	availableDiskMB int
 	load            int
 	cpusOnline      int
+	images          []string
 }
 
 var memTotalRegexp *regexp.Regexp
@@ -167,7 +194,7 @@ func grabInt(re *regexp.Regexp, line string, val *int) bool {
 	return false
 }
 
-func getMemoryInfo() (total, available int) {
+func getMemoryInfo(memInfo string) (total, available int) {
 
 	total = -1
 	available = -1
@@ -175,7 +202,7 @@ func getMemoryInfo() (total, available int) {
 	active := -1
 	inactive := -1
 
-	file, err := os.Open("/proc/meminfo")
+	file, err := os.Open(memInfo)
 	if err != nil {
 		return
 	}
@@ -215,9 +242,9 @@ func getMemoryInfo() (total, available int) {
 	return
 }
 
-func getOnlineCPUs() int {
+func getOnlineCPUs(stat string) int {
 
-	file, err := os.Open("/proc/stat")
+	file, err := os.Open(stat)
 	if err != nil {
 		return -1
 	}
@@ -262,8 +289,8 @@ func getFSInfo(instancesDir string) (total, available int) {
 	return
 }
 
-func getLoadAvg() int {
-	file, err := os.Open("/proc/loadavg")
+func getLoadAvg(loadavg string) int {
+	file, err := os.Open(loadavg)
 	if err != nil {
 		return -1
 	}
@@ -285,31 +312,54 @@ func getLoadAvg() int {
 	return int(loadFloat)
 }
 
-func (ovs *overseer) roomAvailable(cfg *vmConfig) bool {
+// roomAvailable returns an empty reason if the instance can be started.
+// Resources that were not requested as mandatory are granted on a best
+// effort basis and never prevent the instance from starting.
+func (ovs *overseer) roomAvailable(cfg *vmConfig) payloads.StartFailureReason {
+
+	if ovs.maintenance {
+		glog.Warning("We're in maintenance mode.  Not accepting new instances")
+		return payloads.NodeInMaintenance
+	}
 
 	if len(ovs.instances) >= maxInstances {
 		glog.Warningf("We're FULL.  Too many instances %d", len(ovs.instances))
-		return false
+		return payloads.FullComputeNode
 	}
 
 	diskSpaceAvailable := ovs.diskSpaceAvailable - cfg.Disk
 	memoryAvailable := ovs.memoryAvailable - cfg.Mem
 
-	glog.Infof("disk Avail %d MemAvail %d", diskSpaceAvailable, memoryAvailable)
+	glog.Infof("disk Avail %d MemAvail %d CPUs %d", diskSpaceAvailable,
+		memoryAvailable, ovs.cpusOnline)
+
+	if ovs.cpusOnline > 0 && cfg.Cpus > ovs.cpusOnline {
+		if cfg.mandatory(payloads.VCPUs) {
+			return payloads.NotEnoughVCPUs
+		}
+		glog.Warningf("Best effort: %d VCPUs requested, %d CPUs online",
+			cfg.Cpus, ovs.cpusOnline)
+	}
 
 	if diskSpaceAvailable < diskSpaceLWM {
 		if diskLimit == true {
-			return false
+			if cfg.mandatory(payloads.DiskMB) {
+				return payloads.NotEnoughDisk
+			}
+			glog.Warningf("Best effort: %d MB of disk requested", cfg.Disk)
 		}
 	}
 
 	if memoryAvailable < memLWM {
 		if memLimit == true {
-			return false
+			if cfg.mandatory(payloads.MemMB) {
+				return payloads.NotEnoughMemory
+			}
+			glog.Warningf("Best effort: %d MB of memory requested", cfg.Mem)
 		}
 	}
 
-	return true
+	return ""
 }
 
 func (ovs *overseer) updateAvailableResources(cns *cnStats) {
@@ -335,6 +385,8 @@ func (ovs *overseer) updateAvailableResources(cns *cnStats) {
 	ovs.memoryAvailable = (cns.availableMemMB + memConsumed) -
 		ovs.memoryAllocated
 
+	ovs.cpusOnline = cns.cpusOnline
+
 	if glog.V(1) {
 		glog.Infof("Memory Available: %d Disk space Available %d",
 			ovs.memoryAvailable, ovs.diskSpaceAvailable)
@@ -343,6 +395,10 @@ func (ovs *overseer) updateAvailableResources(cns *cnStats) {
 
 func (ovs *overseer) computeStatus() ssntp.Status {
 
+	if ovs.maintenance {
+		return ssntp.MAINTENANCE
+	}
+
 	if len(ovs.instances) >= maxInstances {
 		return ssntp.FULL
 	}
@@ -372,6 +428,7 @@ func (ovs *overseer) sendReadyStatusCommand(cns *cnStats) {
 	s.Load = cns.load
 	s.CpusOnline = cns.cpusOnline
 	s.DiskTotalMB, s.DiskAvailableMB = cns.totalDiskMB, cns.availableDiskMB
+	s.Images = cns.images
 
 	payload, err := yaml.Marshal(&s)
 	if err != nil {
@@ -391,6 +448,8 @@ func (ovs *overseer) sendStatusCommand(cns *cnStats, status ssntp.Status) {
 		ovs.sendReadyStatusCommand(cns)
 	case ssntp.FULL:
 		fallthrough
+	case ssntp.MAINTENANCE:
+		fallthrough
 	case ssntp.OFFLINE:
 		_, err := ovs.ac.conn.SendStatus(status, nil)
 		if err != nil {
@@ -436,6 +495,7 @@ func (ovs *overseer) sendStats(cns *cnStats, status ssntp.Status) {
 		s.Instances[i].Volumes = state.volumes
 		i++
 	}
+	s.Images = cns.images
 
 	payload, err := yaml.Marshal(&s)
 	if err != nil {
@@ -483,17 +543,39 @@ func (ovs *overseer) sendTraceReport() {
 	}
 }
 
-func getStats(instancesDir string) *cnStats {
+func (ovs *overseer) getStats() *cnStats {
 	var s cnStats
 
-	s.totalMemMB, s.availableMemMB = getMemoryInfo()
-	s.load = getLoadAvg()
-	s.cpusOnline = getOnlineCPUs()
-	s.totalDiskMB, s.availableDiskMB = getFSInfo(instancesDir)
+	s.totalMemMB, s.availableMemMB = getMemoryInfo(ovs.memInfo)
+	s.load = getLoadAvg(ovs.loadavg)
+	s.cpusOnline = getOnlineCPUs(ovs.stat)
+	s.totalDiskMB, s.availableDiskMB = getFSInfo(ovs.instancesDir)
+	s.images = ovs.images.list()
+	s.images = append(s.images, ovs.dockerImages...)
 
 	return &s
 }
 
+// refreshDockerImages lists the docker images present on the node in the
+// background, unless such a listing is already in progress.  The result is
+// delivered on dockerImagesCh, which can hold it even if the overseer
+// exits before reading it.
+func (ovs *overseer) refreshDockerImages() {
+	if simulate || ovs.dockerImagesRefreshing {
+		return
+	}
+
+	ovs.dockerImagesRefreshing = true
+	go func() {
+		ovs.dockerImagesCh <- dockerImages()
+	}()
+}
+
+func (ovs *overseer) updateDockerImages(images []string) {
+	ovs.dockerImages = images
+	ovs.dockerImagesRefreshing = false
+}
+
 func (ovs *overseer) sendInstanceDeletedEvent(instance string) {
 	var event payloads.EventInstanceDeleted
 
@@ -512,6 +594,25 @@ func (ovs *overseer) sendInstanceDeletedEvent(instance string) {
 	}
 }
 
+func (ovs *overseer) sendInstanceEvacuatedEvent(instance string) {
+	var event payloads.EventInstanceEvacuated
+
+	event.InstanceEvacuated.InstanceUUID = instance
+	event.InstanceEvacuated.NodeUUID = ovs.ac.conn.UUID()
+
+	payload, err := yaml.Marshal(&event)
+	if err != nil {
+		glog.Errorf("Unable to Marshall InstanceEvacuated %v", err)
+		return
+	}
+
+	_, err = ovs.ac.conn.SendEvent(ssntp.InstanceEvacuated, payload)
+	if err != nil {
+		glog.Errorf("Failed to send event command %v", err)
+		return
+	}
+}
+
 func (ovs *overseer) processGetCommand(cmd *ovsGetCmd) {
 	glog.Infof("Overseer: looking for instance %s", cmd.instance)
 	var insState ovsGetResult
@@ -528,13 +629,18 @@ func (ovs *overseer) processAddCommand(cmd *ovsAddCmd) {
 	var targetCh chan<- interface{}
 	target := ovs.instances[cmd.instance]
 	canAdd := true
+	var reason payloads.StartFailureReason
 	cfg := cmd.cfg
 	if target != nil {
 		targetCh = target.cmdCh
-	} else if ovs.roomAvailable(cfg) {
+	} else if reason = ovs.roomAvailable(cfg); reason == "" {
 		ovs.vcpusAllocated += cfg.Cpus
 		ovs.diskSpaceAllocated += cfg.Disk
 		ovs.memoryAllocated += cfg.Mem
+		image := cachedImageOf(cfg)
+		if image != "" {
+			ovs.images.ref(image)
+		}
 		targetCh = startInstance(cmd.instance, cfg, ovs.childWg, ovs.childDoneCh,
 			ovs.ac, ovs.ovsInstanceCh)
 		ovs.instances[cmd.instance] = &ovsInstanceState{
@@ -548,11 +654,12 @@ func (ovs *overseer) processAddCommand(cmd *ovsAddCmd) {
 			maxMemoryMB:    cfg.Mem,
 			sshIP:          cfg.ConcIP,
 			sshPort:        cfg.SSHPort,
+			image:          image,
 		}
 	} else {
 		canAdd = false
 	}
-	cmd.targetCh <- ovsAddResult{targetCh, canAdd}
+	cmd.targetCh <- ovsAddResult{targetCh, canAdd, reason}
 }
 
 func (ovs *overseer) processRemoveCommand(cmd *ovsRemoveCmd) {
@@ -578,29 +685,90 @@ func (ovs *overseer) processRemoveCommand(cmd *ovsRemoveCmd) {
 		ovs.memoryAllocated = 0
 	}
 
+	if target.image != "" {
+		ovs.images.unref(target.image)
+	}
+
 	delete(ovs.instances, cmd.instance)
-	if !cmd.suicide {
+	if cmd.evacuate {
+		ovs.sendInstanceEvacuatedEvent(cmd.instance)
+	} else if !cmd.suicide {
 		ovs.sendInstanceDeletedEvent(cmd.instance)
 	}
 	cmd.errCh <- nil
+
+	if ovs.evacuating {
+		ovs.checkEvacuationDone()
+	}
+}
+
+func (ovs *overseer) processEvacuateCommand(cmd *ovsEvacuateCmd) {
+	glog.Infof("Overseer: Received Evacuate Command, next state %s", cmd.nextState)
+	if ovs.evacuating {
+		glog.Warning("Overseer: Evacuation already in progress")
+		return
+	}
+
+	ovs.maintenance = true
+	ovs.evacuating = true
+	ovs.nextState = cmd.nextState
+
+	// The node status is sent again when the launcher reconnects so
+	// there is no point in queueing it.
+	if ovs.ac.conn.isConnected() {
+		cns := ovs.getStats()
+		ovs.updateAvailableResources(cns)
+		ovs.sendStatusCommand(cns, ovs.computeStatus())
+	}
+
+	for instance := range ovs.instances {
+		evacuateInstance(instance, ovs.childDoneCh, ovs.ac, ovs.childWg)
+	}
+
+	ovs.checkEvacuationDone()
+}
+
+func (ovs *overseer) checkEvacuationDone() {
+	if len(ovs.instances) > 0 {
+		return
+	}
+
+	glog.Infof("Overseer: Evacuation complete, next state %s", ovs.nextState)
+	ovs.evacuating = false
+
+	// Only the latest node status and stats matter, and they are sent
+	// when the launcher reconnects.
+	if ovs.ac.conn.isConnected() {
+		cns := ovs.getStats()
+		ovs.updateAvailableResources(cns)
+		status := ovs.computeStatus()
+		ovs.sendStatusCommand(cns, status)
+		ovs.sendStats(cns, status)
+	}
+
+	reachNextState(ovs.nextState, ovs.childWg)
 }
 
 func (ovs *overseer) processStatusCommand(cmd *ovsStatusCmd) {
 	glog.Info("Overseer: Received Status Command")
+
+	// A stale status would be replayed after the one sent on reconnection.
 	if !ovs.ac.conn.isConnected() {
 		return
 	}
-	cns := getStats(ovs.instancesDir)
+	cns := ovs.getStats()
 	ovs.updateAvailableResources(cns)
 	ovs.sendStatusCommand(cns, ovs.computeStatus())
 }
 
 func (ovs *overseer) processStatsStatusCommand(cmd *ovsStatsStatusCmd) {
 	glog.Info("Overseer: Received StatsStatus Command")
+
+	// This command is sent on reconnection, it is useless before.
 	if !ovs.ac.conn.isConnected() {
 		return
 	}
-	cns := getStats(ovs.instancesDir)
+	cns := ovs.getStats()
 	ovs.updateAvailableResources(cns)
 	status := ovs.computeStatus()
 	ovs.sendStatusCommand(cns, status)
@@ -630,6 +798,24 @@ func (ovs *overseer) processStatusUpdateCommand(cmd *ovsStatsUpdateCmd) {
 	}
 }
 
+// processResizeCommand replaces the resources allocated to an instance with
+// the ones it was resized to.
+func (ovs *overseer) processResizeCommand(cmd *ovsResizeCmd) {
+	glog.Infof("Overseer: resizing %s", cmd.instance)
+	target := ovs.instances[cmd.instance]
+	if target == nil {
+		return
+	}
+
+	ovs.vcpusAllocated += cmd.cpus - target.maxVCPUs
+	ovs.memoryAllocated += cmd.memMB - target.maxMemoryMB
+	ovs.diskSpaceAllocated += cmd.diskMB - target.maxDiskUsageMB
+
+	target.maxVCPUs = cmd.cpus
+	target.maxMemoryMB = cmd.memMB
+	target.maxDiskUsageMB = cmd.diskMB
+}
+
 func (ovs *overseer) processTraceFrameCommand(cmd *ovsTraceFrame) {
 	cmd.frame.SetEndStamp()
 	ovs.traceFrames.PushBack(cmd.frame)
@@ -651,8 +837,12 @@ func (ovs *overseer) processCommand(cmd interface{}) {
 		ovs.processStateChangeCommand(cmd)
 	case *ovsStatsUpdateCmd:
 		ovs.processStatusUpdateCommand(cmd)
+	case *ovsResizeCmd:
+		ovs.processResizeCommand(cmd)
 	case *ovsTraceFrame:
 		ovs.processTraceFrameCommand(cmd)
+	case *ovsEvacuateCmd:
+		ovs.processEvacuateCommand(cmd)
 	default:
 		panic("Unknown Overseer Command")
 	}
@@ -671,13 +861,19 @@ DONE:
 			ovs.processCommand(cmd)
 		case cmd := <-ovs.ovsInstanceCh:
 			ovs.processCommand(cmd)
+		case images := <-ovs.dockerImagesCh:
+			ovs.updateDockerImages(images)
 		case <-statsTimer:
+			// Queueing periodic stats would fill the SSNTP queue
+			// with outdated ones.
 			if !ovs.ac.conn.isConnected() {
 				statsTimer = time.After(ovs.statsInterval)
 				continue
 			}
 
-			cns := getStats(ovs.instancesDir)
+			ovs.refreshDockerImages()
+			ovs.images.gc()
+			cns := ovs.getStats()
 			ovs.updateAvailableResources(cns)
 			status := ovs.computeStatus()
 			ovs.sendStatusCommand(cns, status)
@@ -723,10 +919,12 @@ DRAIN:
 	glog.Info("Overseer exitting")
 }
 
-func startOverseerFull(instancesDir string, wg *sync.WaitGroup, ac *agentClient, statsInterval time.Duration,
-	memInfo, stat, loadavg string) chan<- interface{} {
+func startOverseerFull(instancesDir, imagesDir string, wg *sync.WaitGroup, ac *agentClient,
+	statsInterval time.Duration, memInfo, stat, loadavg string) chan<- interface{} {
 
 	instances := make(map[string]*ovsInstanceState)
+	images := newImageCache(imagesDir, imageCacheMB)
+	imgCache = images
 	ovsCh := make(chan interface{})
 	ovsInstanceCh := make(chan interface{})
 	toMonitor := make([]chan<- interface{}, 0, 1024)
@@ -760,6 +958,10 @@ func startOverseerFull(instancesDir string, wg *sync.WaitGroup, ac *agentClient,
 		vcpusAllocated += cfg.Cpus
 		diskSpaceAllocated += cfg.Disk
 		memoryAllocated += cfg.Mem
+		image := cachedImageOf(cfg)
+		if image != "" {
+			images.ref(image)
+		}
 
 		target := startInstance(instance, cfg, childWg, childDoneCh, ac, ovsInstanceCh)
 		instances[instance] = &ovsInstanceState{
@@ -773,6 +975,7 @@ func startOverseerFull(instancesDir string, wg *sync.WaitGroup, ac *agentClient,
 			maxMemoryMB:    cfg.Mem,
 			sshIP:          cfg.ConcIP,
 			sshPort:        cfg.SSHPort,
+			image:          image,
 		}
 		toMonitor = append(toMonitor, target)
 
@@ -782,6 +985,7 @@ func startOverseerFull(instancesDir string, wg *sync.WaitGroup, ac *agentClient,
 	ovs := &overseer{
 		instancesDir:       instancesDir,
 		instances:          instances,
+		images:             images,
 		ovsCh:              ovsCh,
 		ovsInstanceCh:      ovsInstanceCh,
 		parentWg:           wg,
@@ -791,12 +995,15 @@ func startOverseerFull(instancesDir string, wg *sync.WaitGroup, ac *agentClient,
 		vcpusAllocated:     vcpusAllocated,
 		diskSpaceAllocated: diskSpaceAllocated,
 		memoryAllocated:    memoryAllocated,
+		cpusOnline:         getOnlineCPUs(stat),
 		traceFrames:        list.New(),
 		statsInterval:      statsInterval,
 		memInfo:            memInfo,
 		stat:               stat,
 		loadavg:            loadavg,
+		dockerImagesCh:     make(chan []string, 1),
 	}
+	ovs.refreshDockerImages()
 	ovs.parentWg.Add(1)
 	glog.Info("Starting Overseer")
 	glog.Infof("Allocated: Disk %d Mem %d CPUs %d",
@@ -820,5 +1027,6 @@ func startOverseerFull(instancesDir string, wg *sync.WaitGroup, ac *agentClient,
 }
 
 func startOverseer(wg *sync.WaitGroup, ac *agentClient) chan<- interface{} {
-	return startOverseerFull(instancesDir, wg, ac, time.Second*statsPeriod, "/proc/meminfo", "/proc/stat", "/proc/loadavg")
+	return startOverseerFull(instancesDir, imagesPath, wg, ac, time.Second*statsPeriod,
+		"/proc/meminfo", "/proc/stat", "/proc/loadavg")
 }
@@ -86,6 +86,7 @@ const loadAvgContents = `
 const statContents = `
 cpu  29164 292 87649 17177990 544 0 580 0 0 0
 cpu0 29164 292 87649 17177990 544 0 580 0 0 0
+cpu1 29164 292 87649 17177990 544 0 580 0 0 0
 intr 28478654 38 10 0 0 0 0 0 0 0 0 0 0 156 0 0 169437 0 0 0 163737 19303499 21210 29 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0
 ctxt 54009655
 btime 1465121906
@@ -423,7 +424,7 @@ func TestStartStopOverseer(t *testing.T) {
 	state := &overseerTestState{t: t}
 	state.ac = &agentClient{conn: state, cmdCh: make(chan *cmdWrapper)}
 
-	ovsCh := startOverseerFull(instancesDir, &wg, state.ac, time.Second*900,
+	ovsCh := startOverseerFull(instancesDir, instancesDir+"-images", &wg, state.ac, time.Second*900,
 		pp.memInfo, pp.stat, pp.loadavg)
 	close(ovsCh)
 	wg.Wait()
@@ -458,7 +459,7 @@ func TestEmptyStats(t *testing.T) {
 	}
 	state.ac = &agentClient{conn: state, cmdCh: make(chan *cmdWrapper)}
 
-	ovsCh := startOverseerFull(instancesDir, &wg, state.ac, time.Millisecond*300,
+	ovsCh := startOverseerFull(instancesDir, instancesDir+"-images", &wg, state.ac, time.Millisecond*300,
 		pp.memInfo, pp.stat, pp.loadavg)
 
 	var stats *payloads.Stat
@@ -482,6 +483,46 @@ DONE:
 	wg.Wait()
 }
 
+// Check the docker images are listed in the background
+//
+// Refresh the docker images known to an overseer twice in a row, and wait
+// for the listing to complete.
+//
+// Only one listing should be started and its result should replace the
+// images previously known to the overseer.
+func TestRefreshDockerImages(t *testing.T) {
+	ovs := &overseer{
+		dockerImages:   []string{"stale"},
+		dockerImagesCh: make(chan []string, 1),
+	}
+
+	ovs.refreshDockerImages()
+	ovs.refreshDockerImages()
+
+	select {
+	case images := <-ovs.dockerImagesCh:
+		ovs.updateDockerImages(images)
+	case <-time.After(2 * dockerImagesTimeout):
+		t.Fatal("Timed out waiting for docker images")
+	}
+
+	if ovs.dockerImagesRefreshing {
+		t.Error("Docker images still being refreshed")
+	}
+
+	for _, image := range ovs.dockerImages {
+		if image == "stale" {
+			t.Error("Stale docker images not replaced")
+		}
+	}
+
+	select {
+	case <-ovs.dockerImagesCh:
+		t.Error("Docker images listed twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
 // Check the overseer sends a status command
 //
 // Start the overseer with a high stats interval and send an ovsStatusCmd.
@@ -510,7 +551,7 @@ func TestEmptyStatus(t *testing.T) {
 	}
 	state.ac = &agentClient{conn: state, cmdCh: make(chan *cmdWrapper)}
 
-	ovsCh := startOverseerFull(instancesDir, &wg, state.ac, time.Second*1000,
+	ovsCh := startOverseerFull(instancesDir, instancesDir+"-images", &wg, state.ac, time.Second*1000,
 		pp.memInfo, pp.stat, pp.loadavg)
 	select {
 	case ovsCh <- &ovsStatusCmd{}:
@@ -571,7 +612,7 @@ func TestFullStatus(t *testing.T) {
 	}
 	state.ac = &agentClient{conn: state, cmdCh: make(chan *cmdWrapper)}
 
-	ovsCh := startOverseerFull(instancesDir, &wg, state.ac, time.Second*1000,
+	ovsCh := startOverseerFull(instancesDir, instancesDir+"-images", &wg, state.ac, time.Second*1000,
 		pp.memInfo, pp.stat, pp.loadavg)
 	select {
 	case ovsCh <- &ovsStatusCmd{}:
@@ -631,7 +672,7 @@ func TestAddDelete(t *testing.T) {
 	}
 	state.ac = &agentClient{conn: state, cmdCh: make(chan *cmdWrapper)}
 
-	ovsCh := startOverseerFull(instancesDir, &wg, state.ac, time.Second*1000,
+	ovsCh := startOverseerFull(instancesDir, instancesDir+"-images", &wg, state.ac, time.Second*1000,
 		pp.memInfo, pp.stat, pp.loadavg)
 
 	_ = addInstance(t, ovsCh, state, false)
@@ -683,7 +724,7 @@ func TestInitialInstance(t *testing.T) {
 	}
 	state.ac = &agentClient{conn: state, cmdCh: make(chan *cmdWrapper)}
 
-	ovsCh := startOverseerFull(instancesDir, &wg, state.ac, time.Millisecond*300,
+	ovsCh := startOverseerFull(instancesDir, instancesDir+"-images", &wg, state.ac, time.Millisecond*300,
 		pp.memInfo, pp.stat, pp.loadavg)
 
 	timer := time.After(time.Second)
@@ -736,7 +777,7 @@ func TestGet(t *testing.T) {
 	}
 	state.ac = &agentClient{conn: state, cmdCh: make(chan *cmdWrapper)}
 
-	ovsCh := startOverseerFull(instancesDir, &wg, state.ac, time.Second*1000,
+	ovsCh := startOverseerFull(instancesDir, instancesDir+"-images", &wg, state.ac, time.Second*1000,
 		pp.memInfo, pp.stat, pp.loadavg)
 
 	_ = addInstance(t, ovsCh, state, false)
@@ -802,7 +843,7 @@ func TestStatsStatus(t *testing.T) {
 	}
 	state.ac = &agentClient{conn: state, cmdCh: make(chan *cmdWrapper)}
 
-	ovsCh := startOverseerFull(instancesDir, &wg, state.ac, time.Second*1000,
+	ovsCh := startOverseerFull(instancesDir, instancesDir+"-images", &wg, state.ac, time.Second*1000,
 		pp.memInfo, pp.stat, pp.loadavg)
 
 	ready, stats := getStatusStats(t, ovsCh, state)
@@ -849,7 +890,7 @@ func TestStateChange(t *testing.T) {
 	}
 	state.ac = &agentClient{conn: state, cmdCh: make(chan *cmdWrapper)}
 
-	ovsCh := startOverseerFull(instancesDir, &wg, state.ac, time.Second*1000,
+	ovsCh := startOverseerFull(instancesDir, instancesDir+"-images", &wg, state.ac, time.Second*1000,
 		pp.memInfo, pp.stat, pp.loadavg)
 
 	_ = addInstance(t, ovsCh, state, false)
@@ -871,3 +912,179 @@ func TestStateChange(t *testing.T) {
 	shutdownOverseer(ovsCh, state)
 	wg.Wait()
 }
+
+// Checks that mandatory resources are enforced when starting instances.
+//
+// Call roomAvailable on an overseer with 4 online CPUs and little memory
+// left, with a variety of mandatory and best effort requests.
+//
+// Mandatory requests that cannot be met should return the reason of the
+// failure, best effort requests should always succeed.
+func TestRoomAvailable(t *testing.T) {
+	defer func(disk, mem bool) { diskLimit, memLimit = disk, mem }(diskLimit, memLimit)
+	diskLimit = true
+	memLimit = true
+
+	ovs := &overseer{
+		instances:          make(map[string]*ovsInstanceState),
+		diskSpaceAvailable: diskSpaceLWM + 1000,
+		memoryAvailable:    memLWM + 1000,
+		cpusOnline:         4,
+	}
+
+	var roomTests = []struct {
+		cfg    vmConfig
+		reason payloads.StartFailureReason
+	}{
+		{vmConfig{Cpus: 2, Mem: 512, Disk: 500}, ""},
+		{vmConfig{Cpus: 16, Mem: 512, Disk: 500}, payloads.NotEnoughVCPUs},
+		{vmConfig{Cpus: 2, Mem: 2048, Disk: 500}, payloads.NotEnoughMemory},
+		{vmConfig{Cpus: 2, Mem: 512, Disk: 2000}, payloads.NotEnoughDisk},
+		{vmConfig{Cpus: 16, Mem: 512, Disk: 500,
+			BestEffort: []payloads.Resource{payloads.VCPUs}}, ""},
+		{vmConfig{Cpus: 2, Mem: 2048, Disk: 2000,
+			BestEffort: []payloads.Resource{payloads.MemMB, payloads.DiskMB}}, ""},
+	}
+
+	for _, test := range roomTests {
+		reason := ovs.roomAvailable(&test.cfg)
+		if reason != test.reason {
+			t.Errorf("Cpus %d Mem %d Disk %d best effort %v: expected %q got %q",
+				test.cfg.Cpus, test.cfg.Mem, test.cfg.Disk,
+				test.cfg.BestEffort, string(test.reason), string(reason))
+		}
+	}
+}
+
+// Checks the overseer accounts for resized instances.
+//
+// Resize an instance of an overseer which has allocated resources to it and
+// to another instance, and then resize an unknown instance.
+//
+// The resources allocated to the resized instance and the total allocated
+// resources should be updated, resizing the unknown instance should be
+// ignored.
+func TestResize(t *testing.T) {
+	ovs := &overseer{
+		instances: map[string]*ovsInstanceState{
+			"instance1": {maxVCPUs: 2, maxMemoryMB: 512, maxDiskUsageMB: 1000},
+			"instance2": {maxVCPUs: 1, maxMemoryMB: 256, maxDiskUsageMB: 500},
+		},
+		vcpusAllocated:     3,
+		memoryAllocated:    768,
+		diskSpaceAllocated: 1500,
+	}
+
+	ovs.processResizeCommand(&ovsResizeCmd{"instance1", 4, 1024, 2000})
+	ovs.processResizeCommand(&ovsResizeCmd{"instance3", 8, 4096, 8000})
+
+	target := ovs.instances["instance1"]
+	if target.maxVCPUs != 4 || target.maxMemoryMB != 1024 || target.maxDiskUsageMB != 2000 {
+		t.Errorf("Instance not resized: %+v", target)
+	}
+
+	if ovs.vcpusAllocated != 5 || ovs.memoryAllocated != 1280 || ovs.diskSpaceAllocated != 2500 {
+		t.Errorf("Unexpected allocated resources %d %d %d", ovs.vcpusAllocated,
+			ovs.memoryAllocated, ovs.diskSpaceAllocated)
+	}
+}
+
+// Checks the overseer evacuates its instances.
+//
+// Start the overseer, add an instance and send an evacuate command.
+// Then acknowledge the removal of the instance, as the server loop would,
+// and try to add another instance.
+//
+// The overseer should ask the server loop to evacuate the instance, report
+// a MAINTENANCE STATS command with no instances once the instance has been
+// removed and refuse to start the new instance.
+func TestEvacuate(t *testing.T) {
+	diskLimit = false
+	memLimit = false
+
+	instancesDir, err := ioutil.TempDir("", "overseer-tests")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory")
+	}
+	defer func() { _ = os.RemoveAll(instancesDir) }()
+
+	pp, err := createGoodProcFiles()
+	if err != nil {
+		t.Fatalf("Unable to create proc files")
+	}
+	defer func() { _ = os.RemoveAll(pp.procDir) }()
+
+	var wg sync.WaitGroup
+	state := &overseerTestState{
+		t:       t,
+		statsCh: make(chan *payloads.Stat),
+	}
+	state.ac = &agentClient{conn: state, cmdCh: make(chan *cmdWrapper)}
+
+	ovsCh := startOverseerFull(instancesDir, instancesDir+"-images", &wg, state.ac, time.Second*1000,
+		pp.memInfo, pp.stat, pp.loadavg)
+
+	_ = addInstance(t, ovsCh, state, false)
+
+	select {
+	case ovsCh <- &ovsEvacuateCmd{payloads.NextStateMaintenance}:
+	case <-time.After(time.Second):
+		t.Fatal("Unable to send evacuate command")
+	}
+
+	select {
+	case cmd := <-state.ac.cmdCh:
+		delCmd, ok := cmd.cmd.(*insDeleteCmd)
+		if !ok || !delCmd.evacuate || cmd.instance != "test-instance" {
+			t.Fatalf("Evacuation delete command expected for test-instance")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for evacuation delete command")
+	}
+
+	removeCh := make(chan error)
+	select {
+	case ovsCh <- &ovsRemoveCmd{
+		instance: "test-instance",
+		evacuate: true,
+		errCh:    removeCh,
+	}:
+	case <-time.After(time.Second):
+		t.Fatal("Unable to remove instance")
+	}
+
+	if err := <-removeCh; err != nil {
+		t.Fatalf("Unable to remove instance: %v", err)
+	}
+
+	select {
+	case stats := <-state.statsCh:
+		if stats.Status != ssntp.MAINTENANCE.String() {
+			t.Errorf("MAINTENANCE status expected.  Found: %s", stats.Status)
+		}
+		if len(stats.Instances) != 0 {
+			t.Errorf("0 instances expected.  Found: %d", len(stats.Instances))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for evacuation stats")
+	}
+
+	addCh := make(chan ovsAddResult)
+	select {
+	case ovsCh <- &ovsAddCmd{
+		instance: "new-instance",
+		cfg:      &vmConfig{Cpus: 1, Mem: 370, Disk: 8000},
+		targetCh: addCh,
+	}:
+	case <-time.After(time.Second):
+		t.Fatal("Unable to add instance")
+	}
+
+	addResult := <-addCh
+	if addResult.canAdd || addResult.reason != payloads.NodeInMaintenance {
+		t.Errorf("Instance should not be added in maintenance mode")
+	}
+
+	shutdownOverseer(ovsCh, state)
+	wg.Wait()
+}
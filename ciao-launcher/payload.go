@@ -70,14 +70,19 @@ func printCloudinit(data *payloads.Start) {
 
 	glog.Info("Requested resources:")
 	for i := range start.RequestedResources {
-		glog.Infof("%8s:     %v", start.RequestedResources[i].Type,
-			start.RequestedResources[i].Value)
+		glog.Infof("%8s:     %v (mandatory %v)", start.RequestedResources[i].Type,
+			start.RequestedResources[i].Value, start.RequestedResources[i].Mandatory)
 	}
 
-	if start.Storage.ID != "" {
+	if start.Storage.ID != "" || len(start.Volumes) > 0 {
 		glog.Info("Volumes:")
+	}
+	if start.Storage.ID != "" {
 		glog.Infof("  %s Bootable=%t", start.Storage.ID, start.Storage.Bootable)
 	}
+	for _, v := range start.Volumes {
+		glog.Infof("  %s Bootable=%t", v.ID, v.Bootable)
+	}
 }
 
 func computeSSHPort(networkNode bool, vnicIP string) int {
@@ -120,6 +125,37 @@ func parseVMTtype(start *payloads.StartCmd) (container bool, image string, err e
 	return
 }
 
+// parseLimits extracts the limits from a list of requested resources.
+// Resources that are not limits are ignored.
+func parseLimits(resources []payloads.RequestedResource) (resourceLimits, error) {
+	var limits resourceLimits
+
+	for _, r := range resources {
+		if !payloads.IsLimit(r.Type) {
+			continue
+		}
+
+		if r.Value < 0 {
+			return resourceLimits{}, fmt.Errorf("Invalid %s limit: %d", r.Type, r.Value)
+		}
+
+		switch r.Type {
+		case payloads.CPUShares:
+			limits.CPUShares = r.Value
+		case payloads.CPUQuota:
+			limits.CPUQuota = r.Value
+		case payloads.MemLimitMB:
+			limits.MemLimitMB = r.Value
+		case payloads.DiskIOPS:
+			limits.DiskIOPS = r.Value
+		case payloads.DiskMBps:
+			limits.DiskMBps = r.Value
+		}
+	}
+
+	return limits, nil
+}
+
 func parseStartPayload(data []byte) (*vmConfig, *payloadError) {
 	var clouddata payloads.Start
 
@@ -146,12 +182,23 @@ func parseStartPayload(data []byte) (*vmConfig, *payloadError) {
 
 	var disk, cpus, mem int
 	var networkNode bool
+	var bestEffort []payloads.Resource
 	container, image, err := parseVMTtype(start)
 	if err != nil {
 		return nil, &payloadError{err, payloads.InvalidData}
 	}
 
+	incoming := strings.TrimSpace(start.IncomingMigration)
+	if container && incoming != "" {
+		err = fmt.Errorf("Containers cannot be migrated")
+		return nil, &payloadError{err, payloads.InvalidData}
+	}
+
 	for i := range start.RequestedResources {
+		if !start.RequestedResources[i].Mandatory {
+			bestEffort = append(bestEffort, start.RequestedResources[i].Type)
+		}
+
 		switch start.RequestedResources[i].Type {
 		case payloads.VCPUs:
 			cpus = start.RequestedResources[i].Value
@@ -167,6 +214,12 @@ func parseStartPayload(data []byte) (*vmConfig, *payloadError) {
 	net := &start.Networking
 	vnicIP := strings.TrimSpace(net.PrivateIP)
 	sshPort := computeSSHPort(networkNode, vnicIP)
+
+	limits, err := parseLimits(start.RequestedResources)
+	if err != nil {
+		return nil, &payloadError{err, payloads.InvalidData}
+	}
+
 	var volumes []volumeConfig
 	if start.Storage.ID != "" {
 		volumes = append(volumes, volumeConfig{
@@ -174,6 +227,12 @@ func parseStartPayload(data []byte) (*vmConfig, *payloadError) {
 			Bootable: start.Storage.Bootable,
 		})
 	}
+	for _, v := range start.Volumes {
+		volumes = append(volumes, volumeConfig{
+			UUID:     v.ID,
+			Bootable: v.Bootable,
+		})
+	}
 
 	return &vmConfig{Cpus: cpus,
 		Mem:         mem,
@@ -192,6 +251,12 @@ func parseStartPayload(data []byte) (*vmConfig, *payloadError) {
 		VnicUUID:    strings.TrimSpace(net.VnicUUID),
 		SSHPort:     sshPort,
 		Volumes:     volumes,
+		BestEffort:  bestEffort,
+		Limits:      limits,
+		incoming:    incoming,
+
+		imageServiceURL: strings.TrimSpace(start.ImageServiceURL),
+		token:           start.Token,
 	}, nil
 }
 
@@ -227,6 +292,40 @@ func generateDeleteError(instance string, deleteErr *deleteError) (out []byte, e
 	return yaml.Marshal(df)
 }
 
+func generateMigrateError(instance string, migrateErr *migrateError) (out []byte, err error) {
+	mf := &payloads.ErrorMigrateFailure{
+		InstanceUUID: instance,
+		Reason:       migrateErr.code,
+	}
+	return yaml.Marshal(mf)
+}
+
+func generateCreateImageError(instance, image string, cie *createImageError) (out []byte, err error) {
+	cif := &payloads.ErrorCreateImageFailure{
+		InstanceUUID: instance,
+		ImageUUID:    image,
+		Reason:       cie.code,
+	}
+	return yaml.Marshal(cif)
+}
+
+func generateGetConsoleError(instance, request string, gce *getConsoleError) (out []byte, err error) {
+	gcf := &payloads.ErrorGetConsoleFailure{
+		InstanceUUID: instance,
+		RequestUUID:  request,
+		Reason:       gce.code,
+	}
+	return yaml.Marshal(gcf)
+}
+
+func generateUpdateLimitsError(instance string, ule *updateLimitsError) (out []byte, err error) {
+	ulf := &payloads.ErrorUpdateLimitsFailure{
+		InstanceUUID: instance,
+		Reason:       ule.code,
+	}
+	return yaml.Marshal(ulf)
+}
+
 func generateAttachVolumeError(instance, volume string, ave *attachVolumeError) (out []byte, err error) {
 	avf := &payloads.ErrorAttachVolumeFailure{
 		InstanceUUID: instance,
@@ -274,20 +373,51 @@ func generateNetEventPayload(ssntpEvent *libsnnet.SsntpEventInfo, agentUUID stri
 	return yaml.Marshal(event)
 }
 
-func parseRestartPayload(data []byte) (string, *payloadError) {
+// instanceSize contains the number of CPUs and the amount of memory and disk
+// space, in MB, requested for an instance in a RESTART payload.  Zero values
+// indicate that the current value should be retained.
+type instanceSize struct {
+	cpus int
+	mem  int
+	disk int
+}
+
+func parseRestartPayload(data []byte) (string, instanceSize, *payloadError) {
 	var clouddata payloads.Restart
+	var size instanceSize
 
 	err := yaml.Unmarshal(data, &clouddata)
 	if err != nil {
-		return "", &payloadError{err, payloads.RestartInvalidPayload}
+		return "", size, &payloadError{err, payloads.RestartInvalidPayload}
 	}
 
 	instance := strings.TrimSpace(clouddata.Restart.InstanceUUID)
 	if !uuidRegexp.MatchString(instance) {
 		err = fmt.Errorf("Invalid instance id received: %s", instance)
-		return "", &payloadError{err, payloads.RestartInvalidData}
+		return "", size, &payloadError{err, payloads.RestartInvalidData}
 	}
-	return instance, nil
+
+	for _, r := range clouddata.Restart.RequestedResources {
+		var v *int
+		switch r.Type {
+		case payloads.VCPUs:
+			v = &size.cpus
+		case payloads.MemMB:
+			v = &size.mem
+		case payloads.DiskMB:
+			v = &size.disk
+		default:
+			continue
+		}
+
+		if r.Value < 0 {
+			err = fmt.Errorf("Invalid %s value received: %d", r.Type, r.Value)
+			return "", instanceSize{}, &payloadError{err, payloads.RestartInvalidData}
+		}
+		*v = r.Value
+	}
+
+	return instance, size, nil
 }
 
 func parseDeletePayload(data []byte) (string, *payloadError) {
@@ -323,6 +453,133 @@ func parseStopPayload(data []byte) (string, *payloadError) {
 	return instance, nil
 }
 
+func parseMigratePayload(data []byte) (string, string, *payloadError) {
+	var clouddata payloads.Migrate
+
+	err := yaml.Unmarshal(data, &clouddata)
+	if err != nil {
+		glog.Errorf("YAML error: %v", err)
+		return "", "", &payloadError{err, payloads.MigrateInvalidPayload}
+	}
+
+	instance := strings.TrimSpace(clouddata.Migrate.InstanceUUID)
+	if !uuidRegexp.MatchString(instance) {
+		err = fmt.Errorf("Invalid instance id received: %s", instance)
+		return "", "", &payloadError{err, payloads.MigrateInvalidData}
+	}
+
+	uri := strings.TrimSpace(clouddata.Migrate.DestinationURI)
+	if uri == "" {
+		err = fmt.Errorf("Missing destination URI for instance: %s", instance)
+		return "", "", &payloadError{err, payloads.MigrateInvalidData}
+	}
+
+	return instance, uri, nil
+}
+
+func parseCreateImagePayload(data []byte) (payloads.CreateImageCmd, *payloadError) {
+	var clouddata payloads.CreateImage
+
+	err := yaml.Unmarshal(data, &clouddata)
+	if err != nil {
+		glog.Errorf("YAML error: %v", err)
+		return payloads.CreateImageCmd{}, &payloadError{err, payloads.CreateImageInvalidPayload}
+	}
+
+	cmd := clouddata.CreateImage
+	cmd.InstanceUUID = strings.TrimSpace(cmd.InstanceUUID)
+	if !uuidRegexp.MatchString(cmd.InstanceUUID) {
+		err = fmt.Errorf("Invalid instance id received: %s", cmd.InstanceUUID)
+		return payloads.CreateImageCmd{}, &payloadError{err, payloads.CreateImageInvalidData}
+	}
+
+	cmd.ImageUUID = strings.TrimSpace(cmd.ImageUUID)
+	if !uuidRegexp.MatchString(cmd.ImageUUID) {
+		err = fmt.Errorf("Invalid image id received: %s", cmd.ImageUUID)
+		return payloads.CreateImageCmd{}, &payloadError{err, payloads.CreateImageInvalidData}
+	}
+
+	cmd.ImageServiceURL = strings.TrimSpace(cmd.ImageServiceURL)
+	if cmd.ImageServiceURL == "" {
+		err = fmt.Errorf("Missing image service URL for instance: %s", cmd.InstanceUUID)
+		return payloads.CreateImageCmd{}, &payloadError{err, payloads.CreateImageInvalidData}
+	}
+
+	return cmd, nil
+}
+
+func parseGetConsolePayload(data []byte) (payloads.GetConsoleCmd, *payloadError) {
+	var clouddata payloads.GetConsole
+
+	err := yaml.Unmarshal(data, &clouddata)
+	if err != nil {
+		glog.Errorf("YAML error: %v", err)
+		return payloads.GetConsoleCmd{}, &payloadError{err, payloads.GetConsoleInvalidPayload}
+	}
+
+	cmd := clouddata.GetConsole
+	cmd.InstanceUUID = strings.TrimSpace(cmd.InstanceUUID)
+	if !uuidRegexp.MatchString(cmd.InstanceUUID) {
+		err = fmt.Errorf("Invalid instance id received: %s", cmd.InstanceUUID)
+		return payloads.GetConsoleCmd{RequestUUID: cmd.RequestUUID},
+			&payloadError{err, payloads.GetConsoleInvalidData}
+	}
+
+	if cmd.Lines < 0 {
+		err = fmt.Errorf("Invalid number of lines received: %d", cmd.Lines)
+		return payloads.GetConsoleCmd{RequestUUID: cmd.RequestUUID},
+			&payloadError{err, payloads.GetConsoleInvalidData}
+	}
+
+	return cmd, nil
+}
+
+func parseUpdateLimitsPayload(data []byte) (string, resourceLimits, *payloadError) {
+	var clouddata payloads.UpdateLimits
+
+	err := yaml.Unmarshal(data, &clouddata)
+	if err != nil {
+		glog.Errorf("YAML error: %v", err)
+		return "", resourceLimits{}, &payloadError{err, payloads.UpdateLimitsInvalidPayload}
+	}
+
+	cmd := &clouddata.UpdateLimits
+	instance := strings.TrimSpace(cmd.InstanceUUID)
+	if !uuidRegexp.MatchString(instance) {
+		err = fmt.Errorf("Invalid instance id received: %s", instance)
+		return "", resourceLimits{}, &payloadError{err, payloads.UpdateLimitsInvalidData}
+	}
+
+	limits, err := parseLimits(cmd.Limits)
+	if err != nil {
+		return "", resourceLimits{}, &payloadError{err, payloads.UpdateLimitsInvalidData}
+	}
+
+	return instance, limits, nil
+}
+
+func parseEvacuatePayload(data []byte) (payloads.EvacuateNextState, error) {
+	var clouddata payloads.Evacuate
+
+	err := yaml.Unmarshal(data, &clouddata)
+	if err != nil {
+		glog.Errorf("YAML error: %v", err)
+		return "", err
+	}
+
+	nextState := clouddata.Evacuate.NextState
+	switch nextState {
+	case "":
+		nextState = payloads.NextStateMaintenance
+	case payloads.NextStateMaintenance, payloads.NextStateShutdown,
+		payloads.NextStateUpdate, payloads.NextStateReboot:
+	default:
+		return "", fmt.Errorf("Invalid next state received: %s", nextState)
+	}
+
+	return nextState, nil
+}
+
 func extractVolumeInfo(cmd *payloads.VolumeCmd, errString string) (string, string, *payloadError) {
 	instance := strings.TrimSpace(cmd.InstanceUUID)
 	if !uuidRegexp.MatchString(instance) {
@@ -17,6 +17,8 @@
 package main
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/01org/ciao/payloads"
@@ -62,3 +64,237 @@ func TestParseDetachVolumePayload(t *testing.T) {
 		t.Fatalf("DetachVolumeInvalidData error expected")
 	}
 }
+
+func TestParseEvacuatePayload(t *testing.T) {
+	nextState, err := parseEvacuatePayload([]byte(testutil.EvacuateYaml))
+	if err != nil {
+		t.Fatalf("parseEvacuatePayload failed: %v", err)
+	}
+	if nextState != payloads.NextStateMaintenance {
+		t.Fatalf("Expected %s next state, got %s", payloads.NextStateMaintenance, nextState)
+	}
+
+	nextState, err = parseEvacuatePayload([]byte(testutil.EvacuateRebootYaml))
+	if err != nil {
+		t.Fatalf("parseEvacuatePayload failed: %v", err)
+	}
+	if nextState != payloads.NextStateReboot {
+		t.Fatalf("Expected %s next state, got %s", payloads.NextStateReboot, nextState)
+	}
+
+	_, err = parseEvacuatePayload([]byte("  -"))
+	if err == nil {
+		t.Fatalf("Invalid payload error expected")
+	}
+
+	badNextState := strings.Replace(testutil.EvacuateRebootYaml, "reboot", "explode", 1)
+	_, err = parseEvacuatePayload([]byte(badNextState))
+	if err == nil {
+		t.Fatalf("Invalid next state error expected")
+	}
+}
+
+func TestParseMigratePayload(t *testing.T) {
+	instance, uri, err := parseMigratePayload([]byte(testutil.MigrateYaml))
+	if err != nil {
+		t.Fatalf("parseMigratePayload failed: %v", err)
+	}
+	if instance != testutil.InstanceUUID || uri != testutil.MigrationURI {
+		t.Fatalf("InstanceUUID or DestinationURI is invalid")
+	}
+
+	_, _, err = parseMigratePayload([]byte("  -"))
+	if err == nil || err.code != payloads.MigrateInvalidPayload {
+		t.Fatalf("MigrateInvalidPayload error expected")
+	}
+
+	noURI := strings.Replace(testutil.MigrateYaml, testutil.MigrationURI, "", 1)
+	_, _, err = parseMigratePayload([]byte(noURI))
+	if err == nil || err.code != payloads.MigrateInvalidData {
+		t.Fatalf("MigrateInvalidData error expected")
+	}
+}
+
+func TestParseCreateImagePayload(t *testing.T) {
+	cmd, err := parseCreateImagePayload([]byte(testutil.CreateImageYaml))
+	if err != nil {
+		t.Fatalf("parseCreateImagePayload failed: %v", err)
+	}
+	if cmd.InstanceUUID != testutil.InstanceUUID || cmd.ImageUUID != testutil.ImageUUID ||
+		cmd.ImageServiceURL != testutil.GlanceURL || cmd.Token != testutil.ImageToken {
+		t.Fatalf("CreateImage command is invalid")
+	}
+
+	_, err = parseCreateImagePayload([]byte("  -"))
+	if err == nil || err.code != payloads.CreateImageInvalidPayload {
+		t.Fatalf("CreateImageInvalidPayload error expected")
+	}
+
+	noImage := strings.Replace(testutil.CreateImageYaml, testutil.ImageUUID, "", 1)
+	_, err = parseCreateImagePayload([]byte(noImage))
+	if err == nil || err.code != payloads.CreateImageInvalidData {
+		t.Fatalf("CreateImageInvalidData error expected")
+	}
+
+	noURL := strings.Replace(testutil.CreateImageYaml, testutil.GlanceURL, "", 1)
+	_, err = parseCreateImagePayload([]byte(noURL))
+	if err == nil || err.code != payloads.CreateImageInvalidData {
+		t.Fatalf("CreateImageInvalidData error expected")
+	}
+}
+
+func TestParseGetConsolePayload(t *testing.T) {
+	cmd, err := parseGetConsolePayload([]byte(testutil.GetConsoleYaml))
+	if err != nil {
+		t.Fatalf("parseGetConsolePayload failed: %v", err)
+	}
+	if cmd.InstanceUUID != testutil.InstanceUUID || cmd.Lines != 50 ||
+		cmd.RequestUUID != testutil.ConsoleRequestUUID {
+		t.Fatalf("GetConsole command is invalid")
+	}
+
+	_, err = parseGetConsolePayload([]byte("  -"))
+	if err == nil || err.code != payloads.GetConsoleInvalidPayload {
+		t.Fatalf("GetConsoleInvalidPayload error expected")
+	}
+
+	noInstance := strings.Replace(testutil.GetConsoleYaml, testutil.InstanceUUID, "", 1)
+	cmd, err = parseGetConsolePayload([]byte(noInstance))
+	if err == nil || err.code != payloads.GetConsoleInvalidData {
+		t.Fatalf("GetConsoleInvalidData error expected")
+	}
+	if cmd.RequestUUID != testutil.ConsoleRequestUUID {
+		t.Fatalf("Request UUID of invalid GetConsole command not returned")
+	}
+
+	badLines := strings.Replace(testutil.GetConsoleYaml, "lines: 50", "lines: -1", 1)
+	_, err = parseGetConsolePayload([]byte(badLines))
+	if err == nil || err.code != payloads.GetConsoleInvalidData {
+		t.Fatalf("GetConsoleInvalidData error expected")
+	}
+}
+
+func TestParseUpdateLimitsPayload(t *testing.T) {
+	instance, limits, err := parseUpdateLimitsPayload([]byte(testutil.UpdateLimitsYaml))
+	if err != nil {
+		t.Fatalf("parseUpdateLimitsPayload failed: %v", err)
+	}
+	expected := resourceLimits{CPUShares: 512, MemLimitMB: 2048, DiskIOPS: 100}
+	if instance != testutil.InstanceUUID || limits != expected {
+		t.Fatalf("UpdateLimits command is invalid")
+	}
+
+	_, _, err = parseUpdateLimitsPayload([]byte("  -"))
+	if err == nil || err.code != payloads.UpdateLimitsInvalidPayload {
+		t.Fatalf("UpdateLimitsInvalidPayload error expected")
+	}
+
+	noInstance := strings.Replace(testutil.UpdateLimitsYaml, testutil.InstanceUUID, "", 1)
+	_, _, err = parseUpdateLimitsPayload([]byte(noInstance))
+	if err == nil || err.code != payloads.UpdateLimitsInvalidData {
+		t.Fatalf("UpdateLimitsInvalidData error expected")
+	}
+
+	badLimit := strings.Replace(testutil.UpdateLimitsYaml, "value: 512", "value: -1", 1)
+	_, _, err = parseUpdateLimitsPayload([]byte(badLimit))
+	if err == nil || err.code != payloads.UpdateLimitsInvalidData {
+		t.Fatalf("UpdateLimitsInvalidData error expected")
+	}
+}
+
+func TestParseRestartPayload(t *testing.T) {
+	instance, size, err := parseRestartPayload([]byte(testutil.RestartYaml))
+	if err != nil {
+		t.Fatalf("parseRestartPayload failed: %v", err)
+	}
+	expected := instanceSize{cpus: 2, mem: 4096, disk: 10000}
+	if instance != testutil.InstanceUUID || size != expected {
+		t.Fatalf("Restart command is invalid")
+	}
+
+	_, size, err = parseRestartPayload([]byte(testutil.PartialRestartYaml))
+	if err != nil {
+		t.Fatalf("parseRestartPayload failed: %v", err)
+	}
+	if size != (instanceSize{cpus: 2}) {
+		t.Fatalf("Unexpected size %+v", size)
+	}
+
+	_, _, err = parseRestartPayload([]byte("  -"))
+	if err == nil || err.code != payloads.RestartInvalidPayload {
+		t.Fatalf("RestartInvalidPayload error expected")
+	}
+
+	noInstance := strings.Replace(testutil.RestartYaml, testutil.InstanceUUID, "", 1)
+	_, _, err = parseRestartPayload([]byte(noInstance))
+	if err == nil || err.code != payloads.RestartInvalidData {
+		t.Fatalf("RestartInvalidData error expected")
+	}
+
+	badSize := strings.Replace(testutil.RestartYaml, "value: 4096", "value: -1", 1)
+	_, _, err = parseRestartPayload([]byte(badSize))
+	if err == nil || err.code != payloads.RestartInvalidData {
+		t.Fatalf("RestartInvalidData error expected")
+	}
+}
+
+func TestParseStartPayloadIncoming(t *testing.T) {
+	cfg, err := parseStartPayload([]byte(testutil.StartYaml))
+	if err != nil {
+		t.Fatalf("parseStartPayload failed: %v", err)
+	}
+	if cfg.incoming != "" {
+		t.Errorf("Unexpected incoming migration URI %s", cfg.incoming)
+	}
+
+	incoming := testutil.StartYaml + "  incoming_migration: tcp:0:4444\n"
+	cfg, err = parseStartPayload([]byte(incoming))
+	if err != nil {
+		t.Fatalf("parseStartPayload failed: %v", err)
+	}
+	if cfg.incoming != "tcp:0:4444" {
+		t.Errorf("Expected incoming migration URI tcp:0:4444, got %s", cfg.incoming)
+	}
+}
+
+func TestParseStartPayloadBestEffort(t *testing.T) {
+	cfg, err := parseStartPayload([]byte(testutil.StartYaml))
+	if err != nil {
+		t.Fatalf("parseStartPayload failed: %v", err)
+	}
+	if len(cfg.BestEffort) != 0 || !cfg.mandatory(payloads.VCPUs) {
+		t.Errorf("Unexpected best effort resources %v", cfg.BestEffort)
+	}
+
+	optionalVCPUs := strings.Replace(testutil.StartYaml,
+		"value: 2\n    mandatory: true", "value: 2\n    mandatory: false", 1)
+	cfg, err = parseStartPayload([]byte(optionalVCPUs))
+	if err != nil {
+		t.Fatalf("parseStartPayload failed: %v", err)
+	}
+	if cfg.mandatory(payloads.VCPUs) || !cfg.mandatory(payloads.MemMB) {
+		t.Errorf("Expected only vcpus to be best effort, got %v", cfg.BestEffort)
+	}
+}
+
+func TestParseStartPayloadVolumes(t *testing.T) {
+	volumes := testutil.StartYaml + `  storage:
+    id: ` + testutil.VolumeUUID + `
+    boot: true
+  volumes:
+  - id: 67d86208-b46c-4465-9018-fe14087d415f
+    boot: false
+`
+	cfg, err := parseStartPayload([]byte(volumes))
+	if err != nil {
+		t.Fatalf("parseStartPayload failed: %v", err)
+	}
+
+	expected := []volumeConfig{
+		{UUID: testutil.VolumeUUID, Bootable: true},
+		{UUID: "67d86208-b46c-4465-9018-fe14087d415f"},
+	}
+	if !reflect.DeepEqual(cfg.Volumes, expected) {
+		t.Errorf("Expected volumes %v, got %v", expected, cfg.Volumes)
+	}
+}
@@ -42,6 +42,20 @@ const (
 	seedImage  = "seed.iso"
 	imagesPath = "/var/lib/ciao/images"
 	vcTries    = 10
+
+	migratePollInterval = time.Second
+
+	// rootfsDriveID is the name qemu gave to the rootfs drive when it
+	// was added with if=virtio.  Instances started with that name may
+	// still be running so it is kept.
+	rootfsDriveID = "virtio0"
+	seedDriveID   = "seed"
+
+	// firstPCIAddr is the first PCI slot given to the instance disks
+	// and network interfaces, i.e., the slot of the rootfs.  The slots
+	// below it are taken by the devices qemu adds itself, e.g., the VGA
+	// card.  Spice takes one more slot.
+	firstPCIAddr = 3
 )
 
 type qmpGlogLogger struct{}
@@ -228,8 +242,17 @@ func (q *qemuV) createRootfs() error {
 func (q *qemuV) checkBackingImage() error {
 	backingImage := path.Join(imagesPath, q.cfg.Image)
 	_, err := os.Stat(backingImage)
-	if err != nil {
-		return fmt.Errorf("Backing Image does not exist: %v", err)
+	if os.IsNotExist(err) {
+		return errImageNotFound
+	} else if err != nil {
+		return fmt.Errorf("Unable to access backing image: %v", err)
+	}
+
+	if q.cfg.imageServiceURL != "" && imgCache != nil {
+		err = imgCache.validate(q.cfg.imageServiceURL, q.cfg.token, q.cfg.Image)
+		if err != nil {
+			return err
+		}
 	}
 
 	if q.cfg.Disk != 0 {
@@ -248,7 +271,11 @@ func (q *qemuV) checkBackingImage() error {
 }
 
 func (q *qemuV) downloadBackingImage() error {
-	return fmt.Errorf("Not supported yet!")
+	if q.cfg.imageServiceURL == "" {
+		return fmt.Errorf("No image service to download %s from", q.cfg.Image)
+	}
+
+	return downloadImage(q.cfg.imageServiceURL, q.cfg.token, imagesPath, q.cfg.Image)
 }
 
 func (q *qemuV) createImage(bridge string, userData, metaData []byte) error {
@@ -261,10 +288,55 @@ func (q *qemuV) createImage(bridge string, userData, metaData []byte) error {
 	return q.createRootfs()
 }
 
+// resize grows the instance's rootfs if the requested disk size exceeds its
+// current virtual size.  The CPU and memory settings are read from the
+// vmConfig when qemu is next launched.
+func (q *qemuV) resize() error {
+	if q.cfg.Image == "" || q.cfg.Disk == 0 {
+		return nil
+	}
+
+	vmImage := path.Join(q.instanceDir, "image.qcow2")
+	sizeMB, err := q.imageInfo(vmImage)
+	if err != nil {
+		return fmt.Errorf("Unable to determine size of %s: %v", vmImage, err)
+	}
+
+	// qemu-img info reports sizes in units of 1000 * 1000 bytes but
+	// qemu-img create and resize interpret M as 1024 * 1024 bytes.
+	if sizeMB != -1 && int64(q.cfg.Disk)*1024*1024 <= int64(sizeMB)*1000*1000 {
+		return nil
+	}
+
+	diskSize := fmt.Sprintf("%dM", q.cfg.Disk)
+	glog.Infof("Growing %s to %s", vmImage, diskSize)
+
+	cmd := exec.Command("qemu-img", "resize", vmImage, diskSize)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("qemu-img resize failed: %v: %s", err, string(out))
+	}
+
+	return nil
+}
+
 func (q *qemuV) deleteImage() error {
 	return nil
 }
 
+func (q *qemuV) snapshot(target string) error {
+	vmImage := path.Join(q.instanceDir, "image.qcow2")
+	glog.Infof("Converting %s to %s", vmImage, target)
+
+	cmd := exec.Command("qemu-img", "convert", "-O", "qcow2", vmImage, target)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("qemu-img convert failed: %v: %s", err, string(out))
+	}
+
+	return nil
+}
+
 func cleanupFds(fds []*os.File, numFds int) {
 
 	maxFds := len(fds)
@@ -278,34 +350,31 @@ func cleanupFds(fds []*os.File, numFds int) {
 	}
 }
 
-func computeMacvtapParam(vnicName string, mac string, queues int) ([]string, []*os.File, error) {
+func computeMacvtapParam(vnicName string, mac string, queues int) (qemu.NetDevice, error) {
 
 	fds := make([]*os.File, queues)
-	params := make([]string, 0, 8)
 
 	ifIndexPath := path.Join("/sys/class/net", vnicName, "ifindex")
 	fip, err := os.Open(ifIndexPath)
 	if err != nil {
 		glog.Errorf("Failed to determine tap ifname: %s", err)
-		return nil, nil, err
+		return qemu.NetDevice{}, err
 	}
 	defer func() { _ = fip.Close() }()
 
 	scan := bufio.NewScanner(fip)
 	if !scan.Scan() {
 		glog.Error("Unable to read tap index")
-		return nil, nil, fmt.Errorf("Unable to read tap index")
+		return qemu.NetDevice{}, fmt.Errorf("Unable to read tap index")
 	}
 
 	i, err := strconv.Atoi(scan.Text())
 	if err != nil {
 		glog.Errorf("Failed to determine tap ifname: %s", err)
-		return nil, nil, err
+		return qemu.NetDevice{}, err
 	}
 
-	//mq support
-	var fdParam bytes.Buffer
-	fdSeperator := ""
+	//mq support, one file descriptor per queue
 	for q := 0; q < queues; q++ {
 
 		tapDev := fmt.Sprintf("/dev/tap%d", i)
@@ -314,55 +383,79 @@ func computeMacvtapParam(vnicName string, mac string, queues int) ([]string, []*
 		if err != nil {
 			glog.Errorf("Failed to open tap device %s: %s", tapDev, err)
 			cleanupFds(fds, q)
-			return nil, nil, err
+			return qemu.NetDevice{}, err
 		}
 		fds[q] = f
-		/*
-		   3, what do you mean 3.  Well, it turns out that files passed to child
-		   processes via cmd.ExtraFiles have different fds in the child and the
-		   parent.  In the child the fds are determined by the file's position
-		   in the ExtraFiles array + 3.
-		*/
-
-		// bytes.WriteString does not return an error
-		_, _ = fdParam.WriteString(fmt.Sprintf("%s%d", fdSeperator, q+3))
-		fdSeperator = ":"
 	}
 
-	netdev := fmt.Sprintf("type=tap,fds=%s,id=%s,vhost=on", fdParam.String(), vnicName)
-	device := fmt.Sprintf("virtio-net-pci,netdev=%s,mq=on,vectors=%d,mac=%s", vnicName, 32, mac)
-	params = append(params, "-netdev", netdev)
-	params = append(params, "-device", device)
-	return params, fds, nil
+	return qemu.NetDevice{
+		Type:       qemu.MACVTAP,
+		Driver:     qemu.VirtioNet,
+		ID:         vnicName,
+		FDs:        fds,
+		VHost:      true,
+		MACAddress: mac,
+	}, nil
 }
 
-func computeTapParam(vnicName string, mac string) ([]string, error) {
-	params := make([]string, 0, 8)
-	netdev := fmt.Sprintf("type=tap,ifname=%s,script=no,downscript=no,id=%s,vhost=on", vnicName, vnicName)
-	device := fmt.Sprintf("driver=virtio-net-pci,netdev=%s,mac=%s", vnicName, mac)
+func computeTapParam(vnicName string, mac string) (qemu.NetDevice, error) {
+	return qemu.NetDevice{
+		Type:       qemu.TAP,
+		Driver:     qemu.VirtioNet,
+		ID:         vnicName,
+		IFName:     vnicName,
+		Script:     "no",
+		DownScript: "no",
+		VHost:      true,
+		MACAddress: mac,
+	}, nil
+}
+
+// consoleDevice returns the guest serial port.  Everything the guest writes
+// to it is logged to the instance console log and, if port is set, sent to
+// the netcat clients connected to host:port.
+func consoleDevice(instanceDir, host string, port int) qemu.CharDevice {
+	dev := qemu.CharDevice{
+		Driver:  qemu.ISASerial,
+		Backend: qemu.Null,
+		ID:      "gnc0",
+		LogFile: path.Join(instanceDir, consoleLogName),
+	}
+
+	if port > 0 {
+		dev.Backend = qemu.Socket
+		dev.Host = host
+		dev.Port = port
+	}
 
-	params = append(params, "-netdev", netdev)
-	params = append(params, "-device", device)
-	return params, nil
+	return dev
 }
 
-func launchQemuWithNC(params []string, fds []*os.File, ipAddress string) (int, error) {
+// withDevice returns a copy of config with dev added to its devices.  The
+// device list is copied so that config can be relaunched without dev.
+func withDevice(config qemu.Config, dev qemu.Device) qemu.Config {
+	devices := make([]qemu.Device, 0, len(config.Devices)+1)
+	devices = append(devices, config.Devices...)
+	config.Devices = append(devices, dev)
+	return config
+}
+
+func launchQemuWithNC(config qemu.Config, instanceDir, ipAddress string) (int, error) {
 	var err error
 
 	tries := 0
-	params = append(params, "-display", "none", "-vga", "none")
-	params = append(params, "-device", "isa-serial,chardev=gnc0", "-chardev", "")
+	config.Display = "none"
+	config.VGA = "none"
 	port := 0
 	for ; tries < vcTries; tries++ {
 		port = uiPortGrabber.grabPort()
 		if port == 0 {
 			break
 		}
-		ncString := "socket,port=%d,host=%s,server,id=gnc0,server,nowait"
-		params[len(params)-1] = fmt.Sprintf(ncString, port, ipAddress)
+		ncConfig := withDevice(config, consoleDevice(instanceDir, ipAddress, port))
 		var errStr string
 
-		errStr, err = qemu.LaunchCustomQemu(context.Background(), "", params, fds, qmpGlogLogger{})
+		errStr, err = qemu.LaunchQemu(ncConfig, qmpGlogLogger{})
 		if err == nil {
 			glog.Info("============================================")
 			glog.Infof("Connect to vm with netcat %s %d", ipAddress, port)
@@ -379,26 +472,29 @@ func launchQemuWithNC(params []string, fds []*os.File, ipAddress string) (int, e
 
 	if port == 0 || (err != nil && tries == vcTries) {
 		glog.Warning("Failed to launch qemu due to chardev error.  Relaunching without virtual console")
-		_, err = qemu.LaunchCustomQemu(context.Background(), "", params[:len(params)-4], fds, qmpGlogLogger{})
+		_, err = qemu.LaunchQemu(withDevice(config, consoleDevice(instanceDir, "", 0)), qmpGlogLogger{})
 	}
 
 	return port, err
 }
 
-func launchQemuWithSpice(params []string, fds []*os.File, ipAddress string) (int, error) {
+func launchQemuWithSpice(config qemu.Config, ipAddress string) (int, error) {
 	var err error
 
 	tries := 0
-	params = append(params, "-spice", "")
 	port := 0
 	for ; tries < vcTries; tries++ {
 		port = uiPortGrabber.grabPort()
 		if port == 0 {
 			break
 		}
-		params[len(params)-1] = fmt.Sprintf("port=%d,addr=%s,disable-ticketing", port, ipAddress)
+		config.Spice = qemu.Spice{
+			Port:             port,
+			Addr:             ipAddress,
+			DisableTicketing: true,
+		}
 		var errStr string
-		errStr, err = qemu.LaunchCustomQemu(context.Background(), "", params, fds, qmpGlogLogger{})
+		errStr, err = qemu.LaunchQemu(config, qmpGlogLogger{})
 		if err == nil {
 			glog.Info("============================================")
 			glog.Infof("Connect to vm with spicec -h %s -p %d", ipAddress, port)
@@ -416,50 +512,81 @@ func launchQemuWithSpice(params []string, fds []*os.File, ipAddress string) (int
 
 	if port == 0 || (err != nil && tries == vcTries) {
 		glog.Warning("Failed to launch qemu due to spice error.  Relaunching without virtual console")
-		params = append(params[:len(params)-2], "-display", "none", "-vga", "none")
-		_, err = qemu.LaunchCustomQemu(context.Background(), "", params, fds, qmpGlogLogger{})
+		config.Spice = qemu.Spice{}
+		config.Display = "none"
+		config.VGA = "none"
+		_, err = qemu.LaunchQemu(config, qmpGlogLogger{})
 	}
 
 	return port, err
 }
 
-func generateQEMULaunchParams(cfg *vmConfig, isoPath, instanceDir string,
-	networkParams []string, cephID string) []string {
-	params := make([]string, 0, 32)
+func generateQEMUConfig(cfg *vmConfig, isoPath, instanceDir string,
+	netDevices []qemu.Device, cephID string) qemu.Config {
+	config := qemu.Config{
+		// Volumes are given fixed addresses so that they can be detached
+		// while the instance runs.  The slots are given in the order
+		// of the devices, which keeps the PCI layout of the instances
+		// started by older launchers, as they are live migrated to
+		// this one.
+		FirstPCIAddr: firstPCIAddr,
+		QMPSockets: []qemu.QMPSocket{
+			{
+				Type:   qemu.Unix,
+				Name:   path.Join(instanceDir, "socket"),
+				Server: true,
+				NoWait: true,
+			},
+		},
+		Knobs: qemu.Knobs{
+			Daemonize: true,
+		},
+		Incoming: qemu.Incoming{
+			URI: cfg.incoming,
+		},
+	}
 
-	addr := 3
 	if launchWithUI.String() == "spice" {
-		addr = 4
+		config.FirstPCIAddr++
 	}
-	if cfg.Image != "" {
-		vmImage := path.Join(instanceDir, "image.qcow2")
-		fileParam := fmt.Sprintf("file=%s,if=virtio,aio=threads,format=qcow2", vmImage)
-		params = append(params, "-drive", fileParam)
-		addr++
-	}
-
-	// I know this is nasty but we have to specify a bus and address otherwise qemu
-	// hangs on startup.  I can't find a way to get qemu to pre-allocate the address.
-	// It will do this when using the legacy method of adding volumes but we can't do
-	// this if we want to be able to live detach these volumes.  The first drive qemu
-	// adds, i.e., the rootfs  is assigned a slot of 3 without spice and 4 with.
 
+	if cfg.Image != "" {
+		config.Devices = append(config.Devices, qemu.BlockDevice{
+			Driver:    qemu.VirtioBlock,
+			ID:        rootfsDriveID,
+			File:      path.Join(instanceDir, "image.qcow2"),
+			Interface: qemu.NoInterface,
+			AIO:       qemu.Threads,
+			Format:    qemu.QCOW2,
+			WCE:       true,
+		})
+	}
+
+	// The drive and device IDs must match the ones used by qmpAttach and
+	// qmpDetach.
 	for _, v := range cfg.Volumes {
-		blockdevID := fmt.Sprintf("drive_%s", v.UUID)
-		volDriveStr := fmt.Sprintf("file=rbd:rbd/%s:id=%s,if=none,id=%s,format=raw",
-			v.UUID, cephID, blockdevID)
-		params = append(params, "-drive", volDriveStr)
-		volDeviceStr :=
-			fmt.Sprintf("virtio-blk-pci,scsi=off,bus=pci.0,addr=0x%x,id=device_%s,drive=%s",
-				addr, v.UUID, blockdevID)
-		params = append(params, "-device", volDeviceStr)
-		addr++
-	}
-
-	isoParam := fmt.Sprintf("file=%s,if=virtio,media=cdrom", isoPath)
-	params = append(params, "-drive", isoParam)
-
-	params = append(params, networkParams...)
+		config.Devices = append(config.Devices, qemu.BlockDevice{
+			Driver:    qemu.VirtioBlock,
+			ID:        fmt.Sprintf("drive_%s", v.UUID),
+			DeviceID:  fmt.Sprintf("device_%s", v.UUID),
+			File:      fmt.Sprintf("rbd:rbd/%s:id=%s", v.UUID, cephID),
+			Interface: qemu.NoInterface,
+			Format:    qemu.RAW,
+			WCE:       true,
+		})
+	}
+
+	config.Devices = append(config.Devices, qemu.BlockDevice{
+		Driver:    qemu.VirtioBlock,
+		ID:        seedDriveID,
+		File:      isoPath,
+		Interface: qemu.NoInterface,
+		Format:    qemu.RAW,
+		Media:     qemu.CDROM,
+		WCE:       true,
+	})
+
+	config.Devices = append(config.Devices, netDevices...)
 
 	useKvm := true
 
@@ -474,81 +601,79 @@ func generateQEMULaunchParams(cfg *vmConfig, isoPath, instanceDir string,
 	}
 
 	if useKvm {
-		params = append(params, "-enable-kvm")
-		params = append(params, "-cpu", "host")
+		config.Machine = qemu.Machine{
+			Type:         "pc",
+			Acceleration: "kvm",
+		}
+		config.CPUModel = "host"
 	} else {
 		glog.Warning("Running qemu without kvm support")
 	}
 
-	params = append(params, "-daemonize")
-
-	qmpSocket := path.Join(instanceDir, "socket")
-	qmpParam := fmt.Sprintf("unix:%s,server,nowait", qmpSocket)
-	params = append(params, "-qmp", qmpParam)
-
 	if cfg.Mem > 0 {
-		memoryParam := fmt.Sprintf("%d", cfg.Mem)
-		params = append(params, "-m", memoryParam)
+		config.Memory.Size = fmt.Sprintf("%dM", cfg.Mem)
 	}
 	if cfg.Cpus > 0 {
-		cpusParam := fmt.Sprintf("cpus=%d", cfg.Cpus)
-		params = append(params, "-smp", cpusParam)
+		config.SMP.CPUs = uint32(cfg.Cpus)
 	}
 
 	if !cfg.Legacy {
-		params = append(params, "-bios", qemuEfiFw)
+		config.Bios = qemuEfiFw
 	}
-	return params
+
+	return config
 }
 
 func (q *qemuV) startVM(vnicName, ipAddress, cephID string) error {
 
-	var fds []*os.File
+	var netDevice qemu.NetDevice
 
 	glog.Info("Launching qemu")
 
-	networkParams := make([]string, 0, 32)
-
 	if vnicName != "" {
+		var err error
 		if q.cfg.NetworkNode {
-			var err error
-			var macvtapParam []string
 			//TODO: @mcastelino get from scheduler/controller
 			numQueues := 4
-			macvtapParam, fds, err = computeMacvtapParam(vnicName, q.cfg.VnicMAC, numQueues)
+			netDevice, err = computeMacvtapParam(vnicName, q.cfg.VnicMAC, numQueues)
 			if err != nil {
 				return err
 			}
-			defer cleanupFds(fds, len(fds))
-			networkParams = append(networkParams, macvtapParam...)
+			defer cleanupFds(netDevice.FDs, len(netDevice.FDs))
 		} else {
-			tapParam, err := computeTapParam(vnicName, q.cfg.VnicMAC)
+			netDevice, err = computeTapParam(vnicName, q.cfg.VnicMAC)
 			if err != nil {
 				return err
 			}
-			networkParams = append(networkParams, tapParam...)
 		}
 	} else {
-		networkParams = append(networkParams, "-net", "nic,model=virtio")
-		networkParams = append(networkParams, "-net", "user")
+		netDevice = qemu.NetDevice{
+			Type:   qemu.User,
+			Driver: qemu.VirtioNet,
+			ID:     "user0",
+		}
 	}
 
-	params := generateQEMULaunchParams(q.cfg, q.isoPath, q.instanceDir, networkParams, cephID)
+	config := generateQEMUConfig(q.cfg, q.isoPath, q.instanceDir,
+		[]qemu.Device{netDevice}, cephID)
 
 	var err error
 
 	if !launchWithUI.Enabled() {
-		params = append(params, "-display", "none", "-vga", "none")
-		_, err = qemu.LaunchCustomQemu(context.Background(), "", params, fds, qmpGlogLogger{})
+		config = withDevice(config, consoleDevice(q.instanceDir, "", 0))
+		config.Display = "none"
+		config.VGA = "none"
+		_, err = qemu.LaunchQemu(config, qmpGlogLogger{})
 	} else if launchWithUI.String() == "spice" {
 		var port int
-		port, err = launchQemuWithSpice(params, fds, ipAddress)
+		config = withDevice(config, consoleDevice(q.instanceDir, "", 0))
+		port, err = launchQemuWithSpice(config, ipAddress)
 		if err == nil {
 			q.vcPort = port
 		}
 	} else {
 		var port int
-		port, err = launchQemuWithNC(params, fds, ipAddress)
+		port, err = launchQemuWithNC(config, q.instanceDir, ipAddress)
 		if err == nil {
 			q.vcPort = port
 		}
@@ -563,6 +688,10 @@ func (q *qemuV) startVM(vnicName, ipAddress, cephID string) error {
 	return nil
 }
 
+func (q *qemuV) consoleLog(lines int) (string, error) {
+	return tailConsoleLog(path.Join(q.instanceDir, consoleLogName), lines)
+}
+
 func (q *qemuV) lostVM() {
 	if launchWithUI.Enabled() {
 		glog.Infof("Releasing VC Port %d", q.vcPort)
@@ -571,6 +700,15 @@ func (q *qemuV) lostVM() {
 	}
 	q.pid = 0
 	q.prevCPUTime = -1
+	removeCgroup(q.cfg.Instance)
+}
+
+func (q *qemuV) setLimits(limits resourceLimits) error {
+	if q.pid == 0 {
+		return fmt.Errorf("PID of qemu for instance %s is not known", q.cfg.Instance)
+	}
+
+	return applyCgroupLimits(q.cfg.Instance, q.pid, limits, q.instanceDir)
 }
 
 func qmpAttach(cmd virtualizerAttachCmd, q *qemu.QMP) {
@@ -606,6 +744,55 @@ func qmpDetach(cmd virtualizerDetachCmd, q *qemu.QMP) {
 	cmd.responseCh <- err
 }
 
+// qmpSnapshot copies the rootfs of a running instance into cmd.target.  The
+// rootfs is the drive named rootfsDriveID.
+func qmpSnapshot(cmd virtualizerSnapshotCmd, q *qemu.QMP) {
+	glog.Infof("Snapshot command received, target %s", cmd.target)
+	err := q.ExecuteDriveBackup(context.Background(), rootfsDriveID, cmd.target, "qcow2")
+	if err != nil {
+		glog.Errorf("Failed to execute drive-backup: %v", err)
+	}
+	cmd.responseCh <- err
+}
+
+// qmpMigrate starts the migration of the instance.  Disks are copied
+// incrementally along with the instance's memory as the destination node
+// creates its own rootfs from the same backing image.
+func qmpMigrate(cmd virtualizerMigrateCmd, q *qemu.QMP) error {
+	glog.Infof("Migrate command received, destination %s", cmd.uri)
+	err := q.ExecuteMigrate(context.Background(), cmd.uri, true, true)
+	if err != nil {
+		glog.Errorf("Failed to execute migrate: %v", err)
+	}
+	return err
+}
+
+// qmpMigrateStatus checks on an ongoing migration.  It returns true
+// when the migration is over, along with an error if it did not complete.
+func qmpMigrateStatus(q *qemu.QMP) (bool, error) {
+	status, err := q.ExecuteQueryMigrate(context.Background())
+	if err != nil {
+		glog.Errorf("Failed to execute query-migrate: %v", err)
+		return true, err
+	}
+
+	switch status.Status {
+	case qemu.MigrationCompleted:
+		glog.Infof("Migration completed in %d ms, downtime %d ms",
+			status.TotalTime, status.Downtime)
+		return true, nil
+	case qemu.MigrationFailed, qemu.MigrationCancelled, qemu.MigrationNone:
+		return true, fmt.Errorf("Migration %s: %s", status.Status, status.ErrorDesc)
+	}
+
+	if glog.V(1) {
+		glog.Infof("Migration %s: %d/%d bytes transferred", status.Status,
+			status.RAM.Transferred, status.RAM.Total)
+	}
+
+	return false, nil
+}
+
 func qmpConnect(qmpChannel chan interface{}, instance, instanceDir string, closedCh chan struct{},
 	connectedCh chan struct{}, wg *sync.WaitGroup, boot bool) {
 
@@ -638,22 +825,68 @@ func qmpConnect(qmpChannel chan interface{}, instance, instanceDir string, close
 
 	close(connectedCh)
 
+	// migrateCh is only set while a migration is in progress.  The
+	// migration is polled from this loop so that other commands, such
+	// as stop, can still be processed while it runs.
+
+	var migrateCh chan error
+	var migrateTimer <-chan time.Time
+
+	consoleTimer := time.After(consoleRotateInterval)
+
+	defer func() {
+		if migrateCh != nil {
+			migrateCh <- fmt.Errorf("Lost connection to instance during migration")
+		}
+	}()
+
 DONE:
 	for {
-		cmd, ok := <-qmpChannel
-		if !ok {
-			break DONE
-		}
-		switch cmd := cmd.(type) {
-		case virtualizerStopCmd:
-			err = q.ExecuteQuit(context.Background())
+		select {
+		case cmd, ok := <-qmpChannel:
+			if !ok {
+				break DONE
+			}
+			switch cmd := cmd.(type) {
+			case virtualizerStopCmd:
+				err = q.ExecuteQuit(context.Background())
+				if err != nil {
+					glog.Warningf("Failed to execute stop command: %v", err)
+				}
+			case virtualizerAttachCmd:
+				qmpAttach(cmd, q)
+			case virtualizerDetachCmd:
+				qmpDetach(cmd, q)
+			case virtualizerSnapshotCmd:
+				qmpSnapshot(cmd, q)
+			case virtualizerMigrateCmd:
+				if migrateCh != nil {
+					cmd.responseCh <- fmt.Errorf("Migration already in progress")
+					break
+				}
+				err = qmpMigrate(cmd, q)
+				if err != nil {
+					cmd.responseCh <- err
+					break
+				}
+				migrateCh = cmd.responseCh
+				migrateTimer = time.After(migratePollInterval)
+			}
+		case <-migrateTimer:
+			done, err := qmpMigrateStatus(q)
+			if !done {
+				migrateTimer = time.After(migratePollInterval)
+				break
+			}
+			migrateCh <- err
+			migrateCh = nil
+			migrateTimer = nil
+		case <-consoleTimer:
+			err := rotateConsoleLog(path.Join(instanceDir, consoleLogName), consoleLogMaxSize)
 			if err != nil {
-				glog.Warningf("Failed to execute stop command: %v", err)
+				glog.Warningf("Unable to rotate console log of %s: %v", instance, err)
 			}
-		case virtualizerAttachCmd:
-			qmpAttach(cmd, q)
-		case virtualizerDetachCmd:
-			qmpDetach(cmd, q)
+			consoleTimer = time.After(consoleRotateInterval)
 		}
 	}
 }
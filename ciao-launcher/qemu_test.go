@@ -24,9 +24,13 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/01org/ciao/qemu"
+	"github.com/01org/ciao/testutil"
 )
 
 var imageInfoTestGood = `
@@ -135,74 +139,174 @@ func TestExtractImageInfo(t *testing.T) {
 	}
 }
 
-func genQEMUParams(networkParams []string) []string {
-	baseParams := []string{
-		"-drive",
-		"file=/var/lib/ciao/instance/1/image.qcow2,if=virtio,aio=threads,format=qcow2",
-		"-drive",
-		"file=/var/lib/ciao/instance/1/seed.iso,if=virtio,media=cdrom",
+func genQEMUConfig(devices ...qemu.Device) qemu.Config {
+	config := qemu.Config{
+		Machine: qemu.Machine{
+			Type:         "pc",
+			Acceleration: "kvm",
+		},
+		CPUModel:     "host",
+		FirstPCIAddr: firstPCIAddr,
+		QMPSockets: []qemu.QMPSocket{
+			{
+				Type:   qemu.Unix,
+				Name:   "/var/lib/ciao/instance/1/socket",
+				Server: true,
+				NoWait: true,
+			},
+		},
+		Knobs: qemu.Knobs{
+			Daemonize: true,
+		},
+		Devices: []qemu.Device{
+			qemu.BlockDevice{
+				Driver:    qemu.VirtioBlock,
+				ID:        rootfsDriveID,
+				File:      "/var/lib/ciao/instance/1/image.qcow2",
+				Interface: qemu.NoInterface,
+				AIO:       qemu.Threads,
+				Format:    qemu.QCOW2,
+				WCE:       true,
+			},
+		},
 	}
-	baseParams = append(baseParams, networkParams...)
-	baseParams = append(baseParams, "-enable-kvm", "-cpu", "host", "-daemonize",
-		"-qmp", "unix:/var/lib/ciao/instance/1/socket,server,nowait")
+	config.Devices = append(config.Devices, devices...)
+	config.Devices = append(config.Devices, qemu.BlockDevice{
+		Driver:    qemu.VirtioBlock,
+		ID:        seedDriveID,
+		File:      "/var/lib/ciao/instance/1/seed.iso",
+		Interface: qemu.NoInterface,
+		Format:    qemu.RAW,
+		Media:     qemu.CDROM,
+		WCE:       true,
+	})
 
-	return baseParams
+	return config
 }
 
-func TestGenerateQEMULaunchParams(t *testing.T) {
-	var cfg vmConfig
-
-	params := genQEMUParams(nil)
-	cfg.Legacy = true
-	cfg.Image = "some_image"
-	genParams := generateQEMULaunchParams(&cfg, "/var/lib/ciao/instance/1/seed.iso",
-		"/var/lib/ciao/instance/1", nil, "ciao")
-	if !reflect.DeepEqual(params, genParams) {
-		t.Fatalf("%s and %s do not match", params, genParams)
+func TestGenerateQEMUConfig(t *testing.T) {
+	userNet := qemu.NetDevice{
+		Type:   qemu.User,
+		Driver: qemu.VirtioNet,
+		ID:     "user0",
+	}
+	volume := qemu.BlockDevice{
+		Driver:    qemu.VirtioBlock,
+		ID:        "drive_" + testutil.VolumeUUID,
+		DeviceID:  "device_" + testutil.VolumeUUID,
+		File:      "rbd:rbd/" + testutil.VolumeUUID + ":id=ciao",
+		Interface: qemu.NoInterface,
+		Format:    qemu.RAW,
+		WCE:       true,
 	}
 
-	params = genQEMUParams(nil)
-	cfg.Legacy = false
-	cfg.Mem = 0
-	cfg.Cpus = 0
-	params = append(params, "-bios", qemuEfiFw)
-	genParams = generateQEMULaunchParams(&cfg, "/var/lib/ciao/instance/1/seed.iso",
-		"/var/lib/ciao/instance/1", nil, "ciao")
-	if !reflect.DeepEqual(params, genParams) {
-		t.Fatalf("%s and %s do not match", params, genParams)
+	tests := []struct {
+		name       string
+		cfg        vmConfig
+		netDevices []qemu.Device
+		expected   func() qemu.Config
+	}{
+		{
+			"legacy",
+			vmConfig{Legacy: true},
+			nil,
+			func() qemu.Config { return genQEMUConfig() },
+		},
+		{
+			"efi",
+			vmConfig{},
+			nil,
+			func() qemu.Config {
+				c := genQEMUConfig()
+				c.Bios = qemuEfiFw
+				return c
+			},
+		},
+		{
+			"memory",
+			vmConfig{Legacy: true, Mem: 100},
+			nil,
+			func() qemu.Config {
+				c := genQEMUConfig()
+				c.Memory.Size = "100M"
+				return c
+			},
+		},
+		{
+			"cpus",
+			vmConfig{Legacy: true, Cpus: 4},
+			nil,
+			func() qemu.Config {
+				c := genQEMUConfig()
+				c.SMP.CPUs = 4
+				return c
+			},
+		},
+		{
+			"network",
+			vmConfig{Legacy: true},
+			[]qemu.Device{userNet},
+			func() qemu.Config {
+				c := genQEMUConfig()
+				c.Devices = append(c.Devices, userNet)
+				return c
+			},
+		},
+		{
+			"volume",
+			vmConfig{
+				Legacy:  true,
+				Volumes: []volumeConfig{{UUID: testutil.VolumeUUID}},
+			},
+			nil,
+			func() qemu.Config { return genQEMUConfig(volume) },
+		},
+		{
+			"incoming",
+			vmConfig{Legacy: true, incoming: "tcp:0:4444"},
+			nil,
+			func() qemu.Config {
+				c := genQEMUConfig()
+				c.Incoming.URI = "tcp:0:4444"
+				return c
+			},
+		},
 	}
 
-	params = genQEMUParams(nil)
-	cfg.Mem = 100
-	cfg.Cpus = 0
-	cfg.Legacy = true
-	params = append(params, "-m", "100")
-	genParams = generateQEMULaunchParams(&cfg, "/var/lib/ciao/instance/1/seed.iso",
-		"/var/lib/ciao/instance/1", nil, "ciao")
-	if !reflect.DeepEqual(params, genParams) {
-		t.Fatalf("%s and %s do not match", params, genParams)
+	for _, tt := range tests {
+		tt.cfg.Image = "some_image"
+		config := generateQEMUConfig(&tt.cfg, "/var/lib/ciao/instance/1/seed.iso",
+			"/var/lib/ciao/instance/1", tt.netDevices, "ciao")
+		expected := tt.expected()
+		if !reflect.DeepEqual(expected, config) {
+			t.Fatalf("%s: %+v and %+v do not match", tt.name, expected, config)
+		}
 	}
+}
+
+// Checks that the rootfs is given slot 3 of the PCI bus, or 4 when spice
+// is enabled, as qemu did when it was added with if=virtio.
+func TestGenerateQEMUConfigPCIAddr(t *testing.T) {
+	defer func(ui uiFlag) { launchWithUI = ui }(launchWithUI)
 
-	params = genQEMUParams(nil)
-	cfg.Mem = 0
-	cfg.Cpus = 4
-	cfg.Legacy = true
-	params = append(params, "-smp", "cpus=4")
-	genParams = generateQEMULaunchParams(&cfg, "/var/lib/ciao/instance/1/seed.iso",
-		"/var/lib/ciao/instance/1", nil, "ciao")
-	if !reflect.DeepEqual(params, genParams) {
-		t.Fatalf("%s and %s do not match", params, genParams)
+	tests := []struct {
+		ui       uiFlag
+		expected int
+	}{
+		{"none", 3},
+		{"nc", 3},
+		{"spice", 4},
 	}
 
-	netParams := []string{"-net", "nic,model=virtio", "-net", "user"}
-	params = genQEMUParams(netParams)
-	cfg.Mem = 0
-	cfg.Cpus = 0
-	cfg.Legacy = true
-	genParams = generateQEMULaunchParams(&cfg, "/var/lib/ciao/instance/1/seed.iso",
-		"/var/lib/ciao/instance/1", netParams, "ciao")
-	if !reflect.DeepEqual(params, genParams) {
-		t.Fatalf("%s and %s do not match", params, genParams)
+	for _, tt := range tests {
+		launchWithUI = tt.ui
+		cfg := vmConfig{Image: "some_image"}
+		config := generateQEMUConfig(&cfg, "/var/lib/ciao/instance/1/seed.iso",
+			"/var/lib/ciao/instance/1", nil, "ciao")
+		if config.FirstPCIAddr != tt.expected {
+			t.Errorf("%s: expected first PCI slot %d, got %d", tt.ui,
+				tt.expected, config.FirstPCIAddr)
+		}
 	}
 }
 
@@ -323,3 +427,48 @@ func TestQmpLost(t *testing.T) {
 		return false
 	})
 }
+
+func testQmpMigrate(t *testing.T, status string, expectErr bool) {
+	setupQmpSocket(t, func(fd net.Conn, sc *bufio.Scanner, qmpChannel chan interface{}, t *testing.T) bool {
+		responseCh := make(chan error, 1)
+		qmpChannel <- virtualizerMigrateCmd{
+			responseCh: responseCh,
+			uri:        testutil.MigrationURI,
+		}
+		if !sc.Scan() || !strings.Contains(sc.Text(), `"migrate"`) {
+			t.Fatalf("migrate command expected")
+		}
+		_, err := fmt.Fprintln(fd, `{ "return": {}}`)
+		if err != nil {
+			t.Fatalf("Unable to write to domain socket: %v", err)
+		}
+
+		if !sc.Scan() || !strings.Contains(sc.Text(), `"query-migrate"`) {
+			t.Fatalf("query-migrate command expected")
+		}
+		_, err = fmt.Fprintf(fd, "{ \"return\": { \"status\": \"%s\"}}\n", status)
+		if err != nil {
+			t.Fatalf("Unable to write to domain socket: %v", err)
+		}
+
+		select {
+		case err = <-responseCh:
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for migration response")
+		}
+		if expectErr && err == nil {
+			t.Errorf("Expected migration to fail")
+		} else if !expectErr && err != nil {
+			t.Errorf("Unexpected migration error: %v", err)
+		}
+		return true
+	})
+}
+
+func TestQmpMigrate(t *testing.T) {
+	testQmpMigrate(t, "completed", false)
+}
+
+func TestQmpMigrateFailed(t *testing.T) {
+	testQmpMigrate(t, "failed", true)
+}
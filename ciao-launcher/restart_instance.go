@@ -46,3 +46,42 @@ func processRestart(instanceDir string, vm virtualizer, conn serverConn, cfg *vm
 
 	return nil
 }
+
+// processResize applies the new sizes contained in a RESTART command to a
+// stopped instance and saves them in the instance's state.  Sizes that are
+// zero or that match the current configuration are ignored.  Disks are never
+// shrunk.
+func processResize(vm virtualizer, cfg *vmConfig, instance, instanceDir string,
+	size instanceSize) *restartError {
+
+	old := instanceSize{cpus: cfg.Cpus, mem: cfg.Mem, disk: cfg.Disk}
+	if size.cpus != 0 {
+		cfg.Cpus = size.cpus
+	}
+	if size.mem != 0 {
+		cfg.Mem = size.mem
+	}
+	if size.disk > cfg.Disk {
+		cfg.Disk = size.disk
+	}
+
+	if cfg.Cpus == old.cpus && cfg.Mem == old.mem && cfg.Disk == old.disk {
+		return nil
+	}
+
+	glog.Infof("Resizing instance %s from %+v to %+v", instance, old,
+		instanceSize{cfg.Cpus, cfg.Mem, cfg.Disk})
+
+	err := vm.resize()
+	if err == nil {
+		err = cfg.save(instanceDir)
+	}
+
+	if err != nil {
+		cfg.Cpus, cfg.Mem, cfg.Disk = old.cpus, old.mem, old.disk
+		glog.Errorf("Unable to resize instance %s: %v", instance, err)
+		return &restartError{err, payloads.RestartResizeFailure}
+	}
+
+	return nil
+}
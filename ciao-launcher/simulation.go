@@ -17,6 +17,8 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"sync"
 	"time"
@@ -27,6 +29,7 @@ import (
 type simulation struct {
 	uuid        string
 	instanceDir string
+	cfg         *vmConfig
 
 	closedCh    chan struct{}
 	connectedCh chan struct{}
@@ -34,15 +37,18 @@ type simulation struct {
 	monitorCh   chan interface{}
 	wg          *sync.WaitGroup
 
-	cpus int
-	mem  int
-	disk int
+	cpus   int
+	mem    int
+	disk   int
+	limits resourceLimits
 }
 
 func (s *simulation) init(cfg *vmConfig, instanceDir string) {
 	s.cpus = cfg.Cpus
 	s.mem = cfg.Mem
 	s.disk = cfg.Disk
+	s.uuid = cfg.Instance
+	s.cfg = cfg
 	s.instanceDir = instanceDir
 }
 
@@ -58,10 +64,26 @@ func (s *simulation) createImage(bridge string, userData, metaData []byte) error
 	return nil
 }
 
+func (s *simulation) resize() error {
+	glog.Infof("simulation: resize %d %d %d\n", s.cfg.Cpus, s.cfg.Mem, s.cfg.Disk)
+	s.cpus = s.cfg.Cpus
+	s.mem = s.cfg.Mem
+	s.disk = s.cfg.Disk
+	return nil
+}
+
 func (s *simulation) deleteImage() error {
 	return nil
 }
 
+func (s *simulation) snapshot(target string) error {
+	return ioutil.WriteFile(target, nil, 0644)
+}
+
+func (s *simulation) consoleLog(lines int) (string, error) {
+	return fmt.Sprintf("Simulated console of instance %s\n", s.uuid), nil
+}
+
 func fakeVM(s *simulation) {
 	glog.Infof("fakeVM started")
 	source := rand.NewSource(time.Now().UnixNano())
@@ -83,6 +105,12 @@ VM:
 			if _, stopCmd := cmd.(virtualizerStopCmd); stopCmd {
 				break VM
 			}
+			if migrateCmd, ok := cmd.(virtualizerMigrateCmd); ok {
+				migrateCmd.responseCh <- nil
+			}
+			if snapshotCmd, ok := cmd.(virtualizerSnapshotCmd); ok {
+				snapshotCmd.responseCh <- s.snapshot(snapshotCmd.target)
+			}
 		case <-s.killCh:
 			break VM
 		case <-ticker.C:
@@ -130,3 +158,9 @@ func (s *simulation) connected() {
 func (s *simulation) lostVM() {
 	glog.Infof("simulation: lostVM\n")
 }
+
+func (s *simulation) setLimits(limits resourceLimits) error {
+	glog.Infof("simulation: setLimits %+v\n", limits)
+	s.limits = limits
+	return nil
+}
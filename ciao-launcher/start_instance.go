@@ -45,6 +45,12 @@ func ensureBackingImage(vm virtualizer) error {
 			glog.Errorf("Unable to download backing image: %v", err)
 			return err
 		}
+
+		err = vm.checkBackingImage()
+		if err != nil {
+			glog.Errorf("Downloaded backing image check failed: %v", err)
+			return err
+		}
 	} else if err != nil {
 		glog.Errorf("Backing image check failed")
 		return err
@@ -122,6 +128,11 @@ func processStart(cmd *insStartCmd, instanceDir string, vm virtualizer, conn ser
 
 	if cfg.Image != "" {
 		err = ensureBackingImage(vm)
+
+		// The image token is only needed to fetch the backing image
+		// and is not kept around for the lifetime of the instance.
+		cfg.token = ""
+
 		if err != nil {
 			return nil, &startError{err, payloads.ImageFailure}
 		}
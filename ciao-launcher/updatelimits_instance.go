@@ -0,0 +1,56 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/01org/ciao/payloads"
+	"github.com/golang/glog"
+)
+
+// processUpdateLimits applies limits to the instance, if it is running, and
+// saves them in the instance's state.  The limits of instances that are not
+// running are applied when they are next started.
+func processUpdateLimits(vm virtualizer, cfg *vmConfig, instance, instanceDir string,
+	limits resourceLimits, running bool) *updateLimitsError {
+
+	if running {
+		err := vm.setLimits(limits)
+		if err != nil {
+			limitsErr := &updateLimitsError{err, payloads.UpdateLimitsApplyFailure}
+			glog.Errorf("Unable to apply limits to instance %s [%s]: %v",
+				instance, string(limitsErr.code), err)
+			return limitsErr
+		}
+	}
+
+	oldLimits := cfg.Limits
+	cfg.Limits = limits
+
+	err := cfg.save(instanceDir)
+	if err != nil {
+		cfg.Limits = oldLimits
+		if running {
+			_ = vm.setLimits(oldLimits)
+		}
+		limitsErr := &updateLimitsError{err, payloads.UpdateLimitsStateFailure}
+		glog.Errorf("Unable to persist instance %s state [%s]: %v",
+			instance, string(limitsErr.code), err)
+		return limitsErr
+	}
+
+	return nil
+}
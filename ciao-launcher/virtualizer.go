@@ -31,11 +31,18 @@ type virtualizerDetachCmd struct {
 	responseCh chan error
 	volumeUUID string
 }
+type virtualizerMigrateCmd struct {
+	responseCh chan error
+	uri        string
+}
+type virtualizerSnapshotCmd struct {
+	responseCh chan error
+	target     string
+}
 
 var errImageNotFound = errors.New("Image Not Found")
 
 //BUG(markus): These methods need to be cancellable
-//BUG(markus): How do we deal with locally cached images getting stale?
 
 // The virtualizer interface is designed to isolate launcher, and in particular,
 // functions that run in the instance go routine, from the underlying virtualisation
@@ -72,6 +79,23 @@ type virtualizer interface {
 	// deleted by the instance go routine.
 	deleteImage() error
 
+	// Creates a snapshot of the rootfs of a stopped instance and stores it in
+	// the file target.  Snapshots of running instances are taken by sending a
+	// virtualizerSnapshotCmd down the channel returned by monitorVM instead.
+	snapshot(target string) error
+
+	// Returns the last lines of the console log of the instance, or the whole
+	// log if lines is 0.  The log outlives the VM or container so this method
+	// can be called whether the instance is running or not.  errNoConsoleLog
+	// is returned if the instance has no log yet.
+	consoleLog(lines int) (string, error)
+
+	// Applies the Cpus, Mem and Disk values of the vmConfig passed to init to a
+	// stopped instance.  It is called before startVM when a RESTART command
+	// changes the size of an instance.  Disk is never smaller than the current
+	// size of the instance's rootfs.
+	resize() error
+
 	// Boots a VM.  This method is called by both START and RESTART.
 	startVM(vnicName, ipAddress, cephID string) error
 
@@ -129,4 +153,10 @@ type virtualizer interface {
 	// The instance go routine then calls lostVM so that the virtualizer can update
 	// its internal state.
 	lostVM()
+
+	// Applies resource limits to a running VM or container.  It is called by the
+	// instance go routine when the instance is first detected to be running and
+	// whenever an UpdateLimits command is received for a running instance.
+	// Limits that are not set, i.e., zero, are removed.
+	setLimits(limits resourceLimits) error
 }
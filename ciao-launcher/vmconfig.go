@@ -21,6 +21,7 @@ import (
 	"os"
 	"path"
 
+	"github.com/01org/ciao/payloads"
 	"github.com/golang/glog"
 )
 
@@ -47,6 +48,21 @@ type vmConfig struct {
 	VnicUUID    string
 	SSHPort     int
 	Volumes     []volumeConfig
+	BestEffort  []payloads.Resource
+	Limits      resourceLimits
+
+	// incoming is the URI on which a newly created instance waits for
+	// an incoming migration.  It is deliberately not exported so that it
+	// is not saved with the rest of the instance's state.  Once the
+	// instance has been migrated it is booted normally on RESTART.
+	incoming string
+
+	// imageServiceURL and token are used to download the backing image
+	// if it is not present on the node.  Like incoming, they are not
+	// saved with the rest of the instance's state as they are only
+	// needed, and only valid, when the instance is created.
+	imageServiceURL string
+	token           string
 }
 
 func loadVMConfig(instanceDir string) (*vmConfig, error) {
@@ -88,6 +104,16 @@ func (cfg *vmConfig) save(instanceDir string) error {
 	return cfgFile.Close()
 }
 
+// mandatory returns false if the resource was requested on a best effort basis
+func (cfg *vmConfig) mandatory(resource payloads.Resource) bool {
+	for _, r := range cfg.BestEffort {
+		if r == resource {
+			return false
+		}
+	}
+	return true
+}
+
 func (cfg *vmConfig) findVolume(UUID string) *volumeConfig {
 	for i := range cfg.Volumes {
 		if cfg.Volumes[i].UUID == UUID {
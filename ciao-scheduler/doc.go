@@ -134,9 +134,37 @@ any changes in their node statistics.
 
 Fairness
 
-Ciao-scheduler currently implements an extremely trivial algorithm to
+By default ciao-scheduler implements an extremely trivial algorithm to
 prefer not using the most-recently-used compute node.  This is inexpensive
 and leads to sufficient spread of new workloads across a cluster.
 
+Scheduling Policies
+
+The compute node placement strategy can be selected through the
+"policy" entry of the scheduler section of the cluster configuration.
+Every policy only considers nodes that have enough memory, disk and
+CPUs for the workload.  The vCPUs of the workloads sent to a node are
+deducted from its online CPUs until the node reports its resources
+again in its next READY status.  The supported policies are:
+
+  round_robin   the default, first fit after the most recently used node
+  bin_pack      the node left with the least free memory, disk and CPUs
+  spread        the node left with the most free memory, disk and CPUs
+  least_loaded  the node with the lowest load per online CPU
+
+All but round_robin visit every compute node, trading a little dispatch
+latency for a better fit.  The policy is updated when the controller sends
+a new configuration through the CONFIGURE command.
+
+Controller Failover
+
+Several ciao-controller instances may connect to the scheduler.  The
+first one becomes the master, the other ones are kept as backups.  Only
+the master may send commands, and node statistics, events and failures
+are forwarded to the master alone.  When the master disconnects, the
+first backup is promoted and sent a ControllerPromoted event carrying
+the latest STATS of every node, against which the new master reconciles
+its datastore.
+
 */
 package main
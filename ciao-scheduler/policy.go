@@ -0,0 +1,214 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/01org/ciao/payloads"
+)
+
+// schedulingPolicy chooses a compute node for a workload.  Implementations
+// are called with sched.cnMutex read locked and must return either nil or a
+// locked nodeStat which fits the workload.
+type schedulingPolicy interface {
+	pickComputeNode(sched *ssntpSchedulerServer, workload *workResources) *nodeStat
+	name() payloads.SchedulingPolicy
+}
+
+func newSchedulingPolicy(policy payloads.SchedulingPolicy) (schedulingPolicy, error) {
+	switch policy {
+	case "", payloads.RoundRobin:
+		return &roundRobinPolicy{}, nil
+	case payloads.BinPack:
+		return &scoringPolicy{policy: payloads.BinPack, score: binPackScore}, nil
+	case payloads.Spread:
+		return &scoringPolicy{policy: payloads.Spread, score: spreadScore}, nil
+	case payloads.LeastLoaded:
+		return &scoringPolicy{policy: payloads.LeastLoaded, score: leastLoadedScore}, nil
+	}
+
+	return nil, fmt.Errorf("unknown scheduling policy \"%s\"", string(policy))
+}
+
+// roundRobinPolicy picks the first node that fits, preferring the nodes
+// holding the workload image and not to use the most recently used
+// compute node.
+type roundRobinPolicy struct{}
+
+func (p *roundRobinPolicy) name() payloads.SchedulingPolicy {
+	return payloads.RoundRobin
+}
+
+func (p *roundRobinPolicy) pickComputeNode(sched *ssntpSchedulerServer, workload *workResources) *nodeStat {
+	/* First try the nodes holding the workload image */
+	if workload.image != "" {
+		node := p.pick(sched, workload, true)
+		if node != nil {
+			return node // locked nodeStat
+		}
+	}
+
+	return p.pick(sched, workload, false)
+}
+
+// pick returns the first node that fits in round robin order.  When
+// withImage is set, only the nodes holding the workload image are
+// considered and the MRU is always skipped, so that workloads created
+// from the same image are still spread over the nodes holding it.
+func (p *roundRobinPolicy) pick(sched *ssntpSchedulerServer, workload *workResources, withImage bool) *nodeStat {
+	fits := func(node *nodeStat) bool {
+		if withImage && !node.hasImage(workload.image) {
+			return false
+		}
+		return sched.workloadFits(node, workload)
+	}
+
+	/* First try nodes after the MRU */
+	if sched.cnMRUIndex != -1 && sched.cnMRUIndex < len(sched.cnList)-1 {
+		for i, node := range sched.cnList[sched.cnMRUIndex+1:] {
+			node.mutex.Lock()
+			if node == sched.cnMRU {
+				node.mutex.Unlock()
+				continue
+			}
+
+			if fits(node) == true {
+				sched.cnMRUIndex = sched.cnMRUIndex + 1 + i
+				sched.cnMRU = node
+				return node // locked nodeStat
+			}
+			node.mutex.Unlock()
+		}
+	}
+
+	/* Then try the whole list, including the MRU */
+	for i, node := range sched.cnList {
+		if withImage && node == sched.cnMRU {
+			continue
+		}
+
+		node.mutex.Lock()
+		if fits(node) == true {
+			sched.cnMRUIndex = i
+			sched.cnMRU = node
+			return node // locked nodeStat
+		}
+		node.mutex.Unlock()
+	}
+
+	return nil
+}
+
+// scoringPolicy visits every compute node and picks the fitting node with
+// the highest score.  Ties go to the nodes holding the workload image, then
+// to the node found first in the list.
+type scoringPolicy struct {
+	policy payloads.SchedulingPolicy
+
+	// score rates a locked node known to fit the workload.
+	score func(node *nodeStat, workload *workResources) float64
+}
+
+func (p *scoringPolicy) name() payloads.SchedulingPolicy {
+	return p.policy
+}
+
+func (p *scoringPolicy) pickComputeNode(sched *ssntpSchedulerServer, workload *workResources) *nodeStat {
+	var best *nodeStat
+	var bestIndex int
+	var bestScore float64
+	var bestHasImage bool
+
+	for i, node := range sched.cnList {
+		node.mutex.Lock()
+		if sched.workloadFits(node, workload) == false {
+			node.mutex.Unlock()
+			continue
+		}
+
+		score := p.score(node, workload)
+		hasImage := node.hasImage(workload.image)
+		if best == nil || score > bestScore ||
+			(score == bestScore && hasImage && !bestHasImage) {
+			if best != nil {
+				best.mutex.Unlock()
+			}
+			best = node
+			bestIndex = i
+			bestScore = score
+			bestHasImage = hasImage
+			continue // keep best locked
+		}
+		node.mutex.Unlock()
+	}
+
+	if best != nil {
+		sched.cnMRUIndex = bestIndex
+		sched.cnMRU = best
+	}
+
+	return best // locked nodeStat, if any
+}
+
+// freeRatio returns the fraction of a node's resources which would remain
+// available after starting the workload.  Memory is always accounted for,
+// disk and CPUs only when the node reports them.
+func freeRatio(node *nodeStat, workload *workResources) float64 {
+	var ratio float64
+	resources := 0
+
+	if node.memTotalMB > 0 {
+		ratio += float64(node.memAvailMB-workload.memReqMB) / float64(node.memTotalMB)
+		resources++
+	}
+
+	if node.diskTotalMB > 0 {
+		ratio += float64(node.diskAvailMB-workload.diskReqMB) / float64(node.diskTotalMB)
+		resources++
+	}
+
+	if node.cpus > 0 {
+		ratio += float64(node.cpusAvail-workload.vcpusReq) / float64(node.cpus)
+		resources++
+	}
+
+	if resources == 0 {
+		return 0
+	}
+
+	return ratio / float64(resources)
+}
+
+func binPackScore(node *nodeStat, workload *workResources) float64 {
+	return -freeRatio(node, workload)
+}
+
+func spreadScore(node *nodeStat, workload *workResources) float64 {
+	return freeRatio(node, workload)
+}
+
+func leastLoadedScore(node *nodeStat, workload *workResources) float64 {
+	cpus := node.cpus
+	if cpus <= 0 {
+		cpus = 1
+	}
+
+	// the load is the primary criteria, free resources only break ties
+	// between equally loaded nodes.
+	return -float64(node.load)/float64(cpus) + freeRatio(node, workload)/1000
+}
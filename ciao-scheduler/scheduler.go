@@ -27,6 +27,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/01org/ciao/configuration"
 	"github.com/01org/ciao/osprepare"
 	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp"
@@ -64,6 +65,7 @@ type ssntpSchedulerServer struct {
 	cnMutex    sync.RWMutex // Rlock traversing map, Lock modifying map
 	cnMRU      *nodeStat
 	cnMRUIndex int
+	cnPolicy   schedulingPolicy // protected by cnMutex
 	//cnInactiveMap      map[string]nodeStat
 
 	// Network Nodes
@@ -77,18 +79,29 @@ func newSsntpSchedulerServer() *ssntpSchedulerServer {
 		controllerMap: make(map[string]*controllerStat),
 		cnMap:         make(map[string]*nodeStat),
 		cnMRUIndex:    -1,
+		cnPolicy:      &roundRobinPolicy{},
 		nnMap:         make(map[string]*nodeStat),
 	}
 }
 
 type nodeStat struct {
-	mutex      sync.Mutex
-	status     ssntp.Status
-	uuid       string
-	memTotalMB int
-	memAvailMB int
-	load       int
-	cpus       int
+	mutex       sync.Mutex
+	status      ssntp.Status
+	uuid        string
+	memTotalMB  int
+	memAvailMB  int
+	diskTotalMB int
+	diskAvailMB int
+	load        int
+	cpus        int
+	cpusAvail   int
+	images      map[string]bool // images present on the node
+	stats       []byte          // latest STATS payload, handed over on failover
+}
+
+// Returns true if the referenced, locked nodeStat object holds image
+func (node *nodeStat) hasImage(image string) bool {
+	return image != "" && node.images[image]
 }
 
 type controllerStatus uint8
@@ -198,6 +211,24 @@ func connectController(sched *ssntpSchedulerServer, uuid string) {
 // Undo previous state additions for departed Controller
 // This function is symmetric with connectController().
 func disconnectController(sched *ssntpSchedulerServer, uuid string) {
+	promoted := removeController(sched, uuid)
+	if promoted == "" {
+		return
+	}
+
+	glog.Infof("Controller %s promoted to master\n", promoted)
+
+	// The controller lock is not held here, gathering the node
+	// statistics needs the compute and network node locks.
+	err := sched.sendControllerPromotedEvent(promoted)
+	if err != nil {
+		glog.Warningf("Unable to inform controller %s it is master: %v\n", promoted, err)
+	}
+}
+
+// Remove a departed Controller, promoting a backup one if the master
+// went away.  The promoted Controller's UUID is returned, if any.
+func removeController(sched *ssntpSchedulerServer, uuid string) (promoted string) {
 	sched.controllerMutex.Lock()
 	defer sched.controllerMutex.Unlock()
 
@@ -225,7 +256,7 @@ func disconnectController(sched *ssntpSchedulerServer, uuid string) {
 		c.mutex.Lock()
 		if c.status == controllerBackup {
 			c.status = controllerMaster
-			//TODO: inform the Controller it is master
+			promoted = c.uuid
 			c.mutex.Unlock()
 
 			// move to front of list
@@ -237,6 +268,59 @@ func disconnectController(sched *ssntpSchedulerServer, uuid string) {
 		}
 		c.mutex.Unlock()
 	}
+
+	return
+}
+
+// Build the ControllerPromoted event payload from the latest STATS
+// reported by each compute and network node.
+func (sched *ssntpSchedulerServer) controllerPromotedPayload(controllerUUID string) payloads.EventControllerPromoted {
+	var event payloads.EventControllerPromoted
+	event.ControllerPromoted.ControllerUUID = controllerUUID
+
+	addStats := func(node *nodeStat) {
+		node.mutex.Lock()
+		defer node.mutex.Unlock()
+
+		if node.stats == nil {
+			return
+		}
+
+		var stat payloads.Stat
+		stat.Init()
+		err := yaml.Unmarshal(node.stats, &stat)
+		if err != nil {
+			glog.Errorf("Bad cached STATS yaml for node %s\n", node.uuid)
+			return
+		}
+		event.ControllerPromoted.NodeStats = append(event.ControllerPromoted.NodeStats, stat)
+	}
+
+	sched.cnMutex.RLock()
+	for _, node := range sched.cnList {
+		addStats(node)
+	}
+	sched.cnMutex.RUnlock()
+
+	sched.nnMutex.RLock()
+	for _, node := range sched.nnMap {
+		addStats(node)
+	}
+	sched.nnMutex.RUnlock()
+
+	return event
+}
+
+func (sched *ssntpSchedulerServer) sendControllerPromotedEvent(controllerUUID string) error {
+	payload := sched.controllerPromotedPayload(controllerUUID)
+
+	b, err := yaml.Marshal(&payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = sched.ssntp.SendEvent(controllerUUID, ssntp.ControllerPromoted, b)
+	return err
 }
 
 // Add state for newly connected Compute Node
@@ -371,9 +455,15 @@ func (sched *ssntpSchedulerServer) updateNodeStat(node *nodeStat, status ssntp.S
 		}
 		node.memTotalMB = stats.MemTotalMB
 		node.memAvailMB = stats.MemAvailableMB
+		node.diskTotalMB = stats.DiskTotalMB
+		node.diskAvailMB = stats.DiskAvailableMB
 		node.load = stats.Load
 		node.cpus = stats.CpusOnline
-		//TODO pull in other types of payloads.Ready struct data
+		node.cpusAvail = stats.CpusOnline
+		node.images = make(map[string]bool)
+		for _, image := range stats.Images {
+			node.images[image] = true
+		}
 	}
 }
 
@@ -411,30 +501,70 @@ func (sched *ssntpSchedulerServer) StatusNotify(uuid string, status ssntp.Status
 
 type workResources struct {
 	instanceUUID string
+	vcpusReq     int
 	memReqMB     int
+	diskReqMB    int
 	networkNode  int
+
+	// image is the qemu image UUID or the docker image name the
+	// workload is created from.  Nodes already holding it are preferred.
+	image string
+
+	// mandatory resources must be satisfied by the chosen node, the
+	// other ones are only granted on a best effort basis.
+	mandatory map[payloads.Resource]bool
+
+	// bestEffort is set once no node could satisfy every resource
+	// demand, including the optional ones.
+	bestEffort bool
+}
+
+// Returns true if the workload resource demand must be met by the chosen node
+func (workload *workResources) enforced(resource payloads.Resource) bool {
+	return workload.mandatory[resource] || !workload.bestEffort
+}
+
+// Returns true if some of the workload resource demands are optional
+func (workload *workResources) hasOptional() bool {
+	for _, resource := range scheduledResources {
+		if !workload.mandatory[resource] {
+			return true
+		}
+	}
+	return false
 }
 
 func (sched *ssntpSchedulerServer) getWorkloadResources(work *payloads.Start) (workload workResources, err error) {
+	workload.mandatory = make(map[payloads.Resource]bool)
+
 	// loop the array to find resources
 	for idx := range work.Start.RequestedResources {
-		// memory:
-		if work.Start.RequestedResources[idx].Type == payloads.MemMB {
-			workload.memReqMB = work.Start.RequestedResources[idx].Value
+		if work.Start.RequestedResources[idx].Mandatory {
+			workload.mandatory[work.Start.RequestedResources[idx].Type] = true
 		}
 
-		// network node
-		if work.Start.RequestedResources[idx].Type == payloads.NetworkNode {
+		switch work.Start.RequestedResources[idx].Type {
+		case payloads.VCPUs:
+			workload.vcpusReq = work.Start.RequestedResources[idx].Value
+		case payloads.MemMB:
+			workload.memReqMB = work.Start.RequestedResources[idx].Value
+		case payloads.DiskMB:
+			workload.diskReqMB = work.Start.RequestedResources[idx].Value
+		case payloads.NetworkNode:
 			workload.networkNode = work.Start.RequestedResources[idx].Value
 		}
-
-		// etc...
 	}
 
 	// validate the found resources
 	if workload.memReqMB <= 0 {
 		return workload, fmt.Errorf("invalid start payload resource demand: mem_mb (%d) <= 0, must be > 0", workload.memReqMB)
 	}
+	if workload.vcpusReq < 0 {
+		return workload, fmt.Errorf("invalid start payload resource demand: vcpus (%d) < 0", workload.vcpusReq)
+	}
+	if workload.diskReqMB < 0 {
+		return workload, fmt.Errorf("invalid start payload resource demand: disk_mb (%d) < 0", workload.diskReqMB)
+	}
 	if workload.networkNode != 0 && workload.networkNode != 1 {
 		return workload, fmt.Errorf("invalid start payload resource demand: network_node (%d) is not 0 or 1", workload.networkNode)
 	}
@@ -442,17 +572,78 @@ func (sched *ssntpSchedulerServer) getWorkloadResources(work *payloads.Start) (w
 	// note the uuid
 	workload.instanceUUID = work.Start.InstanceUUID
 
+	if work.Start.VMType == payloads.Docker {
+		workload.image = work.Start.DockerImage
+	} else {
+		workload.image = work.Start.ImageUUID
+	}
+
 	return workload, nil
 }
 
+// Check a single resource demand is satisfiable by the referenced, locked nodeStat object.
+// Disk and CPU demands are only checked against nodes which reported them.
+func resourceFits(node *nodeStat, workload *workResources, resource payloads.Resource) bool {
+	switch resource {
+	case payloads.VCPUs:
+		return node.cpus <= 0 || node.cpusAvail >= workload.vcpusReq
+	case payloads.MemMB:
+		return node.memAvailMB >= workload.memReqMB
+	case payloads.DiskMB:
+		return node.diskTotalMB <= 0 || node.diskAvailMB >= workload.diskReqMB
+	}
+
+	return true
+}
+
+var scheduledResources = []payloads.Resource{payloads.VCPUs, payloads.MemMB, payloads.DiskMB}
+
 // Check resource demands are satisfiable by the referenced, locked nodeStat object
 func (sched *ssntpSchedulerServer) workloadFits(node *nodeStat, workload *workResources) bool {
-	// simple scheduling policy == first memory fit
-	if node.memAvailMB >= workload.memReqMB &&
-		node.status == ssntp.READY {
-		return true
+	if node.status != ssntp.READY {
+		return false
 	}
-	return false
+
+	for _, resource := range scheduledResources {
+		if workload.enforced(resource) && !resourceFits(node, workload, resource) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Find out why no node in the list could take the workload.  A mandatory
+// resource demand that no READY node can satisfy on its own is reported as
+// such, otherwise the nodes are full for mixed reasons.
+func (sched *ssntpSchedulerServer) startFailureReason(nodes []*nodeStat, workload *workResources) payloads.StartFailureReason {
+	reasons := map[payloads.Resource]payloads.StartFailureReason{
+		payloads.VCPUs:  payloads.NotEnoughVCPUs,
+		payloads.MemMB:  payloads.NotEnoughMemory,
+		payloads.DiskMB: payloads.NotEnoughDisk,
+	}
+
+	for _, resource := range scheduledResources {
+		if !workload.mandatory[resource] {
+			continue
+		}
+
+		satisfied := false
+		for _, node := range nodes {
+			node.mutex.Lock()
+			satisfied = node.status == ssntp.READY && resourceFits(node, workload, resource)
+			node.mutex.Unlock()
+			if satisfied {
+				break
+			}
+		}
+
+		if !satisfied {
+			return reasons[resource]
+		}
+	}
+
+	return payloads.FullCloud
 }
 
 func (sched *ssntpSchedulerServer) sendStartFailureError(clientUUID string, instanceUUID string, reason payloads.StartFailureReason) {
@@ -502,6 +693,37 @@ func (sched *ssntpSchedulerServer) fwdEventToCNCI(event ssntp.Event, payload []b
 	return dest
 }
 
+func (sched *ssntpSchedulerServer) getCommandConcentratorUUID(command ssntp.Command, payload []byte) (string, string, error) {
+	switch command {
+	default:
+		return "", "", fmt.Errorf("unsupported ssntp.Command type \"%s\"", command)
+	case ssntp.AssignPublicIP:
+		var cmd payloads.CommandAssignPublicIP
+		err := yaml.Unmarshal(payload, &cmd)
+		return cmd.AssignIP.InstanceUUID, cmd.AssignIP.ConcentratorUUID, err
+	case ssntp.ReleasePublicIP:
+		var cmd payloads.CommandReleasePublicIP
+		err := yaml.Unmarshal(payload, &cmd)
+		return cmd.ReleaseIP.InstanceUUID, cmd.ReleaseIP.ConcentratorUUID, err
+	}
+}
+
+func (sched *ssntpSchedulerServer) fwdCmdToCNCI(command ssntp.Command, payload []byte) (dest ssntp.ForwardDestination, instanceUUID string) {
+	// some commands require no scheduling choice, rather the specified
+	// tenant CNCI needs the command instead of the scheduler
+	instanceUUID, concentratorUUID, err := sched.getCommandConcentratorUUID(command, payload)
+	if err != nil || concentratorUUID == "" {
+		glog.Errorf("Bad %s command yaml from Controller, concentratorUUID == %s\n", command, concentratorUUID)
+		dest.SetDecision(ssntp.Discard)
+		return
+	}
+
+	glog.V(2).Infof("Forwarding controller %s command to %s\n", command, concentratorUUID)
+	dest.AddRecipient(concentratorUUID)
+
+	return
+}
+
 func getWorkloadAgentUUID(sched *ssntpSchedulerServer, command ssntp.Command, payload []byte) (string, string, error) {
 	switch command {
 	default:
@@ -531,6 +753,22 @@ func getWorkloadAgentUUID(sched *ssntpSchedulerServer, command ssntp.Command, pa
 		var cmd payloads.DetachVolume
 		err := yaml.Unmarshal(payload, &cmd)
 		return cmd.Detach.InstanceUUID, cmd.Detach.WorkloadAgentUUID, err
+	case ssntp.MIGRATE:
+		var cmd payloads.Migrate
+		err := yaml.Unmarshal(payload, &cmd)
+		return cmd.Migrate.InstanceUUID, cmd.Migrate.WorkloadAgentUUID, err
+	case ssntp.CreateImage:
+		var cmd payloads.CreateImage
+		err := yaml.Unmarshal(payload, &cmd)
+		return cmd.CreateImage.InstanceUUID, cmd.CreateImage.WorkloadAgentUUID, err
+	case ssntp.GetConsole:
+		var cmd payloads.GetConsole
+		err := yaml.Unmarshal(payload, &cmd)
+		return cmd.GetConsole.InstanceUUID, cmd.GetConsole.WorkloadAgentUUID, err
+	case ssntp.UpdateLimits:
+		var cmd payloads.UpdateLimits
+		err := yaml.Unmarshal(payload, &cmd)
+		return cmd.UpdateLimits.InstanceUUID, cmd.UpdateLimits.WorkloadAgentUUID, err
 	}
 }
 
@@ -553,6 +791,22 @@ func (sched *ssntpSchedulerServer) fwdCmdToComputeNode(command ssntp.Command, pa
 // Decrement resource claims for the referenced locked nodeStat object
 func (sched *ssntpSchedulerServer) decrementResourceUsage(node *nodeStat, workload *workResources) {
 	node.memAvailMB -= workload.memReqMB
+	if node.diskTotalMB > 0 {
+		node.diskAvailMB -= workload.diskReqMB
+	}
+	if node.cpus > 0 {
+		node.cpusAvail -= workload.vcpusReq
+	}
+
+	// the node is about to fetch the workload image, if it does not hold
+	// it already, so that following workloads created from the same image
+	// are preferably sent to it too.
+	if workload.image != "" {
+		if node.images == nil {
+			node.images = make(map[string]bool)
+		}
+		node.images[workload.image] = true
+	}
 }
 
 // Find suitable compute node, returning referenced to a locked nodeStat if found
@@ -566,36 +820,18 @@ func pickComputeNode(sched *ssntpSchedulerServer, controllerUUID string, workloa
 		return nil
 	}
 
-	/* First try nodes after the MRU */
-	if sched.cnMRUIndex != -1 && sched.cnMRUIndex < len(sched.cnList)-1 {
-		for i, node := range sched.cnList[sched.cnMRUIndex+1:] {
-			node.mutex.Lock()
-			if node == sched.cnMRU {
-				node.mutex.Unlock()
-				continue
-			}
-
-			if sched.workloadFits(node, workload) == true {
-				sched.cnMRUIndex = sched.cnMRUIndex + 1 + i
-				sched.cnMRU = node
-				return node // locked nodeStat
-			}
-			node.mutex.Unlock()
-		}
+	node = sched.cnPolicy.pickComputeNode(sched, workload)
+	if node == nil && workload.hasOptional() {
+		// optional resources are granted on a best effort basis
+		workload.bestEffort = true
+		node = sched.cnPolicy.pickComputeNode(sched, workload)
 	}
-
-	/* Then try the whole list, including the MRU */
-	for i, node := range sched.cnList {
-		node.mutex.Lock()
-		if sched.workloadFits(node, workload) == true {
-			sched.cnMRUIndex = i
-			sched.cnMRU = node
-			return node // locked nodeStat
-		}
-		node.mutex.Unlock()
+	if node != nil {
+		return node // locked nodeStat
 	}
 
-	sched.sendStartFailureError(controllerUUID, workload.instanceUUID, payloads.FullCloud)
+	reason := sched.startFailureReason(sched.cnList, workload)
+	sched.sendStartFailureError(controllerUUID, workload.instanceUUID, reason)
 	return nil
 }
 
@@ -618,6 +854,7 @@ func (sched *ssntpSchedulerServer) pickNetworkNode(controllerUUID string, worklo
 			sched.nnMRU = node.uuid
 			return node // locked nodeStat
 		}
+		node.mutex.Unlock()
 	}
 
 	sched.sendStartFailureError(controllerUUID, workload.instanceUUID, payloads.NoNetworkNodes)
@@ -668,10 +905,40 @@ func startWorkload(sched *ssntpSchedulerServer, controllerUUID string, payload [
 	return dest, instanceUUID
 }
 
+// Forward a frame to the master Controller only, so that backup
+// Controllers do not act upon node reports.
+func (sched *ssntpSchedulerServer) fwdFrameToMasterController() (dest ssntp.ForwardDestination) {
+	sched.controllerMutex.RLock()
+	defer sched.controllerMutex.RUnlock()
+
+	if len(sched.controllerList) == 0 {
+		dest.SetDecision(ssntp.Discard)
+		return
+	}
+
+	controller := sched.controllerList[0]
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	if controller.status != controllerMaster {
+		dest.SetDecision(ssntp.Discard)
+		return
+	}
+
+	dest.AddRecipient(controller.uuid)
+
+	return dest
+}
+
 func (sched *ssntpSchedulerServer) CommandForward(controllerUUID string, command ssntp.Command, frame *ssntp.Frame) (dest ssntp.ForwardDestination) {
 	payload := frame.Payload
 	instanceUUID := ""
 
+	// STATS come from the nodes and are reported to the Controller
+	if command == ssntp.STATS {
+		return sched.fwdFrameToMasterController()
+	}
+
 	sched.controllerMutex.RLock()
 	defer sched.controllerMutex.RUnlock()
 	if sched.controllerMap[controllerUUID] == nil {
@@ -707,8 +974,20 @@ func (sched *ssntpSchedulerServer) CommandForward(controllerUUID string, command
 		fallthrough
 	case ssntp.DetachVolume:
 		fallthrough
+	case ssntp.MIGRATE:
+		fallthrough
+	case ssntp.CreateImage:
+		fallthrough
+	case ssntp.GetConsole:
+		fallthrough
+	case ssntp.UpdateLimits:
+		fallthrough
 	case ssntp.EVACUATE:
 		dest, instanceUUID = sched.fwdCmdToComputeNode(command, payload)
+	case ssntp.AssignPublicIP:
+		fallthrough
+	case ssntp.ReleasePublicIP:
+		dest, instanceUUID = sched.fwdCmdToCNCI(command, payload)
 	default:
 		dest.SetDecision(ssntp.Discard)
 	}
@@ -719,10 +998,65 @@ func (sched *ssntpSchedulerServer) CommandForward(controllerUUID string, command
 	return
 }
 
+// Switch to the scheduling policy requested by the cluster configuration.
+// An unknown policy leaves the current one in place.
+func (sched *ssntpSchedulerServer) setSchedulingPolicy(conf *payloads.Configure) {
+	policy, err := newSchedulingPolicy(conf.Configure.Scheduler.Policy)
+	if err != nil {
+		glog.Errorf("Keeping current scheduling policy: %v", err)
+		return
+	}
+
+	sched.cnMutex.Lock()
+	defer sched.cnMutex.Unlock()
+
+	if sched.cnPolicy.name() != policy.name() {
+		glog.Infof("Scheduling policy set to %s", policy.name())
+	}
+	sched.cnPolicy = policy
+}
+
 func (sched *ssntpSchedulerServer) CommandNotify(uuid string, command ssntp.Command, frame *ssntp.Frame) {
-	// Currently all commands are handled by CommandForward, the SSNTP command forwader,
-	// or directly by role defined forwarding rules.
+	// Currently all commands but CONFIGURE are handled by CommandForward,
+	// the SSNTP command forwader, or directly by role defined forwarding rules.
 	glog.V(2).Infof("COMMAND %v from %s\n", command, uuid)
+
+	if command == ssntp.CONFIGURE {
+		conf, err := configuration.Payload(frame.Payload)
+		if err != nil {
+			glog.Errorf("Bad CONFIGURE yaml from %s: %v", uuid, err)
+			return
+		}
+		sched.setSchedulingPolicy(&conf)
+	}
+
+	if command == ssntp.STATS {
+		sched.cacheNodeStats(uuid, frame.Payload)
+	}
+}
+
+// Keep the latest STATS payload from each node, for a Controller
+// being promoted to master to reconcile its state against.
+func (sched *ssntpSchedulerServer) cacheNodeStats(uuid string, payload []byte) {
+	var node *nodeStat
+
+	sched.cnMutex.RLock()
+	node = sched.cnMap[uuid]
+	sched.cnMutex.RUnlock()
+
+	if node == nil {
+		sched.nnMutex.RLock()
+		node = sched.nnMap[uuid]
+		sched.nnMutex.RUnlock()
+	}
+
+	if node == nil {
+		return
+	}
+
+	node.mutex.Lock()
+	node.stats = payload
+	node.mutex.Unlock()
 }
 
 func (sched *ssntpSchedulerServer) EventForward(uuid string, event ssntp.Event, frame *ssntp.Frame) (dest ssntp.ForwardDestination) {
@@ -735,6 +1069,18 @@ func (sched *ssntpSchedulerServer) EventForward(uuid string, event ssntp.Event,
 		fallthrough
 	case ssntp.TenantRemoved:
 		dest = sched.fwdEventToCNCI(event, payload)
+	case ssntp.TraceReport:
+		fallthrough
+	case ssntp.InstanceDeleted:
+		fallthrough
+	case ssntp.InstanceEvacuated:
+		fallthrough
+	case ssntp.ConsoleOutput:
+		fallthrough
+	case ssntp.ConcentratorInstanceAdded:
+		fallthrough
+	case ssntp.PublicIPAssigned:
+		dest = sched.fwdFrameToMasterController()
 	}
 
 	elapsed := time.Since(start)
@@ -749,6 +1095,11 @@ func (sched *ssntpSchedulerServer) EventNotify(uuid string, event ssntp.Event, f
 	glog.V(2).Infof("EVENT %v from %s\n", event, uuid)
 }
 
+func (sched *ssntpSchedulerServer) ErrorForward(uuid string, error ssntp.Error, frame *ssntp.Frame) (dest ssntp.ForwardDestination) {
+	// node failures are only reported to the master Controller
+	return sched.fwdFrameToMasterController()
+}
+
 func (sched *ssntpSchedulerServer) ErrorNotify(uuid string, error ssntp.Error, frame *ssntp.Frame) {
 	glog.V(2).Infof("ERROR %v from %s\n", error, uuid)
 }
@@ -935,41 +1286,65 @@ func toggleDebug(sched *ssntpSchedulerServer) {
 
 func setSSNTPForwardRules(sched *ssntpSchedulerServer) {
 	sched.config.ForwardRules = []ssntp.FrameForwardRule{
-		{ // all STATS commands go to all Controllers
-			Operand: ssntp.STATS,
-			Dest:    ssntp.Controller,
+		{ // all STATS commands go to the master Controller
+			Operand:        ssntp.STATS,
+			CommandForward: sched,
+		},
+		{ // all TraceReport events go to the master Controller
+			Operand:      ssntp.TraceReport,
+			EventForward: sched,
+		},
+		{ // all InstanceDeleted events go to the master Controller
+			Operand:      ssntp.InstanceDeleted,
+			EventForward: sched,
+		},
+		{ // all InstanceEvacuated events go to the master Controller
+			Operand:      ssntp.InstanceEvacuated,
+			EventForward: sched,
+		},
+		{ // all ConsoleOutput events go to the master Controller
+			Operand:      ssntp.ConsoleOutput,
+			EventForward: sched,
+		},
+		{ // all ConcentratorInstanceAdded events go to the master Controller
+			Operand:      ssntp.ConcentratorInstanceAdded,
+			EventForward: sched,
 		},
-		{ // all TraceReport events go to all Controllers
-			Operand: ssntp.TraceReport,
-			Dest:    ssntp.Controller,
+		{ // all StartFailure events go to the master Controller
+			Operand:      ssntp.StartFailure,
+			ErrorForward: sched,
 		},
-		{ // all InstanceDeleted events go to all Controllers
-			Operand: ssntp.InstanceDeleted,
-			Dest:    ssntp.Controller,
+		{ // all StopFailure events go to the master Controller
+			Operand:      ssntp.StopFailure,
+			ErrorForward: sched,
 		},
-		{ // all ConcentratorInstanceAdded events go to all Controllers
-			Operand: ssntp.ConcentratorInstanceAdded,
-			Dest:    ssntp.Controller,
+		{ // all RestartFailure events go to the master Controller
+			Operand:      ssntp.RestartFailure,
+			ErrorForward: sched,
 		},
-		{ // all StartFailure events go to all Controllers
-			Operand: ssntp.StartFailure,
-			Dest:    ssntp.Controller,
+		{ // all DeleteFailure events go to the master Controller
+			Operand:      ssntp.DeleteFailure,
+			ErrorForward: sched,
 		},
-		{ // all StopFailure events go to all Controllers
-			Operand: ssntp.StopFailure,
-			Dest:    ssntp.Controller,
+		{ // all MigrateFailure events go to the master Controller
+			Operand:      ssntp.MigrateFailure,
+			ErrorForward: sched,
 		},
-		{ // all RestartFailure events go to all Controllers
-			Operand: ssntp.RestartFailure,
-			Dest:    ssntp.Controller,
+		{ // all CreateImageFailure events go to the master Controller
+			Operand:      ssntp.CreateImageFailure,
+			ErrorForward: sched,
 		},
-		{ // all DeleteFailure events go to all Controllers
-			Operand: ssntp.DeleteFailure,
-			Dest:    ssntp.Controller,
+		{ // all GetConsoleFailure events go to the master Controller
+			Operand:      ssntp.GetConsoleFailure,
+			ErrorForward: sched,
 		},
-		{ // all PublicIPAssigned events go to all Controllers
-			Operand: ssntp.PublicIPAssigned,
-			Dest:    ssntp.Controller,
+		{ // all UpdateLimitsFailure events go to the master Controller
+			Operand:      ssntp.UpdateLimitsFailure,
+			ErrorForward: sched,
+		},
+		{ // all PublicIPAssigned events go to the master Controller
+			Operand:      ssntp.PublicIPAssigned,
+			EventForward: sched,
 		},
 		{ // all START command are processed by the Command forwarder
 			Operand:        ssntp.START,
@@ -1007,10 +1382,34 @@ func setSSNTPForwardRules(sched *ssntpSchedulerServer) {
 			Operand:        ssntp.DetachVolume,
 			CommandForward: sched,
 		},
+		{ // all MIGRATE command are processed by the Command forwarder
+			Operand:        ssntp.MIGRATE,
+			CommandForward: sched,
+		},
+		{ // all CreateImage command are processed by the Command forwarder
+			Operand:        ssntp.CreateImage,
+			CommandForward: sched,
+		},
+		{ // all GetConsole command are processed by the Command forwarder
+			Operand:        ssntp.GetConsole,
+			CommandForward: sched,
+		},
+		{ // all UpdateLimits command are processed by the Command forwarder
+			Operand:        ssntp.UpdateLimits,
+			CommandForward: sched,
+		},
+		{ // all AssignPublicIP command are processed by the Command forwarder
+			Operand:        ssntp.AssignPublicIP,
+			CommandForward: sched,
+		},
+		{ // all ReleasePublicIP command are processed by the Command forwarder
+			Operand:        ssntp.ReleasePublicIP,
+			CommandForward: sched,
+		},
 	}
 }
 
-func configSchedulerServer() (sched *ssntpSchedulerServer) {
+func configSchedulerServer() (sched *ssntpSchedulerServer, err error) {
 	logDirFlag := flag.Lookup("log_dir")
 	if logDirFlag == nil {
 		glog.Errorf("log_dir does not exist")
@@ -1038,7 +1437,19 @@ func configSchedulerServer() (sched *ssntpSchedulerServer) {
 
 	setSSNTPForwardRules(sched)
 
-	return sched
+	blob, err := configuration.ExtractBlob(*configURI)
+	if err != nil {
+		glog.Warningf("Unable to load configuration from %s, using default scheduling policy: %v", *configURI, err)
+	} else {
+		conf, err := configuration.Payload(blob)
+		if err != nil {
+			glog.Errorf("Invalid configuration from %s: %v", *configURI, err)
+			return nil, err
+		}
+		sched.setSchedulingPolicy(&conf)
+	}
+
+	return sched, nil
 }
 
 func main() {
@@ -1047,9 +1458,9 @@ func main() {
 	osprepare.Bootstrap(context.TODO(), ospLogger)
 	osprepare.InstallDeps(context.TODO(), schedDeps, ospLogger)
 
-	sched := configSchedulerServer()
-	if sched == nil {
-		glog.Errorf("unable to configure scheduler")
+	sched, err := configSchedulerServer()
+	if err != nil {
+		glog.Errorf("unable to configure scheduler: %v", err)
 		return
 	}
 
@@ -26,6 +26,7 @@ import (
 	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp"
 	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
 )
 
 // an ssntpSchedulerServer instance for non-SSNTP unit tests
@@ -63,6 +64,7 @@ func spinUpComputeNode(sched *ssntpSchedulerServer, ident int, RAM int) {
 	node.memAvailMB = RAM
 	node.load = 0
 	node.cpus = 4
+	node.cpusAvail = 4
 
 	sched.cnMutex.Lock()
 	defer sched.cnMutex.Unlock()
@@ -94,6 +96,7 @@ func spinUpNetworkNode(sched *ssntpSchedulerServer, ident int, RAM int) {
 	node.memAvailMB = RAM
 	node.load = 0
 	node.cpus = 4
+	node.cpusAvail = 4
 
 	sched.nnMutex.Lock()
 	defer sched.nnMutex.Unlock()
@@ -172,9 +175,10 @@ func TestMain(m *testing.M) {
 }
 
 func TestPickComputeNode(t *testing.T) {
-	sched = configSchedulerServer()
-	if sched == nil {
-		t.Fatal("unable to configure test scheduler")
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
 	}
 
 	var work = createStartWorkload(2, 256, 10000)
@@ -210,6 +214,8 @@ func TestPickComputeNode(t *testing.T) {
 	node = PickComputeNode(sched, "", &resources)
 	if node == nil {
 		t.Error("found no fit when one should exist")
+	} else {
+		node.mutex.Unlock()
 	}
 
 	// 100 compute nodes := earlier 1 + 1 + 1 + now 97 more compute nodes
@@ -219,6 +225,8 @@ func TestPickComputeNode(t *testing.T) {
 	node = PickComputeNode(sched, "", &resources)
 	if node == nil {
 		t.Error("failed to fit in hundred node list")
+	} else {
+		node.mutex.Unlock()
 	}
 
 	// MRU set somewhere arbitrary
@@ -226,13 +234,330 @@ func TestPickComputeNode(t *testing.T) {
 	node = PickComputeNode(sched, "", &resources)
 	if node == nil {
 		t.Error("failed to find fit after MRU")
+	} else {
+		node.mutex.Unlock()
+	}
+}
+
+func TestWorkloadFits(t *testing.T) {
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
+	}
+
+	node := nodeStat{
+		status:      ssntp.READY,
+		memTotalMB:  4096,
+		memAvailMB:  2048,
+		diskTotalMB: 20000,
+		diskAvailMB: 10000,
+		cpus:        4,
+		cpusAvail:   4,
+	}
+
+	var fitTests = []struct {
+		vcpus  int
+		memMB  int
+		diskMB int
+		fits   bool
+	}{
+		{2, 256, 1000, true},
+		{4, 2048, 10000, true},
+		{8, 256, 1000, false},
+		{2, 4096, 1000, false},
+		{2, 256, 20000, false},
+	}
+
+	for _, test := range fitTests {
+		resources, err := sched.getWorkloadResources(createStartWorkload(test.vcpus, test.memMB, test.diskMB))
+		if err != nil {
+			t.Fatalf("bad workload resources: %v", err)
+		}
+
+		if sched.workloadFits(&node, &resources) != test.fits {
+			t.Errorf("vcpus %d, mem %d, disk %d: expected fit %v",
+				test.vcpus, test.memMB, test.diskMB, test.fits)
+		}
+	}
+
+	// Nodes that do not report their disk are only checked for memory
+	node.diskTotalMB = -1
+	node.diskAvailMB = -1
+	resources, _ := sched.getWorkloadResources(createStartWorkload(2, 256, 10000))
+	if sched.workloadFits(&node, &resources) == false {
+		t.Error("disk checked on node not reporting disk")
+	}
+}
+
+func TestOptionalResources(t *testing.T) {
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
+	}
+
+	spinUpComputeNodeSmall(sched, 1)
+
+	// 16 mandatory vcpus on a 4 CPUs node
+	work := createStartWorkload(16, 256, 10000)
+	resources, err := sched.getWorkloadResources(work)
+	if err != nil {
+		t.Fatalf("bad workload resources: %v", err)
+	}
+
+	node := PickComputeNode(sched, "", &resources)
+	if node != nil {
+		node.mutex.Unlock()
+		t.Fatal("found fit for mandatory vcpus when none should exist")
+	}
+
+	reason := sched.startFailureReason(sched.cnList, &resources)
+	if reason != payloads.NotEnoughVCPUs {
+		t.Errorf("expected %s, got %s", payloads.NotEnoughVCPUs, reason)
+	}
+
+	// the same vcpus demand, on a best effort basis
+	work.Start.RequestedResources[0].Mandatory = false
+	resources, err = sched.getWorkloadResources(work)
+	if err != nil {
+		t.Fatalf("bad workload resources: %v", err)
+	}
+
+	node = PickComputeNode(sched, "", &resources)
+	if node == nil {
+		t.Fatal("found no fit for optional vcpus")
+	}
+	node.mutex.Unlock()
+}
+
+func TestVCPUsAccounting(t *testing.T) {
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
+	}
+
+	spinUpComputeNodeLarge(sched, 1)
+
+	// two 2 vcpus workloads fill a 4 CPUs node
+	resources, err := sched.getWorkloadResources(createStartWorkload(2, 256, 0))
+	if err != nil {
+		t.Fatalf("bad workload resources: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		node := PickComputeNode(sched, "", &resources)
+		if node == nil {
+			t.Fatalf("found no fit for workload %d", i)
+		}
+		sched.decrementResourceUsage(node, &resources)
+		node.mutex.Unlock()
+	}
+
+	node := PickComputeNode(sched, "", &resources)
+	if node != nil {
+		node.mutex.Unlock()
+		t.Fatal("found fit for mandatory vcpus on a full node")
+	}
+
+	reason := sched.startFailureReason(sched.cnList, &resources)
+	if reason != payloads.NotEnoughVCPUs {
+		t.Errorf("expected %s, got %s", payloads.NotEnoughVCPUs, reason)
+	}
+
+	// the next READY frame reports the node resources afresh
+	ready := payloads.Ready{
+		NodeUUID:       sched.cnList[0].uuid,
+		MemTotalMB:     141312,
+		MemAvailableMB: 141312,
+		CpusOnline:     4,
+	}
+	payload, err := yaml.Marshal(&ready)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sched.updateNodeStat(sched.cnList[0], ssntp.READY, &ssntp.Frame{Payload: payload})
+
+	node = PickComputeNode(sched, "", &resources)
+	if node == nil {
+		t.Fatal("found no fit after READY")
+	}
+	node.mutex.Unlock()
+}
+
+func TestStartFailureReason(t *testing.T) {
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
+	}
+
+	spinUpComputeNodeVerySmall(sched, 1)
+	spinUpComputeNodeSmall(sched, 2)
+	for _, node := range sched.cnList {
+		node.diskTotalMB = 20000
+		node.diskAvailMB = 5000
+	}
+
+	var reasonTests = []struct {
+		vcpus    int
+		memMB    int
+		diskMB   int
+		expected payloads.StartFailureReason
+	}{
+		{8, 256, 1000, payloads.NotEnoughVCPUs},
+		{2, 32768, 1000, payloads.NotEnoughMemory},
+		{2, 256, 10000, payloads.NotEnoughDisk},
+		{2, 256, 1000, payloads.FullCloud},
+	}
+
+	for _, test := range reasonTests {
+		resources, err := sched.getWorkloadResources(createStartWorkload(test.vcpus, test.memMB, test.diskMB))
+		if err != nil {
+			t.Fatalf("bad workload resources: %v", err)
+		}
+
+		reason := sched.startFailureReason(sched.cnList, &resources)
+		if reason != test.expected {
+			t.Errorf("vcpus %d, mem %d, disk %d: expected %s, got %s",
+				test.vcpus, test.memMB, test.diskMB, test.expected, reason)
+		}
+	}
+}
+
+func spinUpComputeNodeWithLoad(sched *ssntpSchedulerServer, ident int, memAvail int, load int) {
+	spinUpComputeNode(sched, ident, 16384)
+	node := sched.cnMap[fmt.Sprintf("%08d", ident)]
+	node.memAvailMB = memAvail
+	node.load = load
+}
+
+func TestSchedulingPolicies(t *testing.T) {
+	var policyTests = []struct {
+		policy   payloads.SchedulingPolicy
+		expected string
+	}{
+		{payloads.RoundRobin, "00000001"},
+		{payloads.BinPack, "00000002"},
+		{payloads.Spread, "00000003"},
+		{payloads.LeastLoaded, "00000004"},
+	}
+
+	for _, test := range policyTests {
+		var err error
+		sched, err = configSchedulerServer()
+		if err != nil {
+			t.Fatalf("unable to configure test scheduler: %v", err)
+		}
+
+		var conf payloads.Configure
+		conf.Configure.Scheduler.Policy = test.policy
+		sched.setSchedulingPolicy(&conf)
+		if sched.cnPolicy.name() != test.policy {
+			t.Fatalf("expected policy %s, got %s", test.policy, sched.cnPolicy.name())
+		}
+
+		spinUpComputeNodeWithLoad(sched, 0, 100, 0)
+		spinUpComputeNodeWithLoad(sched, 1, 8192, 3)
+		spinUpComputeNodeWithLoad(sched, 2, 1024, 3)
+		spinUpComputeNodeWithLoad(sched, 3, 16384, 2)
+		spinUpComputeNodeWithLoad(sched, 4, 4096, 1)
+
+		resources, err := sched.getWorkloadResources(createStartWorkload(2, 256, 10000))
+		if err != nil {
+			t.Fatalf("bad workload resources: %v", err)
+		}
+
+		node := PickComputeNode(sched, "", &resources)
+		if node == nil {
+			t.Fatalf("%s: found no fit when one should exist", test.policy)
+		}
+		node.mutex.Unlock()
+
+		if node.uuid != test.expected {
+			t.Errorf("%s: expected node %s, got %s", test.policy, test.expected, node.uuid)
+		}
+	}
+}
+
+func TestImageLocality(t *testing.T) {
+	var policyTests = []struct {
+		policy   payloads.SchedulingPolicy
+		expected []string
+	}{
+		// workloads are spread over the nodes holding the image
+		{payloads.RoundRobin, []string{"00000001", "00000003", "00000001", "00000003"}},
+		// equally scored nodes holding the image win, until their
+		// vCPUs run out
+		{payloads.BinPack, []string{"00000001", "00000001", "00000003", "00000003"}},
+		{payloads.Spread, []string{"00000001", "00000003", "00000000", "00000002"}},
+		{payloads.LeastLoaded, []string{"00000001", "00000003", "00000000", "00000002"}},
+	}
+
+	for _, test := range policyTests {
+		var err error
+		sched, err = configSchedulerServer()
+		if err != nil {
+			t.Fatalf("unable to configure test scheduler: %v", err)
+		}
+
+		var conf payloads.Configure
+		conf.Configure.Scheduler.Policy = test.policy
+		sched.setSchedulingPolicy(&conf)
+
+		work := createStartWorkload(2, 256, 0)
+		for i := 0; i < 4; i++ {
+			spinUpComputeNodeSmall(sched, i)
+		}
+		for _, i := range []int{1, 3} {
+			node := sched.cnMap[fmt.Sprintf("%08d", i)]
+			node.images = map[string]bool{work.Start.ImageUUID: true}
+		}
+
+		resources, err := sched.getWorkloadResources(work)
+		if err != nil {
+			t.Fatalf("bad workload resources: %v", err)
+		}
+
+		for _, expected := range test.expected {
+			node := PickComputeNode(sched, "", &resources)
+			if node == nil {
+				t.Fatalf("%s: found no fit when one should exist", test.policy)
+			}
+			sched.decrementResourceUsage(node, &resources)
+			node.mutex.Unlock()
+
+			if node.uuid != expected {
+				t.Errorf("%s: expected node %s, got %s", test.policy, expected, node.uuid)
+			}
+		}
+	}
+}
+
+func TestUnknownSchedulingPolicy(t *testing.T) {
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
+	}
+
+	var conf payloads.Configure
+	conf.Configure.Scheduler.Policy = payloads.Spread
+	sched.setSchedulingPolicy(&conf)
+
+	conf.Configure.Scheduler.Policy = "first_come"
+	sched.setSchedulingPolicy(&conf)
+	if sched.cnPolicy.name() != payloads.Spread {
+		t.Errorf("unknown policy replaced %s", payloads.Spread)
 	}
 }
 
 func benchmarkPickComputeNode(b *testing.B, nodecount int) {
-	sched = configSchedulerServer()
-	if sched == nil {
-		b.Fatal("unable to configure test scheduler")
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		b.Fatalf("unable to configure test scheduler: %v", err)
 	}
 
 	// eg: idle, small compute nodes
@@ -286,9 +611,10 @@ func BenchmarkPickComputeNode1000000(b *testing.B) {
 }
 
 func TestHeartBeatController(t *testing.T) {
-	sched = configSchedulerServer()
-	if sched == nil {
-		t.Fatal("unable to configure test scheduler")
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
 	}
 
 	// zero controllers
@@ -324,9 +650,10 @@ func TestHeartBeatController(t *testing.T) {
 }
 
 func TestHeartBeatComputeNodes(t *testing.T) {
-	sched = configSchedulerServer()
-	if sched == nil {
-		t.Fatal("unable to configure test scheduler")
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
 	}
 
 	// zero compute nodes
@@ -356,9 +683,10 @@ func TestHeartBeatComputeNodes(t *testing.T) {
 }
 
 func TestHeartBeat(t *testing.T) {
-	sched = configSchedulerServer()
-	if sched == nil {
-		t.Fatal("unable to configure test scheduler")
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
 	}
 
 	beatTxt := heartBeat(sched, 0)
@@ -511,9 +839,10 @@ func clientMiscMods() {
 func TestClientMgmtLocking(t *testing.T) {
 	var wg sync.WaitGroup
 
-	sched = configSchedulerServer()
-	if sched == nil {
-		t.Fatal("unable to configure test scheduler")
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
 	}
 
 	// simple first serial sanity check
@@ -551,10 +880,94 @@ func TestClientMgmtLocking(t *testing.T) {
 	wg.Wait()
 }
 
+func TestControllerPromotion(t *testing.T) {
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
+	}
+
+	dest := sched.fwdFrameToMasterController()
+	if dest.Decision() != ssntp.Discard {
+		t.Error("Frame forwarded without any Controller")
+	}
+
+	ConnectController(sched, "c1")
+	ConnectController(sched, "c2")
+	ConnectComputeNode(sched, "1")
+	ConnectComputeNode(sched, "2")
+	ConnectNetworkNode(sched, "a")
+
+	stat := payloads.Stat{
+		NodeUUID: "1",
+		Status:   ssntp.READY.String(),
+		Instances: []payloads.InstanceStat{
+			{
+				InstanceUUID: testutil.InstanceUUID,
+				State:        payloads.ComputeStatusRunning,
+			},
+		},
+	}
+	b, err := yaml.Marshal(&stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sched.cacheNodeStats("1", b)
+
+	dest = sched.fwdFrameToMasterController()
+	if len(dest.Recipients()) != 1 || dest.Recipients()[0] != "c1" {
+		t.Errorf("Frame forwarded to %v, expected c1", dest.Recipients())
+	}
+
+	promoted := removeController(sched, "c1")
+	if promoted != "c2" {
+		t.Fatalf("Promoted controller \"%s\", expected c2", promoted)
+	}
+
+	if sched.controllerList[0].uuid != "c2" || sched.controllerList[0].status != controllerMaster {
+		t.Errorf("c2 is not the master controller")
+	}
+
+	dest = sched.fwdFrameToMasterController()
+	if len(dest.Recipients()) != 1 || dest.Recipients()[0] != "c2" {
+		t.Errorf("Frame forwarded to %v, expected c2", dest.Recipients())
+	}
+
+	event := sched.controllerPromotedPayload(promoted)
+	if event.ControllerPromoted.ControllerUUID != "c2" {
+		t.Errorf("Wrong controller UUID %s", event.ControllerPromoted.ControllerUUID)
+	}
+
+	// only node 1 reported STATS
+	nodeStats := event.ControllerPromoted.NodeStats
+	if len(nodeStats) != 1 || nodeStats[0].NodeUUID != "1" {
+		t.Fatalf("Wrong node stats %v", nodeStats)
+	}
+
+	if len(nodeStats[0].Instances) != 1 ||
+		nodeStats[0].Instances[0].InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance stats %v", nodeStats[0].Instances)
+	}
+
+	if removeController(sched, "c2") != "" {
+		t.Error("Controller promoted without any backup")
+	}
+
+	dest = sched.fwdFrameToMasterController()
+	if dest.Decision() != ssntp.Discard {
+		t.Error("Frame forwarded without any Controller")
+	}
+
+	DisconnectComputeNode(sched, "1")
+	DisconnectComputeNode(sched, "2")
+	DisconnectNetworkNode(sched, "a")
+}
+
 func TestStartWorkload(t *testing.T) {
-	sched = configSchedulerServer()
-	if sched == nil {
-		t.Fatal("unable to configure test scheduler")
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
 	}
 	spinUpController(sched, 1, controllerMaster)
 	var controllerUUID = fmt.Sprintf("%08d", 1)
@@ -624,9 +1037,10 @@ func TestStartWorkload(t *testing.T) {
 }
 
 func TestGetWorkloadAgentUUID(t *testing.T) {
-	sched = configSchedulerServer()
-	if sched == nil {
-		t.Fatal("unable to configure test scheduler")
+	var err error
+	sched, err = configSchedulerServer()
+	if err != nil {
+		t.Fatalf("unable to configure test scheduler: %v", err)
 	}
 
 	var stringTests = []struct {
@@ -640,6 +1054,10 @@ func TestGetWorkloadAgentUUID(t *testing.T) {
 		{ssntp.DELETE, []byte(testutil.DeleteYaml), testutil.InstanceUUID, testutil.AgentUUID},
 		{ssntp.EVACUATE, []byte(testutil.EvacuateYaml), "", testutil.AgentUUID},
 		{ssntp.AttachVolume, []byte(testutil.AttachVolumeYaml), testutil.InstanceUUID, testutil.AgentUUID},
+		{ssntp.MIGRATE, []byte(testutil.MigrateYaml), testutil.InstanceUUID, testutil.AgentUUID},
+		{ssntp.CreateImage, []byte(testutil.CreateImageYaml), testutil.InstanceUUID, testutil.AgentUUID},
+		{ssntp.GetConsole, []byte(testutil.GetConsoleYaml), testutil.InstanceUUID, testutil.AgentUUID},
+		{ssntp.UpdateLimits, []byte(testutil.UpdateLimitsYaml), testutil.InstanceUUID, testutil.AgentUUID},
 	}
 	for _, test := range stringTests {
 		instanceUUID, agentUUID, _ := GetWorkloadAgentUUID(sched, test.cmd, test.yaml)
@@ -17,7 +17,6 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -410,9 +409,10 @@ func restartServer() error {
 	agentCh := agent.AddEventChan(ssntp.NodeConnected)
 	cnciAgentCh := cnciAgent.AddEventChan(ssntp.NodeConnected)
 
-	server = configSchedulerServer()
-	if server == nil {
-		return errors.New("unable to configure scheduler")
+	var err error
+	server, err = configSchedulerServer()
+	if err != nil {
+		return err
 	}
 	go server.ssntp.Serve(server.config, server)
 	//go heartBeatLoop(server)  ...handy for debugging
@@ -491,6 +491,82 @@ func TestPublicIPAssigned(t *testing.T) {
 	}
 }
 
+func TestAssignPublicIP(t *testing.T) {
+	cnciAgentCh := cnciAgent.AddCmdChan(ssntp.AssignPublicIP)
+
+	_, err := controller.Ssntp.SendCommand(ssntp.AssignPublicIP, []byte(testutil.AssignIPYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := cnciAgent.GetCmdChanResult(cnciAgentCh, ssntp.AssignPublicIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != testutil.InstanceUUID {
+		t.Fatalf("Expected instance %s, got %s", testutil.InstanceUUID, result.InstanceUUID)
+	}
+}
+
+func TestReleasePublicIP(t *testing.T) {
+	cnciAgentCh := cnciAgent.AddCmdChan(ssntp.ReleasePublicIP)
+
+	_, err := controller.Ssntp.SendCommand(ssntp.ReleasePublicIP, []byte(testutil.ReleaseIPYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := cnciAgent.GetCmdChanResult(cnciAgentCh, ssntp.ReleasePublicIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InstanceUUID != testutil.InstanceUUID {
+		t.Fatalf("Expected instance %s, got %s", testutil.InstanceUUID, result.InstanceUUID)
+	}
+}
+
+func TestControllerFailover(t *testing.T) {
+	backup, err := testutil.NewSsntpTestControllerConnection("Backup Controller Client", testutil.ControllerUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForController(testutil.ControllerUUID)
+
+	// the master controller leaves, the backup takes over
+	backupCh := backup.AddEventChan(ssntp.ControllerPromoted)
+	masterUUID := controller.UUID
+	controller.Shutdown()
+
+	_, err = backup.GetEventChanResult(backupCh, ssntp.ControllerPromoted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statsCh := backup.AddCmdChan(ssntp.STATS)
+	go agent.SendStatsCmd()
+
+	_, err = backup.GetCmdChanResult(statsCh, ssntp.STATS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the original controller comes back as a backup and is
+	// promoted again once the current master leaves
+	controller, err = testutil.NewSsntpTestControllerConnection("Controller Client", masterUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForController(masterUUID)
+
+	controllerCh := controller.AddEventChan(ssntp.ControllerPromoted)
+	backup.Shutdown()
+
+	_, err = controller.GetEventChanResult(controllerCh, ssntp.ControllerPromoted)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func waitForController(uuid string) {
 	for {
 		server.controllerMutex.Lock()
@@ -550,9 +626,9 @@ func ssntpTestsSetup() error {
 	var err error
 
 	// start server
-	server = configSchedulerServer()
-	if server == nil {
-		return errors.New("unable to configure scheduler")
+	server, err = configSchedulerServer()
+	if err != nil {
+		return err
 	}
 	go server.ssntp.Serve(server.config, server)
 	//go heartBeatLoop(server)  ...handy for debugging
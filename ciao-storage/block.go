@@ -31,6 +31,7 @@ type BlockDriver interface {
 	UnmapVolumeFromNode(volumeUUID string) error
 	GetVolumeMapping() (map[string][]string, error)
 	CopyBlockDevice(string) (BlockDevice, error)
+	HasImage(imageID string) bool
 }
 
 // BlockDevice contains information about a block devices.
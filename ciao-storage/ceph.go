@@ -20,11 +20,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"path"
 	"strconv"
 
 	"github.com/01org/ciao/ssntp/uuid"
 )
 
+// ImageSnapshot is the name of the protected snapshot of the rbd images
+// holding the data of the images of the image service. Volumes created
+// from these images are cloned from this snapshot.
+const ImageSnapshot = "ciao-image"
+
 // CephDriver maintains context for the ceph driver interface.
 type CephDriver struct {
 	// ID is the cephx user ID to use
@@ -32,6 +38,8 @@ type CephDriver struct {
 }
 
 // CreateBlockDevice will create a rbd image in the ceph cluster.
+// imagePath is either the path of an image file, or the ID of an image
+// the image service stores in ceph, from which the rbd image is cloned.
 func (d CephDriver) CreateBlockDevice(imagePath *string, size int) (BlockDevice, error) {
 	// generate a UUID to use for this image.
 	ID := uuid.Generate().String()
@@ -41,7 +49,12 @@ func (d CephDriver) CreateBlockDevice(imagePath *string, size int) (BlockDevice,
 	// imageFeatures holds the image features to use when creating a ceph rbd image format 2
 	// Currently the kernel rdb client only supports layering but in the future more feaures
 	// should be added as they are enabled in the kernel.
-	if imagePath != nil {
+	if imagePath != nil && d.HasImage(path.Base(*imagePath)) {
+		// the image is stored in ceph, clone it instead of copying it.
+		snapshot := path.Base(*imagePath) + "@" + ImageSnapshot
+		args := append(d.getCredentials(), "clone", snapshot, ID)
+		cmd = exec.Command("rbd", args...)
+	} else if imagePath != nil {
 		rbdStr := fmt.Sprintf("rbd:rbd/%s:id=%s", ID, d.ID)
 		cmd = exec.Command("qemu-img", "convert", "-O", "rbd", *imagePath, rbdStr)
 	} else {
@@ -57,6 +70,13 @@ func (d CephDriver) CreateBlockDevice(imagePath *string, size int) (BlockDevice,
 	return BlockDevice{ID: ID}, nil
 }
 
+// HasImage checks whether imageID is an image the image service stores in
+// ceph, i.e. an rbd image with an ImageSnapshot snapshot.
+func (d CephDriver) HasImage(imageID string) bool {
+	args := append(d.getCredentials(), "info", imageID+"@"+ImageSnapshot)
+	return exec.Command("rbd", args...).Run() == nil
+}
+
 // CopyBlockDevice will copy an existing volume
 func (d CephDriver) CopyBlockDevice(volumeUUID string) (BlockDevice, error) {
 	ID := uuid.Generate().String()
@@ -16,7 +16,12 @@ package storage
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
 	"testing"
+
+	"github.com/01org/ciao/testutil"
 )
 
 var driver = CephDriver{
@@ -40,3 +45,44 @@ func TestDeleteBlockDevice(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestCreateBlockDeviceFromImage(t *testing.T) {
+	rbd, err := testutil.NewFakeRBD()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rbd.Close() }()
+
+	image := "73a86d7e-93c0-480e-9c41-ab42f69b7799"
+
+	cmd := exec.Command("rbd", "import", "-", image)
+	cmd.Stdin = strings.NewReader("image data")
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{"create"}, {"protect"}} {
+		args = append([]string{"snap"}, append(args, image+"@"+ImageSnapshot)...)
+		err = exec.Command("rbd", args...).Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !driver.HasImage(image) || driver.HasImage(imagePath) {
+		t.Fatalf("%s should be the only image stored in ceph", image)
+	}
+
+	for _, path := range []string{image, imagePath} {
+		device, err := driver.CreateBlockDevice(&path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadFile(rbd.ImagePath(device.ID))
+		if err != nil || string(data) != "image data" {
+			t.Errorf("Wrong %s clone data %q: %v", path, string(data), err)
+		}
+	}
+}
@@ -36,6 +36,11 @@ func (d *NoopDriver) CopyBlockDevice(string) (BlockDevice, error) {
 	return BlockDevice{ID: uuid.Generate().String()}, nil
 }
 
+// HasImage reports that no image is stored alongside the block devices.
+func (d *NoopDriver) HasImage(imageID string) bool {
+	return false
+}
+
 // DeleteBlockDevice pretends to delete a block device.
 func (d *NoopDriver) DeleteBlockDevice(string) error {
 	return nil
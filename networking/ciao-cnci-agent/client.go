@@ -200,7 +200,13 @@ func processCommand(client *ssntpConn, cmd *cmdWrapper) {
 			glog.Infof("Processing: CiaoCommandAssignPublicIP %v", c)
 			err := assignPubIP(c)
 			if err != nil {
-				glog.Infof("Error Processing: CiaoCommandAssignPublicIP %v", err)
+				glog.Errorf("Error Processing: CiaoCommandAssignPublicIP %v", err)
+				return
+			}
+
+			err = sendNetworkEvent(client, ssntp.PublicIPAssigned, c)
+			if err != nil {
+				glog.Errorf("Unable to send PublicIPAssigned %v", err)
 			}
 		}(cmd)
 
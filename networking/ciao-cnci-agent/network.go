@@ -253,12 +253,25 @@ func cnciAddedMarshal(agentUUID string) ([]byte, error) {
 	return yaml.Marshal(&cnciAdded)
 }
 
-func sendNetworkEvent(client *ssntpConn, eventType ssntp.Event, eventInfo interface{}) error {
-
-	if !client.isConnected() {
-		return fmt.Errorf("Unable to send %s %v", eventType, eventInfo)
+func publicIPAssignedMarshal(agentUUID string, eventInfo interface{}) ([]byte, error) {
+	cmd, ok := eventInfo.(*payloads.PublicIPCommand)
+	if !ok {
+		return nil, fmt.Errorf("invalid publicIP Assigned event info %v", eventInfo)
 	}
 
+	var assigned payloads.EventPublicIPAssigned
+
+	assigned.AssignedIP.ConcentratorUUID = agentUUID
+	assigned.AssignedIP.InstanceUUID = cmd.InstanceUUID
+	assigned.AssignedIP.PublicIP = cmd.PublicIP
+	assigned.AssignedIP.PrivateIP = cmd.PrivateIP
+
+	return yaml.Marshal(&assigned)
+}
+
+// sendNetworkEvent sends a network event to the scheduler.  Events sent
+// while disconnected are queued by the SSNTP client until it reconnects.
+func sendNetworkEvent(client *ssntpConn, eventType ssntp.Event, eventInfo interface{}) error {
 	payload, err := generateNetEventPayload(eventType, eventInfo, client.UUID())
 	if err != nil {
 		return fmt.Errorf("Unable parse ssntpEvent %s %v", err, eventInfo)
@@ -280,7 +293,7 @@ func generateNetEventPayload(eventType ssntp.Event, eventInfo interface{}, agent
 		return cnciAddedMarshal(agentUUID)
 	case ssntp.PublicIPAssigned:
 		glog.Infof("generating publicIP Assigned Event Payload %s", agentUUID)
-		return nil, nil
+		return publicIPAssignedMarshal(agentUUID, eventInfo)
 	default:
 		return nil, fmt.Errorf("Unsupported ssntpEventInfo type: %v", eventType)
 	}
@@ -309,6 +322,7 @@ func assignPubIP(cmd *payloads.PublicIPCommand) error {
 
 	if err != nil {
 		glog.Errorf("cnci.assignPubIP invalid params %v %v", err, cmd)
+		return err
 	}
 
 	if enableNetwork {
@@ -324,6 +338,7 @@ func releasePubIP(cmd *payloads.PublicIPCommand) error {
 
 	if err != nil {
 		glog.Errorf("cnci.releasePubIP invalid params %v %v", err, cmd)
+		return err
 	}
 
 	if enableNetwork {
@@ -23,6 +23,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/01org/ciao/openstack/identity"
 	"github.com/gorilla/mux"
 )
 
@@ -291,6 +292,51 @@ type ShowVolumeDetails struct {
 	Volume VolumeDetail `json:"volume"`
 }
 
+// QuotaSet implements the block api quota set object.  Only the volumes
+// quota is supported.  A limit of -1 indicates that the limit is infinite.
+// http://developer.openstack.org/api-ref-blockstorage-v2.html#quota-sets-v2
+type QuotaSet struct {
+	ID      string `json:"id"`
+	Volumes int    `json:"volumes"`
+}
+
+// QuotaSetResponse is the json response for the showQuotaSet and
+// updateQuotaSet endpoints.
+type QuotaSetResponse struct {
+	QuotaSet QuotaSet `json:"quota_set"`
+}
+
+// QuotaDetail contains the limit and current usage of a single resource.
+type QuotaDetail struct {
+	InUse    int `json:"in_use"`
+	Limit    int `json:"limit"`
+	Reserved int `json:"reserved"`
+}
+
+// QuotaSetDetail implements the quota set object returned when usage is
+// requested.
+type QuotaSetDetail struct {
+	ID      string      `json:"id"`
+	Volumes QuotaDetail `json:"volumes"`
+}
+
+// QuotaSetDetailResponse is the json response for the showQuotaSet endpoint
+// when usage is requested.
+type QuotaSetDetailResponse struct {
+	QuotaSet QuotaSetDetail `json:"quota_set"`
+}
+
+// QuotaSetUpdate contains the quotas to change for a tenant.  Quotas
+// which are not present are left unchanged.
+type QuotaSetUpdate struct {
+	Volumes *int `json:"volumes,omitempty"`
+}
+
+// UpdateQuotaSetRequest is the json request for the updateQuotaSet endpoint.
+type UpdateQuotaSetRequest struct {
+	QuotaSet QuotaSetUpdate `json:"quota_set"`
+}
+
 // These errors can be returned by the Service interface
 var (
 	ErrQuota                = errors.New("Tenant over quota")
@@ -302,6 +348,7 @@ var (
 	ErrInstanceOwner        = errors.New("You are not instance owner")
 	ErrInstanceNotAvailable = errors.New("Instance not available")
 	ErrVolumeNotAttached    = errors.New("Volume not attached")
+	ErrNotAdmin             = errors.New("Admin rights required")
 )
 
 // errorResponse maps service error responses to http responses.
@@ -322,7 +369,8 @@ func errorResponse(err error) APIResponse {
 		ErrVolumeOwner,
 		ErrInstanceOwner,
 		ErrInstanceNotAvailable,
-		ErrVolumeNotAttached:
+		ErrVolumeNotAttached,
+		ErrNotAdmin:
 		return APIResponse{http.StatusForbidden, nil}
 	default:
 		return APIResponse{http.StatusInternalServerError, nil}
@@ -347,6 +395,9 @@ type Service interface {
 	ListVolumes(tenant string) ([]ListVolume, error)
 	ListVolumesDetail(tenant string) ([]VolumeDetail, error)
 	ShowVolumeDetails(tenant string, volume string) (VolumeDetail, error)
+	ShowVolumeQuotaSet(tenant string) (QuotaSetDetail, error)
+	UpdateVolumeQuotaSet(tenant string, req QuotaSetUpdate) (QuotaSetDetail, error)
+	DeleteVolumeQuotaSet(tenant string) error
 }
 
 // Context contains data and interfaces that the block api will need.
@@ -649,6 +700,87 @@ func volumeAction(bc *Context, w http.ResponseWriter, r *http.Request) (APIRespo
 	return APIResponse{http.StatusBadRequest, nil}, err
 }
 
+func showQuotaSet(bc *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	q, err := bc.ShowVolumeQuotaSet(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if r.URL.Query().Get("usage") == "true" {
+		return APIResponse{http.StatusOK, QuotaSetDetailResponse{q}}, nil
+	}
+
+	resp := QuotaSetResponse{QuotaSet{ID: q.ID, Volumes: q.Volumes.Limit}}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+func showQuotaSetDefaults(bc *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	// tenants are unlimited unless an administrator says otherwise
+	resp := QuotaSetResponse{QuotaSet{ID: tenant, Volumes: -1}}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+func updateQuotaSet(bc *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant_id"]
+
+	if !identity.GetIdentity(r).Admin {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req UpdateQuotaSetRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	volumes := req.QuotaSet.Volumes
+	if volumes != nil && *volumes < -1 {
+		return APIResponse{http.StatusBadRequest, nil},
+			fmt.Errorf("Invalid quota %d", *volumes)
+	}
+
+	q, err := bc.UpdateVolumeQuotaSet(tenant, req.QuotaSet)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	resp := QuotaSetResponse{QuotaSet{ID: q.ID, Volumes: q.Volumes.Limit}}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+func deleteQuotaSet(bc *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant_id"]
+
+	if !identity.GetIdentity(r).Admin {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	err := bc.DeleteVolumeQuotaSet(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, nil}, nil
+}
+
 // Routes provides gorilla mux routes for the supported endpoints.
 func Routes(config APIConfig) *mux.Router {
 	// make new Context
@@ -680,5 +812,19 @@ func Routes(config APIConfig) *mux.Router {
 	r.Handle("/v2/{tenant}/volumes/{volume_id}/action",
 		APIHandler{context, volumeAction}).Methods("POST")
 
+	// Quotas, the token must belong to the tenant whose quotas are read
+	// so the target tenant is the tenant variable here.
+	r.Handle("/v2/{project}/os-quota-sets/{tenant}",
+		APIHandler{context, showQuotaSet}).Methods("GET")
+	r.Handle("/v2/{project}/os-quota-sets/{tenant}/defaults",
+		APIHandler{context, showQuotaSetDefaults}).Methods("GET")
+
+	// Quota admin endpoints, these have no tenant variable and thus
+	// require an admin token.  The handlers check for admin rights too.
+	r.Handle("/v2/{project}/os-quota-sets/{tenant_id}",
+		APIHandler{context, updateQuotaSet}).Methods("PUT")
+	r.Handle("/v2/{project}/os-quota-sets/{tenant_id}",
+		APIHandler{context, deleteQuotaSet}).Methods("DELETE")
+
 	return r
 }
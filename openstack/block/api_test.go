@@ -22,6 +22,8 @@ import (
 	"os"
 	"strconv"
 	"testing"
+
+	"github.com/01org/ciao/openstack/identity"
 )
 
 type test struct {
@@ -119,6 +121,54 @@ var tests = []test{
 		http.StatusAccepted,
 		"null",
 	},
+	{
+		"GET",
+		"/v2/validtenantid/os-quota-sets/validtenantid",
+		showQuotaSet,
+		"",
+		http.StatusOK,
+		`{"quota_set":{"id":"","volumes":10}}`,
+	},
+	{
+		"GET",
+		"/v2/validtenantid/os-quota-sets/validtenantid?usage=true",
+		showQuotaSet,
+		"",
+		http.StatusOK,
+		`{"quota_set":{"id":"","volumes":{"in_use":2,"limit":10,"reserved":0}}}`,
+	},
+	{
+		"GET",
+		"/v2/validtenantid/os-quota-sets/validtenantid/defaults",
+		showQuotaSetDefaults,
+		"",
+		http.StatusOK,
+		`{"quota_set":{"id":"","volumes":-1}}`,
+	},
+	{
+		"PUT",
+		"/v2/validtenantid/os-quota-sets/validtenantid",
+		updateQuotaSet,
+		`{"quota_set":{"volumes":5}}`,
+		http.StatusOK,
+		`{"quota_set":{"id":"","volumes":5}}`,
+	},
+	{
+		"PUT",
+		"/v2/validtenantid/os-quota-sets/validtenantid",
+		updateQuotaSet,
+		`{"quota_set":{"volumes":-2}}`,
+		http.StatusBadRequest,
+		"Bad Request\nnull",
+	},
+	{
+		"DELETE",
+		"/v2/validtenantid/os-quota-sets/validtenantid",
+		deleteQuotaSet,
+		"",
+		http.StatusOK,
+		"null",
+	},
 }
 
 type testVolumeService struct{}
@@ -262,6 +312,27 @@ func (vs testVolumeService) ListVolumesDetail(tenant string) ([]VolumeDetail, er
 	}, nil
 }
 
+func (vs testVolumeService) ShowVolumeQuotaSet(tenant string) (QuotaSetDetail, error) {
+	return QuotaSetDetail{
+		ID:      tenant,
+		Volumes: QuotaDetail{InUse: 2, Limit: 10},
+	}, nil
+}
+
+func (vs testVolumeService) UpdateVolumeQuotaSet(tenant string, req QuotaSetUpdate) (QuotaSetDetail, error) {
+	q, _ := vs.ShowVolumeQuotaSet(tenant)
+
+	if req.Volumes != nil {
+		q.Volumes.Limit = *req.Volumes
+	}
+
+	return q, nil
+}
+
+func (vs testVolumeService) DeleteVolumeQuotaSet(tenant string) error {
+	return nil
+}
+
 func TestAPIResponse(t *testing.T) {
 	var vs testVolumeService
 
@@ -276,6 +347,8 @@ func TestAPIResponse(t *testing.T) {
 			t.Fatal(err)
 		}
 
+		req = identity.WithIdentity(req, identity.Identity{Admin: true})
+
 		rr := httptest.NewRecorder()
 		handler := APIHandler{context, tt.handler}
 
@@ -292,6 +365,39 @@ func TestAPIResponse(t *testing.T) {
 	}
 }
 
+func TestQuotaSetNotAdmin(t *testing.T) {
+	var vs testVolumeService
+
+	context := &Context{8776, vs}
+
+	quotaTests := []struct {
+		method  string
+		handler func(*Context, http.ResponseWriter, *http.Request) (APIResponse, error)
+		request string
+	}{
+		{"PUT", updateQuotaSet, `{"quota_set":{"volumes":5}}`},
+		{"DELETE", deleteQuotaSet, ""},
+	}
+
+	for _, tt := range quotaTests {
+		req, err := http.NewRequest(tt.method, "/v2/validtenantid/os-quota-sets/othertenantid", bytes.NewBuffer([]byte(tt.request)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req = identity.WithIdentity(req, identity.Identity{ProjectID: "validtenantid"})
+
+		rr := httptest.NewRecorder()
+		handler := APIHandler{context, tt.handler}
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("%s: got %v, expected %v", tt.method, rr.Code, http.StatusForbidden)
+		}
+	}
+}
+
 func TestRoutes(t *testing.T) {
 	var vs testVolumeService
 	config := APIConfig{8776, vs}
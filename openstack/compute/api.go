@@ -25,6 +25,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/01org/ciao/openstack/identity"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 )
@@ -77,6 +78,17 @@ var (
 	ErrServerNotFound       = errors.New("Server not found")
 	ErrServerOwner          = errors.New("You are not server owner")
 	ErrInstanceNotAvailable = errors.New("Instance not currently available for this operation")
+	ErrFloatingIPNotFound   = errors.New("Floating IP not found")
+	ErrNoFreeFloatingIP     = errors.New("No more floating IPs available")
+	ErrFloatingIPOwner      = errors.New("You are not floating IP owner")
+	ErrFloatingIPInUse      = errors.New("Floating IP in use")
+	ErrFloatingIPNotMapped  = errors.New("Floating IP not associated to the server")
+	ErrFloatingIPExists     = errors.New("Floating IP already exists")
+	ErrInvalidIPRange       = errors.New("Invalid IP range")
+	ErrInvalidFlavor        = errors.New("Flavor cannot be used for this server")
+	ErrServerNotResizing    = errors.New("Server is not being resized")
+	ErrNoCapacity           = errors.New("No node has the capacity for this server")
+	ErrNotAdmin             = errors.New("Admin rights required")
 )
 
 // errorResponse maps service error responses to http responses.
@@ -84,12 +96,21 @@ var (
 // on return values all the time.
 func errorResponse(err error) APIResponse {
 	switch err {
-	case ErrTenantNotFound, ErrServerNotFound:
+	case ErrTenantNotFound, ErrServerNotFound, ErrFloatingIPNotFound,
+		ErrNoFreeFloatingIP:
 		return APIResponse{http.StatusNotFound, nil}
 
-	case ErrQuota, ErrServerOwner, ErrInstanceNotAvailable:
+	case ErrQuota, ErrServerOwner, ErrInstanceNotAvailable,
+		ErrFloatingIPOwner, ErrNotAdmin:
 		return APIResponse{http.StatusForbidden, nil}
 
+	case ErrFloatingIPInUse, ErrFloatingIPNotMapped, ErrFloatingIPExists,
+		ErrServerNotResizing, ErrNoCapacity:
+		return APIResponse{http.StatusConflict, nil}
+
+	case ErrInvalidIPRange, ErrInvalidFlavor:
+		return APIResponse{http.StatusBadRequest, nil}
+
 	default:
 		return APIResponse{http.StatusInternalServerError, nil}
 	}
@@ -233,6 +254,222 @@ type CreateServerRequest struct {
 	} `json:"server"`
 }
 
+// CreateImageRequest represents the unmarshalled version of the contents of a
+// createImage /v2.1/{tenant}/servers/{server}/action request.  It contains
+// the name and metadata of the image to be created from the server.
+type CreateImageRequest struct {
+	CreateImage struct {
+		Name     string            `json:"name"`
+		Metadata map[string]string `json:"metadata,omitempty"`
+	} `json:"createImage"`
+}
+
+// CreateImageResponse represents the marshalled version of the response to a
+// createImage /v2.1/{tenant}/servers/{server}/action request.  It contains
+// the UUID of the image that will hold the snapshot of the server.
+type CreateImageResponse struct {
+	ImageID string `json:"image_id"`
+}
+
+// GetConsoleOutputRequest represents the unmarshalled version of the contents
+// of an os-getConsoleOutput /v2.1/{tenant}/servers/{server}/action request.
+// It contains the number of lines of console output to return.  A missing
+// or negative length requests the entire console log.
+type GetConsoleOutputRequest struct {
+	GetConsoleOutput struct {
+		Length *int `json:"length"`
+	} `json:"os-getConsoleOutput"`
+}
+
+// ResizeServerRequest represents the unmarshalled version of the contents
+// of a resize /v2.1/{tenant}/servers/{server}/action request.  It contains
+// the ID of the flavor to which the server is to be resized.
+type ResizeServerRequest struct {
+	Resize struct {
+		FlavorRef string `json:"flavorRef"`
+	} `json:"resize"`
+}
+
+// GetConsoleOutputResponse represents the marshalled version of the response
+// to an os-getConsoleOutput /v2.1/{tenant}/servers/{server}/action request.
+// It contains the console output of the server.
+type GetConsoleOutputResponse struct {
+	Output string `json:"output"`
+}
+
+// FloatingIPDetails contains information about a specific floating IP.
+type FloatingIPDetails struct {
+	FixedIP    *string `json:"fixed_ip"`
+	ID         string  `json:"id"`
+	InstanceID *string `json:"instance_id"`
+	IP         string  `json:"ip"`
+	Pool       string  `json:"pool"`
+}
+
+// FloatingIP represents the unmarshalled version of the contents of a
+// /v2.1/{tenant}/os-floating-ips/{id} response.
+type FloatingIP struct {
+	FloatingIP FloatingIPDetails `json:"floating_ip"`
+}
+
+// FloatingIPs represents the unmarshalled version of the contents of a
+// /v2.1/{tenant}/os-floating-ips response.
+type FloatingIPs struct {
+	FloatingIPs []FloatingIPDetails `json:"floating_ips"`
+}
+
+// NewFloatingIPs allocates a FloatingIPs structure.
+// It allocates the FloatingIPs slice as well so that the marshalled
+// JSON is an empty array and not a nil.
+func NewFloatingIPs() (ips FloatingIPs) {
+	ips.FloatingIPs = []FloatingIPDetails{}
+	return
+}
+
+// CreateFloatingIPRequest represents the unmarshalled version of the contents
+// of a POST /v2.1/{tenant}/os-floating-ips request.  An empty pool means any
+// pool.
+type CreateFloatingIPRequest struct {
+	Pool string `json:"pool"`
+}
+
+// AddFloatingIPRequest represents the unmarshalled version of the contents
+// of an addFloatingIp /v2.1/{tenant}/servers/{server}/action request.
+type AddFloatingIPRequest struct {
+	AddFloatingIP struct {
+		Address      string `json:"address"`
+		FixedAddress string `json:"fixed_address,omitempty"`
+	} `json:"addFloatingIp"`
+}
+
+// RemoveFloatingIPRequest represents the unmarshalled version of the contents
+// of a removeFloatingIp /v2.1/{tenant}/servers/{server}/action request.
+type RemoveFloatingIPRequest struct {
+	RemoveFloatingIP struct {
+		Address string `json:"address"`
+	} `json:"removeFloatingIp"`
+}
+
+// FloatingIPPool contains the name of a floating IP pool.
+type FloatingIPPool struct {
+	Name string `json:"name"`
+}
+
+// FloatingIPPools represents the unmarshalled version of the contents of a
+// /v2.1/{tenant}/os-floating-ip-pools response.
+type FloatingIPPools struct {
+	FloatingIPPools []FloatingIPPool `json:"floating_ip_pools"`
+}
+
+// NewFloatingIPPools allocates a FloatingIPPools structure.
+// It allocates the FloatingIPPools slice as well so that the marshalled
+// JSON is an empty array and not a nil.
+func NewFloatingIPPools() (pools FloatingIPPools) {
+	pools.FloatingIPPools = []FloatingIPPool{}
+	return
+}
+
+// FloatingIPBulkDetails contains the administrative view of a floating IP.
+type FloatingIPBulkDetails struct {
+	Address      string  `json:"address"`
+	FixedIP      *string `json:"fixed_ip"`
+	InstanceUUID *string `json:"instance_uuid"`
+	Interface    string  `json:"interface"`
+	Pool         string  `json:"pool"`
+	ProjectID    *string `json:"project_id"`
+}
+
+// FloatingIPsBulk represents the unmarshalled version of the contents of a
+// /v2.1/os-floating-ips-bulk response.
+type FloatingIPsBulk struct {
+	FloatingIPInfo []FloatingIPBulkDetails `json:"floating_ip_info"`
+}
+
+// NewFloatingIPsBulk allocates a FloatingIPsBulk structure.
+// It allocates the FloatingIPInfo slice as well so that the marshalled
+// JSON is an empty array and not a nil.
+func NewFloatingIPsBulk() (ips FloatingIPsBulk) {
+	ips.FloatingIPInfo = []FloatingIPBulkDetails{}
+	return
+}
+
+// CreateFloatingIPsBulkRequest represents the unmarshalled version of the
+// contents of a POST /v2.1/os-floating-ips-bulk request.  IPRange is either
+// a single address or a CIDR range of addresses to add to the pool.  The
+// same structure is returned in the response.
+type CreateFloatingIPsBulkRequest struct {
+	FloatingIPsBulkCreate struct {
+		IPRange   string `json:"ip_range"`
+		Pool      string `json:"pool"`
+		Interface string `json:"interface,omitempty"`
+	} `json:"floating_ips_bulk_create"`
+}
+
+// DeleteFloatingIPsBulkRequest represents the unmarshalled version of the
+// contents of a PUT /v2.1/os-floating-ips-bulk/delete request.
+type DeleteFloatingIPsBulkRequest struct {
+	IPRange string `json:"ip_range"`
+}
+
+// DeleteFloatingIPsBulkResponse represents the marshalled version of the
+// response to a PUT /v2.1/os-floating-ips-bulk/delete request.
+type DeleteFloatingIPsBulkResponse struct {
+	FloatingIPsBulkDelete string `json:"floating_ips_bulk_delete"`
+}
+
+// QuotaSet contains the limits of a tenant.  A limit of -1 means that
+// the resource is unlimited.
+type QuotaSet struct {
+	ID        string `json:"id"`
+	Instances int    `json:"instances"`
+	Cores     int    `json:"cores"`
+	RAM       int    `json:"ram"`
+	Disk      int    `json:"disk"`
+}
+
+// QuotaSetResponse represents the marshalled version of the response to
+// a GET or PUT /v2.1/{tenant}/os-quota-sets/{tenant_id} request.
+type QuotaSetResponse struct {
+	QuotaSet QuotaSet `json:"quota_set"`
+}
+
+// QuotaDetail contains the limit and current usage of a single resource.
+type QuotaDetail struct {
+	InUse    int `json:"in_use"`
+	Limit    int `json:"limit"`
+	Reserved int `json:"reserved"`
+}
+
+// QuotaSetDetail contains the limits and usage of a tenant.
+type QuotaSetDetail struct {
+	ID        string      `json:"id"`
+	Instances QuotaDetail `json:"instances"`
+	Cores     QuotaDetail `json:"cores"`
+	RAM       QuotaDetail `json:"ram"`
+	Disk      QuotaDetail `json:"disk"`
+}
+
+// QuotaSetDetailResponse represents the marshalled version of the response
+// to a GET /v2.1/{tenant}/os-quota-sets/{tenant_id}/detail request.
+type QuotaSetDetailResponse struct {
+	QuotaSet QuotaSetDetail `json:"quota_set"`
+}
+
+// QuotaSetUpdate contains the limits to change for a tenant.  Limits
+// which are not present are left unchanged.
+type QuotaSetUpdate struct {
+	Instances *int `json:"instances,omitempty"`
+	Cores     *int `json:"cores,omitempty"`
+	RAM       *int `json:"ram,omitempty"`
+	Disk      *int `json:"disk,omitempty"`
+}
+
+// UpdateQuotaSetRequest represents the unmarshalled version of the contents
+// of a PUT /v2.1/{tenant}/os-quota-sets/{tenant_id} request.
+type UpdateQuotaSetRequest struct {
+	QuotaSet QuotaSetUpdate `json:"quota_set"`
+}
+
 // APIConfig contains information needed to start the compute api service.
 type APIConfig struct {
 	Port           int     // the https port of the compute api service
@@ -248,11 +485,35 @@ type Service interface {
 	DeleteServer(tenant string, server string) error
 	StartServer(tenant string, server string) error
 	StopServer(tenant string, server string) error
+	CreateServerImage(tenant string, server string, req CreateImageRequest) (CreateImageResponse, error)
+	GetServerConsoleOutput(tenant string, server string, req GetConsoleOutputRequest) (GetConsoleOutputResponse, error)
+	ResizeServer(tenant string, server string, req ResizeServerRequest) error
+	ConfirmResizeServer(tenant string, server string) error
+	RevertResizeServer(tenant string, server string) error
 
 	//flavor interfaces
 	ListFlavors(string) (Flavors, error)
 	ListFlavorsDetail(string) (FlavorsDetails, error)
 	ShowFlavorDetails(string, string) (Flavor, error)
+
+	// floating IP interfaces
+	ListFloatingIPs(tenant string) (FloatingIPs, error)
+	CreateFloatingIP(tenant string, req CreateFloatingIPRequest) (FloatingIP, error)
+	ShowFloatingIP(tenant string, ID string) (FloatingIP, error)
+	DeleteFloatingIP(tenant string, ID string) error
+	AddFloatingIP(tenant string, server string, req AddFloatingIPRequest) error
+	RemoveFloatingIP(tenant string, server string, req RemoveFloatingIPRequest) error
+	ListFloatingIPPools(tenant string) (FloatingIPPools, error)
+
+	// floating IP admin interfaces
+	ListFloatingIPsBulk() (FloatingIPsBulk, error)
+	CreateFloatingIPsBulk(req CreateFloatingIPsBulkRequest) (CreateFloatingIPsBulkRequest, error)
+	DeleteFloatingIPsBulk(req DeleteFloatingIPsBulkRequest) (DeleteFloatingIPsBulkResponse, error)
+
+	// quota interfaces
+	ShowQuotaSet(tenant string) (QuotaSetDetail, error)
+	UpdateQuotaSet(tenant string, req QuotaSetUpdate) (QuotaSetDetail, error)
+	DeleteQuotaSet(tenant string) error
 }
 
 type pagerFilterType uint8
@@ -386,6 +647,13 @@ const (
 	computeActionStart action = iota
 	computeActionStop
 	computeActionDelete
+	computeActionCreateImage
+	computeActionAddFloatingIP
+	computeActionRemoveFloatingIP
+	computeActionGetConsoleOutput
+	computeActionResize
+	computeActionConfirmResize
+	computeActionRevertResize
 )
 
 func dumpRequestBody(r *http.Request, body bool) {
@@ -604,8 +872,108 @@ func deleteServer(c *Context, w http.ResponseWriter, r *http.Request) (APIRespon
 	return APIResponse{http.StatusNoContent, nil}, nil
 }
 
+func createServerImage(c *Context, tenant string, server string, body []byte) (APIResponse, error) {
+	var req CreateImageRequest
+
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	if req.CreateImage.Name == "" {
+		return APIResponse{http.StatusBadRequest, nil},
+			errors.New("Missing image name")
+	}
+
+	resp, err := c.CreateServerImage(tenant, server, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, resp}, nil
+}
+
+func getServerConsoleOutput(c *Context, tenant string, server string, body []byte) (APIResponse, error) {
+	var req GetConsoleOutputRequest
+
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	resp, err := c.GetServerConsoleOutput(tenant, server, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+func resizeServer(c *Context, tenant string, server string, body []byte) (APIResponse, error) {
+	var req ResizeServerRequest
+
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	if req.Resize.FlavorRef == "" {
+		return APIResponse{http.StatusBadRequest, nil},
+			errors.New("Missing flavorRef")
+	}
+
+	err = c.ResizeServer(tenant, server, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, nil}, nil
+}
+
+func addFloatingIP(c *Context, tenant string, server string, body []byte) (APIResponse, error) {
+	var req AddFloatingIPRequest
+
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	if req.AddFloatingIP.Address == "" {
+		return APIResponse{http.StatusBadRequest, nil},
+			errors.New("Missing floating IP address")
+	}
+
+	err = c.AddFloatingIP(tenant, server, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, nil}, nil
+}
+
+func removeFloatingIP(c *Context, tenant string, server string, body []byte) (APIResponse, error) {
+	var req RemoveFloatingIPRequest
+
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	if req.RemoveFloatingIP.Address == "" {
+		return APIResponse{http.StatusBadRequest, nil},
+			errors.New("Missing floating IP address")
+	}
+
+	err = c.RemoveFloatingIP(tenant, server, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, nil}, nil
+}
+
 // @Title serverAction
-// @Description Runs the indicated action (os-start, os-stop) in the a server.
+// @Description Runs the indicated action (os-start, os-stop, createImage, os-getConsoleOutput, addFloatingIp, removeFloatingIp, resize, confirmResize, revertResize) in the a server.
 // @Accept  json
 // @Success 202 {object} string "This operation does not return a response body, returns the 202 StatusAccepted code."
 // @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
@@ -634,6 +1002,20 @@ func serverAction(c *Context, w http.ResponseWriter, r *http.Request) (APIRespon
 		action = computeActionStart
 	} else if strings.Contains(bodyString, "os-stop") {
 		action = computeActionStop
+	} else if strings.Contains(bodyString, "createImage") {
+		action = computeActionCreateImage
+	} else if strings.Contains(bodyString, "os-getConsoleOutput") {
+		action = computeActionGetConsoleOutput
+	} else if strings.Contains(bodyString, "addFloatingIp") {
+		action = computeActionAddFloatingIP
+	} else if strings.Contains(bodyString, "removeFloatingIp") {
+		action = computeActionRemoveFloatingIP
+	} else if strings.Contains(bodyString, "confirmResize") {
+		action = computeActionConfirmResize
+	} else if strings.Contains(bodyString, "revertResize") {
+		action = computeActionRevertResize
+	} else if strings.Contains(bodyString, "resize") {
+		action = computeActionResize
 	} else {
 		return APIResponse{http.StatusServiceUnavailable, nil},
 			errors.New("Unsupported Action")
@@ -644,6 +1026,20 @@ func serverAction(c *Context, w http.ResponseWriter, r *http.Request) (APIRespon
 		err = c.StartServer(tenant, server)
 	case computeActionStop:
 		err = c.StopServer(tenant, server)
+	case computeActionCreateImage:
+		return createServerImage(c, tenant, server, body)
+	case computeActionGetConsoleOutput:
+		return getServerConsoleOutput(c, tenant, server, body)
+	case computeActionAddFloatingIP:
+		return addFloatingIP(c, tenant, server, body)
+	case computeActionRemoveFloatingIP:
+		return removeFloatingIP(c, tenant, server, body)
+	case computeActionResize:
+		return resizeServer(c, tenant, server, body)
+	case computeActionConfirmResize:
+		err = c.ConfirmResizeServer(tenant, server)
+	case computeActionRevertResize:
+		err = c.RevertResizeServer(tenant, server)
 	}
 
 	if err != nil {
@@ -720,6 +1116,384 @@ func showFlavorDetails(c *Context, w http.ResponseWriter, r *http.Request) (APIR
 	return APIResponse{http.StatusOK, resp}, nil
 }
 
+// @Title listFloatingIPs
+// @Description Lists the floating IPs allocated to the tenant.
+// @Accept  json
+// @Success 200 {object} FloatingIPs "Returns the floating IPs of the tenant."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-floating-ips [get]
+// @Resource /v2.1/{tenant}/os-floating-ips
+func listFloatingIPs(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	resp, err := c.ListFloatingIPs(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// @Title createFloatingIP
+// @Description Allocates a floating IP to the tenant.
+// @Accept  json
+// @Success 200 {object} FloatingIP "Returns the allocated floating IP."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-floating-ips [post]
+// @Resource /v2.1/{tenant}/os-floating-ips
+func createFloatingIP(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req CreateFloatingIPRequest
+
+	// the request body is optional.
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			return APIResponse{http.StatusBadRequest, nil}, err
+		}
+	}
+
+	resp, err := c.CreateFloatingIP(tenant, req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// @Title showFloatingIP
+// @Description Shows details for a floating IP.
+// @Accept  json
+// @Success 200 {object} FloatingIP "Returns details for a floating IP."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-floating-ips/{id} [get]
+// @Resource /v2.1/{tenant}/os-floating-ips
+func showFloatingIP(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	ID := vars["id"]
+
+	DumpRequest(r)
+
+	resp, err := c.ShowFloatingIP(tenant, ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// @Title deleteFloatingIP
+// @Description Releases a floating IP back to its pool.
+// @Accept  json
+// @Success 202 {object} string "This operation does not return a response body, returns the 202 StatusAccepted code."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-floating-ips/{id} [delete]
+// @Resource /v2.1/{tenant}/os-floating-ips
+func deleteFloatingIP(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+	ID := vars["id"]
+
+	DumpRequest(r)
+
+	err := c.DeleteFloatingIP(tenant, ID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, nil}, nil
+}
+
+// @Title listFloatingIPPools
+// @Description Lists the floating IP pools.
+// @Accept  json
+// @Success 200 {object} FloatingIPPools "Returns the floating IP pools."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-floating-ip-pools [get]
+// @Resource /v2.1/{tenant}/os-floating-ip-pools
+func listFloatingIPPools(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	resp, err := c.ListFloatingIPPools(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// @Title listFloatingIPsBulk
+// @Description Lists all the floating IPs of all the pools.
+// @Accept  json
+// @Success 200 {object} FloatingIPsBulk "Returns all the floating IPs."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/os-floating-ips-bulk [get]
+// @Resource /v2.1/os-floating-ips-bulk
+func listFloatingIPsBulk(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	DumpRequest(r)
+
+	resp, err := c.ListFloatingIPsBulk()
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// @Title createFloatingIPsBulk
+// @Description Adds a range of floating IPs to a pool.
+// @Accept  json
+// @Success 200 {object} CreateFloatingIPsBulkRequest "Returns the range of floating IPs added."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/os-floating-ips-bulk [post]
+// @Resource /v2.1/os-floating-ips-bulk
+func createFloatingIPsBulk(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	DumpRequest(r)
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req CreateFloatingIPsBulkRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	if req.FloatingIPsBulkCreate.IPRange == "" {
+		return APIResponse{http.StatusBadRequest, nil},
+			errors.New("Missing IP range")
+	}
+
+	resp, err := c.CreateFloatingIPsBulk(req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// @Title deleteFloatingIPsBulk
+// @Description Removes a range of floating IPs from their pool.
+// @Accept  json
+// @Success 200 {object} DeleteFloatingIPsBulkResponse "Returns the range of floating IPs removed."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/os-floating-ips-bulk/delete [put]
+// @Resource /v2.1/os-floating-ips-bulk
+func deleteFloatingIPsBulk(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	DumpRequest(r)
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req DeleteFloatingIPsBulkRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	if req.IPRange == "" {
+		return APIResponse{http.StatusBadRequest, nil},
+			errors.New("Missing IP range")
+	}
+
+	resp, err := c.DeleteFloatingIPsBulk(req)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+func quotaSetLimits(detail QuotaSetDetail) QuotaSet {
+	return QuotaSet{
+		ID:        detail.ID,
+		Instances: detail.Instances.Limit,
+		Cores:     detail.Cores.Limit,
+		RAM:       detail.RAM.Limit,
+		Disk:      detail.Disk.Limit,
+	}
+}
+
+// @Title showQuotaSet
+// @Description Shows the quotas of a tenant.
+// @Accept  json
+// @Success 200 {object} QuotaSetResponse "Returns the quotas of the tenant."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-quota-sets/{tenant_id} [get]
+// @Resource /v2.1/{tenant}/os-quota-sets
+func showQuotaSet(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	resp, err := c.ShowQuotaSet(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, QuotaSetResponse{quotaSetLimits(resp)}}, nil
+}
+
+// @Title showQuotaSetDetail
+// @Description Shows the quotas of a tenant along with their usage.
+// @Accept  json
+// @Success 200 {object} QuotaSetDetailResponse "Returns the quotas and usage of the tenant."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-quota-sets/{tenant_id}/detail [get]
+// @Resource /v2.1/{tenant}/os-quota-sets
+func showQuotaSetDetail(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	resp, err := c.ShowQuotaSet(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, QuotaSetDetailResponse{resp}}, nil
+}
+
+// @Title showQuotaSetDefaults
+// @Description Shows the default quotas of a tenant.
+// @Accept  json
+// @Success 200 {object} QuotaSetResponse "Returns the default quotas."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-quota-sets/{tenant_id}/defaults [get]
+// @Resource /v2.1/{tenant}/os-quota-sets
+func showQuotaSetDefaults(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant"]
+
+	DumpRequest(r)
+
+	// tenants are unlimited unless an administrator says otherwise
+	resp := QuotaSet{
+		ID:        tenant,
+		Instances: -1,
+		Cores:     -1,
+		RAM:       -1,
+		Disk:      -1,
+	}
+
+	return APIResponse{http.StatusOK, QuotaSetResponse{resp}}, nil
+}
+
+// @Title updateQuotaSet
+// @Description Updates the quotas of a tenant.
+// @Accept  json
+// @Success 200 {object} QuotaSetResponse "Returns the updated quotas of the tenant."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-quota-sets/{tenant_id} [put]
+// @Resource /v2.1/{tenant}/os-quota-sets
+func updateQuotaSet(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant_id"]
+
+	if !identity.GetIdentity(r).Admin {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	DumpRequest(r)
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req UpdateQuotaSetRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	q := req.QuotaSet
+	for _, limit := range []*int{q.Instances, q.Cores, q.RAM, q.Disk} {
+		if limit != nil && *limit < -1 {
+			return APIResponse{http.StatusBadRequest, nil},
+				fmt.Errorf("Invalid quota %d", *limit)
+		}
+	}
+
+	resp, err := c.UpdateQuotaSet(tenant, q)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, QuotaSetResponse{quotaSetLimits(resp)}}, nil
+}
+
+// @Title deleteQuotaSet
+// @Description Resets the quotas of a tenant to their defaults.
+// @Accept  json
+// @Success 202 {object} string "This operation does not return a response body, returns the 202 StatusAccepted code."
+// @Failure 400 {object} HTTPReturnErrorCode "The response contains the corresponding message and 40x corresponding code."
+// @Failure 500 {object} HTTPReturnErrorCode "The response contains the corresponding message and 50x corresponding code."
+// @Router /v2.1/{tenant}/os-quota-sets/{tenant_id} [delete]
+// @Resource /v2.1/{tenant}/os-quota-sets
+func deleteQuotaSet(c *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	tenant := vars["tenant_id"]
+
+	if !identity.GetIdentity(r).Admin {
+		return errorResponse(ErrNotAdmin), ErrNotAdmin
+	}
+
+	DumpRequest(r)
+
+	err := c.DeleteQuotaSet(tenant)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusAccepted, nil}, nil
+}
+
 // Routes returns a gorilla mux router for the compute endpoints.
 func Routes(config APIConfig) *mux.Router {
 	context := &Context{config.Port, config.ComputeService}
@@ -746,5 +1520,42 @@ func Routes(config APIConfig) *mux.Router {
 	r.Handle("/v2.1/{tenant}/flavors/{flavor}",
 		APIHandler{context, showFlavorDetails}).Methods("GET")
 
+	// floating IP related endpoints
+	r.Handle("/v2.1/{tenant}/os-floating-ips",
+		APIHandler{context, listFloatingIPs}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/os-floating-ips",
+		APIHandler{context, createFloatingIP}).Methods("POST")
+	r.Handle("/v2.1/{tenant}/os-floating-ips/{id}",
+		APIHandler{context, showFloatingIP}).Methods("GET")
+	r.Handle("/v2.1/{tenant}/os-floating-ips/{id}",
+		APIHandler{context, deleteFloatingIP}).Methods("DELETE")
+	r.Handle("/v2.1/{tenant}/os-floating-ip-pools",
+		APIHandler{context, listFloatingIPPools}).Methods("GET")
+
+	// floating IP admin endpoints, these have no tenant and thus
+	// require an admin token.
+	r.Handle("/v2.1/os-floating-ips-bulk",
+		APIHandler{context, listFloatingIPsBulk}).Methods("GET")
+	r.Handle("/v2.1/os-floating-ips-bulk",
+		APIHandler{context, createFloatingIPsBulk}).Methods("POST")
+	r.Handle("/v2.1/os-floating-ips-bulk/delete",
+		APIHandler{context, deleteFloatingIPsBulk}).Methods("PUT")
+
+	// quota endpoints.  The token must belong to the tenant whose quotas
+	// are read, so the target tenant is the tenant variable here.
+	r.Handle("/v2.1/{project}/os-quota-sets/{tenant}",
+		APIHandler{context, showQuotaSet}).Methods("GET")
+	r.Handle("/v2.1/{project}/os-quota-sets/{tenant}/detail",
+		APIHandler{context, showQuotaSetDetail}).Methods("GET")
+	r.Handle("/v2.1/{project}/os-quota-sets/{tenant}/defaults",
+		APIHandler{context, showQuotaSetDefaults}).Methods("GET")
+
+	// quota admin endpoints, these have no tenant variable and thus
+	// require an admin token.  The handlers check for admin rights too.
+	r.Handle("/v2.1/{project}/os-quota-sets/{tenant_id}",
+		APIHandler{context, updateQuotaSet}).Methods("PUT")
+	r.Handle("/v2.1/{project}/os-quota-sets/{tenant_id}",
+		APIHandler{context, deleteQuotaSet}).Methods("DELETE")
+
 	return r
 }
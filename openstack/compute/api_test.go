@@ -20,6 +20,8 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+
+	"github.com/01org/ciao/openstack/identity"
 )
 
 type test struct {
@@ -93,6 +95,62 @@ var tests = []test{
 		http.StatusAccepted,
 		"null",
 	},
+	{
+		"POST",
+		"/v2.1/{tenant}/servers/{server}/action",
+		serverAction,
+		`{"createImage":{"name":"golden-image","metadata":{"version":"1"}}}`,
+		http.StatusAccepted,
+		`{"image_id":"validImageID"}`,
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/servers/{server}/action",
+		serverAction,
+		`{"createImage":{"metadata":{"version":"1"}}}`,
+		http.StatusBadRequest,
+		`{"error":{"code":400,"name":"Bad Request","message":"Missing image name"}}` + "\nnull",
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/servers/{server}/action",
+		serverAction,
+		`{"os-getConsoleOutput":{"length":50}}`,
+		http.StatusOK,
+		`{"output":"ciao login:"}`,
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/servers/{server}/action",
+		serverAction,
+		`{"resize":{"flavorRef":"flavorUUID"}}`,
+		http.StatusAccepted,
+		"null",
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/servers/{server}/action",
+		serverAction,
+		`{"resize":{}}`,
+		http.StatusBadRequest,
+		`{"error":{"code":400,"name":"Bad Request","message":"Missing flavorRef"}}` + "\nnull",
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/servers/{server}/action",
+		serverAction,
+		`{"confirmResize":null}`,
+		http.StatusAccepted,
+		"null",
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/servers/{server}/action",
+		serverAction,
+		`{"revertResize":null}`,
+		http.StatusAccepted,
+		"null",
+	},
 	{
 		"GET",
 		"/v2.1/{tenant}/flavors/",
@@ -117,6 +175,166 @@ var tests = []test{
 		http.StatusOK,
 		`{"flavor":{"OS-FLV-DISABLED:disabled":false,"disk":"imageUUID","OS-FLV-EXT-DATA:ephemeral":0,"os-flavor-access:is_public":true,"id":"workloadUUID","links":null,"name":"testflavor","ram":256,"swap":"","vcpus":2}}`,
 	},
+	{
+		"GET",
+		"/v2.1/{tenant}/os-floating-ips",
+		listFloatingIPs,
+		"",
+		http.StatusOK,
+		`{"floating_ips":[{"fixed_ip":"192.169.0.1","id":"floatingIPUUID","instance_id":"testUUID","ip":"203.0.113.1","pool":"public"}]}`,
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/os-floating-ips",
+		createFloatingIP,
+		`{"pool":"public"}`,
+		http.StatusOK,
+		`{"floating_ip":{"fixed_ip":null,"id":"floatingIPUUID","instance_id":null,"ip":"203.0.113.1","pool":"public"}}`,
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/os-floating-ips",
+		createFloatingIP,
+		`{"pool":"empty"}`,
+		http.StatusNotFound,
+		`{"error":{"code":404,"name":"Not Found","message":"No more floating IPs available"}}` + "\nnull",
+	},
+	{
+		"GET",
+		"/v2.1/{tenant}/os-floating-ips/{id}",
+		showFloatingIP,
+		"",
+		http.StatusOK,
+		`{"floating_ip":{"fixed_ip":null,"id":"","instance_id":null,"ip":"203.0.113.1","pool":"public"}}`,
+	},
+	{
+		"DELETE",
+		"/v2.1/{tenant}/os-floating-ips/{id}",
+		deleteFloatingIP,
+		"",
+		http.StatusAccepted,
+		"null",
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/servers/{server}/action",
+		serverAction,
+		`{"addFloatingIp":{"address":"203.0.113.1"}}`,
+		http.StatusAccepted,
+		"null",
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/servers/{server}/action",
+		serverAction,
+		`{"addFloatingIp":{}}`,
+		http.StatusBadRequest,
+		`{"error":{"code":400,"name":"Bad Request","message":"Missing floating IP address"}}` + "\nnull",
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/servers/{server}/action",
+		serverAction,
+		`{"removeFloatingIp":{"address":"203.0.113.1"}}`,
+		http.StatusAccepted,
+		"null",
+	},
+	{
+		"POST",
+		"/v2.1/{tenant}/servers/{server}/action",
+		serverAction,
+		`{"removeFloatingIp":{"address":"203.0.113.2"}}`,
+		http.StatusConflict,
+		`{"error":{"code":409,"name":"Conflict","message":"Floating IP not associated to the server"}}` + "\nnull",
+	},
+	{
+		"GET",
+		"/v2.1/{tenant}/os-floating-ip-pools",
+		listFloatingIPPools,
+		"",
+		http.StatusOK,
+		`{"floating_ip_pools":[{"name":"public"}]}`,
+	},
+	{
+		"GET",
+		"/v2.1/os-floating-ips-bulk",
+		listFloatingIPsBulk,
+		"",
+		http.StatusOK,
+		`{"floating_ip_info":[{"address":"203.0.113.1","fixed_ip":null,"instance_uuid":null,"interface":"","pool":"public","project_id":null}]}`,
+	},
+	{
+		"POST",
+		"/v2.1/os-floating-ips-bulk",
+		createFloatingIPsBulk,
+		`{"floating_ips_bulk_create":{"ip_range":"203.0.113.0/30","pool":"public"}}`,
+		http.StatusOK,
+		`{"floating_ips_bulk_create":{"ip_range":"203.0.113.0/30","pool":"public"}}`,
+	},
+	{
+		"POST",
+		"/v2.1/os-floating-ips-bulk",
+		createFloatingIPsBulk,
+		`{"floating_ips_bulk_create":{"pool":"public"}}`,
+		http.StatusBadRequest,
+		`{"error":{"code":400,"name":"Bad Request","message":"Missing IP range"}}` + "\nnull",
+	},
+	{
+		"PUT",
+		"/v2.1/os-floating-ips-bulk/delete",
+		deleteFloatingIPsBulk,
+		`{"ip_range":"203.0.113.0/30"}`,
+		http.StatusOK,
+		`{"floating_ips_bulk_delete":"203.0.113.0/30"}`,
+	},
+	{
+		"GET",
+		"/v2.1/{tenant}/os-quota-sets/{tenant}",
+		showQuotaSet,
+		"",
+		http.StatusOK,
+		`{"quota_set":{"id":"","instances":10,"cores":-1,"ram":-1,"disk":-1}}`,
+	},
+	{
+		"GET",
+		"/v2.1/{tenant}/os-quota-sets/{tenant}/detail",
+		showQuotaSetDetail,
+		"",
+		http.StatusOK,
+		`{"quota_set":{"id":"","instances":{"in_use":1,"limit":10,"reserved":0},"cores":{"in_use":2,"limit":-1,"reserved":0},"ram":{"in_use":256,"limit":-1,"reserved":0},"disk":{"in_use":0,"limit":-1,"reserved":0}}}`,
+	},
+	{
+		"GET",
+		"/v2.1/{tenant}/os-quota-sets/{tenant}/defaults",
+		showQuotaSetDefaults,
+		"",
+		http.StatusOK,
+		`{"quota_set":{"id":"","instances":-1,"cores":-1,"ram":-1,"disk":-1}}`,
+	},
+	{
+		"PUT",
+		"/v2.1/{tenant}/os-quota-sets/{tenant_id}",
+		updateQuotaSet,
+		`{"quota_set":{"cores":4}}`,
+		http.StatusOK,
+		`{"quota_set":{"id":"","instances":10,"cores":4,"ram":-1,"disk":-1}}`,
+	},
+	{
+		"PUT",
+		"/v2.1/{tenant}/os-quota-sets/{tenant_id}",
+		updateQuotaSet,
+		`{"quota_set":{"ram":-2}}`,
+		http.StatusBadRequest,
+		`{"error":{"code":400,"name":"Bad Request","message":"Invalid quota -2"}}` + "\nnull",
+	},
+	{
+		"DELETE",
+		"/v2.1/{tenant}/os-quota-sets/{tenant_id}",
+		deleteQuotaSet,
+		"",
+		http.StatusAccepted,
+		"null",
+	},
 }
 
 type testComputeService struct{}
@@ -193,6 +411,26 @@ func (cs testComputeService) StopServer(tenant string, server string) error {
 	return nil
 }
 
+func (cs testComputeService) CreateServerImage(tenant string, server string, req CreateImageRequest) (CreateImageResponse, error) {
+	return CreateImageResponse{ImageID: "validImageID"}, nil
+}
+
+func (cs testComputeService) GetServerConsoleOutput(tenant string, server string, req GetConsoleOutputRequest) (GetConsoleOutputResponse, error) {
+	return GetConsoleOutputResponse{Output: "ciao login:"}, nil
+}
+
+func (cs testComputeService) ResizeServer(tenant string, server string, req ResizeServerRequest) error {
+	return nil
+}
+
+func (cs testComputeService) ConfirmResizeServer(tenant string, server string) error {
+	return nil
+}
+
+func (cs testComputeService) RevertResizeServer(tenant string, server string) error {
+	return nil
+}
+
 //flavor interfaces
 func (cs testComputeService) ListFlavors(string) (Flavors, error) {
 	flavors := NewComputeFlavors()
@@ -243,6 +481,113 @@ func (cs testComputeService) ShowFlavorDetails(string, string) (Flavor, error) {
 	return flavor, nil
 }
 
+// floating IP interfaces
+func (cs testComputeService) ListFloatingIPs(tenant string) (FloatingIPs, error) {
+	fixedIP := "192.169.0.1"
+	instanceID := "testUUID"
+
+	ips := NewFloatingIPs()
+	ips.FloatingIPs = append(ips.FloatingIPs, FloatingIPDetails{
+		FixedIP:    &fixedIP,
+		ID:         "floatingIPUUID",
+		InstanceID: &instanceID,
+		IP:         "203.0.113.1",
+		Pool:       "public",
+	})
+
+	return ips, nil
+}
+
+func (cs testComputeService) CreateFloatingIP(tenant string, req CreateFloatingIPRequest) (FloatingIP, error) {
+	if req.Pool != "public" {
+		return FloatingIP{}, ErrNoFreeFloatingIP
+	}
+
+	ip := FloatingIPDetails{
+		ID:   "floatingIPUUID",
+		IP:   "203.0.113.1",
+		Pool: req.Pool,
+	}
+
+	return FloatingIP{FloatingIP: ip}, nil
+}
+
+func (cs testComputeService) ShowFloatingIP(tenant string, ID string) (FloatingIP, error) {
+	ip := FloatingIPDetails{
+		ID:   ID,
+		IP:   "203.0.113.1",
+		Pool: "public",
+	}
+
+	return FloatingIP{FloatingIP: ip}, nil
+}
+
+func (cs testComputeService) DeleteFloatingIP(tenant string, ID string) error {
+	return nil
+}
+
+func (cs testComputeService) AddFloatingIP(tenant string, server string, req AddFloatingIPRequest) error {
+	return nil
+}
+
+func (cs testComputeService) RemoveFloatingIP(tenant string, server string, req RemoveFloatingIPRequest) error {
+	if req.RemoveFloatingIP.Address != "203.0.113.1" {
+		return ErrFloatingIPNotMapped
+	}
+
+	return nil
+}
+
+func (cs testComputeService) ListFloatingIPPools(tenant string) (FloatingIPPools, error) {
+	pools := NewFloatingIPPools()
+	pools.FloatingIPPools = append(pools.FloatingIPPools, FloatingIPPool{Name: "public"})
+
+	return pools, nil
+}
+
+func (cs testComputeService) ListFloatingIPsBulk() (FloatingIPsBulk, error) {
+	ips := NewFloatingIPsBulk()
+	ips.FloatingIPInfo = append(ips.FloatingIPInfo, FloatingIPBulkDetails{
+		Address: "203.0.113.1",
+		Pool:    "public",
+	})
+
+	return ips, nil
+}
+
+func (cs testComputeService) CreateFloatingIPsBulk(req CreateFloatingIPsBulkRequest) (CreateFloatingIPsBulkRequest, error) {
+	return req, nil
+}
+
+func (cs testComputeService) DeleteFloatingIPsBulk(req DeleteFloatingIPsBulkRequest) (DeleteFloatingIPsBulkResponse, error) {
+	return DeleteFloatingIPsBulkResponse{FloatingIPsBulkDelete: req.IPRange}, nil
+}
+
+// quota interfaces
+func (cs testComputeService) ShowQuotaSet(tenant string) (QuotaSetDetail, error) {
+	return QuotaSetDetail{
+		ID:        tenant,
+		Instances: QuotaDetail{InUse: 1, Limit: 10},
+		Cores:     QuotaDetail{InUse: 2, Limit: -1},
+		RAM:       QuotaDetail{InUse: 256, Limit: -1},
+		Disk:      QuotaDetail{Limit: -1},
+	}, nil
+}
+
+func (cs testComputeService) UpdateQuotaSet(tenant string, req QuotaSetUpdate) (QuotaSetDetail, error) {
+	q, _ := cs.ShowQuotaSet(tenant)
+
+	if req.Cores != nil {
+		q.Cores.Limit = *req.Cores
+	}
+
+	return q, nil
+}
+
+func (cs testComputeService) DeleteQuotaSet(tenant string) error {
+	return nil
+}
+
 func TestAPIResponse(t *testing.T) {
 	var cs testComputeService
 
@@ -257,6 +602,8 @@ func TestAPIResponse(t *testing.T) {
 			t.Fatal(err)
 		}
 
+		req = identity.WithIdentity(req, identity.Identity{Admin: true})
+
 		rr := httptest.NewRecorder()
 		handler := APIHandler{context, tt.handler}
 
@@ -273,6 +620,39 @@ func TestAPIResponse(t *testing.T) {
 	}
 }
 
+func TestQuotaSetNotAdmin(t *testing.T) {
+	var cs testComputeService
+
+	context := &Context{8774, cs}
+
+	quotaTests := []struct {
+		method  string
+		handler func(*Context, http.ResponseWriter, *http.Request) (APIResponse, error)
+		request string
+	}{
+		{"PUT", updateQuotaSet, `{"quota_set":{"cores":4}}`},
+		{"DELETE", deleteQuotaSet, ""},
+	}
+
+	for _, tt := range quotaTests {
+		req, err := http.NewRequest(tt.method, "/v2.1/validtenantid/os-quota-sets/othertenantid", bytes.NewBuffer([]byte(tt.request)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req = identity.WithIdentity(req, identity.Identity{ProjectID: "validtenantid"})
+
+		rr := httptest.NewRecorder()
+		handler := APIHandler{context, tt.handler}
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("%s: got %v, expected %v", tt.method, rr.Code, http.StatusForbidden)
+		}
+	}
+}
+
 func TestRoutes(t *testing.T) {
 	var cs testComputeService
 	config := APIConfig{8774, cs}
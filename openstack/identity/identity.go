@@ -18,6 +18,7 @@ import (
 	"net/http"
 
 	"github.com/golang/glog"
+	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 	"github.com/mitchellh/mapstructure"
 	"github.com/rackspace/gophercloud"
@@ -248,7 +249,10 @@ func (h Handler) adminToken(r *http.Request) bool {
 	return false
 }
 
-func (h Handler) validateToken(r *http.Request) bool {
+// validateToken validates the token of a request and returns the identity
+// of its owner.  Admin rights are only checked for when the route has no
+// tenant variable or when the token does not belong to the tenant.
+func (h Handler) validateToken(r *http.Request) (Identity, bool) {
 	vars := mux.Vars(r)
 	tenant := vars["tenant"]
 
@@ -261,15 +265,15 @@ func (h Handler) validateToken(r *http.Request) bool {
 
 	/* If we don't have a tenant parameter, are we admin ? */
 	if tenant == "" {
-		return h.adminToken(r)
+		return Identity{Admin: true}, h.adminToken(r)
 	}
 
 	/* If we have a tenant parameter that does not match the token are we admin ? */
 	if h.tenantToken(r, tenant) == false {
-		return h.adminToken(r)
+		return Identity{Admin: true}, h.adminToken(r)
 	}
 
-	return true
+	return Identity{ProjectID: tenant}, true
 }
 
 // ValidService defines service name and type of the api service
@@ -284,6 +288,65 @@ type ValidAdmin struct {
 	Role    string
 }
 
+// Identity is the keystone identity of the caller of an API.
+type Identity struct {
+	// ProjectID is the UUID of the project the caller's token is scoped to.
+	ProjectID string
+
+	// Admin is true if the caller's token has one of the admin roles.
+	Admin bool
+}
+
+type identityKey struct{}
+
+// GetIdentity returns the identity of the caller of an API, as validated
+// by a Handler.  Handlers which are not ProjectScoped only set the project
+// of callers using a token of the tenant of the route, and only check for
+// admin rights for the other callers.  The zero Identity, which has neither
+// a project nor admin rights, is returned for requests that were not
+// validated by a Handler.
+func GetIdentity(r *http.Request) Identity {
+	id, _ := context.Get(r, identityKey{}).(Identity)
+	return id
+}
+
+// WithIdentity returns r carrying id as the identity of the caller of an
+// API, for handlers which authenticate requests without keystone.  The
+// identity is stored in the request context of gorilla, along with the
+// route variables, rather than in a copy of r which would lose them.  It is
+// cleared with them once the mux router has served the request.
+func WithIdentity(r *http.Request, id Identity) *http.Request {
+	context.Set(r, identityKey{}, id)
+	return r
+}
+
+// projectIdentity validates that the project a token is scoped to has
+// access to the service, or that the token is an admin token, and returns
+// the identity of the token's owner.
+func (h Handler) projectIdentity(r *http.Request) (Identity, bool) {
+	token := r.Header["X-Auth-Token"]
+	if token == nil {
+		return Identity{}, false
+	}
+
+	result := getResult{v3tokens.Get(h.Client, token[0])}
+	p, err := result.extractProject()
+	if err != nil {
+		return Identity{}, false
+	}
+
+	id := Identity{
+		ProjectID: p.ID,
+		Admin:     h.adminToken(r),
+	}
+
+	if id.Admin == false && h.tenantToken(r, p.ID) == false {
+		return Identity{}, false
+	}
+
+	return id, true
+}
+
 // Handler is a custom handler for APIs which would like keystone validation.
 // This custom handler allows us to more cleanly return an error and response,
 // and pass some package level context into the handler.
@@ -292,15 +355,34 @@ type Handler struct {
 	Next          http.Handler
 	ValidServices []ValidService
 	ValidAdmins   []ValidAdmin
+
+	// ProjectScoped handlers serve APIs which routes have no tenant
+	// variable.  Instead of requiring an admin token, they accept the
+	// token of any project that can access one of the ValidServices, and
+	// pass the identity of the caller to the next handler, see GetIdentity.
+	ProjectScoped bool
 }
 
 // ServeHTTP satisfies the http handler interface.
 // It will check to make sure that the api caller is validated with
 // keystone before allowing the next handler in the chain to be called.
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if h.validateToken(r) == false {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return
+	if h.ProjectScoped {
+		id, ok := h.projectIdentity(r)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		r = WithIdentity(r, id)
+	} else {
+		id, ok := h.validateToken(r)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		r = WithIdentity(r, id)
 	}
 
 	h.Next.ServeHTTP(w, r)
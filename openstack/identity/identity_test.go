@@ -198,3 +198,149 @@ func TestHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestHandlerIdentity(t *testing.T) {
+	testIdentityConfig := testutil.IdentityConfig{
+		ComputeURL: testutil.ComputeURL,
+		ProjectID:  testutil.ComputeUser,
+	}
+
+	id := testutil.StartIdentityServer(testIdentityConfig)
+	if id == nil {
+		t.Fatal("Could not start test identity server")
+	}
+
+	defer id.Close()
+
+	client, err := getIdentityClient(id.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		URL              string
+		route            string
+		expectedIdentity Identity
+	}{
+		{fmt.Sprintf("/v2/%s/volumes", testutil.ComputeUser), "/v2/{tenant}/volumes", Identity{testutil.ComputeUser, false}},
+		{"/v2/othertenantid/volumes", "/v2/{tenant}/volumes", Identity{"", true}},
+		{"/v2.1/tenants", "/v2.1/tenants", Identity{"", true}},
+	}
+
+	for _, tt := range tests {
+		var caller Identity
+
+		testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			caller = GetIdentity(r)
+		})
+
+		h := Handler{
+			Client:        client,
+			Next:          &testHandler,
+			ValidServices: validServices,
+			ValidAdmins:   validAdmins,
+		}
+
+		req, err := http.NewRequest("GET", tt.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Auth-Token", "imaninvalidtoken")
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+
+		r.Handle(tt.route, h).Methods("GET")
+
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: got %v: expected %v", tt.URL, rr.Code, http.StatusOK)
+		}
+
+		if caller != tt.expectedIdentity {
+			t.Errorf("%s: got identity %+v: expected %+v", tt.URL, caller, tt.expectedIdentity)
+		}
+	}
+}
+
+func TestProjectScopedHandler(t *testing.T) {
+	testIdentityConfig := testutil.IdentityConfig{
+		ComputeURL: testutil.ComputeURL,
+		ProjectID:  testutil.ComputeUser,
+	}
+
+	id := testutil.StartIdentityServer(testIdentityConfig)
+	if id == nil {
+		t.Fatal("Could not start test identity server")
+	}
+
+	defer id.Close()
+
+	client, err := getIdentityClient(id.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		validServices    []ValidService
+		validAdmins      []ValidAdmin
+		token            string
+		expectedResponse int
+		expectedIdentity Identity
+	}{
+		{validServices, validAdmins, "imaninvalidtoken", 200, Identity{testutil.ComputeUser, true}},
+		{validServices, invalidAdmins, "imaninvalidtoken", 200, Identity{testutil.ComputeUser, false}},
+		{invalidServices, validAdmins, "imaninvalidtoken", 200, Identity{testutil.ComputeUser, true}},
+		{invalidServices, invalidAdmins, "imaninvalidtoken", 401, Identity{}},
+		{validServices, validAdmins, "", 401, Identity{}},
+	}
+
+	for _, tt := range tests {
+		var caller Identity
+		var imageID string
+
+		testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			caller = GetIdentity(r)
+			imageID = mux.Vars(r)["image_id"]
+		})
+
+		h := Handler{
+			Client:        client,
+			Next:          &testHandler,
+			ValidServices: tt.validServices,
+			ValidAdmins:   tt.validAdmins,
+			ProjectScoped: true,
+		}
+
+		req, err := http.NewRequest("GET", "/v2/images/imageid", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.token != "" {
+			req.Header.Set("X-Auth-Token", tt.token)
+		}
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+
+		r.Handle("/v2/images/{image_id}", h).Methods("GET")
+
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expectedResponse {
+			t.Errorf("got %v: expected %v", rr.Code, tt.expectedResponse)
+		}
+
+		if caller != tt.expectedIdentity {
+			t.Errorf("got identity %+v: expected %+v", caller, tt.expectedIdentity)
+		}
+
+		// the route variables must survive the identity being attached
+		if rr.Code == http.StatusOK && imageID != "imageid" {
+			t.Errorf("got image %q: expected %q", imageID, "imageid")
+		}
+	}
+}
@@ -22,8 +22,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/01org/ciao/openstack/identity"
 	"github.com/gorilla/mux"
 )
 
@@ -108,6 +111,26 @@ const (
 
 	// Private indicates that the image is only available to a tenant.
 	Private Visibility = "private"
+
+	// Shared indicates that the image is available to its owner and to
+	// the tenants it is shared with.
+	Shared Visibility = "shared"
+)
+
+// MemberStatus defines the status of a tenant an image is shared with.
+type MemberStatus string
+
+const (
+	// MemberPending means that the member did not yet accept or
+	// reject the image.
+	MemberPending MemberStatus = "pending"
+
+	// MemberAccepted means that the member accepted the image, which
+	// is listed with the member's images.
+	MemberAccepted MemberStatus = "accepted"
+
+	// MemberRejected means that the member rejected the image.
+	MemberRejected MemberStatus = "rejected"
 )
 
 // ContainerFormat defines the acceptable container format strings.
@@ -133,6 +156,21 @@ const (
 	ISO DiskFormat = "iso"
 )
 
+// TokenScope defines what an image token can be used for.
+type TokenScope string
+
+const (
+	// UploadScope tokens allow the data of an image to be uploaded.
+	UploadScope TokenScope = "upload"
+
+	// DownloadScope tokens allow an image and its data to be retrieved.
+	DownloadScope TokenScope = "download"
+)
+
+// TokenHeader is the header in which image tokens are presented to the
+// image service, instead of a keystone token.
+const TokenHeader = "X-Image-Token"
+
 // ErrorImage defines all possible image handling errors
 type ErrorImage error
 
@@ -143,12 +181,52 @@ var (
 	// ErrImageSaving is returned when an image is being uploaded.
 	ErrImageSaving = errors.New("Image being uploaded")
 
+	// ErrImageActive is returned when uploading data to an image
+	// which data has already been uploaded.
+	ErrImageActive = errors.New("Image data already uploaded")
+
 	// ErrBadUUID is returned when an invalid UUID is specified
 	ErrBadUUID = errors.New("Bad UUID")
 
 	// ErrAlreadyExists is returned when an attempt is made to add
 	// an image with a UUID that already exists.
 	ErrAlreadyExists = errors.New("Already Exists")
+
+	// ErrNoImageData is returned when downloading an image which
+	// data has not been uploaded yet.
+	ErrNoImageData = errors.New("Image has no data")
+
+	// ErrBadPatch is returned when an image update request contains
+	// an invalid operation, path or value.
+	ErrBadPatch = errors.New("Invalid image update")
+
+	// ErrBadProperty is returned when an image creation request
+	// contains an invalid attribute or custom property.
+	ErrBadProperty = errors.New("Invalid image property")
+
+	// ErrReadOnly is returned when an image update request attempts
+	// to modify an attribute that is managed by the image service.
+	ErrReadOnly = errors.New("Attribute is read-only")
+
+	// ErrImageProtected is returned when an attempt is made to delete
+	// a protected image.
+	ErrImageProtected = errors.New("Image is protected")
+
+	// ErrForbidden is returned when the caller is not allowed to
+	// perform an operation on an image, e.g. when a tenant attempts
+	// to modify an image it does not own.
+	ErrForbidden = errors.New("Forbidden")
+
+	// ErrNoMember is returned when an image is not shared with a tenant.
+	ErrNoMember = errors.New("Image member not found")
+
+	// ErrBadRange is returned when the range requested by an image
+	// download cannot be satisfied.
+	ErrBadRange = errors.New("Requested range not satisfiable")
+
+	// ErrBadImageData is returned when uploaded image data does not
+	// match the disk format of the image.
+	ErrBadImageData = errors.New("Image data does not match the image disk format")
 )
 
 // CreateImageRequest contains information for a create image request.
@@ -164,6 +242,10 @@ type CreateImageRequest struct {
 	MinRAM          int             `json:"min_ram,omitempty"`
 	Protected       bool            `json:"protected,omitempty"`
 	Properties      interface{}     `json:"properties,omitempty"`
+
+	// Owner is the tenant owning the image.  Only admins can create
+	// images owned by another tenant.
+	Owner string `json:"owner,omitempty"`
 }
 
 // DefaultResponse contains information about an image
@@ -183,6 +265,8 @@ type DefaultResponse struct {
 	VirtualSize     *int             `json:"virtual_size"`
 	Name            *string          `json:"name"`
 	CheckSum        *string          `json:"checksum"`
+	HashAlgo        *string          `json:"os_hash_algo"`
+	HashValue       *string          `json:"os_hash_value"`
 	CreatedAt       time.Time        `json:"created_at"`
 	DiskFormat      DiskFormat       `json:"disk_format"`
 	Properties      interface{}      `json:"properties"`
@@ -200,6 +284,63 @@ type ListImagesResponse struct {
 	First  string            `json:"first"`
 }
 
+// PatchOp is the type of an image update operation.
+type PatchOp string
+
+const (
+	// PatchAdd adds an attribute, or replaces its value if it exists.
+	PatchAdd PatchOp = "add"
+
+	// PatchReplace replaces the value of an existing attribute.
+	PatchReplace PatchOp = "replace"
+
+	// PatchRemove removes an attribute.
+	PatchRemove PatchOp = "remove"
+)
+
+// PatchMediaType is the content type of image update requests.
+const PatchMediaType = "application/openstack-images-v2.1-json-patch"
+
+// PatchOperation is a single operation of an image update request.
+// Path is either the name of an image attribute, e.g. /name, or the name
+// of a custom image property.
+// http://developer.openstack.org/api-ref-image-v2.html#updateImage-v2
+type PatchOperation struct {
+	Op    PatchOp     `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ImageMember describes a tenant an image is shared with.
+// http://developer.openstack.org/api-ref-image-v2.html#createImageMember-v2
+type ImageMember struct {
+	CreatedAt time.Time    `json:"created_at"`
+	ImageID   string       `json:"image_id"`
+	MemberID  string       `json:"member_id"`
+	Schema    string       `json:"schema"`
+	Status    MemberStatus `json:"status"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// ImageMembers contains the list of the tenants an image is shared with.
+// http://developer.openstack.org/api-ref-image-v2.html#listImageMembers-v2
+type ImageMembers struct {
+	Members []ImageMember `json:"members"`
+	Schema  string        `json:"schema"`
+}
+
+// AddImageMemberRequest contains the tenant to share an image with.
+// http://developer.openstack.org/api-ref-image-v2.html#createImageMember-v2
+type AddImageMemberRequest struct {
+	Member string `json:"member"`
+}
+
+// UpdateImageMemberRequest contains the new status of an image member.
+// http://developer.openstack.org/api-ref-image-v2.html#updateImageMember-v2
+type UpdateImageMemberRequest struct {
+	Status MemberStatus `json:"status"`
+}
+
 // NoContentImageResponse contains the UUID of the image which content
 // got uploaded or deleted
 // http://developer.openstack.org/api-ref-image-v2.html#storeImageFile-v2
@@ -207,6 +348,23 @@ type NoContentImageResponse struct {
 	ImageID string `json:"image_id"`
 }
 
+// CreateTokenRequest contains the scope of the image token to create.  This
+// is a ciao extension of the image API.
+type CreateTokenRequest struct {
+	Scope TokenScope `json:"scope"`
+}
+
+// TokenResponse contains a short-lived image token, which grants access to
+// a single image, within the limits of its scope, to whoever presents it.
+// Image tokens let ciao nodes access the images of their instances without
+// being given keystone credentials.
+type TokenResponse struct {
+	Token     string     `json:"token"`
+	Scope     TokenScope `json:"scope"`
+	ImageID   string     `json:"image_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
 // TBD - can we pull these structs out into some sort of common
 // api service file?
 // ----------
@@ -218,13 +376,22 @@ type APIConfig struct {
 }
 
 // Service is the interface that the api requires in order to get
-// information needed to implement the image endpoints.
+// information needed to implement the image endpoints.  Every call is
+// made on behalf of the identity of the API caller.
 type Service interface {
-	CreateImage(CreateImageRequest) (DefaultResponse, error)
-	UploadImage(string, io.Reader) (NoContentImageResponse, error)
-	ListImages() ([]DefaultResponse, error)
-	GetImage(string) (DefaultResponse, error)
-	DeleteImage(string) (NoContentImageResponse, error)
+	CreateImage(identity.Identity, CreateImageRequest) (DefaultResponse, error)
+	UploadImage(identity.Identity, string, io.Reader) (NoContentImageResponse, error)
+	ListImages(identity.Identity) ([]DefaultResponse, error)
+	GetImage(identity.Identity, string) (DefaultResponse, error)
+	DeleteImage(identity.Identity, string) (NoContentImageResponse, error)
+	DownloadImage(identity.Identity, string) (io.ReadCloser, error)
+	UpdateImage(identity.Identity, string, []PatchOperation) (DefaultResponse, error)
+	ListImageMembers(identity.Identity, string) ([]ImageMember, error)
+	AddImageMember(identity.Identity, string, string) (ImageMember, error)
+	GetImageMember(identity.Identity, string, string) (ImageMember, error)
+	UpdateImageMember(identity.Identity, string, string, MemberStatus) (ImageMember, error)
+	DeleteImageMember(identity.Identity, string, string) error
+	CreateImageToken(identity.Identity, string, TokenScope) (TokenResponse, error)
 }
 
 // Context contains data and interfaces that the image api will need.
@@ -278,8 +445,18 @@ func errorResponse(err error) APIResponse {
 		return APIResponse{http.StatusNotFound, nil}
 	case ErrBadUUID:
 		return APIResponse{http.StatusBadRequest, nil}
-	case ErrAlreadyExists:
+	case ErrAlreadyExists, ErrImageSaving, ErrImageActive:
 		return APIResponse{http.StatusConflict, nil}
+	case ErrNoImageData:
+		return APIResponse{http.StatusNoContent, nil}
+	case ErrBadPatch, ErrBadProperty, ErrBadImageData:
+		return APIResponse{http.StatusBadRequest, nil}
+	case ErrReadOnly, ErrImageProtected, ErrForbidden:
+		return APIResponse{http.StatusForbidden, nil}
+	case ErrNoMember:
+		return APIResponse{http.StatusNotFound, nil}
+	case ErrBadRange:
+		return APIResponse{http.StatusRequestedRangeNotSatisfiable, nil}
 	default:
 		return APIResponse{http.StatusInternalServerError, nil}
 	}
@@ -315,11 +492,7 @@ func listAPIVersions(context *Context, w http.ResponseWriter, r *http.Request) (
 }
 
 // createImage creates information about an image, but doesn't contain
-// any actual image.
-//
-// TBD: this endpoint has no tenant var - how do you know who owns the
-// image if the tenant id isn't passed in? Default visibility is supposed
-// to be private.
+// any actual image.  The image is owned by the tenant of the caller.
 func createImage(context *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	defer r.Body.Close()
 
@@ -335,7 +508,7 @@ func createImage(context *Context, w http.ResponseWriter, r *http.Request) (APIR
 		return APIResponse{http.StatusInternalServerError, nil}, err
 	}
 
-	resp, err := context.CreateImage(req)
+	resp, err := context.CreateImage(identity.GetIdentity(r), req)
 	if err != nil {
 		return errorResponse(err), err
 	}
@@ -347,7 +520,7 @@ func createImage(context *Context, w http.ResponseWriter, r *http.Request) (APIR
 //
 // TBD: support query & sort parameters
 func listImages(context *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
-	images, err := context.ListImages()
+	images, err := context.ListImages(identity.GetIdentity(r))
 	if err != nil {
 		return errorResponse(err), err
 	}
@@ -367,7 +540,7 @@ func getImage(context *Context, w http.ResponseWriter, r *http.Request) (APIResp
 	vars := mux.Vars(r)
 	imageID := vars["image_id"]
 
-	resp, err := context.GetImage(imageID)
+	resp, err := context.GetImage(identity.GetIdentity(r), imageID)
 	if err != nil {
 		return errorResponse(err), err
 	}
@@ -378,24 +551,398 @@ func uploadImage(context *Context, w http.ResponseWriter, r *http.Request) (APIR
 	vars := mux.Vars(r)
 	imageID := vars["image_id"]
 
-	_, err := context.UploadImage(imageID, r.Body)
+	_, err := context.UploadImage(identity.GetIdentity(r), imageID, r.Body)
 	if err != nil {
 		return errorResponse(err), err
 	}
 	return APIResponse{http.StatusNoContent, nil}, nil
 }
 
+// parseRange returns the first and last byte offsets of the single byte
+// range requested by a Range header, for image data of the given size.
+// Headers that are not a single byte range are ignored, as allowed by
+// RFC 7233, and ok is false.
+func parseRange(header string, size int64) (first int64, last int64, ok bool, err error) {
+	const prefix = "bytes="
+
+	if !strings.HasPrefix(header, prefix) || strings.Contains(header, ",") {
+		return 0, 0, false, nil
+	}
+
+	spec := strings.SplitN(strings.TrimSpace(header[len(prefix):]), "-", 2)
+	if len(spec) != 2 {
+		return 0, 0, false, nil
+	}
+
+	if spec[0] == "" {
+		// suffix range, the last n bytes of the data
+		n, err := strconv.ParseInt(spec[1], 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+
+		if n == 0 || size == 0 {
+			return 0, 0, false, ErrBadRange
+		}
+
+		if n > size {
+			n = size
+		}
+
+		return size - n, size - 1, true, nil
+	}
+
+	first, err = strconv.ParseInt(spec[0], 10, 64)
+	if err != nil || first < 0 {
+		return 0, 0, false, nil
+	}
+
+	last = size - 1
+	if spec[1] != "" {
+		last, err = strconv.ParseInt(spec[1], 10, 64)
+		if err != nil || last < first {
+			return 0, 0, false, nil
+		}
+
+		if last >= size {
+			last = size - 1
+		}
+	}
+
+	if first >= size {
+		return 0, 0, false, ErrBadRange
+	}
+
+	return first, last, true, nil
+}
+
+// downloadImage streams the raw data of an image.
+// The response body is the image data itself and not json, which is
+// why this endpoint is not wrapped by an APIHandler.  A single byte
+// range of the data can be requested with a Range header.
+// http://developer.openstack.org/api-ref-image-v2.html#downloadImage-v2
+func downloadImage(context *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	imageID := vars["image_id"]
+
+	img, err := context.GetImage(identity.GetIdentity(r), imageID)
+	if err != nil {
+		resp := errorResponse(err)
+		http.Error(w, http.StatusText(resp.status), resp.status)
+		return
+	}
+
+	if img.Status != Active {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var size int64
+	var first, last int64
+	var partial bool
+
+	if img.Size != nil {
+		size = int64(*img.Size)
+		first, last, partial, err = parseRange(r.Header.Get("Range"), size)
+		if err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			resp := errorResponse(err)
+			http.Error(w, http.StatusText(resp.status), resp.status)
+			return
+		}
+	}
+
+	data, err := context.DownloadImage(identity.GetIdentity(r), imageID)
+	if err != nil {
+		resp := errorResponse(err)
+		http.Error(w, http.StatusText(resp.status), resp.status)
+		return
+	}
+	defer data.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	if !partial {
+		if img.CheckSum != nil {
+			w.Header().Set("Content-MD5", *img.CheckSum)
+		}
+		if img.Size != nil {
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+		}
+		w.WriteHeader(http.StatusOK)
+
+		_, _ = io.Copy(w, data)
+		return
+	}
+
+	if seeker, ok := data.(io.Seeker); ok {
+		_, err = seeker.Seek(first, os.SEEK_SET)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, data, first)
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, size))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", last-first+1))
+	w.WriteHeader(http.StatusPartialContent)
+
+	_, _ = io.CopyN(w, data, last-first+1)
+}
+
+// dataHandler is the handler for the image data endpoints.
+type dataHandler struct {
+	*Context
+	Handler func(*Context, http.ResponseWriter, *http.Request)
+}
+
+// ServeHTTP satisfies the http Handler interface.
+func (h dataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Handler(h.Context, w, r)
+}
+
 func deleteImage(context *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
 	vars := mux.Vars(r)
 	imageID := vars["image_id"]
 
-	_, err := context.DeleteImage(imageID)
+	_, err := context.DeleteImage(identity.GetIdentity(r), imageID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+	return APIResponse{http.StatusNoContent, nil}, nil
+}
+
+// updateImage applies a JSON patch to the attributes of an image.
+// http://developer.openstack.org/api-ref-image-v2.html#updateImage-v2
+func updateImage(context *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	imageID := vars["image_id"]
+
+	defer r.Body.Close()
+
+	if r.Header.Get("Content-Type") != PatchMediaType {
+		return APIResponse{http.StatusUnsupportedMediaType, nil}, ErrBadPatch
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var ops []PatchOperation
+
+	err = json.Unmarshal(body, &ops)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	resp, err := context.UpdateImage(identity.GetIdentity(r), imageID, ops)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// updateImageTag adds a tag to, or removes a tag from, an image.
+// http://developer.openstack.org/api-ref-image-v2.html#addImageTag-v2
+func updateImageTag(context *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	imageID := vars["image_id"]
+	tag := vars["tag"]
+
+	img, err := context.GetImage(identity.GetIdentity(r), imageID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	tags := make([]interface{}, 0, len(img.Tags)+1)
+	found := false
+	for _, t := range img.Tags {
+		if t == tag {
+			found = true
+			if r.Method == "DELETE" {
+				continue
+			}
+		}
+		tags = append(tags, t)
+	}
+
+	if r.Method == "DELETE" && !found {
+		return APIResponse{http.StatusNotFound, nil}, ErrBadPatch
+	}
+
+	if r.Method == "PUT" && !found {
+		tags = append(tags, tag)
+	}
+
+	ops := []PatchOperation{
+		{
+			Op:    PatchReplace,
+			Path:  "/tags",
+			Value: tags,
+		},
+	}
+
+	_, err = context.UpdateImage(identity.GetIdentity(r), imageID, ops)
 	if err != nil {
 		return errorResponse(err), err
 	}
+
 	return APIResponse{http.StatusNoContent, nil}, nil
 }
 
+// listImageMembers lists the tenants an image is shared with.
+// http://developer.openstack.org/api-ref-image-v2.html#listImageMembers-v2
+func listImageMembers(context *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	imageID := vars["image_id"]
+
+	members, err := context.ListImageMembers(identity.GetIdentity(r), imageID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if members == nil {
+		members = make([]ImageMember, 0)
+	}
+
+	resp := ImageMembers{
+		Members: members,
+		Schema:  "/v2/schemas/members",
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// addImageMember shares an image with a tenant.
+// http://developer.openstack.org/api-ref-image-v2.html#createImageMember-v2
+func addImageMember(context *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	imageID := vars["image_id"]
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req AddImageMemberRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	if req.Member == "" {
+		return APIResponse{http.StatusBadRequest, nil}, ErrNoMember
+	}
+
+	resp, err := context.AddImageMember(identity.GetIdentity(r), imageID, req.Member)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// getImageMember shows the status of a tenant an image is shared with.
+// http://developer.openstack.org/api-ref-image-v2.html#showImageMember-v2
+func getImageMember(context *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	imageID := vars["image_id"]
+	memberID := vars["member_id"]
+
+	resp, err := context.GetImageMember(identity.GetIdentity(r), imageID, memberID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// updateImageMember lets the tenant an image is shared with accept or
+// reject it.
+// http://developer.openstack.org/api-ref-image-v2.html#updateImageMember-v2
+func updateImageMember(context *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	imageID := vars["image_id"]
+	memberID := vars["member_id"]
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req UpdateImageMemberRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	switch req.Status {
+	case MemberPending, MemberAccepted, MemberRejected:
+	default:
+		return APIResponse{http.StatusBadRequest, nil}, ErrBadPatch
+	}
+
+	resp, err := context.UpdateImageMember(identity.GetIdentity(r), imageID, memberID, req.Status)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusOK, resp}, nil
+}
+
+// deleteImageMember stops sharing an image with a tenant.
+// http://developer.openstack.org/api-ref-image-v2.html#deleteImageMember-v2
+func deleteImageMember(context *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	imageID := vars["image_id"]
+	memberID := vars["member_id"]
+
+	err := context.DeleteImageMember(identity.GetIdentity(r), imageID, memberID)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusNoContent, nil}, nil
+}
+
+// createImageToken creates a token granting access to an image.
+func createImageToken(context *Context, w http.ResponseWriter, r *http.Request) (APIResponse, error) {
+	vars := mux.Vars(r)
+	imageID := vars["image_id"]
+
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	var req CreateTokenRequest
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return APIResponse{http.StatusBadRequest, nil}, err
+	}
+
+	resp, err := context.CreateImageToken(identity.GetIdentity(r), imageID, req.Scope)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	return APIResponse{http.StatusCreated, resp}, nil
+}
+
 // Routes provides gorilla mux routes for the supported endpoints.
 func Routes(config APIConfig) *mux.Router {
 	// make new Context
@@ -407,9 +954,18 @@ func Routes(config APIConfig) *mux.Router {
 	r.Handle("/", APIHandler{context, listAPIVersions}).Methods("GET")
 	r.Handle("/v2/images", APIHandler{context, createImage}).Methods("POST")
 	r.Handle("/v2/images/{image_id}/file", APIHandler{context, uploadImage}).Methods("PUT")
+	r.Handle("/v2/images/{image_id}/file", dataHandler{context, downloadImage}).Methods("GET")
 	r.Handle("/v2/images", APIHandler{context, listImages}).Methods("GET")
 	r.Handle("/v2/images/{image_id}", APIHandler{context, getImage}).Methods("GET")
 	r.Handle("/v2/images/{image_id}", APIHandler{context, deleteImage}).Methods("DELETE")
+	r.Handle("/v2/images/{image_id}", APIHandler{context, updateImage}).Methods("PATCH")
+	r.Handle("/v2/images/{image_id}/tags/{tag}", APIHandler{context, updateImageTag}).Methods("PUT", "DELETE")
+	r.Handle("/v2/images/{image_id}/token", APIHandler{context, createImageToken}).Methods("POST")
+	r.Handle("/v2/images/{image_id}/members", APIHandler{context, listImageMembers}).Methods("GET")
+	r.Handle("/v2/images/{image_id}/members", APIHandler{context, addImageMember}).Methods("POST")
+	r.Handle("/v2/images/{image_id}/members/{member_id}", APIHandler{context, getImageMember}).Methods("GET")
+	r.Handle("/v2/images/{image_id}/members/{member_id}", APIHandler{context, updateImageMember}).Methods("PUT")
+	r.Handle("/v2/images/{image_id}/members/{member_id}", APIHandler{context, deleteImageMember}).Methods("DELETE")
 
 	return r
 }
@@ -18,11 +18,15 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/01org/ciao/openstack/identity"
 )
 
 // TBD - can some of this stuff be pulled out into a common test area?
@@ -50,7 +54,7 @@ var tests = []test{
 		createImage,
 		`{"container_format":"bare","disk_format":"raw","name":"Ubuntu","id":"b2173dd3-7ad6-4362-baa6-a68bce3565cb"}`,
 		http.StatusCreated,
-		`{"status":"queued","container_format":"bare","min_ram":0,"updated_at":"2015-11-29T22:21:42Z","owner":"bab7d5c60cd041a0a36f7c4b6e1dd978","min_disk":0,"tags":[],"locations":[],"visibility":"private","id":"b2173dd3-7ad6-4362-baa6-a68bce3565cb","size":null,"virtual_size":null,"name":"Ubuntu","checksum":null,"created_at":"2015-11-29T22:21:42Z","disk_format":"raw","properties":null,"protected":false,"self":"/v2/images/b2173dd3-7ad6-4362-baa6-a68bce3565cb","file":"/v2/images/b2173dd3-7ad6-4362-baa6-a68bce3565cb/file","schema":"/v2/schemas/image"}`,
+		`{"status":"queued","container_format":"bare","min_ram":0,"updated_at":"2015-11-29T22:21:42Z","owner":"bab7d5c60cd041a0a36f7c4b6e1dd978","min_disk":0,"tags":[],"locations":[],"visibility":"private","id":"b2173dd3-7ad6-4362-baa6-a68bce3565cb","size":null,"virtual_size":null,"name":"Ubuntu","checksum":null,"os_hash_algo":null,"os_hash_value":null,"created_at":"2015-11-29T22:21:42Z","disk_format":"raw","properties":null,"protected":false,"self":"/v2/images/b2173dd3-7ad6-4362-baa6-a68bce3565cb","file":"/v2/images/b2173dd3-7ad6-4362-baa6-a68bce3565cb/file","schema":"/v2/schemas/image"}`,
 	},
 	{
 		"GET",
@@ -58,7 +62,7 @@ var tests = []test{
 		listImages,
 		"",
 		http.StatusOK,
-		`{"images":[{"status":"queued","container_format":"bare","min_ram":0,"updated_at":"2015-11-29T22:21:42Z","owner":"bab7d5c60cd041a0a36f7c4b6e1dd978","min_disk":0,"tags":[],"locations":[],"visibility":"private","id":"b2173dd3-7ad6-4362-baa6-a68bce3565cb","size":null,"virtual_size":null,"name":"Ubuntu","checksum":null,"created_at":"2015-11-29T22:21:42Z","disk_format":"raw","properties":null,"protected":false,"self":"/v2/images/b2173dd3-7ad6-4362-baa6-a68bce3565cb","file":"/v2/images/b2173dd3-7ad6-4362-baa6-a68bce3565cb/file","schema":"/v2/schemas/image"}],"schema":"/v2/schemas/images","first":"/v2/images"}`,
+		`{"images":[{"status":"queued","container_format":"bare","min_ram":0,"updated_at":"2015-11-29T22:21:42Z","owner":"bab7d5c60cd041a0a36f7c4b6e1dd978","min_disk":0,"tags":[],"locations":[],"visibility":"private","id":"b2173dd3-7ad6-4362-baa6-a68bce3565cb","size":null,"virtual_size":null,"name":"Ubuntu","checksum":null,"os_hash_algo":null,"os_hash_value":null,"created_at":"2015-11-29T22:21:42Z","disk_format":"raw","properties":null,"protected":false,"self":"/v2/images/b2173dd3-7ad6-4362-baa6-a68bce3565cb","file":"/v2/images/b2173dd3-7ad6-4362-baa6-a68bce3565cb/file","schema":"/v2/schemas/image"}],"schema":"/v2/schemas/images","first":"/v2/images"}`,
 	},
 	{
 		"GET",
@@ -66,7 +70,7 @@ var tests = []test{
 		getImage,
 		"",
 		http.StatusOK,
-		`{"status":"active","container_format":"bare","min_ram":0,"updated_at":"2014-05-05T17:15:11Z","owner":"5ef70662f8b34079a6eddb8da9d75fe8","min_disk":0,"tags":[],"locations":[],"visibility":"public","id":"1bea47ed-f6a9-463b-b423-14b9cca9ad27","size":13167616,"virtual_size":null,"name":"cirros-0.3.2-x86_64-disk","checksum":"64d7c1cd2b6f60c92c14662941cb7913","created_at":"2014-05-05T17:15:10Z","disk_format":"qcow2","properties":null,"protected":false,"self":"/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27","file":"/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27/file","schema":"/v2/schemas/image"}`,
+		`{"status":"active","container_format":"bare","min_ram":0,"updated_at":"2014-05-05T17:15:11Z","owner":"5ef70662f8b34079a6eddb8da9d75fe8","min_disk":0,"tags":[],"locations":[],"visibility":"public","id":"1bea47ed-f6a9-463b-b423-14b9cca9ad27","size":13167616,"virtual_size":null,"name":"cirros-0.3.2-x86_64-disk","checksum":"64d7c1cd2b6f60c92c14662941cb7913","os_hash_algo":null,"os_hash_value":null,"created_at":"2014-05-05T17:15:10Z","disk_format":"qcow2","properties":null,"protected":false,"self":"/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27","file":"/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27/file","schema":"/v2/schemas/image"}`,
 	},
 	{
 		"DELETE",
@@ -84,6 +88,46 @@ var tests = []test{
 		http.StatusNoContent,
 		`null`,
 	},
+	{
+		"POST",
+		"/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27/token",
+		createImageToken,
+		`{"scope":"upload"}`,
+		http.StatusCreated,
+		`{"token":"0d3b6a1c8a7b4bd5a0f0e0e5d7e9b1c2","scope":"upload","image_id":"","expires_at":"2015-11-29T23:21:42Z"}`,
+	},
+	{
+		"GET",
+		"/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27/members",
+		listImageMembers,
+		"",
+		http.StatusOK,
+		`{"members":[{"created_at":"2015-11-29T22:21:42Z","image_id":"","member_id":"bab7d5c60cd041a0a36f7c4b6e1dd978","schema":"/v2/schemas/member","status":"accepted","updated_at":"2015-11-29T22:21:42Z"}],"schema":"/v2/schemas/members"}`,
+	},
+	{
+		"POST",
+		"/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27/members",
+		addImageMember,
+		`{"member":"5ef70662f8b34079a6eddb8da9d75fe8"}`,
+		http.StatusOK,
+		`{"created_at":"2015-11-29T22:21:42Z","image_id":"","member_id":"5ef70662f8b34079a6eddb8da9d75fe8","schema":"/v2/schemas/member","status":"pending","updated_at":"2015-11-29T22:21:42Z"}`,
+	},
+	{
+		"PUT",
+		"/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27/members/5ef70662f8b34079a6eddb8da9d75fe8",
+		updateImageMember,
+		`{"status":"accepted"}`,
+		http.StatusOK,
+		`{"created_at":"2015-11-29T22:21:42Z","image_id":"","member_id":"","schema":"/v2/schemas/member","status":"accepted","updated_at":"2015-11-29T22:21:42Z"}`,
+	},
+	{
+		"DELETE",
+		"/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27/members/5ef70662f8b34079a6eddb8da9d75fe8",
+		deleteImageMember,
+		"",
+		http.StatusNoContent,
+		`null`,
+	},
 }
 
 func myHostname() string {
@@ -93,7 +137,7 @@ func myHostname() string {
 
 type testImageService struct{}
 
-func (is testImageService) CreateImage(req CreateImageRequest) (DefaultResponse, error) {
+func (is testImageService) CreateImage(caller identity.Identity, req CreateImageRequest) (DefaultResponse, error) {
 	format := Bare
 	name := "Ubuntu"
 	createdAt, _ := time.Parse(time.RFC3339, "2015-11-29T22:21:42Z")
@@ -123,7 +167,7 @@ func (is testImageService) CreateImage(req CreateImageRequest) (DefaultResponse,
 	}, nil
 }
 
-func (is testImageService) ListImages() ([]DefaultResponse, error) {
+func (is testImageService) ListImages(identity.Identity) ([]DefaultResponse, error) {
 	format := Bare
 	name := "Ubuntu"
 	createdAt, _ := time.Parse(time.RFC3339, "2015-11-29T22:21:42Z")
@@ -158,7 +202,7 @@ func (is testImageService) ListImages() ([]DefaultResponse, error) {
 	return images, nil
 }
 
-func (is testImageService) GetImage(ID string) (DefaultResponse, error) {
+func (is testImageService) GetImage(caller identity.Identity, ID string) (DefaultResponse, error) {
 	imageID := "1bea47ed-f6a9-463b-b423-14b9cca9ad27"
 	format := Bare
 	name := "cirros-0.3.2-x86_64-disk"
@@ -193,14 +237,206 @@ func (is testImageService) GetImage(ID string) (DefaultResponse, error) {
 	}, nil
 }
 
-func (is testImageService) UploadImage(string, io.Reader) (NoContentImageResponse, error) {
+func (is testImageService) UploadImage(identity.Identity, string, io.Reader) (NoContentImageResponse, error) {
 	return NoContentImageResponse{}, nil
 }
 
-func (is testImageService) DeleteImage(string) (NoContentImageResponse, error) {
+func (is testImageService) DeleteImage(identity.Identity, string) (NoContentImageResponse, error) {
 	return NoContentImageResponse{}, nil
 }
 
+func (is testImageService) DownloadImage(identity.Identity, string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("image data")), nil
+}
+
+func (is testImageService) UpdateImage(caller identity.Identity, ID string, ops []PatchOperation) (DefaultResponse, error) {
+	for _, op := range ops {
+		if op.Path == "/checksum" {
+			return DefaultResponse{}, ErrReadOnly
+		}
+	}
+
+	return is.GetImage(caller, ID)
+}
+
+func testImageMember(imageID, memberID string, status MemberStatus) ImageMember {
+	createdAt, _ := time.Parse(time.RFC3339, "2015-11-29T22:21:42Z")
+
+	return ImageMember{
+		CreatedAt: createdAt,
+		ImageID:   imageID,
+		MemberID:  memberID,
+		Schema:    "/v2/schemas/member",
+		Status:    status,
+		UpdatedAt: createdAt,
+	}
+}
+
+func (is testImageService) ListImageMembers(caller identity.Identity, imageID string) ([]ImageMember, error) {
+	return []ImageMember{testImageMember(imageID, "bab7d5c60cd041a0a36f7c4b6e1dd978", MemberAccepted)}, nil
+}
+
+func (is testImageService) AddImageMember(caller identity.Identity, imageID string, memberID string) (ImageMember, error) {
+	return testImageMember(imageID, memberID, MemberPending), nil
+}
+
+func (is testImageService) GetImageMember(caller identity.Identity, imageID string, memberID string) (ImageMember, error) {
+	return ImageMember{}, ErrNoMember
+}
+
+func (is testImageService) UpdateImageMember(caller identity.Identity, imageID string, memberID string, status MemberStatus) (ImageMember, error) {
+	return testImageMember(imageID, memberID, status), nil
+}
+
+func (is testImageService) DeleteImageMember(identity.Identity, string, string) error {
+	return nil
+}
+
+func (is testImageService) CreateImageToken(caller identity.Identity, imageID string, scope TokenScope) (TokenResponse, error) {
+	expiresAt, _ := time.Parse(time.RFC3339, "2015-11-29T23:21:42Z")
+
+	return TokenResponse{
+		Token:     "0d3b6a1c8a7b4bd5a0f0e0e5d7e9b1c2",
+		Scope:     scope,
+		ImageID:   imageID,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func TestUpdateImage(t *testing.T) {
+	var is testImageService
+	context := &Context{9292, is}
+
+	tests := []struct {
+		contentType    string
+		request        string
+		expectedStatus int
+	}{
+		{PatchMediaType, `[{"op":"replace","path":"/name","value":"cirros"}]`, http.StatusOK},
+		{PatchMediaType, `[{"op":"replace","path":"/checksum","value":"0"}]`, http.StatusForbidden},
+		{PatchMediaType, `{"op":"replace"}`, http.StatusBadRequest},
+		{"application/json", `[{"op":"replace","path":"/name","value":"cirros"}]`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("PATCH", "/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27", strings.NewReader(tt.request))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", tt.contentType)
+
+		rr := httptest.NewRecorder()
+		handler := APIHandler{context, updateImage}
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expectedStatus {
+			t.Errorf("%s: got %v, expected %v", tt.request, rr.Code, tt.expectedStatus)
+		}
+	}
+}
+
+func TestUpdateImageTag(t *testing.T) {
+	var is testImageService
+	r := Routes(APIConfig{9292, is})
+
+	tests := []struct {
+		method         string
+		expectedStatus int
+	}{
+		{"PUT", http.StatusNoContent},
+		{"DELETE", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, "/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27/tags/ubuntu", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expectedStatus {
+			t.Errorf("%s: got %v, expected %v", tt.method, rr.Code, tt.expectedStatus)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		first  int64
+		last   int64
+		ok     bool
+		err    error
+	}{
+		{"", 0, 0, false, nil},
+		{"bytes=0-4", 0, 4, true, nil},
+		{"bytes=5-", 5, 9, true, nil},
+		{"bytes=5-100", 5, 9, true, nil},
+		{"bytes=-3", 7, 9, true, nil},
+		{"bytes=-100", 0, 9, true, nil},
+		{"bytes=0-1,4-5", 0, 0, false, nil},
+		{"bytes=4-1", 0, 0, false, nil},
+		{"lines=0-4", 0, 0, false, nil},
+		{"bytes=10-", 0, 0, false, ErrBadRange},
+		{"bytes=-0", 0, 0, false, ErrBadRange},
+	}
+
+	for _, tt := range tests {
+		first, last, ok, err := parseRange(tt.header, 10)
+		if first != tt.first || last != tt.last || ok != tt.ok || err != tt.err {
+			t.Errorf("%s: got %d-%d %v %v, expected %d-%d %v %v", tt.header,
+				first, last, ok, err, tt.first, tt.last, tt.ok, tt.err)
+		}
+	}
+}
+
+func TestDownloadImageRange(t *testing.T) {
+	var is testImageService
+	context := &Context{9292, is}
+
+	tests := []struct {
+		header         string
+		expectedStatus int
+		expectedBody   string
+		expectedRange  string
+	}{
+		{"bytes=0-4", http.StatusPartialContent, "image", "bytes 0-4/13167616"},
+		{"bytes=6-9", http.StatusPartialContent, "data", "bytes 6-9/13167616"},
+		{"bytes=0-1,4-5", http.StatusOK, "image data", ""},
+		{"bytes=13167616-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */13167616"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27/file", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", tt.header)
+
+		rr := httptest.NewRecorder()
+		handler := dataHandler{context, downloadImage}
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expectedStatus {
+			t.Errorf("%s: got %v, expected %v", tt.header, rr.Code, tt.expectedStatus)
+		}
+
+		if rr.Header().Get("Content-Range") != tt.expectedRange {
+			t.Errorf("%s: got range %s, expected %s", tt.header,
+				rr.Header().Get("Content-Range"), tt.expectedRange)
+		}
+
+		if tt.expectedStatus != http.StatusRequestedRangeNotSatisfiable &&
+			rr.Body.String() != tt.expectedBody {
+			t.Errorf("%s: got %v, expected %v", tt.header, rr.Body.String(), tt.expectedBody)
+		}
+	}
+}
+
 func TestRoutes(t *testing.T) {
 	var is testImageService
 	config := APIConfig{9292, is}
@@ -240,3 +476,30 @@ func TestAPIResponse(t *testing.T) {
 		}
 	}
 }
+
+func TestDownloadImage(t *testing.T) {
+	var is testImageService
+	context := &Context{9292, is}
+
+	req, err := http.NewRequest("GET", "/v2/images/1bea47ed-f6a9-463b-b423-14b9cca9ad27/file", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := dataHandler{context, downloadImage}
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %v, expected %v", rr.Code, http.StatusOK)
+	}
+
+	if rr.Header().Get("Content-MD5") != "64d7c1cd2b6f60c92c14662941cb7913" {
+		t.Errorf("Wrong checksum header %s", rr.Header().Get("Content-MD5"))
+	}
+
+	if rr.Body.String() != "image data" {
+		t.Errorf("got %v, expected image data", rr.Body.String())
+	}
+}
@@ -23,6 +23,10 @@ type ServiceType string
 // StorageType is used to define the configuration backend storage type.
 type StorageType string
 
+// SchedulingPolicy is used to define the strategy the scheduler follows
+// when choosing a compute node for a new instance.
+type SchedulingPolicy string
+
 const (
 	// Glance is used to define the imaging service.
 	Glance ServiceType = "glance"
@@ -37,6 +41,24 @@ const (
 	Filesystem StorageType = "file"
 )
 
+const (
+	// RoundRobin is the default scheduling policy.  The scheduler picks
+	// the first node that fits, starting after the most recently used one.
+	RoundRobin SchedulingPolicy = "round_robin"
+
+	// BinPack makes the scheduler pick the node that will have the least
+	// free resources left once the instance is started.
+	BinPack SchedulingPolicy = "bin_pack"
+
+	// Spread makes the scheduler pick the node that will have the most
+	// free resources left once the instance is started.
+	Spread SchedulingPolicy = "spread"
+
+	// LeastLoaded makes the scheduler pick the node with the lowest load
+	// per online CPU.
+	LeastLoaded SchedulingPolicy = "least_loaded"
+)
+
 func (s ServiceType) String() string {
 	switch s {
 	case Glance:
@@ -57,10 +79,26 @@ func (s StorageType) String() string {
 	return ""
 }
 
+func (s SchedulingPolicy) String() string {
+	switch s {
+	case RoundRobin:
+		return "round_robin"
+	case BinPack:
+		return "bin_pack"
+	case Spread:
+		return "spread"
+	case LeastLoaded:
+		return "least_loaded"
+	}
+
+	return ""
+}
+
 // ConfigureScheduler contains the unmarshalled configurations for the
 // scheduler service.
 type ConfigureScheduler struct {
-	ConfigStorageURI string `yaml:"storage_uri"`
+	ConfigStorageURI string           `yaml:"storage_uri"`
+	Policy           SchedulingPolicy `yaml:"policy,omitempty"`
 }
 
 // ConfigureController contains the unmarshalled configurations for the
@@ -81,6 +119,7 @@ type ConfigureLauncher struct {
 	ManagementNetwork []string `yaml:"mgmt_net"`
 	DiskLimit         bool     `yaml:"disk_limit"`
 	MemoryLimit       bool     `yaml:"mem_limit"`
+	ImageCacheMB      int      `yaml:"image_cache_mb,omitempty"`
 }
 
 // ConfigureStorage contains the unmarshalled configurations for the
@@ -117,6 +117,25 @@ func TestConfigureStorageTypeString(t *testing.T) {
 	}
 }
 
+func TestConfigureSchedulingPolicyString(t *testing.T) {
+	var stringTests = []struct {
+		s        SchedulingPolicy
+		expected string
+	}{
+		{RoundRobin, "round_robin"},
+		{BinPack, "bin_pack"},
+		{Spread, "spread"},
+		{LeastLoaded, "least_loaded"},
+	}
+	for _, test := range stringTests {
+		obj := test.s
+		out := obj.String()
+		if out != test.expected {
+			t.Errorf("expected \"%s\", got \"%s\"", test.expected, out)
+		}
+	}
+}
+
 func TestConfigureServiceTypeString(t *testing.T) {
 	var stringTests = []struct {
 		s        ServiceType
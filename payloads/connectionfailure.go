@@ -0,0 +1,62 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// ConnectionFailureReason denotes the underlying error that prevented
+// an SSNTP peer from completing the CONNECT/CONNECTED exchange.
+type ConnectionFailureReason string
+
+const (
+	// IncompatibleVersion indicates that the peers are speaking
+	// different SSNTP major versions.
+	IncompatibleVersion ConnectionFailureReason = "incompatible_version"
+
+	// MissingCapabilities indicates that the peer does not support
+	// some of the SSNTP capabilities the sender requires.
+	MissingCapabilities = "missing_capabilities"
+)
+
+// ErrorConnectionFailure represents the unmarshalled version of the contents
+// of a SSNTP ERROR frame whose type is set to ssntp.ConnectionFailure.
+// Connection failures without a payload are transient and the connection
+// may be retried, the ones carrying a reason are not.
+type ErrorConnectionFailure struct {
+	// Reason provides the reason for the connection failure, e.g.,
+	// IncompatibleVersion.
+	Reason ConnectionFailureReason `yaml:"reason"`
+
+	// Major is the SSNTP major version of the sender.
+	Major uint8 `yaml:"major"`
+
+	// Minor is the SSNTP minor version of the sender.
+	Minor uint8 `yaml:"minor"`
+
+	// Capabilities lists the capabilities the sender requires but
+	// that were not negotiated.
+	Capabilities string `yaml:"capabilities"`
+}
+
+func (r ConnectionFailureReason) String() string {
+	switch r {
+	case IncompatibleVersion:
+		return "Incompatible SSNTP version"
+	case MissingCapabilities:
+		return "Missing SSNTP capabilities"
+	}
+
+	return ""
+}
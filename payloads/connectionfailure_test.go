@@ -0,0 +1,79 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConnectionFailureUnmarshal(t *testing.T) {
+	var error ErrorConnectionFailure
+	err := yaml.Unmarshal([]byte(testutil.ConnectionFailureYaml), &error)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if error.Reason != MissingCapabilities {
+		t.Error("Wrong Error field")
+	}
+
+	if error.Major != 0 || error.Minor != 2 {
+		t.Errorf("Wrong version %d.%d", error.Major, error.Minor)
+	}
+
+	if error.Capabilities != "ClusterConfiguration" {
+		t.Errorf("Wrong capabilities field [%s]", error.Capabilities)
+	}
+}
+
+func TestConnectionFailureMarshal(t *testing.T) {
+	error := ErrorConnectionFailure{
+		Reason:       MissingCapabilities,
+		Major:        0,
+		Minor:        2,
+		Capabilities: "ClusterConfiguration",
+	}
+
+	y, err := yaml.Marshal(&error)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.ConnectionFailureYaml {
+		t.Errorf("ConnectionFailure marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.ConnectionFailureYaml)
+	}
+}
+
+func TestConnectionFailureString(t *testing.T) {
+	var stringTests = []struct {
+		r        ConnectionFailureReason
+		expected string
+	}{
+		{IncompatibleVersion, "Incompatible SSNTP version"},
+		{MissingCapabilities, "Missing SSNTP capabilities"},
+	}
+	for _, test := range stringTests {
+		s := test.r.String()
+		if s != test.expected {
+			t.Errorf("expected \"%s\", got \"%s\"", test.expected, s)
+		}
+	}
+}
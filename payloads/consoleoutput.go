@@ -0,0 +1,38 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// ConsoleOutputEvent contains the tail of the serial console log of an
+// instance.
+type ConsoleOutputEvent struct {
+	// InstanceUUID is the UUID of the instance the log belongs to.
+	InstanceUUID string `yaml:"instance_uuid"`
+
+	// RequestUUID is the RequestUUID of the GetConsole command this
+	// event replies to.
+	RequestUUID string `yaml:"request_uuid"`
+
+	// Output is the tail of the console log.
+	Output string `yaml:"output"`
+}
+
+// EventConsoleOutput represents the unmarshalled version of the contents
+// of an SSNTP ssntp.ConsoleOutput event. This event is sent by
+// ciao-launcher in reply to a GetConsole command.
+type EventConsoleOutput struct {
+	ConsoleOutput ConsoleOutputEvent `yaml:"console_output"`
+}
@@ -0,0 +1,62 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConsoleOutputUnmarshal(t *testing.T) {
+	var output EventConsoleOutput
+	err := yaml.Unmarshal([]byte(testutil.ConsoleOutputYaml), &output)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if output.ConsoleOutput.InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID field [%s]", output.ConsoleOutput.InstanceUUID)
+	}
+
+	if output.ConsoleOutput.RequestUUID != testutil.ConsoleRequestUUID {
+		t.Errorf("Wrong request UUID field [%s]", output.ConsoleOutput.RequestUUID)
+	}
+
+	if output.ConsoleOutput.Output != testutil.ConsoleOutput {
+		t.Errorf("Wrong output field [%s]", output.ConsoleOutput.Output)
+	}
+}
+
+func TestConsoleOutputMarshal(t *testing.T) {
+	var output EventConsoleOutput
+
+	output.ConsoleOutput.InstanceUUID = testutil.InstanceUUID
+	output.ConsoleOutput.RequestUUID = testutil.ConsoleRequestUUID
+	output.ConsoleOutput.Output = testutil.ConsoleOutput
+
+	y, err := yaml.Marshal(&output)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.ConsoleOutputYaml {
+		t.Errorf("ConsoleOutput marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.ConsoleOutputYaml)
+	}
+}
@@ -0,0 +1,33 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// ControllerPromotedEvent contains the UUID of the Controller that has just
+// been promoted to master, along with the latest STATS payload the scheduler
+// received from each of the nodes it is connected to.
+type ControllerPromotedEvent struct {
+	ControllerUUID string `yaml:"controller_uuid"`
+	NodeStats      []Stat `yaml:"node_stats"`
+}
+
+// EventControllerPromoted represents the unmarshalled version of the contents
+// of an SSNTP ssntp.ControllerPromoted event. This event is sent by the
+// scheduler to a backup Controller when it replaces a master Controller that
+// disconnected.
+type EventControllerPromoted struct {
+	ControllerPromoted ControllerPromotedEvent `yaml:"controller_promoted"`
+}
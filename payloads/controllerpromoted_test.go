@@ -0,0 +1,86 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestControllerPromotedUnmarshal(t *testing.T) {
+	var promoted EventControllerPromoted
+	err := yaml.Unmarshal([]byte(testutil.ControllerPromotedYaml), &promoted)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if promoted.ControllerPromoted.ControllerUUID != testutil.ControllerUUID {
+		t.Errorf("Wrong controller UUID field [%s]", promoted.ControllerPromoted.ControllerUUID)
+	}
+
+	if len(promoted.ControllerPromoted.NodeStats) != 1 {
+		t.Fatalf("Wrong number of node stats [%d]", len(promoted.ControllerPromoted.NodeStats))
+	}
+
+	stat := promoted.ControllerPromoted.NodeStats[0]
+	if stat.NodeUUID != testutil.AgentUUID {
+		t.Errorf("Wrong node UUID field [%s]", stat.NodeUUID)
+	}
+
+	if len(stat.Instances) != 1 || stat.Instances[0].InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instances field %v", stat.Instances)
+	}
+}
+
+func TestControllerPromotedMarshal(t *testing.T) {
+	var promoted EventControllerPromoted
+
+	promoted.ControllerPromoted.ControllerUUID = testutil.ControllerUUID
+	promoted.ControllerPromoted.NodeStats = []Stat{
+		{
+			NodeUUID:        testutil.AgentUUID,
+			Status:          "READY",
+			MemTotalMB:      3896,
+			MemAvailableMB:  3896,
+			DiskTotalMB:     500000,
+			DiskAvailableMB: 256000,
+			Load:            0,
+			CpusOnline:      4,
+			Instances: []InstanceStat{
+				{
+					InstanceUUID:  testutil.InstanceUUID,
+					State:         ComputeStatusRunning,
+					MemoryUsageMB: 100,
+					DiskUsageMB:   200,
+					CPUUsage:      10,
+				},
+			},
+		},
+	}
+
+	y, err := yaml.Marshal(&promoted)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.ControllerPromotedYaml {
+		t.Errorf("ControllerPromoted marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.ControllerPromotedYaml)
+	}
+}
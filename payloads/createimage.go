@@ -0,0 +1,50 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// CreateImageCmd contains the information needed to create an image from
+// the root filesystem of an instance.
+type CreateImageCmd struct {
+	// InstanceUUID is the UUID of the instance to snapshot.
+	InstanceUUID string `yaml:"instance_uuid"`
+
+	// WorkloadAgentUUID identifies the node on which the instance is
+	// running.  This information is needed by the scheduler to route
+	// the command to the correct CN.
+	WorkloadAgentUUID string `yaml:"workload_agent_uuid"`
+
+	// ImageUUID is the UUID of the image, already created in the image
+	// service, to which the snapshot of the instance is to be uploaded.
+	ImageUUID string `yaml:"image_uuid"`
+
+	// ImageServiceURL is the base URL of the image service, e.g.,
+	// https://controller.example.com:9292.
+	ImageServiceURL string `yaml:"image_service_url"`
+
+	// Token is a short-lived token which only allows the snapshot to be
+	// uploaded to the image identified by ImageUUID.  It must be presented
+	// to the image service in the X-Image-Token header.
+	Token string `yaml:"token"`
+}
+
+// CreateImage represents the unmarshalled version of the contents of a SSNTP
+// CreateImage payload.  The structure contains enough information to
+// snapshot an instance and to upload the resulting image.
+type CreateImage struct {
+	// CreateImage contains information about the instance to snapshot.
+	CreateImage CreateImageCmd `yaml:"create_image"`
+}
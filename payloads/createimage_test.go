@@ -0,0 +1,71 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestCreateImageUnmarshal(t *testing.T) {
+	var create CreateImage
+	err := yaml.Unmarshal([]byte(testutil.CreateImageYaml), &create)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if create.CreateImage.InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID field [%s]", create.CreateImage.InstanceUUID)
+	}
+
+	if create.CreateImage.WorkloadAgentUUID != testutil.AgentUUID {
+		t.Errorf("Wrong Agent UUID field [%s]", create.CreateImage.WorkloadAgentUUID)
+	}
+
+	if create.CreateImage.ImageUUID != testutil.ImageUUID {
+		t.Errorf("Wrong image UUID field [%s]", create.CreateImage.ImageUUID)
+	}
+
+	if create.CreateImage.ImageServiceURL != testutil.GlanceURL {
+		t.Errorf("Wrong image service URL field [%s]", create.CreateImage.ImageServiceURL)
+	}
+
+	if create.CreateImage.Token != testutil.ImageToken {
+		t.Errorf("Wrong token field [%s]", create.CreateImage.Token)
+	}
+}
+
+func TestCreateImageMarshal(t *testing.T) {
+	var create CreateImage
+	create.CreateImage.InstanceUUID = testutil.InstanceUUID
+	create.CreateImage.WorkloadAgentUUID = testutil.AgentUUID
+	create.CreateImage.ImageUUID = testutil.ImageUUID
+	create.CreateImage.ImageServiceURL = testutil.GlanceURL
+	create.CreateImage.Token = testutil.ImageToken
+
+	y, err := yaml.Marshal(&create)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.CreateImageYaml {
+		t.Errorf("CreateImage marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.CreateImageYaml)
+	}
+}
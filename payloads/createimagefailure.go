@@ -0,0 +1,77 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// CreateImageFailureReason denotes the underlying error that prevented
+// an SSNTP CreateImage command from creating an image from an instance.
+type CreateImageFailureReason string
+
+const (
+	// CreateImageNoInstance indicates that an image could not be created
+	// as the instance does not exist on the node to which the CreateImage
+	// command was sent.
+	CreateImageNoInstance CreateImageFailureReason = "no_instance"
+
+	// CreateImageInvalidPayload indicates that the payload of the SSNTP
+	// CreateImage command was corrupt and could not be unmarshalled.
+	CreateImageInvalidPayload = "invalid_payload"
+
+	// CreateImageInvalidData is returned by ciao-launcher if the contents
+	// of the CreateImage payload are incorrect, e.g., the image_uuid is
+	// missing.
+	CreateImageInvalidData = "invalid_data"
+
+	// CreateImageSnapshotFailure indicates that the snapshot of the
+	// instance's root filesystem could not be created.
+	CreateImageSnapshotFailure = "snapshot_failure"
+
+	// CreateImageUploadFailure indicates that the snapshot was created
+	// but could not be uploaded to the image service.
+	CreateImageUploadFailure = "upload_failure"
+)
+
+// ErrorCreateImageFailure represents the unmarshalled version of the contents
+// of a SSNTP ERROR frame whose type is set to ssntp.CreateImageFailure.
+type ErrorCreateImageFailure struct {
+	// InstanceUUID is the UUID of the instance that could not be
+	// snapshotted.
+	InstanceUUID string `yaml:"instance_uuid"`
+
+	// ImageUUID is the UUID of the image that was to receive the snapshot.
+	ImageUUID string `yaml:"image_uuid"`
+
+	// Reason provides the reason for the failure, e.g.,
+	// CreateImageUploadFailure.
+	Reason CreateImageFailureReason `yaml:"reason"`
+}
+
+func (r CreateImageFailureReason) String() string {
+	switch r {
+	case CreateImageNoInstance:
+		return "Instance does not exist"
+	case CreateImageInvalidPayload:
+		return "YAML payload is corrupt"
+	case CreateImageInvalidData:
+		return "Command section of YAML payload is corrupt or missing required information"
+	case CreateImageSnapshotFailure:
+		return "Unable to snapshot instance"
+	case CreateImageUploadFailure:
+		return "Unable to upload instance snapshot"
+	}
+
+	return ""
+}
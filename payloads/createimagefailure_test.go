@@ -0,0 +1,85 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestCreateImageFailureUnmarshal(t *testing.T) {
+	var error ErrorCreateImageFailure
+	err := yaml.Unmarshal([]byte(testutil.CreateImageFailureYaml), &error)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if error.InstanceUUID != testutil.InstanceUUID {
+		t.Error("Wrong UUID field")
+	}
+
+	if error.ImageUUID != testutil.ImageUUID {
+		t.Error("Wrong image UUID field")
+	}
+
+	if error.Reason != CreateImageUploadFailure {
+		t.Error("Wrong Error field")
+	}
+}
+
+func TestCreateImageFailureMarshal(t *testing.T) {
+	error := ErrorCreateImageFailure{
+		InstanceUUID: testutil.InstanceUUID,
+		ImageUUID:    testutil.ImageUUID,
+		Reason:       CreateImageUploadFailure,
+	}
+
+	y, err := yaml.Marshal(&error)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.CreateImageFailureYaml {
+		t.Errorf("CreateImageFailure marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.CreateImageFailureYaml)
+	}
+}
+
+func TestCreateImageFailureString(t *testing.T) {
+	var stringTests = []struct {
+		r        CreateImageFailureReason
+		expected string
+	}{
+		{CreateImageNoInstance, "Instance does not exist"},
+		{CreateImageInvalidPayload, "YAML payload is corrupt"},
+		{CreateImageInvalidData, "Command section of YAML payload is corrupt or missing required information"},
+		{CreateImageSnapshotFailure, "Unable to snapshot instance"},
+		{CreateImageUploadFailure, "Unable to upload instance snapshot"},
+	}
+	error := ErrorCreateImageFailure{
+		InstanceUUID: testutil.InstanceUUID,
+	}
+	for _, test := range stringTests {
+		error.Reason = test.r
+		s := error.Reason.String()
+		if s != test.expected {
+			t.Errorf("expected \"%s\", got \"%s\"", test.expected, s)
+		}
+	}
+}
@@ -16,9 +16,32 @@
 
 package payloads
 
-// EvacuateCmd contains the nodeID of a SSNTP Agent.
+// EvacuateNextState describes the state a node should reach once all of
+// its instances have been evacuated.
+type EvacuateNextState string
+
+const (
+	// NextStateMaintenance keeps the evacuated node connected but in
+	// maintenance mode, i.e., it will not accept any new instance.
+	NextStateMaintenance EvacuateNextState = "maintenance"
+
+	// NextStateShutdown powers the evacuated node off.
+	NextStateShutdown = "shutdown"
+
+	// NextStateUpdate keeps the evacuated node in maintenance mode so
+	// that its software can be updated.
+	NextStateUpdate = "update"
+
+	// NextStateReboot reboots the evacuated node.
+	NextStateReboot = "reboot"
+)
+
+// EvacuateCmd contains the nodeID of a SSNTP Agent and the state this
+// agent should reach once it has been evacuated.  An empty NextState
+// is equivalent to NextStateMaintenance.
 type EvacuateCmd struct {
-	WorkloadAgentUUID string `yaml:"workload_agent_uuid"`
+	WorkloadAgentUUID string            `yaml:"workload_agent_uuid"`
+	NextState         EvacuateNextState `yaml:"next_state,omitempty"`
 }
 
 // Evacuate represents the SSNTP EVACUATE command payload.
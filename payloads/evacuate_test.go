@@ -49,3 +49,30 @@ func TestEvacUnmarshal(t *testing.T) {
 		t.Errorf("Wrong Agent UUID field [%s]", cmd.Evacuate.WorkloadAgentUUID)
 	}
 }
+
+func TestEvacNextStateMarshal(t *testing.T) {
+	var cmd Evacuate
+	cmd.Evacuate.WorkloadAgentUUID = testutil.AgentUUID
+	cmd.Evacuate.NextState = NextStateReboot
+
+	y, err := yaml.Marshal(&cmd)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.EvacuateRebootYaml {
+		t.Errorf("EVACUATE marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.EvacuateRebootYaml)
+	}
+}
+
+func TestEvacNextStateUnmarshal(t *testing.T) {
+	var cmd Evacuate
+	err := yaml.Unmarshal([]byte(testutil.EvacuateRebootYaml), &cmd)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if cmd.Evacuate.NextState != NextStateReboot {
+		t.Errorf("Wrong next state field [%s]", cmd.Evacuate.NextState)
+	}
+}
@@ -0,0 +1,47 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// GetConsoleCmd contains the information needed to fetch the serial
+// console log of an instance.
+type GetConsoleCmd struct {
+	// InstanceUUID is the UUID of the instance whose console log is
+	// requested.
+	InstanceUUID string `yaml:"instance_uuid"`
+
+	// WorkloadAgentUUID identifies the node on which the instance is
+	// running.  This information is needed by the scheduler to route
+	// the command to the correct CN.
+	WorkloadAgentUUID string `yaml:"workload_agent_uuid"`
+
+	// Lines is the maximum number of lines, counted from the end of the
+	// log, to return.  0 means the whole log.
+	Lines int `yaml:"lines"`
+
+	// RequestUUID identifies this request.  It is copied into the
+	// ConsoleOutput event or GetConsoleFailure error sent in reply so
+	// that concurrent requests for the same instance can be told apart.
+	RequestUUID string `yaml:"request_uuid"`
+}
+
+// GetConsole represents the unmarshalled version of the contents of a SSNTP
+// GetConsole payload.
+type GetConsole struct {
+	// GetConsole contains information about the instance whose console
+	// log is requested.
+	GetConsole GetConsoleCmd `yaml:"get_console"`
+}
@@ -0,0 +1,66 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestGetConsoleUnmarshal(t *testing.T) {
+	var get GetConsole
+	err := yaml.Unmarshal([]byte(testutil.GetConsoleYaml), &get)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if get.GetConsole.InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID field [%s]", get.GetConsole.InstanceUUID)
+	}
+
+	if get.GetConsole.WorkloadAgentUUID != testutil.AgentUUID {
+		t.Errorf("Wrong Agent UUID field [%s]", get.GetConsole.WorkloadAgentUUID)
+	}
+
+	if get.GetConsole.Lines != 50 {
+		t.Errorf("Wrong lines field [%d]", get.GetConsole.Lines)
+	}
+
+	if get.GetConsole.RequestUUID != testutil.ConsoleRequestUUID {
+		t.Errorf("Wrong request UUID field [%s]", get.GetConsole.RequestUUID)
+	}
+}
+
+func TestGetConsoleMarshal(t *testing.T) {
+	var get GetConsole
+	get.GetConsole.InstanceUUID = testutil.InstanceUUID
+	get.GetConsole.WorkloadAgentUUID = testutil.AgentUUID
+	get.GetConsole.Lines = 50
+	get.GetConsole.RequestUUID = testutil.ConsoleRequestUUID
+
+	y, err := yaml.Marshal(&get)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.GetConsoleYaml {
+		t.Errorf("GetConsole marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.GetConsoleYaml)
+	}
+}
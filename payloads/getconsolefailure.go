@@ -0,0 +1,73 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// GetConsoleFailureReason denotes the underlying error that prevented
+// an SSNTP GetConsole command from returning the console log of an
+// instance.
+type GetConsoleFailureReason string
+
+const (
+	// GetConsoleNoInstance indicates that the console log could not be
+	// read as the instance does not exist on the node to which the
+	// GetConsole command was sent.
+	GetConsoleNoInstance GetConsoleFailureReason = "no_instance"
+
+	// GetConsoleInvalidPayload indicates that the payload of the SSNTP
+	// GetConsole command was corrupt and could not be unmarshalled.
+	GetConsoleInvalidPayload = "invalid_payload"
+
+	// GetConsoleInvalidData is returned by ciao-launcher if the contents
+	// of the GetConsole payload are incorrect, e.g., the instance_uuid is
+	// missing.
+	GetConsoleInvalidData = "invalid_data"
+
+	// GetConsoleNoLog indicates that the instance has no console log,
+	// e.g., it has never been started.
+	GetConsoleNoLog = "no_log"
+)
+
+// ErrorGetConsoleFailure represents the unmarshalled version of the contents
+// of a SSNTP ERROR frame whose type is set to ssntp.GetConsoleFailure.
+type ErrorGetConsoleFailure struct {
+	// InstanceUUID is the UUID of the instance whose console log could
+	// not be read.
+	InstanceUUID string `yaml:"instance_uuid"`
+
+	// RequestUUID is the RequestUUID of the GetConsole command that
+	// failed.
+	RequestUUID string `yaml:"request_uuid"`
+
+	// Reason provides the reason for the failure, e.g.,
+	// GetConsoleNoLog.
+	Reason GetConsoleFailureReason `yaml:"reason"`
+}
+
+func (r GetConsoleFailureReason) String() string {
+	switch r {
+	case GetConsoleNoInstance:
+		return "Instance does not exist"
+	case GetConsoleInvalidPayload:
+		return "YAML payload is corrupt"
+	case GetConsoleInvalidData:
+		return "Command section of YAML payload is corrupt or missing required information"
+	case GetConsoleNoLog:
+		return "Console log is not available"
+	}
+
+	return ""
+}
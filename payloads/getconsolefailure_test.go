@@ -0,0 +1,84 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestGetConsoleFailureUnmarshal(t *testing.T) {
+	var error ErrorGetConsoleFailure
+	err := yaml.Unmarshal([]byte(testutil.GetConsoleFailureYaml), &error)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if error.InstanceUUID != testutil.InstanceUUID {
+		t.Error("Wrong UUID field")
+	}
+
+	if error.RequestUUID != testutil.ConsoleRequestUUID {
+		t.Error("Wrong request UUID field")
+	}
+
+	if error.Reason != GetConsoleNoLog {
+		t.Error("Wrong Error field")
+	}
+}
+
+func TestGetConsoleFailureMarshal(t *testing.T) {
+	error := ErrorGetConsoleFailure{
+		InstanceUUID: testutil.InstanceUUID,
+		RequestUUID:  testutil.ConsoleRequestUUID,
+		Reason:       GetConsoleNoLog,
+	}
+
+	y, err := yaml.Marshal(&error)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.GetConsoleFailureYaml {
+		t.Errorf("GetConsoleFailure marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.GetConsoleFailureYaml)
+	}
+}
+
+func TestGetConsoleFailureString(t *testing.T) {
+	var stringTests = []struct {
+		r        GetConsoleFailureReason
+		expected string
+	}{
+		{GetConsoleNoInstance, "Instance does not exist"},
+		{GetConsoleInvalidPayload, "YAML payload is corrupt"},
+		{GetConsoleInvalidData, "Command section of YAML payload is corrupt or missing required information"},
+		{GetConsoleNoLog, "Console log is not available"},
+	}
+	error := ErrorGetConsoleFailure{
+		InstanceUUID: testutil.InstanceUUID,
+	}
+	for _, test := range stringTests {
+		error.Reason = test.r
+		s := error.Reason.String()
+		if s != test.expected {
+			t.Errorf("expected \"%s\", got \"%s\"", test.expected, s)
+		}
+	}
+}
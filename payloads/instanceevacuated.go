@@ -0,0 +1,32 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// InstanceEvacuatedEvent contains the UUID of an instance that has just been
+// removed from a node being evacuated, along with the UUID of that node.
+type InstanceEvacuatedEvent struct {
+	InstanceUUID string `yaml:"instance_uuid"`
+	NodeUUID     string `yaml:"node_uuid"`
+}
+
+// EventInstanceEvacuated represents the unmarshalled version of the contents
+// of an SSNTP ssntp.InstanceEvacuated event. This event is sent by
+// ciao-launcher when it removes an instance from a node it is evacuating, so
+// that the instance can be started again on another node.
+type EventInstanceEvacuated struct {
+	InstanceEvacuated InstanceEvacuatedEvent `yaml:"instance_evacuated"`
+}
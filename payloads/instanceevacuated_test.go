@@ -0,0 +1,57 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestInstanceEvacuatedUnmarshal(t *testing.T) {
+	var insEvac EventInstanceEvacuated
+	err := yaml.Unmarshal([]byte(testutil.InsEvacuatedYaml), &insEvac)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if insEvac.InstanceEvacuated.InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID field [%s]", insEvac.InstanceEvacuated.InstanceUUID)
+	}
+
+	if insEvac.InstanceEvacuated.NodeUUID != testutil.AgentUUID {
+		t.Errorf("Wrong node UUID field [%s]", insEvac.InstanceEvacuated.NodeUUID)
+	}
+}
+
+func TestInstanceEvacuatedMarshal(t *testing.T) {
+	var insEvac EventInstanceEvacuated
+
+	insEvac.InstanceEvacuated.InstanceUUID = testutil.InstanceUUID
+	insEvac.InstanceEvacuated.NodeUUID = testutil.AgentUUID
+
+	y, err := yaml.Marshal(&insEvac)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.InsEvacuatedYaml {
+		t.Errorf("InstanceEvacuated marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.InsEvacuatedYaml)
+	}
+}
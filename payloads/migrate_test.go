@@ -0,0 +1,61 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMigrateUnmarshal(t *testing.T) {
+	var migrate Migrate
+	err := yaml.Unmarshal([]byte(testutil.MigrateYaml), &migrate)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if migrate.Migrate.InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID field [%s]", migrate.Migrate.InstanceUUID)
+	}
+
+	if migrate.Migrate.WorkloadAgentUUID != testutil.AgentUUID {
+		t.Errorf("Wrong Agent UUID field [%s]", migrate.Migrate.WorkloadAgentUUID)
+	}
+
+	if migrate.Migrate.DestinationURI != testutil.MigrationURI {
+		t.Errorf("Wrong destination URI field [%s]", migrate.Migrate.DestinationURI)
+	}
+}
+
+func TestMigrateMarshal(t *testing.T) {
+	var migrate Migrate
+	migrate.Migrate.InstanceUUID = testutil.InstanceUUID
+	migrate.Migrate.WorkloadAgentUUID = testutil.AgentUUID
+	migrate.Migrate.DestinationURI = testutil.MigrationURI
+
+	y, err := yaml.Marshal(&migrate)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.MigrateYaml {
+		t.Errorf("MIGRATE marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.MigrateYaml)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// MigrateFailureReason denotes the underlying error that prevented
+// an SSNTP MIGRATE command from migrating a running instance.
+type MigrateFailureReason string
+
+const (
+	// MigrateNoInstance indicates that an instance could not be migrated
+	// as it does not exist on the node to which the MIGRATE command was
+	// sent.
+	MigrateNoInstance MigrateFailureReason = "no_instance"
+
+	// MigrateInvalidPayload indicates that the payload of the SSNTP
+	// MIGRATE command was corrupt and could not be unmarshalled.
+	MigrateInvalidPayload = "invalid_payload"
+
+	// MigrateInvalidData is returned by ciao-launcher if the contents
+	// of the MIGRATE payload are incorrect, e.g., the destination_uri
+	// is missing.
+	MigrateInvalidData = "invalid_data"
+
+	// MigrateNotRunning indicates that the instance does exist on the
+	// node to which the MIGRATE command was sent, but that it is not
+	// currently running.
+	MigrateNotRunning = "not_running"
+
+	// MigrateNotSupported indicates that the instance cannot be
+	// migrated, e.g., it is a container.
+	MigrateNotSupported = "not_supported"
+
+	// MigrateFailed indicates that the migration was started but did not
+	// complete.  The instance continues to run on the source node.
+	MigrateFailed = "migration_failed"
+)
+
+// ErrorMigrateFailure represents the unmarshalled version of the contents of
+// a SSNTP ERROR frame whose type is set to ssntp.MigrateFailure.
+type ErrorMigrateFailure struct {
+	// InstanceUUID is the UUID of the instance that could not be migrated.
+	InstanceUUID string `yaml:"instance_uuid"`
+
+	// Reason provides the reason for the migrate failure, e.g.,
+	// MigrateNotRunning.
+	Reason MigrateFailureReason `yaml:"reason"`
+}
+
+func (r MigrateFailureReason) String() string {
+	switch r {
+	case MigrateNoInstance:
+		return "Instance does not exist"
+	case MigrateInvalidPayload:
+		return "YAML payload is corrupt"
+	case MigrateInvalidData:
+		return "Command section of YAML payload is corrupt or missing required information"
+	case MigrateNotRunning:
+		return "Instance is not running"
+	case MigrateNotSupported:
+		return "Instance cannot be migrated"
+	case MigrateFailed:
+		return "Migration failed"
+	}
+
+	return ""
+}
@@ -44,6 +44,11 @@ type Ready struct {
 	// Number of CPUs present in the CN/NN.  Derived from the number of
 	// cpu[0-9]+ entries in /proc/stat.
 	CpusOnline int `yaml:"cpus_online"`
+
+	// Images present on the CN/NN, i.e., the UUIDs of the cached qemu
+	// images and the names of the docker images.  Instances can be
+	// created from these images without downloading them first.
+	Images []string `yaml:"images,omitempty"`
 }
 
 // Init initialises the Ready structure.
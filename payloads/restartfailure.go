@@ -52,6 +52,11 @@ const (
 	// RestartNetworkFailure indicates that it was not possible to
 	// initialise networking for the instance before restarting it.
 	RestartNetworkFailure = "network_failure"
+
+	// RestartResizeFailure indicates that it was not possible to apply
+	// the new CPU, memory or disk sizes specified in the RESTART payload
+	// to the instance.
+	RestartResizeFailure = "resize_failure"
 )
 
 // ErrorRestartFailure represents the unmarshalled version of the contents of a
@@ -81,6 +86,8 @@ func (r RestartFailureReason) String() string {
 		return "Failed to launch instance"
 	case RestartNetworkFailure:
 		return "Failed to locate VNIC for instance"
+	case RestartResizeFailure:
+		return "Failed to resize instance"
 	}
 
 	return ""
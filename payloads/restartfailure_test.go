@@ -67,6 +67,7 @@ func TestRestartFailureString(t *testing.T) {
 		{RestartInstanceCorrupt, "Instance is corrupt"},
 		{RestartLaunchFailure, "Failed to launch instance"},
 		{RestartNetworkFailure, "Failed to locate VNIC for instance"},
+		{RestartResizeFailure, "Failed to resize instance"},
 	}
 	error := ErrorRestartFailure{
 		InstanceUUID: testutil.InstanceUUID,
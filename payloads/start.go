@@ -75,6 +75,29 @@ const (
 	// ComputeNode indicates that a resource struct specifies whether the
 	// command in which it is embedded applies to a compute node.
 	ComputeNode = "compute_node"
+
+	// CPUShares indicates that a resource struct specifies the relative
+	// weight of an instance when CPU time is shared between instances.
+	CPUShares = "cpu_shares"
+
+	// CPUQuota indicates that a resource struct specifies the maximum
+	// amount of CPU time an instance can use, as a percentage of a
+	// single CPU.
+	CPUQuota = "cpu_quota"
+
+	// MemLimitMB indicates that a resource struct specifies the maximum
+	// amount of memory, in MBs, the processes of an instance can use.
+	MemLimitMB = "mem_limit_mb"
+
+	// DiskIOPS indicates that a resource struct specifies the maximum
+	// number of read and of write operations per second an instance can
+	// issue to its local disk.
+	DiskIOPS = "disk_iops"
+
+	// DiskMBps indicates that a resource struct specifies the maximum
+	// number of MBs per second an instance can read from and write to
+	// its local disk.
+	DiskMBps = "disk_mbps"
 )
 
 const (
@@ -199,6 +222,27 @@ type StartCmd struct {
 	// Storage contains all the information required to attach or boot
 	// from storage for the new instance.
 	Storage StorageResources `yaml:"storage,omitempty"`
+
+	// Volumes lists the volumes, other than the one described by Storage,
+	// that are to be attached to the new instance.  It is used when an
+	// existing instance is relaunched on another node.
+	Volumes []StorageResources `yaml:"volumes,omitempty"`
+
+	// IncomingMigration, when set, is the URI on which the node should
+	// wait for the instance to be migrated from another node, e.g.,
+	// tcp:0:4444, rather than booting it.  Only used for qemu instances.
+	IncomingMigration string `yaml:"incoming_migration,omitempty"`
+
+	// ImageServiceURL is the base URL of the image service from which
+	// the node can download the image identified by ImageUUID if it
+	// does not have it yet, e.g., https://controller.example.com:9292.
+	// Only used for qemu instances.
+	ImageServiceURL string `yaml:"image_service_url,omitempty"`
+
+	// Token is a short-lived token which only allows the image identified
+	// by ImageUUID to be downloaded.  It must be presented to the image
+	// service in the X-Image-Token header.
+	Token string `yaml:"token,omitempty"`
 }
 
 // Start represents the unmarshalled version of the contents of a SSNTP START
@@ -232,7 +276,9 @@ type RestartCmd struct {
 	InstancePersistence Persistence `yaml:"persistence"`
 
 	// RequestedResources contains a list of the resources that are to be
-	// assigned to the new instance.
+	// assigned to the restarted instance.  Any vcpus, mem_mb or disk_mb
+	// resources present in this list replace the values with which the
+	// instance was originally started, i.e., the instance is resized.
 	RequestedResources []RequestedResource `yaml:"requested_resources"`
 
 	// EstimatedResources represents the estimated value of the instance resource.
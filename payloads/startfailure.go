@@ -72,6 +72,22 @@ const (
 	// NetworkFailure indicates that it was not possible to initialise
 	// networking for the instance.
 	NetworkFailure = "network_failure"
+
+	// NotEnoughVCPUs indicates that the number of VCPUs marked as mandatory
+	// in the START payload could not be provided.
+	NotEnoughVCPUs = "not_enough_vcpus"
+
+	// NotEnoughMemory indicates that the amount of memory marked as
+	// mandatory in the START payload could not be provided.
+	NotEnoughMemory = "not_enough_mem"
+
+	// NotEnoughDisk indicates that the amount of disk space marked as
+	// mandatory in the START payload could not be provided.
+	NotEnoughDisk = "not_enough_disk"
+
+	// NodeInMaintenance indicates that the node to which the START command
+	// was sent is being evacuated or is in maintenance mode.
+	NodeInMaintenance = "node_in_maintenance"
 )
 
 // ErrorStartFailure represents the unmarshalled version of the contents of a
@@ -109,6 +125,14 @@ func (r StartFailureReason) String() string {
 		return "Failed to launch instance"
 	case NetworkFailure:
 		return "Failed to create VNIC for instance"
+	case NotEnoughVCPUs:
+		return "Not enough VCPUs for mandatory request"
+	case NotEnoughMemory:
+		return "Not enough memory for mandatory request"
+	case NotEnoughDisk:
+		return "Not enough disk space for mandatory request"
+	case NodeInMaintenance:
+		return "Compute node is in maintenance mode"
 	}
 
 	return ""
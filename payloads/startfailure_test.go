@@ -72,6 +72,10 @@ func TestStartFailureString(t *testing.T) {
 		{ImageFailure, "Failed to create instance image"},
 		{LaunchFailure, "Failed to launch instance"},
 		{NetworkFailure, "Failed to create VNIC for instance"},
+		{NotEnoughVCPUs, "Not enough VCPUs for mandatory request"},
+		{NotEnoughMemory, "Not enough memory for mandatory request"},
+		{NotEnoughDisk, "Not enough disk space for mandatory request"},
+		{NodeInMaintenance, "Compute node is in maintenance mode"},
 	}
 	error := ErrorStartFailure{
 		InstanceUUID: testutil.InstanceUUID,
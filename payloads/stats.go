@@ -102,6 +102,11 @@ type Stat struct {
 	// Array containing statistics information for each instance hosted by
 	// the CN/NN
 	Instances []InstanceStat
+
+	// Images present on the CN/NN, i.e., the UUIDs of the cached qemu
+	// images and the names of the docker images.  Instances can be
+	// created from these images without downloading them first.
+	Images []string `yaml:"images,omitempty"`
 }
 
 const (
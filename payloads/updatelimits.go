@@ -0,0 +1,54 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// UpdateLimitsCmd contains the information needed to change the resource
+// limits of an instance while it is running.
+type UpdateLimitsCmd struct {
+	// InstanceUUID is the UUID of the instance whose limits are to be
+	// updated.
+	InstanceUUID string `yaml:"instance_uuid"`
+
+	// WorkloadAgentUUID identifies the node on which the instance is
+	// running.  This information is needed by the scheduler to route
+	// the command to the correct CN.
+	WorkloadAgentUUID string `yaml:"workload_agent_uuid"`
+
+	// Limits contains the new values of the limits of the instance, e.g.,
+	// CPUShares or MemLimitMB.  A limit that is not present or that has a
+	// value of 0 is removed.
+	Limits []RequestedResource `yaml:"limits"`
+}
+
+// UpdateLimits represents the unmarshalled version of the contents of a SSNTP
+// UpdateLimits payload.
+type UpdateLimits struct {
+	// UpdateLimits contains the new limits of an instance.
+	UpdateLimits UpdateLimitsCmd `yaml:"update_limits"`
+}
+
+// IsLimit returns true if r is a resource that limits the host resources
+// an instance can use, rather than a resource that is reserved for the
+// instance.
+func IsLimit(r Resource) bool {
+	switch r {
+	case CPUShares, CPUQuota, MemLimitMB, DiskIOPS, DiskMBps:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,93 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads_test
+
+import (
+	"testing"
+
+	. "github.com/01org/ciao/payloads"
+	"github.com/01org/ciao/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func TestUpdateLimitsUnmarshal(t *testing.T) {
+	var update UpdateLimits
+	err := yaml.Unmarshal([]byte(testutil.UpdateLimitsYaml), &update)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if update.UpdateLimits.InstanceUUID != testutil.InstanceUUID {
+		t.Errorf("Wrong instance UUID field [%s]", update.UpdateLimits.InstanceUUID)
+	}
+
+	if update.UpdateLimits.WorkloadAgentUUID != testutil.AgentUUID {
+		t.Errorf("Wrong Agent UUID field [%s]", update.UpdateLimits.WorkloadAgentUUID)
+	}
+
+	if len(update.UpdateLimits.Limits) != 3 {
+		t.Fatalf("Wrong number of limits [%d]", len(update.UpdateLimits.Limits))
+	}
+
+	if update.UpdateLimits.Limits[0].Type != CPUShares ||
+		update.UpdateLimits.Limits[0].Value != 512 {
+		t.Errorf("Wrong limit %v", update.UpdateLimits.Limits[0])
+	}
+}
+
+func TestUpdateLimitsMarshal(t *testing.T) {
+	var update UpdateLimits
+	update.UpdateLimits.InstanceUUID = testutil.InstanceUUID
+	update.UpdateLimits.WorkloadAgentUUID = testutil.AgentUUID
+	update.UpdateLimits.Limits = []RequestedResource{
+		{Type: CPUShares, Value: 512},
+		{Type: MemLimitMB, Value: 2048},
+		{Type: DiskIOPS, Value: 100},
+	}
+
+	y, err := yaml.Marshal(&update)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if string(y) != testutil.UpdateLimitsYaml {
+		t.Errorf("UpdateLimits marshalling failed\n[%s]\n vs\n[%s]", string(y), testutil.UpdateLimitsYaml)
+	}
+}
+
+func TestIsLimit(t *testing.T) {
+	var limitTests = []struct {
+		r        Resource
+		expected bool
+	}{
+		{VCPUs, false},
+		{MemMB, false},
+		{DiskMB, false},
+		{NetworkNode, false},
+		{CPUShares, true},
+		{CPUQuota, true},
+		{MemLimitMB, true},
+		{DiskIOPS, true},
+		{DiskMBps, true},
+	}
+
+	for _, test := range limitTests {
+		if IsLimit(test.r) != test.expected {
+			t.Errorf("IsLimit(%s) should be %v", test.r, test.expected)
+		}
+	}
+}
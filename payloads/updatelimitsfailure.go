@@ -0,0 +1,75 @@
+/*
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+*/
+
+package payloads
+
+// UpdateLimitsFailureReason denotes the underlying error that prevented
+// an SSNTP UpdateLimits command from changing the limits of an instance.
+type UpdateLimitsFailureReason string
+
+const (
+	// UpdateLimitsNoInstance indicates that the limits could not be
+	// updated as the instance does not exist on the node to which the
+	// UpdateLimits command was sent.
+	UpdateLimitsNoInstance UpdateLimitsFailureReason = "no_instance"
+
+	// UpdateLimitsInvalidPayload indicates that the payload of the SSNTP
+	// UpdateLimits command was corrupt and could not be unmarshalled.
+	UpdateLimitsInvalidPayload = "invalid_payload"
+
+	// UpdateLimitsInvalidData is returned by ciao-launcher if the contents
+	// of the UpdateLimits payload are incorrect, e.g., a limit is
+	// negative.
+	UpdateLimitsInvalidData = "invalid_data"
+
+	// UpdateLimitsApplyFailure indicates that the new limits could not be
+	// applied to the running instance.
+	UpdateLimitsApplyFailure = "apply_failure"
+
+	// UpdateLimitsStateFailure indicates that the new limits could not be
+	// saved in the instance's state.
+	UpdateLimitsStateFailure = "state_failure"
+)
+
+// ErrorUpdateLimitsFailure represents the unmarshalled version of the
+// contents of a SSNTP ERROR frame whose type is set to
+// ssntp.UpdateLimitsFailure.
+type ErrorUpdateLimitsFailure struct {
+	// InstanceUUID is the UUID of the instance whose limits could not be
+	// updated.
+	InstanceUUID string `yaml:"instance_uuid"`
+
+	// Reason provides the reason for the failure, e.g.,
+	// UpdateLimitsApplyFailure.
+	Reason UpdateLimitsFailureReason `yaml:"reason"`
+}
+
+func (r UpdateLimitsFailureReason) String() string {
+	switch r {
+	case UpdateLimitsNoInstance:
+		return "Instance does not exist"
+	case UpdateLimitsInvalidPayload:
+		return "YAML payload is corrupt"
+	case UpdateLimitsInvalidData:
+		return "Command section of YAML payload is corrupt or missing required information"
+	case UpdateLimitsApplyFailure:
+		return "Failed to apply the new limits"
+	case UpdateLimitsStateFailure:
+		return "State failure"
+	}
+
+	return ""
+}
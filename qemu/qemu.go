@@ -73,8 +73,14 @@ const (
 
 	// VirtioSerialPort is the serial port device driver.
 	VirtioSerialPort = "virtserialport"
+
+	// ISASerial is the legacy serial port device driver.
+	ISASerial = "isa-serial"
 )
 
+// DefaultPCIBus is the name of the root PCI bus of the pc machine type.
+const DefaultPCIBus = "pci.0"
+
 // ObjectType is a string representing a qemu object type.
 type ObjectType string
 
@@ -254,6 +260,10 @@ const (
 
 	// PTY creates a new pseudo-terminal on the host and connect to it.
 	PTY = "pty"
+
+	// Null discards the traffic from the guest.  It is mostly useful
+	// along with a LogFile.
+	Null = "null"
 )
 
 // CharDevice represents a qemu character device.
@@ -272,11 +282,24 @@ type CharDevice struct {
 	ID   string
 	Path string
 	Name string
+
+	// Host and Port are the TCP address of a Socket backend.  They
+	// are used instead of Path when Port is set.
+	Host string
+	Port int
+
+	// LogFile is the path of a file receiving a copy of the traffic
+	// from the guest.  Qemu appends to the file.
+	LogFile string
 }
 
 // Valid returns true if the CharDevice structure is valid and complete.
 func (cdev CharDevice) Valid() bool {
-	if cdev.ID == "" || cdev.Path == "" {
+	if cdev.ID == "" {
+		return false
+	}
+
+	if cdev.Backend != Null && cdev.Path == "" && cdev.Port == 0 {
 		return false
 	}
 
@@ -294,19 +317,30 @@ func (cdev CharDevice) QemuParams(config *Config) []string {
 		deviceParams = append(deviceParams, fmt.Sprintf(",bus=%s", cdev.Bus))
 	}
 	deviceParams = append(deviceParams, fmt.Sprintf(",chardev=%s", cdev.ID))
-	deviceParams = append(deviceParams, fmt.Sprintf(",id=%s", cdev.DeviceID))
+	if cdev.DeviceID != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf(",id=%s", cdev.DeviceID))
+	}
 	if cdev.Name != "" {
 		deviceParams = append(deviceParams, fmt.Sprintf(",name=%s", cdev.Name))
 	}
 
 	cdevParams = append(cdevParams, string(cdev.Backend))
 	cdevParams = append(cdevParams, fmt.Sprintf(",id=%s", cdev.ID))
-	if cdev.Backend == Socket {
+	if cdev.Backend == Socket && cdev.Port > 0 {
+		if cdev.Host != "" {
+			cdevParams = append(cdevParams, fmt.Sprintf(",host=%s", cdev.Host))
+		}
+		cdevParams = append(cdevParams, fmt.Sprintf(",port=%d,server,nowait", cdev.Port))
+	} else if cdev.Backend == Socket {
 		cdevParams = append(cdevParams, fmt.Sprintf(",path=%s,server,nowait", cdev.Path))
-	} else {
+	} else if cdev.Backend != Null {
 		cdevParams = append(cdevParams, fmt.Sprintf(",path=%s", cdev.Path))
 	}
 
+	if cdev.LogFile != "" {
+		cdevParams = append(cdevParams, fmt.Sprintf(",logfile=%s,logappend=on", cdev.LogFile))
+	}
+
 	qemuParams = append(qemuParams, "-device")
 	qemuParams = append(qemuParams, strings.Join(deviceParams, ""))
 
@@ -325,6 +359,10 @@ const (
 
 	// MACVTAP is a MAC virtual TAP networking device type.
 	MACVTAP = "macvtap"
+
+	// User is a user mode networking device type.  It does not need
+	// any host interface.
+	User = "user"
 )
 
 // NetDevice represents a guest networking device
@@ -356,18 +394,26 @@ type NetDevice struct {
 
 	// MACAddress is the networking device interface MAC address.
 	MACAddress string
+
+	// Bus is the PCI bus the device is plugged into.
+	Bus string
+
+	// Addr is the PCI address of the device on Bus, e.g., 0x5.  An
+	// address is allocated from the Config when empty.
+	Addr string
 }
 
 // Valid returns true if the NetDevice structure is valid and complete.
 func (netdev NetDevice) Valid() bool {
-	if netdev.ID == "" || netdev.IFName == "" {
+	if netdev.ID == "" {
 		return false
 	}
 
 	switch netdev.Type {
-	case TAP:
-		return true
-	case MACVTAP:
+	case TAP, MACVTAP:
+		// the interface is either opened by qemu or passed through FDs.
+		return netdev.IFName != "" || len(netdev.FDs) > 0
+	case User:
 		return true
 	default:
 		return false
@@ -382,20 +428,26 @@ func (netdev NetDevice) QemuParams(config *Config) []string {
 
 	deviceParams = append(deviceParams, fmt.Sprintf("%s", netdev.Driver))
 	deviceParams = append(deviceParams, fmt.Sprintf(",netdev=%s", netdev.ID))
-	deviceParams = append(deviceParams, fmt.Sprintf(",mac=%s", netdev.MACAddress))
-
-	netdevParams = append(netdevParams, string(netdev.Type))
-	netdevParams = append(netdevParams, fmt.Sprintf(",id=%s", netdev.ID))
-	netdevParams = append(netdevParams, fmt.Sprintf(",ifname=%s", netdev.IFName))
+	if netdev.MACAddress != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf(",mac=%s", netdev.MACAddress))
+	}
 
-	if netdev.DownScript != "" {
-		netdevParams = append(netdevParams, fmt.Sprintf(",downscript=%s", netdev.DownScript))
+	// One queue per file descriptor, each queue needs a vector for
+	// rx and one for tx, plus one for config and one for control.
+	if len(netdev.FDs) > 1 {
+		deviceParams = append(deviceParams, fmt.Sprintf(",mq=on,vectors=%d", 2*len(netdev.FDs)+2))
 	}
+	deviceParams = append(deviceParams, config.pciAddrParams(netdev.Bus, netdev.Addr))
 
-	if netdev.Script != "" {
-		netdevParams = append(netdevParams, fmt.Sprintf(",script=%s", netdev.Script))
+	// macvtap devices are driven by qemu through their tap interface.
+	if netdev.Type == MACVTAP {
+		netdevParams = append(netdevParams, string(TAP))
+	} else {
+		netdevParams = append(netdevParams, string(netdev.Type))
 	}
+	netdevParams = append(netdevParams, fmt.Sprintf(",id=%s", netdev.ID))
 
+	// qemu refuses an interface name or scripts along with file descriptors.
 	if len(netdev.FDs) > 0 {
 		var fdParams []string
 
@@ -406,6 +458,18 @@ func (netdev NetDevice) QemuParams(config *Config) []string {
 		}
 
 		netdevParams = append(netdevParams, fmt.Sprintf(",fds=%s", strings.Join(fdParams, ":")))
+	} else {
+		if netdev.IFName != "" {
+			netdevParams = append(netdevParams, fmt.Sprintf(",ifname=%s", netdev.IFName))
+		}
+
+		if netdev.DownScript != "" {
+			netdevParams = append(netdevParams, fmt.Sprintf(",downscript=%s", netdev.DownScript))
+		}
+
+		if netdev.Script != "" {
+			netdevParams = append(netdevParams, fmt.Sprintf(",script=%s", netdev.Script))
+		}
 	}
 
 	if netdev.VHost == true {
@@ -462,6 +526,9 @@ type BlockDeviceAIO string
 // BlockDeviceFormat defines the image format used on a block device.
 type BlockDeviceFormat string
 
+// BlockDeviceMedia defines the type of media of a block device.
+type BlockDeviceMedia string
+
 const (
 	// NoInterface for block devices with no interfaces.
 	NoInterface BlockDeviceInterface = "none"
@@ -481,6 +548,17 @@ const (
 const (
 	// QCOW2 is the Qemu Copy On Write v2 image format.
 	QCOW2 BlockDeviceFormat = "qcow2"
+
+	// RAW is the raw image format.
+	RAW = "raw"
+)
+
+const (
+	// Disk is a read-write disk media.
+	Disk BlockDeviceMedia = "disk"
+
+	// CDROM is a read-only CD-ROM media.
+	CDROM = "cdrom"
 )
 
 // BlockDevice represents a qemu block device.
@@ -493,6 +571,19 @@ type BlockDevice struct {
 	Format    BlockDeviceFormat
 	SCSI      bool
 	WCE       bool
+
+	// DeviceID is the user defined device ID, needed to unplug the device.
+	DeviceID string
+
+	// Media is the drive media, a disk unless specified.
+	Media BlockDeviceMedia
+
+	// Bus is the PCI bus the device is plugged into.
+	Bus string
+
+	// Addr is the PCI address of the device on Bus, e.g., 0x5.  An
+	// address is allocated from the Config when empty.
+	Addr string
 }
 
 // Valid returns true if the BlockDevice structure is valid and complete.
@@ -512,6 +603,10 @@ func (blkdev BlockDevice) QemuParams(config *Config) []string {
 
 	deviceParams = append(deviceParams, fmt.Sprintf("%s", blkdev.Driver))
 	deviceParams = append(deviceParams, fmt.Sprintf(",drive=%s", blkdev.ID))
+	if blkdev.DeviceID != "" {
+		deviceParams = append(deviceParams, fmt.Sprintf(",id=%s", blkdev.DeviceID))
+	}
+
 	if blkdev.SCSI == false {
 		deviceParams = append(deviceParams, ",scsi=off")
 	}
@@ -519,12 +614,18 @@ func (blkdev BlockDevice) QemuParams(config *Config) []string {
 	if blkdev.WCE == false {
 		deviceParams = append(deviceParams, ",config-wce=off")
 	}
+	deviceParams = append(deviceParams, config.pciAddrParams(blkdev.Bus, blkdev.Addr))
 
 	blkParams = append(blkParams, fmt.Sprintf("id=%s", blkdev.ID))
 	blkParams = append(blkParams, fmt.Sprintf(",file=%s", blkdev.File))
-	blkParams = append(blkParams, fmt.Sprintf(",aio=%s", blkdev.AIO))
+	if blkdev.AIO != "" {
+		blkParams = append(blkParams, fmt.Sprintf(",aio=%s", blkdev.AIO))
+	}
 	blkParams = append(blkParams, fmt.Sprintf(",format=%s", blkdev.Format))
 	blkParams = append(blkParams, fmt.Sprintf(",if=%s", blkdev.Interface))
+	if blkdev.Media != "" {
+		blkParams = append(blkParams, fmt.Sprintf(",media=%s", blkdev.Media))
+	}
 
 	qemuParams = append(qemuParams, "-device")
 	qemuParams = append(qemuParams, strings.Join(deviceParams, ""))
@@ -597,6 +698,23 @@ func (rtc RTC) Valid() bool {
 	return true
 }
 
+// Spice is the SPICE remote display configuration.
+type Spice struct {
+	// Port is the TCP port the SPICE server listens on.
+	Port int
+
+	// Addr is the IP address the SPICE server listens on.
+	Addr string
+
+	// DisableTicketing lets clients connect without a password.
+	DisableTicketing bool
+}
+
+// Valid returns true if the Spice structure is valid and complete.
+func (spice Spice) Valid() bool {
+	return spice.Port > 0
+}
+
 // QMPSocketType is the type of socket used for QMP communication.
 type QMPSocketType string
 
@@ -687,6 +805,19 @@ type Knobs struct {
 	Daemonize bool
 }
 
+// MigrationDefer can be used as an Incoming URI to launch a qemu instance
+// that waits for a migrate-incoming QMP command before listening for an
+// incoming migration.
+const MigrationDefer = "defer"
+
+// Incoming is the incoming migration configuration structure.
+type Incoming struct {
+	// URI is the address on which qemu listens for an incoming migration,
+	// e.g., tcp:0:4444, or MigrationDefer.  When set, the guest is not
+	// started until the migration has completed.
+	URI string
+}
+
 // Config is the qemu configuration structure.
 // It allows for passing custom settings and parameters to the qemu API.
 type Config struct {
@@ -720,6 +851,15 @@ type Config struct {
 	// VGA is the qemu VGA mode.
 	VGA string
 
+	// Display is the qemu display type, e.g., none.
+	Display string
+
+	// Spice is the SPICE remote display configuration.
+	Spice Spice
+
+	// Bios is the path of the guest firmware on the host filesystem.
+	Bios string
+
 	// Kernel is the guest kernel configuration.
 	Kernel Kernel
 
@@ -735,6 +875,19 @@ type Config struct {
 	// Knobs is a set of qemu boolean settings.
 	Knobs Knobs
 
+	// Incoming is the incoming migration configuration.
+	Incoming Incoming
+
+	// FirstPCIAddr is the first slot of the default PCI bus given to
+	// block and network devices which have no PCI address.  Slots are
+	// given in the order of Devices, which makes the guest PCI layout
+	// stable, e.g., for hot plugging or migration.  When zero, qemu picks
+	// the addresses itself.
+	FirstPCIAddr int
+
+	// pciAddr is the next PCI slot to give to a device.
+	pciAddr int
+
 	// fds is a list of open file descriptors to be passed to the spawned qemu process
 	fds []*os.File
 
@@ -761,6 +914,30 @@ func (config *Config) appendFDs(fds []*os.File) []int {
 	return fdInts
 }
 
+// pciAddrParams returns the bus and address parameters of a PCI device.
+// A device without an address gets the next free slot of the default
+// PCI bus when the configuration hands out addresses.
+func (config *Config) pciAddrParams(bus, addr string) string {
+	if addr == "" && config.FirstPCIAddr > 0 {
+		if config.pciAddr < config.FirstPCIAddr {
+			config.pciAddr = config.FirstPCIAddr
+		}
+
+		addr = fmt.Sprintf("0x%x", config.pciAddr)
+		config.pciAddr++
+	}
+
+	if addr == "" {
+		return ""
+	}
+
+	if bus == "" {
+		bus = DefaultPCIBus
+	}
+
+	return fmt.Sprintf(",bus=%s,addr=%s", bus, addr)
+}
+
 func (config *Config) appendName() {
 	if config.Name != "" {
 		config.qemuParams = append(config.qemuParams, "-name")
@@ -870,7 +1047,7 @@ func (config *Config) appendCPUs() {
 }
 
 func (config *Config) appendRTC() {
-	if config.RTC.Valid() == false {
+	if config.RTC == (RTC{}) || config.RTC.Valid() == false {
 		return
 	}
 
@@ -904,6 +1081,41 @@ func (config *Config) appendVGA() {
 	}
 }
 
+func (config *Config) appendDisplay() {
+	if config.Display != "" {
+		config.qemuParams = append(config.qemuParams, "-display")
+		config.qemuParams = append(config.qemuParams, config.Display)
+	}
+}
+
+func (config *Config) appendSpice() {
+	if config.Spice.Valid() == false {
+		return
+	}
+
+	var spiceParams []string
+
+	spiceParams = append(spiceParams, fmt.Sprintf("port=%d", config.Spice.Port))
+
+	if config.Spice.Addr != "" {
+		spiceParams = append(spiceParams, fmt.Sprintf(",addr=%s", config.Spice.Addr))
+	}
+
+	if config.Spice.DisableTicketing == true {
+		spiceParams = append(spiceParams, ",disable-ticketing")
+	}
+
+	config.qemuParams = append(config.qemuParams, "-spice")
+	config.qemuParams = append(config.qemuParams, strings.Join(spiceParams, ""))
+}
+
+func (config *Config) appendBios() {
+	if config.Bios != "" {
+		config.qemuParams = append(config.qemuParams, "-bios")
+		config.qemuParams = append(config.qemuParams, config.Bios)
+	}
+}
+
 func (config *Config) appendKernel() {
 	if config.Kernel.Path != "" {
 		config.qemuParams = append(config.qemuParams, "-kernel")
@@ -916,6 +1128,13 @@ func (config *Config) appendKernel() {
 	}
 }
 
+func (config *Config) appendIncoming() {
+	if config.Incoming.URI != "" {
+		config.qemuParams = append(config.qemuParams, "-incoming")
+		config.qemuParams = append(config.qemuParams, config.Incoming.URI)
+	}
+}
+
 func (config *Config) appendKnobs() {
 	if config.Knobs.NoUserConfig == true {
 		config.qemuParams = append(config.qemuParams, "-no-user-config")
@@ -955,8 +1174,12 @@ func LaunchQemu(config Config, logger QMPLog) (string, error) {
 	config.appendRTC()
 	config.appendGlobalParam()
 	config.appendVGA()
+	config.appendDisplay()
+	config.appendSpice()
 	config.appendKnobs()
 	config.appendKernel()
+	config.appendBios()
+	config.appendIncoming()
 
 	return LaunchCustomQemu(config.Ctx, config.Path, config.qemuParams, config.fds, logger)
 }
@@ -64,6 +64,14 @@ func testAppend(structure interface{}, expected string, t *testing.T) {
 	case RTC:
 		config.RTC = s
 		config.appendRTC()
+
+	case Incoming:
+		config.Incoming = s
+		config.appendIncoming()
+
+	case Spice:
+		config.Spice = s
+		config.appendSpice()
 	}
 
 	result := strings.Join(config.qemuParams, " ")
@@ -119,7 +127,7 @@ func TestAppendDeviceFS(t *testing.T) {
 	testAppend(fsdev, deviceFSString, t)
 }
 
-var deviceNetworkString = "-device virtio-net,netdev=tap0,mac=01:02:de:ad:be:ef -netdev tap,id=tap0,ifname=ceth0,downscript=no,script=no,fds=3:4,vhost=on"
+var deviceNetworkString = "-device virtio-net,netdev=tap0,mac=01:02:de:ad:be:ef,mq=on,vectors=6 -netdev tap,id=tap0,fds=3:4,vhost=on"
 
 func TestAppendDeviceNetwork(t *testing.T) {
 	foo, _ := ioutil.TempFile(os.TempDir(), "qemu-ciao-test")
@@ -143,6 +151,45 @@ func TestAppendDeviceNetwork(t *testing.T) {
 	testAppend(netdev, deviceNetworkString, t)
 }
 
+var deviceNetworkTapString = "-device virtio-net,netdev=tap0,mac=01:02:de:ad:be:ef -netdev tap,id=tap0,ifname=ceth0,downscript=no,script=no,vhost=on"
+
+func TestAppendDeviceNetworkTap(t *testing.T) {
+	netdev := NetDevice{
+		Driver:     VirtioNet,
+		Type:       TAP,
+		ID:         "tap0",
+		IFName:     "ceth0",
+		Script:     "no",
+		DownScript: "no",
+		VHost:      true,
+		MACAddress: "01:02:de:ad:be:ef",
+	}
+
+	testAppend(netdev, deviceNetworkTapString, t)
+}
+
+var deviceNetworkUserString = "-device virtio-net,netdev=user0 -netdev user,id=user0"
+
+func TestAppendDeviceNetworkUser(t *testing.T) {
+	netdev := NetDevice{
+		Driver: VirtioNet,
+		Type:   User,
+		ID:     "user0",
+	}
+
+	testAppend(netdev, deviceNetworkUserString, t)
+}
+
+func TestAppendInvalidDeviceNetwork(t *testing.T) {
+	netdev := NetDevice{
+		Driver: VirtioNet,
+		Type:   MACVTAP,
+		ID:     "tap0",
+	}
+
+	testAppend(netdev, "", t)
+}
+
 var deviceSerialString = "-device virtio-serial-pci,id=serial0"
 
 func TestAppendDeviceSerial(t *testing.T) {
@@ -169,6 +216,33 @@ func TestAppendDeviceSerialPort(t *testing.T) {
 	testAppend(chardev, deviceSerialPortString, t)
 }
 
+var deviceSerialTCPString = "-device isa-serial,chardev=gnc0 -chardev socket,id=gnc0,host=127.0.0.1,port=5900,server,nowait"
+
+func TestAppendDeviceSerialTCP(t *testing.T) {
+	chardev := CharDevice{
+		Driver:  ISASerial,
+		Backend: Socket,
+		ID:      "gnc0",
+		Host:    "127.0.0.1",
+		Port:    5900,
+	}
+
+	testAppend(chardev, deviceSerialTCPString, t)
+}
+
+var deviceSerialLogString = "-device isa-serial,chardev=console0 -chardev null,id=console0,logfile=/var/lib/ciao/console.log,logappend=on"
+
+func TestAppendDeviceSerialLog(t *testing.T) {
+	chardev := CharDevice{
+		Driver:  ISASerial,
+		Backend: Null,
+		ID:      "console0",
+		LogFile: "/var/lib/ciao/console.log",
+	}
+
+	testAppend(chardev, deviceSerialLogString, t)
+}
+
 var deviceBlockString = "-device virtio-blk,drive=hd0,scsi=off,config-wce=off -drive id=hd0,file=/var/lib/ciao.img,aio=threads,format=qcow2,if=none"
 
 func TestAppendDeviceBlock(t *testing.T) {
@@ -186,6 +260,60 @@ func TestAppendDeviceBlock(t *testing.T) {
 	testAppend(blkdev, deviceBlockString, t)
 }
 
+var deviceCDROMString = "-device virtio-blk,drive=cdrom0,id=device0,scsi=off,config-wce=off,bus=pci.0,addr=0x6 -drive id=cdrom0,file=/var/lib/ciao/seed.iso,format=raw,if=none,media=cdrom"
+
+func TestAppendDeviceCDROM(t *testing.T) {
+	blkdev := BlockDevice{
+		Driver:    VirtioBlock,
+		ID:        "cdrom0",
+		DeviceID:  "device0",
+		File:      "/var/lib/ciao/seed.iso",
+		Format:    RAW,
+		Interface: NoInterface,
+		Media:     CDROM,
+		Addr:      "0x6",
+	}
+
+	testAppend(blkdev, deviceCDROMString, t)
+}
+
+var pciAddrString = "-device virtio-blk,drive=hd0,scsi=off,config-wce=off,bus=pci.0,addr=0x5 -drive id=hd0,file=/var/lib/ciao.img,format=qcow2,if=none -device virtio-blk,drive=hd1,scsi=off,config-wce=off,bus=pci.0,addr=0x9 -drive id=hd1,file=/var/lib/ciao1.img,format=raw,if=none -device virtio-net,netdev=user0,bus=pci.0,addr=0x6 -netdev user,id=user0"
+
+func TestAppendPCIAddr(t *testing.T) {
+	config := Config{
+		FirstPCIAddr: 5,
+		Devices: []Device{
+			BlockDevice{
+				Driver:    VirtioBlock,
+				ID:        "hd0",
+				File:      "/var/lib/ciao.img",
+				Format:    QCOW2,
+				Interface: NoInterface,
+			},
+			BlockDevice{
+				Driver:    VirtioBlock,
+				ID:        "hd1",
+				File:      "/var/lib/ciao1.img",
+				Format:    RAW,
+				Interface: NoInterface,
+				Addr:      "0x9",
+			},
+			NetDevice{
+				Driver: VirtioNet,
+				Type:   User,
+				ID:     "user0",
+			},
+		},
+	}
+
+	config.appendDevices()
+
+	result := strings.Join(config.qemuParams, " ")
+	if result != pciAddrString {
+		t.Fatalf("Failed to append parameters [%s] != [%s]", result, pciAddrString)
+	}
+}
+
 func TestAppendEmptyDevice(t *testing.T) {
 	device := SerialDevice{}
 
@@ -327,3 +455,54 @@ func TestAppendRTC(t *testing.T) {
 
 	testAppend(rtc, rtcString, t)
 }
+
+func TestAppendEmptyRTC(t *testing.T) {
+	rtc := RTC{}
+
+	testAppend(rtc, "", t)
+}
+
+var incomingString = "-incoming tcp:0:4444"
+
+func TestAppendIncoming(t *testing.T) {
+	incoming := Incoming{
+		URI: "tcp:0:4444",
+	}
+
+	testAppend(incoming, incomingString, t)
+}
+
+var spiceString = "-spice port=5900,addr=127.0.0.1,disable-ticketing"
+
+func TestAppendSpice(t *testing.T) {
+	spice := Spice{
+		Port:             5900,
+		Addr:             "127.0.0.1",
+		DisableTicketing: true,
+	}
+
+	testAppend(spice, spiceString, t)
+}
+
+func TestAppendEmptySpice(t *testing.T) {
+	spice := Spice{}
+
+	testAppend(spice, "", t)
+}
+
+var displayBiosString = "-display none -bios /usr/share/qemu/OVMF.fd"
+
+func TestAppendDisplayBios(t *testing.T) {
+	config := Config{
+		Display: "none",
+		Bios:    "/usr/share/qemu/OVMF.fd",
+	}
+
+	config.appendDisplay()
+	config.appendBios()
+
+	result := strings.Join(config.qemuParams, " ")
+	if result != displayBiosString {
+		t.Fatalf("Failed to append parameters [%s] != [%s]", result, displayBiosString)
+	}
+}
@@ -118,6 +118,11 @@ type qmpCommand struct {
 	args           map[string]interface{}
 	filter         *qmpEventFilter
 	resultReceived bool
+	data           map[string]interface{}
+
+	// eventErr is set when the event the command waits for reports
+	// that the command failed.
+	eventErr error
 }
 
 // QMP is a structure that contains the internal state used by startQMPLoop and
@@ -175,8 +180,14 @@ func (q *QMP) processQMPEvent(cmdQueue *list.List, name interface{}, data interf
 					match = eventData[filter.dataKey] == filter.dataValue
 				}
 				if match {
+					// Events such as BLOCK_JOB_COMPLETED report
+					// the failure of the command in an error
+					// field.
+					if msg, ok := eventData["error"].(string); ok {
+						cmd.eventErr = fmt.Errorf("%s: %s", strname, msg)
+					}
 					if cmd.resultReceived {
-						q.finaliseCommand(cmdEl, cmdQueue, true)
+						q.finaliseCommand(cmdEl, cmdQueue, cmd.eventErr == nil)
 					} else {
 						cmd.filter = nil
 					}
@@ -210,7 +221,9 @@ func (q *QMP) finaliseCommand(cmdEl *list.Element, cmdQueue *list.List, succeede
 	case <-cmd.ctx.Done():
 	default:
 		if succeeded {
-			cmd.res <- qmpResult{}
+			cmd.res <- qmpResult{data: cmd.data}
+		} else if cmd.eventErr != nil {
+			cmd.res <- qmpResult{err: fmt.Errorf("QMP command failed: %v", cmd.eventErr)}
 		} else {
 			cmd.res <- qmpResult{err: fmt.Errorf("QMP command failed")}
 		}
@@ -233,7 +246,7 @@ func (q *QMP) processQMPInput(line []byte, cmdQueue *list.List) {
 		return
 	}
 
-	_, succeeded := vmData["return"]
+	ret, succeeded := vmData["return"]
 	_, failed := vmData["error"]
 
 	if !succeeded && !failed {
@@ -247,8 +260,11 @@ func (q *QMP) processQMPInput(line []byte, cmdQueue *list.List) {
 		return
 	}
 	cmd := cmdEl.Value.(*qmpCommand)
+	if succeeded {
+		cmd.data, _ = ret.(map[string]interface{})
+	}
 	if failed || cmd.filter == nil {
-		q.finaliseCommand(cmdEl, cmdQueue, succeeded)
+		q.finaliseCommand(cmdEl, cmdQueue, succeeded && cmd.eventErr == nil)
 	} else {
 		cmd.resultReceived = true
 	}
@@ -400,7 +416,14 @@ func startQMPLoop(conn io.ReadWriteCloser, cfg QMPConfig,
 
 func (q *QMP) executeCommand(ctx context.Context, name string, args map[string]interface{},
 	filter *qmpEventFilter) error {
+	_, err := q.executeCommandWithResponse(ctx, name, args, filter)
+	return err
+}
+
+func (q *QMP) executeCommandWithResponse(ctx context.Context, name string, args map[string]interface{},
+	filter *qmpEventFilter) (map[string]interface{}, error) {
 	var err error
+	var data map[string]interface{}
 	resCh := make(chan qmpResult)
 	select {
 	case <-q.disconnectedCh:
@@ -415,17 +438,18 @@ func (q *QMP) executeCommand(ctx context.Context, name string, args map[string]i
 	}
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	select {
 	case res := <-resCh:
 		err = res.err
+		data = res.data
 	case <-ctx.Done():
 		err = ctx.Err()
 	}
 
-	return err
+	return data, err
 }
 
 // QMPStart connects to a unix domain socket maintained by a QMP instance.  It
@@ -595,3 +619,146 @@ func (q *QMP) ExecuteDeviceDel(ctx context.Context, devID string) error {
 	}
 	return q.executeCommand(ctx, "device_del", args, filter)
 }
+
+// MigrationState describes the state of an outgoing migration, as reported by
+// the query-migrate command.
+type MigrationState string
+
+const (
+	// MigrationNone indicates that no migration has been started.
+	MigrationNone MigrationState = "none"
+
+	// MigrationSetup indicates that a migration is being set up.
+	MigrationSetup MigrationState = "setup"
+
+	// MigrationActive indicates that a migration is in progress.
+	MigrationActive MigrationState = "active"
+
+	// MigrationCompleted indicates that a migration has finished successfully.
+	MigrationCompleted MigrationState = "completed"
+
+	// MigrationFailed indicates that a migration has failed.
+	MigrationFailed MigrationState = "failed"
+
+	// MigrationCancelled indicates that a migration was cancelled.
+	MigrationCancelled MigrationState = "cancelled"
+)
+
+// MigrationRAM contains statistics about the RAM transferred during a
+// migration.  All values are in bytes.
+type MigrationRAM struct {
+	Transferred int64
+	Remaining   int64
+	Total       int64
+}
+
+// MigrationStatus contains the information returned by the query-migrate
+// command.
+type MigrationStatus struct {
+	// Status is the current state of the migration.
+	Status MigrationState
+
+	// TotalTime is the time in milliseconds spent migrating so far, or
+	// the total migration time once the migration has completed.
+	TotalTime int64
+
+	// Downtime is the time in milliseconds during which the instance
+	// was paused.  It is only reported once the migration has completed.
+	Downtime int64
+
+	// RAM contains the RAM transfer statistics.
+	RAM MigrationRAM
+
+	// ErrorDesc describes why a migration failed.
+	ErrorDesc string
+}
+
+func qmpInt64(data map[string]interface{}, key string) int64 {
+	val, _ := data[key].(float64)
+	return int64(val)
+}
+
+// ExecuteMigrate starts the migration of the instance to the destination
+// described by uri, e.g., tcp:192.168.0.2:4444.  The destination QEMU
+// instance must have been launched with a matching incoming URI.  If blk is
+// true the instance's disks are copied along with its memory.  inc
+// restricts the disk copy to the top most image, i.e., it assumes that the
+// destination already has a copy of any backing files.
+//
+// ExecuteMigrate returns as soon as the migration has started.  Callers can
+// use ExecuteQueryMigrate to track its progress.
+func (q *QMP) ExecuteMigrate(ctx context.Context, uri string, blk, inc bool) error {
+	args := map[string]interface{}{
+		"uri": uri,
+	}
+	if blk {
+		args["blk"] = true
+	}
+	if inc {
+		args["inc"] = true
+	}
+	return q.executeCommand(ctx, "migrate", args, nil)
+}
+
+// ExecuteMigrateIncoming tells an instance that was launched with an
+// incoming URI of MigrationDefer to start listening for a migration on uri.
+func (q *QMP) ExecuteMigrateIncoming(ctx context.Context, uri string) error {
+	args := map[string]interface{}{
+		"uri": uri,
+	}
+	return q.executeCommand(ctx, "migrate-incoming", args, nil)
+}
+
+// ExecuteMigrateCancel cancels the current outgoing migration.
+func (q *QMP) ExecuteMigrateCancel(ctx context.Context) error {
+	return q.executeCommand(ctx, "migrate_cancel", nil, nil)
+}
+
+// ExecuteQueryMigrate sends the query-migrate command to the instance and
+// returns the status of the current, or most recent, outgoing migration.
+func (q *QMP) ExecuteQueryMigrate(ctx context.Context) (MigrationStatus, error) {
+	var status MigrationStatus
+
+	data, err := q.executeCommandWithResponse(ctx, "query-migrate", nil, nil)
+	if err != nil {
+		return status, err
+	}
+
+	status.Status = MigrationNone
+	if s, ok := data["status"].(string); ok {
+		status.Status = MigrationState(s)
+	}
+	status.TotalTime = qmpInt64(data, "total-time")
+	status.Downtime = qmpInt64(data, "downtime")
+	status.ErrorDesc, _ = data["error-desc"].(string)
+	if ram, ok := data["ram"].(map[string]interface{}); ok {
+		status.RAM.Transferred = qmpInt64(ram, "transferred")
+		status.RAM.Remaining = qmpInt64(ram, "remaining")
+		status.RAM.Total = qmpInt64(ram, "total")
+	}
+
+	return status, nil
+}
+
+// ExecuteDriveBackup copies the contents of the drive identified by device
+// into a new image, target, of the given format, e.g., qcow2, by sending a
+// drive-backup command with sync mode full.  The instance can continue
+// to run while the backup is taken.
+//
+// This method blocks until a BLOCK_JOB_COMPLETED event is received for
+// device.  An error is returned if the event reports that the backup
+// failed.
+func (q *QMP) ExecuteDriveBackup(ctx context.Context, device, target, format string) error {
+	args := map[string]interface{}{
+		"device": device,
+		"target": target,
+		"format": format,
+		"sync":   "full",
+	}
+	filter := &qmpEventFilter{
+		eventName: "BLOCK_JOB_COMPLETED",
+		dataKey:   "device",
+		dataValue: device,
+	}
+	return q.executeCommand(ctx, "drive-backup", args, filter)
+}
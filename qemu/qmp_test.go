@@ -695,3 +695,233 @@ func TestQMPLostLoop(t *testing.T) {
 		t.Error("Expected executeQMPCapabilities to fail")
 	}
 }
+
+// Checks that the migrate command is correctly sent.
+//
+// We start a QMPLoop, send the migrate command and stop the loop.
+//
+// The migrate command should be correctly sent and the QMP loop should
+// exit gracefully.
+func TestQMPMigrate(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommmand("migrate", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteMigrate(context.Background(), "tcp:192.168.0.2:4444",
+		true, true)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that the migrate-incoming command is correctly sent.
+//
+// We start a QMPLoop, send the migrate-incoming command and stop the loop.
+//
+// The migrate-incoming command should be correctly sent and the QMP loop
+// should exit gracefully.
+func TestQMPMigrateIncoming(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommmand("migrate-incoming", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteMigrateIncoming(context.Background(), "tcp:0:4444")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that the migrate_cancel command is correctly sent.
+//
+// We start a QMPLoop, send the migrate_cancel command and stop the loop.
+//
+// The migrate_cancel command should be correctly sent and the QMP loop
+// should exit gracefully.
+func TestQMPMigrateCancel(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommmand("migrate_cancel", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	err := q.ExecuteMigrateCancel(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that the query-migrate command is correctly sent and that its
+// response is correctly parsed.
+//
+// We start a QMPLoop, send a query-migrate command which returns a completed
+// migration and stop the loop.
+//
+// The command should succeed and the fields of the MigrationStatus should
+// match those of the response.
+func TestQMPQueryMigrate(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommmand("query-migrate", nil, "return", map[string]interface{}{
+		"status":     "completed",
+		"total-time": 1200,
+		"downtime":   30,
+		"ram": map[string]interface{}{
+			"transferred": 4096,
+			"remaining":   0,
+			"total":       8192,
+		},
+	})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	status, err := q.ExecuteQueryMigrate(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := MigrationStatus{
+		Status:    MigrationCompleted,
+		TotalTime: 1200,
+		Downtime:  30,
+		RAM: MigrationRAM{
+			Transferred: 4096,
+			Remaining:   0,
+			Total:       8192,
+		},
+	}
+	if status != expected {
+		t.Errorf("Unexpected migration status.  Expected %+v, found %+v",
+			expected, status)
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that an empty query-migrate response is correctly parsed.
+//
+// We start a QMPLoop, send a query-migrate command which returns an empty
+// response, as QEMU does when no migration has been started, and stop the
+// loop.
+//
+// The command should succeed and the MigrationStatus should have a status
+// of none.
+func TestQMPQueryMigrateNone(t *testing.T) {
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommmand("query-migrate", nil, "return", nil)
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+
+	status, err := q.ExecuteQueryMigrate(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if status.Status != MigrationNone {
+		t.Errorf("Unexpected migration status.  Expected %s, found %s",
+			MigrationNone, status.Status)
+	}
+
+	q.Shutdown()
+	<-disconnectedCh
+}
+
+// Checks that the drive-backup command is correctly sent.
+//
+// We start a QMPLoop, send the drive-backup command and wait for it to
+// complete.  The command generates a BLOCK_JOB_COMPLETED event once the
+// backup has been written.
+//
+// The drive-backup command should be correctly sent, should only complete
+// once the BLOCK_JOB_COMPLETED event has been received and the QMP loop
+// should exit gracefully.
+func TestQMPDriveBackup(t *testing.T) {
+	const device = "virtio0"
+
+	var wg sync.WaitGroup
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommmand("drive-backup", nil, "return", nil)
+	buf.AddEvent("BLOCK_JOB_COMPLETED", time.Millisecond*200,
+		map[string]interface{}{
+			"device": device,
+			"type":   "backup",
+		},
+		map[string]interface{}{
+			"seconds":      1352167040730,
+			"microseconds": 123456,
+		})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	buf.startEventLoop(&wg)
+	start := time.Now()
+	err := q.ExecuteDriveBackup(context.Background(), device,
+		"/tmp/snapshot.qcow2", "qcow2")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if time.Since(start) < time.Millisecond*200 {
+		t.Errorf("drive-backup completed before BLOCK_JOB_COMPLETED")
+	}
+	q.Shutdown()
+	<-disconnectedCh
+	wg.Wait()
+}
+
+// Checks that a failed drive-backup is reported.
+//
+// We start a QMPLoop, send the drive-backup command and wait for it to
+// complete.  The command generates a BLOCK_JOB_COMPLETED event with an
+// error field as the backup could not be written.
+//
+// The drive-backup command should fail and the QMP loop should exit
+// gracefully.
+func TestQMPDriveBackupFailure(t *testing.T) {
+	const device = "virtio0"
+
+	var wg sync.WaitGroup
+	connectedCh := make(chan *QMPVersion)
+	disconnectedCh := make(chan struct{})
+	buf := newQMPTestCommandBuffer(t)
+	buf.AddCommmand("drive-backup", nil, "return", nil)
+	buf.AddEvent("BLOCK_JOB_COMPLETED", time.Millisecond*200,
+		map[string]interface{}{
+			"device": device,
+			"type":   "backup",
+			"error":  "No space left on device",
+		},
+		map[string]interface{}{
+			"seconds":      1352167040730,
+			"microseconds": 123456,
+		})
+	cfg := QMPConfig{Logger: qmpTestLogger{}}
+	q := startQMPLoop(buf, cfg, connectedCh, disconnectedCh)
+	checkVersion(t, connectedCh)
+	buf.startEventLoop(&wg)
+	err := q.ExecuteDriveBackup(context.Background(), device,
+		"/tmp/snapshot.qcow2", "qcow2")
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	q.Shutdown()
+	<-disconnectedCh
+	wg.Wait()
+}
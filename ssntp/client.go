@@ -17,9 +17,9 @@
 package ssntp
 
 import (
+	"bufio"
 	"crypto/tls"
 	"fmt"
-	"math/rand"
 	"sync"
 	"time"
 
@@ -40,7 +40,8 @@ type ClientNotifier interface {
 
 	// DisconnectNotify notifies of a SSNTP server disconnection.
 	// SSNTP Client implementations are not supposed to explicitly
-	// reconnect, the SSNTP protocol will handle the reconnection.
+	// reconnect, the SSNTP protocol will handle the reconnection
+	// according to the client ReconnectConfig.
 	DisconnectNotify()
 
 	// StatusNotify notifies of a pending status frame from the SSNTP server.
@@ -76,6 +77,15 @@ type Client struct {
 	status    connectionStatus
 	closed    chan struct{}
 
+	capabilities         Capability
+	requiredCapabilities Capability
+
+	reconnect ReconnectConfig
+	queue     frameQueue
+
+	// The last CONFIGURE payload sent, re-sent after reconnecting.
+	sentConfiguration clusterConfiguration
+
 	frameWg              sync.WaitGroup
 	frameRoutinesChannel chan struct{}
 
@@ -109,7 +119,11 @@ func (client *Client) processSSNTPFrame(frame *Frame) {
 func (client *Client) handleSSNTPServer() {
 	defer client.Close()
 
-	for {
+	for reconnected := false; ; reconnected = true {
+		if reconnected {
+			client.resendConfiguration()
+		}
+		client.replayQueuedFrames()
 		client.ntf.ConnectNotify()
 
 		for {
@@ -123,6 +137,7 @@ func (client *Client) handleSSNTPServer() {
 					client.status.Unlock()
 					return
 				}
+				client.status.status = ssntpConnecting
 				client.status.Unlock()
 
 				client.log.Errorf("Read error: %s\n", err)
@@ -142,6 +157,10 @@ func (client *Client) handleSSNTPServer() {
 			go client.processSSNTPFrame(&frame)
 		}
 
+		if client.reconnect.Disable {
+			return
+		}
+
 		err := client.attemptDial()
 		if err != nil {
 			client.log.Errorf("%s", err)
@@ -178,6 +197,15 @@ func (client *Client) sendConnect() (bool, error) {
 			return false, fmt.Errorf("SSNTP Client: Connection failure")
 		}
 
+		// A ConnectionFailure with a reason comes from a server
+		// refusing us, there is no point in retrying.
+		var failure payloads.ErrorConnectionFailure
+		err = yaml.Unmarshal(connected.Payload, &failure)
+		if err == nil && failure.Reason != "" {
+			return false, fmt.Errorf("SSNTP Client: Connection refused by %d.%d server: %s %s",
+				failure.Major, failure.Minor, failure.Reason, failure.Capabilities)
+		}
+
 		return true, fmt.Errorf("SSNTP Client: Connection error %s\n", (Error)(connected.Operand))
 
 	default:
@@ -189,10 +217,25 @@ func (client *Client) sendConnect() (bool, error) {
 	oidFound, err := verifyRole(client.session.conn, connected.Role)
 	if oidFound == false {
 		client.log.Errorf("%s\n", err)
-		client.SendError(ConnectionFailure, nil)
+		client.sendConnectionFailure(nil)
 		return false, fmt.Errorf("SSNTP Client: Connection failure")
 	}
 
+	if connected.Major&majorMask != Major {
+		client.sendConnectionFailure(connectionFailurePayload(payloads.IncompatibleVersion, 0))
+		return false, fmt.Errorf("SSNTP Client: Incompatible server version %d.%d, expected %d.x",
+			connected.Major&majorMask, connected.Minor, Major)
+	}
+
+	client.session.negotiate(connected.Minor, connected.Capabilities, client.capabilities)
+	client.session.negotiateFraming()
+
+	missing := client.requiredCapabilities &^ client.session.capabilities
+	if missing != 0 {
+		client.sendConnectionFailure(connectionFailurePayload(payloads.MissingCapabilities, missing))
+		return false, fmt.Errorf("SSNTP Client: Server is missing capabilities %s", missing)
+	}
+
 	client.status.Lock()
 	client.status.status = ssntpConnected
 	client.status.Unlock()
@@ -204,9 +247,15 @@ func (client *Client) sendConnect() (bool, error) {
 	return true, nil
 }
 
-func (client *Client) attemptDial() error {
-	delays := []int64{5, 10, 20, 40}
+// sendConnectionFailure tells the server the client is connecting to why
+// the connection is refused.  The error is not queued as the client is not
+// connected yet.
+func (client *Client) sendConnectionFailure(payload []byte) {
+	frame := client.session.errorFrame(ConnectionFailure, payload, client.trace)
+	_, _ = client.session.Write(frame)
+}
 
+func (client *Client) attemptDial() error {
 	if len(client.uris) == 0 {
 		return fmt.Errorf("No servers to connect to")
 	}
@@ -215,71 +264,66 @@ func (client *Client) attemptDial() error {
 	client.closed = make(chan struct{})
 	client.status.Unlock()
 
-	source := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(source)
+	backoff := newBackoff(client.reconnect)
 
 	for {
-	URILoop:
-		for d := 0; ; d++ {
-			for _, uri := range client.uris {
-				client.log.Infof("%s connecting to %s\n", client.uuid, uri)
-				conn, err := tls.Dial(client.transport, uri, client.tls)
-
-				client.status.Lock()
-				if client.status.status == ssntpClosed {
-					client.status.Unlock()
-					return fmt.Errorf("Connection closed")
-				}
-				client.status.Unlock()
+		var session *session
 
-				if err == nil {
-					client.log.Infof("Connected\n")
-					session := newSession(&client.uuid, client.role, 0, conn)
-					client.session = session
+		for _, uri := range client.uris {
+			client.log.Infof("%s connecting to %s\n", client.uuid, uri)
+			conn, err := tls.Dial(client.transport, uri, client.tls)
 
-					break URILoop
-				}
-
-				client.log.Errorf("Could not connect to %s (%s)\n", uri, err)
+			client.status.Lock()
+			if client.status.status == ssntpClosed {
+				client.status.Unlock()
+				return fmt.Errorf("Connection closed")
 			}
+			client.status.Unlock()
 
-			delay := r.Int63n(delays[d%len(delays)])
-			delay++ // Avoid waiting for 0 seconds
-			client.log.Errorf("All server URIs failed - retrying in %d seconds\n", delay)
+			if err == nil {
+				client.log.Infof("Connected\n")
+				codec := newGobCodec(bufio.NewReader(conn), conn)
+				session = newSession(&client.uuid, client.role, 0, conn, codec)
+				session.capabilities = client.capabilities
 
-			// Wait for delay before reconnecting or return if the client is closed
-			select {
-			case <-client.closed:
-				return fmt.Errorf("Connection closed")
-			case <-time.After(time.Duration(delay) * time.Second):
 				break
 			}
 
-			continue
+			client.log.Errorf("Could not connect to %s (%s)\n", uri, err)
 		}
 
-		if client.session == nil {
-			continue
-		}
+		if session != nil {
+			client.status.Lock()
+			client.session = session
+			client.status.Unlock()
+
+			reconnect, err := client.sendConnect()
+			if err == nil {
+				// Dialed and connected, we can proceed
+				return nil
+			}
 
-		reconnect, err := client.sendConnect()
-		if err != nil {
-			// Dialed but could not connect, try again
 			client.log.Errorf("%s", err)
-			client.Close()
-			if reconnect == true {
-				continue
-			} else {
+			if reconnect == false {
+				client.Close()
 				client.ntf.DisconnectNotify()
 				return err
 			}
+
+			// Dialed but could not connect, try again
+			session.conn.Close()
 		}
 
-		// Dialed and connected, we can proceed
-		break
-	}
+		delay := backoff.next()
+		client.log.Errorf("Could not connect to any server - retrying in %s\n", delay)
 
-	return nil
+		// Wait for delay before reconnecting or return if the client is closed
+		select {
+		case <-client.closed:
+			return fmt.Errorf("Connection closed")
+		case <-time.After(delay):
+		}
+	}
 }
 
 // Dial attempts to connect to a SSNTP server, as specified by the config argument.
@@ -324,6 +368,10 @@ func (client *Client) Dial(config *Config, ntf ClientNotifier) error {
 	}
 	client.role = role
 	client.lUUID, client.uuid = config.configUUID(client.role)
+	client.capabilities = config.capabilities()
+	client.requiredCapabilities = config.RequiredCapabilities
+	client.reconnect = config.reconnect()
+	client.queue.length = client.reconnect.QueueLength
 	client.port = config.port()
 	client.transport = config.transport()
 	client.uris = config.ConfigURIs(client.uris, client.port)
@@ -378,60 +426,126 @@ func (client *Client) Close() {
 	freeUUID(client.lUUID)
 }
 
-func (client *Client) sendCommand(cmd Command, payload []byte, trace *TraceConfig) (int, error) {
+// connectedSession returns the current session and tells if the client
+// is connected through it.
+func (client *Client) connectedSession() (*session, bool, error) {
 	client.status.Lock()
-	if client.status.status == ssntpClosed {
-		client.status.Unlock()
-		return -1, fmt.Errorf("sendCommand: Client not connected")
+	defer client.status.Unlock()
+
+	if client.status.status == ssntpClosed || client.session == nil {
+		return nil, false, fmt.Errorf("Client not connected")
+	}
+
+	return client.session, client.status.status == ssntpConnected, nil
+}
+
+// sendOrQueue sends a frame to the server. Frames sent while the client
+// is disconnected, or while previously queued frames are not yet replayed,
+// are queued for keeping the frames ordering.
+func (client *Client) sendOrQueue(session *session, connected bool, frame *Frame) (int, error) {
+	client.queue.Lock()
+	defer client.queue.Unlock()
+
+	if connected && len(client.queue.frames) == 0 {
+		n, err := session.Write(frame)
+		if err == nil || client.reconnect.Disable {
+			return n, err
+		}
+
+		// We are losing the server, keep the frame for the next one.
+		client.log.Warningf("Write error, queueing %s %d frame: %s\n", frame.Type, frame.Operand, err)
+	}
+
+	return 0, client.queue.push(frame)
+}
+
+// replayQueuedFrames sends the frames queued while disconnected.
+func (client *Client) replayQueuedFrames() {
+	client.queue.Lock()
+	defer client.queue.Unlock()
+
+	session, connected, _ := client.connectedSession()
+	if connected == false || len(client.queue.frames) == 0 {
+		return
+	}
+
+	client.log.Infof("Replaying %d queued frames\n", len(client.queue.frames))
+
+	for i, frame := range client.queue.frames {
+		_, err := session.Write(frame)
+		if err != nil {
+			client.log.Errorf("Could not replay queued frames: %s\n", err)
+			client.queue.frames = client.queue.frames[i:]
+			return
+		}
+	}
+
+	client.queue.frames = nil
+}
+
+// resendConfiguration sends the last CONFIGURE command sent by the client
+// again after reconnecting, in case the server restarted and lost it.
+func (client *Client) resendConfiguration() {
+	client.sentConfiguration.RLock()
+	payload := client.sentConfiguration.configuration
+	client.sentConfiguration.RUnlock()
+
+	if payload == nil {
+		return
+	}
+
+	_, err := client.sendCommand(CONFIGURE, payload, client.trace)
+	if err != nil {
+		client.log.Errorf("Could not send configuration: %s\n", err)
+	}
+}
+
+func (client *Client) sendCommand(cmd Command, payload []byte, trace *TraceConfig) (int, error) {
+	session, _, err := client.connectedSession()
+	if err != nil {
+		return -1, fmt.Errorf("sendCommand: %s", err)
+	}
+
+	if cmd == CONFIGURE {
+		client.sentConfiguration.setConfiguration(payload)
 	}
-	client.status.Unlock()
 
-	session := client.session
 	frame := session.commandFrame(cmd, payload, trace)
 
 	return session.Write(frame)
 }
 
 func (client *Client) sendStatus(status Status, payload []byte, trace *TraceConfig) (int, error) {
-	client.status.Lock()
-	if client.status.status == ssntpClosed {
-		client.status.Unlock()
-		return -1, fmt.Errorf("sendStatus: Client not connected")
+	session, connected, err := client.connectedSession()
+	if err != nil {
+		return -1, fmt.Errorf("sendStatus: %s", err)
 	}
-	client.status.Unlock()
 
-	session := client.session
 	frame := session.statusFrame(status, payload, trace)
 
-	return session.Write(frame)
+	return client.sendOrQueue(session, connected, frame)
 }
 
 func (client *Client) sendEvent(event Event, payload []byte, trace *TraceConfig) (int, error) {
-	client.status.Lock()
-	if client.status.status == ssntpClosed {
-		client.status.Unlock()
-		return -1, fmt.Errorf("sendEvent: Client not connected")
+	session, connected, err := client.connectedSession()
+	if err != nil {
+		return -1, fmt.Errorf("sendEvent: %s", err)
 	}
-	client.status.Unlock()
 
-	session := client.session
 	frame := session.eventFrame(event, payload, trace)
 
-	return session.Write(frame)
+	return client.sendOrQueue(session, connected, frame)
 }
 
 func (client *Client) sendError(error Error, payload []byte, trace *TraceConfig) (int, error) {
-	client.status.Lock()
-	if client.status.status == ssntpClosed {
-		client.status.Unlock()
-		return -1, fmt.Errorf("sendError: Client not connected")
+	session, connected, err := client.connectedSession()
+	if err != nil {
+		return -1, fmt.Errorf("sendError: %s", err)
 	}
-	client.status.Unlock()
 
-	session := client.session
 	frame := session.errorFrame(error, payload, trace)
 
-	return session.Write(frame)
+	return client.sendOrQueue(session, connected, frame)
 }
 
 // SendCommand sends a specific command and its payload to the SSNTP server.
@@ -492,6 +606,19 @@ func (client *Client) UUID() string {
 	return client.uuid.String()
 }
 
+// Capabilities returns the SSNTP capabilities negotiated with the server.
+// It returns 0 if the client is not connected.
+func (client *Client) Capabilities() Capability {
+	client.status.Lock()
+	defer client.status.Unlock()
+
+	if client.status.status != ssntpConnected || client.session == nil {
+		return 0
+	}
+
+	return client.session.capabilities
+}
+
 // ClusterConfiguration returns the latest cluster configuration
 // payload a client received. Clients should use that payload to
 // configure themselves based on the information provided to them
@@ -0,0 +1,475 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssntp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// All binary frames start with the same 8 bytes long header:
+//
+//	+----------------------------------------------------------------+
+//	|   Major  |   Minor  |   Type   | Operand  |  Payload Length    |
+//	| (1 byte) | (1 byte) | (1 byte) | (1 byte) |  or Role (4 bytes) |
+//	+----------------------------------------------------------------+
+//
+// All multi-bytes fields are big endian encoded, UUIDs are 16 bytes long
+// and timestamps are signed 8 bytes nanoseconds counts since the Unix epoch,
+// 0 meaning unset.
+const headerLength = 8
+const uuidLength = 16
+const timestampLength = 8
+
+// CONNECT: header (Role) | Capabilities (4) | Source | Destination
+const connectLength = headerLength + 4 + 2*uuidLength
+
+// Path trace node: UUID | Role (4) | Tx timestamp | Rx timestamp
+const nodeLength = uuidLength + 4 + 2*timestampLength
+
+// Upper bounds for the frame variable length fields, to protect
+// decoders from allocating arbitrary amounts of memory.
+const maxPayloadLength = 64 << 20
+const maxTraceLength = 1 << 20
+
+type frameCodec interface {
+	encode(frame interface{}) error
+	decode(frame interface{}) error
+}
+
+// gobCodec is the legacy SSNTP frame encoding.
+type gobCodec struct {
+	r *bufio.Reader
+	w io.Writer
+
+	encoder *gob.Encoder
+	decoder *gob.Decoder
+}
+
+func newGobCodec(r *bufio.Reader, w io.Writer) *gobCodec {
+	return &gobCodec{
+		r:       r,
+		w:       w,
+		encoder: gob.NewEncoder(w),
+		decoder: gob.NewDecoder(r),
+	}
+}
+
+func (c *gobCodec) encode(frame interface{}) error {
+	return c.encoder.Encode(frame)
+}
+
+func (c *gobCodec) decode(frame interface{}) error {
+	return c.decoder.Decode(frame)
+}
+
+// binaryCodec returns a binary codec for the connection c is used on.
+// gob decoders do not read ahead of the frame they decode from a
+// bufio.Reader, so the binary codec reads from where c stopped.
+func (c *gobCodec) binaryCodec() *binaryCodec {
+	return newBinaryCodec(c.r, c.w)
+}
+
+// binaryCodec implements the SSNTP binary framing.
+type binaryCodec struct {
+	r io.Reader
+
+	sync.Mutex
+	w io.Writer
+}
+
+func newBinaryCodec(r io.Reader, w io.Writer) *binaryCodec {
+	return &binaryCodec{
+		r: r,
+		w: w,
+	}
+}
+
+// A binary CONNECT frame Type and Operand bytes are both 0, while a
+// gob stream starts with a type definition message: its byte count
+// followed by a negative type id. Neither of them is encoded with
+// leading null bytes, so at least one of the gob stream third and
+// fourth bytes is not 0.
+func isBinaryConnect(header []byte) bool {
+	return len(header) >= 4 &&
+		header[2] == byte(COMMAND) && header[3] == byte(CONNECT)
+}
+
+// newServerCodec detects the framing a client uses by peeking at its
+// CONNECT frame.  SSNTP clients open connections with gob encoded
+// frames, which legacy servers understand, but servers also accept
+// binary CONNECT frames.
+func newServerCodec(r io.Reader, w io.Writer) (frameCodec, error) {
+	reader := bufio.NewReader(r)
+
+	header, err := reader.Peek(4)
+	if err != nil {
+		return newGobCodec(reader, w), err
+	}
+
+	if isBinaryConnect(header) {
+		return newBinaryCodec(reader, w), nil
+	}
+
+	return newGobCodec(reader, w), nil
+}
+
+func putUUID(buf *bytes.Buffer, uuid []byte) {
+	var u [uuidLength]byte
+
+	copy(u[:], uuid)
+	buf.Write(u[:])
+}
+
+func putUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+
+	binary.BigEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func putTimestamp(buf *bytes.Buffer, t time.Time) {
+	var b [timestampLength]byte
+
+	if t.IsZero() == false {
+		binary.BigEndian.PutUint64(b[:], uint64(t.UnixNano()))
+	}
+
+	buf.Write(b[:])
+}
+
+func putHeader(buf *bytes.Buffer, major, minor uint8, t Type, operand uint8, field uint32) {
+	buf.Write([]byte{major, minor, byte(t), operand})
+	putUint32(buf, field)
+}
+
+// Trace: Label length (2) | Label | Start | End | Path length (1) | Path nodes
+func encodeTrace(trace *FrameTrace) ([]byte, error) {
+	var buf bytes.Buffer
+	var labelLength [2]byte
+
+	if trace == nil {
+		return nil, nil
+	}
+
+	if len(trace.Label) > 0xffff {
+		return nil, fmt.Errorf("Trace label too long (%d bytes)", len(trace.Label))
+	}
+
+	if len(trace.Path) > 0xff {
+		return nil, fmt.Errorf("Trace path too long (%d nodes)", len(trace.Path))
+	}
+
+	binary.BigEndian.PutUint16(labelLength[:], uint16(len(trace.Label)))
+	buf.Write(labelLength[:])
+	buf.Write(trace.Label)
+	putTimestamp(&buf, trace.StartTimestamp)
+	putTimestamp(&buf, trace.EndTimestamp)
+	buf.WriteByte(uint8(len(trace.Path)))
+
+	for _, n := range trace.Path {
+		putUUID(&buf, n.UUID)
+		putUint32(&buf, uint32(n.Role))
+		putTimestamp(&buf, n.TxTimestamp)
+		putTimestamp(&buf, n.RxTimestamp)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func marshalFrame(frame interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch f := frame.(type) {
+	case *ConnectFrame:
+		putHeader(&buf, f.Major, f.Minor, f.Type, f.Operand, uint32(f.Role))
+		putUint32(&buf, uint32(f.Capabilities))
+		putUUID(&buf, f.Source)
+		putUUID(&buf, f.Destination)
+
+	case *ConnectedFrame:
+		if len(f.Payload) > maxPayloadLength {
+			return nil, fmt.Errorf("Payload too long (%d bytes)", len(f.Payload))
+		}
+
+		putHeader(&buf, f.Major, f.Minor, f.Type, f.Operand, uint32(f.Role))
+		putUint32(&buf, uint32(f.Capabilities))
+		putUUID(&buf, f.Source)
+		putUUID(&buf, f.Destination)
+		putUint32(&buf, uint32(len(f.Payload)))
+		buf.Write(f.Payload)
+
+	case *Frame:
+		if len(f.Payload) > maxPayloadLength {
+			return nil, fmt.Errorf("Payload too long (%d bytes)", len(f.Payload))
+		}
+
+		trace, err := encodeTrace(f.Trace)
+		if err != nil {
+			return nil, err
+		}
+
+		putHeader(&buf, f.Major, f.Minor, f.Type, f.Operand, uint32(len(f.Payload)))
+		putUUID(&buf, f.Origin[:])
+		putUint32(&buf, uint32(len(trace)))
+		buf.Write(trace)
+		buf.Write(f.Payload)
+
+	default:
+		return nil, fmt.Errorf("Unsupported frame type %T", frame)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *binaryCodec) encode(frame interface{}) error {
+	b, err := marshalFrame(frame)
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	_, err = c.w.Write(b)
+
+	return err
+}
+
+// readBytes reads n bytes without trusting n for allocating
+// the whole buffer upfront.
+func readBytes(r io.Reader, n uint32) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if n == 0 {
+		return nil, nil
+	}
+
+	_, err := io.CopyN(&buf, r, int64(n))
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return buf.Bytes(), err
+}
+
+func getTimestamp(b []byte) time.Time {
+	ns := int64(binary.BigEndian.Uint64(b))
+	if ns == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ns)
+}
+
+func decodeTrace(b []byte) (*FrameTrace, error) {
+	var trace FrameTrace
+
+	if len(b) < 2 {
+		return nil, fmt.Errorf("Truncated frame trace")
+	}
+
+	labelLength := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < labelLength+2*timestampLength+1 {
+		return nil, fmt.Errorf("Truncated frame trace")
+	}
+
+	if labelLength > 0 {
+		trace.Label = append([]byte(nil), b[:labelLength]...)
+	}
+	b = b[labelLength:]
+
+	trace.StartTimestamp = getTimestamp(b)
+	trace.EndTimestamp = getTimestamp(b[timestampLength:])
+	trace.PathLength = b[2*timestampLength]
+	b = b[2*timestampLength+1:]
+
+	if len(b) != int(trace.PathLength)*nodeLength {
+		return nil, fmt.Errorf("Invalid frame trace path length %d", trace.PathLength)
+	}
+
+	for i := 0; i < int(trace.PathLength); i++ {
+		n := b[i*nodeLength : (i+1)*nodeLength]
+		node := Node{
+			UUID:        append([]byte(nil), n[:uuidLength]...),
+			Role:        Role(binary.BigEndian.Uint32(n[uuidLength:])),
+			TxTimestamp: getTimestamp(n[uuidLength+4:]),
+			RxTimestamp: getTimestamp(n[uuidLength+4+timestampLength:]),
+		}
+
+		trace.Path = append(trace.Path, node)
+	}
+
+	return &trace, nil
+}
+
+func (c *binaryCodec) decodeConnect(header []byte, frame interface{}) error {
+	f, ok := frame.(*ConnectFrame)
+	if !ok {
+		return fmt.Errorf("Unexpected CONNECT frame")
+	}
+
+	var body [connectLength - headerLength]byte
+	if _, err := io.ReadFull(c.r, body[:]); err != nil {
+		return err
+	}
+
+	*f = ConnectFrame{
+		Major:        header[0],
+		Minor:        header[1],
+		Type:         Type(header[2]),
+		Operand:      header[3],
+		Role:         Role(binary.BigEndian.Uint32(header[4:])),
+		Capabilities: Capability(binary.BigEndian.Uint32(body[:])),
+		Source:       append([]byte(nil), body[4:4+uuidLength]...),
+		Destination:  append([]byte(nil), body[4+uuidLength:]...),
+	}
+
+	return nil
+}
+
+func (c *binaryCodec) decodeConnected(header []byte, frame interface{}) error {
+	f, ok := frame.(*ConnectedFrame)
+	if !ok {
+		return fmt.Errorf("Unexpected CONNECTED frame")
+	}
+
+	var body [4 + 2*uuidLength + 4]byte
+	if _, err := io.ReadFull(c.r, body[:]); err != nil {
+		return err
+	}
+
+	payloadLength := binary.BigEndian.Uint32(body[4+2*uuidLength:])
+	if payloadLength > maxPayloadLength {
+		return fmt.Errorf("Payload too long (%d bytes)", payloadLength)
+	}
+
+	payload, err := readBytes(c.r, payloadLength)
+	if err != nil {
+		return err
+	}
+
+	*f = ConnectedFrame{
+		Major:         header[0],
+		Minor:         header[1],
+		Type:          Type(header[2]),
+		Operand:       header[3],
+		Role:          Role(binary.BigEndian.Uint32(header[4:])),
+		Capabilities:  Capability(binary.BigEndian.Uint32(body[:])),
+		Source:        append([]byte(nil), body[4:4+uuidLength]...),
+		Destination:   append([]byte(nil), body[4+uuidLength:4+2*uuidLength]...),
+		PayloadLength: payloadLength,
+		Payload:       payload,
+	}
+
+	return nil
+}
+
+// Frame: header (Payload Length) | Origin | Trace Length (4) | Trace | Payload
+func (c *binaryCodec) decodeFrame(header []byte, frame interface{}) error {
+	var body [uuidLength + 4]byte
+	var trace *FrameTrace
+
+	payloadLength := binary.BigEndian.Uint32(header[4:])
+	if payloadLength > maxPayloadLength {
+		return fmt.Errorf("Payload too long (%d bytes)", payloadLength)
+	}
+
+	if _, err := io.ReadFull(c.r, body[:]); err != nil {
+		return err
+	}
+
+	traceLength := binary.BigEndian.Uint32(body[uuidLength:])
+	if traceLength > maxTraceLength {
+		return fmt.Errorf("Frame trace too long (%d bytes)", traceLength)
+	}
+
+	traceBytes, err := readBytes(c.r, traceLength)
+	if err != nil {
+		return err
+	}
+
+	if traceLength > 0 {
+		trace, err = decodeTrace(traceBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	payload, err := readBytes(c.r, payloadLength)
+	if err != nil {
+		return err
+	}
+
+	switch f := frame.(type) {
+	case *Frame:
+		*f = Frame{
+			Major:         header[0],
+			Minor:         header[1],
+			Type:          Type(header[2]),
+			Operand:       header[3],
+			PayloadLength: payloadLength,
+			Trace:         trace,
+			Payload:       payload,
+		}
+		copy(f.Origin[:], body[:uuidLength])
+
+	case *ConnectedFrame:
+		// Servers reply to CONNECT with an ERROR frame
+		// when refusing a connection.
+		*f = ConnectedFrame{
+			Major:         header[0],
+			Minor:         header[1],
+			Type:          Type(header[2]),
+			Operand:       header[3],
+			PayloadLength: payloadLength,
+			Payload:       payload,
+		}
+
+	default:
+		return fmt.Errorf("Unexpected %s frame", Type(header[2]))
+	}
+
+	return nil
+}
+
+func (c *binaryCodec) decode(frame interface{}) error {
+	var header [headerLength]byte
+
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return err
+	}
+
+	t := Type(header[2])
+	operand := header[3]
+
+	switch {
+	case t == COMMAND && operand == uint8(CONNECT):
+		return c.decodeConnect(header[:], frame)
+	case t == STATUS && operand == uint8(CONNECTED):
+		return c.decodeConnected(header[:], frame)
+	}
+
+	return c.decodeFrame(header[:], frame)
+}
@@ -0,0 +1,368 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssntp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/01org/ciao/ssntp/uuid"
+)
+
+var testSrc = uuid.Generate()
+var testDest = uuid.Generate()
+
+func testFrames() []interface{} {
+	start := time.Unix(0, time.Now().UnixNano())
+
+	return []interface{}{
+		&ConnectFrame{
+			Major:        Major,
+			Minor:        minor,
+			Type:         COMMAND,
+			Operand:      uint8(CONNECT),
+			Role:         AGENT | NETAGENT,
+			Source:       testSrc[:],
+			Destination:  testDest[:],
+			Capabilities: DefaultCapabilities,
+		},
+		&ConnectedFrame{
+			Major:         Major,
+			Minor:         minor,
+			Type:          STATUS,
+			Operand:       uint8(CONNECTED),
+			Role:          SCHEDULER,
+			Source:        testSrc[:],
+			Destination:   testDest[:],
+			Capabilities:  FrameTracingCapability,
+			PayloadLength: 4,
+			Payload:       []byte("YAML"),
+		},
+		&Frame{
+			Major:   Major,
+			Minor:   minor,
+			Type:    STATUS,
+			Operand: uint8(READY),
+			Origin:  testSrc,
+		},
+		&Frame{
+			Major:         Major,
+			Minor:         minor,
+			Type:          COMMAND,
+			Operand:       uint8(START),
+			Origin:        testSrc,
+			PayloadLength: 4,
+			Payload:       []byte("YAML"),
+		},
+		&Frame{
+			Major:         Major,
+			Minor:         minor,
+			Type:          EVENT,
+			Operand:       uint8(TenantAdded),
+			Origin:        testSrc,
+			PayloadLength: 4,
+			Trace:         &FrameTrace{Label: []byte("label")},
+			Payload:       []byte("YAML"),
+		},
+		&Frame{
+			Major:         Major | pathTraceEnabled,
+			Minor:         minor,
+			Type:          ERROR,
+			Operand:       uint8(StartFailure),
+			Origin:        testSrc,
+			PayloadLength: 4,
+			Trace: &FrameTrace{
+				StartTimestamp: start,
+				PathLength:     2,
+				Path: []Node{
+					{
+						UUID:        testSrc[:],
+						Role:        AGENT,
+						TxTimestamp: start.Add(time.Millisecond),
+					},
+					{
+						UUID:        testDest[:],
+						Role:        SERVER,
+						TxTimestamp: start.Add(3 * time.Millisecond),
+						RxTimestamp: start.Add(2 * time.Millisecond),
+					},
+				},
+			},
+			Payload: []byte("YAML"),
+		},
+	}
+}
+
+func TestBinaryCodec(t *testing.T) {
+	for _, frame := range testFrames() {
+		var buf bytes.Buffer
+
+		codec := newBinaryCodec(&buf, &buf)
+
+		err := codec.encode(frame)
+		if err != nil {
+			t.Fatalf("Could not encode %T: %s", frame, err)
+		}
+
+		decoded := reflect.New(reflect.TypeOf(frame).Elem()).Interface()
+		err = codec.decode(decoded)
+		if err != nil {
+			t.Fatalf("Could not decode %T: %s", frame, err)
+		}
+
+		if reflect.DeepEqual(frame, decoded) == false {
+			t.Errorf("Decoded frame mismatch:\n%+v\n%+v", frame, decoded)
+		}
+
+		if buf.Len() != 0 {
+			t.Errorf("%d bytes left after decoding %T", buf.Len(), frame)
+		}
+	}
+}
+
+func TestBinaryCodecConnectLength(t *testing.T) {
+	b, err := marshalFrame(testFrames()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) != connectLength {
+		t.Fatalf("Wrong CONNECT length: expected %d got %d", connectLength, len(b))
+	}
+}
+
+func TestBinaryCodecConnectionFailure(t *testing.T) {
+	var buf bytes.Buffer
+	var s session
+	var connected ConnectedFrame
+
+	codec := newBinaryCodec(&buf, &buf)
+
+	frame := s.errorFrame(ConnectionFailure, []byte("YAML"), nil)
+	err := codec.encode(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = codec.decode(&connected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if connected.Type != ERROR || connected.Operand != uint8(ConnectionFailure) ||
+		string(connected.Payload) != "YAML" {
+		t.Fatalf("Wrong connection failure frame %+v", connected)
+	}
+}
+
+func TestBinaryCodecTruncated(t *testing.T) {
+	for _, frame := range testFrames() {
+		b, err := marshalFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < len(b); i++ {
+			codec := newBinaryCodec(bytes.NewReader(b[:i]), nil)
+			decoded := reflect.New(reflect.TypeOf(frame).Elem()).Interface()
+
+			err = codec.decode(decoded)
+			if err == nil {
+				t.Fatalf("Decoded a %d bytes truncated %T", i, frame)
+			}
+		}
+	}
+}
+
+func TestBinaryCodecInvalid(t *testing.T) {
+	var frame Frame
+
+	tests := [][]byte{
+		// Payload length above maxPayloadLength
+		{0, minor, byte(COMMAND), byte(START), 0xff, 0xff, 0xff, 0xff},
+
+		// Trace length above maxTraceLength
+		append(append([]byte{0, minor, byte(COMMAND), byte(START), 0, 0, 0, 0},
+			testSrc[:]...), 0xff, 0xff, 0xff, 0xff),
+
+		// Trace path length not matching the trace length
+		append(append([]byte{0, minor, byte(COMMAND), byte(START), 0, 0, 0, 0},
+			testSrc[:]...), 0, 0, 0, 19,
+			0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1),
+	}
+
+	for _, b := range tests {
+		codec := newBinaryCodec(bytes.NewReader(b), nil)
+		if err := codec.decode(&frame); err == nil || err == io.ErrUnexpectedEOF {
+			t.Errorf("Expected an invalid frame error, got %v", err)
+		}
+	}
+}
+
+func TestServerCodecDetection(t *testing.T) {
+	connect := testFrames()[0]
+
+	var gobBuf bytes.Buffer
+	err := gob.NewEncoder(&gobBuf).Encode(connect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binaryBytes, err := marshalFrame(connect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		stream []byte
+		binary bool
+	}{
+		{gobBuf.Bytes(), false},
+		{binaryBytes, true},
+	}
+
+	for _, test := range tests {
+		var decoded ConnectFrame
+
+		codec, err := newServerCodec(bytes.NewReader(test.stream), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, binary := codec.(*binaryCodec); binary != test.binary {
+			t.Fatalf("Wrong codec detected, got %T", codec)
+		}
+
+		err = codec.decode(&decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reflect.DeepEqual(connect, &decoded) == false {
+			t.Errorf("Decoded CONNECT mismatch:\n%+v\n%+v", connect, decoded)
+		}
+	}
+}
+
+func TestNegotiateFraming(t *testing.T) {
+	frames := testFrames()
+
+	tests := []struct {
+		peerMinor        uint8
+		peerCapabilities Capability
+		binary           bool
+	}{
+		{minor, DefaultCapabilities, true},
+		{minor, FrameTracingCapability | ClusterConfigurationCapability, false},
+		{capabilitiesMinor, FrameTracingCapability, false},
+		{capabilitiesMinor - 1, 0, false},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+
+		codec := newGobCodec(bufio.NewReader(&buf), &buf)
+		session := newSession(&testSrc, AGENT, SERVER, nil, codec)
+		session.negotiate(test.peerMinor, test.peerCapabilities, DefaultCapabilities)
+
+		// The CONNECTED frame is always gob encoded.
+		err := session.codec.encode(frames[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		session.negotiateFraming()
+		if _, binary := session.codec.(*binaryCodec); binary != test.binary {
+			t.Fatalf("%d.%d %s peer: wrong codec %T", Major, test.peerMinor,
+				test.peerCapabilities, session.codec)
+		}
+
+		err = session.codec.encode(frames[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var connected ConnectedFrame
+		err = codec.decode(&connected)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var frame Frame
+		err = session.codec.decode(&frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reflect.DeepEqual(frames[2], &frame) == false {
+			t.Errorf("Decoded frame mismatch:\n%+v\n%+v", frames[2], frame)
+		}
+	}
+}
+
+// TestBinaryCodecDecodeRandom decodes randomly corrupted frames, and
+// checks that the decoder neither panics nor returns frames that cannot
+// be encoded back.  The random source is seeded for the test to be
+// reproducible.
+func TestBinaryCodecDecodeRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(0x55a7))
+
+	var streams [][]byte
+	for _, frame := range testFrames() {
+		b, err := marshalFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		streams = append(streams, b)
+	}
+
+	for i := 0; i < 10000; i++ {
+		var b []byte
+
+		if i%10 == 0 {
+			b = make([]byte, r.Intn(2*connectLength))
+			_, _ = r.Read(b)
+		} else {
+			b = append([]byte{}, streams[r.Intn(len(streams))]...)
+			for j := r.Intn(4) + 1; j > 0; j-- {
+				b[r.Intn(len(b))] = byte(r.Intn(256))
+			}
+			b = b[:r.Intn(len(b)+1)]
+		}
+
+		targets := []interface{}{&Frame{}, &ConnectFrame{}, &ConnectedFrame{}}
+
+		for _, frame := range targets {
+			codec := newBinaryCodec(bytes.NewReader(b), nil)
+			if codec.decode(frame) != nil {
+				continue
+			}
+
+			// Anything we decode must be encodable back.
+			if _, err := marshalFrame(frame); err != nil {
+				t.Fatalf("Could not encode %T decoded from %x: %s", frame, b, err)
+			}
+		}
+	}
+}
@@ -80,13 +80,14 @@ type Frame struct {
 
 // ConnectFrame is the SSNTP connection frame structure.
 type ConnectFrame struct {
-	Major       uint8
-	Minor       uint8
-	Type        Type
-	Operand     uint8
-	Role        Role
-	Source      []byte
-	Destination []byte
+	Major        uint8
+	Minor        uint8
+	Type         Type
+	Operand      uint8
+	Role         Role
+	Source       []byte
+	Destination  []byte
+	Capabilities Capability
 }
 
 // ConnectedFrame is the SSNTP connected frame structure.
@@ -98,6 +99,7 @@ type ConnectedFrame struct {
 	Role          Role
 	Source        []byte
 	Destination   []byte
+	Capabilities  Capability
 	PayloadLength uint32
 	Payload       []byte
 }
@@ -191,8 +193,8 @@ func (f ConnectFrame) String() string {
 	copy(src[:], f.Source[:16])
 	copy(dest[:], f.Destination[:16])
 
-	return fmt.Sprintf("\tMajor %d\n\tMinor %d\n\tType %s\n\tOp %s\n\tRole %s\n\tSource %s\n\tDestination %s\n",
-		f.Major, f.Minor, (Type)(f.Type), op, &f.Role, src, dest)
+	return fmt.Sprintf("\tMajor %d\n\tMinor %d\n\tType %s\n\tOp %s\n\tRole %s\n\tSource %s\n\tDestination %s\n\tCapabilities %s\n",
+		f.Major, f.Minor, (Type)(f.Type), op, &f.Role, src, dest, f.Capabilities)
 }
 
 func (f ConnectedFrame) String() string {
@@ -212,8 +214,8 @@ func (f ConnectedFrame) String() string {
 	copy(src[:], f.Source[:16])
 	copy(dest[:], f.Destination[:16])
 
-	return fmt.Sprintf("\tMajor %d\n\tMinor %d\n\tType %s\n\tOp %s\n\tRole %s\n\tSource %s\n\tDestination %s\n",
-		f.Major, f.Minor, (Type)(f.Type), op, &f.Role, src, dest)
+	return fmt.Sprintf("\tMajor %d\n\tMinor %d\n\tType %s\n\tOp %s\n\tRole %s\n\tSource %s\n\tDestination %s\n\tCapabilities %s\n",
+		f.Major, f.Minor, (Type)(f.Type), op, &f.Role, src, dest, f.Capabilities)
 }
 
 func (f *Frame) addPathNode(session *session) {
@@ -0,0 +1,52 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build gofuzz
+
+package ssntp
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Fuzz is the go-fuzz (https://github.com/dvyukov/go-fuzz) entry point
+// for the binary frame decoder:
+//
+//	go-fuzz-build github.com/01org/ciao/ssntp
+//	go-fuzz -bin=ssntp-fuzz.zip -workdir=fuzz
+//
+// The decoder must not panic on any input, and anything it decodes
+// must be encodable back.
+func Fuzz(data []byte) int {
+	ret := 0
+	targets := []interface{}{&Frame{}, &ConnectFrame{}, &ConnectedFrame{}}
+
+	for _, frame := range targets {
+		codec := newBinaryCodec(bytes.NewReader(data), nil)
+		if codec.decode(frame) != nil {
+			continue
+		}
+
+		if _, err := marshalFrame(frame); err != nil {
+			panic(fmt.Sprintf("Could not encode %T decoded from %x: %s", frame, data, err))
+		}
+
+		ret = 1
+	}
+
+	return ret
+}
@@ -0,0 +1,96 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssntp
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ReconnectConfig is the SSNTP client reconnection policy.
+// SSNTP clients losing their server keep on trying to reconnect to
+// it, waiting for an exponentially growing, randomized delay between
+// each attempt. While disconnected, the STATUS, EVENT and ERROR frames
+// they send are queued and then replayed once reconnected.
+type ReconnectConfig struct {
+	// Disable turns automatic reconnection off. Clients will then
+	// be closed when losing their server.
+	Disable bool
+
+	// Delay is the maximum delay before the first reconnection
+	// attempt. The default is 1 second.
+	Delay time.Duration
+
+	// MaxDelay caps the delay between 2 reconnection attempts.
+	// The default is 40 seconds.
+	MaxDelay time.Duration
+
+	// QueueLength is the maximum number of frames queued while
+	// disconnected. Frames sent while the queue is full are
+	// rejected. The default is 256, a negative value disables
+	// frame queuing.
+	QueueLength int
+}
+
+const defaultReconnectDelay = 1 * time.Second
+const defaultReconnectMaxDelay = 40 * time.Second
+const defaultQueueLength = 256
+
+type backoff struct {
+	delay    time.Duration
+	maxDelay time.Duration
+	r        *rand.Rand
+}
+
+func newBackoff(config ReconnectConfig) *backoff {
+	return &backoff{
+		delay:    config.Delay,
+		maxDelay: config.MaxDelay,
+		r:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// next returns a random delay between half and all of the current
+// delay, and doubles the latter.
+func (b *backoff) next() time.Duration {
+	delay := b.delay
+
+	b.delay *= 2
+	if b.delay > b.maxDelay {
+		b.delay = b.maxDelay
+	}
+
+	return delay/2 + time.Duration(b.r.Int63n(int64(delay/2)+1))
+}
+
+type frameQueue struct {
+	sync.Mutex
+	frames []*Frame
+	length int
+}
+
+func (queue *frameQueue) push(frame *Frame) error {
+	if len(queue.frames) >= queue.length {
+		return fmt.Errorf("Client not connected, frame queue full")
+	}
+
+	queue.frames = append(queue.frames, frame)
+
+	return nil
+}
@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssntp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(ReconnectConfig{
+		Delay:    time.Second,
+		MaxDelay: 5 * time.Second,
+	})
+
+	expected := []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+	}
+
+	for _, max := range expected {
+		delay := b.next()
+		if delay < max/2 || delay > max {
+			t.Errorf("Delay %s out of [%s, %s]", delay, max/2, max)
+		}
+	}
+}
+
+func TestReconnectConfig(t *testing.T) {
+	tests := []struct {
+		config   *ReconnectConfig
+		expected ReconnectConfig
+	}{
+		{
+			nil,
+			ReconnectConfig{
+				Delay:       defaultReconnectDelay,
+				MaxDelay:    defaultReconnectMaxDelay,
+				QueueLength: defaultQueueLength,
+			},
+		},
+		{
+			&ReconnectConfig{Disable: true, QueueLength: -1},
+			ReconnectConfig{
+				Disable:     true,
+				Delay:       defaultReconnectDelay,
+				MaxDelay:    defaultReconnectMaxDelay,
+				QueueLength: 0,
+			},
+		},
+		{
+			&ReconnectConfig{Delay: time.Minute, QueueLength: 10},
+			ReconnectConfig{
+				Delay:       time.Minute,
+				MaxDelay:    time.Minute,
+				QueueLength: 10,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		config := Config{Reconnect: test.config}
+		reconnect := config.reconnect()
+		if reconnect != test.expected {
+			t.Errorf("Expected %+v, got %+v", test.expected, reconnect)
+		}
+	}
+}
+
+func TestFrameQueue(t *testing.T) {
+	queue := frameQueue{length: 2}
+
+	for i := 0; i < queue.length; i++ {
+		if err := queue.push(&Frame{}); err != nil {
+			t.Fatalf("Could not queue frame #%d: %s", i, err)
+		}
+	}
+
+	if err := queue.push(&Frame{}); err == nil {
+		t.Fatal("Frame queued on a full queue")
+	}
+}
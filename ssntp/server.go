@@ -18,14 +18,15 @@ package ssntp
 
 import (
 	"crypto/tls"
-	"encoding/gob"
 	"fmt"
 	"net"
 	"sync"
 	"time"
 
 	"github.com/01org/ciao/configuration"
+	"github.com/01org/ciao/payloads"
 	"github.com/01org/ciao/ssntp/uuid"
+	"gopkg.in/yaml.v2"
 )
 
 // ServerNotifier is the SSNTP server notification interface.
@@ -75,6 +76,9 @@ type Server struct {
 	roleVerify    bool
 	clientWg      sync.WaitGroup
 
+	capabilities         Capability
+	requiredCapabilities Capability
+
 	forwardRules frameForward
 
 	log Logger
@@ -84,22 +88,36 @@ type Server struct {
 	configuration clusterConfiguration
 }
 
-func sendConnectionFailure(conn net.Conn) *session {
+func sendConnectionFailure(codec frameCodec, payload []byte) *session {
 	var session session
-	encoder := gob.NewEncoder(conn)
 
-	frame := session.errorFrame(ConnectionFailure, nil, nil)
-	encoder.Encode(frame)
+	frame := session.errorFrame(ConnectionFailure, payload, nil)
+	codec.encode(frame)
 
 	return nil
 }
 
-func sendConnectionAborted(conn net.Conn) *session {
+func connectionFailurePayload(reason payloads.ConnectionFailureReason, missing Capability) []byte {
+	failure := payloads.ErrorConnectionFailure{
+		Reason:       reason,
+		Major:        Major,
+		Minor:        minor,
+		Capabilities: missing.String(),
+	}
+
+	payload, err := yaml.Marshal(&failure)
+	if err != nil {
+		return nil
+	}
+
+	return payload
+}
+
+func sendConnectionAborted(codec frameCodec) *session {
 	var session session
-	encoder := gob.NewEncoder(conn)
 
 	frame := session.errorFrame(ConnectionAborted, nil, nil)
-	encoder.Encode(frame)
+	codec.encode(frame)
 
 	return nil
 }
@@ -107,15 +125,16 @@ func sendConnectionAborted(conn net.Conn) *session {
 func handleClientConnect(server *Server, conn net.Conn) *session {
 	var connect ConnectFrame
 
-	decoder := gob.NewDecoder(conn)
-
 	server.log.Infof("Waiting for CONNECT\n")
 	setReadTimeout(conn)
-	readErr := decoder.Decode(&connect)
+	codec, readErr := newServerCodec(conn, conn)
+	if readErr == nil {
+		readErr = codec.decode(&connect)
+	}
 	clearReadTimeout(conn)
 	if readErr != nil {
 		server.log.Errorf("Connect error: %s\n", readErr)
-		return sendConnectionFailure(conn)
+		return sendConnectionFailure(codec, nil)
 	}
 
 	server.log.Infof("Received CONNECT frame:\n%s\n", connect)
@@ -125,30 +144,49 @@ func handleClientConnect(server *Server, conn net.Conn) *session {
 		oidFound, err := verifyRole(tlscon, connect.Role)
 		if oidFound == false {
 			server.log.Errorf("%s\n", err)
-			return sendConnectionAborted(conn)
+			return sendConnectionAborted(codec)
 		}
 	}
 
 	if connect.Type != COMMAND || connect.Operand != (uint8)(CONNECT) {
 		server.log.Errorf("Invalid Connect frame")
-		return sendConnectionFailure(conn)
+		return sendConnectionFailure(codec, nil)
 	}
 
-	session := newSession(&server.uuid, server.role, connect.Role, conn)
+	if connect.Major&majorMask != Major {
+		server.log.Errorf("Incompatible SSNTP version %d.%d, expected %d.x\n",
+			connect.Major&majorMask, connect.Minor, Major)
+		return sendConnectionFailure(codec, connectionFailurePayload(payloads.IncompatibleVersion, 0))
+	}
+
+	session := newSession(&server.uuid, server.role, connect.Role, conn, codec)
 	session.setDest(connect.Source[:16])
+	session.negotiate(connect.Minor, connect.Capabilities, server.capabilities)
 
-	/* TODO Get the CONFIGURE payload from the config package */
-	server.configuration.RLock()
-	connected := session.connectedFrame(server.role, server.configuration.configuration)
-	server.configuration.RUnlock()
+	missing := server.requiredCapabilities &^ session.capabilities
+	if missing != 0 {
+		server.log.Errorf("Client is missing SSNTP capabilities %s\n", missing)
+		return sendConnectionFailure(codec, connectionFailurePayload(payloads.MissingCapabilities, missing))
+	}
+
+	var configuration []byte
+	if session.capabilities.HasCapability(ClusterConfigurationCapability) {
+		/* TODO Get the CONFIGURE payload from the config package */
+		server.configuration.RLock()
+		configuration = server.configuration.configuration
+		server.configuration.RUnlock()
+	}
+	connected := session.connectedFrame(server.role, configuration)
 
 	server.log.Infof("Sending CONNECTED\n")
 	_, writeErr := session.Write(connected)
 	if writeErr != nil {
 		server.log.Errorf("Connected error: %s\n", writeErr)
-		return sendConnectionFailure(conn)
+		return sendConnectionFailure(codec, nil)
 	}
 
+	session.negotiateFraming()
+
 	return session
 }
 
@@ -246,6 +284,8 @@ func (server *Server) Serve(config *Config, ntf ServerNotifier) error {
 	server.role = role
 
 	server.lUUID, server.uuid = config.configUUID(server.role)
+	server.capabilities = config.capabilities()
+	server.requiredCapabilities = config.RequiredCapabilities
 	serverPort = config.port()
 	transport := config.transport()
 	uri = config.URI
@@ -464,3 +504,13 @@ func (server *Server) ClientRole(uuid string) (Role, error) {
 	}
 	return session.destRole, nil
 }
+
+// ClientCapabilities returns the SSNTP capabilities negotiated with the
+// session peer with the specified uuid.
+func (server *Server) ClientCapabilities(uuid string) (Capability, error) {
+	session := server.getSession(uuid)
+	if session == nil {
+		return 0, fmt.Errorf("SSNTP session missing for uuid %s", uuid)
+	}
+	return session.capabilities, nil
+}
@@ -17,7 +17,6 @@
 package ssntp
 
 import (
-	"encoding/gob"
 	"net"
 	"time"
 
@@ -47,14 +46,17 @@ type session struct {
 	destRole Role
 	conn     net.Conn
 
-	encoder *gob.Encoder
-	decoder *gob.Decoder
+	// negotiated protocol minor version and capabilities
+	minor        uint8
+	capabilities Capability
+
+	codec frameCodec
 }
 
 /*
  * session methods
  */
-func newSession(src *uuid.UUID, srcRole Role, destRole Role, netConn net.Conn) *session {
+func newSession(src *uuid.UUID, srcRole Role, destRole Role, netConn net.Conn, codec frameCodec) *session {
 	var session session
 
 	if src != nil {
@@ -63,10 +65,10 @@ func newSession(src *uuid.UUID, srcRole Role, destRole Role, netConn net.Conn) *
 
 	session.srcRole = srcRole
 	session.destRole = destRole
+	session.minor = minor
 
 	session.conn = netConn
-	session.encoder = gob.NewEncoder(netConn)
-	session.decoder = gob.NewDecoder(netConn)
+	session.codec = codec
 
 	return &session
 }
@@ -75,6 +77,43 @@ func (session *session) setDest(uuid []byte) {
 	copy(session.dest[:], uuid[:16])
 }
 
+// negotiate downgrades the session to the lowest common minor version
+// and to the capabilities supported by both peers.
+func (session *session) negotiate(peerMinor uint8, peerCapabilities Capability, capabilities Capability) {
+	if peerMinor < session.minor {
+		session.minor = peerMinor
+	}
+
+	if peerMinor < capabilitiesMinor {
+		peerCapabilities = legacyCapabilities
+	}
+
+	session.capabilities = capabilities & peerCapabilities
+}
+
+// negotiateFraming switches the session to the binary framing when
+// both peers support it.  Sessions start with the gob framing legacy
+// peers understand, and switch right after the CONNECTED frame.
+func (session *session) negotiateFraming() {
+	if session.capabilities.HasCapability(BinaryFramingCapability) == false {
+		return
+	}
+
+	if codec, ok := session.codec.(*gobCodec); ok {
+		session.codec = codec.binaryCodec()
+	}
+}
+
+// frameTrace drops the tracing configuration for peers that do not
+// accept traced frames.
+func (session *session) frameTrace(trace *TraceConfig) *TraceConfig {
+	if session.capabilities.HasCapability(FrameTracingCapability) == false {
+		return nil
+	}
+
+	return trace
+}
+
 func (session *session) connectedFrame(serverRole Role, payload []byte) (f *ConnectedFrame) {
 	f = &ConnectedFrame{
 		Major:         Major,
@@ -84,6 +123,7 @@ func (session *session) connectedFrame(serverRole Role, payload []byte) (f *Conn
 		Role:          serverRole,
 		Source:        session.src[:],
 		Destination:   session.dest[:],
+		Capabilities:  session.capabilities,
 		PayloadLength: (uint32)(len(payload)),
 		Payload:       payload,
 	}
@@ -93,13 +133,14 @@ func (session *session) connectedFrame(serverRole Role, payload []byte) (f *Conn
 
 func (session *session) connectFrame() (f *ConnectFrame) {
 	f = &ConnectFrame{
-		Major:       Major,
-		Minor:       minor,
-		Type:        COMMAND,
-		Operand:     byte(CONNECT),
-		Role:        session.srcRole,
-		Source:      session.src[:],
-		Destination: session.dest[:],
+		Major:        Major,
+		Minor:        minor,
+		Type:         COMMAND,
+		Operand:      byte(CONNECT),
+		Role:         session.srcRole,
+		Source:       session.src[:],
+		Destination:  session.dest[:],
+		Capabilities: session.capabilities,
 	}
 
 	return
@@ -116,7 +157,7 @@ func (session *session) commandFrame(cmd Command, payload []byte, trace *TraceCo
 		Payload:       payload,
 	}
 
-	f.setTrace(trace)
+	f.setTrace(session.frameTrace(trace))
 	f.addPathNode(session)
 
 	return
@@ -133,7 +174,7 @@ func (session *session) statusFrame(status Status, payload []byte, trace *TraceC
 		Payload:       payload,
 	}
 
-	f.setTrace(trace)
+	f.setTrace(session.frameTrace(trace))
 	f.addPathNode(session)
 
 	return
@@ -150,7 +191,7 @@ func (session *session) eventFrame(event Event, payload []byte, trace *TraceConf
 		Payload:       payload,
 	}
 
-	f.setTrace(trace)
+	f.setTrace(session.frameTrace(trace))
 	f.addPathNode(session)
 
 	return
@@ -167,7 +208,7 @@ func (session *session) errorFrame(error Error, payload []byte, trace *TraceConf
 		Payload:       payload,
 	}
 
-	f.setTrace(trace)
+	f.setTrace(session.frameTrace(trace))
 	f.addPathNode(session)
 
 	return
@@ -184,14 +225,14 @@ func (session *session) Write(frame interface{}) (int, error) {
 	}
 
 	setWriteTimeout(session.conn)
-	err := session.encoder.Encode(frame)
+	err := session.codec.encode(frame)
 	clearWriteTimeout(session.conn)
 
 	return 0, err
 }
 
 func (session *session) Read(frame interface{}) error {
-	err := session.decoder.Decode(frame)
+	err := session.codec.decode(frame)
 
 	switch f := frame.(type) {
 	case *Frame:
@@ -42,7 +42,8 @@ type Type uint8
 
 // Command is the SSNTP Command operand.
 // It can be CONNECT, START, STOP, STATS, EVACUATE, DELETE, RESTART,
-// AssignPublicIP, ReleasePublicIP, CONFIGURE, AttachVolume or DetachVolume.
+// AssignPublicIP, ReleasePublicIP, CONFIGURE, AttachVolume, DetachVolume,
+// MIGRATE, CreateImage, GetConsole or UpdateLimits.
 type Command uint8
 
 // Status is the SSNTP Status operand.
@@ -56,13 +57,16 @@ type Role uint32
 // Error is the SSNTP Error operand.
 // It can be InvalidFrameType Error, StartFailure,
 // StopFailure, ConnectionFailure, RestartFailure,
-// DeleteFailure, ConnectionAborted or InvalidConfiguration.
+// DeleteFailure, ConnectionAborted, InvalidConfiguration,
+// AttachVolumeFailure, DetachVolumeFailure, MigrateFailure,
+// CreateImageFailure, GetConsoleFailure or UpdateLimitsFailure.
 type Error uint8
 
 // Event is the SSNTP Event operand.
 // It can be TenantAdded, TenantRemoval, InstanceDeleted,
 // ConcentratorInstanceAdded, PublicIPAssigned, TraceReport,
-// NodeConnected or NodeDisconnected
+// NodeConnected, NodeDisconnected, InstanceEvacuated, ControllerPromoted
+// or ConsoleOutput.
 type Event uint8
 
 const (
@@ -96,10 +100,10 @@ const (
 	// frame:
 	//					   SSNTP CONNECT Command frame
 	//
-	//	+-------------------------------------------------------------+
-	//	| Major | Minor | Type  | Operand |          Role             |
-	//	|       |       | (0x0) |  (0x0)  | (bitmask of client roles) |
-	//	+-------------------------------------------------------------+
+	//	+------------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |          Role             |  Capabilities    |
+	//	|       |       | (0x0) |  (0x0)  | (bitmask of client roles) | (client bitmask) |
+	//	+------------------------------------------------------------------------------+
 	CONNECT Command = iota
 
 	// START is a command that should reach CIAO agents for scheduling a new
@@ -253,6 +257,64 @@ const (
 	//	|       |       | (0x0) |  (0xb)  |                 |                         |
 	//	+-----------------------------------------------------------------------------+
 	DetachVolume
+
+	// MIGRATE is a command sent to ciao-launcher for live migrating a running
+	// instance to another compute node.
+	//
+	// The MIGRATE command payload includes an instance UUID and the URI on
+	// which the destination node is waiting for the instance.  The destination
+	// node must have been sent a START command with a matching incoming
+	// migration URI beforehand.
+	//
+	//                                       SSNTP MIGRATE Command frame
+	//	+-----------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted payload  |
+	//	|       |       | (0x0) |  (0xc)  |                 |                         |
+	//	+-----------------------------------------------------------------------------+
+	MIGRATE
+
+	// CreateImage is a command sent to ciao-launcher for creating an image
+	// from the root filesystem of a specific instance.
+	//
+	// The CreateImage command payload includes an instance UUID, the UUID
+	// of an image previously created in the image service and the
+	// information needed to upload the instance snapshot to that image.
+	//
+	//                                       SSNTP CreateImage Command frame
+	//	+-----------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted payload  |
+	//	|       |       | (0x0) |  (0xd)  |                 |                         |
+	//	+-----------------------------------------------------------------------------+
+	CreateImage
+
+	// GetConsole is a command sent to ciao-launcher for fetching the
+	// serial console log of a specific instance.  ciao-launcher replies
+	// with a ConsoleOutput event or a GetConsoleFailure error.
+	//
+	// The GetConsole command payload includes an instance UUID and the
+	// maximum number of lines to return.
+	//
+	//                                       SSNTP GetConsole Command frame
+	//	+-----------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted payload  |
+	//	|       |       | (0x0) |  (0xe)  |                 |                         |
+	//	+-----------------------------------------------------------------------------+
+	GetConsole
+
+	// UpdateLimits is a command sent to ciao-launcher for changing the
+	// resource limits, e.g., CPU shares or memory limit, of a specific
+	// instance.  ciao-launcher replies with an UpdateLimitsFailure error
+	// if the limits cannot be changed.
+	//
+	// The UpdateLimits command payload includes an instance UUID and the
+	// new limits.
+	//
+	//                                       SSNTP UpdateLimits Command frame
+	//	+-----------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted payload  |
+	//	|       |       | (0x0) |  (0xf)  |                 |                         |
+	//	+-----------------------------------------------------------------------------+
+	UpdateLimits
 )
 
 const (
@@ -260,14 +322,15 @@ const (
 	// send such frame. The CONNECTED status confirms the client that it's connected and
 	// that it should be prepared to process and send commands and statuses.
 	// The CONNECTED payload contains the cloud configuration data. Please refer to the
-	// CONFIGURE command frame for more details.
+	// CONFIGURE command frame for more details. The CONNECTED Minor and Capabilities
+	// fields carry the negotiated protocol minor version and capabilities.
 	//
 	//					 SSNTP CONNECTED Status frame
 	//
-	//	+--------------------------------------------------------------------------------------------------------------------+
-	//	| Major | Minor | Type  | Operand |         Role              | Server UUID | Client UUID | Payload | YAML formatted |
-	//	|       |       | (0x1) |  (0x0)  | (bitmask of server roles) |             |             |  Length |      payload   |
-	//	+--------------------------------------------------------------------------------------------------------------------+
+	//	+---------------------------------------------------------------------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |         Role              | Capabilities | Server UUID | Client UUID | Payload | YAML formatted |
+	//	|       |       | (0x1) |  (0x0)  | (bitmask of server roles) | (negotiated) |             |             |  Length |      payload   |
+	//	+---------------------------------------------------------------------------------------------------------------------------------------+
 	CONNECTED Status = iota
 
 	// READY is a status command CIAO agents send to the scheduler to notify them about
@@ -438,6 +501,49 @@ const (
 	//	|       |       | (0x3) |  (0x7)  |                 |                        |
 	//	+----------------------------------------------------------------------------+
 	NodeDisconnected
+
+	// InstanceEvacuated is sent by workload agents to notify the scheduler and the Controller
+	// that an instance has been removed from a node being evacuated. Unlike InstanceDeleted,
+	// this event does not mean the instance is gone: the Controller is expected to start it
+	// again on another node.
+	// The InstanceEvacuated event payload contains the instance UUID and the evacuated node UUID.
+	//
+	//					 SSNTP InstanceEvacuated Event frame
+	//
+	//	+----------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted payload |
+	//	|       |       | (0x3) |  (0x8)  |                 |                        |
+	//	+----------------------------------------------------------------------------+
+	InstanceEvacuated
+
+	// ControllerPromoted is sent by the Scheduler to a backup Controller when it
+	// becomes the master Controller, i.e. when the previous master Controller
+	// disconnected. From then on the Scheduler forwards the STATS commands and
+	// the Controller bound events and errors to that Controller only.
+	// The ControllerPromoted event payload contains the promoted Controller UUID
+	// and the latest STATS payload received from each node, so that the new master
+	// Controller can reconcile its state with the nodes.
+	//
+	//					 SSNTP ControllerPromoted Event frame
+	//
+	//	+----------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted payload |
+	//	|       |       | (0x3) |  (0x9)  |                 |                        |
+	//	+----------------------------------------------------------------------------+
+	ControllerPromoted
+
+	// ConsoleOutput is sent by workload agents in reply to a GetConsole
+	// command. The Scheduler must forward it to the Controllers.
+	// The ConsoleOutput event payload contains the instance UUID and the
+	// tail of the instance serial console log.
+	//
+	//					 SSNTP ConsoleOutput Event frame
+	//
+	//	+----------------------------------------------------------------------------+
+	//	| Major | Minor | Type  | Operand |  Payload Length | YAML formatted payload |
+	//	|       |       | (0x3) |  (0xa)  |                 |                        |
+	//	+----------------------------------------------------------------------------+
+	ConsoleOutput
 )
 
 // SSNTP clients and servers can have one or several roles and are expected to declare their
@@ -497,7 +603,10 @@ const (
 	StopFailure
 
 	// ConnectionFailure is sent to report an SSNTP connection failure.
-	// It can be sent by servers and clients.
+	// It can be sent by servers and clients. When the peers speak
+	// incompatible protocol versions or lack required capabilities,
+	// the failure carries a payloads.ErrorConnectionFailure payload
+	// and the connection must not be retried.
 	ConnectionFailure
 
 	// RestartFailure is sent by launcher agents to report a workload re-start failure.
@@ -525,11 +634,58 @@ const (
 	// DetachVolumeFailure is sent by launcher agents to report a failure to detach
 	// a volume from an instance.
 	DetachVolumeFailure
+
+	// MigrateFailure is sent by launcher agents to report a failure to migrate
+	// an instance to another node.
+	MigrateFailure
+
+	// CreateImageFailure is sent by launcher agents to report a failure to
+	// create an image from an instance.
+	CreateImageFailure
+
+	// GetConsoleFailure is sent by launcher agents to report a failure to
+	// read the console log of an instance.
+	GetConsoleFailure
+
+	// UpdateLimitsFailure is sent by launcher agents to report a failure
+	// to change the resource limits of an instance.
+	UpdateLimitsFailure
 )
 
+// Capability is a bitmask of optional SSNTP protocol features.
+// Clients advertise their capabilities in the CONNECT frame and
+// servers reply with the negotiated ones, i.e. the capabilities
+// both ends support, in the CONNECTED frame.
+type Capability uint32
+
+const (
+	// FrameTracingCapability is set by peers accepting labelled
+	// and path traced frames.
+	FrameTracingCapability Capability = 1 << iota
+
+	// ClusterConfigurationCapability is set by clients expecting
+	// the cluster configuration data in the CONNECTED payload.
+	ClusterConfigurationCapability
+
+	// BinaryFramingCapability is set by peers supporting the SSNTP
+	// binary framing.  Peers switch from the legacy gob framing to
+	// the binary one after the CONNECTED frame when it is negotiated.
+	BinaryFramingCapability
+)
+
+// DefaultCapabilities is the set of capabilities advertised by
+// SSNTP clients and servers when their Config does not specify any.
+const DefaultCapabilities = FrameTracingCapability | ClusterConfigurationCapability |
+	BinaryFramingCapability
+
+// Peers speaking an older minor version do not advertise their
+// capabilities, they implicitly support the legacy ones.
+const capabilitiesMinor = 2
+const legacyCapabilities = FrameTracingCapability | ClusterConfigurationCapability
+
 // Major is the SSNTP protocol major version
 const Major = 0
-const minor = 1
+const minor = 3
 const defaultURL = "localhost"
 const port = 8888
 const readTimeout = 30
@@ -580,6 +736,14 @@ func (command Command) String() string {
 		return "Attach storage volume"
 	case DetachVolume:
 		return "Detach storage volume"
+	case MIGRATE:
+		return "MIGRATE"
+	case CreateImage:
+		return "Create instance image"
+	case GetConsole:
+		return "Get instance console"
+	case UpdateLimits:
+		return "Update instance limits"
 	}
 
 	return ""
@@ -620,6 +784,12 @@ func (status Event) String() string {
 		return "Node Connected"
 	case NodeDisconnected:
 		return "Node Disconnected"
+	case InstanceEvacuated:
+		return "Instance Evacuated"
+	case ControllerPromoted:
+		return "Controller Promoted"
+	case ConsoleOutput:
+		return "Console Output"
 	}
 
 	return ""
@@ -643,11 +813,43 @@ func (error Error) String() string {
 		return "SSNTP Connection aborted"
 	case InvalidConfiguration:
 		return "Cluster configuration is invalid"
+	case MigrateFailure:
+		return "Could not migrate instance"
+	case CreateImageFailure:
+		return "Could not create instance image"
+	case GetConsoleFailure:
+		return "Could not get instance console"
+	case UpdateLimitsFailure:
+		return "Could not update instance limits"
 	}
 
 	return ""
 }
 
+// HasCapability checks if a capability set contains all the
+// specified capabilities.
+func (c Capability) HasCapability(cmp Capability) bool {
+	return c&cmp == cmp
+}
+
+func (c Capability) String() string {
+	capabilityStrings := []string{}
+
+	if c.HasCapability(FrameTracingCapability) {
+		capabilityStrings = append(capabilityStrings, "FrameTracing")
+	}
+
+	if c.HasCapability(ClusterConfigurationCapability) {
+		capabilityStrings = append(capabilityStrings, "ClusterConfiguration")
+	}
+
+	if c.HasCapability(BinaryFramingCapability) {
+		capabilityStrings = append(capabilityStrings, "BinaryFraming")
+	}
+
+	return strings.Join(capabilityStrings, "-")
+}
+
 // HasRole checks if a role instance has the specified role
 func (role *Role) HasRole(cmp Role) bool {
 	if *role&cmp == cmp {
@@ -856,6 +1058,19 @@ type Config struct {
 	// ConfigURI contains the location of the configuration that the
 	// SSNTP server will fetch to setup the cluster.
 	ConfigURI string
+
+	// Capabilities is the set of SSNTP capabilities advertised
+	// when connecting. If set to 0, DefaultCapabilities will be used.
+	Capabilities Capability
+
+	// RequiredCapabilities is the set of capabilities the peer must
+	// support. A connection is refused with a ConnectionFailure error
+	// when one of them is not negotiated.
+	RequiredCapabilities Capability
+
+	// Reconnect is the SSNTP clients reconnection policy.
+	// If not set, the default policy will be used.
+	Reconnect *ReconnectConfig
 }
 
 // Logger is an interface for SSNTP users to define their own
@@ -1181,6 +1396,14 @@ func (config *Config) role() (Role, error) {
 	return role, nil
 }
 
+func (config *Config) capabilities() Capability {
+	if config.Capabilities == 0 {
+		return DefaultCapabilities
+	}
+
+	return config.Capabilities
+}
+
 func (config *Config) port() uint32 {
 	if config.Port != 0 {
 		return config.Port
@@ -1189,6 +1412,33 @@ func (config *Config) port() uint32 {
 	return port
 }
 
+func (config *Config) reconnect() ReconnectConfig {
+	var reconnect ReconnectConfig
+
+	if config.Reconnect != nil {
+		reconnect = *config.Reconnect
+	}
+
+	if reconnect.Delay <= 0 {
+		reconnect.Delay = defaultReconnectDelay
+	}
+
+	if reconnect.MaxDelay < reconnect.Delay {
+		reconnect.MaxDelay = defaultReconnectMaxDelay
+		if reconnect.MaxDelay < reconnect.Delay {
+			reconnect.MaxDelay = reconnect.Delay
+		}
+	}
+
+	if reconnect.QueueLength == 0 {
+		reconnect.QueueLength = defaultQueueLength
+	} else if reconnect.QueueLength < 0 {
+		reconnect.QueueLength = 0
+	}
+
+	return reconnect
+}
+
 func loadCertificate(certPath string) (*x509.Certificate, error) {
 	certPEM, err := ioutil.ReadFile(certPath)
 	if err != nil {
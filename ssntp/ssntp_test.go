@@ -1169,6 +1169,251 @@ func TestClientReconnect(t *testing.T) {
 	server.ssntp.Stop()
 }
 
+func reconnectTestClient(t *testing.T, server *ssntpEchoServer, client *ssntpClient,
+	reconnect *ReconnectConfig) *Config {
+	server.t = t
+	serverConfig, err := buildTestConfig(SERVER)
+	if err != nil {
+		t.Fatalf("Could not build a test config")
+	}
+
+	client.t = t
+	clientConfig, err := buildTestConfig(AGENT)
+	if err != nil {
+		t.Fatalf("Could not build a test config")
+	}
+	clientConfig.Reconnect = reconnect
+
+	err = server.ssntp.ServeThreadSync(serverConfig, server)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	client.connected = make(chan struct{})
+	client.disconnected = make(chan struct{})
+	err = client.ssntp.Dial(clientConfig, client)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	select {
+	case <-client.connected:
+		break
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive the connection notification")
+	}
+
+	server.ssntp.Stop()
+
+	select {
+	case <-client.disconnected:
+		break
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Did not receive the disconnection notification")
+	}
+
+	return serverConfig
+}
+
+// Test SSNTP client frame queuing.
+//
+// Test that an event sent by an SSNTP client while its server
+// is down is sent to the server once it restarts.
+//
+// Test is expected to pass.
+func TestClientQueueReplay(t *testing.T) {
+	var server ssntpEchoServer
+	var client ssntpClient
+
+	serverConfig := reconnectTestClient(t, &server, &client,
+		&ReconnectConfig{Delay: 100 * time.Millisecond})
+	defer client.ssntp.Close()
+
+	client.payload = []byte{'Y', 'A', 'M', 'L'}
+	client.evtChannel = make(chan string)
+	_, err := client.ssntp.SendEvent(TenantAdded, client.payload)
+	if err != nil {
+		t.Fatalf("Could not queue event: %s", err)
+	}
+
+	client.connected = make(chan struct{})
+	err = server.ssntp.ServeThreadSync(serverConfig, &server)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer server.ssntp.Stop()
+
+	select {
+	case check := <-client.evtChannel:
+		if check != TenantAdded.String() {
+			t.Fatalf("Did not receive the right event %s", check)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Did not receive the queued event")
+	}
+}
+
+// Test SSNTP client error frame queuing.
+//
+// Test that an error sent by an SSNTP client while its server
+// is down is sent to the server once it restarts.
+//
+// Test is expected to pass.
+func TestClientQueueReplayError(t *testing.T) {
+	var server ssntpEchoServer
+	var client ssntpClient
+
+	serverConfig := reconnectTestClient(t, &server, &client,
+		&ReconnectConfig{Delay: 100 * time.Millisecond})
+	defer client.ssntp.Close()
+
+	client.payload = []byte{'Y', 'A', 'M', 'L'}
+	client.errChannel = make(chan string)
+	_, err := client.ssntp.SendError(StartFailure, client.payload)
+	if err != nil {
+		t.Fatalf("Could not queue error: %s", err)
+	}
+
+	client.connected = make(chan struct{})
+	err = server.ssntp.ServeThreadSync(serverConfig, &server)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer server.ssntp.Stop()
+
+	select {
+	case check := <-client.errChannel:
+		if check != StartFailure.String() {
+			t.Fatalf("Did not receive the right error %s", check)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Did not receive the queued error")
+	}
+}
+
+// Test SSNTP client frame queue length.
+//
+// Test that an SSNTP client rejects frames once its disconnected
+// frames queue is full.
+//
+// Test is expected to pass.
+func TestClientQueueFull(t *testing.T) {
+	var server ssntpEchoServer
+	var client ssntpClient
+
+	reconnectTestClient(t, &server, &client, &ReconnectConfig{QueueLength: 1})
+	defer client.ssntp.Close()
+
+	payload := []byte{'Y', 'A', 'M', 'L'}
+	_, err := client.ssntp.SendStatus(READY, payload)
+	if err != nil {
+		t.Fatalf("Could not queue status: %s", err)
+	}
+
+	_, err = client.ssntp.SendStatus(READY, payload)
+	if err == nil {
+		t.Fatalf("Status queued on a full queue")
+	}
+}
+
+// Test SSNTP client without automatic reconnection.
+//
+// Test that an SSNTP client not reconnecting is closed when
+// losing its server.
+//
+// Test is expected to pass.
+func TestClientReconnectDisabled(t *testing.T) {
+	var server ssntpEchoServer
+	var client ssntpClient
+
+	reconnectTestClient(t, &server, &client, &ReconnectConfig{Disable: true})
+	defer client.ssntp.Close()
+
+	payload := []byte{'Y', 'A', 'M', 'L'}
+	for i := 0; i < 10; i++ {
+		_, err := client.ssntp.SendEvent(TenantAdded, payload)
+		if err != nil {
+			return
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatalf("Client not closed")
+}
+
+// Test SSNTP client configuration re-sending.
+//
+// Test that a Controller client sends its last CONFIGURE command
+// again when reconnecting to its server.
+//
+// Test is expected to pass.
+func TestClientResendConfiguration(t *testing.T) {
+	var server ssntpEchoServer
+	var client ssntpClient
+
+	server.t = t
+	serverConfig, err := buildTestConfig(SERVER)
+	if err != nil {
+		t.Fatalf("Could not build a test config")
+	}
+
+	client.t = t
+	clientConfig, err := buildTestConfig(Controller)
+	if err != nil {
+		t.Fatalf("Could not build a test config")
+	}
+	clientConfig.Reconnect = &ReconnectConfig{Delay: 100 * time.Millisecond}
+
+	err = server.ssntp.ServeThreadSync(serverConfig, &server)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	client.cmdChannel = make(chan string)
+	client.disconnected = make(chan struct{})
+	err = client.ssntp.Dial(clientConfig, &client)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer client.ssntp.Close()
+
+	client.payload = []byte{'Y', 'A', 'M', 'L'}
+	_, err = client.ssntp.SendCommand(CONFIGURE, client.payload)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	select {
+	case <-client.cmdChannel:
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive the CONFIGURE command")
+	}
+
+	server.ssntp.Stop()
+
+	select {
+	case <-client.disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Did not receive the disconnection notification")
+	}
+
+	err = server.ssntp.ServeThreadSync(serverConfig, &server)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer server.ssntp.Stop()
+
+	select {
+	case check := <-client.cmdChannel:
+		if check != CONFIGURE.String() {
+			t.Fatalf("Did not receive the right command %s", check)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Did not receive the re-sent CONFIGURE command")
+	}
+}
+
 // Test SSNTP server Stop()
 //
 // Test that an SSNTP client properly receives its disconnection
@@ -1286,6 +1531,70 @@ func TestCommand(t *testing.T) {
 	}
 }
 
+// Test SSNTP legacy gob framing
+//
+// Test that an SSNTP client can connect to a server which does not
+// support the binary framing, e.g. a server older than SSNTP 0.3,
+// and send a Command frame to it, then receive it back consistently.
+//
+// Test is expected to pass.
+func TestCommandGobFraming(t *testing.T) {
+	var server ssntpEchoServer
+	var client ssntpClient
+
+	server.t = t
+	client.t = t
+	client.cmdChannel = make(chan string)
+	client.typeChannel = make(chan string)
+
+	serverConfig, err := buildTestConfig(SERVER)
+	if err != nil {
+		t.Fatalf("Could not build a test config")
+	}
+	serverConfig.Capabilities = FrameTracingCapability | ClusterConfigurationCapability
+
+	clientConfig, err := buildTestConfig(AGENT)
+	if err != nil {
+		t.Fatalf("Could not build a test config")
+	}
+
+	err = server.ssntp.ServeThreadSync(serverConfig, &server)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	err = client.ssntp.Dial(clientConfig, &client)
+	if err != nil {
+		t.Fatalf("Failed to connect")
+	}
+
+	client.payload = []byte{'Y', 'A', 'M', 'L'}
+	client.ssntp.SendCommand(START, client.payload)
+
+	defer func() {
+		client.ssntp.Close()
+		server.ssntp.Stop()
+	}()
+
+	select {
+	case frameType := <-client.typeChannel:
+		if frameType != COMMAND.String() {
+			t.Fatalf("Did not receive the right frame type")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive the command notification")
+	}
+
+	select {
+	case check := <-client.cmdChannel:
+		if check != START.String() {
+			t.Fatalf("Did not receive the right payload")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive the command notification")
+	}
+}
+
 // Test SSNTP Command traced frame label
 //
 // Test that an SSNTP client can send a traced Command frame to an echo
@@ -2483,6 +2792,10 @@ func TestCommandStringer(t *testing.T) {
 		{CONFIGURE, "CONFIGURE"},
 		{AttachVolume, "Attach storage volume"},
 		{DetachVolume, "Detach storage volume"},
+		{MIGRATE, "MIGRATE"},
+		{CreateImage, "Create instance image"},
+		{GetConsole, "Get instance console"},
+		{UpdateLimits, "Update instance limits"},
 	}
 
 	for _, test := range stringTests {
@@ -2526,6 +2839,9 @@ func TestEventStringer(t *testing.T) {
 		{TraceReport, "Trace Report"},
 		{NodeConnected, "Node Connected"},
 		{NodeDisconnected, "Node Disconnected"},
+		{InstanceEvacuated, "Instance Evacuated"},
+		{ControllerPromoted, "Controller Promoted"},
+		{ConsoleOutput, "Console Output"},
 	}
 
 	for _, test := range stringTests {
@@ -2549,6 +2865,10 @@ func TestErrorStringer(t *testing.T) {
 		{DeleteFailure, "Could not delete instance"},
 		{ConnectionAborted, "SSNTP Connection aborted"},
 		{InvalidConfiguration, "Cluster configuration is invalid"},
+		{MigrateFailure, "Could not migrate instance"},
+		{CreateImageFailure, "Could not create instance image"},
+		{GetConsoleFailure, "Could not get instance console"},
+		{UpdateLimitsFailure, "Could not update instance limits"},
 	}
 
 	for _, test := range stringTests {
@@ -2817,3 +3137,147 @@ func Benchmark100Clients100Frames65kB1msDelay(b *testing.B) {
 func BenchmarkDefaultMultiClientsMultiFrames(b *testing.B) {
 	benchmarkMultiClients(b, *payloadSize, *clients, *frames, *delay)
 }
+
+func TestCapabilityString(t *testing.T) {
+	var stringTests = []struct {
+		c        Capability
+		expected string
+	}{
+		{0, ""},
+		{FrameTracingCapability, "FrameTracing"},
+		{ClusterConfigurationCapability, "ClusterConfiguration"},
+		{BinaryFramingCapability, "BinaryFraming"},
+		{DefaultCapabilities, "FrameTracing-ClusterConfiguration-BinaryFraming"},
+	}
+
+	for _, test := range stringTests {
+		str := test.c.String()
+		if str != test.expected {
+			t.Errorf("expected \"%s\", got \"%s\"", test.expected, str)
+		}
+	}
+}
+
+// Test SSNTP capabilities negotiation
+//
+// Start a server with the default capabilities and connect a
+// client only advertising frame tracing, then verify that both
+// ends agree on frame tracing being the only negotiated capability.
+//
+// Test is expected to pass.
+func TestCapabilitiesNegotiation(t *testing.T) {
+	var server ssntpEchoServer
+	var client ssntpClient
+
+	server.t = t
+	server.roleConnectChannel = make(chan string)
+	serverConfig, err := buildTestConfig(SERVER)
+	if err != nil {
+		t.Fatalf("Could not build a test config")
+	}
+
+	client.t = t
+	clientConfig, err := buildTestConfig(AGENT)
+	if err != nil {
+		t.Fatalf("Could not build a test config")
+	}
+	clientConfig.Capabilities = FrameTracingCapability
+
+	err = server.ssntp.ServeThreadSync(serverConfig, &server)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer server.ssntp.Stop()
+
+	err = client.ssntp.Dial(clientConfig, &client)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer client.ssntp.Close()
+
+	select {
+	case <-server.roleConnectChannel:
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive the connection notification")
+	}
+
+	if c := client.ssntp.Capabilities(); c != FrameTracingCapability {
+		t.Errorf("Wrong client capabilities: expected %s got %s", FrameTracingCapability, c)
+	}
+
+	c, err := server.ssntp.ClientCapabilities(client.ssntp.UUID())
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if c != FrameTracingCapability {
+		t.Errorf("Wrong server capabilities: expected %s got %s", FrameTracingCapability, c)
+	}
+}
+
+func testRequiredCapabilities(t *testing.T, serverCapabilities, serverRequired,
+	clientCapabilities, clientRequired Capability) {
+	var server ssntpEchoServer
+	var client ssntpClient
+
+	server.t = t
+	serverConfig, err := buildTestConfig(SERVER)
+	if err != nil {
+		t.Fatalf("Could not build a test config")
+	}
+	serverConfig.Capabilities = serverCapabilities
+	serverConfig.RequiredCapabilities = serverRequired
+
+	client.t = t
+	clientConfig, err := buildTestConfig(AGENT)
+	if err != nil {
+		t.Fatalf("Could not build a test config")
+	}
+	clientConfig.Capabilities = clientCapabilities
+	clientConfig.RequiredCapabilities = clientRequired
+
+	err = server.ssntp.ServeThreadSync(serverConfig, &server)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer server.ssntp.Stop()
+
+	dialCh := make(chan error)
+	go func() {
+		dialCh <- client.ssntp.Dial(clientConfig, &client)
+	}()
+
+	select {
+	case err = <-dialCh:
+	case <-time.After(10 * time.Second):
+		client.ssntp.Close()
+		t.Fatalf("Dial did not return")
+	}
+
+	if err == nil {
+		client.ssntp.Close()
+		t.Fatalf("Connection should have been refused")
+	}
+}
+
+// Test SSNTP server required capabilities
+//
+// Start a server requiring the cluster configuration capability
+// and connect a client that does not advertise it.
+//
+// Test is expected to pass if the client connection is refused.
+func TestServerRequiredCapabilities(t *testing.T) {
+	testRequiredCapabilities(t, DefaultCapabilities, ClusterConfigurationCapability,
+		FrameTracingCapability, 0)
+}
+
+// Test SSNTP client required capabilities
+//
+// Connect a client requiring the cluster configuration capability
+// to a server that does not advertise it.
+//
+// Test is expected to pass if the client fails to connect.
+func TestClientRequiredCapabilities(t *testing.T) {
+	testRequiredCapabilities(t, FrameTracingCapability, 0,
+		DefaultCapabilities, ClusterConfigurationCapability)
+}
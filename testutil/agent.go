@@ -49,6 +49,10 @@ type SsntpTestClient struct {
 	AttachVolumeFailReason payloads.AttachVolumeFailureReason
 	DetachFail             bool
 	DetachVolumeFailReason payloads.DetachVolumeFailureReason
+	GetConsoleFail         bool
+	GetConsoleFailReason   payloads.GetConsoleFailureReason
+	UpdateLimitsFail       bool
+	UpdateLimitsFailReason payloads.UpdateLimitsFailureReason
 	traces                 []*ssntp.Frame
 	tracesLock             *sync.Mutex
 
@@ -455,6 +459,80 @@ func (client *SsntpTestClient) handleDelete(payload []byte) Result {
 	return result
 }
 
+func (client *SsntpTestClient) handleGetConsole(payload []byte) Result {
+	var result Result
+	var cmd payloads.GetConsole
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.InstanceUUID = cmd.GetConsole.InstanceUUID
+
+	if client.GetConsoleFail == true {
+		result.Err = errors.New(client.GetConsoleFailReason.String())
+		client.sendGetConsoleFailure(cmd.GetConsole.InstanceUUID, cmd.GetConsole.RequestUUID,
+			client.GetConsoleFailReason)
+		go client.SendResultAndDelErrorChan(ssntp.GetConsoleFailure, result)
+		return result
+	}
+
+	client.sendConsoleOutput(cmd.GetConsole.InstanceUUID, cmd.GetConsole.RequestUUID)
+
+	return result
+}
+
+func (client *SsntpTestClient) handleUpdateLimits(payload []byte) Result {
+	var result Result
+	var cmd payloads.UpdateLimits
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.InstanceUUID = cmd.UpdateLimits.InstanceUUID
+
+	if client.UpdateLimitsFail == true {
+		result.Err = errors.New(client.UpdateLimitsFailReason.String())
+		client.sendUpdateLimitsFailure(cmd.UpdateLimits.InstanceUUID, client.UpdateLimitsFailReason)
+		go client.SendResultAndDelErrorChan(ssntp.UpdateLimitsFailure, result)
+	}
+
+	return result
+}
+
+func (client *SsntpTestClient) handleAssignPublicIP(payload []byte) Result {
+	var result Result
+	var cmd payloads.CommandAssignPublicIP
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.InstanceUUID = cmd.AssignIP.InstanceUUID
+	return result
+}
+
+func (client *SsntpTestClient) handleReleasePublicIP(payload []byte) Result {
+	var result Result
+	var cmd payloads.CommandReleasePublicIP
+
+	err := yaml.Unmarshal(payload, &cmd)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.InstanceUUID = cmd.ReleaseIP.InstanceUUID
+	return result
+}
+
 func (client *SsntpTestClient) handleAttachVolume(payload []byte) Result {
 	var result Result
 	var cmd payloads.AttachVolume
@@ -522,8 +600,6 @@ func (client *SsntpTestClient) CommandNotify(command ssntp.Command, frame *ssntp
 	case ssntp.CONNECT:
 	case ssntp.STATS:
 	case ssntp.EVACUATE:
-	case ssntp.AssignPublicIP:
-	case ssntp.ReleasePublicIP:
 	case ssntp.CONFIGURE:
 	*/
 	case ssntp.START:
@@ -544,6 +620,18 @@ func (client *SsntpTestClient) CommandNotify(command ssntp.Command, frame *ssntp
 	case ssntp.DetachVolume:
 		result = client.handleDetachVolume(payload)
 
+	case ssntp.GetConsole:
+		result = client.handleGetConsole(payload)
+
+	case ssntp.UpdateLimits:
+		result = client.handleUpdateLimits(payload)
+
+	case ssntp.AssignPublicIP:
+		result = client.handleAssignPublicIP(payload)
+
+	case ssntp.ReleasePublicIP:
+		result = client.handleReleasePublicIP(payload)
+
 	default:
 		fmt.Fprintf(os.Stderr, "client %s unhandled command %s\n", client.Role.String(), command.String())
 	}
@@ -683,6 +771,56 @@ func (client *SsntpTestClient) SendDeleteEvent(uuid string) {
 	go client.SendResultAndDelEventChan(ssntp.InstanceDeleted, result)
 }
 
+func (client *SsntpTestClient) sendConsoleOutput(uuid, request string) {
+	var result Result
+
+	event := payloads.EventConsoleOutput{
+		ConsoleOutput: payloads.ConsoleOutputEvent{
+			InstanceUUID: uuid,
+			RequestUUID:  request,
+			Output:       ConsoleOutput,
+		},
+	}
+
+	y, err := yaml.Marshal(event)
+	if err != nil {
+		result.Err = err
+	} else {
+		_, err = client.Ssntp.SendEvent(ssntp.ConsoleOutput, y)
+		if err != nil {
+			result.Err = err
+		}
+	}
+
+	go client.SendResultAndDelEventChan(ssntp.ConsoleOutput, result)
+}
+
+// SendEvacuatedEvent allows an SsntpTestClient to push an ssntp.InstanceEvacuated event frame
+func (client *SsntpTestClient) SendEvacuatedEvent(uuid string) {
+	var result Result
+
+	evt := payloads.InstanceEvacuatedEvent{
+		InstanceUUID: uuid,
+		NodeUUID:     client.UUID,
+	}
+
+	event := payloads.EventInstanceEvacuated{
+		InstanceEvacuated: evt,
+	}
+
+	y, err := yaml.Marshal(event)
+	if err != nil {
+		result.Err = err
+	} else {
+		_, err = client.Ssntp.SendEvent(ssntp.InstanceEvacuated, y)
+		if err != nil {
+			result.Err = err
+		}
+	}
+
+	go client.SendResultAndDelEventChan(ssntp.InstanceEvacuated, result)
+}
+
 // SendTenantAddedEvent allows an SsntpTestClient to push an ssntp.TenantAdded event frame
 func (client *SsntpTestClient) SendTenantAddedEvent() {
 	var result Result
@@ -782,6 +920,41 @@ func (client *SsntpTestClient) sendStopFailure(instanceUUID string, reason paylo
 	}
 }
 
+func (client *SsntpTestClient) sendGetConsoleFailure(instanceUUID, requestUUID string, reason payloads.GetConsoleFailureReason) {
+	e := payloads.ErrorGetConsoleFailure{
+		InstanceUUID: instanceUUID,
+		RequestUUID:  requestUUID,
+		Reason:       reason,
+	}
+
+	y, err := yaml.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	_, err = client.Ssntp.SendError(ssntp.GetConsoleFailure, y)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func (client *SsntpTestClient) sendUpdateLimitsFailure(instanceUUID string, reason payloads.UpdateLimitsFailureReason) {
+	e := payloads.ErrorUpdateLimitsFailure{
+		InstanceUUID: instanceUUID,
+		Reason:       reason,
+	}
+
+	y, err := yaml.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	_, err = client.Ssntp.SendError(ssntp.UpdateLimitsFailure, y)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
 func (client *SsntpTestClient) sendRestartFailure(instanceUUID string, reason payloads.RestartFailureReason) {
 	e := payloads.ErrorRestartFailure{
 		InstanceUUID: instanceUUID,
@@ -323,6 +323,13 @@ func (ctl *SsntpTestController) EventNotify(event ssntp.Event, frame *ssntp.Fram
 		if err != nil {
 			result.Err = err
 		}
+	case ssntp.ControllerPromoted:
+		var promotedEvent payloads.EventControllerPromoted
+
+		err := yaml.Unmarshal(frame.Payload, &promotedEvent)
+		if err != nil {
+			result.Err = err
+		}
 	default:
 		fmt.Fprintf(os.Stderr, "controller unhandled event: %s\n", event.String())
 	}
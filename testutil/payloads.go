@@ -108,6 +108,9 @@ const NetAgentUUID = "6be56328-92e2-4ecd-b426-8fe529c04e0c"
 // AgentUUID is a node UUID for coordinated stop/restart/delete tests
 const AgentUUID = "4cb19522-1e18-439a-883a-f9b2a3a95f5e"
 
+// ControllerUUID is a Controller UUID for controller failover tests
+const ControllerUUID = "8e4b7dc9-4f3a-4a6e-9b2a-5d2c0c3e1f17"
+
 // VolumeUUID is a node UUID for storage tests
 const VolumeUUID = "67d86208-b46c-4465-9018-e14187d4010"
 
@@ -275,6 +278,101 @@ const EvacuateYaml = `evacuate:
   workload_agent_uuid: ` + AgentUUID + `
 `
 
+// EvacuateRebootYaml is a sample node EVACUATE ssntp.Command payload
+// requesting a reboot, for test cases
+const EvacuateRebootYaml = `evacuate:
+  workload_agent_uuid: ` + AgentUUID + `
+  next_state: reboot
+`
+
+// MigrationURI is a test destination URI for instance migrations
+const MigrationURI = "tcp:" + AgentIP + ":4444"
+
+// MigrateYaml is a sample workload MIGRATE ssntp.Command payload for test cases
+const MigrateYaml = `migrate:
+  instance_uuid: ` + InstanceUUID + `
+  workload_agent_uuid: ` + AgentUUID + `
+  destination_uri: ` + MigrationURI + `
+`
+
+// MigrateFailureYaml is a sample workload MigrateFailure ssntp.Error payload for test cases
+const MigrateFailureYaml = `instance_uuid: ` + InstanceUUID + `
+reason: not_running
+`
+
+// ConnectionFailureYaml is a sample ConnectionFailure ssntp.Error payload for test cases
+const ConnectionFailureYaml = `reason: missing_capabilities
+major: 0
+minor: 2
+capabilities: ClusterConfiguration
+`
+
+// ImageToken is a test identity token for uploading images
+const ImageToken = "a0b1c2d3e4f5"
+
+// CreateImageYaml is a sample CreateImage ssntp.Command payload for test cases
+const CreateImageYaml = `create_image:
+  instance_uuid: ` + InstanceUUID + `
+  workload_agent_uuid: ` + AgentUUID + `
+  image_uuid: ` + ImageUUID + `
+  image_service_url: ` + GlanceURL + `
+  token: ` + ImageToken + `
+`
+
+// CreateImageFailureYaml is a sample CreateImageFailure ssntp.Error payload for test cases
+const CreateImageFailureYaml = `instance_uuid: ` + InstanceUUID + `
+image_uuid: ` + ImageUUID + `
+reason: upload_failure
+`
+
+// GetConsoleYaml is a sample GetConsole ssntp.Command payload for test cases
+const GetConsoleYaml = `get_console:
+  instance_uuid: ` + InstanceUUID + `
+  workload_agent_uuid: ` + AgentUUID + `
+  lines: 50
+  request_uuid: ` + ConsoleRequestUUID + `
+`
+
+// ConsoleRequestUUID is a console request UUID for test cases
+const ConsoleRequestUUID = "9d1f5c0e-6c3a-4d8b-a2f4-3b7e1c0d9a52"
+
+// ConsoleOutput is a sample instance console log for test cases
+const ConsoleOutput = "ciao login:"
+
+// ConsoleOutputYaml is a sample ConsoleOutput ssntp.Event payload for test cases
+const ConsoleOutputYaml = `console_output:
+  instance_uuid: ` + InstanceUUID + `
+  request_uuid: ` + ConsoleRequestUUID + `
+  output: '` + ConsoleOutput + `'
+`
+
+// GetConsoleFailureYaml is a sample GetConsoleFailure ssntp.Error payload for test cases
+const GetConsoleFailureYaml = `instance_uuid: ` + InstanceUUID + `
+request_uuid: ` + ConsoleRequestUUID + `
+reason: no_log
+`
+
+// UpdateLimitsYaml is a sample UpdateLimits ssntp.Command payload for test cases
+const UpdateLimitsYaml = `update_limits:
+  instance_uuid: ` + InstanceUUID + `
+  workload_agent_uuid: ` + AgentUUID + `
+  limits:
+  - type: cpu_shares
+    value: 512
+    mandatory: false
+  - type: mem_limit_mb
+    value: 2048
+    mandatory: false
+  - type: disk_iops
+    value: 100
+    mandatory: false
+`
+
+// UpdateLimitsFailureYaml is a sample UpdateLimitsFailure ssntp.Error payload for test cases
+const UpdateLimitsFailureYaml = `instance_uuid: ` + InstanceUUID + `
+reason: apply_failure
+`
+
 // CNCIAddedYaml is a sample ConcentratorInstanceAdded ssntp.Event payload for test cases
 const CNCIAddedYaml = `concentrator_instance_added:
   instance_uuid: ` + CNCIUUID + `
@@ -375,12 +473,43 @@ const InsDelYaml = `instance_deleted:
   instance_uuid: ` + InstanceUUID + `
 `
 
+// InsEvacuatedYaml is a sample workload InstanceEvacuated ssntp.Event payload for test cases
+const InsEvacuatedYaml = `instance_evacuated:
+  instance_uuid: ` + InstanceUUID + `
+  node_uuid: ` + AgentUUID + `
+`
+
 // NodeConnectedYaml is a sample node NodeConnected ssntp.Event payload for test cases
 const NodeConnectedYaml = `node_connected:
   node_uuid: ` + AgentUUID + `
   node_type: ` + payloads.NetworkNode + `
 `
 
+// ControllerPromotedYaml is a sample ControllerPromoted ssntp.Event payload for test cases
+const ControllerPromotedYaml = `controller_promoted:
+  controller_uuid: ` + ControllerUUID + `
+  node_stats:
+  - node_uuid: ` + AgentUUID + `
+    status: READY
+    mem_total_mb: 3896
+    mem_available_mb: 3896
+    disk_total_mb: 500000
+    disk_available_mb: 256000
+    load: 0
+    cpus_online: 4
+    hostname: ""
+    networks: []
+    instances:
+    - instance_uuid: ` + InstanceUUID + `
+      state: active
+      ssh_ip: ""
+      ssh_port: 0
+      memory_usage_mb: 100
+      disk_usage_mb: 200
+      cpu_usage: 10
+      volumes: []
+`
+
 // ReadyPayload is a helper to craft a mostly fixed ssntp.READY status
 // payload, with parameters to specify the source node uuid and memory metrics
 func ReadyPayload(uuid string, memTotal int, memAvail int) payloads.Ready {
@@ -391,7 +520,7 @@ func ReadyPayload(uuid string, memTotal int, memAvail int) payloads.Ready {
 		DiskTotalMB:     500000,
 		DiskAvailableMB: 256000,
 		Load:            0,
-		CpusOnline:      4,
+		CpusOnline:      64,
 	}
 	return p
 }
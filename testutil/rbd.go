@@ -0,0 +1,219 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package testutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// fakeRBDScript stores rbd images as files of the images directory and
+// snapshots as image@snapshot files of the snaps directory. Protected
+// snapshots have an entry in the protected directory.
+const fakeRBDScript = `#!/bin/sh
+store=$(dirname "$(dirname "$0")")
+images=$store/images
+snaps=$store/snaps
+protected=$store/protected
+
+fail() {
+	echo "rbd: $*" >&2
+	exit 1
+}
+
+size() {
+	wc -c < "$1" | tr -d ' '
+}
+
+resolve() {
+	case "$1" in
+	*@*) f=$snaps/$1 ;;
+	*) f=$images/$1 ;;
+	esac
+	[ -e "$f" ] || fail "$1 does not exist"
+	echo "$f"
+}
+
+long=false
+size=0
+args=""
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--id|--image-format|--image-feature|--format|--pool) shift 2 ;;
+	--size) size=$2; shift 2 ;;
+	-l) long=true; shift ;;
+	*) args="$args $1"; shift ;;
+	esac
+done
+set -- $args
+
+case "$1" in
+import)
+	[ -e "$images/$3" ] && fail "image $3 already exists"
+	if [ "$2" = "-" ]; then
+		cat > "$images/$3" || exit 1
+	else
+		cp "$2" "$images/$3" || exit 1
+	fi
+	;;
+export)
+	file=$(resolve "$2") || exit 1
+	if [ "$3" = "-" ]; then
+		cat "$file"
+	else
+		cp "$file" "$3"
+	fi
+	;;
+info)
+	file=$(resolve "$2") || exit 1
+	printf '{"name":"%s","size":%s,"format":2}\n' "${2%%@*}" "$(size "$file")"
+	;;
+ls)
+	sep=""
+	printf '['
+	for i in $(ls "$images"); do
+		if [ "$long" = "false" ]; then
+			printf '%s"%s"' "$sep" "$i"
+			sep=","
+			continue
+		fi
+		printf '%s{"image":"%s","size":%s,"format":2}' "$sep" "$i" "$(size "$images/$i")"
+		sep=","
+		for s in $(ls "$snaps" | grep "^$i@"); do
+			p=false
+			[ -e "$protected/$s" ] && p=true
+			printf ',{"image":"%s","snapshot":"%s","size":%s,"format":2,"protected":"%s"}' \
+				"$i" "${s#*@}" "$(size "$snaps/$s")" "$p"
+		done
+	done
+	printf ']\n'
+	;;
+snap)
+	case "$2" in
+	create)
+		file=$(resolve "${3%%@*}") || exit 1
+		[ -e "$snaps/$3" ] && fail "snapshot $3 already exists"
+		cp "$file" "$snaps/$3"
+		;;
+	protect)
+		resolve "$3" > /dev/null || exit 1
+		touch "$protected/$3"
+		;;
+	unprotect)
+		[ -e "$protected/$3" ] || fail "snapshot $3 is not protected"
+		rm "$protected/$3"
+		;;
+	purge)
+		resolve "$3" > /dev/null || exit 1
+		for s in $(ls "$snaps" | grep "^$3@"); do
+			[ -e "$protected/$s" ] && fail "snapshot $s is protected"
+			rm "$snaps/$s"
+		done
+		;;
+	*)
+		fail "unsupported snap command $2"
+		;;
+	esac
+	;;
+rm)
+	resolve "$2" > /dev/null || exit 1
+	ls "$snaps" | grep -q "^$2@" && fail "image $2 has snapshots"
+	rm "$images/$2"
+	;;
+clone)
+	[ -e "$protected/$2" ] || fail "snapshot $2 is not protected"
+	[ -e "$images/$3" ] && fail "image $3 already exists"
+	cp "$snaps/$2" "$images/$3"
+	;;
+cp)
+	file=$(resolve "$2") || exit 1
+	[ -e "$images/$3" ] && fail "image $3 already exists"
+	cp "$file" "$images/$3"
+	;;
+create)
+	[ -e "$images/$2" ] && fail "image $2 already exists"
+	truncate -s "$size" "$images/$2"
+	;;
+*)
+	fail "unsupported command $1"
+	;;
+esac
+`
+
+// FakeRBD emulates, on top of a temporary directory, the subset of the
+// rbd command line used by ciao, so that the ceph backed code can be
+// tested without a ceph cluster.
+type FakeRBD struct {
+	// Dir holds the fake rbd command and the images it manages.
+	Dir string
+
+	path string
+}
+
+// NewFakeRBD creates a fake rbd command and puts it first in the PATH.
+// Close must be called to restore the PATH.
+func NewFakeRBD() (*FakeRBD, error) {
+	dir, err := ioutil.TempDir("", "ciao-fake-rbd")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range []string{"bin", "images", "snaps", "protected"} {
+		err = os.Mkdir(path.Join(dir, d), 0755)
+		if err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	bin := path.Join(dir, "bin")
+
+	err = ioutil.WriteFile(path.Join(bin, "rbd"), []byte(fakeRBDScript), 0755)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	f := &FakeRBD{
+		Dir:  dir,
+		path: os.Getenv("PATH"),
+	}
+
+	err = os.Setenv("PATH", bin+string(os.PathListSeparator)+f.path)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ImagePath returns the path of the file holding the data of an rbd image.
+func (f *FakeRBD) ImagePath(name string) string {
+	return path.Join(f.Dir, "images", name)
+}
+
+// Close restores the PATH and removes the fake rbd command and its images.
+func (f *FakeRBD) Close() error {
+	err := os.Setenv("PATH", f.path)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(f.Dir)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	. "github.com/01org/ciao/testutil"
+)
+
+func TestFakeRBD(t *testing.T) {
+	path := os.Getenv("PATH")
+
+	rbd, err := NewFakeRBD()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("rbd", "--id", "ciao", "import", "-", "image")
+	cmd.Stdin = strings.NewReader("image data")
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args    []string
+		success bool
+		output  string
+	}{
+		{[]string{"import", "-", "image"}, false, ""},
+		{[]string{"snap", "create", "image@snap"}, true, ""},
+		{[]string{"clone", "image@snap", "clone"}, false, ""},
+		{[]string{"snap", "protect", "image@snap"}, true, ""},
+		{[]string{"clone", "image@snap", "clone"}, true, ""},
+		{[]string{"info", "--format", "json", "clone"}, true, `{"name":"clone","size":10,"format":2}` + "\n"},
+		{[]string{"export", "image@snap", "-"}, true, "image data"},
+		{[]string{"ls", "--format", "json"}, true, `["clone","image"]` + "\n"},
+		{[]string{"ls", "-l", "--format", "json"}, true, `[{"image":"clone","size":10,"format":2},` +
+			`{"image":"image","size":10,"format":2},` +
+			`{"image":"image","snapshot":"snap","size":10,"format":2,"protected":"true"}]` + "\n"},
+		{[]string{"rm", "image"}, false, ""},
+		{[]string{"snap", "purge", "image"}, false, ""},
+		{[]string{"snap", "unprotect", "image@snap"}, true, ""},
+		{[]string{"snap", "purge", "image"}, true, ""},
+		{[]string{"rm", "image"}, true, ""},
+		{[]string{"info", "image"}, false, ""},
+	}
+
+	for _, test := range tests {
+		out, err := exec.Command("rbd", test.args...).Output()
+		if (err == nil) != test.success {
+			t.Errorf("rbd %v: expected success %t, got %v", test.args, test.success, err)
+		}
+
+		if test.success && string(out) != test.output {
+			t.Errorf("rbd %v: expected output %q, got %q", test.args, test.output, string(out))
+		}
+	}
+
+	data, err := ioutil.ReadFile(rbd.ImagePath("clone"))
+	if err != nil || string(data) != "image data" {
+		t.Errorf("Wrong clone data %q: %v", string(data), err)
+	}
+
+	err = rbd.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if os.Getenv("PATH") != path {
+		t.Errorf("PATH not restored")
+	}
+
+	_, err = os.Stat(rbd.Dir)
+	if !os.IsNotExist(err) {
+		t.Errorf("%s not removed: %v", rbd.Dir, err)
+	}
+}
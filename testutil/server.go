@@ -367,8 +367,6 @@ func (server *SsntpTestServer) CommandNotify(uuid string, command ssntp.Command,
 	switch command {
 	/*TODO:
 	case CONNECT:
-	case AssignPublicIP:
-	case ReleasePublicIP:
 	case CONFIGURE:
 	*/
 	case ssntp.START:
@@ -425,6 +423,56 @@ func (server *SsntpTestServer) CommandNotify(uuid string, command ssntp.Command,
 	case ssntp.DetachVolume:
 		getDetachVolumeResult(payload, &result)
 
+	case ssntp.CreateImage:
+		var createCmd payloads.CreateImage
+
+		err := yaml.Unmarshal(payload, &createCmd)
+		result.Err = err
+		if err == nil {
+			result.InstanceUUID = createCmd.CreateImage.InstanceUUID
+			result.NodeUUID = createCmd.CreateImage.WorkloadAgentUUID
+		}
+
+	case ssntp.GetConsole:
+		var consoleCmd payloads.GetConsole
+
+		err := yaml.Unmarshal(payload, &consoleCmd)
+		result.Err = err
+		if err == nil {
+			result.InstanceUUID = consoleCmd.GetConsole.InstanceUUID
+			result.NodeUUID = consoleCmd.GetConsole.WorkloadAgentUUID
+			server.Ssntp.SendCommand(consoleCmd.GetConsole.WorkloadAgentUUID, command, frame.Payload)
+		}
+
+	case ssntp.UpdateLimits:
+		var limitsCmd payloads.UpdateLimits
+
+		err := yaml.Unmarshal(payload, &limitsCmd)
+		result.Err = err
+		if err == nil {
+			result.InstanceUUID = limitsCmd.UpdateLimits.InstanceUUID
+			result.NodeUUID = limitsCmd.UpdateLimits.WorkloadAgentUUID
+			server.Ssntp.SendCommand(limitsCmd.UpdateLimits.WorkloadAgentUUID, command, frame.Payload)
+		}
+
+	case ssntp.AssignPublicIP:
+		var assignCmd payloads.CommandAssignPublicIP
+
+		err := yaml.Unmarshal(payload, &assignCmd)
+		result.Err = err
+		if err == nil {
+			result.InstanceUUID = assignCmd.AssignIP.InstanceUUID
+		}
+
+	case ssntp.ReleasePublicIP:
+		var releaseCmd payloads.CommandReleasePublicIP
+
+		err := yaml.Unmarshal(payload, &releaseCmd)
+		result.Err = err
+		if err == nil {
+			result.InstanceUUID = releaseCmd.ReleaseIP.InstanceUUID
+		}
+
 	default:
 		fmt.Fprintf(os.Stderr, "server unhandled command %s\n", command.String())
 	}
@@ -453,8 +501,15 @@ func (server *SsntpTestServer) EventNotify(uuid string, event ssntp.Event, frame
 		var deleteEvent payloads.EventInstanceDeleted
 
 		result.Err = yaml.Unmarshal(payload, &deleteEvent)
+	case ssntp.InstanceEvacuated:
+		var evacuatedEvent payloads.EventInstanceEvacuated
+
+		result.Err = yaml.Unmarshal(payload, &evacuatedEvent)
+		result.NodeUUID = evacuatedEvent.InstanceEvacuated.NodeUUID
 	case ssntp.ConcentratorInstanceAdded:
 		// forward rule auto-sends to controllers
+	case ssntp.ConsoleOutput:
+		// forward rule auto-sends to controllers
 	case ssntp.TenantAdded:
 		// forwards to CNCI via server.EventForward()
 	case ssntp.TenantRemoved:
@@ -636,6 +691,30 @@ func (server *SsntpTestServer) handleDetachVolume(payload []byte) ssntp.ForwardD
 	return dest
 }
 
+func (server *SsntpTestServer) handlePublicIP(command ssntp.Command, payload []byte) (dest ssntp.ForwardDestination) {
+	var concentratorUUID string
+
+	if command == ssntp.AssignPublicIP {
+		var cmd payloads.CommandAssignPublicIP
+		if yaml.Unmarshal(payload, &cmd) == nil {
+			concentratorUUID = cmd.AssignIP.ConcentratorUUID
+		}
+	} else {
+		var cmd payloads.CommandReleasePublicIP
+		if yaml.Unmarshal(payload, &cmd) == nil {
+			concentratorUUID = cmd.ReleaseIP.ConcentratorUUID
+		}
+	}
+
+	if concentratorUUID == "" {
+		dest.SetDecision(ssntp.Discard)
+		return
+	}
+
+	dest.AddRecipient(concentratorUUID)
+	return
+}
+
 // CommandForward implements an SSNTP CommandForward callback for SsntpTestServer
 func (server *SsntpTestServer) CommandForward(uuid string, command ssntp.Command, frame *ssntp.Frame) (dest ssntp.ForwardDestination) {
 	payload := frame.Payload
@@ -647,6 +726,10 @@ func (server *SsntpTestServer) CommandForward(uuid string, command ssntp.Command
 		dest = server.handleAttachVolume(payload)
 	case ssntp.DetachVolume:
 		dest = server.handleDetachVolume(payload)
+	case ssntp.AssignPublicIP:
+		fallthrough
+	case ssntp.ReleasePublicIP:
+		dest = server.handlePublicIP(command, payload)
 	case ssntp.EVACUATE:
 		fallthrough
 	case ssntp.STOP:
@@ -698,6 +781,10 @@ func StartTestServer() *SsntpTestServer {
 				Operand: ssntp.InstanceDeleted,
 				Dest:    ssntp.Controller,
 			},
+			{ // all InstanceEvacuated events go to all Controllers
+				Operand: ssntp.InstanceEvacuated,
+				Dest:    ssntp.Controller,
+			},
 			{ // all ConcentratorInstanceAdded events go to all Controllers
 				Operand: ssntp.ConcentratorInstanceAdded,
 				Dest:    ssntp.Controller,
@@ -726,6 +813,18 @@ func StartTestServer() *SsntpTestServer {
 				Operand: ssntp.DetachVolumeFailure,
 				Dest:    ssntp.Controller,
 			},
+			{ // all ConsoleOutput events go to all Controllers
+				Operand: ssntp.ConsoleOutput,
+				Dest:    ssntp.Controller,
+			},
+			{ // all GetConsoleFailure events go to all Controllers
+				Operand: ssntp.GetConsoleFailure,
+				Dest:    ssntp.Controller,
+			},
+			{ // all UpdateLimitsFailure events go to all Controllers
+				Operand: ssntp.UpdateLimitsFailure,
+				Dest:    ssntp.Controller,
+			},
 			{ // all PublicIPAssigned events go to all Controllers
 				Operand: ssntp.PublicIPAssigned,
 				Dest:    ssntp.Controller,
@@ -766,6 +865,14 @@ func StartTestServer() *SsntpTestServer {
 				Operand:        ssntp.DetachVolume,
 				CommandForward: server,
 			},
+			{ // all AssignPublicIP commands are processed by the Command forwarder
+				Operand:        ssntp.AssignPublicIP,
+				CommandForward: server,
+			},
+			{ // all ReleasePublicIP commands are processed by the Command forwarder
+				Operand:        ssntp.ReleasePublicIP,
+				CommandForward: server,
+			},
 		},
 	}
 